@@ -15,6 +15,8 @@ const (
 	ContextStep                           // Inside a step object (label, command, plugins, etc.)
 	ContextPlugins                        // Inside a plugins array (plugin names)
 	ContextPluginConfig                   // Inside a specific plugin configuration
+	ContextTriggerBuild                   // Inside a trigger step's build (message, commit, branch, ...)
+	ContextRetryManual                    // Inside a step's retry.manual (allowed, permit_on_passed, reason)
 )
 
 // ContextInfo provides detailed information about the completion context
@@ -59,7 +61,92 @@ func (a *Analyzer) AnalyzeContext(posCtx *PositionContext) *ContextInfo {
 	charIndex := posCtx.CharIndex
 
 	// Build context by analyzing indentation and keys
-	return a.analyzeYAMLStructure(lines, currentLine, charIndex)
+	context := a.analyzeYAMLStructure(lines, currentLine, charIndex)
+
+	// A trigger step's build takes the keys of the build it creates, not a step's
+	if context.Type == ContextStep && !context.InArray && len(context.ParentKeys) > 0 && context.ParentKeys[len(context.ParentKeys)-1] == "build" {
+		allLines := lines
+		if posCtx.FullContent != "" {
+			allLines = strings.Split(posCtx.FullContent, "\n")
+		}
+		if isTriggerBuild(allLines, len(lines)-1) {
+			context.Type = ContextTriggerBuild
+		}
+	}
+
+	// retry.manual takes its own keys too
+	if context.Type == ContextStep && !context.InArray && len(context.ParentKeys) > 1 &&
+		context.ParentKeys[len(context.ParentKeys)-2] == "retry" && context.ParentKeys[len(context.ParentKeys)-1] == "manual" {
+		context.Type = ContextRetryManual
+	}
+	return context
+}
+
+// isTriggerBuild reports whether the line is inside the build of a trigger step: whether
+// the key enclosing it is build, and the step with that key has a trigger key too
+func isTriggerBuild(lines []string, line int) bool {
+	if line < 0 || line >= len(lines) {
+		return false
+	}
+
+	// The build key is the closest line above indented less than the line
+	indent := getIndentLevel(lines[line])
+	buildLine := -1
+	for i := line - 1; i >= 0; i-- {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if getIndentLevel(lines[i]) < indent {
+			buildLine = i
+			break
+		}
+	}
+	if buildLine < 0 {
+		return false
+	}
+	build := parseKeyFromLine(lines[buildLine], getIndentLevel(lines[buildLine]))
+	if build == nil || build.Key != "build" {
+		return false
+	}
+
+	// The step's keys are level with build, the first of them after the list item's dash
+	keyIndent := build.IndentLevel
+	if strings.HasPrefix(strings.TrimSpace(lines[buildLine]), "- ") {
+		keyIndent += 2
+	}
+	start := buildLine
+	for start >= 0 && !strings.HasPrefix(strings.TrimSpace(lines[start]), "- ") {
+		trimmed := strings.TrimSpace(lines[start])
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") && getIndentLevel(lines[start]) < keyIndent {
+			return false
+		}
+		start--
+	}
+	if start < 0 || getIndentLevel(lines[start])+2 != keyIndent {
+		return false
+	}
+
+	for i := start; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		lineIndent := getIndentLevel(lines[i])
+		if i > start && lineIndent < keyIndent {
+			break
+		}
+		if i == start {
+			lineIndent += 2
+		}
+		if lineIndent != keyIndent {
+			continue
+		}
+		if key := parseKeyFromLine(lines[i], lineIndent); key != nil && key.Key == "trigger" {
+			return true
+		}
+	}
+	return false
 }
 
 // analyzeYAMLStructure analyzes the YAML structure to determine context
@@ -128,6 +215,31 @@ type KeyInfo struct {
 	HasValue    bool
 }
 
+// KeyColon returns the index of the colon that ends the mapping key text starts with, or -1
+// when text isn't a key. Plain keys end at the first colon followed by a space or the end of
+// the line, so keys such as "ssh://git@host/repo#v1.0" keep the colons inside them.
+func KeyColon(text string) int {
+	start := 0
+	if len(text) > 0 && (text[0] == '"' || text[0] == '\'') {
+		end := strings.IndexByte(text[1:], text[0])
+		if end < 0 {
+			return -1
+		}
+		start = end + 2
+	}
+
+	for i := start; i < len(text); i++ {
+		if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ' || text[i+1] == '\t') {
+			return i
+		}
+		if text[i] == ' ' && i+1 < len(text) && text[i+1] == '#' {
+			// A comment starts before any key colon
+			return -1
+		}
+	}
+	return -1
+}
+
 // parseKeyFromLine extracts key information from a YAML line
 func parseKeyFromLine(line string, indent int) *KeyInfo {
 	trimmed := strings.TrimSpace(line)
@@ -137,8 +249,8 @@ func parseKeyFromLine(line string, indent int) *KeyInfo {
 		arrayItemContent := strings.TrimSpace(trimmed[2:]) // Remove "- " prefix
 
 		// Check if the array item has a key: pattern
-		if colonIndex := strings.Index(arrayItemContent, ":"); colonIndex != -1 {
-			key := strings.TrimSpace(arrayItemContent[:colonIndex])
+		if colonIndex := KeyColon(arrayItemContent); colonIndex != -1 {
+			key := strings.Trim(strings.TrimSpace(arrayItemContent[:colonIndex]), `"'`)
 			afterColon := strings.TrimSpace(arrayItemContent[colonIndex+1:])
 
 			return &KeyInfo{
@@ -154,8 +266,8 @@ func parseKeyFromLine(line string, indent int) *KeyInfo {
 	}
 
 	// Look for key: value pattern in regular lines
-	if colonIndex := strings.Index(trimmed, ":"); colonIndex != -1 {
-		key := strings.TrimSpace(trimmed[:colonIndex])
+	if colonIndex := KeyColon(trimmed); colonIndex != -1 {
+		key := strings.Trim(strings.TrimSpace(trimmed[:colonIndex]), `"'`)
 		afterColon := strings.TrimSpace(trimmed[colonIndex+1:])
 
 		return &KeyInfo{
@@ -204,6 +316,7 @@ func (a *Analyzer) determineContextFromStack(context *ContextInfo, keyStack []Ke
 		// If we find "steps", we know we're in a step context
 		if key.Key == "steps" {
 			context.Type = ContextStep
+			markArray(context, keyStack)
 			return context
 		}
 	}
@@ -211,14 +324,36 @@ func (a *Analyzer) determineContextFromStack(context *ContextInfo, keyStack []Ke
 	// Check if we're at top level (no nesting)
 	if len(keyStack) <= 1 {
 		context.Type = ContextTopLevel
+		markArray(context, keyStack)
 		return context
 	}
 
 	// Default to step context if we're nested
 	context.Type = ContextStep
+	markArray(context, keyStack)
 	return context
 }
 
+// arrayKeys are the pipeline and step properties whose values are lists of items
+var arrayKeys = map[string]bool{
+	"steps":          true,
+	"commands":       true,
+	"depends_on":     true,
+	"artifact_paths": true,
+	"fields":         true,
+	"notify":         true,
+}
+
+// markArray records when the cursor sits directly inside a list property, such as the
+// items of `commands:`
+func markArray(context *ContextInfo, keyStack []KeyInfo) {
+	innermost := keyStack[len(keyStack)-1]
+	if innermost.IsArray && arrayKeys[innermost.Key] {
+		context.InArray = true
+		context.ArrayContext = innermost.Key
+	}
+}
+
 // getIndentLevel calculates the indentation level of a line
 func getIndentLevel(line string) int {
 	indent := 0
@@ -259,6 +394,16 @@ func (info *ContextInfo) IsAtTopLevel() bool {
 	return info.Type == ContextTopLevel
 }
 
+// IsInTriggerBuild checks if the cursor is inside the build of a trigger step
+func (info *ContextInfo) IsInTriggerBuild() bool {
+	return info.Type == ContextTriggerBuild
+}
+
+// IsInRetryManual checks if the cursor is inside a step's manual retry settings
+func (info *ContextInfo) IsInRetryManual() bool {
+	return info.Type == ContextRetryManual
+}
+
 // IsInStepContext checks if the cursor is inside a step object
 func (info *ContextInfo) IsInStepContext() bool {
 	return info.Type == ContextStep
@@ -91,6 +91,57 @@ func TestAnalyzeContext_PluginsArray(t *testing.T) {
 	}
 }
 
+func TestAnalyzeContext_StepArray(t *testing.T) {
+	analyzer := NewAnalyzer()
+
+	tests := []struct {
+		name          string
+		lines         []string
+		expectedArray string
+	}{
+		{
+			name:          "empty line under commands",
+			lines:         []string{"steps:", "  - label: \"test\"", "    commands:", "      - \"make\"", "      "},
+			expectedArray: "commands",
+		},
+		{
+			name:          "empty line under depends_on",
+			lines:         []string{"steps:", "  - command: \"make\"", "    depends_on:", "      "},
+			expectedArray: "depends_on",
+		},
+		{
+			name:          "sibling of commands",
+			lines:         []string{"steps:", "  - label: \"test\"", "    commands:", "      - \"make\"", "    "},
+			expectedArray: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			currentLine := tt.lines[len(tt.lines)-1]
+			result := analyzer.AnalyzeContext(&PositionContext{
+				Position:     protocol.Position{Line: uint32(len(tt.lines) - 1), Character: uint32(len(currentLine))},
+				CurrentLine:  currentLine,
+				CharIndex:    len(currentLine),
+				ContextLines: tt.lines,
+				FullContent:  strings.Join(tt.lines, "\n"),
+			})
+
+			if result.Type != ContextStep {
+				t.Errorf("Expected ContextStep, got %v", result.Type)
+			}
+
+			if result.ArrayContext != tt.expectedArray {
+				t.Errorf("Expected array context %q, got %q", tt.expectedArray, result.ArrayContext)
+			}
+
+			if result.InArray != (tt.expectedArray != "") {
+				t.Errorf("Expected InArray %v, got %v", tt.expectedArray != "", result.InArray)
+			}
+		})
+	}
+}
+
 func TestAnalyzeContext_PluginConfig(t *testing.T) {
 	analyzer := NewAnalyzer()
 
@@ -232,7 +283,11 @@ func TestParseKeyFromLine(t *testing.T) {
 		{"    command: echo hello", 4, &KeyInfo{Key: "command", IndentLevel: 4, IsArray: false, HasValue: true}},
 		{"    retry: []", 4, &KeyInfo{Key: "retry", IndentLevel: 4, IsArray: true, HasValue: false}},
 		{"  - docker#v5.13.0:", 2, &KeyInfo{Key: "docker#v5.13.0", IndentLevel: 2, IsArray: true, HasValue: false}}, // Array items with keys are parsed
-		{"", 0, nil}, // Empty lines return nil
+		{"  - ssh://git@host/repo#v1.0:", 2, &KeyInfo{Key: "ssh://git@host/repo#v1.0", IndentLevel: 2, IsArray: true, HasValue: false}},
+		{"  - \"git@host:org/repo#v1\": {}", 2, &KeyInfo{Key: "git@host:org/repo#v1", IndentLevel: 2, IsArray: false, HasValue: true}},
+		{"    image: node:20", 4, &KeyInfo{Key: "image", IndentLevel: 4, IsArray: false, HasValue: true}},
+		{"    command:make", 4, nil}, // Not a key without the space after the colon
+		{"", 0, nil},                 // Empty lines return nil
 	}
 
 	for _, test := range tests {
@@ -263,3 +318,126 @@ func TestParseKeyFromLine(t *testing.T) {
 		}
 	}
 }
+
+func TestKeyColon(t *testing.T) {
+	tests := map[string]int{
+		"command: make":                7,
+		"command:":                     7,
+		"image: node:20":               5,
+		"ssh://git@host/repo#v1.0:":    24,
+		"git@host:org/repo.git#v1: {}": 24,
+		`"a: b": value`:                6,
+		"command:make":                 -1,
+		"- item":                       -1,
+		"echo # not: a key":            -1,
+		`"unterminated: value`:         -1,
+		"http://example.com/hook":      -1,
+	}
+	for text, expected := range tests {
+		if got := KeyColon(text); got != expected {
+			t.Errorf("KeyColon(%q) = %d, expected %d", text, got, expected)
+		}
+	}
+}
+
+func TestAnalyzeContext_TriggerBuild(t *testing.T) {
+	analyzer := NewAnalyzer()
+
+	tests := []struct {
+		name     string
+		content  string
+		line     int
+		expected CompletionContext
+	}{
+		{
+			name:     "build of a trigger step",
+			content:  "steps:\n  - trigger: deploy\n    build:\n      message: Deploy\n      \n",
+			line:     4,
+			expected: ContextTriggerBuild,
+		},
+		{
+			name:     "trigger key after build",
+			content:  "steps:\n  - label: Deploy\n    build:\n      \n    trigger: deploy\n",
+			line:     3,
+			expected: ContextTriggerBuild,
+		},
+		{
+			name:     "build of a command step",
+			content:  "steps:\n  - command: make\n    build:\n      \n  - trigger: deploy\n",
+			line:     3,
+			expected: ContextStep,
+		},
+		{
+			name:     "env inside the build",
+			content:  "steps:\n  - trigger: deploy\n    build:\n      env:\n        \n",
+			line:     4,
+			expected: ContextStep,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := strings.Split(tt.content, "\n")
+			currentLine := lines[tt.line]
+			result := analyzer.AnalyzeContext(&PositionContext{
+				Position:     protocol.Position{Line: uint32(tt.line), Character: uint32(len(currentLine))},
+				CurrentLine:  currentLine,
+				CharIndex:    len(currentLine),
+				ContextLines: lines[:tt.line+1],
+				FullContent:  tt.content,
+			})
+
+			if result.Type != tt.expected {
+				t.Errorf("Expected context %v, got %v (parents %v)", tt.expected, result.Type, result.ParentKeys)
+			}
+		})
+	}
+}
+
+func TestAnalyzeContext_RetryManual(t *testing.T) {
+	analyzer := NewAnalyzer()
+
+	tests := []struct {
+		name     string
+		content  string
+		line     int
+		expected CompletionContext
+	}{
+		{
+			name:     "inside retry.manual",
+			content:  "steps:\n  - command: make\n    retry:\n      manual:\n        allowed: false\n        \n",
+			line:     5,
+			expected: ContextRetryManual,
+		},
+		{
+			name:     "inside retry",
+			content:  "steps:\n  - command: make\n    retry:\n      \n",
+			line:     3,
+			expected: ContextStep,
+		},
+		{
+			name:     "a step's manual key",
+			content:  "steps:\n  - command: make\n    manual:\n      \n",
+			line:     3,
+			expected: ContextStep,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := strings.Split(tt.content, "\n")
+			currentLine := lines[tt.line]
+			result := analyzer.AnalyzeContext(&PositionContext{
+				Position:     protocol.Position{Line: uint32(tt.line), Character: uint32(len(currentLine))},
+				CurrentLine:  currentLine,
+				CharIndex:    len(currentLine),
+				ContextLines: lines[:tt.line+1],
+				FullContent:  tt.content,
+			})
+
+			if result.Type != tt.expected {
+				t.Errorf("Expected context %v, got %v (parents %v)", tt.expected, result.Type, result.ParentKeys)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package corpus
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.lsp.dev/protocol"
+)
+
+// GoldenExt is the extension of the file holding a fixture's expected diagnostics
+const GoldenExt = ".golden"
+
+// DiagnoseFunc runs the diagnostic pipeline over a pipeline document
+type DiagnoseFunc func(content string) []protocol.Diagnostic
+
+// Result is the outcome of checking a single fixture against its golden file
+type Result struct {
+	Fixture string
+	Golden  string
+	Want    string
+	Got     string
+	Updated bool
+}
+
+// Passed reports whether the fixture produced its golden diagnostics
+func (r Result) Passed() bool {
+	return r.Updated || r.Want == r.Got
+}
+
+// Run diagnoses every pipeline fixture (*.yml, *.yaml) under dir and compares the output
+// with the fixture's golden file. When update is true, golden files are rewritten instead.
+func Run(dir string, diagnose DiagnoseFunc, update bool) ([]Result, error) {
+	fixtures, err := findFixtures(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(fixtures) == 0 {
+		return nil, fmt.Errorf("no pipeline fixtures found in %s", dir)
+	}
+
+	var results []Result
+	for _, fixture := range fixtures {
+		result, err := check(fixture, diagnose, update)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// Format renders diagnostics in the golden file format: one diagnostic per line as
+// "line:column severity code: message", using 1-based positions
+func Format(diagnostics []protocol.Diagnostic) string {
+	var b strings.Builder
+	for _, d := range diagnostics {
+		code := "-"
+		if d.Code != nil {
+			code = fmt.Sprint(d.Code)
+		}
+
+		fmt.Fprintf(&b, "%d:%d %s %s: %s\n",
+			d.Range.Start.Line+1,
+			d.Range.Start.Character+1,
+			strings.ToLower(d.Severity.String()),
+			code,
+			d.Message,
+		)
+	}
+	return b.String()
+}
+
+func findFixtures(dir string) ([]string, error) {
+	var fixtures []string
+
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		switch filepath.Ext(path) {
+		case ".yml", ".yaml":
+			fixtures = append(fixtures, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read corpus %s: %w", dir, err)
+	}
+
+	sort.Strings(fixtures)
+	return fixtures, nil
+}
+
+func check(fixture string, diagnose DiagnoseFunc, update bool) (Result, error) {
+	content, err := os.ReadFile(fixture)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to read fixture %s: %w", fixture, err)
+	}
+
+	result := Result{
+		Fixture: fixture,
+		Golden:  strings.TrimSuffix(fixture, filepath.Ext(fixture)) + GoldenExt,
+		Got:     Format(diagnose(string(content))),
+	}
+
+	if update {
+		if err := os.WriteFile(result.Golden, []byte(result.Got), 0o644); err != nil {
+			return Result{}, fmt.Errorf("failed to write golden file %s: %w", result.Golden, err)
+		}
+		result.Want = result.Got
+		result.Updated = true
+		return result, nil
+	}
+
+	want, err := os.ReadFile(result.Golden)
+	if err != nil && !os.IsNotExist(err) {
+		return Result{}, fmt.Errorf("failed to read golden file %s: %w", result.Golden, err)
+	}
+	result.Want = string(want)
+
+	return result, nil
+}
@@ -0,0 +1,83 @@
+package corpus
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.lsp.dev/protocol"
+
+	"github.com/mcncl/buildkite-ls/internal/lsp"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+func TestCorpus(t *testing.T) {
+	server := lsp.NewServer()
+
+	results, err := Run("testdata", server.Diagnose, *update)
+	if err != nil {
+		t.Fatalf("Failed to run corpus: %v", err)
+	}
+
+	for _, result := range results {
+		t.Run(filepath.Base(result.Fixture), func(t *testing.T) {
+			if !result.Passed() {
+				t.Errorf("Diagnostics differ from %s\n--- want\n%s+++ got\n%s", result.Golden, result.Want, result.Got)
+			}
+		})
+	}
+}
+
+func TestRun_DetectsMismatch(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "pipeline.yml"), []byte("steps: []\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "pipeline.golden"), []byte("1:1 error stale: old output\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	diagnose := func(content string) []protocol.Diagnostic {
+		return []protocol.Diagnostic{
+			{
+				Range:    protocol.Range{Start: protocol.Position{Line: 0, Character: 2}},
+				Severity: protocol.DiagnosticSeverityWarning,
+				Code:     "example",
+				Message:  "Example diagnostic",
+			},
+		}
+	}
+
+	results, err := Run(dir, diagnose, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(results) != 1 || results[0].Passed() {
+		t.Fatalf("Expected a single failing result, got %+v", results)
+	}
+
+	// Updating rewrites the golden file so the next run passes
+	if _, err := Run(dir, diagnose, true); err != nil {
+		t.Fatalf("Unexpected error updating: %v", err)
+	}
+
+	results, err = Run(dir, diagnose, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !results[0].Passed() {
+		t.Errorf("Expected result to pass after update, got %+v", results[0])
+	}
+
+	if results[0].Got != "1:3 warning example: Example diagnostic\n" {
+		t.Errorf("Unexpected golden format: %q", results[0].Got)
+	}
+}
+
+func TestRun_EmptyCorpus(t *testing.T) {
+	if _, err := Run(t.TempDir(), nil, false); err == nil {
+		t.Error("Expected an error for a corpus without fixtures")
+	}
+}
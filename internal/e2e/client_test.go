@@ -0,0 +1,219 @@
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go.lsp.dev/jsonrpc2"
+	"go.lsp.dev/protocol"
+)
+
+// serverBinary is the path of the binary built for the tests
+var serverBinary string
+
+// responseTimeout bounds how long any single exchange with the server may take
+const responseTimeout = 10 * time.Second
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "buildkite-ls-e2e")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create build directory: %v\n", err)
+		os.Exit(1)
+	}
+
+	serverBinary = filepath.Join(dir, "buildkite-ls")
+	build := exec.Command("go", "build", "-o", serverBinary, "github.com/mcncl/buildkite-ls")
+	build.Stdout, build.Stderr = os.Stderr, os.Stderr
+	if err := build.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to build buildkite-ls: %v\n", err)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// pipe joins the server's stdout and stdin into the stream a connection reads and writes
+type pipe struct {
+	io.ReadCloser
+	io.WriteCloser
+}
+
+func (p pipe) Close() error {
+	writeErr := p.WriteCloser.Close()
+	readErr := p.ReadCloser.Close()
+	if writeErr != nil {
+		return writeErr
+	}
+	return readErr
+}
+
+// client is an editor connected to a running server
+type client struct {
+	t    *testing.T
+	conn jsonrpc2.Conn
+	// notifications receives every notification the server sends
+	notifications chan jsonrpc2.Notification
+
+	mu sync.Mutex
+	// configuration answers the server's workspace/configuration requests
+	configuration map[string]interface{}
+}
+
+// startServer launches the binary and connects to it over stdio. The server is stopped
+// when the test ends.
+func startServer(t *testing.T) *client {
+	t.Helper()
+
+	cmd := exec.Command(serverBinary)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+
+	c := &client{
+		t:             t,
+		conn:          jsonrpc2.NewConn(jsonrpc2.NewStream(pipe{stdout, stdin})),
+		notifications: make(chan jsonrpc2.Notification, 100),
+	}
+	c.conn.Go(context.Background(), func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		if notification, ok := req.(*jsonrpc2.Notification); ok {
+			c.notifications <- *notification
+			return nil
+		}
+		if req.Method() == "workspace/configuration" {
+			var params protocol.ConfigurationParams
+			if err := json.Unmarshal(req.Params(), &params); err != nil {
+				return reply(ctx, nil, err)
+			}
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			sections := make([]interface{}, 0, len(params.Items))
+			for _, item := range params.Items {
+				sections = append(sections, c.configuration[item.Section])
+			}
+			return reply(ctx, sections, nil)
+		}
+		// Other requests from the server, such as workspace/applyEdit, are accepted without acting on them
+		return reply(ctx, nil, nil)
+	})
+
+	t.Cleanup(func() {
+		// Closing stdin ends the server's connection, and with it the process
+		c.conn.Close()
+		done := make(chan error, 1)
+		go func() { done <- cmd.Wait() }()
+		select {
+		case <-done:
+		case <-time.After(responseTimeout):
+			cmd.Process.Kill()
+			t.Error("server didn't exit after its input was closed")
+		}
+	})
+
+	return c
+}
+
+// call sends a request and decodes its result
+func (c *client) call(method string, params, result interface{}) {
+	c.t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), responseTimeout)
+	defer cancel()
+	if _, err := c.conn.Call(ctx, method, params, result); err != nil {
+		c.t.Fatalf("%s failed: %v", method, err)
+	}
+}
+
+// notify sends a notification
+func (c *client) notify(method string, params interface{}) {
+	c.t.Helper()
+
+	if err := c.conn.Notify(context.Background(), method, params); err != nil {
+		c.t.Fatalf("%s failed: %v", method, err)
+	}
+}
+
+// configure sets the configuration section returned to workspace/configuration requests
+func (c *client) configure(section string, settings interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.configuration == nil {
+		c.configuration = make(map[string]interface{})
+	}
+	c.configuration[section] = settings
+}
+
+// initialize performs the initialize handshake and returns the server's capabilities as JSON
+func (c *client) initialize() map[string]interface{} {
+	c.t.Helper()
+
+	params := protocol.InitializeParams{
+		ClientInfo: &protocol.ClientInfo{Name: "e2e", Version: "1.0.0"},
+		Capabilities: protocol.ClientCapabilities{
+			Workspace: &protocol.WorkspaceClientCapabilities{Configuration: true},
+			TextDocument: &protocol.TextDocumentClientCapabilities{
+				Hover:          &protocol.HoverTextDocumentClientCapabilities{ContentFormat: []protocol.MarkupKind{protocol.Markdown}},
+				SemanticTokens: &protocol.SemanticTokensClientCapabilities{},
+			},
+		},
+	}
+
+	var result struct {
+		Capabilities map[string]interface{} `json:"capabilities"`
+	}
+	c.call("initialize", params, &result)
+	c.notify("initialized", protocol.InitializedParams{})
+	return result.Capabilities
+}
+
+// open opens a pipeline document
+func (c *client) open(uri protocol.DocumentURI, text string) {
+	c.t.Helper()
+
+	c.notify("textDocument/didOpen", protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: uri, LanguageID: "yaml", Version: 1, Text: text},
+	})
+}
+
+// waitForDiagnostics returns the next diagnostics published for the document
+func (c *client) waitForDiagnostics(uri protocol.DocumentURI) []protocol.Diagnostic {
+	c.t.Helper()
+
+	timeout := time.After(responseTimeout)
+	for {
+		select {
+		case notification := <-c.notifications:
+			if notification.Method() != "textDocument/publishDiagnostics" {
+				continue
+			}
+			var params protocol.PublishDiagnosticsParams
+			if err := json.Unmarshal(notification.Params(), &params); err != nil {
+				c.t.Fatalf("malformed publishDiagnostics params: %v", err)
+			}
+			if params.URI == uri {
+				return params.Diagnostics
+			}
+		case <-timeout:
+			c.t.Fatalf("no diagnostics published for %s", uri)
+			return nil
+		}
+	}
+}
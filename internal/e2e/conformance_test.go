@@ -0,0 +1,62 @@
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// recordedReply is a request and the reply a strict client expects when there's nothing
+// to return
+type recordedReply struct {
+	Name   string          `json:"name"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+}
+
+func TestEmptyResults(t *testing.T) {
+	data, err := os.ReadFile("testdata/empty_results.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recorded []recordedReply
+	if err := json.Unmarshal(data, &recorded); err != nil {
+		t.Fatalf("malformed testdata/empty_results.json: %v", err)
+	}
+
+	c := startServer(t)
+	c.initialize()
+	c.open(pipelineURI, "steps:\n  - label: \"Build\"\n    command: make\n\n")
+	c.waitForDiagnostics(pipelineURI)
+
+	for _, reply := range recorded {
+		t.Run(reply.Name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), responseTimeout)
+			defer cancel()
+
+			var result json.RawMessage
+			if _, err := c.conn.Call(ctx, reply.Method, reply.Params, &result); err != nil {
+				t.Fatalf("%s failed: %v", reply.Method, err)
+			}
+
+			// A null result leaves nothing to decode
+			if len(result) == 0 {
+				result = json.RawMessage("null")
+			}
+
+			var got, expected interface{}
+			if err := json.Unmarshal(result, &got); err != nil {
+				t.Fatalf("malformed %s result %s: %v", reply.Method, result, err)
+			}
+			if err := json.Unmarshal(reply.Result, &expected); err != nil {
+				t.Fatalf("malformed expected result %s: %v", reply.Result, err)
+			}
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("Expected %s to reply %s, got %s", reply.Method, reply.Result, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,4 @@
+// Package e2e holds end-to-end tests that build the buildkite-ls binary and drive it over
+// stdio as an editor would, checking the JSON-RPC messages it exchanges rather than the
+// behaviour of individual handlers.
+package e2e
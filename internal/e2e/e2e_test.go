@@ -0,0 +1,162 @@
+package e2e
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+const pipelineURI = protocol.DocumentURI("file:///workspace/.buildkite/pipeline.yml")
+
+func TestInitialize_Capabilities(t *testing.T) {
+	c := startServer(t)
+	capabilities := c.initialize()
+
+	for _, provider := range []string{"hoverProvider", "definitionProvider", "documentSymbolProvider", "workspaceSymbolProvider"} {
+		if capabilities[provider] != true {
+			t.Errorf("Expected %s to be true, got %v", provider, capabilities[provider])
+		}
+	}
+
+	sync, _ := capabilities["textDocumentSync"].(map[string]interface{})
+	if sync["openClose"] != true || sync["change"] != float64(protocol.TextDocumentSyncKindFull) {
+		t.Errorf("Expected full document sync, got %v", capabilities["textDocumentSync"])
+	}
+
+	completion, _ := capabilities["completionProvider"].(map[string]interface{})
+	triggers, _ := completion["triggerCharacters"].([]interface{})
+	if !slices.Contains(triggers, interface{}(":")) || completion["resolveProvider"] != true {
+		t.Errorf("Expected completion triggered on ':' with resolve, got %v", capabilities["completionProvider"])
+	}
+
+	tokens, _ := capabilities["semanticTokensProvider"].(map[string]interface{})
+	if legend, _ := tokens["legend"].(map[string]interface{}); legend["tokenTypes"] == nil {
+		t.Errorf("Expected a semantic tokens legend, got %v", capabilities["semanticTokensProvider"])
+	}
+
+	commands, _ := capabilities["executeCommandProvider"].(map[string]interface{})
+	if names, _ := commands["commands"].([]interface{}); !slices.Contains(names, interface{}("buildkite.extractCommandToScript")) {
+		t.Errorf("Expected the extract script command, got %v", capabilities["executeCommandProvider"])
+	}
+}
+
+func TestDidOpen_PublishesDiagnostics(t *testing.T) {
+	c := startServer(t)
+	c.initialize()
+
+	c.open(pipelineURI, "steps:\n  - label: \"Build\n    command: make\n")
+
+	diagnostics := c.waitForDiagnostics(pipelineURI)
+	if len(diagnostics) == 0 {
+		t.Fatal("Expected diagnostics for a pipeline with a YAML error")
+	}
+	if diagnostics[0].Code != "yaml-syntax-error" || diagnostics[0].Source != "buildkite-ls" {
+		t.Errorf("Expected a yaml-syntax-error from buildkite-ls, got %+v", diagnostics[0])
+	}
+
+	// Fixing the document clears them
+	// protocol.TextDocumentContentChangeEvent always sends a range, so the full change is
+	// written out without one
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   protocol.VersionedTextDocumentIdentifier{TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: pipelineURI}, Version: 2},
+		"contentChanges": []map[string]string{{"text": "steps:\n  - label: \"Build\"\n    key: build\n    command: make\n"}},
+	})
+	if diagnostics := c.waitForDiagnostics(pipelineURI); len(diagnostics) != 0 {
+		t.Errorf("Expected no diagnostics once fixed, got %+v", diagnostics)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	c := startServer(t)
+	c.initialize()
+	c.open(pipelineURI, "steps:\n  - label: \"Build\"\n    ")
+	c.waitForDiagnostics(pipelineURI)
+
+	var result protocol.CompletionList
+	c.call("textDocument/completion", protocol.CompletionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: pipelineURI},
+			Position:     protocol.Position{Line: 2, Character: 4},
+		},
+	}, &result)
+
+	var labels []string
+	for _, item := range result.Items {
+		labels = append(labels, item.Label)
+	}
+	for _, expected := range []string{"command", "key", "depends_on"} {
+		if !slices.Contains(labels, expected) {
+			t.Errorf("Expected step completion %q, got %v", expected, labels)
+		}
+	}
+}
+
+func TestHover(t *testing.T) {
+	c := startServer(t)
+	c.initialize()
+	c.open(pipelineURI, "steps:\n  - label: \"Build\"\n    command: make\n")
+	c.waitForDiagnostics(pipelineURI)
+
+	var hover protocol.Hover
+	c.call("textDocument/hover", protocol.HoverParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: pipelineURI},
+			Position:     protocol.Position{Line: 2, Character: 6},
+		},
+	}, &hover)
+
+	if hover.Contents.Kind != protocol.Markdown || !strings.Contains(hover.Contents.Value, "**command**") {
+		t.Errorf("Expected markdown documentation for command, got %+v", hover.Contents)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	c := startServer(t)
+	c.initialize()
+
+	var result interface{}
+	c.call("shutdown", nil, &result)
+	if result != nil {
+		t.Errorf("Expected a null shutdown result, got %v", result)
+	}
+	c.notify("exit", nil)
+}
+
+func TestWorkspaceConfiguration(t *testing.T) {
+	c := startServer(t)
+	c.configure("buildkite-ls", map[string]interface{}{"teams": []string{"platform"}})
+	c.initialize()
+
+	uri := protocol.DocumentURI("file:///workspace/.buildkite/pipeline.release.yml")
+	c.open(uri, "steps:\n  - block: \"Release\"\n    key: release\n    allowed_teams:\n      - security\n")
+
+	// The pulled teams flag the unknown team, once the configuration has arrived
+	if !waitForCode(c, uri, "unknown-team", true) {
+		t.Fatal("Expected the team to be flagged once the configured teams were pulled")
+	}
+
+	// Changing the configuration is pulled again and revalidates the open document
+	c.configure("buildkite-ls", map[string]interface{}{"teams": []string{"platform", "security"}})
+	c.notify("workspace/didChangeConfiguration", protocol.DidChangeConfigurationParams{Settings: map[string]interface{}{}})
+	if !waitForCode(c, uri, "unknown-team", false) {
+		t.Fatal("Expected the team to be accepted after the configuration changed")
+	}
+}
+
+// waitForCode waits until diagnostics for the document do or don't include the code
+func waitForCode(c *client, uri protocol.DocumentURI, code string, present bool) bool {
+	for range 5 {
+		found := false
+		for _, diagnostic := range c.waitForDiagnostics(uri) {
+			if diagnostic.Code == code {
+				found = true
+			}
+		}
+		if found == present {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,584 @@
+// Package expression parses and evaluates Buildkite conditionals, the expressions
+// used by a step's `if:` to decide whether it runs.
+package expression
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Variables maps dotted variable names (e.g. "build.branch") to their values. Values are
+// strings, float64s, bools, nil, []interface{} for lists, or map[string]interface{} for
+// functions taking a single string argument such as build.env("NAME").
+type Variables map[string]interface{}
+
+// Expression is a parsed conditional
+type Expression struct {
+	source     string
+	root       node
+	references []Reference
+}
+
+// Reference is a variable or function named by a conditional
+type Reference struct {
+	Name   string
+	Offset int  // 0-based byte offset into the expression
+	Call   bool // whether it's called as a function, as in build.env("NAME")
+}
+
+// KnownVariables are the variables Buildkite provides to conditionals
+var KnownVariables = []string{
+	"build.author.email",
+	"build.author.id",
+	"build.author.name",
+	"build.author.teams",
+	"build.branch",
+	"build.commit",
+	"build.creator.email",
+	"build.creator.id",
+	"build.creator.name",
+	"build.creator.teams",
+	"build.id",
+	"build.merge_queue.base_branch",
+	"build.merge_queue.base_commit",
+	"build.message",
+	"build.number",
+	"build.pull_request.base_branch",
+	"build.pull_request.draft",
+	"build.pull_request.id",
+	"build.pull_request.labels",
+	"build.pull_request.repository",
+	"build.pull_request.repository.fork",
+	"build.pull_request.repository.owner",
+	"build.source",
+	"build.state",
+	"build.tag",
+	"organization.id",
+	"organization.slug",
+	"pipeline.default_branch",
+	"pipeline.id",
+	"pipeline.repository",
+	"pipeline.slug",
+}
+
+// KnownFunctions are the functions Buildkite provides to conditionals
+var KnownFunctions = []string{"build.env"}
+
+// SyntaxError describes where a conditional failed to parse
+type SyntaxError struct {
+	Offset  int // 0-based byte offset into the expression
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at offset %d", e.Message, e.Offset)
+}
+
+// Parse parses a conditional such as `build.branch == "main" && build.tag == null`
+func Parse(source string) (*Expression, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, unexpectedToken(tok)
+	}
+
+	return &Expression{source: source, root: root, references: p.references}, nil
+}
+
+// References returns the variables and functions the conditional names, in the order
+// they appear
+func (e *Expression) References() []Reference {
+	return e.references
+}
+
+// String returns the expression's source
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Evaluate reports whether the conditional holds for the variables. Values other than
+// false and null count as true, the same as on Buildkite.
+func (e *Expression) Evaluate(vars Variables) (bool, error) {
+	value, err := e.root.eval(vars)
+	if err != nil {
+		return false, err
+	}
+	return truthy(value), nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenRegex
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenComma
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	offset int
+}
+
+// operators are matched longest first
+var operators = []string{"&&", "||", "==", "!=", "=~", "!~", "!"}
+
+// invalidOperators are operators from other languages, with what to use instead, matched
+// longest first
+var invalidOperators = []struct{ operator, hint string }{
+	{"<=", "conditionals can only compare with ==, !=, =~ and !~"},
+	{">=", "conditionals can only compare with ==, !=, =~ and !~"},
+	{"<", "conditionals can only compare with ==, !=, =~ and !~"},
+	{">", "conditionals can only compare with ==, !=, =~ and !~"},
+	{"=", "use == to compare"},
+	{"&", "use && for and"},
+	{"|", "use || for or"},
+}
+
+// wordOperators are operators written as words, with the symbol to use instead
+var wordOperators = map[string]string{"and": "&&", "or": "||", "not": "!"}
+
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", offset: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", offset: i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ",", offset: i})
+			i++
+		case c == '"' || c == '\'':
+			end := i + 1
+			var text strings.Builder
+			for end < len(source) && source[end] != c {
+				if source[end] == '\\' && end+1 < len(source) {
+					end++
+				}
+				text.WriteByte(source[end])
+				end++
+			}
+			if end >= len(source) {
+				return nil, &SyntaxError{Offset: i, Message: "unterminated string"}
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text.String(), offset: i})
+			i = end + 1
+		case c == '/':
+			end := i + 1
+			for end < len(source) && source[end] != '/' {
+				if source[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(source) {
+				return nil, &SyntaxError{Offset: i, Message: "unterminated regular expression"}
+			}
+			pattern := source[i+1 : end]
+			end++
+			// Trailing flags, e.g. /main/i
+			for end < len(source) && source[end] == 'i' {
+				pattern = "(?i)" + pattern
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenRegex, text: pattern, offset: i})
+			i = end
+		case c >= '0' && c <= '9':
+			end := i
+			for end < len(source) && (source[end] >= '0' && source[end] <= '9' || source[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: source[i:end], offset: i})
+			i = end
+		case isIdentByte(c):
+			end := i
+			for end < len(source) && (isIdentByte(source[end]) || source[end] >= '0' && source[end] <= '9' || source[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: source[i:end], offset: i})
+			i = end
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(source[i:], op) {
+					tokens = append(tokens, token{kind: tokenOperator, text: op, offset: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if matched {
+				break
+			}
+			for _, invalid := range invalidOperators {
+				if strings.HasPrefix(source[i:], invalid.operator) {
+					return nil, &SyntaxError{Offset: i, Message: fmt.Sprintf("invalid operator %q: %s", invalid.operator, invalid.hint)}
+				}
+			}
+			return nil, &SyntaxError{Offset: i, Message: fmt.Sprintf("unexpected character %q", c)}
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, offset: len(source)}), nil
+}
+
+func isIdentByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+// exprParser is a recursive descent parser. From loosest to tightest binding:
+// ||, &&, comparisons (==, !=, =~, !~, includes), then unary !.
+type exprParser struct {
+	tokens     []token
+	pos        int
+	references []Reference
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *exprParser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenOperator && p.peek().text == "||" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (node, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenOperator && p.peek().text == "&&" {
+		p.next()
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseComparison() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.peek()
+	isComparison := tok.kind == tokenOperator && tok.text != "&&" && tok.text != "||" && tok.text != "!"
+	if !isComparison && !(tok.kind == tokenIdent && tok.text == "includes") {
+		return left, nil
+	}
+	p.next()
+
+	right, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return &comparisonNode{op: tok.text, left: left, right: right}, nil
+}
+
+func (p *exprParser) parseUnary() (node, error) {
+	if tok := p.peek(); tok.kind == tokenOperator && tok.text == "!" {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (node, error) {
+	tok := p.next()
+
+	switch tok.kind {
+	case tokenString:
+		return &literalNode{value: tok.text}, nil
+	case tokenNumber:
+		number, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, &SyntaxError{Offset: tok.offset, Message: fmt.Sprintf("invalid number %q", tok.text)}
+		}
+		return &literalNode{value: number}, nil
+	case tokenRegex:
+		pattern, err := regexp.Compile(tok.text)
+		if err != nil {
+			return nil, &SyntaxError{Offset: tok.offset, Message: fmt.Sprintf("invalid regular expression: %v", err)}
+		}
+		return &literalNode{value: pattern}, nil
+	case tokenLParen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.closeParen(tok); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	case tokenIdent:
+		switch tok.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null":
+			return &literalNode{value: nil}, nil
+		}
+
+		if _, ok := wordOperators[tok.text]; ok {
+			return nil, unexpectedToken(tok)
+		}
+
+		if p.peek().kind != tokenLParen {
+			p.references = append(p.references, Reference{Name: tok.text, Offset: tok.offset})
+			return &variableNode{name: tok.text}, nil
+		}
+		p.references = append(p.references, Reference{Name: tok.text, Offset: tok.offset, Call: true})
+		opening := p.next()
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.closeParen(opening); err != nil {
+			return nil, err
+		}
+		return &callNode{name: tok.text, arg: arg}, nil
+	default:
+		return nil, unexpectedToken(tok)
+	}
+}
+
+// closeParen consumes the ) closing the opening (
+func (p *exprParser) closeParen(opening token) error {
+	closing := p.peek()
+	if closing.kind == tokenRParen {
+		p.next()
+		return nil
+	}
+	if closing.kind == tokenEOF {
+		return &SyntaxError{Offset: closing.offset, Message: fmt.Sprintf("unbalanced parentheses: the ( at offset %d is never closed", opening.offset)}
+	}
+	return &SyntaxError{Offset: closing.offset, Message: fmt.Sprintf("expected ) but found %q", closing.text)}
+}
+
+// unexpectedToken describes a token found where it can't go, explaining the mistakes that
+// commonly put it there
+func unexpectedToken(tok token) error {
+	switch {
+	case tok.kind == tokenEOF:
+		return &SyntaxError{Offset: tok.offset, Message: "unexpected end of expression"}
+	case tok.kind == tokenRParen:
+		return &SyntaxError{Offset: tok.offset, Message: "unbalanced parentheses: this ) has no ( to close"}
+	case tok.kind == tokenIdent && wordOperators[tok.text] != "":
+		return &SyntaxError{Offset: tok.offset, Message: fmt.Sprintf("invalid operator %q: use %s", tok.text, wordOperators[tok.text])}
+	}
+	return &SyntaxError{Offset: tok.offset, Message: fmt.Sprintf("unexpected %q", tok.text)}
+}
+
+type node interface {
+	eval(vars Variables) (interface{}, error)
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n *literalNode) eval(Variables) (interface{}, error) {
+	return n.value, nil
+}
+
+type variableNode struct {
+	name string
+}
+
+func (n *variableNode) eval(vars Variables) (interface{}, error) {
+	value, ok := vars[n.name]
+	if !ok {
+		return nil, fmt.Errorf("unknown variable %s", n.name)
+	}
+	return value, nil
+}
+
+type callNode struct {
+	name string
+	arg  node
+}
+
+func (n *callNode) eval(vars Variables) (interface{}, error) {
+	values, ok := vars[n.name].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s", n.name)
+	}
+
+	arg, err := n.arg.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := arg.(string)
+	if !ok {
+		return nil, fmt.Errorf("%s expects a string argument", n.name)
+	}
+	return values[key], nil
+}
+
+type notNode struct {
+	operand node
+}
+
+func (n *notNode) eval(vars Variables) (interface{}, error) {
+	value, err := n.operand.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	return !truthy(value), nil
+}
+
+type logicalNode struct {
+	op          string
+	left, right node
+}
+
+func (n *logicalNode) eval(vars Variables) (interface{}, error) {
+	left, err := n.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "&&" && !truthy(left) {
+		return false, nil
+	}
+	if n.op == "||" && truthy(left) {
+		return true, nil
+	}
+
+	right, err := n.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	return truthy(right), nil
+}
+
+type comparisonNode struct {
+	op          string
+	left, right node
+}
+
+func (n *comparisonNode) eval(vars Variables) (interface{}, error) {
+	left, err := n.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "=~", "!~":
+		matched, err := matches(left, right)
+		if err != nil {
+			return nil, err
+		}
+		return matched == (n.op == "=~"), nil
+	case "includes":
+		list, ok := left.([]interface{})
+		if !ok {
+			return false, nil
+		}
+		for _, item := range list {
+			if equal(item, right) {
+				return true, nil
+			}
+		}
+		return false, nil
+	default:
+		return nil, fmt.Errorf("unknown operator %s", n.op)
+	}
+}
+
+func equal(left, right interface{}) bool {
+	return reflect.DeepEqual(left, right)
+}
+
+// matches applies a regular expression, or a string compiled as one, to a string value.
+// Null never matches.
+func matches(value, pattern interface{}) (bool, error) {
+	re, ok := pattern.(*regexp.Regexp)
+	if !ok {
+		source, isString := pattern.(string)
+		if !isString {
+			return false, fmt.Errorf("=~ expects a regular expression")
+		}
+		compiled, err := regexp.Compile(source)
+		if err != nil {
+			return false, fmt.Errorf("invalid regular expression: %w", err)
+		}
+		re = compiled
+	}
+
+	text, ok := value.(string)
+	if !ok {
+		return false, nil
+	}
+	return re.MatchString(text), nil
+}
+
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	default:
+		return true
+	}
+}
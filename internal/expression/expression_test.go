@@ -0,0 +1,142 @@
+package expression
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var testVariables = Variables{
+	"build.branch":              "feature/login",
+	"build.tag":                 nil,
+	"build.message":             "Fix login [skip tests]",
+	"build.pull_request.id":     "42",
+	"build.pull_request.draft":  false,
+	"build.pull_request.labels": []interface{}{"frontend", "ready"},
+	"pipeline.default_branch":   "main",
+	"build.env":                 map[string]interface{}{"DEPLOY": "true"},
+}
+
+func TestExpression_Evaluate(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   bool
+	}{
+		{`build.branch == "feature/login"`, true},
+		{`build.branch == pipeline.default_branch`, false},
+		{`build.branch != pipeline.default_branch`, true},
+		{`build.tag == null`, true},
+		{`build.tag != null`, false},
+		{`build.branch =~ /^feature\//`, true},
+		{`build.branch !~ /^release/`, true},
+		{`build.message =~ /SKIP TESTS/i`, true},
+		{`build.tag =~ /^v/`, false},
+		{`build.pull_request.id != null && !build.pull_request.draft`, true},
+		{`build.branch == "main" || build.pull_request.labels includes "ready"`, true},
+		{`build.pull_request.labels includes "backend"`, false},
+		{`!(build.branch == "main" || build.tag != null)`, true},
+		{`build.env("DEPLOY") == "true"`, true},
+		{`build.env("MISSING") == null`, true},
+		{`build.pull_request.draft`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			expr, err := Parse(tt.expression)
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+
+			result, err := expr.Evaluate(testVariables)
+			if err != nil {
+				t.Fatalf("Failed to evaluate: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestParse_SyntaxErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		offset     int
+	}{
+		{`build.branch == "main`, 16},
+		{`build.branch ==`, 15},
+		{`(build.branch == "main"`, 23},
+		{`build.branch = "main"`, 13},
+		{`build.branch == "main" "dev"`, 23},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			_, err := Parse(tt.expression)
+
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("Expected a syntax error, got %v", err)
+			}
+			if syntaxErr.Offset != tt.offset {
+				t.Errorf("Expected offset %d, got %d (%v)", tt.offset, syntaxErr.Offset, err)
+			}
+		})
+	}
+}
+
+func TestExpression_UnknownVariable(t *testing.T) {
+	expr, err := Parse(`build.branchh == "main"`)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if _, err := expr.Evaluate(testVariables); err == nil {
+		t.Error("Expected an error for an unknown variable")
+	}
+}
+
+func TestParse_ErrorMessages(t *testing.T) {
+	tests := []struct {
+		expression string
+		offset     int
+		message    string
+	}{
+		{`build.branch = "main"`, 13, `invalid operator "=": use == to compare`},
+		{`build.branch == "main" & build.tag == null`, 23, `invalid operator "&": use && for and`},
+		{`build.number >= 100`, 13, `invalid operator ">=": conditionals can only compare with ==, !=, =~ and !~`},
+		{`build.branch == "main" and build.tag == null`, 23, `invalid operator "and": use &&`},
+		{`(build.branch == "main"`, 23, "unbalanced parentheses: the ( at offset 0 is never closed"},
+		{`build.branch == "main")`, 22, "unbalanced parentheses: this ) has no ( to close"},
+		{`build.env("DEPLOY" == "true"`, 28, "unbalanced parentheses: the ( at offset 9 is never closed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			_, err := Parse(tt.expression)
+
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("Expected a syntax error, got %v", err)
+			}
+			if syntaxErr.Offset != tt.offset || syntaxErr.Message != tt.message {
+				t.Errorf("Expected %q at offset %d, got %q at offset %d", tt.message, tt.offset, syntaxErr.Message, syntaxErr.Offset)
+			}
+		})
+	}
+}
+
+func TestExpression_References(t *testing.T) {
+	expr, err := Parse(`build.brach == "main" && build.env("DEPLOY") == "true" && !build.tag`)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	expected := []Reference{
+		{Name: "build.brach", Offset: 0},
+		{Name: "build.env", Offset: 25, Call: true},
+		{Name: "build.tag", Offset: 59},
+	}
+	if references := expr.References(); !reflect.DeepEqual(references, expected) {
+		t.Errorf("Expected references %+v, got %+v", expected, references)
+	}
+}
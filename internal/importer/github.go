@@ -0,0 +1,257 @@
+package importer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// githubExpression matches a `${{ ... }}` expression
+var githubExpression = regexp.MustCompile(`\$\{\{\s*(.*?)\s*\}\}`)
+
+// githubContextVariables are the github context values with a Buildkite environment variable
+var githubContextVariables = map[string]string{
+	"github.sha":        "BUILDKITE_COMMIT",
+	"github.ref_name":   "BUILDKITE_BRANCH",
+	"github.head_ref":   "BUILDKITE_BRANCH",
+	"github.run_number": "BUILDKITE_BUILD_NUMBER",
+	"github.run_id":     "BUILDKITE_BUILD_ID",
+	"github.workspace":  "BUILDKITE_BUILD_CHECKOUT_PATH",
+	"github.actor":      "BUILDKITE_BUILD_CREATOR",
+	"github.job":        "BUILDKITE_STEP_KEY",
+}
+
+// convertGitHubActions turns each job of a workflow into a command step
+func convertGitHubActions(workflow *yaml.Node) *yaml.Node {
+	pipeline := newMapping()
+
+	if env := githubEnv(mappingValue(workflow, "env"), nil); env != nil {
+		pipeline.set("env", env)
+	}
+
+	var steps []*yaml.Node
+	taken := make(map[string]bool)
+	keys := make(map[string]string)
+	jobs := mappingValue(workflow, "jobs")
+	if jobs != nil && jobs.Kind == yaml.MappingNode {
+		// Keys are assigned up front so needs can refer to jobs defined later
+		for i := 0; i+1 < len(jobs.Content); i += 2 {
+			id := jobs.Content[i].Value
+			keys[id] = uniqueKey(stepKey(id), taken)
+		}
+		for i := 0; i+1 < len(jobs.Content); i += 2 {
+			steps = append(steps, githubJobStep(jobs.Content[i].Value, jobs.Content[i+1], keys))
+		}
+	}
+
+	pipeline.set("steps", list(steps...))
+	if on := mappingValue(workflow, "on"); on != nil {
+		pipeline.note(fmt.Sprintf("the workflow ran on %s; set up the matching triggers in the pipeline's settings", strings.Join(githubTriggers(on), ", ")))
+	}
+	return pipeline.node
+}
+
+// githubTriggers lists the events a workflow runs on
+func githubTriggers(on *yaml.Node) []string {
+	if on.Kind == yaml.MappingNode {
+		var events []string
+		for i := 0; i < len(on.Content); i += 2 {
+			events = append(events, on.Content[i].Value)
+		}
+		return events
+	}
+	return stringList(on)
+}
+
+// githubJobStep converts a job and its steps
+func githubJobStep(id string, job *yaml.Node, keys map[string]string) *yaml.Node {
+	step := newMapping()
+	var notes []string
+
+	label := stringValue(job, "name")
+	if label == "" {
+		label = id
+	}
+	step.set("label", str(translateGitHubExpressions(label, &notes)))
+	step.set("key", str(keys[id]))
+
+	var commands, artifacts []string
+	if steps := mappingValue(job, "steps"); steps != nil && steps.Kind == yaml.SequenceNode {
+		for _, action := range steps.Content {
+			commands = append(commands, githubStepCommands(action, &artifacts, &notes)...)
+		}
+	}
+	commandStep(step, commands)
+
+	if needs := stringList(mappingValue(job, "needs")); len(needs) > 0 {
+		var dependencies []*yaml.Node
+		for _, need := range needs {
+			if key, ok := keys[need]; ok {
+				dependencies = append(dependencies, str(key))
+			}
+		}
+		if len(dependencies) == 1 {
+			step.set("depends_on", dependencies[0])
+		} else if len(dependencies) > 1 {
+			step.set("depends_on", list(dependencies...))
+		}
+	}
+
+	if env := githubEnv(mappingValue(job, "env"), &notes); env != nil {
+		step.set("env", env)
+	}
+
+	if runsOn := stringList(mappingValue(job, "runs-on")); len(runsOn) > 0 {
+		agents := newMapping()
+		agents.set("queue", str("default"))
+		step.set("agents", agents.node)
+		notes = append(notes, fmt.Sprintf("pick the agent queue for runs-on: %s", strings.Join(runsOn, ", ")))
+	}
+
+	if container := mappingValue(job, "container"); container != nil {
+		image := container.Value
+		if container.Kind == yaml.MappingNode {
+			image = stringValue(container, "image")
+		}
+		if image != "" {
+			dockerImage(step, image)
+		}
+	}
+	if mappingValue(job, "services") != nil {
+		notes = append(notes, "run the job's services, e.g. with the docker-compose plugin")
+	}
+
+	if matrix := githubMatrix(mappingValue(mappingValue(job, "strategy"), "matrix"), &notes); matrix != nil {
+		step.set("matrix", matrix)
+	}
+
+	if len(artifacts) > 0 {
+		paths := make([]*yaml.Node, 0, len(artifacts))
+		for _, path := range artifacts {
+			paths = append(paths, str(path))
+		}
+		step.set("artifact_paths", list(paths...))
+	}
+	if timeout := mappingValue(job, "timeout-minutes"); timeout != nil && timeout.Tag == "!!int" {
+		step.set("timeout_in_minutes", scalar(timeout))
+	}
+	if continueOnError := mappingValue(job, "continue-on-error"); continueOnError != nil && continueOnError.Value == "true" {
+		step.set("soft_fail", scalar(continueOnError))
+	}
+	if condition := stringValue(job, "if"); condition != "" {
+		notes = append(notes, fmt.Sprintf("rewrite the job condition `%s` as a step `if`", condition))
+	}
+
+	todo(step, notes)
+	return step.node
+}
+
+// githubStepCommands converts one workflow step into the commands it runs. Actions have no
+// Buildkite equivalent beyond the few handled here, so they are left as notes.
+func githubStepCommands(action *yaml.Node, artifacts *[]string, notes *[]string) []string {
+	if run := stringValue(action, "run"); run != "" {
+		command := translateGitHubExpressions(strings.TrimRight(run, "\n"), notes)
+		if dir := stringValue(action, "working-directory"); dir != "" {
+			command = fmt.Sprintf("cd %s\n%s", dir, command)
+		}
+		return []string{command}
+	}
+
+	uses := stringValue(action, "uses")
+	name, _, _ := strings.Cut(uses, "@")
+	switch name {
+	case "":
+	case "actions/checkout":
+		// Agents check out the repository before running a step
+	case "actions/upload-artifact":
+		*artifacts = append(*artifacts, stringList(mappingValue(mappingValue(action, "with"), "path"))...)
+	default:
+		*notes = append(*notes, fmt.Sprintf("replace the %s action, e.g. with a plugin or an agent hook", uses))
+	}
+	return nil
+}
+
+// githubEnv converts an env mapping, translating expressions in its values
+func githubEnv(env *yaml.Node, notes *[]string) *yaml.Node {
+	if env == nil || env.Kind != yaml.MappingNode || len(env.Content) == 0 {
+		return nil
+	}
+	if notes == nil {
+		notes = new([]string)
+	}
+
+	converted := newMapping()
+	for i := 0; i+1 < len(env.Content); i += 2 {
+		converted.set(env.Content[i].Value, str(translateGitHubExpressions(env.Content[i+1].Value, notes)))
+	}
+	return converted.node
+}
+
+// githubMatrix converts the list-valued dimensions of a strategy matrix
+func githubMatrix(matrix *yaml.Node, notes *[]string) *yaml.Node {
+	if matrix == nil || matrix.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	setup := newMapping()
+	for i := 0; i+1 < len(matrix.Content); i += 2 {
+		name, values := matrix.Content[i].Value, matrix.Content[i+1]
+		if name == "include" || name == "exclude" || values.Kind != yaml.SequenceNode {
+			*notes = append(*notes, fmt.Sprintf("convert the matrix %s, e.g. to matrix adjustments", name))
+			continue
+		}
+		items := make([]*yaml.Node, 0, len(values.Content))
+		for _, value := range values.Content {
+			items = append(items, str(value.Value))
+		}
+		setup.set(name, list(items...))
+	}
+	if setup.empty() {
+		return nil
+	}
+
+	converted := newMapping()
+	converted.set("setup", setup.node)
+	return converted.node
+}
+
+// translateGitHubExpressions rewrites `${{ }}` expressions as the environment variables or
+// matrix values Buildkite provides, deferring every variable to the agent
+func translateGitHubExpressions(value string, notes *[]string) string {
+	var out strings.Builder
+	last := 0
+	for _, match := range githubExpression.FindAllStringSubmatchIndex(value, -1) {
+		out.WriteString(escapeInterpolation(value[last:match[0]]))
+		last = match[1]
+
+		expression := value[match[2]:match[3]]
+		out.WriteString(translateGitHubExpression(expression, notes))
+	}
+	out.WriteString(escapeInterpolation(value[last:]))
+	return out.String()
+}
+
+// translateGitHubExpression rewrites a single expression, leaving it escaped with a note
+// when there's no equivalent
+func translateGitHubExpression(expression string, notes *[]string) string {
+	if variable, ok := githubContextVariables[expression]; ok {
+		return "$$" + variable
+	}
+	if name, ok := strings.CutPrefix(expression, "secrets."); ok {
+		*notes = append(*notes, fmt.Sprintf("make the secret %s available to the agent", name))
+		return "$$" + name
+	}
+	for _, prefix := range []string{"env.", "vars."} {
+		if name, ok := strings.CutPrefix(expression, prefix); ok {
+			return "$$" + name
+		}
+	}
+	if name, ok := strings.CutPrefix(expression, "matrix."); ok {
+		return "{{matrix." + name + "}}"
+	}
+
+	*notes = append(*notes, fmt.Sprintf("replace the expression `%s`", expression))
+	return "$${{ " + expression + " }}"
+}
@@ -0,0 +1,263 @@
+package importer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// gitlabKeywords are the top-level keys of a GitLab CI file that aren't jobs
+var gitlabKeywords = map[string]bool{
+	"default":       true,
+	"include":       true,
+	"stages":        true,
+	"variables":     true,
+	"workflow":      true,
+	"image":         true,
+	"services":      true,
+	"cache":         true,
+	"before_script": true,
+	"after_script":  true,
+	"types":         true,
+}
+
+// gitlabDefaultStages are the stages jobs run in when the file doesn't list any
+var gitlabDefaultStages = []string{".pre", "build", "test", "deploy", ".post"}
+
+// gitlabVariable matches a `$CI_...` or `${CI_...}` predefined variable
+var gitlabVariable = regexp.MustCompile(`\$\$\{?(CI_[A-Z_]+)\}?`)
+
+// gitlabPredefinedVariables are the predefined variables with a Buildkite equivalent
+var gitlabPredefinedVariables = map[string]string{
+	"CI_COMMIT_SHA":        "BUILDKITE_COMMIT",
+	"CI_COMMIT_BRANCH":     "BUILDKITE_BRANCH",
+	"CI_COMMIT_REF_NAME":   "BUILDKITE_BRANCH",
+	"CI_COMMIT_TAG":        "BUILDKITE_TAG",
+	"CI_COMMIT_MESSAGE":    "BUILDKITE_MESSAGE",
+	"CI_PIPELINE_IID":      "BUILDKITE_BUILD_NUMBER",
+	"CI_PIPELINE_ID":       "BUILDKITE_BUILD_ID",
+	"CI_PROJECT_DIR":       "BUILDKITE_BUILD_CHECKOUT_PATH",
+	"CI_JOB_NAME":          "BUILDKITE_LABEL",
+	"CI_DEFAULT_BRANCH":    "BUILDKITE_PIPELINE_DEFAULT_BRANCH",
+	"CI_MERGE_REQUEST_IID": "BUILDKITE_PULL_REQUEST",
+}
+
+// gitlabJob is a job and its name
+type gitlabJob struct {
+	Name string
+	Node *yaml.Node
+}
+
+// convertGitLabCI turns each job into a command step, separating stages with wait steps
+func convertGitLabCI(config *yaml.Node) *yaml.Node {
+	pipeline := newMapping()
+	defaults := mappingValue(config, "default")
+
+	if env := gitlabEnv(mappingValue(config, "variables")); env != nil {
+		pipeline.set("env", env)
+	}
+
+	stages := stringList(mappingValue(config, "stages"))
+	if len(stages) == 0 {
+		stages = gitlabDefaultStages
+	}
+
+	// Jobs are grouped by stage, keeping the file's order within each stage
+	byStage := make(map[string][]gitlabJob)
+	taken := make(map[string]bool)
+	keys := make(map[string]string)
+	for i := 0; i+1 < len(config.Content); i += 2 {
+		name, job := config.Content[i].Value, config.Content[i+1]
+		if gitlabKeywords[name] || strings.HasPrefix(name, ".") || job.Kind != yaml.MappingNode {
+			continue
+		}
+		stage := stringValue(job, "stage")
+		if stage == "" {
+			stage = "test"
+		}
+		byStage[stage] = append(byStage[stage], gitlabJob{Name: name, Node: job})
+		keys[name] = uniqueKey(stepKey(name), taken)
+	}
+
+	var steps []*yaml.Node
+	for _, stage := range stages {
+		jobs := byStage[stage]
+		if len(jobs) == 0 {
+			continue
+		}
+		if len(steps) > 0 {
+			steps = append(steps, str("wait"))
+		}
+		for _, job := range jobs {
+			steps = append(steps, gitlabJobSteps(job, config, defaults, keys)...)
+		}
+	}
+
+	pipeline.set("steps", list(steps...))
+	if mappingValue(config, "include") != nil {
+		pipeline.note("the file includes other configuration, which wasn't imported")
+	}
+	return pipeline.node
+}
+
+// gitlabSetting returns a job's setting, falling back to the default section and then to
+// the deprecated top-level form
+func gitlabSetting(key string, job, config, defaults *yaml.Node) *yaml.Node {
+	if value := mappingValue(job, key); value != nil {
+		return value
+	}
+	if value := mappingValue(defaults, key); value != nil {
+		return value
+	}
+	return mappingValue(config, key)
+}
+
+// gitlabJobSteps converts a job, preceded by a block step when it only runs when started by hand
+func gitlabJobSteps(job gitlabJob, config, defaults *yaml.Node, keys map[string]string) []*yaml.Node {
+	step := newMapping()
+	var notes []string
+
+	step.set("label", str(job.Name))
+	step.set("key", str(keys[job.Name]))
+
+	var commands []string
+	for _, key := range []string{"before_script", "script"} {
+		for _, command := range stringList(gitlabSetting(key, job.Node, config, defaults)) {
+			commands = append(commands, translateGitLabVariables(command))
+		}
+	}
+	commandStep(step, commands)
+
+	if after := stringList(gitlabSetting("after_script", job.Node, config, defaults)); len(after) > 0 {
+		notes = append(notes, "after_script runs even when the job fails; move it to a pre-exit agent hook")
+	}
+
+	if needs := mappingValue(job.Node, "needs"); needs != nil && needs.Kind == yaml.SequenceNode {
+		var dependencies []*yaml.Node
+		for _, need := range needs.Content {
+			name := need.Value
+			if need.Kind == yaml.MappingNode {
+				name = stringValue(need, "job")
+			}
+			if key, ok := keys[name]; ok {
+				dependencies = append(dependencies, str(key))
+			}
+		}
+		if len(dependencies) > 0 {
+			step.set("depends_on", list(dependencies...))
+		}
+	}
+
+	if env := gitlabEnv(mappingValue(job.Node, "variables")); env != nil {
+		step.set("env", env)
+	}
+
+	if image := gitlabSetting("image", job.Node, config, defaults); image != nil {
+		name := image.Value
+		if image.Kind == yaml.MappingNode {
+			name = stringValue(image, "name")
+		}
+		if name != "" {
+			dockerImage(step, name)
+		}
+	}
+	if gitlabSetting("services", job.Node, config, defaults) != nil {
+		notes = append(notes, "run the job's services, e.g. with the docker-compose plugin")
+	}
+
+	if tags := stringList(mappingValue(job.Node, "tags")); len(tags) > 0 {
+		notes = append(notes, fmt.Sprintf("target agents for the runner tags %s", strings.Join(tags, ", ")))
+	}
+
+	if paths := stringList(mappingValue(mappingValue(job.Node, "artifacts"), "paths")); len(paths) > 0 {
+		items := make([]*yaml.Node, 0, len(paths))
+		for _, path := range paths {
+			items = append(items, str(path))
+		}
+		step.set("artifact_paths", list(items...))
+	}
+
+	if parallel := mappingValue(job.Node, "parallel"); parallel != nil {
+		if parallel.Tag == "!!int" {
+			step.set("parallelism", scalar(parallel))
+		} else {
+			notes = append(notes, "convert the parallel matrix to a step matrix")
+		}
+	}
+
+	if retry := mappingValue(job.Node, "retry"); retry != nil {
+		limit := retry
+		if retry.Kind == yaml.MappingNode {
+			limit = mappingValue(retry, "max")
+		}
+		if limit != nil && limit.Tag == "!!int" {
+			automatic := newMapping()
+			automatic.set("limit", scalar(limit))
+			converted := newMapping()
+			converted.set("automatic", automatic.node)
+			step.set("retry", converted.node)
+		}
+	}
+
+	if allowFailure := mappingValue(job.Node, "allow_failure"); allowFailure != nil && allowFailure.Value == "true" {
+		step.set("soft_fail", scalar(allowFailure))
+	}
+
+	for _, key := range []string{"rules", "only", "except"} {
+		if mappingValue(job.Node, key) != nil {
+			notes = append(notes, fmt.Sprintf("rewrite the job's %s as a step `if` or branch filter", key))
+		}
+	}
+	if mappingValue(job.Node, "extends") != nil {
+		notes = append(notes, "merge in the configuration the job extends")
+	}
+	if timeout := stringValue(job.Node, "timeout"); timeout != "" {
+		notes = append(notes, fmt.Sprintf("set timeout_in_minutes for the timeout of %s", timeout))
+	}
+
+	todo(step, notes)
+
+	if stringValue(job.Node, "when") != "manual" {
+		return []*yaml.Node{step.node}
+	}
+	block := newMapping()
+	block.set("block", str(fmt.Sprintf("Run %s?", job.Name)))
+	return []*yaml.Node{block.node, step.node}
+}
+
+// gitlabEnv converts a variables mapping, reading the value of expanded variable definitions
+func gitlabEnv(variables *yaml.Node) *yaml.Node {
+	if variables == nil || variables.Kind != yaml.MappingNode || len(variables.Content) == 0 {
+		return nil
+	}
+
+	env := newMapping()
+	for i := 0; i+1 < len(variables.Content); i += 2 {
+		value := variables.Content[i+1]
+		if value.Kind == yaml.MappingNode {
+			value = mappingValue(value, "value")
+		}
+		if value == nil || value.Kind != yaml.ScalarNode {
+			continue
+		}
+		env.set(variables.Content[i].Value, str(translateGitLabVariables(value.Value)))
+	}
+	if env.empty() {
+		return nil
+	}
+	return env.node
+}
+
+// translateGitLabVariables defers variables to the agent, renaming the predefined variables
+// Buildkite has an equivalent for
+func translateGitLabVariables(value string) string {
+	return gitlabVariable.ReplaceAllStringFunc(escapeInterpolation(value), func(match string) string {
+		name := gitlabVariable.FindStringSubmatch(match)[1]
+		if variable, ok := gitlabPredefinedVariables[name]; ok {
+			return "$$" + variable
+		}
+		return match
+	})
+}
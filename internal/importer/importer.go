@@ -0,0 +1,239 @@
+// Package importer turns the CI configuration of other systems into Buildkite pipeline
+// scaffolds. The conversion is best-effort: whatever has no direct Buildkite equivalent is
+// left as a TODO comment on the step it came from.
+package importer
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format is a CI configuration format that can be imported
+type Format string
+
+const (
+	GitHubActions Format = "github-actions"
+	GitLabCI      Format = "gitlab-ci"
+)
+
+// dockerPlugin is the plugin container images are run with
+const dockerPlugin = "docker#v5.13.0"
+
+// keyInvalidChars matches the characters replaced when turning a job name into a step key
+var keyInvalidChars = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// DetectFormat works out the format of a CI file from its path, falling back to its content
+func DetectFormat(path string, content []byte) (Format, error) {
+	slashed := filepath.ToSlash(path)
+	switch {
+	case strings.Contains(slashed, ".github/workflows/"):
+		return GitHubActions, nil
+	case strings.HasSuffix(slashed, ".gitlab-ci.yml") || strings.HasSuffix(slashed, ".gitlab-ci.yaml"):
+		return GitLabCI, nil
+	}
+
+	var document map[string]interface{}
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return "", fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if jobs, ok := document["jobs"].(map[string]interface{}); ok && len(jobs) > 0 {
+		return GitHubActions, nil
+	}
+	if _, ok := document["stages"]; ok {
+		return GitLabCI, nil
+	}
+	return "", fmt.Errorf("%s is neither a GitHub Actions workflow nor a GitLab CI file", path)
+}
+
+// Import converts the CI file at the path into a Buildkite pipeline
+func Import(path string, content []byte) (string, error) {
+	format, err := DetectFormat(path, content)
+	if err != nil {
+		return "", err
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		return "", fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return "", fmt.Errorf("%s is empty or not a mapping", path)
+	}
+
+	var pipeline *yaml.Node
+	switch format {
+	case GitHubActions:
+		pipeline = convertGitHubActions(root.Content[0])
+	case GitLabCI:
+		pipeline = convertGitLabCI(root.Content[0])
+	}
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(pipeline); err != nil {
+		return "", fmt.Errorf("failed to write pipeline: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return "", fmt.Errorf("failed to write pipeline: %w", err)
+	}
+
+	header := fmt.Sprintf("# Imported from %s. Review the TODO comments before uploading.\n", filepath.Base(path))
+	return header + out.String(), nil
+}
+
+// stepKey turns a job name into a step key
+func stepKey(name string) string {
+	return strings.Trim(keyInvalidChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// uniqueKey returns the key, suffixed with the first free number when it's already taken,
+// and records it as taken
+func uniqueKey(key string, taken map[string]bool) string {
+	unique := key
+	for n := 2; taken[unique]; n++ {
+		unique = fmt.Sprintf("%s-%d", key, n)
+	}
+	taken[unique] = true
+	return unique
+}
+
+// mapping builds a YAML mapping node key by key
+type mapping struct {
+	node *yaml.Node
+}
+
+func newMapping() *mapping {
+	return &mapping{node: &yaml.Node{Kind: yaml.MappingNode}}
+}
+
+// set appends the key with its value
+func (m *mapping) set(key string, value *yaml.Node) {
+	m.node.Content = append(m.node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
+
+// note attaches a TODO comment above the last key set
+func (m *mapping) note(text string) {
+	m.node.Content[len(m.node.Content)-2].HeadComment = "TODO: " + text
+}
+
+// empty reports whether nothing has been set
+func (m *mapping) empty() bool {
+	return len(m.node.Content) == 0
+}
+
+// str is a string scalar, quoted when it would otherwise read as another type, and written
+// as a block when it spans lines
+func str(value string) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+	if strings.Contains(value, "\n") {
+		node.Style = yaml.LiteralStyle
+	}
+	return node
+}
+
+// scalar keeps a YAML scalar's own type, e.g. for an integer or boolean option
+func scalar(node *yaml.Node) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: node.Tag, Value: node.Value}
+}
+
+// list is a sequence of nodes
+func list(items ...*yaml.Node) *yaml.Node {
+	return &yaml.Node{Kind: yaml.SequenceNode, Content: items}
+}
+
+// mappingValue returns the value of the key in a YAML mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// stringValue returns the value of a scalar key, or ""
+func stringValue(node *yaml.Node, key string) string {
+	if value := mappingValue(node, key); value != nil && value.Kind == yaml.ScalarNode {
+		return value.Value
+	}
+	return ""
+}
+
+// stringList reads a scalar or a sequence of scalars as a list of strings
+func stringList(node *yaml.Node) []string {
+	if node == nil {
+		return nil
+	}
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if node.Value == "" {
+			return nil
+		}
+		return []string{node.Value}
+	case yaml.SequenceNode:
+		var values []string
+		for _, item := range node.Content {
+			if item.Kind == yaml.ScalarNode {
+				values = append(values, item.Value)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// escapeInterpolation defers a shell variable to the agent, since Buildkite interpolates
+// `$VAR` when the pipeline is uploaded
+func escapeInterpolation(value string) string {
+	return strings.ReplaceAll(value, "$", "$$")
+}
+
+// commandStep builds a command step from its commands, with a placeholder when there are none
+func commandStep(step *mapping, commands []string) {
+	switch len(commands) {
+	case 0:
+		step.set("command", str(`echo "TODO: port this job"`))
+	case 1:
+		step.set("command", str(commands[0]))
+	default:
+		items := make([]*yaml.Node, 0, len(commands))
+		for _, command := range commands {
+			items = append(items, str(command))
+		}
+		step.set("commands", list(items...))
+	}
+}
+
+// dockerImage runs the step in a container image with the docker plugin
+func dockerImage(step *mapping, image string) {
+	config := newMapping()
+	config.set("image", str(image))
+	plugin := newMapping()
+	plugin.set(dockerPlugin, config.node)
+	step.set("plugins", list(plugin.node))
+}
+
+// todo attaches TODO comments above a step, once per distinct note
+func todo(step *mapping, notes []string) {
+	if len(notes) == 0 {
+		return
+	}
+	seen := make(map[string]bool)
+	lines := make([]string, 0, len(notes))
+	for _, note := range notes {
+		if !seen[note] {
+			seen[note] = true
+			lines = append(lines, "TODO: "+note)
+		}
+	}
+	step.node.HeadComment = strings.Join(lines, "\n")
+}
@@ -0,0 +1,185 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		path     string
+		content  string
+		expected Format
+		wantErr  bool
+	}{
+		{path: "/repo/.github/workflows/ci.yml", expected: GitHubActions},
+		{path: "/repo/.gitlab-ci.yml", expected: GitLabCI},
+		{path: "/repo/ci/workflow.yml", content: "jobs:\n  build:\n    runs-on: ubuntu-latest\n", expected: GitHubActions},
+		{path: "/repo/ci/gitlab.yml", content: "stages: [build]\n", expected: GitLabCI},
+		{path: "/repo/ci/other.yml", content: "steps: []\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			format, err := DetectFormat(tt.path, []byte(tt.content))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got %s", format)
+				}
+				return
+			}
+			if err != nil || format != tt.expected {
+				t.Errorf("Expected %s, got %s (%v)", tt.expected, format, err)
+			}
+		})
+	}
+}
+
+func TestImport_GitHubActions(t *testing.T) {
+	pipeline, err := Import("/repo/.github/workflows/ci.yml", []byte(`on: [push, pull_request]
+env:
+  GO_VERSION: "1.22"
+jobs:
+  build:
+    name: Build ${{ matrix.os }}
+    runs-on: ubuntu-latest
+    container: golang:1.22
+    strategy:
+      matrix:
+        os: [linux, darwin]
+    steps:
+      - uses: actions/checkout@v4
+      - uses: actions/setup-go@v5
+      - run: go build ./...
+        working-directory: app
+      - run: echo "$HOME"
+      - uses: actions/upload-artifact@v4
+        with:
+          path: dist/
+  deploy:
+    needs: [build]
+    timeout-minutes: 10
+    continue-on-error: true
+    env:
+      TOKEN: ${{ secrets.DEPLOY_TOKEN }}
+    steps:
+      - run: ./deploy.sh ${{ github.sha }} ${{ github.event.number }}
+`))
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+
+	for _, expected := range []string{
+		"# Imported from ci.yml.",
+		"# TODO: the workflow ran on push, pull_request",
+		"label: Build {{matrix.os}}",
+		"key: build",
+		"cd app\n        go build ./...",
+		`echo "$$HOME"`,
+		"docker#v5.13.0:\n          image: golang:1.22",
+		"setup:\n        os:\n          - linux",
+		"artifact_paths:\n      - dist/",
+		"# TODO: replace the actions/setup-go@v5 action",
+		"# TODO: pick the agent queue for runs-on: ubuntu-latest",
+		"depends_on: build",
+		"timeout_in_minutes: 10",
+		"soft_fail: true",
+		"TOKEN: $$DEPLOY_TOKEN",
+		"# TODO: make the secret DEPLOY_TOKEN available to the agent",
+		"./deploy.sh $$BUILDKITE_COMMIT $${{ github.event.number }}",
+		"# TODO: replace the expression `github.event.number`",
+	} {
+		if !strings.Contains(pipeline, expected) {
+			t.Errorf("Expected pipeline to contain %q, got:\n%s", expected, pipeline)
+		}
+	}
+	if strings.Contains(pipeline, "checkout") {
+		t.Errorf("Expected the checkout action to be dropped, got:\n%s", pipeline)
+	}
+	assertValidYAML(t, pipeline)
+}
+
+func TestImport_GitLabCI(t *testing.T) {
+	pipeline, err := Import("/repo/.gitlab-ci.yml", []byte(`stages: [build, test, deploy]
+variables:
+  DOCKER_DRIVER: overlay2
+default:
+  image: golang:1.22
+  before_script:
+    - go version
+.template:
+  script: echo hidden
+build:
+  stage: build
+  script:
+    - go build -o bin/app ./...
+  artifacts:
+    paths: [bin/]
+unit tests:
+  script: go test ./... -run $TEST_FILTER
+  parallel: 3
+  retry: 2
+  allow_failure: true
+deploy:
+  stage: deploy
+  when: manual
+  only: [main]
+  needs: [build]
+  script:
+    - ./deploy.sh $CI_COMMIT_SHA
+  after_script:
+    - ./cleanup.sh
+`))
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+
+	var parsed struct {
+		Env   map[string]string `yaml:"env"`
+		Steps []yaml.Node       `yaml:"steps"`
+	}
+	if err := yaml.Unmarshal([]byte(pipeline), &parsed); err != nil {
+		t.Fatalf("Expected valid YAML, got %v:\n%s", err, pipeline)
+	}
+	if parsed.Env["DOCKER_DRIVER"] != "overlay2" {
+		t.Errorf("Expected variables to become env, got %v", parsed.Env)
+	}
+
+	// build, wait, unit tests, wait, the block for the manual job, deploy
+	if len(parsed.Steps) != 6 {
+		t.Fatalf("Expected 6 steps, got %d:\n%s", len(parsed.Steps), pipeline)
+	}
+
+	for _, expected := range []string{
+		"commands:\n      - go version\n      - go build -o bin/app ./...",
+		"docker#v5.13.0:\n          image: golang:1.22",
+		"artifact_paths:\n      - bin/",
+		"key: unit-tests",
+		"- go test ./... -run $$TEST_FILTER",
+		"parallelism: 3",
+		"retry:\n      automatic:\n        limit: 2",
+		"soft_fail: true",
+		"- block: Run deploy?",
+		"- ./deploy.sh $$BUILDKITE_COMMIT",
+		"depends_on:\n      - build",
+		"# TODO: after_script runs even when the job fails",
+		"# TODO: rewrite the job's only",
+	} {
+		if !strings.Contains(pipeline, expected) {
+			t.Errorf("Expected pipeline to contain %q, got:\n%s", expected, pipeline)
+		}
+	}
+	if strings.Contains(pipeline, "hidden") {
+		t.Errorf("Expected hidden jobs to be skipped, got:\n%s", pipeline)
+	}
+}
+
+func assertValidYAML(t *testing.T, pipeline string) {
+	t.Helper()
+	var parsed map[string]interface{}
+	if err := yaml.Unmarshal([]byte(pipeline), &parsed); err != nil {
+		t.Fatalf("Expected valid YAML, got %v:\n%s", err, pipeline)
+	}
+}
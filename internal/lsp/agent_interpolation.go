@@ -0,0 +1,253 @@
+package lsp
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+
+	bkcontext "github.com/mcncl/buildkite-ls/internal/context"
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+// interpolationPattern matches $$ escapes along with the reference they keep literal,
+// ${VAR}, ${VAR:-default} and $VAR interpolations, and a ${ that isn't followed by a
+// variable name and closing brace
+var interpolationPattern = regexp.MustCompile(`\$\$(?:\{([A-Za-z_][A-Za-z0-9_]*)[^}]*\}|([A-Za-z_][A-Za-z0-9_]*))?|\$\{([A-Za-z_][A-Za-z0-9_]*)[^}]*\}|\$([A-Za-z_][A-Za-z0-9_]*)|\$\{`)
+
+// interpolation is a variable reference in a value, as the agent's pipeline upload sees it
+type interpolation struct {
+	// Start and End are byte offsets into the text it was found in
+	Start, End int
+	// Name is the variable, or "" for a bare $$ and malformed references
+	Name    string
+	Escaped bool
+	Invalid bool
+}
+
+// findInterpolations lists the interpolations in text, in order
+func findInterpolations(text string) []interpolation {
+	var found []interpolation
+	for _, match := range interpolationPattern.FindAllStringSubmatchIndex(text, -1) {
+		ref := interpolation{Start: match[0], End: match[1], Escaped: strings.HasPrefix(text[match[0]:], "$$")}
+		for group := 1; group <= 4; group++ {
+			if match[2*group] >= 0 {
+				ref.Name = text[match[2*group]:match[2*group+1]]
+			}
+		}
+		ref.Invalid = ref.Name == "" && !ref.Escaped
+		found = append(found, ref)
+	}
+	return found
+}
+
+// hasInterpolation reports whether text has a variable the pipeline upload will substitute
+func hasInterpolation(text string) bool {
+	for _, ref := range findInterpolations(text) {
+		if !ref.Escaped {
+			return true
+		}
+	}
+	return false
+}
+
+// interpolationAt returns the interpolation under the cursor on an agents line, or nil
+func interpolationAt(line string, char int) *interpolation {
+	for _, ref := range findInterpolations(line) {
+		if char >= ref.Start && char <= ref.End {
+			return &ref
+		}
+	}
+	return nil
+}
+
+// envNames returns the variables an env mapping sets, with their values
+func envNames(env *yaml.Node) map[string]string {
+	names := make(map[string]string)
+	if env == nil || env.Kind != yaml.MappingNode {
+		return names
+	}
+	for i := 0; i+1 < len(env.Content); i += 2 {
+		names[env.Content[i].Value] = env.Content[i+1].Value
+	}
+	return names
+}
+
+// agentValues returns the scalar values of an agents mapping or `key=value` list
+func agentValues(agents *yaml.Node) []*yaml.Node {
+	var values []*yaml.Node
+	if agents == nil {
+		return values
+	}
+	switch agents.Kind {
+	case yaml.MappingNode:
+		for i := 1; i < len(agents.Content); i += 2 {
+			if agents.Content[i].Kind == yaml.ScalarNode {
+				values = append(values, agents.Content[i])
+			}
+		}
+	case yaml.SequenceNode:
+		for _, item := range agents.Content {
+			if item.Kind == yaml.ScalarNode {
+				values = append(values, item)
+			}
+		}
+	}
+	return values
+}
+
+// validateAgentInterpolation checks the interpolations in agent requirements. They are
+// substituted when the pipeline is uploaded, so variables only the step's env sets are
+// empty by the time the step is matched to an agent.
+func (s *Server) validateAgentInterpolation(pipeline *parser.Pipeline, lines []string) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	root := pipeline.YAMLNode
+	if root == nil || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return diagnostics
+	}
+	pipelineEnv := envNames(mappingValue(root.Content[0], "env"))
+
+	check := func(agents *yaml.Node, stepEnv map[string]string) {
+		for _, value := range agentValues(agents) {
+			if value.Line < 1 || value.Line > len(lines) || value.Style == yaml.LiteralStyle || value.Style == yaml.FoldedStyle {
+				continue
+			}
+			line := lines[value.Line-1]
+			start := value.Column - 1
+			length := len(value.Value)
+			if value.Style == yaml.DoubleQuotedStyle || value.Style == yaml.SingleQuotedStyle {
+				length += 2
+			}
+			end := min(start+length, len(line))
+			if start < 0 || start >= end {
+				continue
+			}
+
+			for _, ref := range findInterpolations(line[start:end]) {
+				refRange := protocol.Range{
+					Start: protocol.Position{Line: uint32(value.Line - 1), Character: uint32(start + ref.Start)},
+					End:   protocol.Position{Line: uint32(value.Line - 1), Character: uint32(start + ref.End)},
+				}
+				switch {
+				case ref.Invalid:
+					diagnostics = append(diagnostics, protocol.Diagnostic{
+						Range:    refRange,
+						Severity: protocol.DiagnosticSeverityError,
+						Message:  "Invalid interpolation: `${` must be followed by a variable name and a closing `}`. Use `$$` for a literal `$`",
+						Source:   "buildkite-ls",
+						Code:     "invalid-interpolation",
+					})
+				case ref.Escaped:
+					// Kept literal on purpose
+				default:
+					if _, inStepEnv := stepEnv[ref.Name]; !inStepEnv {
+						continue
+					}
+					if _, inPipelineEnv := pipelineEnv[ref.Name]; inPipelineEnv {
+						continue
+					}
+					diagnostics = append(diagnostics, protocol.Diagnostic{
+						Range:    refRange,
+						Severity: protocol.DiagnosticSeverityWarning,
+						Message: fmt.Sprintf("$%s is interpolated when the pipeline is uploaded, before the step's env is set, "+
+							"so it comes from the upload's environment instead. Set it in the pipeline's env, or escape it as $$ to keep it literal", ref.Name),
+						Source: "buildkite-ls",
+						Code:   "agent-step-env-interpolation",
+					})
+				}
+			}
+		}
+	}
+
+	check(mappingValue(root.Content[0], "agents"), nil)
+
+	var walkSteps func(steps *yaml.Node)
+	walkSteps = func(steps *yaml.Node) {
+		if steps == nil || steps.Kind != yaml.SequenceNode {
+			return
+		}
+		for _, step := range steps.Content {
+			if step.Kind != yaml.MappingNode {
+				continue
+			}
+			check(mappingValue(step, "agents"), envNames(mappingValue(step, "env")))
+			walkSteps(mappingValue(step, "steps"))
+		}
+	}
+	walkSteps(mappingValue(root.Content[0], "steps"))
+
+	return diagnostics
+}
+
+// getAgentInterpolationHoverContent explains when an interpolation in an agent requirement
+// is substituted, and what escaping it with $$ does
+func (s *Server) getAgentInterpolationHoverContent(posCtx *bkcontext.PositionContext) string {
+	if enclosingKey(posCtx.ContextLines) != "agents" {
+		return ""
+	}
+	ref := interpolationAt(posCtx.CurrentLine, posCtx.CharIndex)
+	if ref == nil {
+		return ""
+	}
+	written := posCtx.CurrentLine[ref.Start:ref.End]
+
+	if ref.Invalid {
+		return "**Invalid interpolation**\n\n`${` must be followed by a variable name and a closing `}`, such as `${QUEUE_NAME}`. Use `$$` for a literal `$`."
+	}
+	if ref.Escaped {
+		literal := strings.TrimPrefix(written, "$")
+		return fmt.Sprintf("**`%s`** is escaped\n\nThe pipeline upload turns it into the literal text `%s`. "+
+			"Agent requirements aren't interpolated again when the job runs, so the step only runs on agents with a tag value of exactly `%s`.",
+			written, literal, literal)
+	}
+
+	content := fmt.Sprintf("**`%s`** is interpolated when the pipeline is uploaded\n\n"+
+		"`buildkite-agent pipeline upload` substitutes `%s` from the upload's environment and the pipeline's top-level `env`. "+
+		"Agents are matched before any of the step's commands run, so the step's own `env` and variables set at runtime aren't available.\n\n"+
+		"| Written | Uploaded as |\n|---|---|\n"+
+		"| `${%[2]s}` | the variable's value, or empty when it's unset |\n"+
+		"| `${%[2]s:-default}` | the value, or `default` when it's unset or empty |\n"+
+		"| `$${%[2]s}` | the literal text `${%[2]s}` |",
+		written, ref.Name)
+
+	if pipeline, err := parser.ParseYAML([]byte(posCtx.FullContent)); err == nil && pipeline.YAMLNode != nil && len(pipeline.YAMLNode.Content) > 0 {
+		if value, ok := envNames(mappingValue(pipeline.YAMLNode.Content[0], "env"))[ref.Name]; ok {
+			content += fmt.Sprintf("\n\nThe pipeline's `env` sets `%s` to `%s`.", ref.Name, value)
+			return content
+		}
+	}
+	if _, step := stepEditOf(splitLines(posCtx.FullContent), int(posCtx.Position.Line)); step != nil {
+		if _, ok := envNames(mappingValue(step, "env"))[ref.Name]; ok {
+			content += fmt.Sprintf("\n\n⚠️ This step's `env` sets `%s`, but not until after the step has been matched to an agent.", ref.Name)
+		}
+	}
+	return content
+}
+
+// getAgentInterpolationActions offers to escape the interpolation under the cursor in an agent
+// requirement, for when it's meant literally rather than substituted on upload
+func (s *Server) getAgentInterpolationActions(params *protocol.CodeActionParams, doc *Document) []protocol.CodeAction {
+	line := int(params.Range.Start.Line)
+	if line >= len(doc.Lines) || enclosingKey(doc.Lines[:line+1]) != "agents" {
+		return nil
+	}
+	ref := interpolationAt(doc.Lines[line], int(params.Range.Start.Character))
+	if ref == nil || ref.Escaped || ref.Invalid {
+		return nil
+	}
+
+	action := quickFix(params.TextDocument.URI, fmt.Sprintf("Escape %s so it isn't interpolated on upload", doc.Lines[line][ref.Start:ref.End]),
+		[]protocol.TextEdit{{
+			Range:   protocol.Range{Start: protocol.Position{Line: uint32(line), Character: uint32(ref.Start)}, End: protocol.Position{Line: uint32(line), Character: uint32(ref.Start)}},
+			NewText: "$",
+		}})
+	for _, diagnostic := range params.Context.Diagnostics {
+		if diagnostic.Code == "agent-step-env-interpolation" && diagnostic.Range.Start.Line == uint32(line) && diagnostic.Range.Start.Character == uint32(ref.Start) {
+			action.Diagnostics = append(action.Diagnostics, diagnostic)
+		}
+	}
+	return []protocol.CodeAction{action}
+}
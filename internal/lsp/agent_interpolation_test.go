@@ -0,0 +1,173 @@
+package lsp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+const agentInterpolationPipeline = `env:
+  DEFAULT_QUEUE: builders
+agents:
+  queue: "${DEFAULT_QUEUE}"
+steps:
+  - label: Build
+    command: make
+    agents:
+      queue: hosted-linux-${SIZE:-medium}
+      os: $OS
+  - label: Deploy
+    command: make deploy
+    env:
+      DEPLOY_QUEUE: deploy
+    agents:
+      - "queue=${DEPLOY_QUEUE}"
+      - "team=$${TEAM}"
+      - "arch=${ARCH"`
+
+func TestFindInterpolations(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected []interpolation
+	}{
+		{"${QUEUE}", []interpolation{{Start: 0, End: 8, Name: "QUEUE"}}},
+		{"hosted-$SIZE", []interpolation{{Start: 7, End: 12, Name: "SIZE"}}},
+		{"${SIZE:-medium}", []interpolation{{Start: 0, End: 15, Name: "SIZE"}}},
+		{"$${TEAM} and $$", []interpolation{{Start: 0, End: 8, Name: "TEAM", Escaped: true}, {Start: 13, End: 15, Escaped: true}}},
+		{"${ARCH", []interpolation{{Start: 0, End: 2, Invalid: true}}},
+		{"linux", nil},
+	}
+
+	for _, tt := range tests {
+		got := findInterpolations(tt.text)
+		if len(got) != len(tt.expected) {
+			t.Errorf("findInterpolations(%q) = %+v, expected %+v", tt.text, got, tt.expected)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.expected[i] {
+				t.Errorf("findInterpolations(%q)[%d] = %+v, expected %+v", tt.text, i, got[i], tt.expected[i])
+			}
+		}
+	}
+}
+
+func TestServer_AgentInterpolationDiagnostics(t *testing.T) {
+	server := newTestServer()
+
+	var found []protocol.Diagnostic
+	for _, diagnostic := range server.Diagnose(agentInterpolationPipeline) {
+		if strings.Contains(diagnostic.Message, "hosted agent queue") {
+			t.Errorf("Expected interpolated hosted queues not to be flagged, got %+v", diagnostic)
+		}
+		if diagnostic.Code == "agent-step-env-interpolation" || diagnostic.Code == "invalid-interpolation" {
+			found = append(found, diagnostic)
+		}
+	}
+
+	expected := []struct {
+		code  string
+		line  uint32
+		start uint32
+		end   uint32
+	}{
+		{"agent-step-env-interpolation", 15, 15, 30},
+		{"invalid-interpolation", 17, 14, 16},
+	}
+	if len(found) != len(expected) {
+		t.Fatalf("Expected %d interpolation diagnostics, got %+v", len(expected), found)
+	}
+	for i, want := range expected {
+		got := found[i]
+		if got.Code != want.code || got.Range.Start.Line != want.line || got.Range.Start.Character != want.start || got.Range.End.Character != want.end {
+			t.Errorf("Diagnostic %d: expected %s at %d:%d-%d, got %v at %d:%d-%d", i, want.code, want.line, want.start, want.end,
+				got.Code, got.Range.Start.Line, got.Range.Start.Character, got.Range.End.Character)
+		}
+	}
+}
+
+func TestServer_AgentInterpolationHover(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	server.documentManager.OpenDocument(uri, 1, agentInterpolationPipeline)
+
+	tests := []struct {
+		name     string
+		position protocol.Position
+		expected []string
+	}{
+		{"pipeline env variable", protocol.Position{Line: 3, Character: 12}, []string{"is interpolated when the pipeline is uploaded", "`$${DEFAULT_QUEUE}`", "sets `DEFAULT_QUEUE` to `builders`"}},
+		{"default value", protocol.Position{Line: 8, Character: 30}, []string{"**`${SIZE:-medium}`**", "`${SIZE:-default}`"}},
+		{"step env variable", protocol.Position{Line: 15, Character: 20}, []string{"This step's `env` sets `DEPLOY_QUEUE`"}},
+		{"escaped", protocol.Position{Line: 16, Character: 16}, []string{"is escaped", "literal text `${TEAM}`"}},
+		{"invalid", protocol.Position{Line: 17, Character: 15}, []string{"**Invalid interpolation**"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hover, err := server.Hover(context.Background(), &protocol.HoverParams{
+				TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+					TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+					Position:     tt.position,
+				},
+			})
+			if err != nil || hover == nil {
+				t.Fatalf("Expected hover content, got %v (%v)", hover, err)
+			}
+			for _, expected := range tt.expected {
+				if !strings.Contains(hover.Contents.Value, expected) {
+					t.Errorf("Expected hover to contain %q, got:\n%s", expected, hover.Contents.Value)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_EscapeAgentInterpolationAction(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	server.documentManager.OpenDocument(uri, 1, agentInterpolationPipeline)
+
+	diagnostic := protocol.Diagnostic{
+		Range: protocol.Range{Start: protocol.Position{Line: 15, Character: 15}, End: protocol.Position{Line: 15, Character: 30}},
+		Code:  "agent-step-env-interpolation",
+	}
+	actions, err := server.CodeAction(context.Background(), &protocol.CodeActionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Range:        protocol.Range{Start: protocol.Position{Line: 15, Character: 18}, End: protocol.Position{Line: 15, Character: 18}},
+		Context:      protocol.CodeActionContext{Diagnostics: []protocol.Diagnostic{diagnostic}},
+	})
+	if err != nil {
+		t.Fatalf("CodeAction failed: %v", err)
+	}
+
+	var escape *protocol.CodeAction
+	for i := range actions {
+		if strings.HasPrefix(actions[i].Title, "Escape ${DEPLOY_QUEUE}") {
+			escape = &actions[i]
+		}
+	}
+	if escape == nil {
+		t.Fatalf("Expected an escape action, got %+v", actions)
+	}
+	if len(escape.Diagnostics) != 1 {
+		t.Errorf("Expected the action to fix the diagnostic, got %+v", escape.Diagnostics)
+	}
+	edits := escape.Edit.Changes[uri]
+	if len(edits) != 1 || edits[0].NewText != "$" || edits[0].Range.Start.Character != 15 || edits[0].Range.End.Character != 15 {
+		t.Errorf("Expected a $ inserted before the interpolation, got %+v", edits)
+	}
+
+	// Outside agents, interpolations are left alone
+	actions, _ = server.CodeAction(context.Background(), &protocol.CodeActionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Range:        protocol.Range{Start: protocol.Position{Line: 13, Character: 8}, End: protocol.Position{Line: 13, Character: 8}},
+	})
+	for _, action := range actions {
+		if strings.HasPrefix(action.Title, "Escape") {
+			t.Errorf("Expected no escape action outside agents, got %q", action.Title)
+		}
+	}
+}
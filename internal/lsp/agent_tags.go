@@ -0,0 +1,131 @@
+package lsp
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.lsp.dev/protocol"
+
+	"github.com/mcncl/buildkite-ls/internal/context"
+)
+
+// agentTag is an agent tag key with a conventional meaning
+type agentTag struct {
+	Name   string
+	Detail string
+	Docs   string
+}
+
+// agentTags are the tag keys most pipelines target agents by
+var agentTags = []agentTag{
+	{
+		Name:   "queue",
+		Detail: "Queue the agent listens on",
+		Docs: "**queue** - The queue the agent listens on\n\n" +
+			"Agents started without a queue tag listen on the `default` queue, and steps without one are scheduled there. " +
+			"Queues are how clusters, the Elastic CI Stack and hosted agents (`hosted`, `hosted-linux-large`, ...) divide up work.",
+	},
+	{
+		Name:   "os",
+		Detail: "Operating system of the agent",
+		Docs: "**os** - The agent's operating system\n\n" +
+			"Conventionally `linux`, `darwin` or `windows`, the values `buildkite-agent start --tags-from-host` sets.",
+	},
+	{
+		Name:   "arch",
+		Detail: "CPU architecture of the agent",
+		Docs: "**arch** - The agent's CPU architecture\n\n" +
+			"Conventionally `amd64` or `arm64`. The agent doesn't set it, so it must be added to the agent's tags.",
+	},
+	{
+		Name:   "docker",
+		Detail: "Whether Docker is available on the agent",
+		Docs: "**docker** - Whether the agent can run Docker\n\n" +
+			"Conventionally `true`, or the installed Docker version, on agents that can run the docker and docker-compose plugins.",
+	},
+}
+
+// agentTargetingDocs explains how step agent requirements match the tags agents are started with
+const agentTargetingDocs = "**Targeting agents**\n\n" +
+	"A step runs on an agent whose tags match every requirement. In the pipeline, requirements are a mapping:\n" +
+	"```yaml\nagents:\n  queue: \"deploy\"\n  os: \"linux\"\n```\n" +
+	"or a list of `key=value` strings:\n" +
+	"```yaml\nagents:\n  - \"queue=deploy\"\n  - \"os=linux\"\n```\n" +
+	"Agents are given tags as `key=value` pairs, with `tags=\"queue=deploy,os=linux\"` in `buildkite-agent.cfg`, " +
+	"`--tags` or `BUILDKITE_AGENT_TAGS`. Values can use `*` as a wildcard, such as `os: \"linux*\"`.\n\n" +
+	"[Agent Tags Documentation](https://buildkite.com/docs/agent/v3/cli-start#agent-targeting)"
+
+// agentTagKeyPattern matches an agents entry whose key is still being typed, in map or list form
+var agentTagKeyPattern = regexp.MustCompile(`^\s*(-\s*["']?)?\w*$`)
+
+// findAgentTag returns the conventional tag with the name, or nil
+func findAgentTag(name string) *agentTag {
+	for i := range agentTags {
+		if agentTags[i].Name == name {
+			return &agentTags[i]
+		}
+	}
+	return nil
+}
+
+// agentTagName returns the tag key an agents entry line sets, in map or `key=value` list form
+func agentTagName(line string) string {
+	trimmed := strings.TrimSpace(line)
+	if entry, ok := strings.CutPrefix(trimmed, "-"); ok {
+		name, _, _ := strings.Cut(strings.Trim(strings.TrimSpace(entry), `"'`), "=")
+		return name
+	}
+	return yamlKey(line)
+}
+
+// getAgentTagHoverContent documents a conventional tag key set under agents
+func (s *Server) getAgentTagHoverContent(posCtx *context.PositionContext, word string) string {
+	tag := findAgentTag(word)
+	if tag == nil || agentTagName(posCtx.CurrentLine) != word || enclosingKey(posCtx.ContextLines) != "agents" {
+		return ""
+	}
+	return tag.Docs + "\n\n" + agentTargetingDocs
+}
+
+// getAgentTagCompletions offers the conventional tag keys for an entry under agents
+func (cp *CompletionProvider) getAgentTagCompletions(posCtx *context.PositionContext) ([]protocol.CompletionItem, bool) {
+	beforeCursor := posCtx.CurrentLine
+	if posCtx.CharIndex <= len(beforeCursor) {
+		beforeCursor = beforeCursor[:posCtx.CharIndex]
+	}
+
+	match := agentTagKeyPattern.FindStringSubmatch(beforeCursor)
+	lines := posCtx.ContextLines
+	agentsLine := enclosingKeyLine(lines)
+	if match == nil || agentsLine < 0 || yamlKey(lines[agentsLine]) != "agents" {
+		return nil, false
+	}
+	listForm := match[1] != ""
+
+	// Tags already required aren't offered again
+	existing := make(map[string]bool)
+	for i := agentsLine + 1; i < len(lines)-1; i++ {
+		existing[agentTagName(lines[i])] = true
+	}
+
+	var items []protocol.CompletionItem
+	for i, tag := range agentTags {
+		if existing[tag.Name] {
+			continue
+		}
+		insertText := tag.Name + ": "
+		if listForm {
+			insertText = tag.Name + "="
+		}
+		items = append(items, protocol.CompletionItem{
+			Label:         tag.Name,
+			Kind:          protocol.CompletionItemKindProperty,
+			Detail:        tag.Detail,
+			Documentation: &protocol.MarkupContent{Kind: protocol.Markdown, Value: tag.Docs},
+			InsertText:    insertText,
+			SortText:      fmt.Sprintf("%02d", i),
+		})
+	}
+	return items, true
+}
@@ -0,0 +1,109 @@
+package lsp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+func TestServer_AgentTagHover(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	server.documentManager.OpenDocument(uri, 1, `agents:
+  queue: "deploy"
+steps:
+  - command: make build
+    agents:
+      - "arch=arm64"
+    env:
+      os: linux`)
+
+	tests := []struct {
+		name     string
+		position protocol.Position
+		expected string
+	}{
+		{"map form", protocol.Position{Line: 1, Character: 3}, "**queue**"},
+		{"list form", protocol.Position{Line: 5, Character: 10}, "**arch**"},
+		{"outside agents", protocol.Position{Line: 7, Character: 7}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hover, err := server.Hover(context.Background(), &protocol.HoverParams{
+				TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+					TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+					Position:     tt.position,
+				},
+			})
+			if err != nil {
+				t.Fatalf("Hover failed: %v", err)
+			}
+
+			if tt.expected == "" {
+				if hover != nil && strings.Contains(hover.Contents.Value, "Targeting agents") {
+					t.Errorf("Expected no agent tag hover, got:\n%s", hover.Contents.Value)
+				}
+				return
+			}
+			if hover == nil {
+				t.Fatal("Expected hover content")
+			}
+			for _, expected := range []string{tt.expected, "Targeting agents", "`key=value`"} {
+				if !strings.Contains(hover.Contents.Value, expected) {
+					t.Errorf("Expected hover to contain %q, got:\n%s", expected, hover.Contents.Value)
+				}
+			}
+		})
+	}
+}
+
+func TestCompletionProvider_AgentTags(t *testing.T) {
+	provider := newTestCompletionProvider()
+
+	tests := []struct {
+		name       string
+		content    string
+		labels     []string
+		insertText string
+	}{
+		{
+			name:       "map form",
+			content:    "agents:\n  queue: deploy\n  ",
+			labels:     []string{"os", "arch", "docker"},
+			insertText: "os: ",
+		},
+		{
+			name:       "list form",
+			content:    "steps:\n  - command: make\n    agents:\n      - \"",
+			labels:     []string{"queue", "os", "arch", "docker"},
+			insertText: "queue=",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, ok := provider.getAgentTagCompletions(blockStepPositionContext(tt.content))
+			if !ok {
+				t.Fatal("Expected agent tag completions")
+			}
+			if len(items) != len(tt.labels) {
+				t.Fatalf("Expected %d completions, got %+v", len(tt.labels), items)
+			}
+			for i, label := range tt.labels {
+				if items[i].Label != label {
+					t.Errorf("Completion %d: expected %q, got %q", i, label, items[i].Label)
+				}
+			}
+			if items[0].InsertText != tt.insertText {
+				t.Errorf("Expected insert text %q, got %q", tt.insertText, items[0].InsertText)
+			}
+		})
+	}
+
+	if _, ok := provider.getAgentTagCompletions(blockStepPositionContext("steps:\n  - command: make\n    env:\n      ")); ok {
+		t.Error("Expected no agent tag completions outside agents")
+	}
+}
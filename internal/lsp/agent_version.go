@@ -0,0 +1,175 @@
+package lsp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+// agentVersion is a Buildkite agent release, major.minor.patch
+type agentVersion [3]int
+
+// agentFeature is a step field that needs an agent at least as new as Since to upload
+type agentFeature struct {
+	// Path is the field's keys from the step, e.g. "matrix.adjustments"
+	Path  string
+	Since agentVersion
+}
+
+// agentFeatures are the step fields older agents reject or ignore, in the order they shipped
+var agentFeatures = []agentFeature{
+	{Path: "matrix", Since: agentVersion{3, 45, 0}},
+	{Path: "matrix.adjustments", Since: agentVersion{3, 46, 0}},
+	{Path: "signature", Since: agentVersion{3, 59, 0}},
+	{Path: "cache", Since: agentVersion{3, 79, 0}},
+	{Path: "secrets", Since: agentVersion{3, 93, 0}},
+}
+
+// parseAgentVersion reads a version such as "3.45", "v3.45.0" or "3.45.0-beta.1". Missing
+// minor and patch numbers are zero and pre-release suffixes are ignored.
+func parseAgentVersion(text string) (agentVersion, bool) {
+	var version agentVersion
+	text = strings.TrimPrefix(strings.TrimSpace(text), "v")
+	if i := strings.IndexAny(text, "-+"); i >= 0 {
+		text = text[:i]
+	}
+
+	parts := strings.Split(text, ".")
+	if len(parts) > len(version) {
+		return version, false
+	}
+	for i, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 {
+			return version, false
+		}
+		version[i] = number
+	}
+	return version, true
+}
+
+// String formats the version as the agent reports it
+func (v agentVersion) String() string {
+	return fmt.Sprintf("v%d.%d.%d", v[0], v[1], v[2])
+}
+
+// before reports whether the version is older than the other
+func (v agentVersion) before(other agentVersion) bool {
+	for i := range v {
+		if v[i] != other[i] {
+			return v[i] < other[i]
+		}
+	}
+	return false
+}
+
+// targetAgentVersion returns the agent version pipelines are checked against, if the user
+// configured one
+func (s *Server) targetAgentVersion() (agentVersion, bool) {
+	configured := s.Settings().AgentVersion
+	if configured == "" {
+		return agentVersion{}, false
+	}
+	version, ok := parseAgentVersion(configured)
+	if !ok {
+		s.logger.Printf("Ignoring agentVersion %q, expected a version such as 3.45.0", configured)
+	}
+	return version, ok
+}
+
+// unsupportedAgentFeature reports whether the target version lacks the feature at the path
+func unsupportedAgentFeature(path string, target agentVersion) bool {
+	for _, feature := range agentFeatures {
+		if feature.Path == path {
+			return target.before(feature.Since)
+		}
+	}
+	return false
+}
+
+// validateAgentVersion flags step fields the configured agent version doesn't support, so
+// pipelines aren't written against features the agent fleet can't upload yet
+func (s *Server) validateAgentVersion(pipeline *parser.Pipeline) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	target, ok := s.targetAgentVersion()
+	if !ok {
+		return diagnostics
+	}
+
+	root := pipeline.YAMLNode
+	if root == nil || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return diagnostics
+	}
+	root = root.Content[0]
+
+	var walkSteps func(steps *yaml.Node)
+	walkSteps = func(steps *yaml.Node) {
+		if steps == nil || steps.Kind != yaml.SequenceNode {
+			return
+		}
+		for _, step := range steps.Content {
+			if step.Kind != yaml.MappingNode {
+				continue
+			}
+			for _, feature := range agentFeatures {
+				if !target.before(feature.Since) {
+					continue
+				}
+				// A field inside an unsupported one is covered by the warning on its parent
+				if parent, _, nested := strings.Cut(feature.Path, "."); nested && unsupportedAgentFeature(parent, target) {
+					continue
+				}
+				if entry := featureEntry(step, feature.Path); entry != nil {
+					diagnostics = append(diagnostics, nodeDiagnostic(entry.key, protocol.DiagnosticSeverityWarning, "unsupported-agent-feature",
+						fmt.Sprintf("`%s` needs Buildkite agent %s or later, but agentVersion is %s", feature.Path, feature.Since, target)))
+				}
+			}
+			walkSteps(mappingValue(step, "steps"))
+		}
+	}
+	walkSteps(mappingValue(root, "steps"))
+
+	return diagnostics
+}
+
+// featureEntry follows a dotted path of keys from a step to the entry it names, or nil
+func featureEntry(step *yaml.Node, path string) *mappingEntry {
+	var entry *mappingEntry
+	node := step
+	for _, key := range strings.Split(path, ".") {
+		if entry = mappingKey(node, key); entry == nil {
+			return nil
+		}
+		node = entry.value
+	}
+	return entry
+}
+
+// gateAgentFeatureCompletions leaves step fields the configured agent version doesn't
+// support out of completions, and the adjustments out of the matrix snippet
+func (s *Server) gateAgentFeatureCompletions(items []protocol.CompletionItem) []protocol.CompletionItem {
+	target, ok := s.targetAgentVersion()
+	if !ok {
+		return items
+	}
+
+	gated := items[:0]
+	for _, item := range items {
+		if item.Kind == protocol.CompletionItemKindProperty {
+			if unsupportedAgentFeature(item.Label, target) {
+				continue
+			}
+			if item.Label == "matrix" && unsupportedAgentFeature("matrix.adjustments", target) {
+				item.InsertText, _, _ = strings.Cut(item.InsertText, "\n  adjustments:")
+			}
+		}
+		gated = append(gated, item)
+	}
+	return gated
+}
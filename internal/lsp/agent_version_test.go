@@ -0,0 +1,143 @@
+package lsp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+const agentVersionPipeline = `steps:
+  - label: Test
+    command: make test
+    matrix:
+      setup:
+        os: [linux, darwin]
+      adjustments:
+        - with:
+            os: darwin
+          soft_fail: true
+  - group: Release
+    steps:
+      - label: Build
+        command: make
+        cache:
+          - node_modules
+        secrets:
+          - NPM_TOKEN`
+
+func TestParseAgentVersion(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected agentVersion
+		ok       bool
+	}{
+		{"3.45.0", agentVersion{3, 45, 0}, true},
+		{"v3.45.1", agentVersion{3, 45, 1}, true},
+		{"3.45", agentVersion{3, 45, 0}, true},
+		{"3.100.0-beta.1", agentVersion{3, 100, 0}, true},
+		{"latest", agentVersion{}, false},
+		{"3.45.0.1", agentVersion{}, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseAgentVersion(tt.text)
+		if ok != tt.ok || (ok && got != tt.expected) {
+			t.Errorf("parseAgentVersion(%q) = %v, %v, expected %v, %v", tt.text, got, ok, tt.expected, tt.ok)
+		}
+	}
+
+	if !(agentVersion{3, 9, 0}).before(agentVersion{3, 45, 0}) || (agentVersion{3, 45, 0}).before(agentVersion{3, 45, 0}) {
+		t.Error("Expected versions to compare numerically")
+	}
+}
+
+func TestServer_AgentVersionDiagnostics(t *testing.T) {
+	tests := []struct {
+		name     string
+		version  string
+		expected []string
+	}{
+		{"latest agent", "", nil},
+		{"unparseable version", "latest", nil},
+		{"new agent", "3.100.0", nil},
+		{"before cache and secrets", "3.60.0", []string{"cache", "secrets"}},
+		{"before matrix adjustments", "3.45.2", []string{"matrix.adjustments", "cache", "secrets"}},
+		{"before matrix", "v3.40.0", []string{"matrix", "cache", "secrets"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer()
+			server.applySettings(parseSettings(map[string]interface{}{"agentVersion": tt.version}))
+
+			var flagged []string
+			for _, diagnostic := range server.Diagnose(agentVersionPipeline) {
+				if diagnostic.Code != "unsupported-agent-feature" {
+					continue
+				}
+				field := strings.Split(diagnostic.Message, "`")[1]
+				flagged = append(flagged, field)
+				if !strings.HasSuffix(field, lineAt(agentVersionPipeline, diagnostic.Range)) {
+					t.Errorf("Expected the diagnostic on the %s key, got %+v", field, diagnostic.Range)
+				}
+			}
+			if strings.Join(flagged, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Expected %v flagged, got %v", tt.expected, flagged)
+			}
+		})
+	}
+}
+
+// lineAt returns the text a single line range covers
+func lineAt(content string, r protocol.Range) string {
+	line := strings.Split(content, "\n")[r.Start.Line]
+	return line[r.Start.Character:r.End.Character]
+}
+
+func TestServer_AgentVersionCompletions(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	server.documentManager.OpenDocument(uri, 1, "steps:\n  - label: \"test\"\n    ")
+
+	complete := func() map[string]protocol.CompletionItem {
+		result, err := server.Completion(context.Background(), &protocol.CompletionParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+				Position:     protocol.Position{Line: 2, Character: 4},
+			},
+		})
+		if err != nil {
+			t.Fatalf("Completion failed: %v", err)
+		}
+		items := make(map[string]protocol.CompletionItem)
+		for _, item := range result.Items {
+			items[item.Label] = item
+		}
+		return items
+	}
+
+	items := complete()
+	if _, ok := items["cache"]; !ok {
+		t.Fatal("Expected cache to be offered without an agentVersion")
+	}
+	if !strings.Contains(items["matrix"].InsertText, "adjustments:") {
+		t.Errorf("Expected the matrix snippet to include adjustments, got %q", items["matrix"].InsertText)
+	}
+
+	server.applySettings(parseSettings(map[string]interface{}{"agentVersion": "3.45.0"}))
+	items = complete()
+	for _, field := range []string{"cache", "secrets"} {
+		if _, ok := items[field]; ok {
+			t.Errorf("Expected %s to be left out for agent v3.45.0", field)
+		}
+	}
+	matrix, ok := items["matrix"]
+	if !ok || strings.Contains(matrix.InsertText, "adjustments") || !strings.Contains(matrix.InsertText, "setup:") {
+		t.Errorf("Expected the matrix snippet without adjustments, got %q", matrix.InsertText)
+	}
+	if _, ok := items["label"]; !ok {
+		t.Error("Expected fields every agent supports to still be offered")
+	}
+}
@@ -0,0 +1,54 @@
+package lsp
+
+import (
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+// validateAnchors points out anchors no alias refers to, which are often left behind when
+// the steps using them are refactored. Aliases to anchors that aren't defined fail to parse,
+// so they're reported with the syntax errors.
+func (s *Server) validateAnchors(pipeline *parser.Pipeline) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	if pipeline.YAMLNode == nil {
+		return diagnostics
+	}
+
+	var anchored []*yaml.Node
+	aliased := make(map[*yaml.Node]bool)
+	var walk func(node *yaml.Node)
+	walk = func(node *yaml.Node) {
+		if node.Kind == yaml.AliasNode {
+			aliased[node.Alias] = true
+			return
+		}
+		if node.Anchor != "" {
+			anchored = append(anchored, node)
+		}
+		for _, child := range node.Content {
+			walk(child)
+		}
+	}
+	walk(pipeline.YAMLNode)
+
+	for _, node := range anchored {
+		if aliased[node] {
+			continue
+		}
+		// The anchored node starts at the &
+		start := protocol.Position{Line: uint32(node.Line - 1), Character: uint32(node.Column - 1)}
+		diagnostics = append(diagnostics, protocol.Diagnostic{
+			Range:    protocol.Range{Start: start, End: protocol.Position{Line: start.Line, Character: start.Character + uint32(len(node.Anchor)) + 1}},
+			Severity: protocol.DiagnosticSeverityHint,
+			Message:  "Anchor &" + node.Anchor + " is never used: no alias refers to it",
+			Source:   "buildkite-ls",
+			Code:     "unused-anchor",
+			Tags:     []protocol.DiagnosticTag{protocol.DiagnosticTagUnnecessary},
+		})
+	}
+
+	return diagnostics
+}
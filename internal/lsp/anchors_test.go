@@ -0,0 +1,72 @@
+package lsp
+
+import (
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+func TestServer_ValidateAnchors(t *testing.T) {
+	server := newTestServer()
+
+	content := `defaults: &defaults
+  timeout_in_minutes: 10
+agents: &agents
+  queue: default
+steps:
+  - <<: *defaults
+    command: make
+    env: &env
+      CI: "true"
+  - command: make test
+`
+	pipeline, err := parser.ParseYAML([]byte(content))
+	if err != nil {
+		t.Fatalf("ParseYAML failed: %v", err)
+	}
+
+	diagnostics := server.validateAnchors(pipeline)
+	if len(diagnostics) != 2 {
+		t.Fatalf("Expected 2 unused anchors, got %d: %+v", len(diagnostics), diagnostics)
+	}
+
+	expected := []protocol.Range{
+		{Start: protocol.Position{Line: 2, Character: 8}, End: protocol.Position{Line: 2, Character: 15}},
+		{Start: protocol.Position{Line: 7, Character: 9}, End: protocol.Position{Line: 7, Character: 13}},
+	}
+	for i, diagnostic := range diagnostics {
+		if diagnostic.Code != "unused-anchor" || diagnostic.Severity != protocol.DiagnosticSeverityHint {
+			t.Errorf("Expected an unused-anchor hint, got %+v", diagnostic)
+		}
+		if len(diagnostic.Tags) != 1 || diagnostic.Tags[0] != protocol.DiagnosticTagUnnecessary {
+			t.Errorf("Expected the hint to be tagged unnecessary, got %v", diagnostic.Tags)
+		}
+		if diagnostic.Range != expected[i] {
+			t.Errorf("Expected range %+v, got %+v", expected[i], diagnostic.Range)
+		}
+	}
+	if !strings.Contains(diagnostics[0].Message, "&agents") {
+		t.Errorf("Expected the message to name the anchor, got %q", diagnostics[0].Message)
+	}
+}
+
+func TestServer_UndefinedAlias(t *testing.T) {
+	server := newTestServer()
+
+	content := "defaults: &defaults\n  timeout_in_minutes: 10\nsteps:\n  - <<: *default\n    command: make\n"
+	diagnostics := server.Diagnose(content)
+	if len(diagnostics) != 1 {
+		t.Fatalf("Expected 1 diagnostic, got %d: %+v", len(diagnostics), diagnostics)
+	}
+
+	diagnostic := diagnostics[0]
+	if diagnostic.Severity != protocol.DiagnosticSeverityError || diagnostic.Range.Start.Line != 3 || diagnostic.Range.Start.Character != 8 {
+		t.Errorf("Expected an error at the alias, got %+v", diagnostic)
+	}
+	if !strings.Contains(diagnostic.Message, "did you mean *defaults?") {
+		t.Errorf("Expected a suggestion, got %q", diagnostic.Message)
+	}
+}
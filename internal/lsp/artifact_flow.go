@@ -0,0 +1,399 @@
+package lsp
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+
+	"github.com/mcncl/buildkite-ls/internal/parser"
+	"github.com/mcncl/buildkite-ls/internal/plugins"
+)
+
+// artifactReference is a path or glob a step uploads or downloads, and where it's written
+type artifactReference struct {
+	Path     string
+	Step     int
+	Location protocol.Location
+}
+
+// stepArtifacts are the artifacts a step uploads and downloads
+type stepArtifacts struct {
+	Uploads   []artifactReference
+	Downloads []artifactReference
+}
+
+// agentFlagsWithValues are the `buildkite-agent artifact` flags followed by a value
+var agentFlagsWithValues = map[string]bool{
+	"--build":              true,
+	"--step":               true,
+	"--job":                true,
+	"--content-type":       true,
+	"--upload-concurrency": true,
+}
+
+// validateArtifactFlow warns on artifacts a step downloads that no earlier step uploads,
+// through artifact_paths, `buildkite-agent artifact upload` or the artifacts plugin. The
+// step that uploads them later, or the one uploading the closest path, is given as related.
+func (s *Server) validateArtifactFlow(uri protocol.DocumentURI, pipeline *parser.Pipeline, lines []string) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	root := pipeline.YAMLNode
+	if root == nil || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return diagnostics
+	}
+
+	var steps []stepArtifacts
+	var walkSteps func(list *yaml.Node)
+	walkSteps = func(list *yaml.Node) {
+		if list == nil || list.Kind != yaml.SequenceNode {
+			return
+		}
+		for _, step := range list.Content {
+			if step.Kind != yaml.MappingNode {
+				continue
+			}
+			if nested := mappingValue(step, "steps"); nested != nil {
+				walkSteps(nested)
+				continue
+			}
+			steps = append(steps, s.collectStepArtifacts(uri, step, len(steps), lines))
+		}
+	}
+	walkSteps(mappingValue(root.Content[0], "steps"))
+
+	var uploads []artifactReference
+	for _, step := range steps {
+		uploads = append(uploads, step.Uploads...)
+	}
+
+	for i, step := range steps {
+		for _, download := range step.Downloads {
+			producer := artifactProducer(uploads, download, i)
+			if producer != nil && producer.Step < i {
+				continue
+			}
+
+			diagnostic := protocol.Diagnostic{
+				Range:    download.Location.Range,
+				Severity: protocol.DiagnosticSeverityWarning,
+				Message:  fmt.Sprintf("No earlier step uploads '%s', so there will be nothing to download", download.Path),
+				Source:   "buildkite-ls",
+				Code:     "artifact-never-uploaded",
+			}
+			if producer != nil {
+				diagnostic.Message = fmt.Sprintf("'%s' is only uploaded by a later step, so it won't exist yet when this step downloads it", download.Path)
+				diagnostic.RelatedInformation = []protocol.DiagnosticRelatedInformation{{
+					Location: producer.Location,
+					Message:  fmt.Sprintf("'%s' is uploaded here", producer.Path),
+				}}
+			} else if closest := closestArtifactUpload(uploads, download); closest != nil {
+				diagnostic.RelatedInformation = []protocol.DiagnosticRelatedInformation{{
+					Location: closest.Location,
+					Message:  fmt.Sprintf("The closest upload is '%s'", closest.Path),
+				}}
+			}
+			diagnostics = append(diagnostics, diagnostic)
+		}
+	}
+
+	return diagnostics
+}
+
+// collectStepArtifacts finds the artifacts a step uploads and downloads
+func (s *Server) collectStepArtifacts(uri protocol.DocumentURI, step *yaml.Node, index int, lines []string) stepArtifacts {
+	var artifacts stepArtifacts
+	reference := func(node *yaml.Node, path string) artifactReference {
+		return artifactReference{
+			Path:     path,
+			Step:     index,
+			Location: protocol.Location{URI: uri, Range: nodeTextRange(node, path, lines)},
+		}
+	}
+
+	if value := mappingValue(step, "artifact_paths"); value != nil {
+		entries := []*yaml.Node{value}
+		if value.Kind == yaml.SequenceNode {
+			entries = value.Content
+		}
+		for _, entry := range entries {
+			if entry.Kind != yaml.ScalarNode {
+				continue
+			}
+			for _, path := range splitArtifactPaths(entry.Value) {
+				artifacts.Uploads = append(artifacts.Uploads, reference(entry, path))
+			}
+		}
+	}
+
+	for _, key := range []string{"command", "commands"} {
+		value := mappingValue(step, key)
+		if value == nil {
+			continue
+		}
+		entries := []*yaml.Node{value}
+		if value.Kind == yaml.SequenceNode {
+			entries = value.Content
+		}
+		for _, entry := range entries {
+			if entry.Kind != yaml.ScalarNode {
+				continue
+			}
+			uploads, downloads := agentArtifactPaths(entry.Value)
+			for _, path := range uploads {
+				artifacts.Uploads = append(artifacts.Uploads, reference(entry, path))
+			}
+			for _, path := range downloads {
+				artifacts.Downloads = append(artifacts.Downloads, reference(entry, path))
+			}
+		}
+	}
+
+	pluginList := mappingValue(step, "plugins")
+	if pluginList == nil || pluginList.Kind != yaml.SequenceNode {
+		return artifacts
+	}
+	for _, plugin := range pluginList.Content {
+		if plugin.Kind != yaml.MappingNode || len(plugin.Content) < 2 {
+			continue
+		}
+		parsed := plugins.ParsePluginReference(s.pluginRegistry.ResolveAlias(plugin.Content[0].Value))
+		config := plugin.Content[1]
+		if parsed == nil || parsed.Org != "buildkite-plugins" || parsed.Name != "artifacts" || config.Kind != yaml.MappingNode {
+			continue
+		}
+		// Artifacts from another build are out of reach of this pipeline
+		if mappingValue(config, "build") != nil {
+			continue
+		}
+		for _, node := range pluginArtifactPaths(mappingValue(config, "upload"), "to") {
+			artifacts.Uploads = append(artifacts.Uploads, reference(node, node.Value))
+		}
+		for _, node := range pluginArtifactPaths(mappingValue(config, "download"), "from") {
+			artifacts.Downloads = append(artifacts.Downloads, reference(node, node.Value))
+		}
+	}
+
+	return artifacts
+}
+
+// pluginArtifactPaths returns the paths of an artifacts plugin upload or download, which can
+// be a path, a list of paths, or a list of from/to pairs, of which field names the artifact
+func pluginArtifactPaths(value *yaml.Node, field string) []*yaml.Node {
+	if value == nil {
+		return nil
+	}
+	entries := []*yaml.Node{value}
+	if value.Kind == yaml.SequenceNode {
+		entries = value.Content
+	}
+
+	var paths []*yaml.Node
+	for _, entry := range entries {
+		if entry.Kind == yaml.MappingNode {
+			if path := mappingValue(entry, field); path != nil {
+				entry = path
+			} else {
+				entry = mappingValue(entry, "from")
+			}
+		}
+		if entry != nil && entry.Kind == yaml.ScalarNode && entry.Value != "" {
+			paths = append(paths, entry)
+		}
+	}
+	return paths
+}
+
+// agentArtifactPaths finds the paths of `buildkite-agent artifact upload` and `download`
+// commands in a script. Downloads from another build and paths built from variables are
+// left out, as what they refer to can't be known here.
+func agentArtifactPaths(script string) (uploads, downloads []string) {
+	for _, line := range strings.Split(script, "\n") {
+		fields := strings.Fields(line)
+		for i := 0; i+2 < len(fields); i++ {
+			if fields[i] != "buildkite-agent" || fields[i+1] != "artifact" {
+				continue
+			}
+			command := fields[i+2]
+			if command != "upload" && command != "download" {
+				continue
+			}
+
+			var args []string
+			fromBuild := false
+			for j := i + 3; j < len(fields); j++ {
+				field := fields[j]
+				if field == "&&" || field == "||" || field == "|" || field == ";" {
+					break
+				}
+				if strings.HasPrefix(field, "--") {
+					flag, _, hasValue := strings.Cut(field, "=")
+					fromBuild = fromBuild || flag == "--build"
+					if !hasValue && agentFlagsWithValues[flag] {
+						j++
+					}
+					continue
+				}
+				args = append(args, strings.Trim(strings.TrimSuffix(field, ";"), `"'`))
+				if strings.HasSuffix(field, ";") {
+					break
+				}
+			}
+			if len(args) == 0 || strings.Contains(args[0], "$") {
+				continue
+			}
+
+			switch {
+			case command == "upload":
+				uploads = append(uploads, splitArtifactPaths(args[0])...)
+			case !fromBuild:
+				downloads = append(downloads, args[0])
+			}
+		}
+	}
+	return uploads, downloads
+}
+
+// artifactProducer returns the first upload from another step that can produce the
+// download, preferring those before the downloading step
+func artifactProducer(uploads []artifactReference, download artifactReference, step int) *artifactReference {
+	var later *artifactReference
+	for i := range uploads {
+		if uploads[i].Step == step || !artifactGlobsOverlap(uploads[i].Path, download.Path) {
+			continue
+		}
+		if uploads[i].Step < step {
+			return &uploads[i]
+		}
+		if later == nil {
+			later = &uploads[i]
+		}
+	}
+	return later
+}
+
+// closestArtifactUpload returns the upload sharing the longest leading directories with the
+// download, or the same file name, or nil if none has either
+func closestArtifactUpload(uploads []artifactReference, download artifactReference) *artifactReference {
+	var closest *artifactReference
+	best := 0
+	for i := range uploads {
+		score := commonDirectoryLength(uploads[i].Path, download.Path)
+		if baseName(uploads[i].Path) == baseName(download.Path) {
+			score += len(baseName(download.Path))
+		}
+		if score > best {
+			closest, best = &uploads[i], score
+		}
+	}
+	return closest
+}
+
+// commonDirectoryLength is the length of the leading directories two paths share
+func commonDirectoryLength(a, b string) int {
+	length := 0
+	for i := 0; i < len(a) && i < len(b) && a[i] == b[i]; i++ {
+		if a[i] == '/' {
+			length = i + 1
+		}
+	}
+	return length
+}
+
+// baseName is the last element of a path
+func baseName(path string) string {
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+// artifactGlobsOverlap reports whether an uploaded glob can produce a downloaded path or
+// glob. Two globs are taken to overlap when the fixed part of either starts with the other's.
+func artifactGlobsOverlap(upload, download string) bool {
+	upload, download = strings.TrimPrefix(upload, "./"), strings.TrimPrefix(download, "./")
+	if upload == download || artifactGlobPattern(upload).MatchString(download) || artifactGlobPattern(download).MatchString(upload) {
+		return true
+	}
+
+	uploadPrefix, downloadPrefix := globPrefix(upload), globPrefix(download)
+	return uploadPrefix != upload && downloadPrefix != download &&
+		(strings.HasPrefix(uploadPrefix, downloadPrefix) || strings.HasPrefix(downloadPrefix, uploadPrefix))
+}
+
+// globPrefix is the part of a glob before its first wildcard
+func globPrefix(glob string) string {
+	if i := strings.IndexAny(glob, "*?[{"); i >= 0 {
+		return glob[:i]
+	}
+	return glob
+}
+
+// artifactGlobPattern converts an artifact glob to a regular expression matching the paths
+// it selects: `**` crosses directories, `*` and `?` don't, and `{a,b}` is either alternative
+func artifactGlobPattern(glob string) *regexp.Regexp {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if strings.HasPrefix(glob[i:], "**/") {
+				pattern.WriteString("(.*/)?")
+				i += 2
+			} else if strings.HasPrefix(glob[i:], "**") {
+				pattern.WriteString(".*")
+				i++
+			} else {
+				pattern.WriteString("[^/]*")
+			}
+		case '?':
+			pattern.WriteString("[^/]")
+		case '{':
+			pattern.WriteString("(")
+		case '}':
+			pattern.WriteString(")")
+		case ',':
+			if strings.Count(glob[:i], "{") > strings.Count(glob[:i], "}") {
+				pattern.WriteString("|")
+			} else {
+				pattern.WriteString(",")
+			}
+		default:
+			pattern.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	pattern.WriteString("$")
+
+	compiled, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return regexp.MustCompile("^" + regexp.QuoteMeta(glob) + "$")
+	}
+	return compiled
+}
+
+// nodeTextRange finds text within a scalar node's lines, falling back to the node's start
+func nodeTextRange(node *yaml.Node, text string, lines []string) protocol.Range {
+	first := node.Line - 1
+	from := node.Column - 1
+	// Block scalars start on the line after their header
+	if node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+		first++
+		from = 0
+	}
+	last := first + strings.Count(node.Value, "\n")
+
+	for line := first; line <= last && line < len(lines); line++ {
+		start := 0
+		if line == node.Line-1 {
+			start = min(from, len(lines[line]))
+		}
+		if index := strings.Index(lines[line][start:], text); index >= 0 {
+			return protocol.Range{
+				Start: protocol.Position{Line: uint32(line), Character: uint32(start + index)},
+				End:   protocol.Position{Line: uint32(line), Character: uint32(start + index + len(text))},
+			}
+		}
+	}
+
+	start := nodeStart(node)
+	return protocol.Range{Start: start, End: start}
+}
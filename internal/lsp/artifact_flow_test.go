@@ -0,0 +1,129 @@
+package lsp
+
+import (
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+// artifactFlowDiagnosticsFor returns the diagnostics raised for artifact downloads
+func artifactFlowDiagnosticsFor(t *testing.T, server *Server, uri protocol.DocumentURI, content string) []protocol.Diagnostic {
+	t.Helper()
+	pipeline, err := parser.ParseYAML([]byte(content))
+	if err != nil {
+		t.Fatalf("Failed to parse YAML: %v", err)
+	}
+	return server.validateArtifactFlow(uri, pipeline, splitLines(content))
+}
+
+func TestServer_ValidateArtifactFlow(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+
+	content := `steps:
+  - label: Build
+    command: make
+    artifact_paths: "dist/**/*;coverage/*"
+  - wait
+  - label: Package
+    command: |
+      buildkite-agent artifact download "dist/app.tar.gz" .
+      buildkite-agent artifact download reports/junit.xml . --step test
+      buildkite-agent artifact download "$ARTIFACT" .
+      buildkite-agent artifact download build.log . --build "$OTHER_BUILD"
+  - group: Checks
+    steps:
+      - label: Lint
+        plugins:
+          - artifacts#v1.9.0:
+              download:
+                - coverage/lcov.info
+                - from: docs/site.zip
+                  to: site.zip
+  - label: Test
+    command: make test && buildkite-agent artifact upload "reports/*.xml"
+    plugins:
+      - artifacts#v1.9.0:
+          upload: docs/site.zip`
+
+	diagnostics := artifactFlowDiagnosticsFor(t, server, uri, content)
+
+	expected := []struct {
+		line    uint32
+		char    uint32
+		message string
+		related uint32
+	}{
+		{8, 40, "'reports/junit.xml' is only uploaded by a later step", 21},
+		{18, 24, "'docs/site.zip' is only uploaded by a later step", 24},
+	}
+
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("Expected %d diagnostics, got %+v", len(expected), diagnostics)
+	}
+	for i, want := range expected {
+		got := diagnostics[i]
+		if got.Code != "artifact-never-uploaded" || got.Range.Start.Line != want.line || got.Range.Start.Character != want.char {
+			t.Errorf("Diagnostic %d: expected artifact-never-uploaded at %d:%d, got %v at %d:%d", i, want.line, want.char,
+				got.Code, got.Range.Start.Line, got.Range.Start.Character)
+		}
+		if !strings.Contains(got.Message, want.message) {
+			t.Errorf("Diagnostic %d: expected message containing %q, got %q", i, want.message, got.Message)
+		}
+		if len(got.RelatedInformation) != 1 || got.RelatedInformation[0].Location.Range.Start.Line != want.related ||
+			got.RelatedInformation[0].Location.URI != uri {
+			t.Errorf("Diagnostic %d: expected the upload on line %d as related, got %+v", i, want.related, got.RelatedInformation)
+		}
+	}
+}
+
+func TestServer_ValidateArtifactFlow_NeverUploaded(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+
+	content := `steps:
+  - command: make
+    artifact_paths:
+      - dist/app.tar.gz
+  - wait
+  - command: buildkite-agent artifact download dist/app.zip .`
+
+	diagnostics := artifactFlowDiagnosticsFor(t, server, uri, content)
+	if len(diagnostics) != 1 {
+		t.Fatalf("Expected 1 diagnostic, got %+v", diagnostics)
+	}
+
+	got := diagnostics[0]
+	if !strings.Contains(got.Message, "No earlier step uploads 'dist/app.zip'") {
+		t.Errorf("Expected a message about the missing upload, got %q", got.Message)
+	}
+	if len(got.RelatedInformation) != 1 || !strings.Contains(got.RelatedInformation[0].Message, "'dist/app.tar.gz'") ||
+		got.RelatedInformation[0].Location.Range.Start.Line != 3 {
+		t.Errorf("Expected the closest upload as related, got %+v", got.RelatedInformation)
+	}
+}
+
+func TestArtifactGlobsOverlap(t *testing.T) {
+	tests := []struct {
+		upload   string
+		download string
+		expected bool
+	}{
+		{"dist/**/*", "dist/app/main.js", true},
+		{"dist/*", "dist/app/main.js", false},
+		{"./dist/app.tar.gz", "dist/app.tar.gz", true},
+		{"{dist,build}/*.zip", "build/app.zip", true},
+		{"reports/*.xml", "reports/*", true},
+		{"logs/*.log", "reports/*", false},
+		{"coverage/*", "coverage.xml", false},
+	}
+
+	for _, tt := range tests {
+		if got := artifactGlobsOverlap(tt.upload, tt.download); got != tt.expected {
+			t.Errorf("artifactGlobsOverlap(%q, %q) = %t, expected %t", tt.upload, tt.download, got, tt.expected)
+		}
+	}
+}
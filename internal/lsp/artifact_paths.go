@@ -0,0 +1,233 @@
+package lsp
+
+import (
+	"fmt"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+// artifactPathSeparator separates the globs of an artifact_paths string. The agent splits
+// on it alone, so a comma is part of the glob it's in.
+const artifactPathSeparator = ";"
+
+// splitArtifactPaths breaks an artifact_paths string into its globs, dropping empty ones
+func splitArtifactPaths(value string) []string {
+	var paths []string
+	for _, path := range strings.Split(value, artifactPathSeparator) {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// commaSeparatedPaths splits a glob on the commas outside of braces, which read as an attempt
+// to list several globs. A comma inside braces, as in `{dist,build}/**`, is an alternative.
+func commaSeparatedPaths(path string) []string {
+	var paths []string
+	depth, start := 0, 0
+	for i, c := range path {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				paths = append(paths, strings.TrimSpace(path[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	return append(paths, strings.TrimSpace(path[start:]))
+}
+
+// artifactPaths returns the globs of an artifact_paths value, string or list, in order and
+// without duplicates, or nil if the value isn't one the agent takes. Globs separated by
+// commas are split, as that's what they were meant to be.
+func artifactPaths(value interface{}) []string {
+	var paths []string
+	switch value := value.(type) {
+	case string:
+		paths = splitArtifactPaths(value)
+	case []interface{}:
+		for _, entry := range value {
+			path, ok := entry.(string)
+			if !ok {
+				return nil
+			}
+			paths = append(paths, splitArtifactPaths(path)...)
+		}
+	default:
+		return nil
+	}
+
+	unique := make([]string, 0, len(paths))
+	seen := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		parts := commaSeparatedPaths(path)
+		if parts == nil {
+			parts = []string{path}
+		}
+		for _, part := range parts {
+			if part != "" && !seen[part] {
+				seen[part] = true
+				unique = append(unique, part)
+			}
+		}
+	}
+	return unique
+}
+
+// validateArtifactPaths checks every step's artifact_paths for globs listed twice, commas
+// used to separate globs, and lists whose entries hold several globs
+func (s *Server) validateArtifactPaths(pipeline *parser.Pipeline) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	root := pipeline.YAMLNode
+	if root == nil || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return diagnostics
+	}
+
+	var walkSteps func(steps *yaml.Node)
+	walkSteps = func(steps *yaml.Node) {
+		if steps == nil || steps.Kind != yaml.SequenceNode {
+			return
+		}
+		for _, step := range steps.Content {
+			if step.Kind != yaml.MappingNode {
+				continue
+			}
+			diagnostics = append(diagnostics, artifactPathDiagnostics(mappingValue(step, "artifact_paths"))...)
+			walkSteps(mappingValue(step, "steps"))
+		}
+	}
+	walkSteps(mappingValue(root.Content[0], "steps"))
+
+	return diagnostics
+}
+
+// artifactPathDiagnostics checks a single artifact_paths value
+func artifactPathDiagnostics(value *yaml.Node) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+	if value == nil {
+		return diagnostics
+	}
+
+	entries := []*yaml.Node{value}
+	if value.Kind == yaml.SequenceNode {
+		entries = value.Content
+	}
+
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.Kind != yaml.ScalarNode || entry.Tag != "!!str" {
+			continue
+		}
+
+		paths := splitArtifactPaths(entry.Value)
+		if value.Kind == yaml.SequenceNode && len(paths) > 1 {
+			diagnostics = append(diagnostics, nodeDiagnostic(entry, protocol.DiagnosticSeverityInformation, "mixed-artifact-separators",
+				fmt.Sprintf("This artifact_paths entry holds %d globs separated by %q. The agent accepts it, "+
+					"but a list reads more clearly with one glob per entry", len(paths), artifactPathSeparator)))
+		}
+
+		var duplicates []string
+		for _, path := range paths {
+			if commaSeparatedPaths(path) != nil {
+				diagnostics = append(diagnostics, nodeDiagnostic(entry, protocol.DiagnosticSeverityWarning, "artifact-path-separator",
+					fmt.Sprintf("The agent reads %q as a single glob: commas don't separate artifact paths. "+
+						"Separate globs with %q or list them one per entry", path, artifactPathSeparator)))
+			}
+			if seen[path] {
+				duplicates = append(duplicates, path)
+			}
+			seen[path] = true
+		}
+		if len(duplicates) > 0 {
+			diagnostics = append(diagnostics, nodeDiagnostic(entry, protocol.DiagnosticSeverityWarning, "duplicate-artifact-path",
+				fmt.Sprintf("artifact_paths already includes %s", quotedList(duplicates))))
+		}
+	}
+
+	return diagnostics
+}
+
+// quotedList quotes and joins values for a message
+func quotedList(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, value := range values {
+		quoted = append(quoted, fmt.Sprintf("%q", value))
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// createNormalizeArtifactPathsAction fixes the step's artifact_paths in place, splitting
+// comma-separated globs and dropping duplicates while keeping the form it's written in
+func (s *Server) createNormalizeArtifactPathsAction(uri protocol.DocumentURI, lines []string, diagnostic protocol.Diagnostic) *protocol.CodeAction {
+	stepInfo := s.stepContainingLine(lines, int(diagnostic.Range.Start.Line))
+	if stepInfo == nil {
+		return nil
+	}
+	value := s.findStepValue(lines, stepInfo, "artifact_paths")
+	if value == nil {
+		return nil
+	}
+	paths := artifactPaths(value.Value)
+	if len(paths) == 0 {
+		return nil
+	}
+
+	var normalized interface{} = paths
+	if _, isString := value.Value.(string); isString {
+		normalized = strings.Join(paths, artifactPathSeparator)
+	}
+
+	action := s.replaceStepValueAction(uri, lines, value, "Normalize artifact_paths", "artifact_paths", normalized)
+	if action != nil {
+		action.Kind = protocol.QuickFix
+		action.Diagnostics = []protocol.Diagnostic{diagnostic}
+		action.IsPreferred = true
+	}
+	return action
+}
+
+// getArtifactPathsActions offers to switch the step's artifact_paths between a string and a
+// list, dropping duplicates on the way
+func (s *Server) getArtifactPathsActions(params *protocol.CodeActionParams, doc *Document) []protocol.CodeAction {
+	var actions []protocol.CodeAction
+
+	uri, lines := params.TextDocument.URI, doc.Lines
+	stepInfo := s.stepContainingLine(lines, int(params.Range.Start.Line))
+	if stepInfo == nil {
+		return actions
+	}
+	value := s.findStepValue(lines, stepInfo, "artifact_paths")
+	if value == nil {
+		return actions
+	}
+	paths := artifactPaths(value.Value)
+	if len(paths) == 0 {
+		return actions
+	}
+
+	switch value.Value.(type) {
+	case string:
+		if action := s.replaceStepValueAction(uri, lines, value, "Convert artifact_paths to a list", "artifact_paths", paths); action != nil {
+			actions = append(actions, *action)
+		}
+	case []interface{}:
+		joined := strings.Join(paths, artifactPathSeparator)
+		if action := s.replaceStepValueAction(uri, lines, value, "Join artifact_paths into a string", "artifact_paths", joined); action != nil {
+			actions = append(actions, *action)
+		}
+	}
+	return actions
+}
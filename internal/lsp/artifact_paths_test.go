@@ -0,0 +1,206 @@
+package lsp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+// artifactPathDiagnosticsFor returns the diagnostics raised for artifact_paths
+func artifactPathDiagnosticsFor(server *Server, content string) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+	for _, diagnostic := range server.Diagnose(content) {
+		switch diagnostic.Code {
+		case "artifact-path-separator", "duplicate-artifact-path", "mixed-artifact-separators":
+			diagnostics = append(diagnostics, diagnostic)
+		}
+	}
+	return diagnostics
+}
+
+func TestServer_ValidateArtifactPaths(t *testing.T) {
+	server := newTestServer()
+
+	tests := []struct {
+		name    string
+		content string
+		code    string
+		line    uint32
+		message string
+	}{
+		{
+			name:    "comma separated string",
+			content: "steps:\n  - command: make\n    artifact_paths: \"dist/*, coverage/*\"\n",
+			code:    "artifact-path-separator",
+			line:    2,
+			message: `The agent reads "dist/*, coverage/*" as a single glob`,
+		},
+		{
+			name:    "duplicate in a string",
+			content: "steps:\n  - command: make\n    artifact_paths: \"dist/*;coverage/*;dist/*\"\n",
+			code:    "duplicate-artifact-path",
+			line:    2,
+			message: `artifact_paths already includes "dist/*"`,
+		},
+		{
+			name:    "duplicate in a list",
+			content: "steps:\n  - command: make\n    artifact_paths:\n      - dist/*\n      - dist/*\n",
+			code:    "duplicate-artifact-path",
+			line:    4,
+			message: `artifact_paths already includes "dist/*"`,
+		},
+		{
+			name:    "separators inside a list",
+			content: "steps:\n  - command: make\n    artifact_paths:\n      - \"dist/*;coverage/*\"\n      - logs/*\n",
+			code:    "mixed-artifact-separators",
+			line:    3,
+			message: "holds 2 globs",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diagnostics := artifactPathDiagnosticsFor(server, tt.content)
+			if len(diagnostics) != 1 {
+				t.Fatalf("Expected 1 artifact_paths diagnostic, got %+v", diagnostics)
+			}
+
+			got := diagnostics[0]
+			if got.Code != tt.code {
+				t.Errorf("Expected code %s, got %v", tt.code, got.Code)
+			}
+			if got.Range.Start.Line != tt.line {
+				t.Errorf("Expected line %d, got %d", tt.line, got.Range.Start.Line)
+			}
+			if !strings.Contains(got.Message, tt.message) {
+				t.Errorf("Expected message containing %q, got %q", tt.message, got.Message)
+			}
+		})
+	}
+}
+
+func TestServer_ValidateArtifactPaths_Valid(t *testing.T) {
+	server := newTestServer()
+
+	content := `steps:
+  - command: make
+    artifact_paths: "dist/**/*;coverage/*"
+  - command: make test
+    artifact_paths:
+      - "{dist,build}/**/*"
+      - logs/*.log`
+
+	if diagnostics := artifactPathDiagnosticsFor(server, content); len(diagnostics) != 0 {
+		t.Errorf("Expected no artifact_paths diagnostics, got %+v", diagnostics)
+	}
+}
+
+func TestServer_NormalizeArtifactPathsAction(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{
+			name:     "string keeps its form",
+			content:  "steps:\n  - command: make\n    artifact_paths: \"dist/*, coverage/*;dist/*\"\n  - wait",
+			expected: "steps:\n  - command: make\n    artifact_paths: dist/*;coverage/*\n  - wait",
+		},
+		{
+			name:     "list entries are split and deduplicated",
+			content:  "steps:\n  - command: make\n    artifact_paths:\n      - \"dist/*;coverage/*\"\n      - dist/*\n  - wait",
+			expected: "steps:\n  - command: make\n    artifact_paths:\n      - dist/*\n      - coverage/*\n  - wait",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server.documentManager.OpenDocument(uri, 1, tt.content)
+			diagnostics := artifactPathDiagnosticsFor(server, tt.content)
+			if len(diagnostics) == 0 {
+				t.Fatal("Expected an artifact_paths diagnostic")
+			}
+
+			actions, err := server.CodeAction(context.Background(), &protocol.CodeActionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+				Range:        diagnostics[0].Range,
+				Context:      protocol.CodeActionContext{Diagnostics: diagnostics[:1]},
+			})
+			if err != nil {
+				t.Fatalf("CodeAction failed: %v", err)
+			}
+
+			var normalize *protocol.CodeAction
+			for i := range actions {
+				if actions[i].Title == "Normalize artifact_paths" {
+					normalize = &actions[i]
+				}
+			}
+			if normalize == nil {
+				t.Fatalf("Expected 'Normalize artifact_paths' action, got %+v", actions)
+			}
+
+			if fixed := applyTextEdit(tt.content, normalize.Edit.Changes[uri][0]); fixed != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, fixed)
+			}
+		})
+	}
+}
+
+func TestServer_ArtifactPathsConversion(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+
+	tests := []struct {
+		name     string
+		content  string
+		title    string
+		expected string
+	}{
+		{
+			name:     "string to list",
+			content:  "steps:\n  - label: Build\n    command: make\n    artifact_paths: \"dist/*;coverage/*\"",
+			title:    "Convert artifact_paths to a list",
+			expected: "steps:\n  - label: Build\n    command: make\n    artifact_paths:\n      - dist/*\n      - coverage/*",
+		},
+		{
+			name:     "list to string",
+			content:  "steps:\n  - label: Build\n    command: make\n    artifact_paths:\n      - dist/*\n      - coverage/*",
+			title:    "Join artifact_paths into a string",
+			expected: "steps:\n  - label: Build\n    command: make\n    artifact_paths: dist/*;coverage/*",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server.documentManager.OpenDocument(uri, 1, tt.content)
+
+			actions, err := server.CodeAction(context.Background(), &protocol.CodeActionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+				Range:        protocol.Range{Start: protocol.Position{Line: 3}, End: protocol.Position{Line: 3}},
+			})
+			if err != nil {
+				t.Fatalf("CodeAction failed: %v", err)
+			}
+
+			var conversion *protocol.CodeAction
+			for i := range actions {
+				if actions[i].Title == tt.title {
+					conversion = &actions[i]
+				}
+			}
+			if conversion == nil {
+				t.Fatalf("Expected %q action, got %+v", tt.title, actions)
+			}
+
+			if fixed := applyTextEdit(tt.content, conversion.Edit.Changes[uri][0]); fixed != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, fixed)
+			}
+		})
+	}
+}
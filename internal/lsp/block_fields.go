@@ -0,0 +1,220 @@
+package lsp
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+
+	"github.com/mcncl/buildkite-ls/internal/context"
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+// fieldKeyPattern is the character set the schema allows in a field's meta-data key
+var fieldKeyPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// fieldPropertyPattern matches a field key that is still being typed on its own line
+var fieldPropertyPattern = regexp.MustCompile(`^\s*\w*$`)
+
+// reservedMetaDataPrefix starts the meta-data keys Buildkite and the agent set themselves,
+// such as buildkite:git:commit, which fields mustn't overwrite
+const reservedMetaDataPrefix = "buildkite"
+
+// fieldKeyItems are the keys every block and input step field takes, besides its type
+var fieldKeyItems = []protocol.CompletionItem{
+	{
+		Label:            "key",
+		Kind:             protocol.CompletionItemKindProperty,
+		Detail:           "Meta-data key storing the input",
+		Documentation:    &protocol.MarkupContent{Kind: protocol.Markdown, Value: "The meta-data key the field's value is stored in, read with `buildkite-agent meta-data get`. Letters, numbers, `-` and `_` only, and unique within the step."},
+		InsertText:       "key: \"${1:key}\"",
+		InsertTextFormat: protocol.InsertTextFormatSnippet,
+	},
+	{
+		Label:            "hint",
+		Kind:             protocol.CompletionItemKindProperty,
+		Detail:           "Explanation shown below the field",
+		InsertText:       "hint: \"$1\"",
+		InsertTextFormat: protocol.InsertTextFormatSnippet,
+	},
+	{
+		Label:            "required",
+		Kind:             protocol.CompletionItemKindProperty,
+		Detail:           "Whether the field must be filled in (default true)",
+		InsertText:       "required: ${1|false,true|}",
+		InsertTextFormat: protocol.InsertTextFormatSnippet,
+	},
+	{
+		Label:            "default",
+		Kind:             protocol.CompletionItemKindProperty,
+		Detail:           "Value the field starts with",
+		InsertText:       "default: \"$1\"",
+		InsertTextFormat: protocol.InsertTextFormatSnippet,
+	},
+}
+
+// selectFieldKeyItems are the keys only select fields take
+var selectFieldKeyItems = []protocol.CompletionItem{
+	{
+		Label:            "options",
+		Kind:             protocol.CompletionItemKindProperty,
+		Detail:           "Choices of the select field",
+		Documentation:    &protocol.MarkupContent{Kind: protocol.Markdown, Value: "The choices offered, each with the `label` shown and the `value` stored as meta-data."},
+		InsertText:       "options:\n  - label: \"${1:Label}\"\n    value: \"${2:value}\"",
+		InsertTextFormat: protocol.InsertTextFormatSnippet,
+	},
+	{
+		Label:            "multiple",
+		Kind:             protocol.CompletionItemKindProperty,
+		Detail:           "Whether more than one option can be chosen",
+		InsertText:       "multiple: ${1|true,false|}",
+		InsertTextFormat: protocol.InsertTextFormatSnippet,
+	},
+}
+
+// textFieldKeyItems are the keys only text fields take
+var textFieldKeyItems = []protocol.CompletionItem{
+	{
+		Label:            "format",
+		Kind:             protocol.CompletionItemKindProperty,
+		Detail:           "Regular expression the input must match",
+		InsertText:       "format: \"${1:[0-9]+}\"",
+		InsertTextFormat: protocol.InsertTextFormatSnippet,
+	},
+}
+
+// getBlockFieldCompletions offers the keys of the block or input step field at the cursor,
+// including options and multiple on select fields
+func (cp *CompletionProvider) getBlockFieldCompletions(posCtx *context.PositionContext) ([]protocol.CompletionItem, bool) {
+	beforeCursor := posCtx.CurrentLine
+	if posCtx.CharIndex <= len(beforeCursor) {
+		beforeCursor = beforeCursor[:posCtx.CharIndex]
+	}
+	if !fieldPropertyPattern.MatchString(beforeCursor) {
+		return nil, false
+	}
+
+	lines := posCtx.ContextLines
+	fieldsLine := enclosingKeyLine(lines)
+	if fieldsLine < 0 || yamlKey(lines[fieldsLine]) != "fields" {
+		return nil, false
+	}
+	allLines := splitLines(posCtx.FullContent)
+	if stepType := enclosingStepType(allLines, fieldsLine); stepType != "block" && stepType != "input" {
+		return nil, false
+	}
+
+	// The field is the list item whose keys line up with the cursor
+	indent := indentOf(lines[len(lines)-1])
+	itemLine := -1
+	for i := len(lines) - 2; i > fieldsLine; i-- {
+		if strings.HasPrefix(strings.TrimSpace(lines[i]), "- ") && indentOf(lines[i])+2 == indent {
+			itemLine = i
+			break
+		}
+	}
+	if itemLine < 0 {
+		return nil, false
+	}
+
+	// The field's keys, including those below the cursor
+	existing := map[string]bool{yamlKey(allLines[itemLine]): true}
+	for i := itemLine + 1; i < len(allLines); i++ {
+		trimmed := strings.TrimSpace(allLines[i])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || i == int(posCtx.Position.Line) {
+			continue
+		}
+		if indentOf(allLines[i]) < indent {
+			break
+		}
+		if indentOf(allLines[i]) == indent {
+			existing[yamlKey(allLines[i])] = true
+		}
+	}
+
+	candidates := append([]protocol.CompletionItem(nil), fieldKeyItems...)
+	switch {
+	case existing["select"]:
+		candidates = append(candidates, selectFieldKeyItems...)
+	case existing["text"]:
+		candidates = append(candidates, textFieldKeyItems...)
+	}
+
+	items := []protocol.CompletionItem{}
+	for _, item := range candidates {
+		if !existing[item.Label] {
+			items = append(items, item)
+		}
+	}
+	return items, true
+}
+
+// validateBlockFields checks the field keys of every block and input step: that they use
+// only the characters the schema allows, don't overwrite meta-data Buildkite sets, and
+// are unique within their step
+func (s *Server) validateBlockFields(uri protocol.DocumentURI, pipeline *parser.Pipeline) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	root := pipeline.YAMLNode
+	if root == nil || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return diagnostics
+	}
+
+	var walkSteps func(steps *yaml.Node)
+	walkSteps = func(steps *yaml.Node) {
+		if steps == nil || steps.Kind != yaml.SequenceNode {
+			return
+		}
+		for _, step := range steps.Content {
+			if step.Kind != yaml.MappingNode {
+				continue
+			}
+			if fields := mappingValue(step, "fields"); fields != nil && fields.Kind == yaml.SequenceNode {
+				diagnostics = append(diagnostics, fieldKeyDiagnostics(uri, fields)...)
+			}
+			walkSteps(mappingValue(step, "steps"))
+		}
+	}
+	walkSteps(mappingValue(root.Content[0], "steps"))
+
+	return diagnostics
+}
+
+// fieldKeyDiagnostics checks the keys of a single step's fields
+func fieldKeyDiagnostics(uri protocol.DocumentURI, fields *yaml.Node) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	declared := make(map[string]protocol.Range)
+	for _, field := range fields.Content {
+		key := mappingValue(field, "key")
+		if key == nil || key.Kind != yaml.ScalarNode || key.Value == "" {
+			continue
+		}
+
+		switch {
+		case !fieldKeyPattern.MatchString(key.Value):
+			diagnostics = append(diagnostics, nodeDiagnostic(key, protocol.DiagnosticSeverityError, "invalid-field-key",
+				fmt.Sprintf("Field key '%s' can only contain letters, numbers, '-' and '_'", key.Value)))
+		case strings.HasPrefix(strings.ToLower(key.Value), reservedMetaDataPrefix):
+			diagnostics = append(diagnostics, nodeDiagnostic(key, protocol.DiagnosticSeverityWarning, "reserved-field-key",
+				fmt.Sprintf("Field key '%s' starts with '%s', which is reserved for the meta-data Buildkite sets itself", key.Value, reservedMetaDataPrefix)))
+		}
+
+		first, duplicate := declared[key.Value]
+		if !duplicate {
+			declared[key.Value] = nodeRange(key)
+			continue
+		}
+		diagnostic := nodeDiagnostic(key, protocol.DiagnosticSeverityError, "duplicate-field-key",
+			fmt.Sprintf("Field key '%s' is already used by another field of this step, whose value it would overwrite", key.Value))
+		diagnostic.RelatedInformation = []protocol.DiagnosticRelatedInformation{{
+			Location: protocol.Location{URI: uri, Range: first},
+			Message:  fmt.Sprintf("'%s' first used here", key.Value),
+		}}
+		diagnostics = append(diagnostics, diagnostic)
+	}
+
+	return diagnostics
+}
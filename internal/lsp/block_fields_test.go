@@ -0,0 +1,142 @@
+package lsp
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+func TestCompletionProvider_BlockFieldKeys(t *testing.T) {
+	provider := newTestCompletionProvider()
+
+	tests := []struct {
+		name     string
+		content  string
+		expected []string
+	}{
+		{
+			name: "select field",
+			content: `steps:
+  - block: Release
+    fields:
+      - select: Environment
+        key: environment
+        `,
+			expected: []string{"hint", "required", "default", "options", "multiple"},
+		},
+		{
+			name: "text field",
+			content: `steps:
+  - input: Details
+    fields:
+      - text: Version
+        `,
+			expected: []string{"key", "hint", "required", "default", "format"},
+		},
+		{
+			name: "plugin config fields",
+			content: `steps:
+  - command: make
+    plugins:
+      - example#v1.0.0:
+          fields:
+            - name: a
+              `,
+		},
+		{
+			name: "below the fields",
+			content: `steps:
+  - block: Release
+    fields:
+      - select: Environment
+    `,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, ok := provider.getBlockFieldCompletions(blockStepPositionContext(tt.content))
+			if tt.expected == nil {
+				if ok {
+					t.Errorf("Expected no field completions, got %+v", items)
+				}
+				return
+			}
+
+			var labels []string
+			for _, item := range items {
+				labels = append(labels, item.Label)
+			}
+			if !reflect.DeepEqual(labels, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, labels)
+			}
+		})
+	}
+}
+
+func TestServer_ValidateBlockFields(t *testing.T) {
+	content := `steps:
+  - block: Release
+    fields:
+      - select: Environment
+        key: environment
+        options:
+          - label: Production
+            value: production
+      - text: Notes
+        key: environment
+      - text: Commit
+        key: buildkite-commit
+  - group: Deploys
+    steps:
+      - input: Details
+        fields:
+          - text: Version
+            key: "release version"
+  - input: Other
+    fields:
+      - text: Environment
+        key: environment`
+
+	pipeline, err := parser.ParseYAML([]byte(content))
+	if err != nil {
+		t.Fatalf("Failed to parse YAML: %v", err)
+	}
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	diagnostics := newTestServer().validateBlockFields(uri, pipeline)
+
+	expected := []struct {
+		code string
+		line uint32
+	}{
+		{"duplicate-field-key", 9},
+		{"reserved-field-key", 11},
+		{"invalid-field-key", 17},
+	}
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("Expected %d diagnostics, got %+v", len(expected), diagnostics)
+	}
+	for i, want := range expected {
+		if got := diagnostics[i]; got.Code != want.code || got.Range.Start.Line != want.line {
+			t.Errorf("Expected %s at line %d, got %+v", want.code, want.line, got)
+		}
+	}
+
+	related := diagnostics[0].RelatedInformation
+	if len(related) != 1 || related[0].Location.URI != uri || related[0].Location.Range.Start.Line != 4 {
+		t.Errorf("Expected the first use as related information, got %+v", related)
+	}
+
+	// The schema rejects the invalid key too, without saying which, so it's still pointed out
+	var found bool
+	for _, diagnostic := range newTestServer().Diagnose(content) {
+		found = found || (diagnostic.Code == "invalid-field-key" && strings.Contains(diagnostic.Message, "release version"))
+	}
+	if !found {
+		t.Error("Expected the invalid key to be reported alongside the schema error")
+	}
+}
@@ -0,0 +1,190 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"go.lsp.dev/protocol"
+
+	bkcontext "github.com/mcncl/buildkite-ls/internal/context"
+)
+
+// blockScalarPattern matches a key whose value is a block scalar such as `command: |`,
+// capturing the indentation before the key, any list marker, and the key
+var blockScalarPattern = regexp.MustCompile(`^(\s*)(-\s+)?([\w.-]+):\s*[|>][-+]?[1-9]?[-+]?\s*(#.*)?$`)
+
+// yamlKeyLinePattern matches lines that start a mapping key, rather than script that contains a colon
+var yamlKeyLinePattern = regexp.MustCompile(`^\s*(-\s+)?["']?[\w.-]+["']?:(\s|$)`)
+
+// scriptPrelude is a line commonly opening a multi-line command
+type scriptPrelude struct {
+	Text   string
+	Detail string
+}
+
+// scriptPreludes are offered on the first line of a command block scalar
+var scriptPreludes = []scriptPrelude{
+	{"set -euo pipefail", "Stop on the first failing command, unset variable or failed pipe"},
+	{"set -euxo pipefail", "As set -euo pipefail, also printing each command as it runs"},
+}
+
+// blockScalarHeader returns the key of a line opening a block scalar and the column it
+// starts at, or "" when the line doesn't open one
+func blockScalarHeader(line string) (string, int) {
+	match := blockScalarPattern.FindStringSubmatch(line)
+	if match == nil {
+		return "", 0
+	}
+	return match[3], len(match[1]) + len(match[2])
+}
+
+// OnTypeFormatting indents a new line typed straight after a block scalar header, so
+// the content typed next belongs to the block
+func (s *Server) OnTypeFormatting(ctx context.Context, params *protocol.DocumentOnTypeFormattingParams) ([]protocol.TextEdit, error) {
+	if params.Ch != "\n" || !s.isBuildkiteFile(string(params.TextDocument.URI)) {
+		return nil, nil
+	}
+
+	doc, exists := s.documentManager.GetDocument(params.TextDocument.URI)
+	line := int(params.Position.Line)
+	if !exists || line < 1 || line > len(doc.Lines) {
+		return nil, nil
+	}
+
+	key, column := blockScalarHeader(doc.Lines[line-1])
+	if key == "" {
+		return nil, nil
+	}
+
+	width := 2
+	if params.Options.InsertSpaces && params.Options.TabSize > 0 {
+		width = int(params.Options.TabSize)
+	}
+	indent := strings.Repeat(" ", column+width)
+
+	// A new line at the end of the document isn't in Lines yet
+	current := ""
+	if line < len(doc.Lines) {
+		current = doc.Lines[line]
+	}
+	leading := len(current) - len(strings.TrimLeft(current, " \t"))
+	if current[:leading] == indent {
+		return nil, nil
+	}
+
+	return []protocol.TextEdit{{
+		Range: protocol.Range{
+			Start: protocol.Position{Line: uint32(line), Character: 0},
+			End:   protocol.Position{Line: uint32(line), Character: uint32(leading)},
+		},
+		NewText: indent,
+	}}, nil
+}
+
+// getScriptPreludeCompletions offers shell preludes on the first line of a command block scalar
+func (cp *CompletionProvider) getScriptPreludeCompletions(posCtx *bkcontext.PositionContext) ([]protocol.CompletionItem, bool) {
+	lines := posCtx.ContextLines
+	if len(lines) < 2 {
+		return nil, false
+	}
+
+	beforeCursor := posCtx.CurrentLine
+	if posCtx.CharIndex <= len(beforeCursor) {
+		beforeCursor = beforeCursor[:posCtx.CharIndex]
+	}
+
+	key, column := blockScalarHeader(lines[len(lines)-2])
+	if key != "command" && key != "commands" {
+		return nil, false
+	}
+
+	// Only offer preludes while the first line is blank or partway through one
+	typed := strings.TrimSpace(beforeCursor)
+	if typed != "" {
+		if len(beforeCursor)-len(strings.TrimLeft(beforeCursor, " ")) <= column {
+			return nil, false
+		}
+		if !slices.ContainsFunc(scriptPreludes, func(p scriptPrelude) bool { return strings.HasPrefix(p.Text, typed) }) {
+			return nil, false
+		}
+	}
+
+	items := make([]protocol.CompletionItem, 0, len(scriptPreludes))
+	for i, prelude := range scriptPreludes {
+		items = append(items, protocol.CompletionItem{
+			Label:      prelude.Text,
+			Kind:       protocol.CompletionItemKindSnippet,
+			Detail:     prelude.Detail,
+			InsertText: prelude.Text,
+			SortText:   fmt.Sprintf("%02d", i),
+		})
+	}
+	return items, true
+}
+
+// validateBlockScalarIndentation flags lines that look like they belong to the block scalar
+// above them but are indented less than its content, which ends the block early
+func (s *Server) validateBlockScalarIndentation(lines []string) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	for i := 0; i < len(lines); i++ {
+		key, column := blockScalarHeader(lines[i])
+		if key == "" {
+			continue
+		}
+
+		// The first non-blank line sets the block's indentation
+		contentIndent := -1
+		j := i + 1
+		for ; j < len(lines); j++ {
+			if strings.TrimSpace(lines[j]) == "" {
+				continue
+			}
+			if indent := s.getIndentLevel(lines[j]); indent > column {
+				contentIndent = indent
+			}
+			break
+		}
+		if contentIndent < 0 {
+			continue
+		}
+
+		for j++; j < len(lines); j++ {
+			trimmed := strings.TrimSpace(lines[j])
+			if trimmed == "" {
+				continue
+			}
+
+			indent := s.getIndentLevel(lines[j])
+			if indent >= contentIndent {
+				continue
+			}
+
+			// Lines that look like YAML rather than script end the block as intended
+			looksLikeYAML := strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "#") || yamlKeyLinePattern.MatchString(lines[j])
+			if indent <= column && looksLikeYAML {
+				break
+			}
+
+			diagnostics = append(diagnostics, protocol.Diagnostic{
+				Range: protocol.Range{
+					Start: protocol.Position{Line: uint32(j), Character: uint32(indent)},
+					End:   protocol.Position{Line: uint32(j), Character: uint32(len(lines[j]))},
+				},
+				Severity: protocol.DiagnosticSeverityError,
+				Message: fmt.Sprintf("Line is indented less than the `%s` block scalar on line %d, so it isn't part of it - indent it by %d spaces like the rest of the block",
+					key, i+1, contentIndent),
+				Source: "buildkite-ls",
+				Code:   "dedented-block-scalar",
+			})
+			break
+		}
+
+		i = j - 1
+	}
+
+	return diagnostics
+}
@@ -0,0 +1,136 @@
+package lsp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+func TestServer_OnTypeFormatting(t *testing.T) {
+	server := newTestServer()
+
+	tests := []struct {
+		name     string
+		content  string
+		line     uint32
+		expected string
+		edit     bool
+	}{
+		{
+			name:     "new line after command block scalar",
+			content:  "steps:\n  - label: Test\n    command: |\n    ",
+			line:     3,
+			expected: "      ",
+			edit:     true,
+		},
+		{
+			name:     "new line after list item block scalar",
+			content:  "steps:\n  - command: >-\n",
+			line:     2,
+			expected: "      ",
+			edit:     true,
+		},
+		{
+			name:    "already indented",
+			content: "steps:\n  - command: |\n      ",
+			line:    2,
+		},
+		{
+			name:    "not a block scalar",
+			content: "steps:\n  - command: make\n    ",
+			line:    2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uri := protocol.DocumentURI("file:///workspace/.buildkite/pipeline.yml")
+			server.documentManager.OpenDocument(uri, 1, tt.content)
+
+			edits, err := server.OnTypeFormatting(context.Background(), &protocol.DocumentOnTypeFormattingParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+				Position:     protocol.Position{Line: tt.line},
+				Ch:           "\n",
+				Options:      protocol.FormattingOptions{InsertSpaces: true, TabSize: 2},
+			})
+			if err != nil {
+				t.Fatalf("OnTypeFormatting failed: %v", err)
+			}
+
+			if !tt.edit {
+				if len(edits) != 0 {
+					t.Errorf("Expected no edits, got %+v", edits)
+				}
+				return
+			}
+			if len(edits) != 1 {
+				t.Fatalf("Expected 1 edit, got %+v", edits)
+			}
+			if edits[0].NewText != tt.expected || edits[0].Range.Start.Line != tt.line {
+				t.Errorf("Expected %q on line %d, got %+v", tt.expected, tt.line, edits[0])
+			}
+		})
+	}
+}
+
+func TestCompletionProvider_ScriptPreludes(t *testing.T) {
+	provider := newTestCompletionProvider()
+
+	tests := []struct {
+		name     string
+		content  string
+		expected bool
+	}{
+		{"blank first line", "steps:\n  - command: |\n      ", true},
+		{"partway through a prelude", "steps:\n  - commands: |\n      set -e", true},
+		{"other script", "steps:\n  - command: |\n      make", false},
+		{"other block scalar", "steps:\n  - label: |\n      ", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, ok := provider.getScriptPreludeCompletions(blockStepPositionContext(tt.content))
+			if ok != tt.expected {
+				t.Fatalf("Expected preludes offered to be %v, got %v", tt.expected, ok)
+			}
+			if ok && (len(items) == 0 || items[0].Label != "set -euo pipefail") {
+				t.Errorf("Expected set -euo pipefail first, got %+v", items)
+			}
+		})
+	}
+}
+
+func TestServer_DedentedBlockScalarDiagnostics(t *testing.T) {
+	server := newTestServer()
+
+	content := `steps:
+  - label: Build
+    command: |
+      set -euo pipefail
+    make build
+  - label: Test
+    command: |
+      echo "key: value"
+      make test
+    env:
+      CI: "true"`
+
+	var dedented []protocol.Diagnostic
+	for _, diagnostic := range server.Diagnose(content) {
+		if diagnostic.Code == "dedented-block-scalar" {
+			dedented = append(dedented, diagnostic)
+		}
+	}
+
+	if len(dedented) != 1 {
+		t.Fatalf("Expected 1 dedented block scalar diagnostic, got %+v", dedented)
+	}
+	if dedented[0].Range.Start.Line != 4 || dedented[0].Range.Start.Character != 4 {
+		t.Errorf("Expected diagnostic at 4:4, got %+v", dedented[0].Range)
+	}
+	if !strings.Contains(dedented[0].Message, "`command` block scalar on line 3") {
+		t.Errorf("Unexpected message: %q", dedented[0].Message)
+	}
+}
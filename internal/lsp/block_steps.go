@@ -0,0 +1,269 @@
+package lsp
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"go.lsp.dev/protocol"
+
+	"github.com/mcncl/buildkite-ls/internal/context"
+)
+
+// blockedStates are the build states a block or input step can show while it waits
+var blockedStates = []struct {
+	State       string
+	Description string
+	Effect      string // What the build looks like in the UI while blocked
+}{
+	{"passed", "Build shows as passed while blocked (default)",
+		"The build shows as passed (green) while it waits, and commit statuses report success. Suits optional approvals after a good build, such as a deploy."},
+	{"failed", "Build shows as failed while blocked",
+		"The build shows as failed (red) while it waits, and commit statuses report failure, so a pull request can't be merged until someone unblocks it."},
+	{"running", "Build shows as running while blocked",
+		"The build shows as running (yellow) while it waits, and commit statuses stay pending, so nothing treats the build as finished."},
+}
+
+// blockStepOnlyKeys are the step properties that only block and input steps accept
+var blockStepOnlyKeys = []string{"prompt", "fields", "blocked_state", "allowed_teams"}
+
+// blockBranchesNote explains what filtering a block step by branch does to the steps after it
+const blockBranchesNote = "**On a block or input step**, builds of other branches skip the step, so the steps after it run without waiting for anyone to unblock it."
+
+var (
+	// blockedStateValuePattern matches a `blocked_state:` value that is still being typed
+	blockedStateValuePattern = regexp.MustCompile(`^\s*(-\s+)?blocked_state:\s*["']?[a-z]*$`)
+	// allowedTeamsValuePattern matches an inline `allowed_teams:` value that is still being typed
+	allowedTeamsValuePattern = regexp.MustCompile(`^\s*(-\s+)?allowed_teams:\s*["']?[\w-]*$`)
+	// listItemValuePattern matches a list item whose value is still being typed
+	listItemValuePattern = regexp.MustCompile(`^\s*-\s*["']?[\w-]*$`)
+)
+
+// SetTeams configures the team slugs offered when completing allowed_teams
+func (cp *CompletionProvider) SetTeams(teams []string) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.teams = slices.Clone(teams)
+}
+
+// Teams returns the team slugs offered when completing allowed_teams
+func (cp *CompletionProvider) Teams() []string {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+	return cp.teams
+}
+
+// getBlockStepValueCompletions offers values for the blocked_state and allowed_teams
+// properties of block and input steps
+func (cp *CompletionProvider) getBlockStepValueCompletions(posCtx *context.PositionContext) ([]protocol.CompletionItem, bool) {
+	beforeCursor := posCtx.CurrentLine
+	if posCtx.CharIndex <= len(beforeCursor) {
+		beforeCursor = beforeCursor[:posCtx.CharIndex]
+	}
+
+	switch {
+	case blockedStateValuePattern.MatchString(beforeCursor):
+		return blockedStateCompletions(), true
+	case allowedTeamsValuePattern.MatchString(beforeCursor):
+		return cp.teamCompletions(), true
+	case listItemValuePattern.MatchString(beforeCursor) && listParentKey(posCtx.ContextLines) == "allowed_teams":
+		return cp.teamCompletions(), true
+	}
+
+	return nil, false
+}
+
+// filterStepCompletions drops the step properties that don't apply to the type of step at the
+// cursor: block and input properties everywhere else, branches on group steps, and anything
+// trigger steps don't take on trigger steps
+func filterStepCompletions(items []protocol.CompletionItem, posCtx *context.PositionContext) []protocol.CompletionItem {
+	stepType := enclosingStepType(splitLines(posCtx.FullContent), int(posCtx.Position.Line))
+	blockStep := stepType == "block" || stepType == "input"
+
+	return slices.DeleteFunc(items, func(item protocol.CompletionItem) bool {
+		if !blockStep && slices.Contains(blockStepOnlyKeys, item.Label) {
+			return true
+		}
+		if stepType == "trigger" && !triggerStepKeys[item.Label] {
+			return true
+		}
+		return stepType == "group" && item.Label == "branches"
+	})
+}
+
+// getBlockStepHoverContent documents blocked_state, with the UI effect of each state, and
+// adds what branches means on a block or input step to its docs
+func (s *Server) getBlockStepHoverContent(posCtx *context.PositionContext, currentWord string, contextInfo *context.ContextInfo) string {
+	key := yamlKey(posCtx.CurrentLine)
+	if key != "blocked_state" && (key != "branches" || currentWord != "branches") {
+		return ""
+	}
+
+	lines := splitLines(posCtx.FullContent)
+	stepType := enclosingStepType(lines, int(posCtx.Position.Line))
+	blockStep := stepType == "block" || stepType == "input"
+
+	if key == "branches" {
+		if !blockStep {
+			return ""
+		}
+		return s.getPropertyHoverContent(currentWord, contextInfo) + "\n\n" + blockBranchesNote
+	}
+
+	_, value, _ := strings.Cut(posCtx.CurrentLine, ":")
+	if index := strings.Index(value, " #"); index >= 0 {
+		value = value[:index]
+	}
+	value = strings.Trim(strings.TrimSpace(value), `"'`)
+
+	var content strings.Builder
+	content.WriteString("**blocked_state** - Build state while blocked\n\n")
+	content.WriteString("How the build appears in Buildkite and to commit status checks while it waits on this step:\n\n")
+	content.WriteString("| Value | While blocked |\n|---|---|\n")
+	for _, blocked := range blockedStates {
+		state := fmt.Sprintf("`%s`", blocked.State)
+		if blocked.State == "passed" {
+			state += " (default)"
+		}
+		if blocked.State == value {
+			state = "**" + state + "**"
+		}
+		fmt.Fprintf(&content, "| %s | %s |\n", state, blocked.Effect)
+	}
+	content.WriteString("\nOnce the step is unblocked, the build carries on and its state follows the steps that run.")
+
+	if stepType != "" && !blockStep {
+		content.WriteString("\n\n⚠️ This step isn't a block or input step, so `blocked_state` has no effect here.")
+	}
+	return content.String()
+}
+
+// blockedStateCompletions returns the values allowed for blocked_state
+func blockedStateCompletions() []protocol.CompletionItem {
+	items := make([]protocol.CompletionItem, 0, len(blockedStates))
+	for i, blocked := range blockedStates {
+		items = append(items, protocol.CompletionItem{
+			Label:    blocked.State,
+			Kind:     protocol.CompletionItemKindEnumMember,
+			Detail:   blocked.Description,
+			SortText: fmt.Sprintf("%d", i),
+		})
+	}
+	return items
+}
+
+// teamCompletions returns the configured team slugs
+func (cp *CompletionProvider) teamCompletions() []protocol.CompletionItem {
+	items := []protocol.CompletionItem{}
+	for _, team := range cp.Teams() {
+		items = append(items, protocol.CompletionItem{
+			Label:  team,
+			Kind:   protocol.CompletionItemKindValue,
+			Detail: "Team allowed to unblock this step",
+		})
+	}
+	return items
+}
+
+// listParentKey returns the key that owns the list item on the last line, e.g.
+// "allowed_teams" for the "- " below `allowed_teams:`
+func listParentKey(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+
+	current := lines[len(lines)-1]
+	indent := len(current) - len(strings.TrimLeft(current, " \t"))
+
+	for i := len(lines) - 2; i >= 0; i-- {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		lineIndent := len(lines[i]) - len(strings.TrimLeft(lines[i], " \t"))
+		// Earlier items of the same list
+		if strings.HasPrefix(trimmed, "-") && lineIndent == indent {
+			continue
+		}
+
+		if lineIndent <= indent {
+			return yamlKey(lines[i])
+		}
+		return ""
+	}
+
+	return ""
+}
+
+// validateAllowedTeams warns about allowed_teams entries on block and input steps that
+// aren't in the configured team list. Nothing is checked when no teams are configured.
+func (s *Server) validateAllowedTeams(pipelineData map[string]interface{}, lines []string) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	known := s.Settings().Teams
+	if len(known) == 0 {
+		return diagnostics
+	}
+
+	steps, ok := pipelineData["steps"].([]interface{})
+	if !ok {
+		return diagnostics
+	}
+
+	stepLines := s.findStepLines(lines)
+
+	for stepIndex, stepItem := range steps {
+		stepData, ok := stepItem.(map[string]interface{})
+		if !ok || stepIndex >= len(stepLines) {
+			continue
+		}
+
+		var teams []string
+		switch v := stepData["allowed_teams"].(type) {
+		case string:
+			teams = []string{v}
+		case []interface{}:
+			for _, team := range v {
+				if slug, ok := team.(string); ok {
+					teams = append(teams, slug)
+				}
+			}
+		}
+
+		propertyLine := s.findStepPropertyLine("allowed_teams", lines, stepLines[stepIndex])
+		for _, team := range teams {
+			if slices.Contains(known, team) {
+				continue
+			}
+
+			// List entries sit on the lines below the property
+			lineNum := propertyLine
+			for i := propertyLine; i < len(lines) && i <= propertyLine+len(teams); i++ {
+				if strings.Contains(lines[i], team) {
+					lineNum = i
+					break
+				}
+			}
+
+			start := strings.Index(lines[lineNum], team)
+			if start < 0 {
+				start = 0
+			}
+
+			diagnostics = append(diagnostics, protocol.Diagnostic{
+				Range: protocol.Range{
+					Start: protocol.Position{Line: uint32(lineNum), Character: uint32(start)},
+					End:   protocol.Position{Line: uint32(lineNum), Character: uint32(start + len(team))},
+				},
+				Severity: protocol.DiagnosticSeverityWarning,
+				Message:  fmt.Sprintf("Step %d allows team '%s', which is not one of the configured teams", stepIndex+1, team),
+				Source:   "buildkite-ls",
+				Code:     "unknown-team",
+			})
+		}
+	}
+
+	return diagnostics
+}
@@ -0,0 +1,307 @@
+package lsp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+
+	bkcontext "github.com/mcncl/buildkite-ls/internal/context"
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+func blockStepPositionContext(content string) *bkcontext.PositionContext {
+	lines := strings.Split(content, "\n")
+	currentLine := lines[len(lines)-1]
+
+	return &bkcontext.PositionContext{
+		URI:          protocol.DocumentURI("file:///test.yml"),
+		Position:     protocol.Position{Line: uint32(len(lines) - 1), Character: uint32(len(currentLine))},
+		CurrentLine:  currentLine,
+		CharIndex:    len(currentLine),
+		ContextLines: lines,
+		FullContent:  content,
+	}
+}
+
+func TestCompletionProvider_BlockStepValues(t *testing.T) {
+	provider := newTestCompletionProvider()
+	provider.SetTeams([]string{"release-managers", "platform"})
+
+	tests := []struct {
+		name     string
+		content  string
+		expected []string
+	}{
+		{
+			name:     "blocked_state value",
+			content:  "steps:\n  - block: \"Deploy?\"\n    blocked_state: ",
+			expected: []string{"passed", "failed", "running"},
+		},
+		{
+			name:     "partially typed blocked_state value",
+			content:  "steps:\n  - block: \"Deploy?\"\n    blocked_state: ru",
+			expected: []string{"passed", "failed", "running"},
+		},
+		{
+			name:     "inline allowed_teams value",
+			content:  "steps:\n  - block: \"Deploy?\"\n    allowed_teams: ",
+			expected: []string{"release-managers", "platform"},
+		},
+		{
+			name:     "allowed_teams list item",
+			content:  "steps:\n  - block: \"Deploy?\"\n    allowed_teams:\n      - \"platform\"\n      - ",
+			expected: []string{"release-managers", "platform"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			completions := provider.GetCompletions(blockStepPositionContext(tt.content))
+
+			if len(completions) != len(tt.expected) {
+				t.Fatalf("Expected %d completions, got %d: %+v", len(tt.expected), len(completions), completions)
+			}
+
+			for i, label := range tt.expected {
+				if completions[i].Label != label {
+					t.Errorf("Completion %d: expected %q, got %q", i, label, completions[i].Label)
+				}
+			}
+		})
+	}
+
+	t.Run("other list items", func(t *testing.T) {
+		completions := provider.GetCompletions(blockStepPositionContext("steps:\n  - command: \"make\"\n    depends_on:\n      - "))
+		for _, completion := range completions {
+			if completion.Label == "release-managers" {
+				t.Errorf("Team completions should only be offered under allowed_teams")
+			}
+		}
+	})
+}
+
+func TestServer_ValidateAllowedTeams(t *testing.T) {
+	content := `steps:
+  - block: "Deploy?"
+    allowed_teams:
+      - "release-managers"
+      - "relase-managers"
+  - block: "Rollback?"
+    allowed_teams: "platfrom"`
+
+	pipeline, err := parser.ParseYAML([]byte(content))
+	if err != nil {
+		t.Fatalf("Failed to parse YAML: %v", err)
+	}
+
+	teamDiagnostics := func(server *Server) []protocol.Diagnostic {
+		var diagnostics []protocol.Diagnostic
+		for _, diagnostic := range server.validatePlugins(pipeline) {
+			if diagnostic.Code == "unknown-team" {
+				diagnostics = append(diagnostics, diagnostic)
+			}
+		}
+		return diagnostics
+	}
+
+	server := newTestServer()
+	if diagnostics := teamDiagnostics(server); len(diagnostics) != 0 {
+		t.Errorf("Expected no diagnostics without configured teams, got %+v", diagnostics)
+	}
+
+	settings := DefaultSettings()
+	settings.Teams = []string{"release-managers", "platform"}
+	server.applySettings(settings)
+
+	diagnostics := teamDiagnostics(server)
+	if len(diagnostics) != 2 {
+		t.Fatalf("Expected 2 diagnostics, got %d: %+v", len(diagnostics), diagnostics)
+	}
+
+	expected := []struct {
+		line  uint32
+		start uint32
+		team  string
+	}{
+		{line: 4, start: 9, team: "relase-managers"},
+		{line: 6, start: 20, team: "platfrom"},
+	}
+
+	for i, want := range expected {
+		diagnostic := diagnostics[i]
+		if diagnostic.Severity != protocol.DiagnosticSeverityWarning {
+			t.Errorf("Diagnostic %d: expected warning severity, got %v", i, diagnostic.Severity)
+		}
+		if diagnostic.Range.Start.Line != want.line || diagnostic.Range.Start.Character != want.start {
+			t.Errorf("Diagnostic %d: expected start %d:%d, got %d:%d", i, want.line, want.start,
+				diagnostic.Range.Start.Line, diagnostic.Range.Start.Character)
+		}
+		if !strings.Contains(diagnostic.Message, want.team) {
+			t.Errorf("Diagnostic %d: expected message to mention %q, got %q", i, want.team, diagnostic.Message)
+		}
+	}
+}
+
+func TestServer_InvalidBlockedState(t *testing.T) {
+	server := newTestServer()
+
+	diagnostics := server.Diagnose(`steps:
+  - block: "Deploy?"
+    blocked_state: paused`)
+
+	if len(diagnostics) != 1 {
+		t.Fatalf("Expected 1 diagnostic, got %d: %+v", len(diagnostics), diagnostics)
+	}
+
+	if !strings.Contains(diagnostics[0].Message, "blocked_state") {
+		t.Errorf("Expected blocked_state in the message, got %q", diagnostics[0].Message)
+	}
+}
+
+func TestCompletionProvider_BlockStepProperties(t *testing.T) {
+	provider := newTestCompletionProvider()
+
+	tests := []struct {
+		name     string
+		content  string
+		offered  []string
+		excluded []string
+	}{
+		{
+			name:    "block step",
+			content: "steps:\n  - block: \"Deploy?\"\n    ",
+			offered: []string{"blocked_state", "branches", "prompt", "allowed_teams"},
+		},
+		{
+			name:    "step without a type yet",
+			content: "steps:\n  - key: release\n    ",
+			offered: []string{"branches"},
+			// No type yet, so block properties wait for one
+			excluded: []string{"blocked_state", "prompt"},
+		},
+		{
+			name:     "command step",
+			content:  "steps:\n  - command: make\n    ",
+			offered:  []string{"branches"},
+			excluded: []string{"blocked_state", "prompt", "fields", "allowed_teams"},
+		},
+		{
+			name:     "group step",
+			content:  "steps:\n  - group: Deploys\n    ",
+			excluded: []string{"blocked_state", "branches"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := make(map[string]bool)
+			for _, completion := range provider.GetCompletions(blockStepPositionContext(tt.content)) {
+				labels[completion.Label] = true
+			}
+			for _, label := range tt.offered {
+				if !labels[label] {
+					t.Errorf("Expected %s to be offered", label)
+				}
+			}
+			for _, label := range tt.excluded {
+				if labels[label] {
+					t.Errorf("Expected %s not to be offered", label)
+				}
+			}
+		})
+	}
+
+	// The step's type can come after the cursor
+	posCtx := blockStepPositionContext("steps:\n  - key: release\n    ")
+	posCtx.FullContent += "\n    input: Release details"
+	found := false
+	for _, completion := range provider.GetCompletions(posCtx) {
+		found = found || completion.Label == "blocked_state"
+	}
+	if !found {
+		t.Error("Expected blocked_state to be offered on an input step")
+	}
+}
+
+func TestServer_BlockStepBranchesAndBlockedState(t *testing.T) {
+	server := newTestServer()
+
+	content := `steps:
+  - label: Build
+    command: make
+    branches:
+      - main
+  - block: "Deploy?"
+    branches: "main release/*"
+    blocked_state: running
+  - input: "Release details"
+    branches: [main]
+    blocked_state: failed
+    fields:
+      - text: Version
+        key: version`
+	if diagnostics := server.Diagnose(content); len(diagnostics) != 0 {
+		t.Errorf("Expected no diagnostics, got %+v", diagnostics)
+	}
+}
+
+func TestServer_BlockStepHover(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	server.documentManager.OpenDocument(uri, 1, `steps:
+  - command: make
+    branches: main
+  - block: "Deploy?"
+    branches: "main release/*"
+    blocked_state: failed # keep PRs red`)
+
+	tests := []struct {
+		name       string
+		line, char uint32
+		expected   []string
+		absent     []string
+	}{
+		{
+			name: "blocked_state value",
+			line: 5, char: 21,
+			expected: []string{"**`failed`**", "`passed` (default)", "commit statuses stay pending"},
+		},
+		{
+			name: "branches on a block step",
+			line: 4, char: 6,
+			expected: []string{"**branches** - Branch filtering", "run without waiting for anyone to unblock it"},
+		},
+		{
+			name: "branches on a command step",
+			line: 2, char: 6,
+			expected: []string{"**branches** - Branch filtering"},
+			absent:   []string{"unblock"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hover, err := server.Hover(context.Background(), &protocol.HoverParams{
+				TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+					TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+					Position:     protocol.Position{Line: tt.line, Character: tt.char},
+				},
+			})
+			if err != nil || hover == nil {
+				t.Fatalf("Expected hover content, got %v (%v)", hover, err)
+			}
+			for _, expected := range tt.expected {
+				if !strings.Contains(hover.Contents.Value, expected) {
+					t.Errorf("Expected hover to contain %q, got:\n%s", expected, hover.Contents.Value)
+				}
+			}
+			for _, absent := range tt.absent {
+				if strings.Contains(hover.Contents.Value, absent) {
+					t.Errorf("Expected hover not to contain %q, got:\n%s", absent, hover.Contents.Value)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package lsp
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"go.lsp.dev/protocol"
+)
+
+// ClientFeatures records which optional LSP features the client declared support for
+// during initialization. Responses are downgraded for clients that lack a feature.
+type ClientFeatures struct {
+	Snippets              bool
+	CompletionMarkdown    bool
+	HoverMarkdown         bool
+	SignatureHelpMarkdown bool
+	SemanticTokens        bool
+	FoldingRanges         bool
+	// CreateFiles means the client can apply workspace edits that create files
+	CreateFiles bool
+	// Configuration means the client answers workspace/configuration requests
+	Configuration bool
+	// HierarchicalSymbols means the client takes nested document symbols; others get a flat
+	// list naming each symbol's container
+	HierarchicalSymbols bool
+	// ShowDocument means the client can be asked to show a document with a selection
+	ShowDocument bool
+	// WatchFiles means the client can be asked to report changes to files on disk
+	WatchFiles bool
+}
+
+// DefaultClientFeatures assumes a fully featured client until Initialize says otherwise
+func DefaultClientFeatures() ClientFeatures {
+	return ClientFeatures{
+		Snippets:              true,
+		CompletionMarkdown:    true,
+		HoverMarkdown:         true,
+		SignatureHelpMarkdown: true,
+		SemanticTokens:        true,
+		FoldingRanges:         true,
+		CreateFiles:           true,
+		Configuration:         true,
+		HierarchicalSymbols:   true,
+		ShowDocument:          true,
+		WatchFiles:            true,
+	}
+}
+
+// parseClientFeatures reads the features a client supports from its declared capabilities
+func parseClientFeatures(capabilities protocol.ClientCapabilities) ClientFeatures {
+	var features ClientFeatures
+
+	if workspace := capabilities.Workspace; workspace != nil && workspace.ApplyEdit && workspace.WorkspaceEdit != nil {
+		features.CreateFiles = workspace.WorkspaceEdit.DocumentChanges &&
+			slices.Contains(workspace.WorkspaceEdit.ResourceOperations, string(protocol.CreateResourceOperation))
+	}
+
+	if workspace := capabilities.Workspace; workspace != nil {
+		features.Configuration = workspace.Configuration
+		features.WatchFiles = workspace.DidChangeWatchedFiles != nil && workspace.DidChangeWatchedFiles.DynamicRegistration
+	}
+
+	if window := capabilities.Window; window != nil && window.ShowDocument != nil {
+		features.ShowDocument = window.ShowDocument.Support
+	}
+
+	textDocument := capabilities.TextDocument
+	if textDocument == nil {
+		return features
+	}
+
+	if textDocument.Completion != nil && textDocument.Completion.CompletionItem != nil {
+		item := textDocument.Completion.CompletionItem
+		features.Snippets = item.SnippetSupport
+		features.CompletionMarkdown = slices.Contains(item.DocumentationFormat, protocol.Markdown)
+	}
+
+	if textDocument.Hover != nil {
+		features.HoverMarkdown = slices.Contains(textDocument.Hover.ContentFormat, protocol.Markdown)
+	}
+
+	if textDocument.SignatureHelp != nil && textDocument.SignatureHelp.SignatureInformation != nil {
+		features.SignatureHelpMarkdown = slices.Contains(textDocument.SignatureHelp.SignatureInformation.DocumentationFormat, protocol.Markdown)
+	}
+
+	features.SemanticTokens = textDocument.SemanticTokens != nil
+	features.FoldingRanges = textDocument.FoldingRange != nil
+	features.HierarchicalSymbols = textDocument.DocumentSymbol != nil && textDocument.DocumentSymbol.HierarchicalDocumentSymbolSupport
+
+	return features
+}
+
+// adaptCompletionItems rewrites snippets and markdown documentation for clients that can't render them
+func adaptCompletionItems(items []protocol.CompletionItem, features ClientFeatures) []protocol.CompletionItem {
+	for i := range items {
+		item := &items[i]
+
+		if !features.Snippets && item.InsertTextFormat == protocol.InsertTextFormatSnippet {
+			item.InsertText = snippetToPlainText(item.InsertText)
+			item.InsertTextFormat = protocol.InsertTextFormatPlainText
+		}
+
+		if !features.CompletionMarkdown {
+			if doc, ok := item.Documentation.(*protocol.MarkupContent); ok && doc.Kind == protocol.Markdown {
+				item.Documentation = &protocol.MarkupContent{
+					Kind:  protocol.PlainText,
+					Value: markdownToPlainText(doc.Value),
+				}
+			}
+		}
+	}
+
+	return items
+}
+
+// adaptMarkupContent converts markdown content to plain text when the client can't render markdown
+func adaptMarkupContent(content protocol.MarkupContent, markdown bool) protocol.MarkupContent {
+	if markdown || content.Kind != protocol.Markdown {
+		return content
+	}
+
+	return protocol.MarkupContent{
+		Kind:  protocol.PlainText,
+		Value: markdownToPlainText(content.Value),
+	}
+}
+
+// adaptSignatures converts markdown signature and parameter documentation to plain text
+// when the client can't render markdown
+func adaptSignatures(signatures []protocol.SignatureInformation, markdown bool) []protocol.SignatureInformation {
+	if markdown {
+		return signatures
+	}
+
+	for i := range signatures {
+		if doc, ok := signatures[i].Documentation.(*protocol.MarkupContent); ok {
+			adapted := adaptMarkupContent(*doc, false)
+			signatures[i].Documentation = &adapted
+		}
+		for j := range signatures[i].Parameters {
+			if doc, ok := signatures[i].Parameters[j].Documentation.(*protocol.MarkupContent); ok {
+				adapted := adaptMarkupContent(*doc, false)
+				signatures[i].Parameters[j].Documentation = &adapted
+			}
+		}
+	}
+
+	return signatures
+}
+
+var (
+	// snippetChoicePattern matches ${1|a,b|} choices
+	snippetChoicePattern = regexp.MustCompile(`\$\{\d+\|([^,|}]*)[^}]*\|\}`)
+	// snippetPlaceholderPattern matches innermost ${1:default} placeholders
+	snippetPlaceholderPattern = regexp.MustCompile(`\$\{\d+:([^{}$]*)\}`)
+	// snippetTabstopPattern matches $1 and ${1} tab stops
+	snippetTabstopPattern = regexp.MustCompile(`\$(\d+|\{\d+\})`)
+	// markdownLinkPattern matches [text](url) links
+	markdownLinkPattern = regexp.MustCompile(`\[([^\]]+)\]\(([^)]+)\)`)
+)
+
+// snippetToPlainText expands a snippet to the text it would insert with every
+// placeholder accepted, taking the first option of each choice
+func snippetToPlainText(snippet string) string {
+	text := snippetChoicePattern.ReplaceAllString(snippet, "$1")
+	// Placeholders can nest, so expand until nothing changes
+	for {
+		expanded := snippetPlaceholderPattern.ReplaceAllString(text, "$1")
+		if expanded == text {
+			break
+		}
+		text = expanded
+	}
+	text = snippetTabstopPattern.ReplaceAllString(text, "")
+	return strings.ReplaceAll(text, `\$`, "$")
+}
+
+// markdownToPlainText strips the markdown syntax used in hover and completion documentation
+func markdownToPlainText(markdown string) string {
+	var lines []string
+	for _, line := range strings.Split(markdown, "\n") {
+		// Drop code fences but keep the code inside them
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			line = strings.TrimLeft(line, "# ")
+		}
+		lines = append(lines, line)
+	}
+
+	text := markdownLinkPattern.ReplaceAllString(strings.Join(lines, "\n"), "$1 ($2)")
+	return strings.NewReplacer("**", "", "`", "").Replace(text)
+}
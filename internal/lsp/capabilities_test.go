@@ -0,0 +1,116 @@
+package lsp
+
+import (
+	"context"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+func TestServer_InitializeNegotiatesCapabilities(t *testing.T) {
+	t.Run("full featured client", func(t *testing.T) {
+		server := newTestServer()
+		params := &protocol.InitializeParams{
+			Capabilities: protocol.ClientCapabilities{
+				TextDocument: &protocol.TextDocumentClientCapabilities{
+					Completion: &protocol.CompletionTextDocumentClientCapabilities{
+						CompletionItem: &protocol.CompletionTextDocumentClientCapabilitiesItem{
+							SnippetSupport:      true,
+							DocumentationFormat: []protocol.MarkupKind{protocol.Markdown, protocol.PlainText},
+						},
+					},
+					Hover:          &protocol.HoverTextDocumentClientCapabilities{ContentFormat: []protocol.MarkupKind{protocol.Markdown}},
+					SemanticTokens: &protocol.SemanticTokensClientCapabilities{},
+					FoldingRange:   &protocol.FoldingRangeClientCapabilities{},
+				},
+			},
+		}
+
+		result, err := server.Initialize(context.Background(), params)
+		if err != nil {
+			t.Fatalf("Initialize failed: %v", err)
+		}
+
+		if result.Capabilities.SemanticTokensProvider == nil {
+			t.Error("Expected semantic tokens to be advertised")
+		}
+		if result.Capabilities.FoldingRangeProvider == nil {
+			t.Error("Expected folding ranges to be advertised")
+		}
+
+		features := server.ClientFeatures()
+		if !features.Snippets || !features.CompletionMarkdown || !features.HoverMarkdown {
+			t.Errorf("Expected snippet and markdown support, got %+v", features)
+		}
+	})
+
+	t.Run("minimal client", func(t *testing.T) {
+		server := newTestServer()
+
+		result, err := server.Initialize(context.Background(), &protocol.InitializeParams{})
+		if err != nil {
+			t.Fatalf("Initialize failed: %v", err)
+		}
+
+		if result.Capabilities.SemanticTokensProvider != nil {
+			t.Error("Did not expect semantic tokens to be advertised")
+		}
+		if result.Capabilities.FoldingRangeProvider != nil {
+			t.Error("Did not expect folding ranges to be advertised")
+		}
+
+		if server.ClientFeatures() != (ClientFeatures{}) {
+			t.Errorf("Expected no optional features, got %+v", server.ClientFeatures())
+		}
+	})
+}
+
+func TestAdaptCompletionItems(t *testing.T) {
+	items := []protocol.CompletionItem{
+		{
+			Label:            "notify",
+			InsertText:       "notify:\n  - ${1|slack,email|}: \"$2\"",
+			InsertTextFormat: protocol.InsertTextFormatSnippet,
+			Documentation:    &protocol.MarkupContent{Kind: protocol.Markdown, Value: "Configure **build** `notify` [docs](https://buildkite.com/docs)"},
+		},
+		{
+			Label:            "timeout_in_minutes",
+			InsertText:       "timeout_in_minutes: ${1:${2:60}}$0",
+			InsertTextFormat: protocol.InsertTextFormatSnippet,
+		},
+	}
+
+	adapted := adaptCompletionItems(items, ClientFeatures{})
+
+	if adapted[0].InsertText != "notify:\n  - slack: \"\"" {
+		t.Errorf("Unexpected plain text for choice snippet: %q", adapted[0].InsertText)
+	}
+	if adapted[0].InsertTextFormat != protocol.InsertTextFormatPlainText {
+		t.Errorf("Expected plain text insert format, got %v", adapted[0].InsertTextFormat)
+	}
+
+	doc, ok := adapted[0].Documentation.(*protocol.MarkupContent)
+	if !ok || doc.Kind != protocol.PlainText {
+		t.Fatalf("Expected plain text documentation, got %#v", adapted[0].Documentation)
+	}
+	if doc.Value != "Configure build notify docs (https://buildkite.com/docs)" {
+		t.Errorf("Unexpected plain text documentation: %q", doc.Value)
+	}
+
+	if adapted[1].InsertText != "timeout_in_minutes: 60" {
+		t.Errorf("Unexpected plain text for nested placeholder: %q", adapted[1].InsertText)
+	}
+}
+
+func TestAdaptMarkupContent(t *testing.T) {
+	content := protocol.MarkupContent{Kind: protocol.Markdown, Value: "## Title\n```yaml\nsteps:\n```"}
+
+	if got := adaptMarkupContent(content, true); got != content {
+		t.Errorf("Expected markdown content to be kept, got %+v", got)
+	}
+
+	got := adaptMarkupContent(content, false)
+	if got.Kind != protocol.PlainText || got.Value != "Title\nsteps:" {
+		t.Errorf("Unexpected plain text content: %+v", got)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"testing"
 
 	"go.lsp.dev/protocol"
+
+	"github.com/mcncl/buildkite-ls/internal/parser"
 )
 
 func TestServer_CodeAction(t *testing.T) {
@@ -28,7 +30,7 @@ func TestServer_CodeAction(t *testing.T) {
     `,
 			line:            1,
 			char:            10,
-			expectedActions: 3, // Add label + Convert to commands + Extract step
+			expectedActions: 6, // Add label + Convert to commands + Wrap in group + Duplicate step + Skip step + Extract step
 			shouldContain:   []string{"Add label to step", "Convert to commands array"},
 		},
 		{
@@ -39,8 +41,8 @@ func TestServer_CodeAction(t *testing.T) {
     `,
 			line:            1,
 			char:            10,
-			expectedActions: 3, // Add key + Convert to commands + Extract step
-			shouldContain:   []string{"Add key to step", "Convert to commands array"},
+			expectedActions: 7, // Add key + Convert to commands + Wrap in group + Duplicate step + Skip step + Extract step + Generate keys
+			shouldContain:   []string{"Add key to step", "Convert to commands array", "Generate keys for all steps"},
 		},
 		{
 			name: "step with empty command",
@@ -50,7 +52,7 @@ func TestServer_CodeAction(t *testing.T) {
     `,
 			line:            1,
 			char:            10,
-			expectedActions: 3, // Fix empty command + Add key + Extract step
+			expectedActions: 7, // Fix empty command + Add key + Wrap in group + Duplicate step + Skip step + Extract step + Generate keys
 			shouldContain:   []string{"Fix empty command", "Add key to step"},
 		},
 		{
@@ -60,7 +62,7 @@ func TestServer_CodeAction(t *testing.T) {
     `,
 			line:            1,
 			char:            10,
-			expectedActions: 2, // Add command + Add key
+			expectedActions: 6, // Add command + Add key + Wrap in group + Duplicate step + Skip step + Generate keys
 			shouldContain:   []string{"Add command to step", "Add key to step"},
 		},
 		{
@@ -72,8 +74,8 @@ func TestServer_CodeAction(t *testing.T) {
     `,
 			line:            1,
 			char:            10,
-			expectedActions: 2, // Convert to commands + Extract step (refactors)
-			shouldContain:   []string{"Convert to commands array", "Extract to separate step"},
+			expectedActions: 5, // Convert to commands + Wrap in group + Duplicate step + Skip step + Extract step (refactors)
+			shouldContain:   []string{"Convert to commands array", "Wrap step in a group", "Extract to separate step"},
 		},
 		{
 			name: "step with 'name' instead of 'label'",
@@ -83,7 +85,7 @@ func TestServer_CodeAction(t *testing.T) {
     `,
 			line:            1,
 			char:            10,
-			expectedActions: 4, // Convert name + Add key + Convert to commands + Extract step
+			expectedActions: 8, // Convert name + Add key + Convert to commands + Wrap in group + Duplicate step + Skip step + Extract step + Generate keys
 			shouldContain:   []string{"Convert 'name' to 'label'", "Add key to step"},
 		},
 		{
@@ -363,3 +365,58 @@ func TestServer_CodeActionGeneration(t *testing.T) {
 		}
 	})
 }
+
+func TestServer_RemoveRedundantTimeoutAction(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	content := `timeout_in_minutes: 30
+steps:
+  - label: "Test"
+    key: "test"
+    command: "make test"
+    timeout_in_minutes: 30`
+
+	server.documentManager.OpenDocument(uri, 1, content)
+
+	pipeline, err := parser.ParseYAML([]byte(content))
+	if err != nil {
+		t.Fatalf("Failed to parse YAML: %v", err)
+	}
+	diagnostics := server.validatePlugins(pipeline)
+	if len(diagnostics) != 1 || diagnostics[0].Code != "redundant-timeout" {
+		t.Fatalf("Expected a single redundant-timeout diagnostic, got %+v", diagnostics)
+	}
+
+	if diagnostics[0].Range.Start.Line != 5 || diagnostics[0].Range.Start.Character != 4 {
+		t.Errorf("Expected diagnostic at 5:4, got %d:%d", diagnostics[0].Range.Start.Line, diagnostics[0].Range.Start.Character)
+	}
+
+	actions, err := server.CodeAction(context.Background(), &protocol.CodeActionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Range:        diagnostics[0].Range,
+		Context:      protocol.CodeActionContext{Diagnostics: diagnostics},
+	})
+	if err != nil {
+		t.Fatalf("CodeAction failed: %v", err)
+	}
+
+	var removeAction *protocol.CodeAction
+	for i := range actions {
+		if actions[i].Title == "Remove redundant step timeout" {
+			removeAction = &actions[i]
+		}
+	}
+	if removeAction == nil {
+		t.Fatal("Expected 'Remove redundant step timeout' action")
+	}
+
+	// The timeout is on the last line, so it goes with the newline before it
+	expected := `timeout_in_minutes: 30
+steps:
+  - label: "Test"
+    key: "test"
+    command: "make test"`
+	if fixed := applyTextEdit(content, removeAction.Edit.Changes[uri][0]); fixed != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, fixed)
+	}
+}
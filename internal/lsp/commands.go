@@ -0,0 +1,203 @@
+package lsp
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+)
+
+// stepValue is a key written directly on a step and the lines its value spans
+type stepValue struct {
+	Key       string
+	Line      int
+	EndLine   int
+	Character int
+	// Value is the parsed value, e.g. a string for a single command or a list of commands
+	Value interface{}
+}
+
+// findCommandValue returns the command or commands key written directly on the step
+func (s *Server) findCommandValue(lines []string, stepInfo *StepInfo) *stepValue {
+	return s.findStepValue(lines, stepInfo, "command", "commands")
+}
+
+// findStepValue returns the first of the keys written directly on the step
+func (s *Server) findStepValue(lines []string, stepInfo *StepInfo, keys ...string) *stepValue {
+	propertyIndent := -1
+
+	for i := stepInfo.StartLine; i <= stepInfo.EndLine && i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		// The step's own keys sit where the key after the step's "- " marker starts
+		indent := s.getIndentLevel(line)
+		if i == stepInfo.StartLine {
+			indent += len(trimmed) - len(strings.TrimPrefix(trimmed, "- "))
+		}
+		if propertyIndent < 0 {
+			propertyIndent = indent
+		}
+		if indent != propertyIndent {
+			continue
+		}
+
+		key := yamlKey(line)
+		if !slices.Contains(keys, key) {
+			continue
+		}
+
+		value := &stepValue{Key: key, Line: i, EndLine: i, Character: indent}
+		for j := i + 1; j <= stepInfo.EndLine && j < len(lines); j++ {
+			if strings.TrimSpace(lines[j]) == "" {
+				continue
+			}
+			if s.getIndentLevel(lines[j]) <= indent {
+				break
+			}
+			value.EndLine = j
+		}
+
+		// Parse the key on its own so the value comes out exactly as YAML reads it
+		var block strings.Builder
+		block.WriteString(line[indent:])
+		for j := i + 1; j <= value.EndLine; j++ {
+			block.WriteString("\n")
+			if len(lines[j]) > indent {
+				block.WriteString(lines[j][indent:])
+			}
+		}
+
+		var parsed map[string]interface{}
+		if err := yaml.Unmarshal([]byte(block.String()), &parsed); err != nil {
+			return nil
+		}
+		value.Value = parsed[key]
+		return value
+	}
+
+	return nil
+}
+
+// splitCommand breaks a command into the commands it runs, one per line. The agent runs
+// a commands list as a single script, so blank lines are all that's dropped.
+func splitCommand(command string) []string {
+	var commands []string
+	for _, line := range strings.Split(command, "\n") {
+		if strings.TrimSpace(line) != "" {
+			commands = append(commands, line)
+		}
+	}
+	return commands
+}
+
+// commandStrings returns the entries of a commands list, or nil if any entry isn't a string
+func commandStrings(value interface{}) []string {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil
+	}
+
+	commands := make([]string, 0, len(list))
+	for _, entry := range list {
+		command, ok := entry.(string)
+		if !ok {
+			return nil
+		}
+		commands = append(commands, command)
+	}
+	return commands
+}
+
+// createConvertToCommandsArrayAction rewrites a command string as a commands list with one
+// entry per line of the command
+func (s *Server) createConvertToCommandsArrayAction(uri protocol.DocumentURI, lines []string, stepInfo *StepInfo) *protocol.CodeAction {
+	value := s.findCommandValue(lines, stepInfo)
+	if value == nil {
+		return nil
+	}
+
+	command, ok := value.Value.(string)
+	if !ok {
+		return nil
+	}
+	commands := splitCommand(command)
+	if len(commands) == 0 {
+		return nil
+	}
+
+	return s.replaceStepValueAction(uri, lines, value, "Convert to commands array", "commands", commands)
+}
+
+// createMergeCommandsAction joins a commands list into a single command, as a block scalar
+// when there's more than one entry
+func (s *Server) createMergeCommandsAction(uri protocol.DocumentURI, lines []string, stepInfo *StepInfo) *protocol.CodeAction {
+	value := s.findCommandValue(lines, stepInfo)
+	if value == nil {
+		return nil
+	}
+
+	commands := commandStrings(value.Value)
+	if len(commands) == 0 {
+		return nil
+	}
+
+	command := strings.Join(commands, "\n")
+	if len(commands) > 1 {
+		command += "\n"
+	}
+
+	return s.replaceStepValueAction(uri, lines, value, "Merge commands into single command", "command", command)
+}
+
+// replaceStepValueAction replaces a step's value with a newly encoded key and value
+func (s *Server) replaceStepValueAction(uri protocol.DocumentURI, lines []string, value *stepValue, title, key string, newValue interface{}) *protocol.CodeAction {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(map[string]interface{}{key: newValue}); err != nil {
+		return nil
+	}
+
+	// Replacing just the entry keeps any comment after it
+	if edit, step := stepEditOf(lines, value.Line); edit != nil {
+		if entry := entryOnLine(step, value.Line); entry != nil && entry.key.Value == value.Key {
+			edit.replaceEntry(entry, buf.String())
+			return &protocol.CodeAction{
+				Title: title,
+				Kind:  protocol.RefactorRewrite,
+				Edit: &protocol.WorkspaceEdit{
+					Changes: map[protocol.DocumentURI][]protocol.TextEdit{uri: edit.textEdits()},
+				},
+			}
+		}
+	}
+
+	// Continuation lines keep the indentation of the key they belong to
+	encoded := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	indent := strings.Repeat(" ", value.Character)
+	for i := 1; i < len(encoded); i++ {
+		encoded[i] = indent + encoded[i]
+	}
+
+	return &protocol.CodeAction{
+		Title: title,
+		Kind:  protocol.RefactorRewrite,
+		Edit: &protocol.WorkspaceEdit{
+			Changes: map[protocol.DocumentURI][]protocol.TextEdit{
+				uri: {{
+					Range: protocol.Range{
+						Start: protocol.Position{Line: uint32(value.Line), Character: uint32(value.Character)},
+						End:   protocol.Position{Line: uint32(value.EndLine), Character: uint32(len(lines[value.EndLine]))},
+					},
+					NewText: strings.Join(encoded, "\n"),
+				}},
+			},
+		},
+	}
+}
@@ -0,0 +1,177 @@
+package lsp
+
+import (
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+// applyTextEdit applies a single edit to the document content
+func applyTextEdit(content string, edit protocol.TextEdit) string {
+	lines := splitLines(content)
+	before := strings.Join(lines[:edit.Range.Start.Line], "\n")
+	if edit.Range.Start.Line > 0 {
+		before += "\n"
+	}
+	before += lines[edit.Range.Start.Line][:edit.Range.Start.Character]
+
+	after := lines[edit.Range.End.Line][edit.Range.End.Character:]
+	if int(edit.Range.End.Line)+1 < len(lines) {
+		after += "\n" + strings.Join(lines[edit.Range.End.Line+1:], "\n")
+	}
+
+	return before + edit.NewText + after
+}
+
+func TestServer_CommandConversion(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+
+	tests := []struct {
+		name     string
+		content  string
+		line     uint32
+		title    string
+		expected string
+	}{
+		{
+			name: "single command to array",
+			content: `steps:
+  - label: "Build"
+    command: "make build"
+    key: build`,
+			line:  1,
+			title: "Convert to commands array",
+			expected: `steps:
+  - label: "Build"
+    commands:
+      - make build
+    key: build`,
+		},
+		{
+			name: "block scalar to array",
+			content: `steps:
+  - label: "Test"
+    command: |
+      echo "--- Running tests"
+
+      go test ./... -run 'Test: unit'
+    agents:
+      queue: default`,
+			line:  1,
+			title: "Convert to commands array",
+			expected: `steps:
+  - label: "Test"
+    commands:
+      - echo "--- Running tests"
+      - 'go test ./... -run ''Test: unit'''
+    agents:
+      queue: default`,
+		},
+		{
+			name: "command on the step's first line",
+			content: `steps:
+  - command: make lint
+    label: Lint`,
+			line:  1,
+			title: "Convert to commands array",
+			expected: `steps:
+  - commands:
+      - make lint
+    label: Lint`,
+		},
+		{
+			name: "array to single command",
+			content: `steps:
+  - label: "Test"
+    commands:
+      - echo "--- Running tests"
+      - make test
+    key: test`,
+			line:  1,
+			title: "Merge commands into single command",
+			expected: `steps:
+  - label: "Test"
+    command: |
+      echo "--- Running tests"
+      make test
+    key: test`,
+		},
+		{
+			name: "array with one entry",
+			content: `steps:
+  - label: "Test"
+    commands:
+      - "make test"`,
+			line:  1,
+			title: "Merge commands into single command",
+			expected: `steps:
+  - label: "Test"
+    command: make test`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server.documentManager.OpenDocument(uri, 1, tt.content)
+			doc, _ := server.documentManager.GetDocument(uri)
+			params := &protocol.CodeActionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+				Range: protocol.Range{
+					Start: protocol.Position{Line: tt.line},
+					End:   protocol.Position{Line: tt.line},
+				},
+			}
+
+			var action *protocol.CodeAction
+			for _, candidate := range server.getRefactorActions(params, doc) {
+				if candidate.Title == tt.title {
+					action = &candidate
+				}
+			}
+			if action == nil {
+				t.Fatalf("Expected a %q action", tt.title)
+			}
+
+			edits := action.Edit.Changes[uri]
+			if len(edits) != 1 {
+				t.Fatalf("Expected one edit, got %+v", edits)
+			}
+			if result := applyTextEdit(tt.content, edits[0]); result != tt.expected {
+				t.Errorf("Unexpected result:\nexpected:\n%s\ngot:\n%s", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestServer_CommandConversionRoundTrip(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	content := `steps:
+  - label: "Deploy"
+    commands:
+      - echo "deploying to ${ENVIRONMENT}"
+      - ./deploy.sh --region us-east-1 | tee deploy.log`
+
+	apply := func(content, title string) string {
+		server.documentManager.OpenDocument(uri, 1, content)
+		doc, _ := server.documentManager.GetDocument(uri)
+		params := &protocol.CodeActionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Range:        protocol.Range{Start: protocol.Position{Line: 1}, End: protocol.Position{Line: 1}},
+		}
+		for _, action := range server.getRefactorActions(params, doc) {
+			if action.Title == title {
+				return applyTextEdit(content, action.Edit.Changes[uri][0])
+			}
+		}
+		t.Fatalf("Expected a %q action for:\n%s", title, content)
+		return ""
+	}
+
+	merged := apply(content, "Merge commands into single command")
+	if result := apply(merged, "Convert to commands array"); result != content {
+		t.Errorf("Round trip changed the commands:\nexpected:\n%s\ngot:\n%s", content, result)
+	}
+}
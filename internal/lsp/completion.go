@@ -1,48 +1,146 @@
 package lsp
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 
 	"go.lsp.dev/protocol"
 
-	"github.com/mcncl/buildkite-ls/internal/context"
+	bkcontext "github.com/mcncl/buildkite-ls/internal/context"
 	"github.com/mcncl/buildkite-ls/internal/plugins"
+	"github.com/mcncl/buildkite-ls/internal/schema"
 )
 
 // CompletionProvider handles context-aware completion
 type CompletionProvider struct {
 	pluginRegistry *plugins.Registry
-	analyzer       *context.Analyzer
+	analyzer       *bkcontext.Analyzer
+	schemaLoader   *schema.Loader
 	logger         *log.Logger
+
+	mu             sync.RWMutex
+	teams          []string
+	popularPlugins *plugins.PopularChannel
 }
 
 // NewCompletionProvider creates a new completion provider
 func NewCompletionProvider(pluginRegistry *plugins.Registry, logger *log.Logger) *CompletionProvider {
 	return &CompletionProvider{
 		pluginRegistry: pluginRegistry,
-		analyzer:       context.NewAnalyzer(),
+		analyzer:       bkcontext.NewAnalyzer(),
+		schemaLoader:   schema.NewLoader(),
 		logger:         logger,
+		popularPlugins: plugins.NewPopularChannel("", 0),
 	}
 }
 
+// SetPopularPlugins configures the channel plugin name completions are taken from
+func (cp *CompletionProvider) SetPopularPlugins(channel *plugins.PopularChannel) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.popularPlugins = channel
+}
+
+// PopularPlugins returns the popular plugins offered when completing plugin names
+func (cp *CompletionProvider) PopularPlugins() []plugins.PopularPlugin {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+	return cp.popularPlugins.Plugins()
+}
+
 // GetContextAnalyzer returns the context analyzer for use by other components
-func (cp *CompletionProvider) GetContextAnalyzer() *context.Analyzer {
+func (cp *CompletionProvider) GetContextAnalyzer() *bkcontext.Analyzer {
 	return cp.analyzer
 }
 
 // GetCompletions returns context-aware completions for the given position
-func (cp *CompletionProvider) GetCompletions(posCtx *context.PositionContext) []protocol.CompletionItem {
+func (cp *CompletionProvider) GetCompletions(posCtx *bkcontext.PositionContext) []protocol.CompletionItem {
+	return cp.GetCompletionsContext(context.Background(), posCtx)
+}
+
+// GetCompletionsContext is GetCompletions for a request that can be cancelled. Cancelling ctx
+// abandons fetching the schema of the plugin being configured.
+func (cp *CompletionProvider) GetCompletionsContext(ctx context.Context, posCtx *bkcontext.PositionContext) []protocol.CompletionItem {
 	if posCtx == nil {
 		cp.logger.Printf("GetCompletions called with nil position context")
 		return []protocol.CompletionItem{}
 	}
+	return rankCompletions(cp.getCompletions(ctx, posCtx), posCtx)
+}
+
+// getCompletions returns the completions of the provider matching the position, unordered
+func (cp *CompletionProvider) getCompletions(ctx context.Context, posCtx *bkcontext.PositionContext) []protocol.CompletionItem {
 
 	cp.logger.Printf("GetCompletions - URI: %s, Line: %d, Char: %d",
 		posCtx.URI, posCtx.Position.Line, posCtx.Position.Character)
 	cp.logger.Printf("GetCompletions - Current line: '%s'", posCtx.CurrentLine)
 
+	// Meta-data keys take precedence inside a `buildkite-agent meta-data get` command
+	if items, ok := cp.getMetaDataKeyCompletions(posCtx); ok {
+		cp.logger.Printf("Returning %d meta-data key completions", len(items))
+		return items
+	}
+
+	// Block and input step values such as blocked_state and allowed_teams
+	if items, ok := cp.getBlockStepValueCompletions(posCtx); ok {
+		cp.logger.Printf("Returning %d block step value completions", len(items))
+		return items
+	}
+
+	// Keys of a block or input step field, such as options on select fields
+	if items, ok := cp.getBlockFieldCompletions(posCtx); ok {
+		cp.logger.Printf("Returning %d block field completions", len(items))
+		return items
+	}
+
+	// Entries of a soft_fail list and their exit statuses, ahead of retry's exit statuses
+	if items, ok := cp.getSoftFailCompletions(posCtx); ok {
+		cp.logger.Printf("Returning %d soft_fail completions", len(items))
+		return items
+	}
+
+	// Retry rule values such as exit_status and signal_reason
+	if items, ok := cp.getRetryValueCompletions(posCtx); ok {
+		cp.logger.Printf("Returning %d retry value completions", len(items))
+		return items
+	}
+
+	// Hosted agent queues for an agents `queue:` value
+	if items, ok := cp.getHostedQueueCompletions(posCtx); ok {
+		cp.logger.Printf("Returning %d hosted queue completions", len(items))
+		return items
+	}
+
+	// Conventional agent tag keys under agents
+	if items, ok := cp.getAgentTagCompletions(posCtx); ok {
+		cp.logger.Printf("Returning %d agent tag completions", len(items))
+		return items
+	}
+
+	// Shell preludes opening a multi-line command
+	if items, ok := cp.getScriptPreludeCompletions(posCtx); ok {
+		cp.logger.Printf("Returning %d script prelude completions", len(items))
+		return items
+	}
+
+	// Keys of a notify entry's Slack object
+	if items, ok := cp.getSlackNotifyCompletions(posCtx); ok {
+		cp.logger.Printf("Returning %d slack notification completions", len(items))
+		return items
+	}
+
+	// Services of a notify entry, and the condition after one
+	if items, ok := cp.getNotifyEntryCompletions(posCtx); ok {
+		cp.logger.Printf("Returning %d notify entry completions", len(items))
+		return items
+	}
+
 	// Analyze the context at the cursor position
 	contextInfo := cp.analyzer.AnalyzeContext(posCtx)
 
@@ -51,25 +149,40 @@ func (cp *CompletionProvider) GetCompletions(posCtx *context.PositionContext) []
 
 	// Return completions based on context
 	switch contextInfo.Type {
-	case context.ContextTopLevel:
+	case bkcontext.ContextTopLevel:
+		if items, ok := cp.getListItemCompletions(posCtx, contextInfo); ok {
+			cp.logger.Printf("Returning list item completions for %s", contextInfo.ArrayContext)
+			return items
+		}
 		cp.logger.Printf("Returning top-level completions")
-		return cp.getTopLevelCompletions()
-	case context.ContextStep:
+		return withSchemaProperties(cp.getTopLevelCompletions(), cp.schemaLoader.PipelineProperties())
+	case bkcontext.ContextStep:
+		if items, ok := cp.getListItemCompletions(posCtx, contextInfo); ok {
+			cp.logger.Printf("Returning list item completions for %s", contextInfo.ArrayContext)
+			return items
+		}
 		cp.logger.Printf("Returning step completions")
-		return cp.getStepCompletions()
-	case context.ContextPlugins:
+		return filterStepCompletions(cp.getSchemaStepCompletions(cp.getStepCompletions(), posCtx), posCtx)
+	case bkcontext.ContextTriggerBuild:
+		cp.logger.Printf("Returning trigger build completions")
+		return cp.getTriggerBuildCompletions(posCtx)
+	case bkcontext.ContextRetryManual:
+		cp.logger.Printf("Returning manual retry completions")
+		return cp.getManualRetryCompletions(posCtx)
+	case bkcontext.ContextPlugins:
 		cp.logger.Printf("Returning plugin completions")
 		return cp.getPluginCompletions(posCtx, contextInfo)
-	case context.ContextPluginConfig:
+	case bkcontext.ContextPluginConfig:
 		cp.logger.Printf("Returning plugin config completions for plugin: %s", contextInfo.PluginName)
-		return cp.getPluginConfigCompletions(contextInfo)
+		return cp.getPluginConfigCompletions(ctx, posCtx, contextInfo)
 	default:
 		cp.logger.Printf("Returning default completions")
 		return cp.getDefaultCompletions()
 	}
 }
 
-// getTopLevelCompletions returns completions for top-level pipeline properties
+// getTopLevelCompletions returns completions for top-level pipeline properties. Only
+// the keys in topLevelKeys are offered; pipeline settings don't belong in the YAML.
 func (cp *CompletionProvider) getTopLevelCompletions() []protocol.CompletionItem {
 	return []protocol.CompletionItem{
 		{
@@ -102,63 +215,12 @@ func (cp *CompletionProvider) getTopLevelCompletions() []protocol.CompletionItem
 			Detail:        "Pipeline timeout",
 			Documentation: &protocol.MarkupContent{Kind: protocol.Markdown, Value: "The maximum number of minutes a job created by this step will run"},
 		},
-		{
-			Label:         "cancel_running_branch_builds",
-			Kind:          protocol.CompletionItemKindProperty,
-			Detail:        "Cancel running builds",
-			Documentation: &protocol.MarkupContent{Kind: protocol.Markdown, Value: "Cancel running builds for the same branch when a new build is created"},
-		},
-		{
-			Label:         "skip_intermediate_builds",
-			Kind:          protocol.CompletionItemKindProperty,
-			Detail:        "Skip intermediate builds",
-			Documentation: &protocol.MarkupContent{Kind: protocol.Markdown, Value: "Skip intermediate builds and only run the latest"},
-		},
-		{
-			Label:         "skip",
-			Kind:          protocol.CompletionItemKindProperty,
-			Detail:        "Skip entire pipeline",
-			Documentation: &protocol.MarkupContent{Kind: protocol.Markdown, Value: "Skip this pipeline entirely"},
-		},
 		{
 			Label:            "notify",
 			Kind:             protocol.CompletionItemKindProperty,
 			Detail:           "Build notifications",
-			Documentation:    &protocol.MarkupContent{Kind: protocol.Markdown, Value: "Configure Slack, email, or webhook notifications"},
-			InsertText:       "notify:\n  - ${1|slack,email,webhook|}: \"$2\"",
-			InsertTextFormat: protocol.InsertTextFormatSnippet,
-		},
-		{
-			Label:            "group",
-			Kind:             protocol.CompletionItemKindProperty,
-			Detail:           "Group steps together",
-			Documentation:    &protocol.MarkupContent{Kind: protocol.Markdown, Value: "Group related steps together in the pipeline UI"},
-			InsertText:       "group: \"$1\"",
-			InsertTextFormat: protocol.InsertTextFormatSnippet,
-		},
-		// Advanced pipeline features
-		{
-			Label:            "x-buildkite-repository-provider",
-			Kind:             protocol.CompletionItemKindProperty,
-			Detail:           "Repository provider settings",
-			Documentation:    &protocol.MarkupContent{Kind: protocol.Markdown, Value: "Configure repository provider specific settings"},
-			InsertText:       "x-buildkite-repository-provider:\n  webhook_url: \"${1:https://api.buildkite.com/v2/webhooks/}\"\n  build_branches: ${2|true,false|}",
-			InsertTextFormat: protocol.InsertTextFormatSnippet,
-		},
-		{
-			Label:            "x-buildkite-plugins",
-			Kind:             protocol.CompletionItemKindProperty,
-			Detail:           "Global plugin configuration",
-			Documentation:    &protocol.MarkupContent{Kind: protocol.Markdown, Value: "Define plugins that apply to all steps"},
-			InsertText:       "x-buildkite-plugins:\n  - ${1:plugin-name}#${2:version}:\n      ${3:config}: \"${4:value}\"",
-			InsertTextFormat: protocol.InsertTextFormatSnippet,
-		},
-		{
-			Label:            "repository_provider_settings",
-			Kind:             protocol.CompletionItemKindProperty,
-			Detail:           "Repository provider configuration",
-			Documentation:    &protocol.MarkupContent{Kind: protocol.Markdown, Value: "Settings specific to your repository provider (GitHub, GitLab, etc.)"},
-			InsertText:       "repository_provider_settings:\n  build_pull_requests: ${1|true,false|}\n  build_branches: ${2|true,false|}\n  publish_commit_status: ${3|true,false|}",
+			Documentation:    &protocol.MarkupContent{Kind: protocol.Markdown, Value: "Configure build notifications via Slack, email, webhooks, PagerDuty, GitHub, or Basecamp"},
+			InsertText:       notifySnippet(pipelineNotifyTypes),
 			InsertTextFormat: protocol.InsertTextFormatSnippet,
 		},
 	}
@@ -219,6 +281,14 @@ func (cp *CompletionProvider) getStepCompletions() []protocol.CompletionItem {
 			Detail:        "Step dependencies",
 			Documentation: &protocol.MarkupContent{Kind: protocol.Markdown, Value: "A list of step keys that this step depends on"},
 		},
+		{
+			Label:            "allow_dependency_failure",
+			Kind:             protocol.CompletionItemKindProperty,
+			Detail:           "Run even if dependencies fail",
+			Documentation:    &protocol.MarkupContent{Kind: protocol.Markdown, Value: "Run this step even when a step it depends on fails. Applies to every dependency in `depends_on`; use `allow_failure` on a single `depends_on` entry to allow just that one to fail."},
+			InsertText:       "allow_dependency_failure: ${1|true,false|}",
+			InsertTextFormat: protocol.InsertTextFormatSnippet,
+		},
 		{
 			Label:            "retry",
 			Kind:             protocol.CompletionItemKindProperty,
@@ -305,8 +375,8 @@ func (cp *CompletionProvider) getStepCompletions() []protocol.CompletionItem {
 			Label:            "notify",
 			Kind:             protocol.CompletionItemKindProperty,
 			Detail:           "Step-specific notifications",
-			Documentation:    &protocol.MarkupContent{Kind: protocol.Markdown, Value: "Configure notifications for this specific step"},
-			InsertText:       "notify:\n  - ${1|slack,email,webhook|}: \"$2\"",
+			Documentation:    &protocol.MarkupContent{Kind: protocol.Markdown, Value: "Configure notifications for this specific step. Steps support Slack, GitHub, and Basecamp - email, webhook, and PagerDuty are pipeline-level only"},
+			InsertText:       notifySnippet(stepNotifyTypes),
 			InsertTextFormat: protocol.InsertTextFormatSnippet,
 		},
 		// Special step types
@@ -359,6 +429,22 @@ func (cp *CompletionProvider) getStepCompletions() []protocol.CompletionItem {
 			InsertText:       "fields:\n  - ${1|text,select,boolean|}: \"$2\"",
 			InsertTextFormat: protocol.InsertTextFormatSnippet,
 		},
+		{
+			Label:            "blocked_state",
+			Kind:             protocol.CompletionItemKindProperty,
+			Detail:           "Build state while blocked",
+			Documentation:    &protocol.MarkupContent{Kind: protocol.Markdown, Value: "The state the build shows while waiting on this block or input step"},
+			InsertText:       "blocked_state: ${1|passed,failed,running|}",
+			InsertTextFormat: protocol.InsertTextFormatSnippet,
+		},
+		{
+			Label:            "allowed_teams",
+			Kind:             protocol.CompletionItemKindProperty,
+			Detail:           "Teams allowed to unblock",
+			Documentation:    &protocol.MarkupContent{Kind: protocol.Markdown, Value: "Restrict who can unblock this step to members of the listed teams"},
+			InsertText:       "allowed_teams:\n  - \"$0\"",
+			InsertTextFormat: protocol.InsertTextFormatSnippet,
+		},
 		{
 			Label:         "pipeline",
 			Kind:          protocol.CompletionItemKindProperty,
@@ -430,23 +516,15 @@ func (cp *CompletionProvider) getStepCompletions() []protocol.CompletionItem {
 }
 
 // getPluginCompletions returns completions for plugin names
-func (cp *CompletionProvider) getPluginCompletions(posCtx *context.PositionContext, contextInfo *context.ContextInfo) []protocol.CompletionItem {
+func (cp *CompletionProvider) getPluginCompletions(posCtx *bkcontext.PositionContext, contextInfo *bkcontext.ContextInfo) []protocol.CompletionItem {
 	var items []protocol.CompletionItem
 
 	// Check if we need to suggest adding a list item first
-	if cp.needsListItemSuggestion(posCtx, contextInfo) {
-		items = append(items, protocol.CompletionItem{
-			Label:            "- (add plugin)",
-			Kind:             protocol.CompletionItemKindSnippet,
-			Detail:           "Add a plugin to the list",
-			Documentation:    &protocol.MarkupContent{Kind: protocol.Markdown, Value: "Insert a list item for adding a plugin"},
-			InsertText:       "- ${1:plugin-name}#${2:version}:\n    ${3:config}: \"${4:value}\"",
-			InsertTextFormat: protocol.InsertTextFormatSnippet,
-			SortText:         "00-list-item", // Sort this to the top
-		})
+	if listItems, ok := cp.getListItemCompletions(posCtx, contextInfo); ok {
+		items = append(items, listItems...)
 	}
 
-	for _, plugin := range plugins.GetPopularPlugins() {
+	for _, plugin := range cp.PopularPlugins() {
 		fullName := plugin.Name + "#" + plugin.Version
 
 		// Create smart snippet templates based on plugin type
@@ -490,39 +568,20 @@ func (cp *CompletionProvider) getPluginCompletions(posCtx *context.PositionConte
 	return items
 }
 
-// needsListItemSuggestion checks if we should suggest adding a list item (-)
-func (cp *CompletionProvider) needsListItemSuggestion(posCtx *context.PositionContext, contextInfo *context.ContextInfo) bool {
-	if posCtx == nil || contextInfo == nil {
-		return false
-	}
-
-	// Check if current line doesn't already have a list item
-	currentLine := posCtx.CurrentLine
-	trimmedLine := strings.TrimSpace(currentLine)
-
-	// If the line already has a dash, don't suggest another one
-	if strings.HasPrefix(trimmedLine, "-") {
-		return false
-	}
-
-	// If the line is empty or only has whitespace, and we're in plugins context,
-	// suggest the list item
-	if trimmedLine == "" && contextInfo.Type == context.ContextPlugins {
-		return true
-	}
-
-	return false
-}
-
 // getPluginConfigCompletions returns completions for plugin configuration
-func (cp *CompletionProvider) getPluginConfigCompletions(contextInfo *context.ContextInfo) []protocol.CompletionItem {
+func (cp *CompletionProvider) getPluginConfigCompletions(ctx context.Context, posCtx *bkcontext.PositionContext, contextInfo *bkcontext.ContextInfo) []protocol.CompletionItem {
 	if contextInfo.PluginName == "" {
 		// No plugin name detected, return generic completions
 		return cp.getGenericPluginConfigCompletions()
 	}
 
+	// The docker plugin is the one edited most, so its options have curated docs
+	if isDockerPlugin(cp.pluginRegistry, contextInfo.PluginName) {
+		return cp.getDockerPluginCompletions(ctx, posCtx, contextInfo)
+	}
+
 	// Fetch plugin schema for the specific plugin
-	schema, err := cp.pluginRegistry.GetPluginSchema(contextInfo.PluginName)
+	schema, err := cp.pluginRegistry.GetPluginSchema(ctx, contextInfo.PluginName)
 	if err != nil {
 		// If we can't fetch the schema, return generic completions
 		return cp.getGenericPluginConfigCompletions()
@@ -546,7 +605,9 @@ func (cp *CompletionProvider) getGenericPluginConfigCompletions() []protocol.Com
 	}
 }
 
-// generateCompletionsFromSchema creates completion items from a plugin's JSON schema
+// generateCompletionsFromSchema creates completion items from a plugin's JSON schema. Required
+// keys come first, then a snippet for each oneOf/anyOf alternative needing several keys together,
+// then the optional keys.
 func (cp *CompletionProvider) generateCompletionsFromSchema(schema *plugins.PluginSchema, pluginName string, indentLevel int) []protocol.CompletionItem {
 	var completions []protocol.CompletionItem
 
@@ -555,13 +616,60 @@ func (cp *CompletionProvider) generateCompletionsFromSchema(schema *plugins.Plug
 		return cp.getGenericPluginConfigCompletions()
 	}
 
+	required := make(map[string]bool)
+	for _, name := range schema.RequiredProperties() {
+		required[name] = true
+	}
+
+	// Keys an alternative requires are described by the groups they belong to
+	groups := schema.RequirementGroups()
+	alternativeOf := make(map[string][]string)
+	for _, group := range groups {
+		description := requirementGroupDescription(group)
+		for _, alternative := range group.Alternatives {
+			for _, name := range alternative {
+				if !slices.Contains(alternativeOf[name], description) {
+					alternativeOf[name] = append(alternativeOf[name], description)
+				}
+			}
+		}
+	}
+
 	// Parse the configuration schema to generate completions
-	if properties, ok := schema.Configuration["properties"].(map[string]interface{}); ok {
-		for propName, propDef := range properties {
-			completion := cp.createCompletionFromProperty(propName, propDef, pluginName, indentLevel)
-			if completion != nil {
-				completions = append(completions, *completion)
+	properties, _ := schema.Configuration["properties"].(map[string]interface{})
+	for propName, propDef := range properties {
+		completion := cp.createCompletionFromProperty(propName, propDef, pluginName, indentLevel)
+		if completion == nil {
+			continue
+		}
+
+		// Required keys are listed before optional ones
+		switch {
+		case required[propName]:
+			completion.SortText = requiredPropertySortPrefix + propName
+			completion.Detail = strings.TrimSpace("(required) " + completion.Detail)
+		case len(alternativeOf[propName]) > 0:
+			completion.SortText = requiredPropertySortPrefix + propName
+			completion.Detail = strings.TrimSpace(fmt.Sprintf("(required: %s) %s", strings.Join(alternativeOf[propName], "; "), completion.Detail))
+		default:
+			completion.SortText = "1-" + propName
+		}
+		completions = append(completions, *completion)
+	}
+
+	// Alternatives needing several keys are offered whole, so none of them is forgotten
+	for _, group := range groups {
+		for i, alternative := range group.Alternatives {
+			var keys []string
+			for _, name := range alternative {
+				if !required[name] {
+					keys = append(keys, name)
+				}
+			}
+			if len(keys) < 2 {
+				continue
 			}
+			completions = append(completions, cp.createRequirementGroupCompletion(keys, properties, group, i, pluginName, indentLevel))
 		}
 	}
 
@@ -570,9 +678,65 @@ func (cp *CompletionProvider) generateCompletionsFromSchema(schema *plugins.Plug
 		return cp.getGenericPluginConfigCompletions()
 	}
 
+	slices.SortStableFunc(completions, func(a, b protocol.CompletionItem) int {
+		return strings.Compare(a.SortText, b.SortText)
+	})
 	return completions
 }
 
+// requirementGroupDescription summarises a group's alternatives, e.g. "one of image, run"
+func requirementGroupDescription(group plugins.RequirementGroup) string {
+	alternatives := make([]string, 0, len(group.Alternatives))
+	for _, alternative := range group.Alternatives {
+		alternatives = append(alternatives, strings.Join(alternative, " + "))
+	}
+
+	quantifier := "one of"
+	if group.Keyword == "anyOf" {
+		quantifier = "at least one of"
+	}
+	return quantifier + " " + strings.Join(alternatives, ", ")
+}
+
+// tabstopPattern matches the number of a snippet tabstop or placeholder
+var tabstopPattern = regexp.MustCompile(`\$\{?(\d+)`)
+
+// createRequirementGroupCompletion creates a snippet inserting every key of a oneOf/anyOf alternative
+func (cp *CompletionProvider) createRequirementGroupCompletion(keys []string, properties map[string]interface{}, group plugins.RequirementGroup, index int, pluginName string, indentLevel int) protocol.CompletionItem {
+	// Each key's snippet numbers its tabstops from 1, so they're shifted past the previous key's
+	var snippets []string
+	offset := 0
+	for _, name := range keys {
+		snippet := fmt.Sprintf("%s: \"${1}\"", name)
+		if propDef, ok := properties[name].(map[string]interface{}); ok {
+			snippet = cp.generateInsertTextForProperty(name, propDef, indentLevel)
+		}
+
+		highest := 0
+		snippet = tabstopPattern.ReplaceAllStringFunc(snippet, func(tabstop string) string {
+			prefix := strings.TrimRight(tabstop, "0123456789")
+			n, _ := strconv.Atoi(tabstop[len(prefix):])
+			highest = max(highest, n)
+			return prefix + strconv.Itoa(n+offset)
+		})
+		offset += highest
+		snippets = append(snippets, snippet)
+	}
+
+	return protocol.CompletionItem{
+		Label:  strings.Join(keys, " + "),
+		Kind:   protocol.CompletionItemKindSnippet,
+		Detail: fmt.Sprintf("(required together) alternative %d of %s", index+1, requirementGroupDescription(group)),
+		Documentation: &protocol.MarkupContent{
+			Kind:  protocol.Markdown,
+			Value: fmt.Sprintf("**%s Plugin**\n\nAdds the keys `%s`, which the plugin requires together.", pluginName, strings.Join(keys, "`, `")),
+		},
+		InsertText:       strings.Join(snippets, "\n"),
+		InsertTextFormat: protocol.InsertTextFormatSnippet,
+		SortText:         fmt.Sprintf("05-%02d", index),
+	}
+}
+
 // createCompletionFromProperty creates a completion item from a JSON schema property
 func (cp *CompletionProvider) createCompletionFromProperty(propName string, propDef interface{}, pluginName string, indentLevel int) *protocol.CompletionItem {
 	propMap, ok := propDef.(map[string]interface{})
@@ -659,3 +823,8 @@ func (cp *CompletionProvider) getDefaultCompletions() []protocol.CompletionItem
 	items = append(items, cp.getStepCompletions()...)
 	return items
 }
+
+// notifySnippet builds a notify snippet offering only the services valid at that level
+func notifySnippet(notifyTypes []string) string {
+	return fmt.Sprintf("notify:\n  - ${1|%s|}: \"$2\"", strings.Join(notifyTypes, ","))
+}
@@ -0,0 +1,90 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"go.lsp.dev/protocol"
+)
+
+// Values of the completionDocumentation setting
+const (
+	// CompletionDocumentationInline sends each item's documentation with the completion list
+	CompletionDocumentationInline = "inline"
+	// CompletionDocumentationLazy leaves documentation out of the completion list; clients
+	// fetch it through completionItem/resolve for the item they select
+	CompletionDocumentationLazy = "lazy"
+)
+
+// completionItemData is stored in the data field of items whose documentation was held back
+type completionItemData struct {
+	DocumentationID string `json:"documentationId"`
+}
+
+// completionDocCache holds the documentation held back from the latest completion list
+type completionDocCache struct {
+	mu         sync.Mutex
+	generation int
+	docs       map[string]interface{}
+}
+
+func newCompletionDocCache() *completionDocCache {
+	return &completionDocCache{docs: make(map[string]interface{})}
+}
+
+// deferDocumentation strips the documentation from the items, remembering it for resolving.
+// Only the latest list can be resolved, so earlier documentation is dropped.
+func (c *completionDocCache) deferDocumentation(items []protocol.CompletionItem) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.docs = make(map[string]interface{}, len(items))
+
+	for i := range items {
+		if items[i].Documentation == nil {
+			continue
+		}
+
+		id := fmt.Sprintf("%d:%d", c.generation, i)
+		c.docs[id] = items[i].Documentation
+		items[i].Documentation = nil
+		items[i].Data = completionItemData{DocumentationID: id}
+	}
+}
+
+func (c *completionDocCache) get(id string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	doc, ok := c.docs[id]
+	return doc, ok
+}
+
+// ResolveCompletionItem fills in the documentation held back from a completion item
+func (s *Server) ResolveCompletionItem(ctx context.Context, item *protocol.CompletionItem) (*protocol.CompletionItem, error) {
+	if item.Data == nil {
+		return item, nil
+	}
+
+	// Data round-trips through the client as plain JSON
+	raw, err := json.Marshal(item.Data)
+	if err != nil {
+		return item, nil
+	}
+	var data completionItemData
+	if err := json.Unmarshal(raw, &data); err != nil || data.DocumentationID == "" {
+		return item, nil
+	}
+
+	doc, ok := s.completionDocs.get(data.DocumentationID)
+	if !ok {
+		return item, nil
+	}
+
+	resolved := *item
+	resolved.Documentation = doc
+	adapted := adaptCompletionItems([]protocol.CompletionItem{resolved}, s.ClientFeatures())
+	return &adapted[0], nil
+}
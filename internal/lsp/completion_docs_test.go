@@ -0,0 +1,90 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+func TestServer_LazyCompletionDocumentation(t *testing.T) {
+	server := newTestServer()
+	ctx := context.Background()
+
+	uri := protocol.DocumentURI("file:///.buildkite/pipeline.yml")
+	server.documentManager.OpenDocument(uri, 1, "steps:\n  - ")
+	params := &protocol.CompletionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 1, Character: 4},
+		},
+	}
+
+	inline, err := server.Completion(ctx, params)
+	if err != nil {
+		t.Fatalf("Completion failed: %v", err)
+	}
+	documented := 0
+	for _, item := range inline.Items {
+		if item.Documentation != nil {
+			documented++
+		}
+	}
+	if documented == 0 {
+		t.Fatal("Expected inline documentation by default")
+	}
+
+	settings := DefaultSettings()
+	settings.CompletionDocumentation = CompletionDocumentationLazy
+	server.applySettings(settings)
+
+	lazy, err := server.Completion(ctx, params)
+	if err != nil {
+		t.Fatalf("Completion failed: %v", err)
+	}
+
+	var deferred *protocol.CompletionItem
+	for i, item := range lazy.Items {
+		if item.Documentation != nil {
+			t.Errorf("Expected %s to be sent without documentation", item.Label)
+		}
+		if item.Data != nil && deferred == nil {
+			deferred = &lazy.Items[i]
+		}
+	}
+	if deferred == nil {
+		t.Fatal("Expected items to carry data for resolving their documentation")
+	}
+
+	// The item comes back from the client as plain JSON
+	data, err := json.Marshal(deferred)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var roundTripped protocol.CompletionItem
+	if err := json.Unmarshal(data, &roundTripped); err != nil {
+		t.Fatal(err)
+	}
+
+	resolved, err := server.ResolveCompletionItem(ctx, &roundTripped)
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if resolved.Documentation == nil {
+		t.Errorf("Expected %s to resolve its documentation", resolved.Label)
+	}
+
+	// A newer completion list replaces the documentation that can be resolved
+	if _, err := server.Completion(ctx, params); err != nil {
+		t.Fatal(err)
+	}
+	if stale, _ := server.ResolveCompletionItem(ctx, &roundTripped); stale.Documentation != nil {
+		t.Error("Expected items from an earlier list to resolve without documentation")
+	}
+
+	plain := &protocol.CompletionItem{Label: "steps"}
+	if result, _ := server.ResolveCompletionItem(ctx, plain); result != plain {
+		t.Error("Expected items without data to be returned unchanged")
+	}
+}
@@ -0,0 +1,93 @@
+package lsp
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.lsp.dev/protocol"
+
+	bkcontext "github.com/mcncl/buildkite-ls/internal/context"
+)
+
+// propertyCommitCharacters accept a property completion when the colon after it is typed
+var propertyCommitCharacters = []string{":"}
+
+// requiredPropertySortPrefix marks the required keys of a plugin's configuration, which sort
+// first
+const requiredPropertySortPrefix = "0-"
+
+// rankCompletions puts completions in a fixed order, so the list doesn't shuffle between
+// keystrokes. Every item gets a SortText, and items the provider gave none keep the order
+// it listed them in. The item most likely wanted at the position is preselected, and
+// property items take the colon typed after them as accepting the item.
+func rankCompletions(items []protocol.CompletionItem, posCtx *bkcontext.PositionContext) []protocol.CompletionItem {
+	// Providers can return their package-level items, which mustn't be reordered
+	items = slices.Clone(items)
+	for i := range items {
+		item := &items[i]
+		if item.SortText == "" {
+			item.SortText = fmt.Sprintf("%04d", i)
+		}
+		if item.Kind == protocol.CompletionItemKindProperty && item.CommitCharacters == nil && !strings.Contains(completionInsertText(*item), ":") {
+			item.CommitCharacters = propertyCommitCharacters
+		}
+	}
+	slices.SortStableFunc(items, func(a, b protocol.CompletionItem) int {
+		return cmp.Or(strings.Compare(a.SortText, b.SortText), strings.Compare(a.Label, b.Label))
+	})
+
+	if index := preselectedCompletion(items, posCtx); index >= 0 {
+		items[index].Preselect = true
+	}
+	return items
+}
+
+// preselectedCompletion returns the index of the item most likely wanted, or -1 when none
+// stands out: command on a step with no type yet, steps in a pipeline without them, or the
+// first required key of a plugin's configuration
+func preselectedCompletion(items []protocol.CompletionItem, posCtx *bkcontext.PositionContext) int {
+	if slices.ContainsFunc(items, func(item protocol.CompletionItem) bool { return item.Preselect }) {
+		return -1
+	}
+	for i, item := range items {
+		if item.Kind != protocol.CompletionItemKindProperty {
+			continue
+		}
+		switch {
+		case item.Label == "command":
+			if enclosingStepType(splitLines(posCtx.FullContent), int(posCtx.Position.Line)) == "" {
+				return i
+			}
+		case item.Label == "steps":
+			if !hasTopLevelKey(splitLines(posCtx.FullContent), "steps") {
+				return i
+			}
+		case strings.HasPrefix(item.SortText, requiredPropertySortPrefix):
+			return i
+		}
+	}
+	return -1
+}
+
+// completionInsertText returns the text a completion inserts
+func completionInsertText(item protocol.CompletionItem) string {
+	switch {
+	case item.TextEdit != nil:
+		return item.TextEdit.NewText
+	case item.InsertText != "":
+		return item.InsertText
+	}
+	return item.Label
+}
+
+// hasTopLevelKey reports whether an unindented line sets the key
+func hasTopLevelKey(lines []string, key string) bool {
+	for _, line := range lines {
+		if indentOf(line) == 0 && yamlKey(line) == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package lsp
+
+import (
+	"slices"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+// preselectedLabels returns the labels of the preselected completions
+func preselectedLabels(items []protocol.CompletionItem) []string {
+	var labels []string
+	for _, item := range items {
+		if item.Preselect {
+			labels = append(labels, item.Label)
+		}
+	}
+	return labels
+}
+
+func TestCompletionProvider_RankedCompletions(t *testing.T) {
+	provider := newTestCompletionProvider()
+	posCtx := blockStepPositionContext("steps:\n  - label: Build\n    ")
+
+	first := provider.GetCompletions(posCtx)
+	for range 5 {
+		again := provider.GetCompletions(posCtx)
+		if !slices.EqualFunc(first, again, func(a, b protocol.CompletionItem) bool { return a.Label == b.Label && a.SortText == b.SortText }) {
+			t.Fatal("Expected the same completions in the same order every time")
+		}
+	}
+
+	for i, item := range first {
+		if item.SortText == "" {
+			t.Errorf("Expected %s to have a SortText", item.Label)
+		}
+		if i > 0 && first[i-1].SortText > item.SortText {
+			t.Errorf("Expected %s before %s", item.Label, first[i-1].Label)
+		}
+
+		switch item.Label {
+		case "label":
+			if !slices.Equal(item.CommitCharacters, []string{":"}) {
+				t.Errorf("Expected label to be accepted with a colon, got %v", item.CommitCharacters)
+			}
+		case "agents":
+			// Its snippet writes the colon itself
+			if item.CommitCharacters != nil {
+				t.Errorf("Expected no commit characters for agents, got %v", item.CommitCharacters)
+			}
+		}
+	}
+
+	if labels := preselectedLabels(first); !slices.Equal(labels, []string{"command"}) {
+		t.Errorf("Expected command preselected on a step with no type, got %v", labels)
+	}
+}
+
+func TestCompletionProvider_Preselect(t *testing.T) {
+	provider := newTestCompletionProvider()
+
+	tests := []struct {
+		name     string
+		content  string
+		expected []string
+	}{
+		{
+			name:     "new step",
+			content:  "steps:\n  - command: make\n  - label: Test\n    ",
+			expected: []string{"command"},
+		},
+		{
+			name:    "step with a type",
+			content: "steps:\n  - command: make\n    ",
+		},
+		{
+			name:     "pipeline without steps",
+			content:  "env:\n  A: b\n",
+			expected: []string{"steps"},
+		},
+		{
+			name:    "pipeline with steps",
+			content: "steps:\n  - command: make\n",
+		},
+		{
+			name:     "plugin configuration",
+			content:  "steps:\n  - command: make\n    plugins:\n      - my-org/deploy#v1.0.0:\n          ",
+			expected: []string{"environment"},
+		},
+	}
+
+	provider.pluginRegistry.CacheSchema("my-org/deploy#v1.0.0", deployPluginSchema)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if labels := preselectedLabels(provider.GetCompletions(blockStepPositionContext(tt.content))); !slices.Equal(labels, tt.expected) {
+				t.Errorf("Expected %v preselected, got %v", tt.expected, labels)
+			}
+		})
+	}
+}
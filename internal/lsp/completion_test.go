@@ -3,8 +3,10 @@ package lsp
 import (
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"go.lsp.dev/protocol"
 
@@ -313,6 +315,158 @@ func TestCompletionProvider_TopLevelSnippets(t *testing.T) {
 	}
 }
 
+func TestCompletionProvider_NotifySnippets(t *testing.T) {
+	provider := newTestCompletionProvider()
+
+	findNotify := func(completions []protocol.CompletionItem) protocol.CompletionItem {
+		for _, completion := range completions {
+			if completion.Label == "notify" {
+				return completion
+			}
+		}
+		t.Fatal("'notify' completion not found")
+		return protocol.CompletionItem{}
+	}
+
+	pipelineNotify := findNotify(provider.getTopLevelCompletions())
+	for _, notifyType := range []string{"email", "webhook", "pagerduty_change_event"} {
+		if !strings.Contains(pipelineNotify.InsertText, notifyType) {
+			t.Errorf("Pipeline notify snippet should offer %s, got: %q", notifyType, pipelineNotify.InsertText)
+		}
+	}
+
+	stepNotify := findNotify(provider.getStepCompletions())
+	expectedStepSnippet := "notify:\n  - ${1|slack,github_commit_status,github_check,basecamp_campfire|}: \"$2\""
+	if stepNotify.InsertText != expectedStepSnippet {
+		t.Errorf("Step notify snippet:\nexpected: %q\ngot:      %q", expectedStepSnippet, stepNotify.InsertText)
+	}
+}
+
+func TestCompletionProvider_ListItems(t *testing.T) {
+	provider := newTestCompletionProvider()
+
+	tests := []struct {
+		name          string
+		lines         []string
+		expectedLabel string
+		expectedText  string
+	}{
+		{
+			name:          "commands",
+			lines:         []string{"steps:", "  - label: \"Build\"", "    commands:", "      - \"make\"", "      "},
+			expectedLabel: "- (add command)",
+			expectedText:  "- \"${1:command}\"",
+		},
+		{
+			name:          "depends_on",
+			lines:         []string{"steps:", "  - command: \"make\"", "    depends_on:", "      "},
+			expectedLabel: "- (add dependency)",
+			expectedText:  "- \"${1:step-key}\"",
+		},
+		{
+			name:          "steps",
+			lines:         []string{"env:", "  CI: \"true\"", "steps:", "  - command: \"make\"", "  "},
+			expectedLabel: "- (add step)",
+			expectedText:  "- label: \"${1:label}\"\n  command: \"${2:command}\"",
+		},
+		{
+			name:          "steps of a group",
+			lines:         []string{"steps:", "  - group: \"Tests\"", "    steps:", "      - command: \"make test\"", "      "},
+			expectedLabel: "- (add step)",
+			expectedText:  "- label: \"${1:label}\"\n  command: \"${2:command}\"",
+		},
+		{
+			name:          "artifact_paths",
+			lines:         []string{"steps:", "  - command: \"make\"", "    artifact_paths:", "      "},
+			expectedLabel: "- (add artifact path)",
+			expectedText:  "- \"${1:build/**/*}\"",
+		},
+		{
+			name:          "fields of an input step",
+			lines:         []string{"steps:", "  - input: \"Release\"", "    fields:", "      - text: \"Version\"", "        key: \"version\"", "      "},
+			expectedLabel: "- (add field)",
+			expectedText:  "- text: \"${1:label}\"\n  key: \"${2:meta-data-key}\"",
+		},
+		{
+			name:          "pipeline notify",
+			lines:         []string{"notify:", "  "},
+			expectedLabel: "- (add notification)",
+			expectedText:  "- slack: \"${1:#channel}\"",
+		},
+		{
+			name:          "step notify",
+			lines:         []string{"steps:", "  - command: \"make\"", "    notify:", "      "},
+			expectedLabel: "- (add notification)",
+			expectedText:  "- slack: \"${1:#channel}\"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			currentLine := tt.lines[len(tt.lines)-1]
+			completions := provider.GetCompletions(&context.PositionContext{
+				URI:          protocol.DocumentURI("file:///test.yml"),
+				Position:     protocol.Position{Line: uint32(len(tt.lines) - 1), Character: uint32(len(currentLine))},
+				CurrentLine:  currentLine,
+				CharIndex:    len(currentLine),
+				ContextLines: tt.lines,
+				FullContent:  strings.Join(tt.lines, "\n"),
+			})
+
+			if len(completions) != 1 {
+				t.Fatalf("Expected 1 list item completion, got %d", len(completions))
+			}
+
+			item := completions[0]
+			if item.Label != tt.expectedLabel {
+				t.Errorf("Expected label %q, got %q", tt.expectedLabel, item.Label)
+			}
+			if item.InsertText != tt.expectedText {
+				t.Errorf("Expected insert text %q, got %q", tt.expectedText, item.InsertText)
+			}
+			if item.SortText != "00-list-item" {
+				t.Errorf("Expected list item to sort first, got sort text %q", item.SortText)
+			}
+		})
+	}
+
+	t.Run("fields of a command step", func(t *testing.T) {
+		lines := []string{"steps:", "  - command: \"make\"", "    fields:", "      "}
+		completions := provider.GetCompletions(&context.PositionContext{
+			URI:          protocol.DocumentURI("file:///test.yml"),
+			Position:     protocol.Position{Line: 3, Character: 6},
+			CurrentLine:  lines[3],
+			CharIndex:    6,
+			ContextLines: lines,
+			FullContent:  strings.Join(lines, "\n"),
+		})
+
+		for _, completion := range completions {
+			if completion.SortText == "00-list-item" {
+				t.Errorf("Should not suggest a field on a command step, got %q", completion.Label)
+			}
+		}
+	})
+
+	t.Run("line with a dash already", func(t *testing.T) {
+		lines := []string{"steps:", "  - label: \"Build\"", "    commands:", "      - "}
+		completions := provider.GetCompletions(&context.PositionContext{
+			URI:          protocol.DocumentURI("file:///test.yml"),
+			Position:     protocol.Position{Line: 3, Character: 8},
+			CurrentLine:  lines[3],
+			CharIndex:    8,
+			ContextLines: lines,
+			FullContent:  strings.Join(lines, "\n"),
+		})
+
+		for _, completion := range completions {
+			if completion.SortText == "00-list-item" {
+				t.Errorf("Should not suggest another list item after an existing dash")
+			}
+		}
+	})
+}
+
 func TestCompletionProvider_Integration_ContextDetection(t *testing.T) {
 	// Simplified integration test focusing on working cases
 	provider := newTestCompletionProvider()
@@ -558,3 +712,45 @@ func TestCompletionProvider_EdgeCases(t *testing.T) {
 		}
 	})
 }
+
+func TestCompletionProvider_PopularPluginsChannel(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "popular-plugins.json")
+	manifest := `{"updatedAt": "2030-01-01", "plugins": [{"name": "docker", "version": "v9.0.0", "description": "Run steps in Docker"}]}`
+	if err := os.WriteFile(cachePath, []byte(manifest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	channel := plugins.NewPopularChannel(cachePath, time.Hour)
+	if err := channel.Refresh(); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+
+	provider := newTestCompletionProvider()
+	provider.SetPopularPlugins(channel)
+
+	posCtx := &context.PositionContext{
+		URI:          protocol.DocumentURI("file:///test.yml"),
+		Position:     protocol.Position{Line: 4, Character: 8},
+		CurrentLine:  "      - ",
+		CharIndex:    8,
+		ContextLines: []string{"steps:", "  - label: \"test\"", "    command: \"echo\"", "    plugins:", "      - "},
+		FullContent:  "steps:\n  - label: \"test\"\n    command: \"echo\"\n    plugins:\n      - ",
+	}
+
+	labels := make(map[string]bool)
+	for _, completion := range provider.GetCompletions(posCtx) {
+		labels[completion.Label] = true
+	}
+	if !labels["docker#v9.0.0"] || len(labels) != 1 {
+		t.Errorf("Expected completions from the cached manifest, got %v", labels)
+	}
+
+	// Pinning goes back to the versions bundled with the server
+	channel.SetPinned(true)
+	labels = make(map[string]bool)
+	for _, completion := range provider.GetCompletions(posCtx) {
+		labels[completion.Label] = true
+	}
+	if labels["docker#v9.0.0"] {
+		t.Error("Expected a pinned channel to complete the bundled versions")
+	}
+}
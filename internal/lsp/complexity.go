@@ -0,0 +1,257 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+// PipelineOverviewMethod is the custom request summarising a pipeline document's steps and
+// complexity metrics
+const PipelineOverviewMethod = "buildkite/pipelineOverview"
+
+// PipelineOverviewParams are the parameters of a buildkite/pipelineOverview request
+type PipelineOverviewParams struct {
+	TextDocument protocol.TextDocumentIdentifier `json:"textDocument"`
+}
+
+// ComplexityThresholds are the limits past which a pipeline is reported as complex.
+// Zero disables a threshold.
+type ComplexityThresholds struct {
+	Steps          int `json:"steps"`
+	NestingDepth   int `json:"nestingDepth"`
+	YAMLSizeBytes  int `json:"yamlSizeBytes"`
+	PluginsPerStep int `json:"pluginsPerStep"`
+}
+
+// PipelineMetrics measures how large and deeply structured a pipeline is
+type PipelineMetrics struct {
+	// Steps counts every step, including the steps inside groups
+	Steps int `json:"steps"`
+	// NestingDepth is the deepest level of nested YAML mappings and lists
+	NestingDepth  int `json:"nestingDepth"`
+	YAMLSizeBytes int `json:"yamlSizeBytes"`
+	// MaxPluginsPerStep is the most plugins any single step uses
+	MaxPluginsPerStep int `json:"maxPluginsPerStep"`
+}
+
+// PipelineOverview is the result of a buildkite/pipelineOverview request
+type PipelineOverview struct {
+	// StepTypes counts the steps of each type, as named by buildkite/stepRangeAt
+	StepTypes map[string]int  `json:"stepTypes"`
+	Metrics   PipelineMetrics `json:"metrics"`
+	// Exceeded names the metrics over their configured thresholds
+	Exceeded []string `json:"exceeded,omitempty"`
+}
+
+// pipelineMeasurement records where each metric peaks, for placing diagnostics
+type pipelineMeasurement struct {
+	PipelineMetrics
+	stepsLine   int
+	deepestLine int
+	// pluginLines are the lines of each step's plugins key, with the number of plugins it lists
+	pluginLines map[int]int
+}
+
+// measurePipeline walks the pipeline's YAML to compute its metrics
+func measurePipeline(pipeline *parser.Pipeline) *pipelineMeasurement {
+	m := &pipelineMeasurement{pluginLines: make(map[int]int)}
+	m.YAMLSizeBytes = len(pipeline.Content)
+
+	root := pipeline.YAMLNode
+	if root == nil {
+		return m
+	}
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+
+	m.measureDepth(root, 0)
+
+	if steps := mappingKey(root, "steps"); steps != nil {
+		m.stepsLine = steps.key.Line - 1
+		m.measureSteps(steps.value)
+	}
+
+	return m
+}
+
+// measureDepth finds the deepest nested mapping or list below the node
+func (m *pipelineMeasurement) measureDepth(node *yaml.Node, depth int) {
+	if node.Kind == yaml.MappingNode || node.Kind == yaml.SequenceNode {
+		depth++
+		if depth > m.NestingDepth {
+			m.NestingDepth = depth
+			m.deepestLine = node.Line - 1
+		}
+	}
+	for _, child := range node.Content {
+		m.measureDepth(child, depth)
+	}
+}
+
+// measureSteps counts the steps in a steps list and the plugins each uses, descending into groups
+func (m *pipelineMeasurement) measureSteps(steps *yaml.Node) {
+	if steps.Kind != yaml.SequenceNode {
+		return
+	}
+
+	for _, step := range steps.Content {
+		m.Steps++
+		if step.Kind != yaml.MappingNode {
+			continue
+		}
+
+		if plugins := mappingKey(step, "plugins"); plugins != nil {
+			count := len(plugins.value.Content)
+			if plugins.value.Kind == yaml.MappingNode {
+				count /= 2
+			}
+			m.pluginLines[plugins.key.Line-1] = count
+			m.MaxPluginsPerStep = max(m.MaxPluginsPerStep, count)
+		}
+
+		if nested := mappingValue(step, "steps"); nested != nil {
+			m.measureSteps(nested)
+		}
+	}
+}
+
+// mappingEntry is a key and its value in a YAML mapping
+type mappingEntry struct {
+	key, value *yaml.Node
+}
+
+// mappingKey returns the entry for the key in a YAML mapping node, or nil
+func mappingKey(node *yaml.Node, key string) *mappingEntry {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return &mappingEntry{key: node.Content[i], value: node.Content[i+1]}
+		}
+	}
+	return nil
+}
+
+// mappingValue returns the value of the key in a YAML mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if entry := mappingKey(node, key); entry != nil {
+		return entry.value
+	}
+	return nil
+}
+
+// exceeded names the metrics over the thresholds
+func (m PipelineMetrics) exceeded(thresholds ComplexityThresholds) []string {
+	var names []string
+	if thresholds.Steps > 0 && m.Steps > thresholds.Steps {
+		names = append(names, "steps")
+	}
+	if thresholds.NestingDepth > 0 && m.NestingDepth > thresholds.NestingDepth {
+		names = append(names, "nestingDepth")
+	}
+	if thresholds.YAMLSizeBytes > 0 && m.YAMLSizeBytes > thresholds.YAMLSizeBytes {
+		names = append(names, "yamlSizeBytes")
+	}
+	if thresholds.PluginsPerStep > 0 && m.MaxPluginsPerStep > thresholds.PluginsPerStep {
+		names = append(names, "pluginsPerStep")
+	}
+	return names
+}
+
+// validateComplexity reports the metrics over their thresholds, when enabled
+func (s *Server) validateComplexity(pipeline *parser.Pipeline, lines []string) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	settings := s.Settings()
+	if !settings.ComplexityMetrics {
+		return diagnostics
+	}
+	thresholds := settings.ComplexityThresholds
+	m := measurePipeline(pipeline)
+
+	add := func(line int, message string) {
+		if line < 0 || line >= len(lines) {
+			line = 0
+		}
+		diagnostics = append(diagnostics, protocol.Diagnostic{
+			Range: protocol.Range{
+				Start: protocol.Position{Line: uint32(line), Character: uint32(s.getIndentLevel(lines[line]))},
+				End:   protocol.Position{Line: uint32(line), Character: uint32(len(lines[line]))},
+			},
+			Severity: protocol.DiagnosticSeverityInformation,
+			Message:  message,
+			Source:   "buildkite-ls",
+			Code:     "pipeline-complexity",
+		})
+	}
+
+	if thresholds.Steps > 0 && m.Steps > thresholds.Steps {
+		add(m.stepsLine, fmt.Sprintf("Pipeline has %d steps, more than the threshold of %d; consider splitting it into pipelines uploaded dynamically",
+			m.Steps, thresholds.Steps))
+	}
+	if thresholds.NestingDepth > 0 && m.NestingDepth > thresholds.NestingDepth {
+		add(m.deepestLine, fmt.Sprintf("Pipeline is nested %d levels deep, more than the threshold of %d",
+			m.NestingDepth, thresholds.NestingDepth))
+	}
+	if thresholds.YAMLSizeBytes > 0 && m.YAMLSizeBytes > thresholds.YAMLSizeBytes {
+		add(0, fmt.Sprintf("Pipeline is %d bytes, more than the threshold of %d; consider splitting it into pipelines uploaded dynamically",
+			m.YAMLSizeBytes, thresholds.YAMLSizeBytes))
+	}
+	if thresholds.PluginsPerStep > 0 {
+		for line := range lines {
+			if count, ok := m.pluginLines[line]; ok && count > thresholds.PluginsPerStep {
+				add(line, fmt.Sprintf("Step uses %d plugins, more than the threshold of %d", count, thresholds.PluginsPerStep))
+			}
+		}
+	}
+
+	return diagnostics
+}
+
+// PipelineOverview summarises the steps and complexity of an open pipeline document
+func (s *Server) PipelineOverview(ctx context.Context, params *PipelineOverviewParams) (*PipelineOverview, error) {
+	doc, exists := s.documentManager.GetDocument(params.TextDocument.URI)
+	if !exists {
+		return nil, fmt.Errorf("document not found: %s", params.TextDocument.URI)
+	}
+
+	if !s.isBuildkiteFile(string(params.TextDocument.URI)) {
+		return nil, nil
+	}
+
+	pipeline, err := parser.ParseYAML([]byte(doc.Content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pipeline: %w", err)
+	}
+
+	overview := &PipelineOverview{StepTypes: make(map[string]int)}
+
+	var pipelineData map[string]interface{}
+	if err := json.Unmarshal(pipeline.JSONBytes, &pipelineData); err == nil {
+		steps, _ := pipelineData["steps"].([]interface{})
+		countStepTypes(steps, overview.StepTypes)
+	}
+
+	overview.Metrics = measurePipeline(pipeline).PipelineMetrics
+	overview.Exceeded = overview.Metrics.exceeded(s.Settings().ComplexityThresholds)
+	return overview, nil
+}
+
+// countStepTypes tallies the steps by type, including the steps inside groups
+func countStepTypes(steps []interface{}, counts map[string]int) {
+	for _, step := range steps {
+		counts[stepType(step)]++
+		if group, ok := step.(map[string]interface{}); ok && stepType(step) == "group" {
+			nested, _ := group["steps"].([]interface{})
+			countStepTypes(nested, counts)
+		}
+	}
+}
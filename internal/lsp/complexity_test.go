@@ -0,0 +1,125 @@
+package lsp
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+const complexPipeline = `env:
+  FOO: bar
+steps:
+  - label: "Build"
+    command: make
+    plugins:
+      - docker#v5.13.0:
+          image: golang
+      - cache#v1.0.0: ~
+      - artifacts#v1.9.0:
+          upload: "dist/*"
+  - wait
+  - group: "Tests"
+    steps:
+      - command: make unit
+      - command: make lint
+`
+
+func TestMeasurePipeline(t *testing.T) {
+	pipeline, err := parser.ParseYAML([]byte(complexPipeline))
+	if err != nil {
+		t.Fatalf("Failed to parse pipeline: %v", err)
+	}
+
+	metrics := measurePipeline(pipeline).PipelineMetrics
+	expected := PipelineMetrics{
+		Steps:             5,
+		NestingDepth:      6,
+		YAMLSizeBytes:     len(complexPipeline),
+		MaxPluginsPerStep: 3,
+	}
+	if metrics != expected {
+		t.Errorf("Expected metrics %+v, got %+v", expected, metrics)
+	}
+}
+
+func TestServer_ComplexityDiagnostics(t *testing.T) {
+	server := newTestServer()
+
+	complexity := func() []protocol.Diagnostic {
+		var diagnostics []protocol.Diagnostic
+		for _, diagnostic := range server.Diagnose(complexPipeline) {
+			if diagnostic.Code == "pipeline-complexity" {
+				diagnostics = append(diagnostics, diagnostic)
+			}
+		}
+		return diagnostics
+	}
+
+	if diagnostics := complexity(); len(diagnostics) != 0 {
+		t.Fatalf("Expected no complexity diagnostics unless enabled, got %+v", diagnostics)
+	}
+
+	server.applySettings(parseSettings(map[string]interface{}{
+		"complexityMetrics": true,
+		"complexityThresholds": map[string]interface{}{
+			"steps":          4,
+			"pluginsPerStep": 2,
+			"yamlSizeBytes":  0,
+		},
+	}))
+
+	diagnostics := complexity()
+	if len(diagnostics) != 2 {
+		t.Fatalf("Expected step count and plugin diagnostics, got %+v", diagnostics)
+	}
+
+	if diagnostics[0].Range.Start.Line != 2 || !strings.Contains(diagnostics[0].Message, "5 steps, more than the threshold of 4") {
+		t.Errorf("Unexpected step count diagnostic: %+v", diagnostics[0])
+	}
+	if diagnostics[1].Range.Start.Line != 5 || !strings.Contains(diagnostics[1].Message, "3 plugins, more than the threshold of 2") {
+		t.Errorf("Unexpected plugin count diagnostic: %+v", diagnostics[1])
+	}
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Severity != protocol.DiagnosticSeverityInformation {
+			t.Errorf("Expected information severity, got %v", diagnostic.Severity)
+		}
+	}
+}
+
+func TestServer_PipelineOverview(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	server.documentManager.OpenDocument(uri, 1, complexPipeline)
+	server.applySettings(parseSettings(map[string]interface{}{
+		"complexityThresholds": map[string]interface{}{"nestingDepth": 5},
+	}))
+
+	overview, err := server.PipelineOverview(context.Background(), &PipelineOverviewParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+	})
+	if err != nil {
+		t.Fatalf("PipelineOverview failed: %v", err)
+	}
+
+	expectedTypes := map[string]int{"command": 3, "wait": 1, "group": 1}
+	if !reflect.DeepEqual(overview.StepTypes, expectedTypes) {
+		t.Errorf("Expected step types %v, got %v", expectedTypes, overview.StepTypes)
+	}
+	if overview.Metrics.Steps != 5 || overview.Metrics.MaxPluginsPerStep != 3 {
+		t.Errorf("Unexpected metrics: %+v", overview.Metrics)
+	}
+	if !reflect.DeepEqual(overview.Exceeded, []string{"nestingDepth"}) {
+		t.Errorf("Expected only the nesting depth to be exceeded, got %v", overview.Exceeded)
+	}
+
+	if _, err := server.PipelineOverview(context.Background(), &PipelineOverviewParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: "file:///test/.buildkite/closed.yml"},
+	}); err == nil {
+		t.Error("Expected an error for a document that isn't open")
+	}
+}
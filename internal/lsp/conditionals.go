@@ -0,0 +1,271 @@
+package lsp
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+
+	bkcontext "github.com/mcncl/buildkite-ls/internal/context"
+	"github.com/mcncl/buildkite-ls/internal/expression"
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+// conditionalScenario is a representative build an `if:` expression is evaluated against
+type conditionalScenario struct {
+	Name      string
+	Variables expression.Variables
+}
+
+// conditionalScenarios covers the builds users most often write conditions for
+var conditionalScenarios = []conditionalScenario{
+	{
+		Name:      "Push to `main`",
+		Variables: scenarioVariables(nil),
+	},
+	{
+		Name: "Pull request from `feature/login`",
+		Variables: scenarioVariables(expression.Variables{
+			"build.branch":                        "feature/login",
+			"build.message":                       "Add login page",
+			"build.pull_request.id":               "42",
+			"build.pull_request.base_branch":      "main",
+			"build.pull_request.draft":            false,
+			"build.pull_request.labels":           []interface{}{},
+			"build.pull_request.repository":       "https://github.com/my-org/my-app.git",
+			"build.pull_request.repository.fork":  false,
+			"build.pull_request.repository.owner": "my-org",
+		}),
+	},
+	{
+		Name: "Tag `v1.2.0`",
+		Variables: scenarioVariables(expression.Variables{
+			"build.branch":  "v1.2.0",
+			"build.tag":     "v1.2.0",
+			"build.message": "Release v1.2.0",
+		}),
+	},
+}
+
+// scenarioVariables returns the variables of a webhook-triggered push to the default branch,
+// with the overrides applied
+func scenarioVariables(overrides expression.Variables) expression.Variables {
+	vars := expression.Variables{
+		"build.branch":                        "main",
+		"build.commit":                        "a1b2c3d4e5f6",
+		"build.message":                       "Update README",
+		"build.number":                        float64(128),
+		"build.source":                        "webhook",
+		"build.state":                         "started",
+		"build.tag":                           nil,
+		"build.id":                            "01890000-0000-0000-0000-000000000000",
+		"build.author.name":                   "Jane Doe",
+		"build.author.email":                  "jane@example.com",
+		"build.creator.name":                  "Jane Doe",
+		"build.creator.email":                 "jane@example.com",
+		"build.pull_request.id":               nil,
+		"build.pull_request.base_branch":      nil,
+		"build.pull_request.draft":            nil,
+		"build.pull_request.labels":           []interface{}{},
+		"build.pull_request.repository":       nil,
+		"build.pull_request.repository.fork":  nil,
+		"build.pull_request.repository.owner": nil,
+		"build.env":                           map[string]interface{}{},
+		"pipeline.default_branch":             "main",
+		"pipeline.slug":                       "my-app",
+		"pipeline.repository":                 "https://github.com/my-org/my-app.git",
+		"organization.slug":                   "my-org",
+	}
+
+	for name, value := range overrides {
+		vars[name] = value
+	}
+	return vars
+}
+
+// getConditionalHoverContent renders how the `if:` expression on the current line evaluates
+// for each of the conditionalScenarios
+func (s *Server) getConditionalHoverContent(posCtx *bkcontext.PositionContext) string {
+	source := s.conditionalSource(posCtx)
+	if source == "" {
+		return ""
+	}
+
+	var content strings.Builder
+	content.WriteString("**Evaluation examples**\n\n")
+
+	expr, err := expression.Parse(source)
+	if err != nil {
+		fmt.Fprintf(&content, "Unable to parse condition: %v", err)
+		return content.String()
+	}
+
+	content.WriteString("| Scenario | Result |\n|---|---|\n")
+	for _, scenario := range conditionalScenarios {
+		result := "✅ runs"
+		if matched, err := expr.Evaluate(scenario.Variables); err != nil {
+			result = fmt.Sprintf("⚠️ %v", err)
+		} else if !matched {
+			result = "⏭️ skipped"
+		}
+		fmt.Fprintf(&content, "| %s | %s |\n", scenario.Name, result)
+	}
+
+	content.WriteString("\n_Evaluated against example builds; `build.env()` values are empty._")
+	return content.String()
+}
+
+// conditionalSource returns the expression of the `if:` key on the current line, following
+// block scalars onto the lines below
+func (s *Server) conditionalSource(posCtx *bkcontext.PositionContext) string {
+	line := posCtx.CurrentLine
+	_, value, found := strings.Cut(line, ":")
+	if !found {
+		return ""
+	}
+	value = strings.TrimSpace(value)
+
+	if strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">") {
+		indent := s.getIndentLevel(line)
+		lines := documentLines(posCtx.FullContent)
+
+		var parts []string
+		for i := int(posCtx.Position.Line) + 1; i < len(lines); i++ {
+			next := lines[i]
+			if strings.TrimSpace(next) == "" {
+				continue
+			}
+			if s.getIndentLevel(next) <= indent {
+				break
+			}
+			parts = append(parts, strings.TrimSpace(next))
+		}
+		return strings.Join(parts, " ")
+	}
+
+	// Let YAML unquote the value, keeping the raw text if it isn't a plain scalar
+	var unquoted string
+	if err := yaml.Unmarshal([]byte(value), &unquoted); err == nil {
+		return strings.TrimSpace(unquoted)
+	}
+	return value
+}
+
+// validateConditions checks each step's `if:`, which Buildkite only parses once the pipeline
+// is uploaded: that it parses, and that the variables and functions it names are ones
+// Buildkite provides, so a typo such as `build.brach` doesn't leave the step never running.
+// Wait steps' syntax errors are left to validateWaitSteps, and conditions with a `$`, which
+// may only parse once interpolated, aren't checked for syntax.
+func (s *Server) validateConditions(pipeline *parser.Pipeline, lines []string) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	root := pipeline.YAMLNode
+	if root == nil || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return diagnostics
+	}
+
+	for _, step := range dependableSteps(mappingValue(root.Content[0], "steps")) {
+		condition := mappingValue(step, "if")
+		if condition == nil || condition.Kind != yaml.ScalarNode || condition.Tag != "!!str" {
+			continue
+		}
+
+		expr, err := expression.Parse(condition.Value)
+		if err != nil {
+			if !isWaitStepNode(step) && !strings.Contains(condition.Value, "$") {
+				diagnostics = append(diagnostics, protocol.Diagnostic{
+					Range:    conditionErrorRange(condition, err, lines),
+					Severity: protocol.DiagnosticSeverityError,
+					Message:  fmt.Sprintf("Invalid condition: %v", err),
+					Source:   "buildkite-ls",
+					Code:     "invalid-condition",
+				})
+			}
+			continue
+		}
+
+		for _, reference := range expr.References() {
+			message := unknownConditionReference(reference)
+			if message == "" {
+				continue
+			}
+			diagnostics = append(diagnostics, protocol.Diagnostic{
+				Range:    conditionOffsetRange(condition, reference.Offset, len(reference.Name), lines),
+				Severity: protocol.DiagnosticSeverityError,
+				Message:  message,
+				Source:   "buildkite-ls",
+				Code:     "unknown-condition-variable",
+			})
+		}
+	}
+
+	return diagnostics
+}
+
+// unknownConditionReference explains a variable or function Buildkite doesn't provide to
+// conditionals, suggesting the closest one it does, or returns "" for known ones
+func unknownConditionReference(reference expression.Reference) string {
+	isVariable := slices.Contains(expression.KnownVariables, reference.Name)
+	isFunction := slices.Contains(expression.KnownFunctions, reference.Name)
+
+	switch {
+	case reference.Call && isFunction, !reference.Call && isVariable:
+		return ""
+	case reference.Call && isVariable:
+		return fmt.Sprintf("%s is a variable, not a function", reference.Name)
+	case !reference.Call && isFunction:
+		return fmt.Sprintf("%s is a function: call it with the variable's name, as in %s(\"DEPLOY\")", reference.Name, reference.Name)
+	}
+
+	kind := "variable"
+	if reference.Call {
+		kind = "function"
+	}
+	message := fmt.Sprintf("Unknown %s '%s' in condition", kind, reference.Name)
+	if suggestion := closestConditionReference(reference); suggestion != "" {
+		message += fmt.Sprintf(". Did you mean '%s'?", suggestion)
+	}
+	return message
+}
+
+// closestConditionReference returns the known variable, or function for calls, closest to
+// an unknown one, or "" when none is close
+func closestConditionReference(reference expression.Reference) string {
+	candidates := expression.KnownVariables
+	if reference.Call {
+		candidates = expression.KnownFunctions
+	}
+
+	closest, distance := "", max(2, len(reference.Name)/5)+1
+	for _, candidate := range candidates {
+		if d := parser.EditDistance(reference.Name, candidate); d < distance {
+			closest, distance = candidate, d
+		}
+	}
+	return closest
+}
+
+// createConditionVariableAction replaces an unknown variable or function in a condition with
+// the one it most likely means
+func (s *Server) createConditionVariableAction(uri protocol.DocumentURI, lines []string, diagnostic protocol.Diagnostic) *protocol.CodeAction {
+	r := diagnostic.Range
+	if r.Start.Line != r.End.Line || int(r.Start.Line) >= len(lines) || int(r.End.Character) > len(lines[r.Start.Line]) {
+		return nil
+	}
+	name := lines[r.Start.Line][r.Start.Character:r.End.Character]
+
+	// Block scalars are highlighted whole, so only a highlighted name is replaced
+	rest := lines[r.Start.Line][r.End.Character:]
+	reference := expression.Reference{Name: name, Call: strings.HasPrefix(strings.TrimSpace(rest), "(")}
+	suggestion := closestConditionReference(reference)
+	if suggestion == "" || suggestion == name {
+		return nil
+	}
+
+	action := quickFix(uri, fmt.Sprintf("Change to '%s'", suggestion), []protocol.TextEdit{{Range: r, NewText: suggestion}})
+	action.Diagnostics = []protocol.Diagnostic{diagnostic}
+	action.IsPreferred = true
+	return &action
+}
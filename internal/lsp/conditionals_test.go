@@ -0,0 +1,253 @@
+package lsp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+func TestServer_ConditionalHover(t *testing.T) {
+	content := `steps:
+  - command: "make deploy"
+    if: build.branch == pipeline.default_branch && build.tag == null
+  - command: "make release"
+    if: |
+      build.tag =~ /^v/
+  - command: "make preview"
+    if: "build.pull_request.id != null"
+  - command: "make broken"
+    if: build.branch == "main
+  - command: "make typo"
+    if: build.brnch == "main"`
+
+	tests := []struct {
+		name     string
+		position protocol.Position
+		expected []string
+	}{
+		{
+			name:     "default branch push",
+			position: protocol.Position{Line: 2, Character: 10},
+			expected: []string{"| Push to `main` | ✅ runs |", "| Pull request from `feature/login` | ⏭️ skipped |", "| Tag `v1.2.0` | ⏭️ skipped |"},
+		},
+		{
+			name:     "block scalar",
+			position: protocol.Position{Line: 4, Character: 8},
+			expected: []string{"| Push to `main` | ⏭️ skipped |", "| Tag `v1.2.0` | ✅ runs |"},
+		},
+		{
+			name:     "quoted expression",
+			position: protocol.Position{Line: 7, Character: 12},
+			expected: []string{"| Push to `main` | ⏭️ skipped |", "| Pull request from `feature/login` | ✅ runs |"},
+		},
+		{
+			name:     "syntax error",
+			position: protocol.Position{Line: 9, Character: 12},
+			expected: []string{"Unable to parse condition: unterminated string"},
+		},
+		{
+			name:     "unknown variable",
+			position: protocol.Position{Line: 11, Character: 12},
+			expected: []string{"⚠️ unknown variable build.brnch"},
+		},
+		{
+			name:     "key keeps its docs",
+			position: protocol.Position{Line: 2, Character: 5},
+			expected: []string{"Conditional execution", "| Push to `main` | ✅ runs |"},
+		},
+	}
+
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///.buildkite/pipeline.yml")
+	server.documentManager.OpenDocument(uri, 1, content)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hover, err := server.Hover(context.Background(), &protocol.HoverParams{
+				TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+					TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+					Position:     tt.position,
+				},
+			})
+			if err != nil {
+				t.Fatalf("Hover failed: %v", err)
+			}
+			if hover == nil {
+				t.Fatal("Expected hover content")
+			}
+
+			for _, expected := range tt.expected {
+				if !strings.Contains(hover.Contents.Value, expected) {
+					t.Errorf("Expected hover to contain %q, got:\n%s", expected, hover.Contents.Value)
+				}
+			}
+		})
+	}
+}
+
+// conditionDiagnosticsFor returns the diagnostics raised for step conditions
+func conditionDiagnosticsFor(server *Server, content string) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+	for _, diagnostic := range server.Diagnose(content) {
+		switch diagnostic.Code {
+		case "invalid-condition", "unknown-condition-variable", "invalid-wait-condition":
+			diagnostics = append(diagnostics, diagnostic)
+		}
+	}
+	return diagnostics
+}
+
+func TestServer_ValidateConditions(t *testing.T) {
+	server := newTestServer()
+
+	tests := []struct {
+		name    string
+		content string
+		code    string
+		line    uint32
+		start   uint32
+		end     uint32
+		message string
+	}{
+		{
+			name:    "misspelt variable",
+			content: "steps:\n  - command: make\n    if: build.brach == \"main\"\n",
+			code:    "unknown-condition-variable",
+			line:    2, start: 8, end: 19,
+			message: "Unknown variable 'build.brach' in condition. Did you mean 'build.branch'?",
+		},
+		{
+			name:    "quoted condition",
+			content: "steps:\n  - command: make\n    if: \"build.branch == 'main' && !build.pull_request.drafts\"\n",
+			code:    "unknown-condition-variable",
+			line:    2, start: 36, end: 61,
+			message: "Did you mean 'build.pull_request.draft'?",
+		},
+		{
+			name:    "misspelt function",
+			content: "steps:\n  - command: make\n    if: build.evn(\"DEPLOY\") == \"true\"\n",
+			code:    "unknown-condition-variable",
+			line:    2, start: 8, end: 17,
+			message: "Unknown function 'build.evn' in condition. Did you mean 'build.env'?",
+		},
+		{
+			name:    "function used as a variable",
+			content: "steps:\n  - command: make\n    if: build.env == \"true\"\n",
+			code:    "unknown-condition-variable",
+			line:    2, start: 8, end: 17,
+			message: "build.env is a function",
+		},
+		{
+			name:    "assignment instead of comparison",
+			content: "steps:\n  - command: make\n    if: build.branch = \"main\"\n",
+			code:    "invalid-condition",
+			line:    2, start: 21, end: 22,
+			message: "invalid operator \"=\": use == to compare",
+		},
+		{
+			name:    "unbalanced parentheses",
+			content: "steps:\n  - command: make\n    if: (build.branch == \"main\"\n",
+			code:    "invalid-condition",
+			line:    2, start: 8, end: 31,
+			message: "unbalanced parentheses",
+		},
+		{
+			name:    "step in a group",
+			content: "steps:\n  - group: Deploy\n    steps:\n      - command: make\n        if: pipeline.slugg == \"app\"\n",
+			code:    "unknown-condition-variable",
+			line:    4, start: 12, end: 26,
+			message: "Did you mean 'pipeline.slug'?",
+		},
+		{
+			name:    "wait step syntax errors are reported once",
+			content: "steps:\n  - command: make\n  - wait: ~\n    if: build.branch ==\n",
+			code:    "invalid-wait-condition",
+			line:    3, start: 8, end: 23,
+			message: "Invalid wait step condition",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diagnostics := conditionDiagnosticsFor(server, tt.content)
+			if len(diagnostics) != 1 {
+				t.Fatalf("Expected 1 condition diagnostic, got %+v", diagnostics)
+			}
+
+			got := diagnostics[0]
+			if got.Code != tt.code {
+				t.Errorf("Expected code %s, got %v", tt.code, got.Code)
+			}
+			if got.Severity != protocol.DiagnosticSeverityError {
+				t.Errorf("Expected an error, got severity %v", got.Severity)
+			}
+			if got.Range.Start.Line != tt.line || got.Range.Start.Character != tt.start || got.Range.End.Character != tt.end {
+				t.Errorf("Expected %d:%d-%d, got %+v", tt.line, tt.start, tt.end, got.Range)
+			}
+			if !strings.Contains(got.Message, tt.message) {
+				t.Errorf("Expected message containing %q, got %q", tt.message, got.Message)
+			}
+		})
+	}
+}
+
+func TestServer_ValidateConditions_Valid(t *testing.T) {
+	server := newTestServer()
+	content := `steps:
+  - command: make deploy
+    if: build.branch == pipeline.default_branch && !build.pull_request.draft
+  - command: make release
+    if: |
+      build.tag =~ /^v/ || build.env("RELEASE") == "true"
+  - command: make preview
+    if: build.pull_request.labels includes "preview"
+  - command: make interpolated
+    if: build.branch == $DEPLOY_BRANCH`
+
+	if diagnostics := conditionDiagnosticsFor(server, content); len(diagnostics) != 0 {
+		t.Errorf("Expected no condition diagnostics, got %+v", diagnostics)
+	}
+}
+
+func TestServer_ConditionVariableAction(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	content := `steps:
+  - command: make deploy
+    if: build.brach == "main" && build.tag == null`
+	server.documentManager.OpenDocument(uri, 1, content)
+
+	diagnostics := conditionDiagnosticsFor(server, content)
+	if len(diagnostics) != 1 {
+		t.Fatalf("Expected a single unknown-condition-variable diagnostic, got %+v", diagnostics)
+	}
+
+	actions, err := server.CodeAction(context.Background(), &protocol.CodeActionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Range:        diagnostics[0].Range,
+		Context:      protocol.CodeActionContext{Diagnostics: diagnostics},
+	})
+	if err != nil {
+		t.Fatalf("CodeAction failed: %v", err)
+	}
+
+	var change *protocol.CodeAction
+	for i := range actions {
+		if actions[i].Title == "Change to 'build.branch'" {
+			change = &actions[i]
+		}
+	}
+	if change == nil {
+		t.Fatalf("Expected 'Change to 'build.branch'' action, got %+v", actions)
+	}
+
+	fixed := applyTextEdit(content, change.Edit.Changes[uri][0])
+	expected := `steps:
+  - command: make deploy
+    if: build.branch == "main" && build.tag == null`
+	if fixed != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, fixed)
+	}
+}
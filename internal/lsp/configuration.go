@@ -0,0 +1,88 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+
+	"go.lsp.dev/protocol"
+)
+
+// ConfigurationSection is the section settings are pulled from with workspace/configuration,
+// so `buildkite-ls.teams` in VS Code settings sets the teams setting
+const ConfigurationSection = "buildkite-ls"
+
+// pullConfiguration asks the client for the configuration section, and applies it over the
+// initialization options. Open documents are revalidated against the new settings.
+func (s *Server) pullConfiguration(ctx context.Context) error {
+	if s.conn == nil || !s.ClientFeatures().Configuration {
+		return nil
+	}
+
+	var sections []interface{}
+	params := protocol.ConfigurationParams{
+		Items: []protocol.ConfigurationItem{{Section: ConfigurationSection}},
+	}
+	if _, err := s.conn.Call(ctx, "workspace/configuration", params, &sections); err != nil {
+		return fmt.Errorf("failed to pull configuration: %w", err)
+	}
+
+	var section interface{}
+	if len(sections) > 0 {
+		section = sections[0]
+	}
+	s.applyConfiguration(ctx, section)
+	return nil
+}
+
+// refreshConfiguration pulls the configuration in the background, reporting whether the
+// client supports it. The response arrives on the connection the triggering notification
+// came in on, so waiting for it in the notification's handler would never return.
+func (s *Server) refreshConfiguration() bool {
+	if s.conn == nil || !s.ClientFeatures().Configuration {
+		return false
+	}
+
+	go func() {
+		if err := s.pullConfiguration(context.Background()); err != nil {
+			s.logger.Printf("%v", err)
+		}
+	}()
+	return true
+}
+
+// applyConfiguration applies the client's configuration section over the initialization
+// options, and revalidates the open documents. The rest of the workspace is revalidated in
+// the background when workspace diagnostics are on.
+func (s *Server) applyConfiguration(ctx context.Context, section interface{}) {
+	s.settingsMu.RLock()
+	initializationOptions := s.initializationOptions
+	s.settingsMu.RUnlock()
+
+	s.applySettings(parseSettings(initializationOptions, section))
+	s.logger.Printf("Applied client configuration: %+v", s.Settings())
+
+	for _, doc := range s.documentManager.AllDocuments() {
+		s.validateDocument(ctx, doc.URI, doc.Content)
+	}
+	if s.Settings().WorkspaceDiagnostics {
+		s.validateWorkspaceInBackground()
+	}
+}
+
+// DidChangeConfiguration re-reads the settings when the client's configuration changes.
+// Clients that answer workspace/configuration are asked for the section; otherwise the
+// section is read from the notification itself.
+func (s *Server) DidChangeConfiguration(ctx context.Context, params *protocol.DidChangeConfigurationParams) error {
+	if s.refreshConfiguration() {
+		return nil
+	}
+
+	section := params.Settings
+	if settings, ok := params.Settings.(map[string]interface{}); ok {
+		if nested, ok := settings[ConfigurationSection]; ok {
+			section = nested
+		}
+	}
+	s.applyConfiguration(ctx, section)
+	return nil
+}
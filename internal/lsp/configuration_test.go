@@ -0,0 +1,51 @@
+package lsp
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+func TestParseSettings_Layers(t *testing.T) {
+	settings := parseSettings(
+		map[string]interface{}{"teams": []string{"platform"}, "complexityMetrics": true},
+		map[string]interface{}{"teams": []string{"security"}},
+		map[string]interface{}{"complexityMetrics": "yes"},
+	)
+
+	if !reflect.DeepEqual(settings.Teams, []string{"security"}) {
+		t.Errorf("Expected later layers to override earlier ones, got teams %v", settings.Teams)
+	}
+	if !settings.ComplexityMetrics {
+		t.Error("Expected settings missing from later layers to be kept, and malformed layers ignored")
+	}
+}
+
+func TestServer_DidChangeConfiguration(t *testing.T) {
+	server := newTestServer()
+	if _, err := server.Initialize(context.Background(), &protocol.InitializeParams{
+		InitializationOptions: map[string]interface{}{"teams": []string{"platform"}, "untitledPipelines": true},
+	}); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+
+	// Without workspace/configuration support, the section comes with the notification
+	err := server.DidChangeConfiguration(context.Background(), &protocol.DidChangeConfigurationParams{
+		Settings: map[string]interface{}{
+			ConfigurationSection: map[string]interface{}{"teams": []string{"security"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("DidChangeConfiguration failed: %v", err)
+	}
+
+	settings := server.Settings()
+	if !reflect.DeepEqual(settings.Teams, []string{"security"}) {
+		t.Errorf("Expected the configuration to override the initialization options, got teams %v", settings.Teams)
+	}
+	if !settings.UntitledPipelines {
+		t.Error("Expected initialization options the configuration doesn't set to be kept")
+	}
+}
@@ -0,0 +1,218 @@
+package lsp
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+// maxRedirectSuggestions caps the keys offered to redirect a dangling dependency to
+const maxRedirectSuggestions = 3
+
+// stepKeyHistory remembers the step keys each open document has defined, so dependencies
+// on steps removed or re-keyed since can be told apart from dependencies on steps another
+// pipeline upload defines
+type stepKeyHistory struct {
+	mu   sync.Mutex
+	keys map[protocol.DocumentURI]map[string]bool
+}
+
+func newStepKeyHistory() *stepKeyHistory {
+	return &stepKeyHistory{
+		keys: make(map[protocol.DocumentURI]map[string]bool),
+	}
+}
+
+// record adds the keys a document defines now to those it has defined, returning the keys
+// it defined before but doesn't any more. Content without a URI has no history to compare.
+func (h *stepKeyHistory) record(uri protocol.DocumentURI, current []string) map[string]bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if uri == "" {
+		return map[string]bool{}
+	}
+	known := h.keys[uri]
+	if known == nil {
+		known = make(map[string]bool)
+		h.keys[uri] = known
+	}
+	removed := make(map[string]bool)
+	for key := range known {
+		if !slices.Contains(current, key) {
+			removed[key] = true
+		}
+	}
+	for _, key := range current {
+		known[key] = true
+	}
+	return removed
+}
+
+// defined reports whether a document has defined a key since it was opened
+func (h *stepKeyHistory) defined(uri protocol.DocumentURI, key string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.keys[uri][key]
+}
+
+func (h *stepKeyHistory) forget(uri protocol.DocumentURI) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.keys, uri)
+}
+
+// validateDanglingDependencies warns about depends_on entries naming a step that was removed
+// from the document, or whose key changed, since it was opened. Buildkite can't order a
+// step after one that doesn't exist. Keys the document never defined are left alone, as
+// they may belong to steps uploaded separately. The warning carries the missing key in its
+// data for the quick fixes removing or redirecting the dependency.
+func (s *Server) validateDanglingDependencies(uri protocol.DocumentURI, pipeline *parser.Pipeline) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	root := pipeline.YAMLNode
+	if root == nil || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return diagnostics
+	}
+	steps := dependableSteps(mappingValue(root.Content[0], "steps"))
+
+	var keys []string
+	for _, step := range steps {
+		if key := stepNodeKey(step); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	removed := s.stepKeys.record(uri, keys)
+	if len(removed) == 0 {
+		return diagnostics
+	}
+
+	for _, step := range steps {
+		for _, dependency := range dependencyNodes(step) {
+			if !removed[dependency.Value] {
+				continue
+			}
+			diagnostic := nodeDiagnostic(dependency, protocol.DiagnosticSeverityWarning, "dangling-depends-on",
+				fmt.Sprintf("No step has the key '%s' any more: the step was removed or its key changed, so this dependency can't be met", dependency.Value))
+			diagnostic.Data = map[string]interface{}{"dependsOn": dependency.Value}
+			diagnostics = append(diagnostics, diagnostic)
+		}
+	}
+
+	return diagnostics
+}
+
+// dependableSteps lists the steps of a pipeline that can have a key, including groups and
+// the steps inside them
+func dependableSteps(list *yaml.Node) []*yaml.Node {
+	var steps []*yaml.Node
+	if list == nil || list.Kind != yaml.SequenceNode {
+		return steps
+	}
+	for _, step := range list.Content {
+		if step.Kind != yaml.MappingNode {
+			continue
+		}
+		steps = append(steps, step)
+		steps = append(steps, dependableSteps(mappingValue(step, "steps"))...)
+	}
+	return steps
+}
+
+// dependencyNodes returns the nodes naming the keys in a step's depends_on: the value itself,
+// its list entries, or the step of its {step, allow_failure} entries
+func dependencyNodes(step *yaml.Node) []*yaml.Node {
+	value := mappingValue(step, "depends_on")
+	if value == nil {
+		return nil
+	}
+	entries := []*yaml.Node{value}
+	if value.Kind == yaml.SequenceNode {
+		entries = value.Content
+	}
+
+	var nodes []*yaml.Node
+	for _, entry := range entries {
+		if entry.Kind == yaml.MappingNode {
+			entry = mappingValue(entry, "step")
+		}
+		if entry != nil && entry.Kind == yaml.ScalarNode && entry.Value != "" {
+			nodes = append(nodes, entry)
+		}
+	}
+	return nodes
+}
+
+// createDanglingDependencyActions offers to remove the dependency a dangling-depends-on
+// warning is on, or to depend instead on one of the document's keys, closest first
+func (s *Server) createDanglingDependencyActions(uri protocol.DocumentURI, lines []string, diagnostic protocol.Diagnostic) []protocol.CodeAction {
+	var actions []protocol.CodeAction
+
+	data, _ := diagnostic.Data.(map[string]interface{})
+	key, _ := data["dependsOn"].(string)
+	if key == "" {
+		return actions
+	}
+	edit, step := stepEditOf(lines, int(diagnostic.Range.Start.Line))
+	if edit == nil {
+		return actions
+	}
+	entry := mappingKey(step, "depends_on")
+	if entry == nil {
+		return actions
+	}
+
+	var node, item *yaml.Node
+	for _, dependency := range dependencyNodes(step) {
+		if dependency.Value == key && dependency.Line-1 == int(diagnostic.Range.Start.Line) {
+			node = dependency
+		}
+	}
+	if node == nil {
+		return actions
+	}
+	if entry.value.Kind == yaml.SequenceNode {
+		for _, candidate := range entry.value.Content {
+			if candidate == node || (candidate.Kind == yaml.MappingNode && mappingValue(candidate, "step") == node) {
+				item = candidate
+			}
+		}
+	}
+
+	if item != nil && len(entry.value.Content) > 1 {
+		edit.deleteItem(entry.value, item)
+	} else {
+		edit.deleteEntry(step, entry)
+	}
+	action := quickFix(uri, fmt.Sprintf("Remove dependency on '%s'", key), edit.textEdits())
+	action.Diagnostics = []protocol.Diagnostic{diagnostic}
+	actions = append(actions, action)
+
+	// Keys the step doesn't already depend on, other than its own
+	var candidates []string
+	for _, other := range dependableSteps(mappingValue(edit.root, "steps")) {
+		otherKey := stepNodeKey(other)
+		if otherKey == "" || otherKey == stepNodeKey(step) || slices.Contains(nodeDependencies(step), otherKey) {
+			continue
+		}
+		candidates = append(candidates, otherKey)
+	}
+	slices.SortStableFunc(candidates, func(a, b string) int {
+		return parser.EditDistance(key, a) - parser.EditDistance(key, b)
+	})
+
+	for _, candidate := range candidates[:min(len(candidates), maxRedirectSuggestions)] {
+		redirect := &structuredEdit{lines: lines, root: edit.root}
+		redirect.replace(nodeStart(node), redirect.nodeEnd(node), yamlString(candidate))
+		action := quickFix(uri, fmt.Sprintf("Depend on '%s' instead", candidate), redirect.textEdits())
+		action.Diagnostics = []protocol.Diagnostic{diagnostic}
+		actions = append(actions, action)
+	}
+
+	return actions
+}
@@ -0,0 +1,172 @@
+package lsp
+
+import (
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+// danglingDependenciesFor validates a version of a document, as an edit would
+func danglingDependenciesFor(t *testing.T, server *Server, uri protocol.DocumentURI, content string) []protocol.Diagnostic {
+	t.Helper()
+	pipeline, err := parser.ParseYAML([]byte(content))
+	if err != nil {
+		t.Fatalf("ParseYAML failed: %v", err)
+	}
+	return server.validateDanglingDependencies(uri, pipeline)
+}
+
+func TestServer_ValidateDanglingDependencies(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+
+	original := `steps:
+  - label: Build
+    key: build
+    command: make
+  - label: Test
+    key: test
+    command: make test
+    depends_on: build
+  - label: Deploy
+    command: make deploy
+    depends_on:
+      - test
+      - step: build
+        allow_failure: true
+      - uploaded-elsewhere
+`
+	if diagnostics := danglingDependenciesFor(t, server, uri, original); len(diagnostics) != 0 {
+		t.Fatalf("Expected no diagnostics before any step is removed, got %+v", diagnostics)
+	}
+
+	rekeyed := strings.Replace(original, "key: build", "key: compile", 1)
+	diagnostics := danglingDependenciesFor(t, server, uri, rekeyed)
+	if len(diagnostics) != 2 {
+		t.Fatalf("Expected 2 dangling dependencies, got %d: %+v", len(diagnostics), diagnostics)
+	}
+	for i, line := range []uint32{7, 12} {
+		if diagnostics[i].Code != "dangling-depends-on" || diagnostics[i].Severity != protocol.DiagnosticSeverityWarning {
+			t.Errorf("Expected a dangling-depends-on warning, got %+v", diagnostics[i])
+		}
+		if diagnostics[i].Range.Start.Line != line {
+			t.Errorf("Expected the warning on line %d, got %d", line, diagnostics[i].Range.Start.Line)
+		}
+	}
+
+	// The key stays known while the document is open, so later edits keep the warnings
+	if diagnostics := danglingDependenciesFor(t, server, uri, rekeyed); len(diagnostics) != 2 {
+		t.Errorf("Expected the warnings to persist, got %+v", diagnostics)
+	}
+	if diagnostics := danglingDependenciesFor(t, server, uri, original); len(diagnostics) != 0 {
+		t.Errorf("Expected restoring the key to clear the warnings, got %+v", diagnostics)
+	}
+
+	server.stepKeys.forget(uri)
+	if diagnostics := danglingDependenciesFor(t, server, uri, rekeyed); len(diagnostics) != 0 {
+		t.Errorf("Expected a reopened document to start afresh, got %+v", diagnostics)
+	}
+
+	// Content diagnosed without a URI, such as corpus fixtures, doesn't share a history
+	server.Diagnose(original)
+	for _, diagnostic := range server.Diagnose(rekeyed) {
+		if diagnostic.Code == "dangling-depends-on" {
+			t.Errorf("Expected no history between documents without a URI, got %+v", diagnostic)
+		}
+	}
+}
+
+func TestServer_DanglingDependencyActions(t *testing.T) {
+	content := `steps:
+  - label: Compile
+    key: compile
+    command: make
+  - label: Lint
+    key: lint
+    command: make lint
+  - label: Test
+    key: test
+    command: make test
+    depends_on: build
+  - label: Deploy
+    command: make deploy
+    depends_on:
+      - test
+      - step: build
+        allow_failure: true
+  - label: Notify
+    command: notify
+    depends_on: [build, test]
+`
+
+	tests := []struct {
+		name     string
+		line     uint32
+		title    string
+		expected string
+	}{
+		{
+			name:  "removes a single dependency",
+			line:  10,
+			title: "Remove dependency on 'build'",
+			expected: `    command: make test
+  - label: Deploy`,
+		},
+		{
+			name:  "removes a list entry",
+			line:  15,
+			title: "Remove dependency on 'build'",
+			expected: `    depends_on:
+      - test
+  - label: Notify`,
+		},
+		{
+			name:     "removes a flow list entry",
+			line:     19,
+			title:    "Remove dependency on 'build'",
+			expected: "    depends_on: [test]",
+		},
+		{
+			name:     "redirects the dependency",
+			line:     10,
+			title:    "Depend on 'compile' instead",
+			expected: "    depends_on: compile\n",
+		},
+		{
+			name:     "redirects an allow_failure entry",
+			line:     15,
+			title:    "Depend on 'lint' instead",
+			expected: "      - step: lint\n        allow_failure: true\n",
+		},
+	}
+
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	lines := splitLines(content)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diagnostic := protocol.Diagnostic{
+				Range: protocol.Range{Start: protocol.Position{Line: tt.line}},
+				Code:  "dangling-depends-on",
+				Data:  map[string]interface{}{"dependsOn": "build"},
+			}
+
+			var titles []string
+			for _, action := range server.createDanglingDependencyActions(uri, lines, diagnostic) {
+				titles = append(titles, action.Title)
+				if action.Title != tt.title {
+					continue
+				}
+				if updated := applyTextEdits(content, action.Edit.Changes[uri]); !strings.Contains(updated, tt.expected) {
+					t.Errorf("Expected the document to contain:\n%s\ngot:\n%s", tt.expected, updated)
+				}
+				return
+			}
+			t.Errorf("Expected a %q action, got %v", tt.title, titles)
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package lsp
+
+import (
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+// validateDependencyFailure checks that allow_dependency_failure is a boolean, and points out
+// allow_failure entries in depends_on that it already covers
+func (s *Server) validateDependencyFailure(pipeline *parser.Pipeline) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	root := pipeline.YAMLNode
+	if root == nil || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return diagnostics
+	}
+
+	var walkSteps func(steps *yaml.Node)
+	walkSteps = func(steps *yaml.Node) {
+		if steps == nil || steps.Kind != yaml.SequenceNode {
+			return
+		}
+		for _, step := range steps.Content {
+			if step.Kind != yaml.MappingNode {
+				continue
+			}
+			diagnostics = append(diagnostics, dependencyFailureDiagnostics(step)...)
+			walkSteps(mappingValue(step, "steps"))
+		}
+	}
+	walkSteps(mappingValue(root.Content[0], "steps"))
+
+	return diagnostics
+}
+
+// dependencyFailureDiagnostics checks a single step
+func dependencyFailureDiagnostics(step *yaml.Node) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	entry := mappingKey(step, "allow_dependency_failure")
+	if entry == nil {
+		return diagnostics
+	}
+	if entry.value.Tag != "!!bool" {
+		return append(diagnostics, nodeDiagnostic(entry.value, protocol.DiagnosticSeverityError, "invalid-allow-dependency-failure",
+			"allow_dependency_failure must be true or false"))
+	}
+	if entry.value.Value != "true" {
+		return diagnostics
+	}
+
+	dependsOn := mappingValue(step, "depends_on")
+	if dependsOn == nil || dependsOn.Kind != yaml.SequenceNode {
+		return diagnostics
+	}
+	for _, dependency := range dependsOn.Content {
+		allowFailure := mappingKey(dependency, "allow_failure")
+		if allowFailure == nil || allowFailure.value.Value != "true" {
+			continue
+		}
+		diagnostic := nodeDiagnostic(allowFailure.key, protocol.DiagnosticSeverityHint, "redundant-allow-failure",
+			"allow_failure has no effect here: allow_dependency_failure: true already lets this step run when any dependency fails")
+		diagnostic.Tags = []protocol.DiagnosticTag{protocol.DiagnosticTagUnnecessary}
+		diagnostics = append(diagnostics, diagnostic)
+	}
+
+	return diagnostics
+}
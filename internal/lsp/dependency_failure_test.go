@@ -0,0 +1,99 @@
+package lsp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+// dependencyFailureDiagnosticsFor returns the diagnostics raised for allow_dependency_failure
+func dependencyFailureDiagnosticsFor(server *Server, content string) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+	for _, diagnostic := range server.Diagnose(content) {
+		switch diagnostic.Code {
+		case "invalid-allow-dependency-failure", "redundant-allow-failure":
+			diagnostics = append(diagnostics, diagnostic)
+		}
+	}
+	return diagnostics
+}
+
+func TestServer_ValidateDependencyFailure(t *testing.T) {
+	server := newTestServer()
+
+	tests := []struct {
+		name    string
+		content string
+		code    string
+		line    uint32
+		char    uint32
+	}{
+		{
+			name:    "string value",
+			content: "steps:\n  - command: make\n    key: build\n  - command: make report\n    depends_on: build\n    allow_dependency_failure: \"yes\"\n",
+			code:    "invalid-allow-dependency-failure",
+			line:    5, char: 30,
+		},
+		{
+			name:    "allow_failure already covered",
+			content: "steps:\n  - command: make\n    key: build\n  - command: make report\n    depends_on:\n      - step: build\n        allow_failure: true\n    allow_dependency_failure: true\n",
+			code:    "redundant-allow-failure",
+			line:    6, char: 8,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diagnostics := dependencyFailureDiagnosticsFor(server, tt.content)
+			if len(diagnostics) != 1 {
+				t.Fatalf("Expected 1 diagnostic, got %+v", diagnostics)
+			}
+			got := diagnostics[0]
+			if got.Code != tt.code || got.Range.Start.Line != tt.line || got.Range.Start.Character != tt.char {
+				t.Errorf("Expected %s at %d:%d, got %v at %d:%d", tt.code, tt.line, tt.char, got.Code, got.Range.Start.Line, got.Range.Start.Character)
+			}
+		})
+	}
+
+	valid := "steps:\n  - command: make\n    key: build\n  - command: make report\n    depends_on:\n      - step: build\n        allow_failure: true\n    allow_dependency_failure: false\n"
+	if diagnostics := dependencyFailureDiagnosticsFor(server, valid); len(diagnostics) != 0 {
+		t.Errorf("Expected no diagnostics, got %+v", diagnostics)
+	}
+}
+
+func TestServer_AllowDependencyFailureDocs(t *testing.T) {
+	server := newTestServer()
+
+	var completion *protocol.CompletionItem
+	items := server.completionProvider.getStepCompletions()
+	for i := range items {
+		if items[i].Label == "allow_dependency_failure" {
+			completion = &items[i]
+		}
+	}
+	if completion == nil {
+		t.Fatal("Expected an allow_dependency_failure step completion")
+	}
+	if completion.InsertText != "allow_dependency_failure: ${1|true,false|}" {
+		t.Errorf("Unexpected insert text %q", completion.InsertText)
+	}
+
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	server.documentManager.OpenDocument(uri, 1, "steps:\n  - command: make report\n    depends_on: build\n    allow_dependency_failure: true")
+	hover, err := server.Hover(context.Background(), &protocol.HoverParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 3, Character: 10},
+		},
+	})
+	if err != nil || hover == nil {
+		t.Fatalf("Expected hover content, got %v (%v)", hover, err)
+	}
+	for _, expected := range []string{"**allow_dependency_failure**", "`depends_on.allow_failure`", "adds nothing"} {
+		if !strings.Contains(hover.Contents.Value, expected) {
+			t.Errorf("Expected hover to contain %q, got:\n%s", expected, hover.Contents.Value)
+		}
+	}
+}
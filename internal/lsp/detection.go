@@ -0,0 +1,68 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.lsp.dev/protocol"
+)
+
+// MarkPipelineMethod is the custom notification that marks an open document as a Buildkite
+// pipeline, for buffers whose URI gives no hint, such as unsaved `untitled:` buffers
+const MarkPipelineMethod = "buildkite/markPipeline"
+
+// MarkPipelineParams are the parameters of a buildkite/markPipeline notification
+type MarkPipelineParams struct {
+	URI protocol.DocumentURI `json:"uri"`
+	// Pipeline marks the document as a pipeline, or clears the mark when false
+	Pipeline bool `json:"pipeline"`
+}
+
+// MarkPipeline enables or disables pipeline features for a document regardless of its URI.
+// The mark lasts until the document is closed.
+func (s *Server) MarkPipeline(ctx context.Context, params *MarkPipelineParams) error {
+	if params.URI == "" {
+		return fmt.Errorf("uri is required")
+	}
+
+	s.setPipelineDocument(params.URI, params.Pipeline)
+
+	doc, open := s.documentManager.GetDocument(params.URI)
+	if !open {
+		return nil
+	}
+
+	if s.isBuildkiteFile(string(params.URI)) {
+		s.validateDocument(ctx, params.URI, doc.Content)
+	} else {
+		// Clear diagnostics published while the document was marked
+		s.stepResults.forget(params.URI)
+		s.sendDiagnostics(ctx, params.URI, nil)
+	}
+	return nil
+}
+
+// setPipelineDocument records whether a document was explicitly marked as a pipeline
+func (s *Server) setPipelineDocument(uri protocol.DocumentURI, pipeline bool) {
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+
+	if pipeline {
+		s.pipelineDocuments[uri] = true
+	} else {
+		delete(s.pipelineDocuments, uri)
+	}
+}
+
+// isMarkedPipeline reports whether a document was explicitly marked as a pipeline
+func (s *Server) isMarkedPipeline(uri protocol.DocumentURI) bool {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
+	return s.pipelineDocuments[uri]
+}
+
+// isUntitledURI reports whether the URI names an unsaved buffer
+func isUntitledURI(uri string) bool {
+	return strings.HasPrefix(uri, "untitled:")
+}
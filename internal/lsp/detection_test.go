@@ -0,0 +1,117 @@
+package lsp
+
+import (
+	"context"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+func TestServer_MarkPipeline(t *testing.T) {
+	server := newTestServer()
+	ctx := context.Background()
+	uri := protocol.DocumentURI("untitled:Untitled-1")
+
+	err := server.DidOpen(ctx, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: uri, LanguageID: "yaml", Version: 1, Text: "steps:\n  - command: \"make\""},
+	})
+	if err != nil {
+		t.Fatalf("DidOpen failed: %v", err)
+	}
+
+	if server.isBuildkiteFile(string(uri)) {
+		t.Fatal("Untitled buffers should not be pipelines until marked")
+	}
+
+	if err := server.MarkPipeline(ctx, &MarkPipelineParams{URI: uri, Pipeline: true}); err != nil {
+		t.Fatalf("MarkPipeline failed: %v", err)
+	}
+	if !server.isBuildkiteFile(string(uri)) {
+		t.Error("Marked buffer should be treated as a pipeline")
+	}
+
+	completions, err := server.Completion(ctx, &protocol.CompletionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 1, Character: 4},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Completion failed: %v", err)
+	}
+	if len(completions.Items) == 0 {
+		t.Error("Expected completions in a marked buffer")
+	}
+
+	if err := server.MarkPipeline(ctx, &MarkPipelineParams{URI: uri, Pipeline: false}); err != nil {
+		t.Fatalf("MarkPipeline failed: %v", err)
+	}
+	if server.isBuildkiteFile(string(uri)) {
+		t.Error("Unmarked buffer should no longer be treated as a pipeline")
+	}
+
+	// Marks don't outlive the document, since untitled names get reused
+	_ = server.MarkPipeline(ctx, &MarkPipelineParams{URI: uri, Pipeline: true})
+	_ = server.DidClose(ctx, &protocol.DidCloseTextDocumentParams{TextDocument: protocol.TextDocumentIdentifier{URI: uri}})
+	if server.isBuildkiteFile(string(uri)) {
+		t.Error("Closing a document should clear its mark")
+	}
+
+	if err := server.MarkPipeline(ctx, &MarkPipelineParams{}); err == nil {
+		t.Error("Expected an error without a URI")
+	}
+}
+
+func TestServer_UntitledPipelinesSetting(t *testing.T) {
+	server := newTestServer()
+
+	if server.isBuildkiteFile("untitled:Untitled-1") {
+		t.Error("Untitled buffers should not be pipelines by default")
+	}
+
+	settings := DefaultSettings()
+	settings.UntitledPipelines = true
+	server.applySettings(settings)
+
+	if !server.isBuildkiteFile("untitled:Untitled-1") {
+		t.Error("Expected untitled buffers to be pipelines with untitledPipelines set")
+	}
+	if server.isBuildkiteFile("file:///project/other.yml") {
+		t.Error("untitledPipelines should not affect saved files")
+	}
+}
+
+func TestServer_PipelineLanguageIDs(t *testing.T) {
+	tests := []struct {
+		name        string
+		languageIDs []string
+		languageID  protocol.LanguageIdentifier
+		expected    bool
+	}{
+		{name: "default buildkite language", languageID: "buildkite", expected: true},
+		{name: "plain yaml", languageID: "yaml", expected: false},
+		{name: "client configured language", languageIDs: []string{"buildkite-pipeline"}, languageID: "buildkite-pipeline", expected: true},
+		{name: "default replaced by client configuration", languageIDs: []string{"buildkite-pipeline"}, languageID: "buildkite", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer()
+			if tt.languageIDs != nil {
+				server.applySettings(parseSettings(map[string]interface{}{"pipelineLanguageIds": tt.languageIDs}))
+			}
+
+			uri := protocol.DocumentURI("file:///project/ci/deploy.yml")
+			err := server.DidOpen(context.Background(), &protocol.DidOpenTextDocumentParams{
+				TextDocument: protocol.TextDocumentItem{URI: uri, LanguageID: tt.languageID, Version: 1, Text: "steps:\n  - command: \"make\""},
+			})
+			if err != nil {
+				t.Fatalf("DidOpen failed: %v", err)
+			}
+
+			if got := server.isBuildkiteFile(string(uri)); got != tt.expected {
+				t.Errorf("isBuildkiteFile after opening as %q = %v, expected %v", tt.languageID, got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package lsp
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"go.lsp.dev/protocol"
+
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+// DiagnosticData is attached to every published diagnostic. Its ID names the step and the
+// rule the diagnostic came from, e.g. "build/unquoted-env-value", so it stays the same while
+// lines are added or removed around the step and clients can track a problem across edits.
+type DiagnosticData struct {
+	ID string `json:"id"`
+}
+
+// identifyDiagnostics gives each diagnostic a stable ID from the step it's in and its code.
+// Diagnostics outside any step are scoped to the pipeline, and repeats of a rule within a
+// step are numbered in document order.
+func (s *Server) identifyDiagnostics(content string, diagnostics []protocol.Diagnostic) []protocol.Diagnostic {
+	lines := splitLines(content)
+
+	var steps []interface{}
+	if pipeline, err := parser.ParseYAML([]byte(content)); err == nil {
+		var pipelineData map[string]interface{}
+		if err := json.Unmarshal(pipeline.JSONBytes, &pipelineData); err == nil {
+			steps, _ = pipelineData["steps"].([]interface{})
+		}
+	}
+
+	seen := make(map[string]int)
+	for i := range diagnostics {
+		scope := "pipeline"
+		if line := int(diagnostics[i].Range.Start.Line); steps != nil && line < len(lines) {
+			if step := s.stepRangeAt(lines, steps, line); step != nil {
+				scope = stepScope(step)
+			}
+		}
+
+		rule := fmt.Sprint(diagnostics[i].Code)
+		if diagnostics[i].Code == nil || rule == "" {
+			rule = "diagnostic"
+		}
+
+		id := scope + "/" + rule
+		seen[id]++
+		if seen[id] > 1 {
+			id = fmt.Sprintf("%s#%d", id, seen[id])
+		}
+		diagnostics[i].Data = DiagnosticData{ID: id}
+	}
+
+	return diagnostics
+}
+
+// stepScope names a step by its key, its label, or failing both its position in the pipeline
+func stepScope(step *StepRange) string {
+	if step.Key != "" {
+		return step.Key
+	}
+	if key := keyFromLabel(step.Label); key != "" {
+		return key
+	}
+
+	path := make([]string, 0, len(step.Path))
+	for _, index := range step.Path {
+		path = append(path, fmt.Sprintf("steps[%d]", index))
+	}
+	return strings.Join(path, ".")
+}
+
+// publishedDiagnostics remembers what was last published for each document, so an edit that
+// leaves the diagnostics as they were doesn't make the client redraw its problems list
+type publishedDiagnostics struct {
+	mu           sync.Mutex
+	fingerprints map[protocol.DocumentURI][sha256.Size]byte
+}
+
+func newPublishedDiagnostics() *publishedDiagnostics {
+	return &publishedDiagnostics{
+		fingerprints: make(map[protocol.DocumentURI][sha256.Size]byte),
+	}
+}
+
+// changed records the diagnostics as published, reporting whether they differ from the
+// last set published for the document
+func (p *publishedDiagnostics) changed(uri protocol.DocumentURI, diagnostics []protocol.Diagnostic) bool {
+	encoded, err := json.Marshal(diagnostics)
+	if err != nil {
+		return true
+	}
+	fingerprint := sha256.Sum256(encoded)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if last, ok := p.fingerprints[uri]; ok && last == fingerprint {
+		return false
+	}
+	p.fingerprints[uri] = fingerprint
+	return true
+}
+
+// forget drops what was published for a document, so it is published again when reopened
+func (p *publishedDiagnostics) forget(uri protocol.DocumentURI) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.fingerprints, uri)
+}
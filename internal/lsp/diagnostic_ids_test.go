@@ -0,0 +1,153 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"go.lsp.dev/jsonrpc2"
+	"go.lsp.dev/protocol"
+)
+
+// diagnosticIDs returns the IDs identifyDiagnostics gives the content's diagnostics, by code
+func diagnosticIDs(server *Server, content string) map[string][]string {
+	ids := make(map[string][]string)
+	for _, diagnostic := range server.identifyDiagnostics(content, server.Diagnose(content)) {
+		data, ok := diagnostic.Data.(DiagnosticData)
+		if !ok {
+			continue
+		}
+		code, _ := diagnostic.Code.(string)
+		ids[code] = append(ids[code], data.ID)
+	}
+	return ids
+}
+
+func TestServer_IdentifyDiagnostics(t *testing.T) {
+	server := newTestServer()
+
+	content := `env:
+  DEBUG: true
+steps:
+  - label: "Build"
+    key: "build"
+    command: make
+    env:
+      GO_VERSION: 1.10
+      RETRIES: 3
+  - label: ":rocket: Deploy"
+    command: make deploy
+    env:
+      DRY_RUN: false
+  - command: make test
+    env:
+      CI: true`
+
+	ids := diagnosticIDs(server, content)
+	expected := []string{
+		"pipeline/unquoted-env-value",
+		"build/unquoted-env-value",
+		"build/unquoted-env-value#2",
+		"deploy/unquoted-env-value",
+		"steps[2]/unquoted-env-value",
+	}
+	got := ids["unquoted-env-value"]
+	if len(got) != len(expected) {
+		t.Fatalf("Expected IDs %v, got %v", expected, got)
+	}
+	for i, id := range expected {
+		if got[i] != id {
+			t.Errorf("ID %d: expected %q, got %q", i, id, got[i])
+		}
+	}
+
+	// Lines added above a step move its diagnostics without changing their IDs
+	moved := diagnosticIDs(server, "# Comment\n\n"+content)
+	for i, id := range expected {
+		if moved["unquoted-env-value"][i] != id {
+			t.Errorf("ID %d changed to %q when lines were added", i, moved["unquoted-env-value"][i])
+		}
+	}
+}
+
+func TestPublishedDiagnostics_Changed(t *testing.T) {
+	published := newPublishedDiagnostics()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	diagnostics := []protocol.Diagnostic{{Message: "Step is missing a label", Code: "missing-label"}}
+
+	if !published.changed(uri, diagnostics) {
+		t.Error("Expected the first set to be published")
+	}
+	if published.changed(uri, []protocol.Diagnostic{{Message: "Step is missing a label", Code: "missing-label"}}) {
+		t.Error("Expected an identical set not to be published again")
+	}
+	if !published.changed(uri, []protocol.Diagnostic{}) {
+		t.Error("Expected clearing the diagnostics to be published")
+	}
+
+	published.forget(uri)
+	if !published.changed(uri, []protocol.Diagnostic{}) {
+		t.Error("Expected a forgotten document to be published again")
+	}
+}
+
+func TestServer_UnchangedDiagnosticsNotRepublished(t *testing.T) {
+	server := newTestServer()
+	ctx := context.Background()
+
+	serverSide, clientSide := net.Pipe()
+	defer serverSide.Close()
+	defer clientSide.Close()
+
+	published := make(chan protocol.PublishDiagnosticsParams, 4)
+	client := jsonrpc2.NewConn(jsonrpc2.NewStream(clientSide))
+	client.Go(ctx, func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		if req.Method() == "textDocument/publishDiagnostics" {
+			var params protocol.PublishDiagnosticsParams
+			if err := json.Unmarshal(req.Params(), &params); err == nil {
+				published <- params
+			}
+		}
+		return reply(ctx, nil, nil)
+	})
+	conn := jsonrpc2.NewConn(jsonrpc2.NewStream(serverSide))
+	conn.Go(ctx, jsonrpc2.MethodNotFoundHandler)
+	server.SetConnection(conn)
+
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	content := "steps:\n  - key: build\n    command: make\n    env:\n      DEBUG: true\n"
+	expectPublished := func(want bool) {
+		t.Helper()
+		select {
+		case params := <-published:
+			if !want {
+				t.Fatalf("Expected no diagnostics to be published, got %+v", params.Diagnostics)
+			}
+			if len(params.Diagnostics) == 0 {
+				return
+			}
+			raw, _ := json.Marshal(params.Diagnostics[0].Data)
+			var data DiagnosticData
+			if err := json.Unmarshal(raw, &data); err != nil || !strings.HasPrefix(data.ID, "build/") {
+				t.Errorf("Expected the diagnostic to carry its ID, got %s", raw)
+			}
+		case <-time.After(200 * time.Millisecond):
+			if want {
+				t.Fatal("Expected diagnostics to be published")
+			}
+		}
+	}
+
+	server.validateDocument(ctx, uri, content)
+	expectPublished(true)
+
+	// A change that leaves the diagnostics as they were, e.g. to a command
+	server.validateDocument(ctx, uri, strings.Replace(content, "make", "make all", 1))
+	expectPublished(false)
+
+	server.validateDocument(ctx, uri, strings.Replace(content, "true", `"true"`, 1))
+	expectPublished(true)
+}
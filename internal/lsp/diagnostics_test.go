@@ -1,6 +1,8 @@
 package lsp
 
 import (
+	"slices"
+	"strings"
 	"testing"
 
 	"go.lsp.dev/protocol"
@@ -224,6 +226,237 @@ steps:
 					Code:     "use-label-not-name",
 					Severity: protocol.DiagnosticSeverityInformation,
 					Message:  "Use 'label' instead of 'name' - 'label' is the standard Buildkite field for step display names",
+					Tags:     []protocol.DiagnosticTag{protocol.DiagnosticTagDeprecated},
+				},
+			},
+		},
+		{
+			name: "valid group step",
+			content: `steps:
+  - group: "Tests"
+    key: "tests"
+    depends_on: "build"
+    steps:
+      - label: "Unit"
+        key: "unit"
+        command: "make unit"`,
+			expectedDiagnostics: []ExpectedDiagnostic{},
+		},
+		{
+			name: "group step with step-only keys",
+			content: `steps:
+  - group: "Tests"
+    agents:
+      queue: "default"
+    timeout_in_minutes: 10
+    steps:
+      - label: "Unit"
+        command: "make unit"`,
+			expectedDiagnostics: []ExpectedDiagnostic{
+				{
+					Code:     "invalid-group-key",
+					Severity: protocol.DiagnosticSeverityError,
+					Message:  "Group step 1 cannot use 'agents' - set it on the steps inside the group instead",
+				},
+				{
+					Code:     "invalid-group-key",
+					Severity: protocol.DiagnosticSeverityError,
+					Message:  "Group step 1 cannot use 'timeout_in_minutes' - set it on the steps inside the group instead",
+				},
+			},
+		},
+		{
+			name: "group step with the schema's key aliases",
+			content: `steps:
+  - group: "Tests"
+    name: "Tests"
+    id: "tests"
+    identifier: "tests"
+    steps:
+      - label: "Unit"
+        command: "make unit"`,
+			expectedDiagnostics: []ExpectedDiagnostic{},
+		},
+		{
+			name: "group step with colliding nested key",
+			content: `steps:
+  - group: "Tests"
+    key: "tests"
+    steps:
+      - label: "Unit"
+        key: "tests"
+        command: "make unit"`,
+			expectedDiagnostics: []ExpectedDiagnostic{
+				{
+					Code:     "group-key-collision",
+					Severity: protocol.DiagnosticSeverityError,
+					Message:  "Step inside group 1 uses key 'tests', which is already used by the group",
+				},
+			},
+		},
+		{
+			name: "group step with nested key colliding through an alias",
+			content: `steps:
+  - group: "Tests"
+    id: "tests"
+    steps:
+      - label: "Unit"
+        identifier: "tests"
+        command: "make unit"
+      - label: "Lint"
+        key: "lint"
+        command: "make lint"`,
+			expectedDiagnostics: []ExpectedDiagnostic{
+				{
+					Code:     "group-key-collision",
+					Severity: protocol.DiagnosticSeverityError,
+					Message:  "Step inside group 1 uses key 'tests', which is already used by the group",
+				},
+			},
+		},
+		{
+			name: "group step with nested key colliding as a number",
+			content: `steps:
+  - group: "Tests"
+    key: 1
+    steps:
+      - label: "Unit"
+        key: "1"
+        command: "make unit"`,
+			expectedDiagnostics: []ExpectedDiagnostic{
+				{
+					Code:     "group-key-collision",
+					Severity: protocol.DiagnosticSeverityError,
+					Message:  "Step inside group 1 uses key '1', which is already used by the group",
+				},
+			},
+		},
+		{
+			name: "valid notify at both levels",
+			content: `notify:
+  - email: "dev@example.com"
+  - webhook: "https://example.com/hook"
+steps:
+  - label: "Build"
+    command: "make build"
+    notify:
+      - slack: "#builds"
+      - github_commit_status:
+          context: "build"`,
+			expectedDiagnostics: []ExpectedDiagnostic{},
+		},
+		{
+			name: "pipeline-only notify on a step",
+			content: `steps:
+  - label: "Build"
+    command: "make build"
+    notify:
+      - email: "dev@example.com"
+        if: build.state == "failed"`,
+			expectedDiagnostics: []ExpectedDiagnostic{
+				{
+					Code:     "pipeline-only-notify",
+					Severity: protocol.DiagnosticSeverityError,
+					Message:  "Step 1 cannot use 'email' notifications - move it to the pipeline-level notify",
+				},
+			},
+		},
+		{
+			name: "unknown pipeline notify type",
+			content: `notify:
+  - teams: "builds"
+steps:
+  - label: "Build"
+    command: "make build"`,
+			expectedDiagnostics: []ExpectedDiagnostic{
+				{
+					Code:     "unknown-notify-type",
+					Severity: protocol.DiagnosticSeverityWarning,
+					Message:  "Unknown notification type 'teams' - expected one of: slack, email, webhook, pagerduty_change_event, github_commit_status, github_check, basecamp_campfire",
+				},
+			},
+		},
+		{
+			name: "step timeouts against the pipeline default",
+			content: `timeout_in_minutes: 30
+steps:
+  - label: "Build"
+    command: "make build"
+    timeout_in_minutes: 60
+  - label: "Test"
+    command: "make test"
+    timeout_in_minutes: 30
+  - label: "Lint"
+    command: "make lint"
+    timeout_in_minutes: 0`,
+			expectedDiagnostics: []ExpectedDiagnostic{
+				{
+					Code:     "timeout-exceeds-default",
+					Severity: protocol.DiagnosticSeverityWarning,
+					Message:  "Step 1 timeout of 60 minutes exceeds the pipeline default of 30 minutes",
+				},
+				{
+					Code:     "redundant-timeout",
+					Severity: protocol.DiagnosticSeverityHint,
+					Message:  "Step 2 timeout matches the pipeline default of 30 minutes and can be removed",
+					Tags:     []protocol.DiagnosticTag{protocol.DiagnosticTagUnnecessary},
+				},
+				{
+					Code:     "invalid-timeout",
+					Severity: protocol.DiagnosticSeverityError,
+					Message:  "Step 3 timeout_in_minutes must be a positive number of minutes, got 0",
+				},
+			},
+		},
+		{
+			name: "no-op wait steps",
+			content: `steps:
+  - wait: ~
+  - label: "Build"
+    command: "make build"
+  - wait: ~
+  - wait
+  - label: "Test"
+    command: "make test"
+  - wait: ~`,
+			expectedDiagnostics: []ExpectedDiagnostic{
+				{
+					Code:     "noop-wait",
+					Severity: protocol.DiagnosticSeverityHint,
+					Message:  "Wait step 1 has no effect - it is the first step, so there is nothing to wait for",
+					Tags:     []protocol.DiagnosticTag{protocol.DiagnosticTagUnnecessary},
+				},
+				{
+					Code:     "noop-wait",
+					Severity: protocol.DiagnosticSeverityHint,
+					Message:  "Wait step 4 has no effect - it directly follows another wait step",
+					Tags:     []protocol.DiagnosticTag{protocol.DiagnosticTagUnnecessary},
+				},
+				{
+					Code:     "noop-wait",
+					Severity: protocol.DiagnosticSeverityHint,
+					Message:  "Wait step 6 has no effect - it is the last step, so nothing runs after it",
+					Tags:     []protocol.DiagnosticTag{protocol.DiagnosticTagUnnecessary},
+				},
+			},
+		},
+		{
+			name: "step env duplicating the pipeline env",
+			content: `env:
+  NODE_ENV: production
+  DEBUG: "false"
+steps:
+  - label: "Build"
+    command: "make build"
+    env:
+      NODE_ENV: production
+      DEBUG: "true"`,
+			expectedDiagnostics: []ExpectedDiagnostic{
+				{
+					Code:     "redundant-env",
+					Severity: protocol.DiagnosticSeverityHint,
+					Message:  "Step 1 sets NODE_ENV to the same value as the pipeline env",
+					Tags:     []protocol.DiagnosticTag{protocol.DiagnosticTagUnnecessary},
 				},
 			},
 		},
@@ -275,6 +508,10 @@ steps:
 					t.Errorf("Diagnostic %d: expected message %q, got %q", i, expected.Message, actual.Message)
 				}
 
+				if expected.Tags != nil && !slices.Equal(actual.Tags, expected.Tags) {
+					t.Errorf("Diagnostic %d: expected tags %v, got %v", i, expected.Tags, actual.Tags)
+				}
+
 				if actual.Source != "buildkite-ls" {
 					t.Errorf("Diagnostic %d: expected source 'buildkite-ls', got %q", i, actual.Source)
 				}
@@ -342,8 +579,60 @@ func TestServer_DiagnosticsHelpers(t *testing.T) {
 	})
 }
 
+func TestServer_SyntaxErrorDiagnostics(t *testing.T) {
+	server := newTestServer()
+
+	content := "steps:\n  - label: \"Build\"\n\t  command: make\n"
+	_, err := parser.ParseYAML([]byte(content))
+	if err == nil {
+		t.Fatal("Expected parse error")
+	}
+
+	diagnostics := server.syntaxErrorDiagnostics(err, content)
+	if len(diagnostics) != 1 {
+		t.Fatalf("Expected 1 diagnostic, got %d", len(diagnostics))
+	}
+
+	diagnostic := diagnostics[0]
+	if diagnostic.Code != "yaml-syntax-error" {
+		t.Errorf("Expected code yaml-syntax-error, got %v", diagnostic.Code)
+	}
+
+	if diagnostic.Range.Start.Line != 2 {
+		t.Errorf("Expected diagnostic on line 2, got %d", diagnostic.Range.Start.Line)
+	}
+
+	if diagnostic.Range.End.Character != uint32(len("\t  command: make")) {
+		t.Errorf("Expected diagnostic to span the line, got end %d", diagnostic.Range.End.Character)
+	}
+
+	if !strings.Contains(diagnostic.Message, "unexpected tab character") {
+		t.Errorf("Expected tab hint in message, got %q", diagnostic.Message)
+	}
+}
+
 type ExpectedDiagnostic struct {
 	Code     string
 	Severity protocol.DiagnosticSeverity
 	Message  string
+	Tags     []protocol.DiagnosticTag
+}
+
+func TestServer_UnknownSchemaPropertySeverity(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+
+	diagnostics := server.diagnose(uri, "steps:\n  - label: Build\n    command: make\n    not_a_step_key: true\n")
+	if len(diagnostics) == 0 || !strings.Contains(diagnostics[0].Message, "not_a_step_key") {
+		t.Fatalf("Expected a schema error about the unknown key, got %+v", diagnostics)
+	}
+
+	// Until the schema is vendored it may leave out keys Buildkite accepts
+	expected := protocol.DiagnosticSeverityError
+	if !server.schemaLoader.Version().Vendored() {
+		expected = protocol.DiagnosticSeverityWarning
+	}
+	if diagnostics[0].Severity != expected {
+		t.Errorf("Expected severity %v for the unknown key, got %v", expected, diagnostics[0].Severity)
+	}
 }
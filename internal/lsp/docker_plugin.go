@@ -0,0 +1,288 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+
+	bkcontext "github.com/mcncl/buildkite-ls/internal/context"
+	"github.com/mcncl/buildkite-ls/internal/parser"
+	"github.com/mcncl/buildkite-ls/internal/plugins"
+)
+
+// dockerPluginOption is one of the docker plugin's most used options, documented beyond the
+// plugin schema's one-line descriptions
+type dockerPluginOption struct {
+	Docs    string
+	Snippet string
+}
+
+// dockerPluginOptions are the docker plugin options with curated docs, by name
+var dockerPluginOptions = map[string]dockerPluginOption{
+	"image": {
+		Docs:    "**image** - Docker image to run the command in\n\nPulled when the agent doesn't have it, or on every run with `always-pull`.\n\nExample: `image: \"node:20\"`",
+		Snippet: "image: \"${1:node:20}\"",
+	},
+	"environment": {
+		Docs: "**environment** - Environment variables passed into the container\n\n" +
+			"A list of `KEY=value` entries, or `KEY` to pass the variable through from the job. The step's `env` isn't passed into the container unless it's listed here or `propagate-environment` is on.\n\n" +
+			"Values are interpolated when the pipeline is uploaded: write `$$VAR` to read a variable when the job runs.\n\n" +
+			"Example:\n```yaml\nenvironment:\n  - NODE_ENV=test\n  - NPM_TOKEN\n```",
+		Snippet: "environment:\n  - ${1:KEY}",
+	},
+	"propagate-environment": {
+		Docs:    "**propagate-environment** - Pass the job's environment into the container\n\nDefaults to `false`. With `true`, every variable the job has, including the step's and pipeline's `env` and the `BUILDKITE_*` variables, is available in the container without listing it in `environment`.\n\nExample: `propagate-environment: true`",
+		Snippet: "propagate-environment: ${1|true,false|}",
+	},
+	"mount-checkout": {
+		Docs:    "**mount-checkout** - Mount the checkout into the container\n\nDefaults to `true`: the repository the agent checked out is mounted at `workdir`, so the command sees the source and the files it writes stay on the agent. Set `false` for images that bring everything they need.\n\nExample: `mount-checkout: false`",
+		Snippet: "mount-checkout: ${1|true,false|}",
+	},
+	"workdir": {
+		Docs:    "**workdir** - Working directory inside the container\n\nAn absolute path in the container, `/workdir` by default (`C:\\workdir` on Windows). The checkout is mounted here unless `mount-checkout` is `false`.\n\nExample: `workdir: /app`",
+		Snippet: "workdir: ${1:/app}",
+	},
+	"volumes": {
+		Docs:    "**volumes** - Extra volumes mounted into the container\n\nEach entry is `source:target`, with an optional `:ro`. Relative sources are relative to the checkout.\n\nExample:\n```yaml\nvolumes:\n  - \"./cache:/cache\"\n  - \"/var/run/docker.sock:/var/run/docker.sock\"\n```",
+		Snippet: "volumes:\n  - \"${1:./cache}:${2:/cache}\"",
+	},
+	"always-pull": {
+		Docs:    "**always-pull** - Pull the image before every run\n\nDefaults to `false`, so agents reuse the copy they have. Turn it on for tags such as `latest` that move.\n\nExample: `always-pull: true`",
+		Snippet: "always-pull: ${1|true,false|}",
+	},
+	"mount-buildkite-agent": {
+		Docs:    "**mount-buildkite-agent** - Make `buildkite-agent` available in the container\n\nDefaults to `false` on Linux. Turn it on to upload artifacts, set meta-data or annotate from inside the container.\n\nExample: `mount-buildkite-agent: true`",
+		Snippet: "mount-buildkite-agent: ${1|true,false|}",
+	},
+}
+
+// dockerPluginBooleans are the docker plugin options that only take true or false
+var dockerPluginBooleans = []string{
+	"always-pull",
+	"init",
+	"mount-buildkite-agent",
+	"mount-checkout",
+	"mount-ssh-agent",
+	"privileged",
+	"propagate-aws-auth-tokens",
+	"propagate-environment",
+	"propagate-uid-gid",
+	"tty",
+}
+
+var (
+	// envVarNamePattern matches the names of environment variables
+	envVarNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// windowsPathPattern matches absolute Windows paths, which Windows containers take
+	windowsPathPattern = regexp.MustCompile(`^[A-Za-z]:[\\/]`)
+)
+
+// isDockerPlugin reports whether a plugin reference is the docker plugin, under any alias
+func isDockerPlugin(registry *plugins.Registry, ref string) bool {
+	parsed := plugins.ParsePluginReference(registry.ResolveAlias(ref))
+	return parsed != nil && parsed.Org == "buildkite-plugins" && parsed.Name == "docker"
+}
+
+// getDockerPluginCompletions offers the docker plugin's options with their curated docs and
+// snippets, along with any others its schema has, even when the schema can't be fetched.
+// Inside environment, it offers the step's and pipeline's env, which the container doesn't
+// get otherwise.
+func (cp *CompletionProvider) getDockerPluginCompletions(ctx context.Context, posCtx *bkcontext.PositionContext, contextInfo *bkcontext.ContextInfo) []protocol.CompletionItem {
+	items := []protocol.CompletionItem{}
+	if len(contextInfo.ParentKeys) == 0 {
+		return items
+	}
+	switch contextInfo.ParentKeys[len(contextInfo.ParentKeys)-1] {
+	case "environment":
+		return dockerEnvironmentCompletions(posCtx)
+	case contextInfo.PluginName:
+	default:
+		return items
+	}
+
+	if schema, err := cp.pluginRegistry.GetPluginSchema(ctx, contextInfo.PluginName); err == nil && schema.Configuration != nil {
+		items = cp.generateCompletionsFromSchema(schema, contextInfo.PluginName, contextInfo.IndentLevel)
+	}
+
+	offered := make(map[string]bool)
+	for i, item := range items {
+		option, ok := dockerPluginOptions[item.Label]
+		if !ok {
+			continue
+		}
+		offered[item.Label] = true
+		items[i].Documentation = &protocol.MarkupContent{Kind: protocol.Markdown, Value: option.Docs}
+		items[i].InsertText = option.Snippet
+		items[i].InsertTextFormat = protocol.InsertTextFormatSnippet
+	}
+	for _, name := range slices.Sorted(maps.Keys(dockerPluginOptions)) {
+		if offered[name] {
+			continue
+		}
+		option := dockerPluginOptions[name]
+		detail, _, _ := strings.Cut(strings.TrimPrefix(option.Docs, "**"+name+"** - "), "\n")
+		items = append(items, protocol.CompletionItem{
+			Label:            name,
+			Kind:             protocol.CompletionItemKindProperty,
+			Detail:           detail,
+			Documentation:    &protocol.MarkupContent{Kind: protocol.Markdown, Value: option.Docs},
+			InsertText:       option.Snippet,
+			InsertTextFormat: protocol.InsertTextFormatSnippet,
+			SortText:         "1-" + name,
+		})
+	}
+	return items
+}
+
+// dockerEnvironmentCompletions offers the variables the step's and pipeline's env set, to
+// pass through into the container
+func dockerEnvironmentCompletions(posCtx *bkcontext.PositionContext) []protocol.CompletionItem {
+	items := []protocol.CompletionItem{}
+	if !strings.HasPrefix(strings.TrimSpace(posCtx.CurrentLine), "-") {
+		return items
+	}
+
+	edit, step := stepEditOf(splitLines(posCtx.FullContent), int(posCtx.Position.Line))
+	if edit == nil {
+		return items
+	}
+	names := envNames(mappingValue(edit.root, "env"))
+	maps.Copy(names, envNames(mappingValue(step, "env")))
+
+	for _, name := range slices.Sorted(maps.Keys(names)) {
+		items = append(items, protocol.CompletionItem{
+			Label:  name,
+			Kind:   protocol.CompletionItemKindVariable,
+			Detail: "Pass " + name + " through from the job",
+			Documentation: &protocol.MarkupContent{Kind: protocol.Markdown,
+				Value: fmt.Sprintf("Set to `%s` by `env`, which isn't passed into the container unless it's listed.", names[name])},
+		})
+	}
+	return items
+}
+
+// getDockerPluginHoverContent documents the docker plugin's options with their curated docs
+func (s *Server) getDockerPluginHoverContent(posCtx *bkcontext.PositionContext, currentWord string, contextInfo *bkcontext.ContextInfo) string {
+	if contextInfo.Type != bkcontext.ContextPluginConfig || yamlKey(posCtx.CurrentLine) != currentWord || len(contextInfo.ParentKeys) == 0 ||
+		contextInfo.ParentKeys[len(contextInfo.ParentKeys)-1] != contextInfo.PluginName || !isDockerPlugin(s.pluginRegistry, contextInfo.PluginName) {
+		return ""
+	}
+	return dockerPluginOptions[currentWord].Docs
+}
+
+// validateDockerPlugins checks the docker plugin options whose mistakes are most common:
+// environment entries, options that only take booleans, and a workdir that isn't absolute.
+// The plugin's schema catches some of these without saying where, and only once fetched.
+func (s *Server) validateDockerPlugins(pipeline *parser.Pipeline) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	root := pipeline.YAMLNode
+	if root == nil || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return diagnostics
+	}
+
+	var walkSteps func(steps *yaml.Node)
+	walkSteps = func(steps *yaml.Node) {
+		if steps == nil || steps.Kind != yaml.SequenceNode {
+			return
+		}
+		for _, step := range steps.Content {
+			if step.Kind != yaml.MappingNode {
+				continue
+			}
+			pluginList := mappingValue(step, "plugins")
+			if pluginList != nil && pluginList.Kind == yaml.SequenceNode {
+				for _, plugin := range pluginList.Content {
+					if plugin.Kind != yaml.MappingNode || len(plugin.Content) < 2 || plugin.Content[1].Kind != yaml.MappingNode {
+						continue
+					}
+					if isDockerPlugin(s.pluginRegistry, plugin.Content[0].Value) {
+						diagnostics = append(diagnostics, dockerPluginDiagnostics(plugin.Content[1])...)
+					}
+				}
+			}
+			walkSteps(mappingValue(step, "steps"))
+		}
+	}
+	walkSteps(mappingValue(root.Content[0], "steps"))
+
+	return diagnostics
+}
+
+// dockerPluginDiagnostics checks the config of a single use of the docker plugin
+func dockerPluginDiagnostics(config *yaml.Node) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	for _, name := range dockerPluginBooleans {
+		value := mappingValue(config, name)
+		if value == nil || (value.Kind == yaml.ScalarNode && value.Tag == "!!bool") {
+			continue
+		}
+		message := fmt.Sprintf("The docker plugin's %s must be true or false", name)
+		if value.Kind == yaml.ScalarNode && (value.Value == "true" || value.Value == "false") {
+			message = fmt.Sprintf("The docker plugin's %s %q is a string. Remove the quotes to make it a boolean", name, value.Value)
+		}
+		diagnostics = append(diagnostics, nodeDiagnostic(value, protocol.DiagnosticSeverityError, "invalid-docker-option", message))
+	}
+
+	if workdir := mappingValue(config, "workdir"); workdir != nil && workdir.Kind == yaml.ScalarNode && !isImplicitNull(workdir) &&
+		!strings.HasPrefix(workdir.Value, "/") && !windowsPathPattern.MatchString(workdir.Value) && !strings.Contains(workdir.Value, "$") {
+		diagnostics = append(diagnostics, nodeDiagnostic(workdir, protocol.DiagnosticSeverityError, "invalid-docker-option",
+			fmt.Sprintf("The docker plugin's workdir %q must be an absolute path inside the container, e.g. /%s", workdir.Value, strings.TrimPrefix(workdir.Value, "./"))))
+	}
+
+	return append(diagnostics, dockerEnvironmentDiagnostics(mappingValue(config, "environment"))...)
+}
+
+// dockerEnvironmentDiagnostics checks that environment is a list of KEY or KEY=value
+// entries, naming each variable once
+func dockerEnvironmentDiagnostics(environment *yaml.Node) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+	if environment == nil {
+		return diagnostics
+	}
+
+	if environment.Kind != yaml.SequenceNode {
+		message := "The docker plugin's environment must be a list of KEY or KEY=value entries"
+		if environment.Kind == yaml.MappingNode {
+			message += ", not a mapping like env: write `- KEY=value` for each variable"
+		}
+		return append(diagnostics, nodeDiagnostic(environment, protocol.DiagnosticSeverityError, "invalid-docker-environment", message))
+	}
+
+	seen := make(map[string]int)
+	for _, entry := range environment.Content {
+		if entry.Kind == yaml.MappingNode && len(entry.Content) == 2 {
+			// `- KEY: value` parses as a mapping rather than the KEY=value string it looks like
+			diagnostics = append(diagnostics, nodeDiagnostic(entry, protocol.DiagnosticSeverityError, "invalid-docker-environment",
+				fmt.Sprintf("Environment entries are strings: write %s=%s", entry.Content[0].Value, entry.Content[1].Value)))
+			continue
+		}
+		if entry.Kind != yaml.ScalarNode || isImplicitNull(entry) {
+			diagnostics = append(diagnostics, nodeDiagnostic(entry, protocol.DiagnosticSeverityError, "invalid-docker-environment",
+				"Environment entries must be KEY or KEY=value"))
+			continue
+		}
+
+		name, _, _ := strings.Cut(entry.Value, "=")
+		if !envVarNamePattern.MatchString(name) && !strings.Contains(name, "$") {
+			diagnostics = append(diagnostics, nodeDiagnostic(entry, protocol.DiagnosticSeverityError, "invalid-docker-environment",
+				fmt.Sprintf("'%s' isn't a valid environment variable name: use letters, digits and underscores, not starting with a digit", name)))
+			continue
+		}
+		if line, duplicate := seen[name]; duplicate {
+			diagnostics = append(diagnostics, nodeDiagnostic(entry, protocol.DiagnosticSeverityWarning, "invalid-docker-environment",
+				fmt.Sprintf("%s is already set on line %d; the container gets the last value", name, line)))
+			continue
+		}
+		seen[name] = entry.Line
+	}
+
+	return diagnostics
+}
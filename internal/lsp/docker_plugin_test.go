@@ -0,0 +1,218 @@
+package lsp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+
+	"github.com/mcncl/buildkite-ls/internal/plugins"
+)
+
+// dockerPluginTestDiagnostics returns the diagnostics raised for docker plugin options
+func dockerPluginTestDiagnostics(server *Server, content string) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+	for _, diagnostic := range server.Diagnose(content) {
+		switch diagnostic.Code {
+		case "invalid-docker-option", "invalid-docker-environment":
+			diagnostics = append(diagnostics, diagnostic)
+		}
+	}
+	return diagnostics
+}
+
+func TestServer_ValidateDockerPlugins(t *testing.T) {
+	server := newTestServer()
+	server.pluginRegistry.CacheSchema("docker#v5.13.0", &plugins.PluginSchema{Name: "Docker"})
+
+	tests := []struct {
+		name     string
+		config   string
+		code     string
+		line     uint32
+		char     uint32
+		severity protocol.DiagnosticSeverity
+		message  string
+	}{
+		{
+			name:   "environment written like env",
+			config: "environment:\n            NODE_ENV: test",
+			code:   "invalid-docker-environment",
+			line:   5, char: 12,
+			severity: protocol.DiagnosticSeverityError,
+			message:  "not a mapping like env",
+		},
+		{
+			name:   "environment entry written as a mapping",
+			config: "environment:\n            - NODE_ENV: test",
+			code:   "invalid-docker-environment",
+			line:   5, char: 14,
+			severity: protocol.DiagnosticSeverityError,
+			message:  "write NODE_ENV=test",
+		},
+		{
+			name:   "environment entry with an invalid name",
+			config: "environment:\n            - 1PASSWORD=x",
+			code:   "invalid-docker-environment",
+			line:   5, char: 14,
+			severity: protocol.DiagnosticSeverityError,
+			message:  "'1PASSWORD' isn't a valid environment variable name",
+		},
+		{
+			name:   "environment variable listed twice",
+			config: "environment:\n            - NODE_ENV=test\n            - NODE_ENV=production",
+			code:   "invalid-docker-environment",
+			line:   6, char: 14,
+			severity: protocol.DiagnosticSeverityWarning,
+			message:  "NODE_ENV is already set on line 6",
+		},
+		{
+			name:   "quoted boolean",
+			config: "propagate-environment: \"true\"",
+			code:   "invalid-docker-option",
+			line:   4, char: 33,
+			severity: protocol.DiagnosticSeverityError,
+			message:  "Remove the quotes",
+		},
+		{
+			name:   "boolean that isn't true or false",
+			config: "mount-checkout: yes please",
+			code:   "invalid-docker-option",
+			line:   4, char: 26,
+			severity: protocol.DiagnosticSeverityError,
+			message:  "mount-checkout must be true or false",
+		},
+		{
+			name:   "relative workdir",
+			config: "workdir: ./app",
+			code:   "invalid-docker-option",
+			line:   4, char: 19,
+			severity: protocol.DiagnosticSeverityError,
+			message:  "must be an absolute path inside the container, e.g. /app",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := "steps:\n  - command: make test\n    plugins:\n      - docker#v5.13.0:\n          " + tt.config + "\n"
+
+			diagnostics := dockerPluginTestDiagnostics(server, content)
+			if len(diagnostics) != 1 {
+				t.Fatalf("Expected 1 docker plugin diagnostic, got %+v", diagnostics)
+			}
+
+			got := diagnostics[0]
+			if got.Code != tt.code || got.Severity != tt.severity {
+				t.Errorf("Expected %s at severity %v, got %v at %v", tt.code, tt.severity, got.Code, got.Severity)
+			}
+			if got.Range.Start.Line != tt.line || got.Range.Start.Character != tt.char {
+				t.Errorf("Expected %d:%d, got %d:%d", tt.line, tt.char, got.Range.Start.Line, got.Range.Start.Character)
+			}
+			if !strings.Contains(got.Message, tt.message) {
+				t.Errorf("Expected message containing %q, got %q", tt.message, got.Message)
+			}
+		})
+	}
+}
+
+func TestServer_ValidateDockerPlugins_Valid(t *testing.T) {
+	server := newTestServer()
+	server.pluginRegistry.CacheSchema("docker#v5.13.0", &plugins.PluginSchema{Name: "Docker"})
+
+	content := `steps:
+  - group: Tests
+    steps:
+      - command: make test
+        plugins:
+          - docker#v5.13.0:
+              image: node:20
+              environment:
+                - NODE_ENV=test
+                - NPM_TOKEN
+                - ${EXTRA_VAR}
+              propagate-environment: true
+              mount-checkout: false
+              workdir: $BUILDKITE_BUILD_CHECKOUT_PATH
+  - command: build.bat
+    plugins:
+      - docker#v5.13.0:
+          image: mcr.microsoft.com/windows/servercore
+          workdir: C:\app
+  - command: make
+    plugins:
+      - my-org/docker#v1.0.0:
+          workdir: relative`
+
+	if diagnostics := dockerPluginTestDiagnostics(server, content); len(diagnostics) != 0 {
+		t.Errorf("Expected no docker plugin diagnostics, got %+v", diagnostics)
+	}
+}
+
+func TestCompletionProvider_DockerPluginOptions(t *testing.T) {
+	provider := newTestCompletionProvider()
+	provider.pluginRegistry.CacheSchema("docker#v5.13.0", &plugins.PluginSchema{
+		Name: "Docker",
+		Configuration: map[string]any{
+			"properties": map[string]any{
+				"image":   map[string]any{"type": "string", "description": "The image to use"},
+				"network": map[string]any{"type": "string", "description": "Network to join"},
+			},
+		},
+	})
+
+	completions := provider.GetCompletions(blockStepPositionContext("steps:\n  - command: make\n    plugins:\n      - docker#v5.13.0:\n          "))
+
+	byLabel := make(map[string]protocol.CompletionItem)
+	for _, completion := range completions {
+		byLabel[completion.Label] = completion
+	}
+	for _, label := range []string{"image", "network", "environment", "propagate-environment", "mount-checkout", "workdir"} {
+		if _, ok := byLabel[label]; !ok {
+			t.Errorf("Expected %s among the docker plugin's options, got %+v", label, completions)
+		}
+	}
+
+	image := byLabel["image"]
+	if docs, ok := image.Documentation.(*protocol.MarkupContent); !ok || !strings.Contains(docs.Value, "always-pull") {
+		t.Errorf("Expected the schema's image option to have the curated docs, got %+v", image.Documentation)
+	}
+	if image.InsertText != dockerPluginOptions["image"].Snippet {
+		t.Errorf("Expected the curated image snippet, got %q", image.InsertText)
+	}
+}
+
+func TestCompletionProvider_DockerEnvironmentNames(t *testing.T) {
+	provider := newTestCompletionProvider()
+	provider.pluginRegistry.CacheSchema("docker#v5.13.0", &plugins.PluginSchema{Name: "Docker"})
+
+	content := "env:\n  REGION: us-east-1\nsteps:\n  - command: make\n    env:\n      NODE_ENV: test\n    plugins:\n      - docker#v5.13.0:\n          environment:\n            - "
+
+	var labels []string
+	for _, completion := range provider.GetCompletions(blockStepPositionContext(content)) {
+		labels = append(labels, completion.Label)
+	}
+	if expected := []string{"NODE_ENV", "REGION"}; strings.Join(labels, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v offered in environment, got %v", expected, labels)
+	}
+}
+
+func TestServer_DockerPluginHover(t *testing.T) {
+	server := newTestServer()
+	server.pluginRegistry.CacheSchema("docker#v5.13.0", &plugins.PluginSchema{Name: "Docker"})
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	server.documentManager.OpenDocument(uri, 1, "steps:\n  - command: make\n    plugins:\n      - docker#v5.13.0:\n          image: node:20\n          mount-checkout: false\n")
+
+	result, err := server.Hover(context.Background(), &protocol.HoverParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 5, Character: 14},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Hover failed: %v", err)
+	}
+	if result == nil || !strings.Contains(result.Contents.Value, "Mount the checkout into the container") {
+		t.Errorf("Expected mount-checkout documented, got %+v", result)
+	}
+}
@@ -0,0 +1,76 @@
+package lsp
+
+import (
+	"context"
+	"time"
+
+	"go.lsp.dev/protocol"
+)
+
+// DocumentValidatedMethod is the custom notification sent after each validation of a
+// document, when the documentValidatedNotifications setting is on
+const DocumentValidatedMethod = "buildkite/documentValidated"
+
+// DocumentValidatedParams summarises a validation, so extensions can show a pipeline's
+// status without tracking its diagnostics themselves
+type DocumentValidatedParams struct {
+	URI protocol.DocumentURI `json:"uri"`
+	// Version is the version of the document that was validated
+	Version int32 `json:"version"`
+	// Valid is true when there are no errors
+	Valid       bool `json:"valid"`
+	Errors      int  `json:"errors"`
+	Warnings    int  `json:"warnings"`
+	Information int  `json:"information"`
+	Hints       int  `json:"hints"`
+	// ParseDurationMs is how long parsing the YAML took, and ValidationDurationMs how long
+	// the whole validation took, parsing included
+	ParseDurationMs      float64 `json:"parseDurationMs"`
+	ValidationDurationMs float64 `json:"validationDurationMs"`
+}
+
+// newDocumentValidatedParams counts the diagnostics of a validation by severity
+func newDocumentValidatedParams(uri protocol.DocumentURI, version int32, diagnostics []protocol.Diagnostic, parseDuration, validationDuration time.Duration) DocumentValidatedParams {
+	params := DocumentValidatedParams{
+		URI:                  uri,
+		Version:              version,
+		ParseDurationMs:      durationMs(parseDuration),
+		ValidationDurationMs: durationMs(validationDuration),
+	}
+	for _, diagnostic := range diagnostics {
+		switch diagnostic.Severity {
+		case protocol.DiagnosticSeverityError:
+			params.Errors++
+		case protocol.DiagnosticSeverityWarning:
+			params.Warnings++
+		case protocol.DiagnosticSeverityInformation:
+			params.Information++
+		case protocol.DiagnosticSeverityHint:
+			params.Hints++
+		}
+	}
+	params.Valid = params.Errors == 0
+	return params
+}
+
+// durationMs converts a duration to fractional milliseconds
+func durationMs(duration time.Duration) float64 {
+	return float64(duration.Microseconds()) / 1000
+}
+
+// notifyDocumentValidated tells the client a document was validated, if it asked to be told
+func (s *Server) notifyDocumentValidated(ctx context.Context, uri protocol.DocumentURI, diagnostics []protocol.Diagnostic, parseDuration, validationDuration time.Duration) {
+	if s.conn == nil || !s.Settings().DocumentValidatedNotifications {
+		return
+	}
+
+	var version int32
+	if doc, exists := s.documentManager.GetDocument(uri); exists {
+		version = doc.Version
+	}
+
+	params := newDocumentValidatedParams(uri, version, diagnostics, parseDuration, validationDuration)
+	if err := s.conn.Notify(ctx, DocumentValidatedMethod, params); err != nil {
+		s.logger.Printf("Failed to send document validated notification: %v", err)
+	}
+}
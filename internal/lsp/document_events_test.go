@@ -0,0 +1,88 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"go.lsp.dev/jsonrpc2"
+	"go.lsp.dev/protocol"
+)
+
+func TestNewDocumentValidatedParams(t *testing.T) {
+	diagnostics := []protocol.Diagnostic{
+		{Severity: protocol.DiagnosticSeverityError},
+		{Severity: protocol.DiagnosticSeverityWarning},
+		{Severity: protocol.DiagnosticSeverityWarning},
+		{Severity: protocol.DiagnosticSeverityInformation},
+		{Severity: protocol.DiagnosticSeverityHint},
+	}
+
+	params := newDocumentValidatedParams("file:///pipeline.yml", 3, diagnostics, 1500*time.Microsecond, 12*time.Millisecond)
+	if params.Valid || params.Errors != 1 || params.Warnings != 2 || params.Information != 1 || params.Hints != 1 {
+		t.Errorf("Expected counts by severity, got %+v", params)
+	}
+	if params.Version != 3 || params.ParseDurationMs != 1.5 || params.ValidationDurationMs != 12 {
+		t.Errorf("Expected the version and durations, got %+v", params)
+	}
+
+	if clean := newDocumentValidatedParams("file:///pipeline.yml", 1, nil, 0, 0); !clean.Valid {
+		t.Errorf("Expected a document without diagnostics to be valid, got %+v", clean)
+	}
+}
+
+func TestServer_DocumentValidatedNotification(t *testing.T) {
+	server := newTestServer()
+	ctx := context.Background()
+
+	serverSide, clientSide := net.Pipe()
+	defer serverSide.Close()
+	defer clientSide.Close()
+
+	validated := make(chan DocumentValidatedParams, 4)
+	client := jsonrpc2.NewConn(jsonrpc2.NewStream(clientSide))
+	client.Go(ctx, func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		if req.Method() == DocumentValidatedMethod {
+			var params DocumentValidatedParams
+			if err := json.Unmarshal(req.Params(), &params); err == nil {
+				validated <- params
+			}
+		}
+		return reply(ctx, nil, nil)
+	})
+	conn := jsonrpc2.NewConn(jsonrpc2.NewStream(serverSide))
+	conn.Go(ctx, jsonrpc2.MethodNotFoundHandler)
+	server.SetConnection(conn)
+
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	content := "steps:\n  - key: build\n    command: make\n    env:\n      DEBUG: true\n"
+	server.documentManager.OpenDocument(uri, 4, content)
+
+	// Off unless the client asks for it
+	server.validateDocument(ctx, uri, content)
+	select {
+	case params := <-validated:
+		t.Fatalf("Expected no notification by default, got %+v", params)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	server.applySettings(parseSettings(map[string]interface{}{"documentValidatedNotifications": true}))
+	server.validateDocument(ctx, uri, content)
+
+	select {
+	case params := <-validated:
+		if params.URI != uri || params.Version != 4 {
+			t.Errorf("Expected the document and its version, got %+v", params)
+		}
+		if !params.Valid || params.Errors != 0 || params.Warnings != 1 {
+			t.Errorf("Expected one warning for the unquoted env value, got %+v", params)
+		}
+		if params.ValidationDurationMs < params.ParseDurationMs {
+			t.Errorf("Expected the validation to take at least as long as parsing, got %+v", params)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a document validated notification")
+	}
+}
@@ -1,7 +1,9 @@
 package lsp
 
 import (
+	"strings"
 	"sync"
+	"unicode/utf8"
 
 	"go.lsp.dev/protocol"
 
@@ -12,6 +14,7 @@ import (
 type DocumentManager struct {
 	mu        sync.RWMutex
 	documents map[protocol.DocumentURI]*Document
+	positions *positionCache
 }
 
 // Document represents a cached document with its content and metadata
@@ -20,12 +23,16 @@ type Document struct {
 	Version int32
 	Content string
 	Lines   []string
+	// LineEnding is the line ending most of the document's lines end with, "\n" or "\r\n".
+	// Edits to the document are written with it.
+	LineEnding string
 }
 
 // NewDocumentManager creates a new document manager
 func NewDocumentManager() *DocumentManager {
 	return &DocumentManager{
 		documents: make(map[protocol.DocumentURI]*Document),
+		positions: newPositionCache(positionCacheSize),
 	}
 }
 
@@ -34,11 +41,13 @@ func (dm *DocumentManager) OpenDocument(uri protocol.DocumentURI, version int32,
 	dm.mu.Lock()
 	defer dm.mu.Unlock()
 
+	dm.positions.forget(uri)
 	dm.documents[uri] = &Document{
-		URI:     uri,
-		Version: version,
-		Content: content,
-		Lines:   splitLines(content),
+		URI:        uri,
+		Version:    version,
+		Content:    content,
+		Lines:      splitLines(content),
+		LineEnding: detectLineEnding(content),
 	}
 }
 
@@ -47,26 +56,105 @@ func (dm *DocumentManager) UpdateDocument(uri protocol.DocumentURI, version int3
 	dm.mu.Lock()
 	defer dm.mu.Unlock()
 
+	dm.positions.forget(uri)
 	if doc, exists := dm.documents[uri]; exists {
 		doc.Version = version
 		doc.Content = content
 		doc.Lines = splitLines(content)
+		doc.LineEnding = detectLineEnding(content)
 	} else {
 		// Document doesn't exist, create it
 		dm.documents[uri] = &Document{
-			URI:     uri,
-			Version: version,
-			Content: content,
-			Lines:   splitLines(content),
+			URI:        uri,
+			Version:    version,
+			Content:    content,
+			Lines:      splitLines(content),
+			LineEnding: detectLineEnding(content),
 		}
 	}
 }
 
+// ContentChange is a change from a didChange notification. Range is nil for a change
+// replacing the whole document: protocol.TextDocumentContentChangeEvent always has a range
+// once decoded, so an insert at the start of the document would read as a full change.
+type ContentChange struct {
+	Range *protocol.Range `json:"range,omitempty"`
+	Text  string          `json:"text"`
+}
+
+// DidChangeParams are the params of a didChange notification, with its changes decoded as
+// ContentChanges
+type DidChangeParams struct {
+	TextDocument   protocol.VersionedTextDocumentIdentifier `json:"textDocument"`
+	ContentChanges []ContentChange                          `json:"contentChanges"`
+}
+
+// ApplyChanges applies a didChange notification's content changes to a document in order
+// and returns its new content. A change replaces the whole document when it has no range,
+// and otherwise replaces its range of the content the previous changes left.
+func (dm *DocumentManager) ApplyChanges(uri protocol.DocumentURI, version int32, changes []ContentChange) string {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	dm.positions.forget(uri)
+	doc, exists := dm.documents[uri]
+	if !exists {
+		doc = &Document{URI: uri}
+		dm.documents[uri] = doc
+	}
+
+	content := doc.Content
+	for _, change := range changes {
+		if change.Range == nil {
+			content = change.Text
+			continue
+		}
+		start := offsetAt(content, change.Range.Start)
+		end := max(offsetAt(content, change.Range.End), start)
+		content = content[:start] + change.Text + content[end:]
+	}
+
+	doc.Version = version
+	doc.Content = content
+	doc.Lines = splitLines(content)
+	doc.LineEnding = detectLineEnding(content)
+	return content
+}
+
+// offsetAt converts a position to a byte offset in the content. Characters are counted in
+// UTF-16 code units, as LSP positions are, and positions past the end of a line or of the
+// document are clamped to it. The end of a CRLF line is before its carriage return.
+func offsetAt(content string, position protocol.Position) int {
+	offset := 0
+	for line := uint32(0); line < position.Line; line++ {
+		next := strings.IndexByte(content[offset:], '\n')
+		if next < 0 {
+			return len(content)
+		}
+		offset += next + 1
+	}
+
+	for units := uint32(0); units < position.Character && offset < len(content); {
+		r, size := utf8.DecodeRuneInString(content[offset:])
+		if r == '\n' || (r == '\r' && strings.HasPrefix(content[offset+size:], "\n")) {
+			break
+		}
+		units++
+		if r >= 0x10000 {
+			// Characters outside the Basic Multilingual Plane take two UTF-16 code units
+			units++
+		}
+		offset += size
+	}
+	return offset
+}
+
 // CloseDocument removes a document from the cache
 func (dm *DocumentManager) CloseDocument(uri protocol.DocumentURI) {
 	dm.mu.Lock()
 	defer dm.mu.Unlock()
 
+	dm.positions.forget(uri)
 	delete(dm.documents, uri)
 }
 
@@ -79,7 +167,21 @@ func (dm *DocumentManager) GetDocument(uri protocol.DocumentURI) (*Document, boo
 	return doc, exists
 }
 
-// GetContentAtPosition returns the content and line information at a specific position
+// AllDocuments returns every open document
+func (dm *DocumentManager) AllDocuments() []*Document {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+
+	docs := make([]*Document, 0, len(dm.documents))
+	for _, doc := range dm.documents {
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+// GetContentAtPosition returns the content and line information at a specific position.
+// The line information is cached per document version and shares the document's lines
+// rather than copying them, as it's asked for on every keystroke while typing.
 func (dm *DocumentManager) GetContentAtPosition(uri protocol.DocumentURI, position protocol.Position) (*context.PositionContext, error) {
 	dm.mu.RLock()
 	defer dm.mu.RUnlock()
@@ -90,27 +192,29 @@ func (dm *DocumentManager) GetContentAtPosition(uri protocol.DocumentURI, positi
 	}
 
 	lineIndex := int(position.Line)
-	charIndex := int(position.Character)
-
 	if lineIndex >= len(doc.Lines) {
 		return nil, nil // Position out of bounds
 	}
 
-	currentLine := doc.Lines[lineIndex]
-
-	// Get surrounding context for analysis
-	contextLines := make([]string, 0, len(doc.Lines))
-	for i := 0; i < len(doc.Lines) && i <= lineIndex; i++ {
-		contextLines = append(contextLines, doc.Lines[i])
+	key := positionKey{uri: uri, version: doc.Version, line: lineIndex}
+	lineCtx, cached := dm.positions.get(key)
+	if !cached {
+		lineCtx = lineContext{
+			currentLine: doc.Lines[lineIndex],
+			// Capped so appending to the context lines can't write into the document's
+			contextLines: doc.Lines[: lineIndex+1 : lineIndex+1],
+			fullContent:  doc.Content,
+		}
+		dm.positions.put(key, lineCtx)
 	}
 
 	return &context.PositionContext{
 		URI:          uri,
 		Position:     position,
-		CurrentLine:  currentLine,
-		CharIndex:    charIndex,
-		ContextLines: contextLines,
-		FullContent:  doc.Content,
+		CurrentLine:  lineCtx.currentLine,
+		CharIndex:    int(position.Character),
+		ContextLines: lineCtx.contextLines,
+		FullContent:  lineCtx.fullContent,
 	}, nil
 }
 
@@ -139,3 +243,33 @@ func splitLines(content string) []string {
 
 	return lines
 }
+
+// documentLines splits content into lines as strings.Split does, keeping the empty line
+// after a trailing newline, but without the carriage returns of CRLF line endings, so
+// columns and line lengths are the same whichever endings the document uses
+func documentLines(content string) []string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return lines
+}
+
+// detectLineEnding returns the line ending most of the content's lines end with, "\r\n" or
+// "\n", taking "\n" for content with a single line or as many of each
+func detectLineEnding(content string) string {
+	crlf := strings.Count(content, "\r\n")
+	if crlf > strings.Count(content, "\n")-crlf {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// withLineEnding rewrites the line breaks in text, written with either ending, to the one given
+func withLineEnding(text, ending string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if ending == "" || ending == "\n" {
+		return text
+	}
+	return strings.ReplaceAll(text, "\n", ending)
+}
@@ -1,6 +1,7 @@
 package lsp
 
 import (
+	"encoding/json"
 	"fmt"
 	"testing"
 
@@ -95,6 +96,128 @@ func TestDocumentManager_UpdateNonExistentDocument(t *testing.T) {
 	}
 }
 
+// changeAt replaces the range from start to end with text
+func changeAt(startLine, startChar, endLine, endChar uint32, text string) ContentChange {
+	return ContentChange{
+		Range: &protocol.Range{
+			Start: protocol.Position{Line: startLine, Character: startChar},
+			End:   protocol.Position{Line: endLine, Character: endChar},
+		},
+		Text: text,
+	}
+}
+
+func TestDocumentManager_ApplyChanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		changes  []ContentChange
+		expected string
+	}{
+		{
+			name:     "full changes keep the last",
+			content:  "steps:",
+			changes:  []ContentChange{{Text: "env: {}"}, {Text: "steps:\n  - wait"}},
+			expected: "steps:\n  - wait",
+		},
+		{
+			name:    "incremental changes apply in order",
+			content: "steps:\n  - label: \"test\"\n    command: make",
+			changes: []ContentChange{
+				// Each change's range is in the content the previous changes left
+				changeAt(1, 12, 1, 16, "build"),
+				changeAt(2, 17, 2, 17, " build"),
+				changeAt(2, 17, 2, 17, "\n    key: build"),
+			},
+			expected: "steps:\n  - label: \"build\"\n    command: make\n    key: build build",
+		},
+		{
+			name:    "deleting lines",
+			content: "steps:\n  - wait\n  - wait\n  - block: Go",
+			changes: []ContentChange{
+				changeAt(1, 0, 2, 0, ""),
+				changeAt(1, 0, 2, 0, ""),
+			},
+			expected: "steps:\n  - block: Go",
+		},
+		{
+			name:    "incremental change after a full change",
+			content: "steps:",
+			changes: []ContentChange{
+				{Text: "steps:\n  - wait"},
+				changeAt(1, 8, 1, 8, ": ~"),
+			},
+			expected: "steps:\n  - wait: ~",
+		},
+		{
+			name:     "inserting at the start of the document",
+			content:  "steps:\n  - wait\n",
+			changes:  []ContentChange{changeAt(0, 0, 0, 0, "# header\n")},
+			expected: "# header\nsteps:\n  - wait\n",
+		},
+		{
+			name:     "characters counted in UTF-16 code units",
+			content:  "steps:\n  - label: \"🚀 é\"",
+			changes:  []ContentChange{changeAt(1, 15, 1, 16, "e")},
+			expected: "steps:\n  - label: \"🚀 e\"",
+		},
+		{
+			name:     "positions past the end are clamped",
+			content:  "steps:\n  - wait",
+			changes:  []ContentChange{changeAt(1, 50, 9, 0, "\n  - block: Go\n")},
+			expected: "steps:\n  - wait\n  - block: Go\n",
+		},
+		{
+			name:     "end of a CRLF line is before the carriage return",
+			content:  "steps:\r\n  - wait\r\n",
+			changes:  []ContentChange{changeAt(1, 50, 1, 50, ": ~")},
+			expected: "steps:\r\n  - wait: ~\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dm := NewDocumentManager()
+			uri := protocol.DocumentURI("file:///tmp/test.yml")
+			dm.OpenDocument(uri, 1, tt.content)
+
+			if content := dm.ApplyChanges(uri, 2, tt.changes); content != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, content)
+			}
+
+			doc, _ := dm.GetDocument(uri)
+			if doc.Version != 2 || doc.Content != tt.expected || len(doc.Lines) != len(splitLines(tt.expected)) {
+				t.Errorf("Expected the document to hold version 2 of the new content, got %+v", doc)
+			}
+		})
+	}
+}
+
+func TestDidChangeParams_RangeDecidesFullChanges(t *testing.T) {
+	dm := NewDocumentManager()
+	uri := protocol.DocumentURI("file:///tmp/test.yml")
+	dm.OpenDocument(uri, 1, "steps:\n  - wait\n")
+
+	// An insert at the start of the document has an empty range at 0:0, but still has one
+	var params DidChangeParams
+	insert := `{"textDocument":{"uri":"file:///tmp/test.yml","version":2},"contentChanges":[{"range":{"start":{"line":0,"character":0},"end":{"line":0,"character":0}},"text":"# header\n"}]}`
+	if err := json.Unmarshal([]byte(insert), &params); err != nil {
+		t.Fatalf("Failed to decode params: %v", err)
+	}
+	if content := dm.ApplyChanges(uri, 2, params.ContentChanges); content != "# header\nsteps:\n  - wait\n" {
+		t.Errorf("Expected the header inserted, got %q", content)
+	}
+
+	params = DidChangeParams{}
+	full := `{"textDocument":{"uri":"file:///tmp/test.yml","version":3},"contentChanges":[{"text":"steps: []\n"}]}`
+	if err := json.Unmarshal([]byte(full), &params); err != nil {
+		t.Fatalf("Failed to decode params: %v", err)
+	}
+	if content := dm.ApplyChanges(uri, 3, params.ContentChanges); content != "steps: []\n" {
+		t.Errorf("Expected the document replaced, got %q", content)
+	}
+}
+
 func TestDocumentManager_CloseDocument(t *testing.T) {
 	dm := NewDocumentManager()
 
@@ -207,6 +330,62 @@ func TestDocumentManager_GetContentAtPosition_NonExistentDocument(t *testing.T)
 	}
 }
 
+func TestDocumentManager_GetContentAtPosition_Cached(t *testing.T) {
+	dm := NewDocumentManager()
+
+	uri := protocol.DocumentURI("file:///tmp/test.yml")
+	dm.OpenDocument(uri, 1, "steps:\n  - label: \"test\"\n    command: make")
+
+	first, _ := dm.GetContentAtPosition(uri, protocol.Position{Line: 1, Character: 4})
+	second, _ := dm.GetContentAtPosition(uri, protocol.Position{Line: 1, Character: 9})
+	if second.CharIndex != 9 || second.Position.Character != 9 {
+		t.Errorf("Expected the second position's character, got %d", second.CharIndex)
+	}
+	if dm.positions.len() != 1 {
+		t.Errorf("Expected one cached line, got %d", dm.positions.len())
+	}
+
+	// The context lines share the document's lines rather than copying them
+	doc, _ := dm.GetDocument(uri)
+	if &first.ContextLines[0] != &doc.Lines[0] || &second.ContextLines[0] != &doc.Lines[0] {
+		t.Error("Expected context lines to share the document's lines")
+	}
+	if cap(first.ContextLines) != 2 {
+		t.Errorf("Expected context lines capped at the current line, got capacity %d", cap(first.ContextLines))
+	}
+
+	// Reopening with the same version replaces what was cached
+	dm.OpenDocument(uri, 1, "steps:\n  - command: make test")
+	posCtx, _ := dm.GetContentAtPosition(uri, protocol.Position{Line: 1, Character: 4})
+	if posCtx.CurrentLine != "  - command: make test" {
+		t.Errorf("Expected the reopened document's line, got %q", posCtx.CurrentLine)
+	}
+
+	dm.CloseDocument(uri)
+	if dm.positions.len() != 0 {
+		t.Errorf("Expected closing the document to empty the cache, got %d lines", dm.positions.len())
+	}
+}
+
+func TestPositionCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newPositionCache(2)
+	uri := protocol.DocumentURI("file:///tmp/test.yml")
+
+	cache.put(positionKey{uri: uri, version: 1, line: 0}, lineContext{currentLine: "a"})
+	cache.put(positionKey{uri: uri, version: 1, line: 1}, lineContext{currentLine: "b"})
+	cache.get(positionKey{uri: uri, version: 1, line: 0})
+	cache.put(positionKey{uri: uri, version: 1, line: 2}, lineContext{currentLine: "c"})
+
+	if _, ok := cache.get(positionKey{uri: uri, version: 1, line: 1}); ok {
+		t.Error("Expected the least recently used line to be evicted")
+	}
+	for _, line := range []int{0, 2} {
+		if _, ok := cache.get(positionKey{uri: uri, version: 1, line: line}); !ok {
+			t.Errorf("Expected line %d to still be cached", line)
+		}
+	}
+}
+
 func TestSplitLines(t *testing.T) {
 	tests := []struct {
 		input    string
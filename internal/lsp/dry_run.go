@@ -0,0 +1,302 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+// DryRunMethod is the custom request simulating the order a pipeline's steps run in, so
+// editor extensions can preview it and show where steps wait on each other needlessly
+const DryRunMethod = "buildkite/dryRun"
+
+// DryRunParams are the parameters of a buildkite/dryRun request
+type DryRunParams struct {
+	TextDocument protocol.TextDocumentIdentifier `json:"textDocument"`
+}
+
+// DryRun is a simulated run of a pipeline, assuming every step takes the same time
+type DryRun struct {
+	// Phases are the batches of steps that can run at the same time, in the order they run
+	Phases []DryRunPhase `json:"phases"`
+	// Unscheduled are the steps that can never start, because of a depends_on cycle
+	Unscheduled []DryRunStep `json:"unscheduled,omitempty"`
+}
+
+// DryRunPhase is a batch of steps that start together
+type DryRunPhase struct {
+	Steps []DryRunStep `json:"steps"`
+}
+
+// DryRunStep is a step as it's scheduled in a dry run
+type DryRunStep struct {
+	// Range spans the step, from its first property to the end of its value
+	Range protocol.Range `json:"range"`
+	// Type is one of command, block, input or trigger. Wait steps and groups take no time
+	// of their own, so they're never scheduled.
+	Type  string `json:"type"`
+	Key   string `json:"key,omitempty"`
+	Label string `json:"label,omitempty"`
+	// Path locates the step by index, as in buildkite/stepRangeAt
+	Path []int `json:"path"`
+	// WaitsFor explains what keeps the step out of the phase before, e.g. "depends_on: build"
+	WaitsFor string `json:"waitsFor,omitempty"`
+}
+
+// dryRunNode is a step in the graph a dry run schedules. Waits are nodes too, finishing as
+// soon as the steps before them do.
+type dryRunNode struct {
+	step  DryRunStep
+	wait  bool
+	deps  []dryRunDependency
+	needs []string
+	// concurrencyGroup and concurrency limit how many of the group's steps run at once
+	concurrencyGroup string
+	concurrency      int
+	phase            int
+	scheduled        bool
+}
+
+// dryRunDependency is a node that must finish first, and how to describe it
+type dryRunDependency struct {
+	node   int
+	reason string
+}
+
+// dryRunGraph builds the nodes of a dry run from a pipeline's steps
+type dryRunGraph struct {
+	edit  *structuredEdit
+	nodes []*dryRunNode
+	// keys maps step and group keys to the nodes depending on them waits for
+	keys map[string][]int
+}
+
+// DryRun simulates the pipeline's run: each step starts once the steps it depends on,
+// explicitly or through wait and block steps, have finished and its concurrency group has
+// room. The result is nil for documents that aren't pipelines.
+func (s *Server) DryRun(ctx context.Context, params *DryRunParams) (*DryRun, error) {
+	doc, exists := s.documentManager.GetDocument(params.TextDocument.URI)
+	if !exists {
+		return nil, fmt.Errorf("document not found: %s", params.TextDocument.URI)
+	}
+
+	if !s.isBuildkiteFile(string(params.TextDocument.URI)) {
+		return nil, nil
+	}
+
+	pipeline, err := parser.ParseYAML([]byte(doc.Content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pipeline: %w", err)
+	}
+
+	root := pipeline.YAMLNode
+	if root == nil || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return nil, nil
+	}
+
+	graph := &dryRunGraph{
+		edit: &structuredEdit{lines: doc.Lines},
+		keys: make(map[string][]int),
+	}
+	graph.addSteps(mappingValue(root.Content[0], "steps"), nil, nil, nil)
+	return graph.schedule(), nil
+}
+
+// addSteps adds the nodes of a list of steps, each waiting for the inherited dependencies
+// of its group as well as the waits and blocks before it in the list. It returns the nodes
+// the steps run as.
+func (g *dryRunGraph) addSteps(list *yaml.Node, path []int, inherited []dryRunDependency, needs []string) []int {
+	var added []int
+	if list == nil || list.Kind != yaml.SequenceNode {
+		return added
+	}
+
+	barrier := inherited
+	// since are the nodes after the last barrier, which the next one waits for
+	var since []int
+	for i, step := range list.Content {
+		stepPath := append(append([]int{}, path...), i)
+
+		if step.Kind == yaml.MappingNode && mappingKey(step, "group") != nil {
+			groupNeeds := append(append([]string{}, needs...), nodeDependencies(step)...)
+			nested := g.addSteps(mappingValue(step, "steps"), stepPath, barrier, groupNeeds)
+			if key := stepNodeKey(step); key != "" {
+				g.keys[key] = append(g.keys[key], nested...)
+			}
+			since = append(since, nested...)
+			added = append(added, nested...)
+			continue
+		}
+
+		node := g.newNode(step, stepPath)
+		if node == nil {
+			continue
+		}
+		index := len(g.nodes)
+		g.nodes = append(g.nodes, node)
+
+		if isBarrierStep(step) {
+			for _, before := range since {
+				node.deps = append(node.deps, dryRunDependency{node: before, reason: g.describe(before)})
+			}
+			node.deps = append(node.deps, barrier...)
+			barrier = []dryRunDependency{{node: index, reason: g.describe(index)}}
+			since = nil
+		} else {
+			node.deps = append(node.deps, barrier...)
+		}
+		node.needs = append(append(node.needs, needs...), nodeDependencies(step)...)
+
+		if key := stepNodeKey(step); key != "" {
+			g.keys[key] = append(g.keys[key], index)
+		}
+		since = append(since, index)
+		added = append(added, index)
+	}
+
+	return added
+}
+
+// newNode describes a step, or returns nil for items that aren't steps
+func (g *dryRunGraph) newNode(step *yaml.Node, path []int) *dryRunNode {
+	if step.Kind != yaml.ScalarNode && step.Kind != yaml.MappingNode {
+		return nil
+	}
+	var decoded interface{}
+	if err := step.Decode(&decoded); err != nil {
+		return nil
+	}
+	kind := stepType(decoded)
+	if kind == "" {
+		return nil
+	}
+
+	node := &dryRunNode{
+		step: DryRunStep{
+			Range: protocol.Range{Start: nodeStart(step), End: g.edit.nodeEnd(step)},
+			Type:  kind,
+			Path:  path,
+		},
+		wait: kind == "wait",
+	}
+	if step.Kind == yaml.MappingNode {
+		node.step.Key = stepNodeKey(step)
+		for _, field := range append(append([]string{}, stepLabelFields...), "trigger") {
+			if label := stringNodeValue(mappingValue(step, field)); label != "" {
+				node.step.Label = label
+				break
+			}
+		}
+		node.concurrencyGroup = stringNodeValue(mappingValue(step, "concurrency_group"))
+		node.concurrency, _ = strconv.Atoi(stringNodeValue(mappingValue(step, "concurrency")))
+	}
+	return node
+}
+
+// describe names a wait or block step for the steps held back by it
+func (g *dryRunGraph) describe(index int) string {
+	node := g.nodes[index]
+	line := node.step.Range.Start.Line + 1
+	switch {
+	case node.wait:
+		return fmt.Sprintf("the wait step on line %d", line)
+	case node.step.Type == "block" && node.step.Label != "":
+		return fmt.Sprintf("the block step '%s'", node.step.Label)
+	case node.step.Type == "block":
+		return fmt.Sprintf("the block step on line %d", line)
+	}
+	return "the steps before it"
+}
+
+// schedule places each node in the earliest phase its dependencies and concurrency group
+// allow, in document order among nodes ready at the same time
+func (g *dryRunGraph) schedule() *DryRun {
+	for _, node := range g.nodes {
+		for _, key := range node.needs {
+			for _, dependency := range g.keys[key] {
+				node.deps = append(node.deps, dryRunDependency{node: dependency, reason: "depends_on: " + key})
+			}
+		}
+	}
+
+	// finish is the phase after a node's last, when the nodes waiting for it can start.
+	// Waits take no time.
+	finish := func(node *dryRunNode) int {
+		if node.wait {
+			return node.phase
+		}
+		return node.phase + 1
+	}
+	running := make(map[string]map[int]int)
+
+	for {
+		next, earliest := -1, 0
+		for i, node := range g.nodes {
+			if node.scheduled {
+				continue
+			}
+			ready, start := true, 0
+			for _, dependency := range node.deps {
+				if !g.nodes[dependency.node].scheduled {
+					ready = false
+					break
+				}
+				start = max(start, finish(g.nodes[dependency.node]))
+			}
+			if ready && (next < 0 || start < earliest) {
+				next, earliest = i, start
+			}
+		}
+		if next < 0 {
+			break
+		}
+
+		node := g.nodes[next]
+		node.phase = earliest
+		for _, dependency := range node.deps {
+			if finish(g.nodes[dependency.node]) == earliest && earliest > 0 {
+				node.step.WaitsFor = dependency.reason
+				break
+			}
+		}
+		if node.concurrencyGroup != "" && node.concurrency > 0 && !node.wait {
+			if running[node.concurrencyGroup] == nil {
+				running[node.concurrencyGroup] = make(map[int]int)
+			}
+			for running[node.concurrencyGroup][node.phase] >= node.concurrency {
+				node.phase++
+				node.step.WaitsFor = fmt.Sprintf("concurrency_group: %s, which runs %d at a time", node.concurrencyGroup, node.concurrency)
+			}
+			running[node.concurrencyGroup][node.phase]++
+		}
+		node.scheduled = true
+	}
+
+	result := &DryRun{Phases: []DryRunPhase{}}
+	byPhase := make(map[int][]DryRunStep)
+	last := -1
+	for _, node := range g.nodes {
+		if node.wait {
+			continue
+		}
+		if !node.scheduled {
+			node.step.WaitsFor = "a depends_on cycle"
+			result.Unscheduled = append(result.Unscheduled, node.step)
+			continue
+		}
+		byPhase[node.phase] = append(byPhase[node.phase], node.step)
+		last = max(last, node.phase)
+	}
+	for phase := 0; phase <= last; phase++ {
+		if steps := byPhase[phase]; len(steps) > 0 {
+			result.Phases = append(result.Phases, DryRunPhase{Steps: steps})
+		}
+	}
+
+	return result
+}
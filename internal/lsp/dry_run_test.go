@@ -0,0 +1,102 @@
+package lsp
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+func TestServer_DryRun(t *testing.T) {
+	content := `steps:
+  - label: Build
+    key: build
+    command: make
+  - label: Lint
+    command: make lint
+  - label: Test
+    key: test
+    command: make test
+    depends_on: build
+  - wait
+  - group: Deploy
+    key: deploy
+    steps:
+      - label: Deploy eu
+        command: deploy eu
+        concurrency_group: deploy
+        concurrency: 1
+      - label: Deploy us
+        command: deploy us
+        concurrency_group: deploy
+        concurrency: 1
+  - block: Release
+  - label: Announce
+    command: announce
+  - label: Ping
+    key: ping
+    command: ping
+    depends_on: pong
+  - label: Pong
+    key: pong
+    command: pong
+    depends_on: ping
+`
+
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	server.documentManager.OpenDocument(uri, 1, content)
+
+	result, err := server.DryRun(context.Background(), &DryRunParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+	})
+	if err != nil {
+		t.Fatalf("DryRun failed: %v", err)
+	}
+
+	expected := [][]string{
+		{"Build", "Lint"},
+		{"Test"},
+		{"Deploy eu"},
+		{"Deploy us"},
+		{"Release"},
+		{"Announce"},
+	}
+	var phases [][]string
+	for _, phase := range result.Phases {
+		var labels []string
+		for _, step := range phase.Steps {
+			labels = append(labels, step.Label)
+		}
+		phases = append(phases, labels)
+	}
+	if !reflect.DeepEqual(phases, expected) {
+		t.Fatalf("Expected phases %v, got %v", expected, phases)
+	}
+
+	reasons := map[string]string{
+		"Build":     "",
+		"Test":      "depends_on: build",
+		"Deploy eu": "the wait step on line 11",
+		"Deploy us": "concurrency_group: deploy, which runs 1 at a time",
+		"Release":   "the steps before it",
+		"Announce":  "the block step 'Release'",
+	}
+	for _, phase := range result.Phases {
+		for _, step := range phase.Steps {
+			if reason, ok := reasons[step.Label]; ok && step.WaitsFor != reason {
+				t.Errorf("Expected %s to wait for %q, got %q", step.Label, reason, step.WaitsFor)
+			}
+		}
+	}
+
+	deployUS := result.Phases[3].Steps[0]
+	if !reflect.DeepEqual(deployUS.Path, []int{4, 1}) || deployUS.Range.Start.Line != 18 {
+		t.Errorf("Expected the nested step's path and range, got %+v", deployUS)
+	}
+
+	if len(result.Unscheduled) != 2 || result.Unscheduled[0].Key != "ping" || result.Unscheduled[1].Key != "pong" {
+		t.Errorf("Expected the steps in the cycle to be unscheduled, got %+v", result.Unscheduled)
+	}
+}
@@ -0,0 +1,244 @@
+package lsp
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+
+	"github.com/mcncl/buildkite-ls/internal/parser"
+	"github.com/mcncl/buildkite-ls/internal/plugins"
+)
+
+// pluginEntry is one entry of a step's plugins list
+type pluginEntry struct {
+	// item is the list item, key the plugin reference and config its options, nil when
+	// the plugin is listed without any
+	item, key, config *yaml.Node
+}
+
+// stepPluginEntries returns the entries of a step's plugins list
+func stepPluginEntries(list *yaml.Node) []pluginEntry {
+	var entries []pluginEntry
+	if list == nil || list.Kind != yaml.SequenceNode {
+		return entries
+	}
+	for _, item := range list.Content {
+		switch item.Kind {
+		case yaml.ScalarNode:
+			if item.Value != "" {
+				entries = append(entries, pluginEntry{item: item, key: item})
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(item.Content); i += 2 {
+				entries = append(entries, pluginEntry{item: item, key: item.Content[i], config: item.Content[i+1]})
+			}
+		}
+	}
+	return entries
+}
+
+// pluginIdentity names the plugin a reference uses, whatever its version and however the
+// reference is written, e.g. docker, docker#v5.13.0 and buildkite-plugins/docker#v5.12.0
+// are all the same plugin
+func (s *Server) pluginIdentity(ref string) (identity, version string) {
+	parsed := plugins.ParsePluginReference(s.pluginRegistry.ResolveAlias(ref))
+	if parsed == nil {
+		return ref, ""
+	}
+	if parsed.Path != "" {
+		return parsed.Path, parsed.Version
+	}
+	return parsed.Host + "/" + parsed.Org + "/" + parsed.Name, parsed.Version
+}
+
+// duplicatePlugin finds the first of a step's plugins entries using the same plugin as the
+// entry, when it comes before it
+func (s *Server) duplicatePlugin(entries []pluginEntry, entry pluginEntry) (pluginEntry, bool) {
+	identity, _ := s.pluginIdentity(entry.key.Value)
+	for _, other := range entries {
+		if other.key == entry.key {
+			break
+		}
+		if otherIdentity, _ := s.pluginIdentity(other.key.Value); otherIdentity == identity {
+			return other, true
+		}
+	}
+	return pluginEntry{}, false
+}
+
+// validateDuplicatePlugins warns when a step lists the same plugin more than once, which
+// runs its hooks once for each entry, and when the entries pin different versions of it.
+// The first entry is given as a related location.
+func (s *Server) validateDuplicatePlugins(uri protocol.DocumentURI, pipeline *parser.Pipeline) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	root := pipeline.YAMLNode
+	if root == nil || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return diagnostics
+	}
+
+	for _, step := range dependableSteps(mappingValue(root.Content[0], "steps")) {
+		entries := stepPluginEntries(mappingValue(step, "plugins"))
+		for _, entry := range entries {
+			first, ok := s.duplicatePlugin(entries, entry)
+			if !ok {
+				continue
+			}
+
+			_, version := s.pluginIdentity(entry.key.Value)
+			_, firstVersion := s.pluginIdentity(first.key.Value)
+			name := pluginDisplayName(entry.key.Value)
+			diagnostic := nodeDiagnostic(entry.key, protocol.DiagnosticSeverityWarning, "duplicate-plugin",
+				fmt.Sprintf("The %s plugin is already used by this step on line %d, so its hooks run twice", name, first.key.Line))
+			if version != firstVersion {
+				diagnostic = nodeDiagnostic(entry.key, protocol.DiagnosticSeverityWarning, "plugin-version-conflict",
+					fmt.Sprintf("This step uses the %s plugin at %s here and at %s on line %d. Both versions run: pin one of them", name, version, firstVersion, first.key.Line))
+			}
+			diagnostic.RelatedInformation = []protocol.DiagnosticRelatedInformation{{
+				Location: protocol.Location{URI: uri, Range: nodeRange(first.key)},
+				Message:  fmt.Sprintf("'%s' first used here", first.key.Value),
+			}}
+			diagnostics = append(diagnostics, diagnostic)
+		}
+	}
+
+	return diagnostics
+}
+
+// pluginDisplayName is a plugin reference without its version
+func pluginDisplayName(ref string) string {
+	name, _, _ := strings.Cut(ref, "#")
+	return name
+}
+
+// createDuplicatePluginActions offers to remove the duplicate entry a duplicate-plugin or
+// plugin-version-conflict warning is on, to merge its options into the first entry, and,
+// for different versions, to use one version in both entries
+func (s *Server) createDuplicatePluginActions(uri protocol.DocumentURI, lines []string, diagnostic protocol.Diagnostic) []protocol.CodeAction {
+	var actions []protocol.CodeAction
+
+	line := int(diagnostic.Range.Start.Line)
+	edit, step := stepEditOf(lines, line)
+	if edit == nil {
+		return actions
+	}
+	list := mappingValue(step, "plugins")
+	entries := stepPluginEntries(list)
+
+	var entry, first pluginEntry
+	found := false
+	for _, candidate := range entries {
+		if candidate.key.Line-1 == line {
+			entry = candidate
+			first, found = s.duplicatePlugin(entries, candidate)
+			break
+		}
+	}
+	if !found || len(entry.item.Content) > 2 {
+		return actions
+	}
+	name := pluginDisplayName(entry.key.Value)
+
+	edit.deleteItem(list, entry.item)
+	action := quickFix(uri, fmt.Sprintf("Remove the duplicate %s entry", name), edit.textEdits())
+	action.Diagnostics = []protocol.Diagnostic{diagnostic}
+	actions = append(actions, action)
+
+	if merge := newStructuredEdit(lines); merge != nil && s.mergePluginEntry(merge, list, first, entry) {
+		action := quickFix(uri, fmt.Sprintf("Merge its options into the %s entry on line %d", name, first.key.Line), merge.textEdits())
+		action.Diagnostics = []protocol.Diagnostic{diagnostic}
+		actions = append(actions, action)
+	}
+
+	if diagnostic.Code == "plugin-version-conflict" {
+		for _, pin := range []struct{ keep, change *yaml.Node }{{first.key, entry.key}, {entry.key, first.key}} {
+			pinEdit := &structuredEdit{lines: lines, root: edit.root}
+			pinEdit.replace(nodeStart(pin.change), pinEdit.nodeEnd(pin.change), pin.keep.Value)
+			action := quickFix(uri, fmt.Sprintf("Use %s in both entries", pin.keep.Value), pinEdit.textEdits())
+			action.Diagnostics = []protocol.Diagnostic{diagnostic}
+			actions = append(actions, action)
+		}
+	}
+
+	return actions
+}
+
+// mergePluginEntry moves the options of a duplicate entry that the first entry doesn't set
+// into the first, and removes the duplicate. It reports false, changing nothing, when
+// there's nothing to move, when the two set an option differently, or when the first
+// entry's options aren't written as a block mapping.
+func (s *Server) mergePluginEntry(edit *structuredEdit, list *yaml.Node, first, duplicate pluginEntry) bool {
+	if duplicate.config == nil || duplicate.config.Kind != yaml.MappingNode || len(duplicate.config.Content) == 0 ||
+		first.config == nil || first.config.Kind != yaml.MappingNode || len(first.config.Content) == 0 || first.config.Style&yaml.FlowStyle != 0 {
+		return false
+	}
+
+	var missing []*mappingEntry
+	for i := 0; i+1 < len(duplicate.config.Content); i += 2 {
+		key, value := duplicate.config.Content[i], duplicate.config.Content[i+1]
+		existing := mappingValue(first.config, key.Value)
+		if existing == nil {
+			missing = append(missing, &mappingEntry{key: key, value: value})
+			continue
+		}
+		var a, b interface{}
+		if existing.Decode(&a) != nil || value.Decode(&b) != nil || !reflect.DeepEqual(a, b) {
+			return false
+		}
+	}
+	if len(missing) == 0 {
+		return false
+	}
+
+	indent := strings.Repeat(" ", first.config.Content[0].Column-1+2)
+	for _, option := range missing {
+		var text bytes.Buffer
+		encoder := yaml.NewEncoder(&text)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(option.value); err != nil {
+			return false
+		}
+		value := strings.TrimSuffix(text.String(), "\n")
+		if option.value.Kind != yaml.ScalarNode {
+			value = "\n" + indent + strings.ReplaceAll(value, "\n", "\n"+indent)
+		}
+		edit.addProperty(first.config, nil, option.key.Value, value)
+	}
+	edit.deleteItem(list, duplicate.item)
+	return true
+}
+
+// getDuplicatePluginHoverNote notes, on a plugin reference, the step's other entries using
+// the same plugin
+func (s *Server) getDuplicatePluginHoverNote(lines []string, line int) string {
+	edit, step := stepEditOf(lines, line)
+	if edit == nil {
+		return ""
+	}
+	entries := stepPluginEntries(mappingValue(step, "plugins"))
+
+	var identity string
+	for _, entry := range entries {
+		if entry.key.Line-1 == line {
+			identity, _ = s.pluginIdentity(entry.key.Value)
+		}
+	}
+	if identity == "" {
+		return ""
+	}
+
+	var others []string
+	for _, entry := range entries {
+		if otherIdentity, _ := s.pluginIdentity(entry.key.Value); otherIdentity == identity && entry.key.Line-1 != line {
+			others = append(others, fmt.Sprintf("`%s` on line %d", entry.key.Value, entry.key.Line))
+		}
+	}
+	if len(others) == 0 {
+		return ""
+	}
+	return "**Also used by this step:** " + strings.Join(others, ", ") + ". Each entry runs the plugin's hooks."
+}
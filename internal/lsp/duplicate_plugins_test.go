@@ -0,0 +1,129 @@
+package lsp
+
+import (
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+
+	"github.com/mcncl/buildkite-ls/internal/plugins"
+)
+
+const duplicatePluginsPipeline = `steps:
+  - command: make
+    plugins:
+      - docker#v5.13.0:
+          image: node:20
+      - docker-compose#v5.0.0:
+          run: app
+      - docker#v5.13.0:
+          image: node:20
+          workdir: /app
+  - command: make test
+    plugins:
+      - docker#v5.13.0:
+          image: node:20
+      - buildkite-plugins/docker#v5.12.0
+  - command: make lint
+    plugins:
+      - docker#v5.13.0:
+          image: node:20
+`
+
+// duplicatePluginDiagnostics returns the duplicate plugin diagnostics raised for a document
+func duplicatePluginDiagnostics(server *Server, uri protocol.DocumentURI, content string) []protocol.Diagnostic {
+	for _, ref := range []string{"docker#v5.13.0", "docker-compose#v5.0.0", "buildkite-plugins/docker#v5.12.0"} {
+		server.pluginRegistry.CacheSchema(ref, &plugins.PluginSchema{Name: ref})
+	}
+
+	var diagnostics []protocol.Diagnostic
+	for _, diagnostic := range server.diagnose(uri, content) {
+		switch diagnostic.Code {
+		case "duplicate-plugin", "plugin-version-conflict":
+			diagnostics = append(diagnostics, diagnostic)
+		}
+	}
+	return diagnostics
+}
+
+func TestServer_ValidateDuplicatePlugins(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+
+	diagnostics := duplicatePluginDiagnostics(server, uri, duplicatePluginsPipeline)
+	if len(diagnostics) != 2 {
+		t.Fatalf("Expected 2 duplicate plugin warnings, got %+v", diagnostics)
+	}
+
+	for i, expected := range []struct {
+		code    string
+		line    uint32
+		related uint32
+		message string
+	}{
+		{"duplicate-plugin", 7, 3, "The docker plugin is already used by this step on line 4"},
+		{"plugin-version-conflict", 14, 12, "at v5.12.0 here and at v5.13.0 on line 13"},
+	} {
+		got := diagnostics[i]
+		if got.Code != expected.code || got.Severity != protocol.DiagnosticSeverityWarning || got.Range.Start.Line != expected.line {
+			t.Errorf("Expected a %s warning on line %d, got %+v", expected.code, expected.line, got)
+		}
+		if !strings.Contains(got.Message, expected.message) {
+			t.Errorf("Expected message containing %q, got %q", expected.message, got.Message)
+		}
+		if len(got.RelatedInformation) != 1 || got.RelatedInformation[0].Location.Range.Start.Line != expected.related {
+			t.Errorf("Expected the first entry on line %d as a related location, got %+v", expected.related, got.RelatedInformation)
+		}
+	}
+}
+
+func TestServer_DuplicatePluginActions(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	lines := splitLines(duplicatePluginsPipeline)
+	diagnostics := duplicatePluginDiagnostics(server, uri, duplicatePluginsPipeline)
+	if len(diagnostics) != 2 {
+		t.Fatalf("Expected 2 duplicate plugin warnings, got %+v", diagnostics)
+	}
+
+	applied := func(diagnostic protocol.Diagnostic) map[string]string {
+		results := make(map[string]string)
+		for _, action := range server.createDuplicatePluginActions(uri, lines, diagnostic) {
+			results[action.Title] = applyTextEdits(duplicatePluginsPipeline, action.Edit.Changes[uri])
+		}
+		return results
+	}
+
+	duplicate := applied(diagnostics[0])
+	if len(duplicate) != 2 {
+		t.Fatalf("Expected remove and merge actions, got %v", duplicate)
+	}
+	removed := duplicate["Remove the duplicate docker entry"]
+	if strings.Count(removed, "docker#v5.13.0") != 3 || strings.Contains(removed, "workdir") {
+		t.Errorf("Expected the second docker entry removed, got:\n%s", removed)
+	}
+	merged := duplicate["Merge its options into the docker entry on line 4"]
+	if !strings.Contains(merged, "      - docker#v5.13.0:\n          image: node:20\n          workdir: /app\n      - docker-compose#v5.0.0:") || strings.Count(merged, "docker#v5.13.0") != 3 {
+		t.Errorf("Expected workdir moved into the first docker entry, got:\n%s", merged)
+	}
+
+	conflict := applied(diagnostics[1])
+	if result, ok := conflict["Use docker#v5.13.0 in both entries"]; !ok || !strings.Contains(result, "      - docker#v5.13.0\n  - command: make lint") {
+		t.Errorf("Expected the second entry pinned to the first's version, got %v", conflict)
+	}
+	if result, ok := conflict["Use buildkite-plugins/docker#v5.12.0 in both entries"]; !ok || strings.Count(result, "buildkite-plugins/docker#v5.12.0") != 2 {
+		t.Errorf("Expected the first entry pinned to the second's version, got %v", conflict)
+	}
+}
+
+func TestServer_DuplicatePluginHoverNote(t *testing.T) {
+	server := newTestServer()
+	lines := splitLines(duplicatePluginsPipeline)
+
+	if note := server.getDuplicatePluginHoverNote(lines, 3); !strings.Contains(note, "`docker#v5.13.0` on line 8") {
+		t.Errorf("Expected the other docker entry noted, got %q", note)
+	}
+	if note := server.getDuplicatePluginHoverNote(lines, 5); note != "" {
+		t.Errorf("Expected no note for a plugin listed once, got %q", note)
+	}
+}
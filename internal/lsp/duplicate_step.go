@@ -0,0 +1,217 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+)
+
+// SelectRangeCommand selects a range of a document in the client with window/showDocument.
+// Its arguments are the document URI and the range. Code actions run it after their edit to
+// leave the cursor where the user is likely to type next.
+const SelectRangeCommand = "buildkite.selectRange"
+
+// getDuplicateStepActions offers to duplicate the step at the line, and when it has
+// depends_on, to duplicate it without its dependencies
+func (s *Server) getDuplicateStepActions(uri protocol.DocumentURI, lines []string, line int) []protocol.CodeAction {
+	var actions []protocol.CodeAction
+	for _, stripDependsOn := range []bool{false, true} {
+		if action := s.createDuplicateStepAction(uri, lines, line, stripDependsOn); action != nil {
+			actions = append(actions, *action)
+		}
+	}
+	return actions
+}
+
+// createDuplicateStepAction copies the innermost step containing the line to just below it,
+// suffixing its keys with -copy, and selects the copy's label for editing. The copy is made
+// by editing the original step and moving the edited lines below it.
+func (s *Server) createDuplicateStepAction(uri protocol.DocumentURI, lines []string, line int, stripDependsOn bool) *protocol.CodeAction {
+	edit, step := stepEditOf(lines, line)
+	if edit == nil || step.Style&yaml.FlowStyle != 0 {
+		return nil
+	}
+	dependsOn := mappingKey(step, "depends_on")
+	if stripDependsOn && dependsOn == nil {
+		return nil
+	}
+
+	// Only steps starting their own list item can be copied line for line
+	first := step.Line - 1
+	if strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(lines[first][:step.Column-1]), "-")) != "" {
+		return nil
+	}
+	last := int(edit.nodeEnd(step).Line)
+
+	// Keys must stay unique, including those of the steps in a copied group
+	taken := takenStepKeys(edit.root)
+	var renameKeys func(step *yaml.Node)
+	renameKeys = func(step *yaml.Node) {
+		for _, field := range []string{"key", "id", "identifier"} {
+			if entry := mappingKey(step, field); entry != nil && entry.value.Kind == yaml.ScalarNode && entry.value.Value != "" {
+				edit.setValue(entry, yamlString(uniqueKey(entry.value.Value+"-copy", taken)))
+				break
+			}
+		}
+		if nested := mappingValue(step, "steps"); nested != nil && nested.Kind == yaml.SequenceNode {
+			for _, nestedStep := range nested.Content {
+				renameKeys(nestedStep)
+			}
+		}
+	}
+	renameKeys(step)
+	if stripDependsOn {
+		edit.deleteEntry(step, dependsOn)
+	}
+	copied := strings.TrimSuffix(applyEditsToLines(lines[first:last+1], first, edit.textEdits()), "\n")
+
+	end := protocol.Position{Line: uint32(last), Character: utf16Length(lines[last])}
+	title := "Duplicate step"
+	if stripDependsOn {
+		title = "Duplicate step without depends_on"
+	}
+	action := quickFix(uri, title, []protocol.TextEdit{{Range: protocol.Range{Start: end, End: end}, NewText: "\n" + copied}})
+	action.Kind = protocol.RefactorRewrite
+
+	if s.ClientFeatures().ShowDocument {
+		selection := copiedLabelRange(copied, last+1)
+		action.Command = &protocol.Command{
+			Title:     "Select the duplicate's label",
+			Command:   SelectRangeCommand,
+			Arguments: []interface{}{string(uri), selection},
+		}
+	}
+	return &action
+}
+
+// takenStepKeys collects the keys of every step in a pipeline, including those in groups
+func takenStepKeys(root *yaml.Node) map[string]bool {
+	taken := make(map[string]bool)
+	var collect func(list *yaml.Node)
+	collect = func(list *yaml.Node) {
+		if list == nil || list.Kind != yaml.SequenceNode {
+			return
+		}
+		for _, step := range list.Content {
+			if key := stepNodeKey(step); key != "" {
+				taken[key] = true
+			}
+			collect(mappingValue(step, "steps"))
+		}
+	}
+	if root.Kind == yaml.MappingNode {
+		collect(mappingValue(root, "steps"))
+	}
+	return taken
+}
+
+// applyEditsToLines applies edits made to a document to a run of its lines starting at the
+// given line, returning the edited text
+func applyEditsToLines(lines []string, first int, edits []protocol.TextEdit) string {
+	sorted := append([]protocol.TextEdit(nil), edits...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i].Range.Start, sorted[j].Range.Start
+		return a.Line > b.Line || (a.Line == b.Line && a.Character > b.Character)
+	})
+
+	content := strings.Join(lines, "\n")
+	shift := func(position protocol.Position) protocol.Position {
+		position.Line -= uint32(first)
+		return position
+	}
+	for _, edit := range sorted {
+		start := offsetAt(content, shift(edit.Range.Start))
+		end := max(offsetAt(content, shift(edit.Range.End)), start)
+		content = content[:start] + edit.NewText + content[end:]
+	}
+	return content
+}
+
+// copiedLabelRange is the range of the label's text in a step copied to the given line, or
+// the start of its first key when it has no label
+func copiedLabelRange(copied string, line int) protocol.Range {
+	copiedLines := splitLines(copied)
+	at := func(node *yaml.Node, offset, length int) protocol.Range {
+		text := copiedLines[node.Line-1]
+		start := min(node.Column-1+offset, len(text))
+		end := min(start+length, len(text))
+		return protocol.Range{
+			Start: protocol.Position{Line: uint32(line + node.Line - 1), Character: utf16Length(text[:start])},
+			End:   protocol.Position{Line: uint32(line + node.Line - 1), Character: utf16Length(text[:end])},
+		}
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte(copied), &root); err != nil || len(root.Content) == 0 ||
+		root.Content[0].Kind != yaml.SequenceNode || len(root.Content[0].Content) == 0 {
+		return protocol.Range{Start: protocol.Position{Line: uint32(line)}, End: protocol.Position{Line: uint32(line)}}
+	}
+	step := root.Content[0].Content[0]
+
+	for _, field := range stepLabelFields {
+		value := mappingValue(step, field)
+		if value == nil || value.Kind != yaml.ScalarNode || value.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+			continue
+		}
+		// Inside the quotes, so typing over the selection keeps them
+		if value.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0 {
+			return at(value, 1, len(value.Value))
+		}
+		return at(value, 0, len(value.Value))
+	}
+	return at(step, 0, 0)
+}
+
+// selectRange asks the client to select a range of a document. The client answers on the
+// connection the command arrived on, so the answer isn't waited for.
+func (s *Server) selectRange(arguments []interface{}) error {
+	if len(arguments) != 2 {
+		return fmt.Errorf("%s expects a document URI and a range", SelectRangeCommand)
+	}
+	uri, ok := arguments[0].(string)
+	if !ok {
+		return fmt.Errorf("%s expects a document URI, got %v", SelectRangeCommand, arguments[0])
+	}
+	selection, err := rangeArgument(arguments[1])
+	if err != nil {
+		return fmt.Errorf("%s expects a range: %w", SelectRangeCommand, err)
+	}
+	if s.conn == nil {
+		return fmt.Errorf("no client connection to select the range in")
+	}
+
+	go func() {
+		var result protocol.ShowDocumentResult
+		params := protocol.ShowDocumentParams{URI: protocol.URI(uri), TakeFocus: true, Selection: &selection}
+		if _, err := s.conn.Call(context.Background(), "window/showDocument", params, &result); err != nil {
+			s.logger.Printf("Failed to select range: %v", err)
+		}
+	}()
+	return nil
+}
+
+// rangeArgument reads a command argument holding an LSP range
+func rangeArgument(argument interface{}) (protocol.Range, error) {
+	var r protocol.Range
+	if typed, ok := argument.(protocol.Range); ok {
+		return typed, nil
+	}
+	object, ok := argument.(map[string]interface{})
+	if !ok || object["start"] == nil || object["end"] == nil {
+		return r, fmt.Errorf("got %v", argument)
+	}
+
+	data, err := json.Marshal(object)
+	if err != nil {
+		return r, err
+	}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return r, fmt.Errorf("got %v", argument)
+	}
+	return r, nil
+}
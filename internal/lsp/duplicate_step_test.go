@@ -0,0 +1,155 @@
+package lsp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+// duplicateStepActionsAt returns the duplicate step actions offered at a line of a document
+func duplicateStepActionsAt(t *testing.T, server *Server, uri protocol.DocumentURI, content string, line uint32) map[string]protocol.CodeAction {
+	t.Helper()
+	server.documentManager.OpenDocument(uri, 1, content)
+
+	position := protocol.Position{Line: line, Character: 4}
+	actions, err := server.CodeAction(context.Background(), &protocol.CodeActionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Range:        protocol.Range{Start: position, End: position},
+	})
+	if err != nil {
+		t.Fatalf("CodeAction failed: %v", err)
+	}
+
+	found := make(map[string]protocol.CodeAction)
+	for _, action := range actions {
+		if strings.HasPrefix(action.Title, "Duplicate step") {
+			found[action.Title] = action
+		}
+	}
+	return found
+}
+
+func TestServer_DuplicateStepAction(t *testing.T) {
+	content := `steps:
+  - key: build
+    label: "Build"
+    command: make
+  - label: Test
+    key: test
+    depends_on: build
+    command: make test
+  - label: Test-copy
+    key: test-copy
+    command: make test`
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+
+	t.Run("copies the step below itself", func(t *testing.T) {
+		server := newTestServer()
+		actions := duplicateStepActionsAt(t, server, uri, content, 1)
+		if _, ok := actions["Duplicate step without depends_on"]; ok {
+			t.Error("Did not expect a variant without depends_on for a step without it")
+		}
+		action, ok := actions["Duplicate step"]
+		if !ok {
+			t.Fatalf("Expected a duplicate step action, got %+v", actions)
+		}
+
+		expected := "    command: make\n  - key: build-copy\n    label: \"Build\"\n    command: make\n  - label: Test\n"
+		if updated := applyTextEdits(content, action.Edit.Changes[uri]); !strings.Contains(updated, expected) {
+			t.Errorf("Expected the document to contain:\n%s\ngot:\n%s", expected, updated)
+		}
+
+		// The label's text, inside its quotes
+		if action.Command == nil || action.Command.Command != SelectRangeCommand || len(action.Command.Arguments) != 2 {
+			t.Fatalf("Expected a command selecting the label, got %+v", action.Command)
+		}
+		selection, err := rangeArgument(action.Command.Arguments[1])
+		if err != nil {
+			t.Fatalf("Expected a range argument: %v", err)
+		}
+		want := protocol.Range{Start: protocol.Position{Line: 5, Character: 12}, End: protocol.Position{Line: 5, Character: 17}}
+		if selection != want {
+			t.Errorf("Expected the label selected at %+v, got %+v", want, selection)
+		}
+	})
+
+	t.Run("keeps keys unique and strips depends_on", func(t *testing.T) {
+		server := newTestServer()
+		actions := duplicateStepActionsAt(t, server, uri, content, 6)
+
+		action, ok := actions["Duplicate step"]
+		if !ok {
+			t.Fatalf("Expected a duplicate step action, got %+v", actions)
+		}
+		expected := "    command: make test\n  - label: Test\n    key: test-copy-2\n    depends_on: build\n"
+		if updated := applyTextEdits(content, action.Edit.Changes[uri]); !strings.Contains(updated, expected) {
+			t.Errorf("Expected the document to contain:\n%s\ngot:\n%s", expected, updated)
+		}
+
+		action, ok = actions["Duplicate step without depends_on"]
+		if !ok {
+			t.Fatalf("Expected a variant without depends_on, got %+v", actions)
+		}
+		expected = "    command: make test\n  - label: Test\n    key: test-copy-2\n    command: make test\n  - label: Test-copy\n"
+		if updated := applyTextEdits(content, action.Edit.Changes[uri]); !strings.Contains(updated, expected) {
+			t.Errorf("Expected the document to contain:\n%s\ngot:\n%s", expected, updated)
+		}
+	})
+
+	t.Run("without showDocument support", func(t *testing.T) {
+		server := newTestServer()
+		server.SetClientFeatures(ClientFeatures{})
+		action := duplicateStepActionsAt(t, server, uri, content, 1)["Duplicate step"]
+		if action.Command != nil {
+			t.Errorf("Expected no selection command, got %+v", action.Command)
+		}
+	})
+}
+
+func TestServer_DuplicateGroupedStep(t *testing.T) {
+	content := `steps:
+  - group: Tests
+    key: tests
+    steps:
+      - label: Unit
+        key: unit
+        command: make unit
+  - wait`
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	server := newTestServer()
+
+	action, ok := duplicateStepActionsAt(t, server, uri, content, 5)["Duplicate step"]
+	if !ok {
+		t.Fatal("Expected a duplicate step action within the group")
+	}
+	expected := "        command: make unit\n      - label: Unit\n        key: unit-copy\n        command: make unit\n  - wait"
+	if updated := applyTextEdits(content, action.Edit.Changes[uri]); !strings.Contains(updated, expected) {
+		t.Errorf("Expected the document to contain:\n%s\ngot:\n%s", expected, updated)
+	}
+
+	// Copying the group renames the keys of its steps too
+	action, ok = duplicateStepActionsAt(t, server, uri, content, 2)["Duplicate step"]
+	if !ok {
+		t.Fatal("Expected a duplicate step action on the group")
+	}
+	expected = "  - group: Tests\n    key: tests-copy\n    steps:\n      - label: Unit\n        key: unit-copy\n"
+	if updated := applyTextEdits(content, action.Edit.Changes[uri]); !strings.Contains(updated, expected) {
+		t.Errorf("Expected the document to contain:\n%s\ngot:\n%s", expected, updated)
+	}
+}
+
+func TestRangeArgument(t *testing.T) {
+	want := protocol.Range{Start: protocol.Position{Line: 1, Character: 2}, End: protocol.Position{Line: 1, Character: 5}}
+	decoded := map[string]interface{}{
+		"start": map[string]interface{}{"line": float64(1), "character": float64(2)},
+		"end":   map[string]interface{}{"line": float64(1), "character": float64(5)},
+	}
+	if got, err := rangeArgument(decoded); err != nil || got != want {
+		t.Errorf("rangeArgument(%v) = %+v, %v", decoded, got, err)
+	}
+	if _, err := rangeArgument("1:2"); err == nil {
+		t.Error("Expected an error for a string argument")
+	}
+}
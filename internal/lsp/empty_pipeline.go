@@ -0,0 +1,123 @@
+package lsp
+
+import (
+	"fmt"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+
+	bkcontext "github.com/mcncl/buildkite-ls/internal/context"
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+// stepScaffolds are the step types offered as list items at the top of an empty steps list,
+// the command step first
+var stepScaffolds = []protocol.CompletionItem{
+	listItemCompletions["steps"],
+	listItemCompletion("wait step", "Add a wait step to the list",
+		"Insert a wait step, which waits for the steps above it to finish", "- wait"),
+	listItemCompletion("block step", "Add a block step to the list",
+		"Insert a block step, which pauses the build until someone unblocks it", "- block: \"${1:Release?}\"\n  key: \"${2:release}\""),
+	listItemCompletion("input step", "Add an input step to the list",
+		"Insert an input step, which asks for details before the build continues", "- input: \"${1:Release details}\"\n  fields:\n    - text: \"${2:Version}\"\n      key: \"${3:version}\""),
+	listItemCompletion("trigger step", "Add a trigger step to the list",
+		"Insert a trigger step, which starts a build of another pipeline", "- trigger: \"${1:pipeline-slug}\"\n  label: \"${2:label}\""),
+	listItemCompletion("group step", "Add a group step to the list",
+		"Insert a group step, which shows the steps it holds together", "- group: \"${1:label}\"\n  steps:\n    - command: \"${2:command}\""),
+}
+
+// stepScaffoldCompletions returns the step scaffolds, in order
+func stepScaffoldCompletions() []protocol.CompletionItem {
+	items := make([]protocol.CompletionItem, len(stepScaffolds))
+	for i, item := range stepScaffolds {
+		item.SortText = fmt.Sprintf("00-list-item-%d", i)
+		items[i] = item
+	}
+	items[0].SortText = "00-list-item"
+	return items
+}
+
+// emptyStepsDiagnostic is the single hint published for a pipeline whose steps list has no
+// steps yet, in place of the schema's errors about it
+func emptyStepsDiagnostic(pipeline *parser.Pipeline) (protocol.Diagnostic, bool) {
+	root := pipeline.YAMLNode
+	if root == nil || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return protocol.Diagnostic{}, false
+	}
+	steps := mappingKey(root.Content[0], "steps")
+	if steps == nil || !hasNoSteps(steps.value) {
+		return protocol.Diagnostic{}, false
+	}
+	return nodeDiagnostic(steps.key, protocol.DiagnosticSeverityInformation, "empty-pipeline",
+		"The pipeline has no steps yet. Add one on the line below steps, where completion offers each type of step"), true
+}
+
+// hasNoSteps reports whether a steps value is empty: null, `[]`, or only list items without
+// a step, such as a `- ` being typed
+func hasNoSteps(steps *yaml.Node) bool {
+	switch {
+	case steps.Kind == yaml.ScalarNode:
+		return steps.Tag == "!!null"
+	case steps.Kind != yaml.SequenceNode:
+		return false
+	}
+	for _, step := range steps.Content {
+		if !isImplicitNull(step) {
+			return false
+		}
+	}
+	return true
+}
+
+// isEmptyStepsList reports whether the cursor line is the top of a steps list with no steps:
+// the lines between it and the steps key are blank, and so is the rest of the list
+func isEmptyStepsList(lines []string, line int) bool {
+	if line >= len(lines) {
+		return false
+	}
+	keyLine := -1
+	for i := line - 1; i >= 0; i-- {
+		if trimmed := strings.TrimSpace(lines[i]); trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			keyLine = i
+			break
+		}
+	}
+	if keyLine < 0 || yamlKey(lines[keyLine]) != "steps" || strings.TrimSpace(strings.SplitN(lines[keyLine], ":", 2)[1]) != "" {
+		return false
+	}
+
+	keyIndent := indentOf(lines[keyLine])
+	for _, next := range lines[line+1:] {
+		trimmed := strings.TrimSpace(next)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		// A list item at or under the key's indentation is a step already in the list
+		return !(strings.HasPrefix(trimmed, "-") && indentOf(next) >= keyIndent)
+	}
+	return true
+}
+
+// getEmptyStepsArrayCompletions offers the step scaffolds on a `steps: []` line, each
+// replacing the empty flow list with a block list holding the new step
+func (cp *CompletionProvider) getEmptyStepsArrayCompletions(posCtx *bkcontext.PositionContext) ([]protocol.CompletionItem, bool) {
+	key, value, found := strings.Cut(posCtx.CurrentLine, ":")
+	if !found || strings.TrimSpace(key) != "steps" || strings.TrimSpace(value) != "[]" || posCtx.CharIndex < len(key)+1 {
+		return nil, false
+	}
+
+	replace := protocol.Range{
+		Start: protocol.Position{Line: posCtx.Position.Line, Character: uint32(len(key) + 1)},
+		End:   protocol.Position{Line: posCtx.Position.Line, Character: uint32(len(posCtx.CurrentLine))},
+	}
+	items := stepScaffoldCompletions()
+	for i, item := range items {
+		newText := "\n  " + strings.ReplaceAll(item.InsertText, "\n", "\n  ")
+		items[i].TextEdit = &protocol.TextEdit{Range: replace, NewText: newText}
+		items[i].InsertText = ""
+		// Clients filter items by the text they replace
+		items[i].FilterText = value
+	}
+	return items, true
+}
@@ -0,0 +1,81 @@
+package lsp
+
+import (
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+func TestServer_EmptyPipeline(t *testing.T) {
+	server := newTestServer()
+
+	for _, content := range []string{
+		"steps: []\n",
+		"env:\n  CI: \"true\"\nsteps:\n",
+		"steps:\n  - \n",
+	} {
+		diagnostics := server.Diagnose(content)
+		if len(diagnostics) != 1 {
+			t.Fatalf("Expected a single diagnostic for %q, got %+v", content, diagnostics)
+		}
+		got := diagnostics[0]
+		if got.Code != "empty-pipeline" || got.Severity != protocol.DiagnosticSeverityInformation {
+			t.Errorf("Expected an empty-pipeline hint for %q, got %+v", content, got)
+		}
+		if line := strings.Split(content, "\n")[got.Range.Start.Line]; !strings.HasPrefix(line, "steps:") {
+			t.Errorf("Expected the hint on the steps key for %q, got line %q", content, line)
+		}
+	}
+
+	if diagnostics := server.Diagnose("steps:\n  - label: \"Build\"\n    command: make\n"); len(diagnostics) != 0 {
+		t.Errorf("Expected no diagnostics once the pipeline has a step, got %+v", diagnostics)
+	}
+}
+
+func TestCompletionProvider_StepScaffolds(t *testing.T) {
+	provider := newTestCompletionProvider()
+	expected := []string{"- (add step)", "- (add wait step)", "- (add block step)", "- (add input step)", "- (add trigger step)", "- (add group step)"}
+
+	labels := func(completions []protocol.CompletionItem) []string {
+		var labels []string
+		for _, completion := range completions {
+			labels = append(labels, completion.Label)
+		}
+		return labels
+	}
+
+	t.Run("top of an empty steps list", func(t *testing.T) {
+		completions := provider.GetCompletions(blockStepPositionContext("env:\n  CI: \"true\"\nsteps:\n  "))
+		if got := labels(completions); strings.Join(got, ",") != strings.Join(expected, ",") {
+			t.Fatalf("Expected %v, got %v", expected, got)
+		}
+		if completions[2].InsertText != "- block: \"${1:Release?}\"\n  key: \"${2:release}\"" {
+			t.Errorf("Expected a block step scaffold, got %q", completions[2].InsertText)
+		}
+	})
+
+	t.Run("steps list with a step", func(t *testing.T) {
+		completions := provider.GetCompletions(blockStepPositionContext("steps:\n  - command: make\n  "))
+		if got := labels(completions); strings.Join(got, ",") != "- (add step)" {
+			t.Errorf("Expected only the step list item below an existing step, got %v", got)
+		}
+	})
+
+	t.Run("empty flow list", func(t *testing.T) {
+		posCtx := blockStepPositionContext("steps: []")
+		posCtx.Position.Character, posCtx.CharIndex = 8, 8
+		completions := provider.GetCompletions(posCtx)
+		if got := labels(completions); strings.Join(got, ",") != strings.Join(expected, ",") {
+			t.Fatalf("Expected %v, got %v", expected, got)
+		}
+
+		edit := completions[1].TextEdit
+		if edit == nil || edit.Range.Start.Character != 6 || edit.Range.End.Character != 9 || edit.NewText != "\n  - wait" {
+			t.Errorf("Expected the wait step to replace the empty list, got %+v", edit)
+		}
+		if updated := applyTextEdits("steps: []", []protocol.TextEdit{*completions[0].TextEdit}); !strings.HasPrefix(updated, "steps:\n  - label: ") {
+			t.Errorf("Expected a block list holding a command step, got %q", updated)
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package lsp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+// validateEnvValueTypes warns on env values YAML reads as booleans or numbers. They are
+// turned back into strings for the job, but not always as written: `1.10` becomes "1.1".
+func (s *Server) validateEnvValueTypes(pipeline *parser.Pipeline) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	root := pipeline.YAMLNode
+	if root == nil || len(root.Content) == 0 {
+		return diagnostics
+	}
+	root = root.Content[0]
+
+	diagnostics = append(diagnostics, unquotedEnvValueDiagnostics(mappingValue(root, "env"))...)
+
+	var walkSteps func(steps *yaml.Node)
+	walkSteps = func(steps *yaml.Node) {
+		if steps == nil || steps.Kind != yaml.SequenceNode {
+			return
+		}
+		for _, step := range steps.Content {
+			diagnostics = append(diagnostics, unquotedEnvValueDiagnostics(mappingValue(step, "env"))...)
+			// Trigger steps pass env to the build they create
+			if build := mappingValue(step, "build"); build != nil {
+				diagnostics = append(diagnostics, unquotedEnvValueDiagnostics(mappingValue(build, "env"))...)
+			}
+			walkSteps(mappingValue(step, "steps"))
+		}
+	}
+	walkSteps(mappingValue(root, "steps"))
+
+	return diagnostics
+}
+
+// unquotedEnvValueDiagnostics flags the plain boolean and number values of an env mapping
+func unquotedEnvValueDiagnostics(env *yaml.Node) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+	if env == nil || env.Kind != yaml.MappingNode {
+		return diagnostics
+	}
+
+	for i := 0; i+1 < len(env.Content); i += 2 {
+		name, value := env.Content[i], env.Content[i+1]
+		if value.Kind != yaml.ScalarNode || value.Style != 0 {
+			continue
+		}
+
+		var message string
+		switch value.Tag {
+		case "!!bool":
+			message = fmt.Sprintf("%s is the boolean %s, passed to the job as the string %q", name.Value, value.Value, strings.ToLower(value.Value))
+		case "!!int", "!!float":
+			message = fmt.Sprintf("%s is a number, passed to the job as a string", name.Value)
+			if coerced := coercedNumber(value); coerced != value.Value {
+				message = fmt.Sprintf("%s is the number %s, passed to the job as %q rather than %q", name.Value, value.Value, coerced, value.Value)
+			}
+		default:
+			continue
+		}
+
+		line, column := uint32(value.Line-1), uint32(value.Column-1)
+		diagnostics = append(diagnostics, protocol.Diagnostic{
+			Range: protocol.Range{
+				Start: protocol.Position{Line: line, Character: column},
+				End:   protocol.Position{Line: line, Character: column + uint32(len(value.Value))},
+			},
+			Severity: protocol.DiagnosticSeverityWarning,
+			Message:  message + ". Quote it to keep the value as written.",
+			Source:   "buildkite-ls",
+			Code:     "unquoted-env-value",
+		})
+	}
+
+	return diagnostics
+}
+
+// coercedNumber is how a YAML number reads once decoded and turned back into a string
+func coercedNumber(value *yaml.Node) string {
+	var decoded interface{}
+	if err := value.Decode(&decoded); err != nil {
+		return value.Value
+	}
+	switch number := decoded.(type) {
+	case int:
+		return strconv.Itoa(number)
+	case float64:
+		return strconv.FormatFloat(number, 'f', -1, 64)
+	default:
+		return fmt.Sprint(number)
+	}
+}
+
+// createQuoteEnvValueAction wraps an unquoted env value in double quotes
+func (s *Server) createQuoteEnvValueAction(uri protocol.DocumentURI, lines []string, diagnostic protocol.Diagnostic) *protocol.CodeAction {
+	start, end := diagnostic.Range.Start, diagnostic.Range.End
+	if int(start.Line) >= len(lines) || int(end.Character) > len(lines[start.Line]) || start.Character > end.Character {
+		return nil
+	}
+	value := lines[start.Line][start.Character:end.Character]
+
+	return &protocol.CodeAction{
+		Title:       fmt.Sprintf("Quote env value %s", value),
+		Kind:        protocol.QuickFix,
+		Diagnostics: []protocol.Diagnostic{diagnostic},
+		IsPreferred: true,
+		Edit: &protocol.WorkspaceEdit{
+			Changes: map[protocol.DocumentURI][]protocol.TextEdit{
+				uri: {{Range: diagnostic.Range, NewText: strconv.Quote(value)}},
+			},
+		},
+	}
+}
@@ -0,0 +1,105 @@
+package lsp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+func TestServer_UnquotedEnvValues(t *testing.T) {
+	server := newTestServer()
+
+	content := `env:
+  DEBUG: true
+  NAME: "app"
+steps:
+  - label: "Build"
+    key: "build"
+    command: make
+    env:
+      GO_VERSION: 1.10
+      RETRIES: 3
+      QUOTED: "1.10"
+  - trigger: "deploy"
+    build:
+      env:
+        DRY_RUN: False`
+
+	var env []protocol.Diagnostic
+	for _, diagnostic := range server.Diagnose(content) {
+		if diagnostic.Code == "unquoted-env-value" {
+			env = append(env, diagnostic)
+		}
+	}
+
+	expected := []struct {
+		line, char uint32
+		message    string
+	}{
+		{1, 9, `DEBUG is the boolean true, passed to the job as the string "true"`},
+		{8, 18, `GO_VERSION is the number 1.10, passed to the job as "1.1" rather than "1.10"`},
+		{9, 15, "RETRIES is a number, passed to the job as a string"},
+		{14, 17, `DRY_RUN is the boolean False, passed to the job as the string "false"`},
+	}
+
+	if len(env) != len(expected) {
+		t.Fatalf("Expected %d diagnostics, got %+v", len(expected), env)
+	}
+	for i, want := range expected {
+		got := env[i]
+		if got.Range.Start.Line != want.line || got.Range.Start.Character != want.char {
+			t.Errorf("Diagnostic %d: expected %d:%d, got %d:%d", i, want.line, want.char, got.Range.Start.Line, got.Range.Start.Character)
+		}
+		if !strings.Contains(got.Message, want.message) {
+			t.Errorf("Diagnostic %d: expected message containing %q, got %q", i, want.message, got.Message)
+		}
+	}
+}
+
+func TestServer_QuoteEnvValueAction(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	content := `steps:
+  - label: "Build"
+    key: "build"
+    command: make
+    env:
+      GO_VERSION: 1.10 # keep in sync with go.mod`
+	server.documentManager.OpenDocument(uri, 1, content)
+
+	var diagnostics []protocol.Diagnostic
+	for _, diagnostic := range server.Diagnose(content) {
+		if diagnostic.Code == "unquoted-env-value" {
+			diagnostics = append(diagnostics, diagnostic)
+		}
+	}
+	if len(diagnostics) != 1 {
+		t.Fatalf("Expected a single unquoted-env-value diagnostic, got %+v", diagnostics)
+	}
+
+	actions, err := server.CodeAction(context.Background(), &protocol.CodeActionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Range:        diagnostics[0].Range,
+		Context:      protocol.CodeActionContext{Diagnostics: diagnostics},
+	})
+	if err != nil {
+		t.Fatalf("CodeAction failed: %v", err)
+	}
+
+	var quoteAction *protocol.CodeAction
+	for i := range actions {
+		if actions[i].Title == "Quote env value 1.10" {
+			quoteAction = &actions[i]
+		}
+	}
+	if quoteAction == nil {
+		t.Fatalf("Expected 'Quote env value 1.10' action, got %+v", actions)
+	}
+
+	fixed := applyTextEdit(content, quoteAction.Edit.Changes[uri][0])
+	if !strings.Contains(fixed, `GO_VERSION: "1.10" # keep in sync with go.mod`) {
+		t.Errorf("Expected the value quoted, got:\n%s", fixed)
+	}
+}
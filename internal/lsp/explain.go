@@ -0,0 +1,317 @@
+package lsp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ExplainDiagnosticCommand returns a longer explanation of a diagnostic, with examples and
+// links, for clients to show in a panel. Its argument is the diagnostic's code, or the
+// diagnostic itself.
+const ExplainDiagnosticCommand = "buildkite.explainDiagnostic"
+
+// DiagnosticExplanation is the explanation of a diagnostic code
+type DiagnosticExplanation struct {
+	Code  string `json:"code"`
+	Title string `json:"title"`
+	// Markdown is the explanation, ready to render
+	Markdown string `json:"markdown"`
+}
+
+// docLink is a link to documentation about a diagnostic
+type docLink struct {
+	Title string
+	URL   string
+}
+
+// diagnosticExplanation is what the server knows about a diagnostic code beyond its message
+type diagnosticExplanation struct {
+	Title   string
+	Details string
+	// Wrong and Right are YAML examples of the problem and its fix
+	Wrong string
+	Right string
+	Links []docLink
+}
+
+var (
+	commandStepDocs  = docLink{"Command step", "https://buildkite.com/docs/pipelines/configure/step-types/command-step"}
+	waitStepDocs     = docLink{"Wait step", "https://buildkite.com/docs/pipelines/configure/step-types/wait-step"}
+	blockStepDocs    = docLink{"Block step", "https://buildkite.com/docs/pipelines/configure/step-types/block-step"}
+	definingStepDocs = docLink{"Defining steps", "https://buildkite.com/docs/pipelines/configure/defining-steps"}
+	dependenciesDocs = docLink{"Dependencies", "https://buildkite.com/docs/pipelines/configure/dependencies"}
+	envDocs          = docLink{"Environment variables", "https://buildkite.com/docs/pipelines/configure/environment-variables"}
+	uploadDocs       = docLink{"Pipeline upload", "https://buildkite.com/docs/agent/v3/cli-pipeline"}
+	artifactDocs     = docLink{"Artifacts", "https://buildkite.com/docs/pipelines/configure/artifacts"}
+	dockerPluginDocs = docLink{"Docker plugin", "https://github.com/buildkite-plugins/docker-buildkite-plugin"}
+	pluginsDocs      = docLink{"Using plugins", "https://buildkite.com/docs/pipelines/integrations/plugins/using"}
+	conditionalsDocs = docLink{"Using conditionals", "https://buildkite.com/docs/pipelines/configure/conditionals"}
+)
+
+// diagnosticExplanations are the diagnostic codes with longer explanations, by code
+var diagnosticExplanations = map[string]diagnosticExplanation{
+	"unquoted-env-value": {
+		Title: "Unquoted env value",
+		Details: "Environment variables are always strings, but YAML reads unquoted values such as `true`, `1.10` or `0755` as booleans and numbers. " +
+			"Buildkite turns them back into strings, which isn't always the text you wrote: `1.10` becomes `1.1`, and `yes` becomes `true`. Quoting the value keeps it as written.",
+		Wrong: "env:\n  GO_VERSION: 1.10\n  DEBUG: yes",
+		Right: "env:\n  GO_VERSION: \"1.10\"\n  DEBUG: \"yes\"",
+		Links: []docLink{envDocs},
+	},
+	"missing-label": {
+		Title:   "Step without a label",
+		Details: "Steps without a `label` are shown in the Buildkite UI by their command, which is hard to scan when commands are long or similar. A short label names what the step does.",
+		Wrong:   "steps:\n  - command: ./scripts/ci/run-tests.sh --shard 1",
+		Right:   "steps:\n  - label: \":test_tube: Tests\"\n    command: ./scripts/ci/run-tests.sh --shard 1",
+		Links:   []docLink{commandStepDocs},
+	},
+	"use-label-not-name": {
+		Title:   "`name` instead of `label`",
+		Details: "`name` is an old alias of `label`. It still works, but `label` is what the documentation and the rest of the pipeline schema use.",
+		Wrong:   "steps:\n  - name: Build\n    command: make",
+		Right:   "steps:\n  - label: Build\n    command: make",
+		Links:   []docLink{commandStepDocs},
+	},
+	"missing-step-type": {
+		Title:   "Step without a type",
+		Details: "Every step needs a key saying what kind of step it is: `command` (or `commands`), `wait`, `block`, `input`, `trigger` or `group`. Without one Buildkite rejects the pipeline when it's uploaded.",
+		Wrong:   "steps:\n  - label: Build\n    agents:\n      queue: default",
+		Right:   "steps:\n  - label: Build\n    command: make\n    agents:\n      queue: default",
+		Links:   []docLink{definingStepDocs},
+	},
+	"multiple-step-types": {
+		Title:   "Step with several types",
+		Details: "A step can only be one kind of step. With both `command` and `block`, for example, it isn't clear which one is meant, and Buildkite rejects the pipeline. Split it into a step of each type.",
+		Wrong:   "steps:\n  - block: Deploy?\n    command: ./deploy.sh",
+		Right:   "steps:\n  - block: Deploy?\n  - command: ./deploy.sh",
+		Links:   []docLink{definingStepDocs},
+	},
+	"empty-pipeline": {
+		Title:   "Pipeline without steps",
+		Details: "The pipeline has a `steps` list with nothing in it yet. Uploading it does nothing. Completion on the line below `steps` offers a scaffold for each type of step.",
+		Wrong:   "steps: []",
+		Right:   "steps:\n  - label: Build\n    command: make",
+		Links:   []docLink{definingStepDocs},
+	},
+	"dangling-depends-on": {
+		Title: "Dependency on a removed step",
+		Details: "A `depends_on` entry names a step key that was in the document when it was opened but isn't any more, usually because the step was deleted or its key renamed. " +
+			"Buildkite fails the upload when a dependency doesn't exist. Depend on the step's new key, or remove the dependency.",
+		Wrong: "steps:\n  - key: compile   # renamed from build\n    command: make\n  - command: make test\n    depends_on: build",
+		Right: "steps:\n  - key: compile\n    command: make\n  - command: make test\n    depends_on: compile",
+		Links: []docLink{dependenciesDocs},
+	},
+	"invalid-condition": {
+		Title: "Condition that doesn't parse",
+		Details: "A step's `if:` is a Buildkite conditional, not shell or another language: it compares with `==`, `!=`, `=~` and `!~`, and combines with `&&`, `||` and `!`. " +
+			"Buildkite rejects the pipeline when its conditions don't parse, so a stray `=`, `and` or unclosed parenthesis fails the upload.",
+		Wrong: "steps:\n  - command: ./deploy.sh\n    if: build.branch = \"main\" and !build.pull_request.draft",
+		Right: "steps:\n  - command: ./deploy.sh\n    if: build.branch == \"main\" && !build.pull_request.draft",
+		Links: []docLink{conditionalsDocs},
+	},
+	"unknown-condition-variable": {
+		Title: "Unknown variable in a condition",
+		Details: "Conditionals can only use the variables Buildkite provides, such as `build.branch`, `build.tag` and `pipeline.default_branch`, and the `build.env()` function for environment variables. " +
+			"A misspelt variable fails the upload instead of evaluating, and environment variables have to be read with `build.env(\"NAME\")`.",
+		Wrong: "steps:\n  - command: ./deploy.sh\n    if: build.brach == \"main\"",
+		Right: "steps:\n  - command: ./deploy.sh\n    if: build.branch == \"main\"",
+		Links: []docLink{conditionalsDocs},
+	},
+	"plugin-path-not-found": {
+		Title: "Plugin path that doesn't exist",
+		Details: "A plugin option that takes a file, such as docker-compose's `config`, names a path that isn't in the checkout. Agents run plugins from the checkout root, so paths are relative to it, not to the pipeline file. " +
+			"The plugin fails when the job runs. Reported only with the `validatePluginPaths` setting on, as files may be generated by earlier commands.",
+		Wrong: "steps:\n  - plugins:\n      - docker-compose#v5.0.0:\n          config: ../docker-compose.yml   # relative to .buildkite/",
+		Right: "steps:\n  - plugins:\n      - docker-compose#v5.0.0:\n          config: docker-compose.yml",
+		Links: []docLink{pluginsDocs},
+	},
+	"unknown-dependency": {
+		Title: "Dependency on a step that doesn't exist",
+		Details: "A `depends_on` entry names a key no step in the pipeline, or in the workspace's other pipeline files, defines. Buildkite only finds out once the build runs, and the step can never start. " +
+			"Steps can only be depended on by their `key`, not their label, so give the step a key or fix the typo.",
+		Wrong: "steps:\n  - label: Build\n    command: make\n  - command: make test\n    depends_on: build",
+		Right: "steps:\n  - label: Build\n    key: build\n    command: make\n  - command: make test\n    depends_on: build",
+		Links: []docLink{dependenciesDocs},
+	},
+	"missing-depends-on": {
+		Title: "Step that may run before what it needs",
+		Details: "The step reads an artifact or meta-data that a single earlier step produces, but nothing makes it wait for that step. Steps without dependencies run in parallel, so it may start first and find nothing. " +
+			"Add `depends_on` with the producing step's key, or a `wait` step between them.",
+		Wrong: "steps:\n  - key: build\n    command: make\n    artifact_paths: dist/*\n  - command: buildkite-agent artifact download dist/* .",
+		Right: "steps:\n  - key: build\n    command: make\n    artifact_paths: dist/*\n  - command: buildkite-agent artifact download dist/* .\n    depends_on: build",
+		Links: []docLink{dependenciesDocs, artifactDocs},
+	},
+	"redundant-depends-on": {
+		Title:   "Dependency a wait step already implies",
+		Details: "Steps after a `wait` already wait for every step before it, so a `depends_on` on one of those steps changes nothing. Removing it keeps the dependencies that matter easy to see.",
+		Wrong:   "steps:\n  - key: build\n    command: make\n  - wait\n  - command: make test\n    depends_on: build",
+		Right:   "steps:\n  - key: build\n    command: make\n  - wait\n  - command: make test",
+		Links:   []docLink{dependenciesDocs, waitStepDocs},
+	},
+	"artifact-path-separator": {
+		Title:   "Artifact globs separated by commas",
+		Details: "`artifact_paths` separates globs with `;`, or takes a list. Commas are part of the glob, so `dist/*,logs/*` matches no files and nothing is uploaded.",
+		Wrong:   "artifact_paths: \"dist/*,logs/*\"",
+		Right:   "artifact_paths:\n  - \"dist/*\"\n  - \"logs/*\"",
+		Links:   []docLink{artifactDocs},
+	},
+	"artifact-never-uploaded": {
+		Title:   "Download of an artifact nothing uploads",
+		Details: "The step downloads artifacts matching a path that no earlier step uploads, through `artifact_paths`, `buildkite-agent artifact upload` or the artifacts plugin. The download fails, or finds nothing, when the step runs. Check the path against the uploading step's.",
+		Wrong:   "steps:\n  - command: make\n    artifact_paths: build/*\n  - wait\n  - command: buildkite-agent artifact download dist/* .",
+		Right:   "steps:\n  - command: make\n    artifact_paths: build/*\n  - wait\n  - command: buildkite-agent artifact download build/* .",
+		Links:   []docLink{artifactDocs},
+	},
+	"dedented-block-scalar": {
+		Title: "Script line outside its block",
+		Details: "A `command: |` block holds the lines indented under it. A line indented less than the first one ends the block, and YAML then tries to read it as a key, which usually fails with a syntax error further down. " +
+			"Indent the line to match the rest of the script.",
+		Wrong: "steps:\n  - command: |\n      make\n    make test",
+		Right: "steps:\n  - command: |\n      make\n      make test",
+		Links: []docLink{commandStepDocs},
+	},
+	"agent-step-env-interpolation": {
+		Title: "Step env variable interpolated on upload",
+		Details: "`$VAR` and `${VAR}` in the pipeline are substituted when it's uploaded, from the environment of the upload, not the step's own `env`, which only applies when the step runs. " +
+			"The variable is empty at upload time. Set it in the pipeline's `env` or where the pipeline is uploaded, or write `$$VAR` to leave it for the agent.",
+		Wrong: "steps:\n  - command: make\n    env:\n      QUEUE: deploy\n    agents:\n      queue: ${QUEUE}",
+		Right: "env:\n  QUEUE: deploy\nsteps:\n  - command: make\n    agents:\n      queue: ${QUEUE}",
+		Links: []docLink{uploadDocs, envDocs},
+	},
+	"invalid-interpolation": {
+		Title:   "Broken interpolation",
+		Details: "`${` starts an interpolation, which needs a variable name and a closing `}`. Pipeline upload fails on one that isn't closed. Write `$$` for a literal `$`.",
+		Wrong:   "agents:\n  queue: \"${QUEUE\"",
+		Right:   "agents:\n  queue: \"${QUEUE}\"",
+		Links:   []docLink{uploadDocs},
+	},
+	"pipeline-setting-key": {
+		Title:   "Pipeline setting in the YAML",
+		Details: "Settings such as `skip_intermediate_builds` and `default_branch` belong to the pipeline in Buildkite, configured in its settings page or through the API. Buildkite ignores them in the pipeline YAML.",
+		Wrong:   "skip_intermediate_builds: true\nsteps:\n  - command: make",
+		Right:   "# Set skip_intermediate_builds in the pipeline's settings\nsteps:\n  - command: make",
+		Links:   []docLink{definingStepDocs},
+	},
+	"invalid-exit-status": {
+		Title:   "Invalid exit status",
+		Details: "`exit_status` takes an integer exit code, a list of them, `-1` for jobs that didn't exit normally, or `\"*\"` for any status. A quoted number is a string, which never matches.",
+		Wrong:   "retry:\n  automatic:\n    - exit_status: \"1\"",
+		Right:   "retry:\n  automatic:\n    - exit_status: 1",
+		Links:   []docLink{commandStepDocs},
+	},
+	"invalid-retry-limit": {
+		Title:   "Retry limit out of bounds",
+		Details: "An automatic retry rule retries a job from 1 to 10 times. Buildkite rejects other limits when the pipeline is uploaded.",
+		Wrong:   "retry:\n  automatic:\n    - exit_status: -1\n      limit: 20",
+		Right:   "retry:\n  automatic:\n    - exit_status: -1\n      limit: 10",
+		Links:   []docLink{commandStepDocs},
+	},
+	"unshown-retry-reason": {
+		Title:   "Retry reason that's never shown",
+		Details: "`retry.manual.reason` explains why a job can't be retried, so Buildkite only shows it when `allowed` is `false`.",
+		Wrong:   "retry:\n  manual:\n    permit_on_passed: false\n    reason: Deploys only run once",
+		Right:   "retry:\n  manual:\n    allowed: false\n    reason: Deploys only run once",
+		Links:   []docLink{commandStepDocs},
+	},
+	"noop-wait": {
+		Title:   "Wait step that waits for nothing",
+		Details: "A `wait` step at the start or end of the pipeline, or right after another wait, has no steps to wait for or none to hold back. It can be removed.",
+		Wrong:   "steps:\n  - wait\n  - command: make",
+		Right:   "steps:\n  - command: make",
+		Links:   []docLink{waitStepDocs},
+	},
+	"wait-label-looks-like-block": {
+		Title:   "Wait step asking for approval",
+		Details: "A `wait` step only waits for the steps before it to finish, it never asks anyone. A label like `Deploy to production?` suggests a `block` step was meant, which pauses the build until someone unblocks it.",
+		Wrong:   "steps:\n  - wait: \"Deploy to production?\"",
+		Right:   "steps:\n  - block: \"Deploy to production?\"",
+		Links:   []docLink{waitStepDocs, blockStepDocs},
+	},
+	"reserved-field-key": {
+		Title:   "Field key reserved by Buildkite",
+		Details: "Block and input step fields store their values as build meta-data under their `key`. Keys starting with `buildkite` are reserved for the meta-data Buildkite sets itself.",
+		Wrong:   "fields:\n  - text: Version\n    key: buildkite-version",
+		Right:   "fields:\n  - text: Version\n    key: release-version",
+		Links:   []docLink{blockStepDocs},
+	},
+	"invalid-docker-environment": {
+		Title: "Docker plugin environment that isn't a list",
+		Details: "The docker plugin's `environment` is a list of `KEY=value` entries, or `KEY` to pass the variable through from the job. Unlike `env` it isn't a mapping, and `- KEY: value` is a mapping inside the list. " +
+			"The step's own `env` isn't passed into the container unless it's listed here or `propagate-environment` is on.",
+		Wrong: "plugins:\n  - docker#v5.13.0:\n      image: node:20\n      environment:\n        NODE_ENV: test",
+		Right: "plugins:\n  - docker#v5.13.0:\n      image: node:20\n      environment:\n        - NODE_ENV=test",
+		Links: []docLink{dockerPluginDocs},
+	},
+	"invalid-docker-option": {
+		Title:   "Invalid docker plugin option",
+		Details: "Options such as `propagate-environment` and `mount-checkout` take `true` or `false`, and a quoted `\"true\"` is a string. `workdir` is a path inside the container, so it has to be absolute.",
+		Wrong:   "plugins:\n  - docker#v5.13.0:\n      image: node:20\n      propagate-environment: \"true\"\n      workdir: app",
+		Right:   "plugins:\n  - docker#v5.13.0:\n      image: node:20\n      propagate-environment: true\n      workdir: /app",
+		Links:   []docLink{dockerPluginDocs},
+	},
+	"duplicate-plugin": {
+		Title:   "Plugin listed twice in a step",
+		Details: "Every entry in a step's `plugins` runs the plugin's hooks, so a plugin listed twice runs twice. Put all of its options in one entry.",
+		Wrong:   "plugins:\n  - docker#v5.13.0:\n      image: node:20\n  - docker#v5.13.0:\n      workdir: /app",
+		Right:   "plugins:\n  - docker#v5.13.0:\n      image: node:20\n      workdir: /app",
+		Links:   []docLink{pluginsDocs},
+	},
+	"plugin-version-conflict": {
+		Title:   "Two versions of a plugin in a step",
+		Details: "The step lists the same plugin twice, pinned to different versions. Both versions are checked out and both run their hooks, which rarely works. Pin one version in a single entry.",
+		Wrong:   "plugins:\n  - docker#v5.13.0:\n      image: node:20\n  - docker#v5.12.0:\n      workdir: /app",
+		Right:   "plugins:\n  - docker#v5.13.0:\n      image: node:20\n      workdir: /app",
+		Links:   []docLink{pluginsDocs},
+	},
+	"yaml-syntax-error": {
+		Title:   "YAML syntax error",
+		Details: "The document isn't valid YAML, so nothing else in it can be checked. The most common causes are tabs used for indentation, a `:` followed by a space inside an unquoted value, and lines indented differently from their siblings.",
+		Wrong:   "steps:\n  - command: echo Result: done",
+		Right:   "steps:\n  - command: \"echo Result: done\"",
+		Links:   []docLink{definingStepDocs},
+	},
+}
+
+// explainDiagnostic returns the explanation of the diagnostic code in the command's
+// arguments: the code itself, or a diagnostic with a code
+func explainDiagnostic(arguments []interface{}) (*DiagnosticExplanation, error) {
+	if len(arguments) != 1 {
+		return nil, fmt.Errorf("%s expects a diagnostic code", ExplainDiagnosticCommand)
+	}
+
+	var code string
+	switch argument := arguments[0].(type) {
+	case string:
+		code = argument
+	case map[string]interface{}:
+		code, _ = argument["code"].(string)
+	}
+	if code == "" {
+		return nil, fmt.Errorf("%s expects a diagnostic code, got %v", ExplainDiagnosticCommand, arguments[0])
+	}
+
+	explanation, ok := diagnosticExplanations[code]
+	if !ok {
+		return nil, fmt.Errorf("no explanation for diagnostic %s", code)
+	}
+	return &DiagnosticExplanation{Code: code, Title: explanation.Title, Markdown: explanation.markdown(code)}, nil
+}
+
+// markdown renders the explanation, with its examples and links
+func (e diagnosticExplanation) markdown(code string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n`%s`\n\n%s\n", e.Title, code, e.Details)
+	if e.Wrong != "" {
+		fmt.Fprintf(&b, "\n**Instead of**\n\n```yaml\n%s\n```\n", e.Wrong)
+	}
+	if e.Right != "" {
+		fmt.Fprintf(&b, "\n**Write**\n\n```yaml\n%s\n```\n", e.Right)
+	}
+	if len(e.Links) > 0 {
+		b.WriteString("\n**Learn more**\n\n")
+		for _, link := range e.Links {
+			fmt.Fprintf(&b, "- [%s](%s)\n", link.Title, link.URL)
+		}
+	}
+	return b.String()
+}
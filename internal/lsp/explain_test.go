@@ -0,0 +1,71 @@
+package lsp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+)
+
+func TestServer_ExplainDiagnosticCommand(t *testing.T) {
+	server := newTestServer()
+
+	for name, argument := range map[string]interface{}{
+		"code":       "unquoted-env-value",
+		"diagnostic": map[string]interface{}{"code": "unquoted-env-value", "message": "DEBUG is the boolean true"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			result, err := server.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{
+				Command:   ExplainDiagnosticCommand,
+				Arguments: []interface{}{argument},
+			})
+			if err != nil {
+				t.Fatalf("Expected an explanation, got %v", err)
+			}
+
+			explanation, ok := result.(*DiagnosticExplanation)
+			if !ok || explanation.Code != "unquoted-env-value" || explanation.Title != "Unquoted env value" {
+				t.Fatalf("Expected the unquoted env value explained, got %+v", result)
+			}
+			for _, expected := range []string{
+				"# Unquoted env value",
+				"**Instead of**\n\n```yaml\nenv:\n  GO_VERSION: 1.10",
+				"**Write**\n\n```yaml\nenv:\n  GO_VERSION: \"1.10\"",
+				"- [Environment variables](https://buildkite.com/docs/",
+			} {
+				if !strings.Contains(explanation.Markdown, expected) {
+					t.Errorf("Expected the explanation to contain %q, got:\n%s", expected, explanation.Markdown)
+				}
+			}
+		})
+	}
+
+	for name, arguments := range map[string][]interface{}{
+		"unknown code": {"not-a-diagnostic"},
+		"no code":      {map[string]interface{}{"message": "Something"}},
+		"no arguments": nil,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := server.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{
+				Command:   ExplainDiagnosticCommand,
+				Arguments: arguments,
+			}); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestDiagnosticExplanations(t *testing.T) {
+	for code, explanation := range diagnosticExplanations {
+		if explanation.Title == "" || explanation.Details == "" || len(explanation.Links) == 0 {
+			t.Errorf("Expected %s to have a title, details and links", code)
+		}
+		var node yaml.Node
+		if err := yaml.Unmarshal([]byte(explanation.Right), &node); err != nil {
+			t.Errorf("Expected the fixed example of %s to be valid YAML, got %v", code, err)
+		}
+	}
+}
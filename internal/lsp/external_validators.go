@@ -0,0 +1,185 @@
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.lsp.dev/protocol"
+
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+// externalValidatorProtocolVersion is sent with every request, so validators can reject
+// requests in a format they don't understand
+const externalValidatorProtocolVersion = 1
+
+// defaultExternalValidatorTimeout bounds validators that don't set timeoutMs
+const defaultExternalValidatorTimeout = 2 * time.Second
+
+// ExternalValidator is an executable run over every pipeline to add organization-specific
+// diagnostics. It reads an externalValidatorRequest as JSON on stdin and writes an
+// externalValidatorResponse as JSON on stdout, exiting 0.
+type ExternalValidator struct {
+	// Name is the diagnostics' source, defaulting to the command's base name
+	Name string `json:"name"`
+	// Command is the executable, found on PATH or relative to the repository root
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	// TimeoutMs is how long the validator may run before it's killed, 2000 by default
+	TimeoutMs int `json:"timeoutMs"`
+}
+
+// externalValidatorRequest is written to a validator's stdin
+type externalValidatorRequest struct {
+	Version int    `json:"version"`
+	URI     string `json:"uri"`
+	// Path is the pipeline's file path, or "" for documents that aren't files
+	Path string `json:"path"`
+	// Content is the pipeline's YAML, for validators that need line numbers
+	Content string `json:"content"`
+	// Pipeline is the parsed pipeline
+	Pipeline json.RawMessage `json:"pipeline"`
+}
+
+// externalValidatorResponse is read from a validator's stdout. Diagnostics use the LSP shape,
+// with zero-based lines and characters.
+type externalValidatorResponse struct {
+	Diagnostics []protocol.Diagnostic `json:"diagnostics"`
+}
+
+// source names the validator in diagnostics and warnings
+func (v ExternalValidator) source() string {
+	if v.Name != "" {
+		return v.Name
+	}
+	return filepath.Base(v.Command)
+}
+
+// timeout is how long the validator may run
+func (v ExternalValidator) timeout() time.Duration {
+	if v.TimeoutMs > 0 {
+		return time.Duration(v.TimeoutMs) * time.Millisecond
+	}
+	return defaultExternalValidatorTimeout
+}
+
+// runExternalValidators runs the configured validators over a pipeline that parses, and
+// returns the diagnostics they report. A validator that fails is skipped, and the user is
+// warned once per session.
+func (s *Server) runExternalValidators(ctx context.Context, uri protocol.DocumentURI, content string) []protocol.Diagnostic {
+	validators := s.Settings().ExternalValidators
+	if len(validators) == 0 {
+		return nil
+	}
+
+	pipeline, err := parser.ParseYAML([]byte(content))
+	if err != nil {
+		return nil
+	}
+
+	path, _ := uriPath(uri)
+	request, err := json.Marshal(externalValidatorRequest{
+		Version:  externalValidatorProtocolVersion,
+		URI:      string(uri),
+		Path:     path,
+		Content:  content,
+		Pipeline: pipeline.JSONBytes,
+	})
+	if err != nil {
+		return nil
+	}
+
+	dir := s.scriptRoot(uri)
+
+	var diagnostics []protocol.Diagnostic
+	for _, validator := range validators {
+		if validator.Command == "" {
+			continue
+		}
+		reported, err := runExternalValidator(ctx, validator, dir, request)
+		if err != nil {
+			s.warnExternalValidatorFailure(validator, err)
+			continue
+		}
+		diagnostics = append(diagnostics, reported...)
+	}
+	return diagnostics
+}
+
+// runExternalValidator runs one validator in dir and reads its diagnostics
+func runExternalValidator(ctx context.Context, validator ExternalValidator, dir string, request []byte) ([]protocol.Diagnostic, error) {
+	ctx, cancel := context.WithTimeout(ctx, validator.timeout())
+	defer cancel()
+
+	command := validator.Command
+	if dir != "" && strings.ContainsRune(command, filepath.Separator) && !filepath.IsAbs(command) {
+		command = filepath.Join(dir, command)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command, validator.Args...)
+	cmd.Dir = dir
+	cmd.Stdin = bytes.NewReader(request)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Don't wait on children of the validator still holding its output open once it's killed
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("timed out after %s", validator.timeout())
+		}
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%w: %s", err, message)
+		}
+		return nil, err
+	}
+
+	var response externalValidatorResponse
+	if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+
+	for i := range response.Diagnostics {
+		diagnostic := &response.Diagnostics[i]
+		if diagnostic.Source == "" {
+			diagnostic.Source = validator.source()
+		}
+		if diagnostic.Severity == 0 {
+			diagnostic.Severity = protocol.DiagnosticSeverityWarning
+		}
+		if diagnostic.Range.End.Line < diagnostic.Range.Start.Line ||
+			(diagnostic.Range.End.Line == diagnostic.Range.Start.Line && diagnostic.Range.End.Character < diagnostic.Range.Start.Character) {
+			diagnostic.Range.End = diagnostic.Range.Start
+		}
+	}
+	return response.Diagnostics, nil
+}
+
+// warnExternalValidatorFailure tells the user, once per validator per session, that a
+// validator couldn't be run, so its rules aren't being checked
+func (s *Server) warnExternalValidatorFailure(validator ExternalValidator, err error) {
+	s.settingsMu.Lock()
+	warned := s.externalValidatorWarnings[validator.Command]
+	s.externalValidatorWarnings[validator.Command] = true
+	s.settingsMu.Unlock()
+
+	s.logger.Printf("External validator %s failed: %v", validator.source(), err)
+	if warned || s.conn == nil {
+		return
+	}
+
+	params := protocol.ShowMessageParams{
+		Type:    protocol.MessageTypeWarning,
+		Message: fmt.Sprintf("External validator %s failed: %v. Its rules aren't being checked.", validator.source(), err),
+	}
+	if err := s.conn.Notify(context.Background(), "window/showMessage", params); err != nil {
+		s.logger.Printf("Failed to send external validator warning: %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+)
+
+// writeValidator writes a shell script validator into dir
+func writeValidator(t *testing.T, dir, name, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("validator scripts need a POSIX shell")
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestServer_RunExternalValidators(t *testing.T) {
+	// The space is escaped in the pipeline's URI, but not in the path validators are given
+	dir := filepath.Join(t.TempDir(), "my repo")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	requestPath := filepath.Join(dir, "request.json")
+	writeValidator(t, dir, "no-latest-tags", `cat > "`+requestPath+`"
+echo '{"diagnostics": [
+  {"range": {"start": {"line": 2, "character": 4}, "end": {"line": 2, "character": 30}}, "message": "Pin the image tag", "code": "no-latest"},
+  {"range": {"start": {"line": 1, "character": 4}, "end": {"line": 1, "character": 0}}, "severity": 1, "source": "acme", "message": "Label needs an emoji"}
+]}'
+`)
+	writeValidator(t, dir, "broken", "echo 'rules file missing' >&2\nexit 3\n")
+
+	server := newTestServer()
+	server.applySettings(parseSettings(map[string]interface{}{
+		"externalValidators": []interface{}{
+			map[string]interface{}{"command": "./no-latest-tags"},
+			map[string]interface{}{"name": "acme-broken", "command": "./broken"},
+		},
+	}))
+	server.SetWorkspaceRoots([]string{dir})
+
+	content := `steps:
+  - label: Build
+    image: node:latest
+    command: make`
+	uri := uri.File(filepath.Join(dir, "pipeline.yml"))
+
+	diagnostics := server.runExternalValidators(context.Background(), uri, content)
+	if len(diagnostics) != 2 {
+		t.Fatalf("Expected 2 diagnostics from the working validator, got %+v", diagnostics)
+	}
+
+	first := diagnostics[0]
+	if first.Source != "no-latest-tags" || first.Severity != protocol.DiagnosticSeverityWarning || first.Code != "no-latest" {
+		t.Errorf("Expected a warning sourced from the command name, got %+v", first)
+	}
+	if first.Range.Start.Line != 2 || first.Range.End.Character != 30 {
+		t.Errorf("Expected the validator's range, got %+v", first.Range)
+	}
+	second := diagnostics[1]
+	if second.Source != "acme" || second.Severity != protocol.DiagnosticSeverityError {
+		t.Errorf("Expected the validator's own source and severity, got %+v", second)
+	}
+	if second.Range.End != second.Range.Start {
+		t.Errorf("Expected an inverted range to collapse to its start, got %+v", second.Range)
+	}
+
+	data, err := os.ReadFile(requestPath)
+	if err != nil {
+		t.Fatalf("Expected the validator to receive a request: %v", err)
+	}
+	var request struct {
+		Version  int    `json:"version"`
+		URI      string `json:"uri"`
+		Path     string `json:"path"`
+		Content  string `json:"content"`
+		Pipeline struct {
+			Steps []map[string]interface{} `json:"steps"`
+		} `json:"pipeline"`
+	}
+	if err := json.Unmarshal(data, &request); err != nil {
+		t.Fatalf("Expected a JSON request, got %s: %v", data, err)
+	}
+	if request.Version != 1 || request.URI != string(uri) || request.Path != filepath.Join(dir, "pipeline.yml") || request.Content != content {
+		t.Errorf("Expected the document in the request, got %+v", request)
+	}
+	if len(request.Pipeline.Steps) != 1 || request.Pipeline.Steps[0]["image"] != "node:latest" {
+		t.Errorf("Expected the parsed pipeline in the request, got %+v", request.Pipeline)
+	}
+
+	if !server.externalValidatorWarnings["./broken"] {
+		t.Errorf("Expected the failing validator to be recorded as warned about")
+	}
+}
+
+func TestServer_RunExternalValidators_Timeout(t *testing.T) {
+	dir := t.TempDir()
+	writeValidator(t, dir, "slow", "sleep 5\n")
+
+	server := newTestServer()
+	server.applySettings(parseSettings(map[string]interface{}{
+		"externalValidators": []interface{}{
+			map[string]interface{}{"command": filepath.Join(dir, "slow"), "timeoutMs": 100},
+		},
+	}))
+
+	diagnostics := server.runExternalValidators(context.Background(), "file:///test/pipeline.yml", "steps:\n  - command: make")
+	if len(diagnostics) != 0 {
+		t.Errorf("Expected no diagnostics from a validator that timed out, got %+v", diagnostics)
+	}
+	if !server.externalValidatorWarnings[filepath.Join(dir, "slow")] {
+		t.Errorf("Expected the slow validator to be recorded as warned about")
+	}
+}
+
+func TestServer_RunExternalValidators_SkipsInvalidYAML(t *testing.T) {
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "ran")
+	writeValidator(t, dir, "validator", `touch "`+marker+`"
+echo '{"diagnostics": []}'
+`)
+
+	server := newTestServer()
+	server.applySettings(parseSettings(map[string]interface{}{
+		"externalValidators": []interface{}{map[string]interface{}{"command": filepath.Join(dir, "validator")}},
+	}))
+
+	server.runExternalValidators(context.Background(), "file:///test/pipeline.yml", "steps:\n  - command: [make")
+	if _, err := os.Stat(marker); err == nil {
+		t.Errorf("Expected validators not to run on YAML that doesn't parse")
+	}
+}
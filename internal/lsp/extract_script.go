@@ -0,0 +1,405 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+)
+
+// ExtractScriptCommand is the command behind the "Extract command to script" refactor.
+// Its arguments are the document URI and the line of the step's command.
+const ExtractScriptCommand = "buildkite.extractCommandToScript"
+
+// scriptsDir is where extracted scripts are written, relative to the repository root
+const scriptsDir = ".buildkite/scripts"
+
+// minExtractableCommandLines is how many lines a command needs before extracting it is offered
+const minExtractableCommandLines = 2
+
+// scriptNameInvalidChars matches characters that don't belong in a script file name
+var scriptNameInvalidChars = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// scriptExtraction describes moving a step's multi-line command into a script file
+type scriptExtraction struct {
+	// ScriptPath is the absolute path of the new script
+	ScriptPath string
+	// Invocation is the command that replaces the inline script
+	Invocation string
+	// Script is the content of the new script
+	Script string
+	// Replace is the range of the `command: |` block in the pipeline
+	Replace protocol.Range
+}
+
+// createFileEdit is a workspace edit whose document changes mix file creation with text edits.
+// protocol.WorkspaceEdit only models text document edits, so it is built by hand.
+type createFileEdit struct {
+	DocumentChanges []interface{} `json:"documentChanges"`
+}
+
+// applyCreateFileEditParams are the parameters of a workspace/applyEdit request carrying a createFileEdit
+type applyCreateFileEditParams struct {
+	Label string         `json:"label,omitempty"`
+	Edit  createFileEdit `json:"edit"`
+}
+
+// getExtractScriptActions offers to move a long `command: |` block of the step under the
+// cursor into its own script file
+func (s *Server) getExtractScriptActions(params *protocol.CodeActionParams, doc *Document) []protocol.CodeAction {
+	if !s.ClientFeatures().CreateFiles {
+		return nil
+	}
+
+	extraction := s.planScriptExtraction(params.TextDocument.URI, doc.Lines, int(params.Range.Start.Line))
+	if extraction == nil {
+		return nil
+	}
+
+	// Never offer to replace a script that already exists
+	if _, err := os.Stat(extraction.ScriptPath); err == nil {
+		return nil
+	}
+
+	title := fmt.Sprintf("Extract command to %s", extraction.Invocation)
+	return []protocol.CodeAction{
+		{
+			Title: title,
+			Kind:  protocol.RefactorExtract,
+			Command: &protocol.Command{
+				Title:     title,
+				Command:   ExtractScriptCommand,
+				Arguments: []interface{}{string(params.TextDocument.URI), extraction.Replace.Start.Line},
+			},
+		},
+	}
+}
+
+// ExecuteCommand runs the server-side half of code actions that can't be expressed as a plain edit
+func (s *Server) ExecuteCommand(ctx context.Context, params *protocol.ExecuteCommandParams) (interface{}, error) {
+	switch params.Command {
+	case ExtractScriptCommand:
+		if len(params.Arguments) != 2 {
+			return nil, fmt.Errorf("%s expects a document URI and a line", ExtractScriptCommand)
+		}
+		uri, ok := params.Arguments[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("%s expects a document URI, got %v", ExtractScriptCommand, params.Arguments[0])
+		}
+		line, ok := params.Arguments[1].(float64)
+		if !ok {
+			return nil, fmt.Errorf("%s expects a line number, got %v", ExtractScriptCommand, params.Arguments[1])
+		}
+		return nil, s.extractCommandToScript(protocol.DocumentURI(uri), int(line))
+	case ImportCommand:
+		if len(params.Arguments) != 1 {
+			return nil, fmt.Errorf("%s expects the path of a CI file", ImportCommand)
+		}
+		path, ok := params.Arguments[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("%s expects a path, got %v", ImportCommand, params.Arguments[0])
+		}
+		return s.importPipeline(path)
+	case InsertWaitAfterStepCommand, InsertBlockAfterStepCommand:
+		return s.insertStepAfterCommand(params.Command, params.Arguments)
+	case SelectRangeCommand:
+		return nil, s.selectRange(params.Arguments)
+	case ToggleSkipCommand:
+		return s.toggleSkipCommand(params.Arguments)
+	case ExplainDiagnosticCommand:
+		return explainDiagnostic(params.Arguments)
+	default:
+		return nil, fmt.Errorf("unknown command: %s", params.Command)
+	}
+}
+
+// applyEdit sends the client a workspace/applyEdit request and calls done with nil once the
+// client has applied the edit, or with why it didn't. Requests are handled one at a time, the
+// next starting once the current one replies, so the command replies first and the edit is
+// waited for in the background rather than holding up every request behind it.
+func (s *Server) applyEdit(params interface{}, done func(error)) {
+	go func() {
+		var response protocol.ApplyWorkspaceEditResponse
+		_, err := s.conn.Call(context.Background(), "workspace/applyEdit", params, &response)
+		if err == nil && !response.Applied {
+			err = fmt.Errorf("client did not apply the edit: %s", response.FailureReason)
+		}
+		done(err)
+	}()
+}
+
+// extractCommandToScript asks the client to create the script and rewrite the step, then
+// marks the new script executable once the client has applied the edit
+func (s *Server) extractCommandToScript(uri protocol.DocumentURI, line int) error {
+	doc, exists := s.documentManager.GetDocument(uri)
+	if !exists {
+		return fmt.Errorf("document not open: %s", uri)
+	}
+
+	extraction := s.planScriptExtraction(uri, doc.Lines, line)
+	if extraction == nil {
+		return fmt.Errorf("no multi-line command to extract on line %d", line+1)
+	}
+
+	if s.conn == nil {
+		return fmt.Errorf("no client connection to apply the edit")
+	}
+
+	params := applyCreateFileEditParams{
+		Label: "Extract command to script",
+		Edit:  extraction.workspaceEdit(uri, doc.Version),
+	}
+	s.applyEdit(params, func(err error) {
+		if err == nil {
+			err = makeExecutable(extraction.ScriptPath)
+		}
+		if err != nil {
+			s.logger.Printf("Failed to extract command to script: %v", err)
+		}
+	})
+	return nil
+}
+
+// workspaceEdit creates the script with its content and replaces the inline command
+func (e *scriptExtraction) workspaceEdit(documentURI protocol.DocumentURI, version int32) createFileEdit {
+	scriptURI := uri.File(e.ScriptPath)
+
+	return createFileEdit{
+		DocumentChanges: []interface{}{
+			protocol.CreateFile{
+				Kind: protocol.CreateResourceOperation,
+				URI:  scriptURI,
+			},
+			protocol.TextDocumentEdit{
+				TextDocument: protocol.OptionalVersionedTextDocumentIdentifier{
+					TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: scriptURI},
+				},
+				Edits: []protocol.TextEdit{{NewText: e.Script}},
+			},
+			protocol.TextDocumentEdit{
+				TextDocument: protocol.OptionalVersionedTextDocumentIdentifier{
+					TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: documentURI},
+					Version:                &version,
+				},
+				Edits: []protocol.TextEdit{{
+					Range:   e.Replace,
+					NewText: fmt.Sprintf("command: %q", e.Invocation),
+				}},
+			},
+		},
+	}
+}
+
+// makeExecutable adds the execute bits to a file's permissions
+func makeExecutable(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to mark %s executable: %w", path, err)
+	}
+	return os.Chmod(path, info.Mode().Perm()|0o111)
+}
+
+// planScriptExtraction works out how to extract the `command: |` block of the step containing
+// the line, returning nil when the step has no long enough block or no name for the script
+func (s *Server) planScriptExtraction(uri protocol.DocumentURI, lines []string, line int) *scriptExtraction {
+	stepInfo := innermostStepAt(lines, line)
+	if stepInfo == nil {
+		return nil
+	}
+
+	commandLine, column := -1, -1
+	for i := stepInfo.StartLine; i <= stepInfo.EndLine && i < len(lines); i++ {
+		if yamlKey(lines[i]) != "command" || !s.isStepPropertyLine(lines, stepInfo, i) {
+			continue
+		}
+		_, value, _ := strings.Cut(lines[i], ":")
+		if value = strings.TrimSpace(value); value == "|" || value == "|-" || value == "|+" {
+			commandLine = i
+			column = strings.Index(lines[i], "command")
+		}
+		break
+	}
+	if commandLine < 0 {
+		return nil
+	}
+
+	// The block runs until the first non-blank line that isn't indented past the key
+	lastLine := commandLine
+	for i := commandLine + 1; i <= stepInfo.EndLine && i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == "" {
+			continue
+		}
+		if s.getIndentLevel(lines[i]) <= column {
+			break
+		}
+		lastLine = i
+	}
+
+	body := lines[commandLine+1 : lastLine+1]
+	if countNonBlank(body) < minExtractableCommandLines {
+		return nil
+	}
+
+	name := s.scriptName(lines, stepInfo)
+	root := s.scriptRoot(uri)
+	if name == "" || root == "" {
+		return nil
+	}
+
+	return &scriptExtraction{
+		ScriptPath: filepath.Join(root, scriptsDir, name+".sh"),
+		Invocation: scriptsDir + "/" + name + ".sh",
+		Script:     "#!/usr/bin/env bash\nset -euo pipefail\n\n" + strings.Join(dedent(body), "\n") + "\n",
+		Replace: protocol.Range{
+			Start: protocol.Position{Line: uint32(commandLine), Character: uint32(column)},
+			End:   protocol.Position{Line: uint32(lastLine), Character: uint32(len(lines[lastLine]))},
+		},
+	}
+}
+
+// stepContainingLine returns the line span of the top-level step the line belongs to
+func (s *Server) stepContainingLine(lines []string, line int) *StepInfo {
+	stepLines := s.findStepLines(lines)
+
+	for i := len(stepLines) - 1; i >= 0; i-- {
+		if stepLines[i] > line {
+			continue
+		}
+
+		end := len(lines) - 1
+		if i+1 < len(stepLines) {
+			end = stepLines[i+1] - 1
+		} else {
+			// The last step runs until the next top-level property
+			for j := stepLines[i] + 1; j < len(lines); j++ {
+				if len(lines[j]) > 0 && lines[j][0] != ' ' && lines[j][0] != '\t' {
+					end = j - 1
+					break
+				}
+			}
+		}
+
+		if line > end {
+			return nil
+		}
+		return &StepInfo{StartLine: stepLines[i], EndLine: end}
+	}
+
+	return nil
+}
+
+// innermostStepAt returns the line span of the innermost step the line belongs to, so a
+// command in a step inside a group is found rather than looked for among the group's keys
+func innermostStepAt(lines []string, line int) *StepInfo {
+	edit := newStructuredEdit(lines)
+	if edit == nil {
+		return nil
+	}
+	step := edit.stepAt(line)
+	if step == nil {
+		return nil
+	}
+	return &StepInfo{StartLine: step.Line - 1, EndLine: int(edit.nodeEnd(step).Line)}
+}
+
+// scriptName names the script after the step's key, falling back to its label
+func (s *Server) scriptName(lines []string, stepInfo *StepInfo) string {
+	var key, label string
+	for i := stepInfo.StartLine; i <= stepInfo.EndLine && i < len(lines); i++ {
+		if !s.isStepPropertyLine(lines, stepInfo, i) {
+			continue
+		}
+
+		trimmed := strings.TrimPrefix(strings.TrimSpace(lines[i]), "- ")
+
+		name, value, found := strings.Cut(trimmed, ":")
+		if !found {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		switch strings.TrimSpace(name) {
+		case "key":
+			key = value
+		case "label":
+			label = value
+		}
+	}
+
+	name := key
+	if name == "" {
+		name = label
+	}
+	return strings.Trim(scriptNameInvalidChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// scriptRoot finds the repository root the scripts directory belongs in: the directory holding
+// the pipeline's .buildkite directory, else the workspace root containing the pipeline
+func (s *Server) scriptRoot(uri protocol.DocumentURI) string {
+	path, isFile := uriPath(uri)
+	if !isFile {
+		return ""
+	}
+
+	if index := strings.Index(path, "/.buildkite/"); index >= 0 {
+		return path[:index]
+	}
+
+	s.settingsMu.RLock()
+	roots := s.workspaceRoots
+	s.settingsMu.RUnlock()
+
+	for _, root := range roots {
+		if strings.HasPrefix(path, strings.TrimSuffix(root, "/")+"/") {
+			return root
+		}
+	}
+
+	return filepath.Dir(path)
+}
+
+// isStepPropertyLine reports whether the line holds one of the step's own properties,
+// rather than a key nested in plugin configs or other maps. The step's properties line up
+// with the first one, written after the step's dash.
+func (s *Server) isStepPropertyLine(lines []string, stepInfo *StepInfo, line int) bool {
+	propertyIndent := s.getIndentLevel(strings.Replace(lines[stepInfo.StartLine], "-", " ", 1))
+	return line == stepInfo.StartLine || s.getIndentLevel(lines[line]) == propertyIndent
+}
+
+// dedent removes the indentation shared by every non-blank line
+func dedent(lines []string) []string {
+	common := -1
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if common < 0 || indent < common {
+			common = indent
+		}
+	}
+
+	dedented := make([]string, len(lines))
+	for i, line := range lines {
+		if len(line) >= common && common > 0 {
+			line = line[common:]
+		}
+		dedented[i] = strings.TrimRight(line, " ")
+	}
+	return dedented
+}
+
+// countNonBlank counts the lines with content
+func countNonBlank(lines []string) int {
+	count := 0
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			count++
+		}
+	}
+	return count
+}
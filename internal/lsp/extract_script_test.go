@@ -0,0 +1,338 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.lsp.dev/jsonrpc2"
+	"go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+)
+
+const extractScriptPipeline = `steps:
+  - label: "Build"
+    key: "build-app"
+    command: |
+      echo "--- Building"
+      make build
+
+      make package
+    plugins:
+      - docker#v5.13.0:
+          image: "golang"
+  - label: "Test"
+    command: "make test"`
+
+func TestServer_PlanScriptExtraction(t *testing.T) {
+	server := newTestServer()
+	// The space is escaped in the pipeline's URI
+	root := filepath.Join(t.TempDir(), "my repo")
+	uri := uri.File(filepath.Join(root, ".buildkite", "pipeline.yml"))
+	lines := strings.Split(extractScriptPipeline, "\n")
+
+	extraction := server.planScriptExtraction(uri, lines, 1)
+	if extraction == nil {
+		t.Fatal("Expected the multi-line command to be extractable")
+	}
+
+	if expected := filepath.Join(root, ".buildkite", "scripts", "build-app.sh"); extraction.ScriptPath != expected {
+		t.Errorf("Expected script path %q, got %q", expected, extraction.ScriptPath)
+	}
+	if extraction.Invocation != ".buildkite/scripts/build-app.sh" {
+		t.Errorf("Unexpected invocation %q", extraction.Invocation)
+	}
+
+	expectedScript := "#!/usr/bin/env bash\nset -euo pipefail\n\necho \"--- Building\"\nmake build\n\nmake package\n"
+	if extraction.Script != expectedScript {
+		t.Errorf("Unexpected script:\nexpected: %q\ngot:      %q", expectedScript, extraction.Script)
+	}
+
+	expectedRange := protocol.Range{
+		Start: protocol.Position{Line: 3, Character: 4},
+		End:   protocol.Position{Line: 7, Character: uint32(len(lines[7]))},
+	}
+	if extraction.Replace != expectedRange {
+		t.Errorf("Expected replace range %+v, got %+v", expectedRange, extraction.Replace)
+	}
+
+	if server.planScriptExtraction(uri, lines, 12) != nil {
+		t.Error("Single-line commands should not be extracted")
+	}
+
+	untitled := protocol.DocumentURI("untitled:Untitled-1")
+	if server.planScriptExtraction(untitled, lines, 1) != nil {
+		t.Error("Scripts can't be placed relative to unsaved buffers")
+	}
+}
+
+func TestServer_PlanScriptExtractionInGroup(t *testing.T) {
+	server := newTestServer()
+	lines := strings.Split(`steps:
+  - group: "Tests"
+    key: "tests"
+    steps:
+      - label: "Unit"
+        key: "unit"
+        command: |
+          make deps
+          make unit
+      - label: "Lint"
+        command: "make lint"`, "\n")
+
+	extraction := server.planScriptExtraction("file:///repo/.buildkite/pipeline.yml", lines, 5)
+	if extraction == nil {
+		t.Fatal("Expected the command of the step inside the group to be extractable")
+	}
+	if extraction.Invocation != ".buildkite/scripts/unit.sh" {
+		t.Errorf("Expected a script named after the nested step, got %q", extraction.Invocation)
+	}
+	expectedRange := protocol.Range{
+		Start: protocol.Position{Line: 6, Character: 8},
+		End:   protocol.Position{Line: 8, Character: uint32(len(lines[8]))},
+	}
+	if extraction.Replace != expectedRange {
+		t.Errorf("Expected replace range %+v, got %+v", expectedRange, extraction.Replace)
+	}
+
+	if server.planScriptExtraction("file:///repo/.buildkite/pipeline.yml", lines, 10) != nil {
+		t.Error("Single-line commands inside groups should not be extracted")
+	}
+}
+
+func TestServer_ScriptNameFallsBackToLabel(t *testing.T) {
+	server := newTestServer()
+	lines := strings.Split(`steps:
+  - label: ":docker: Build Images"
+    command: |
+      docker build .
+      docker push`, "\n")
+
+	extraction := server.planScriptExtraction("file:///repo/.buildkite/pipeline.yml", lines, 2)
+	if extraction == nil {
+		t.Fatal("Expected the command to be extractable")
+	}
+	if extraction.Invocation != ".buildkite/scripts/docker-build-images.sh" {
+		t.Errorf("Expected a script named after the label, got %q", extraction.Invocation)
+	}
+}
+
+func TestServer_ExtractScriptCodeAction(t *testing.T) {
+	server := newTestServer()
+	root := t.TempDir()
+	uri := protocol.DocumentURI("file://" + filepath.Join(root, ".buildkite", "pipeline.yml"))
+	server.documentManager.OpenDocument(uri, 3, extractScriptPipeline)
+
+	findAction := func() *protocol.CodeAction {
+		actions, err := server.CodeAction(context.Background(), &protocol.CodeActionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Range:        protocol.Range{Start: protocol.Position{Line: 4}, End: protocol.Position{Line: 4}},
+		})
+		if err != nil {
+			t.Fatalf("CodeAction failed: %v", err)
+		}
+		for i, action := range actions {
+			if action.Kind == protocol.RefactorExtract {
+				return &actions[i]
+			}
+		}
+		return nil
+	}
+
+	action := findAction()
+	if action == nil {
+		t.Fatal("Expected an extract script action")
+	}
+	if action.Title != "Extract command to .buildkite/scripts/build-app.sh" {
+		t.Errorf("Unexpected title %q", action.Title)
+	}
+	if action.Command == nil || action.Command.Command != ExtractScriptCommand {
+		t.Fatalf("Expected the action to run %s, got %+v", ExtractScriptCommand, action.Command)
+	}
+
+	// The script already existing means the refactor would clobber it
+	scriptPath := filepath.Join(root, ".buildkite", "scripts", "build-app.sh")
+	if err := os.MkdirAll(filepath.Dir(scriptPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(scriptPath, []byte("#!/bin/sh\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if findAction() != nil {
+		t.Error("Should not offer to extract over an existing script")
+	}
+	_ = os.Remove(scriptPath)
+
+	features := server.ClientFeatures()
+	features.CreateFiles = false
+	server.SetClientFeatures(features)
+	if findAction() != nil {
+		t.Error("Should not offer the refactor to clients that can't create files")
+	}
+}
+
+func TestScriptExtraction_WorkspaceEdit(t *testing.T) {
+	extraction := &scriptExtraction{
+		ScriptPath: "/my repo/.buildkite/scripts/build.sh",
+		Invocation: ".buildkite/scripts/build.sh",
+		Script:     "#!/usr/bin/env bash\nmake\n",
+		Replace: protocol.Range{
+			Start: protocol.Position{Line: 3, Character: 4},
+			End:   protocol.Position{Line: 5, Character: 10},
+		},
+	}
+
+	data, err := json.Marshal(extraction.workspaceEdit("file:///my%20repo/.buildkite/pipeline.yml", 7))
+	if err != nil {
+		t.Fatalf("Failed to marshal edit: %v", err)
+	}
+
+	var edit struct {
+		DocumentChanges []map[string]interface{} `json:"documentChanges"`
+	}
+	if err := json.Unmarshal(data, &edit); err != nil {
+		t.Fatalf("Failed to unmarshal edit: %v", err)
+	}
+
+	if len(edit.DocumentChanges) != 3 {
+		t.Fatalf("Expected 3 document changes, got %d: %s", len(edit.DocumentChanges), data)
+	}
+	if edit.DocumentChanges[0]["kind"] != "create" || edit.DocumentChanges[0]["uri"] != "file:///my%20repo/.buildkite/scripts/build.sh" {
+		t.Errorf("Expected the script to be created first, got %v", edit.DocumentChanges[0])
+	}
+	if !strings.Contains(string(data), `"newText":"command: \".buildkite/scripts/build.sh\""`) {
+		t.Errorf("Expected the command to be replaced with the script invocation, got %s", data)
+	}
+	if !strings.Contains(string(data), `"version":7`) {
+		t.Errorf("Expected the pipeline edit to carry the document version, got %s", data)
+	}
+}
+
+func TestMakeExecutable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := makeExecutable(path); err != nil {
+		t.Fatalf("makeExecutable failed: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o755 {
+		t.Errorf("Expected mode 0755, got %o", info.Mode().Perm())
+	}
+
+	if err := makeExecutable(filepath.Join(t.TempDir(), "missing.sh")); err == nil {
+		t.Error("Expected an error for a missing script")
+	}
+}
+
+func TestServer_ExtractCommandToScriptAppliesEdit(t *testing.T) {
+	server := newTestServer()
+	ctx := context.Background()
+	root := t.TempDir()
+	uri := protocol.DocumentURI("file://" + filepath.Join(root, ".buildkite", "pipeline.yml"))
+	script := filepath.Join(root, ".buildkite", "scripts", "build-app.sh")
+	server.documentManager.OpenDocument(uri, 1, extractScriptPipeline)
+
+	serverSide, clientSide := net.Pipe()
+	defer serverSide.Close()
+	defer clientSide.Close()
+
+	// The client applies the edit only once the command has replied, as a client handling
+	// one message at a time would
+	returned := make(chan struct{})
+	applied := make(chan applyCreateFileEditParams, 1)
+	client := jsonrpc2.NewConn(jsonrpc2.NewStream(clientSide))
+	client.Go(ctx, func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		if req.Method() != "workspace/applyEdit" {
+			return reply(ctx, nil, nil)
+		}
+		go func() {
+			<-returned
+			var params applyCreateFileEditParams
+			_ = json.Unmarshal(req.Params(), &params)
+			_ = os.MkdirAll(filepath.Dir(script), 0o755)
+			_ = os.WriteFile(script, []byte("make build\n"), 0o644)
+			applied <- params
+			_ = reply(ctx, protocol.ApplyWorkspaceEditResponse{Applied: true}, nil)
+		}()
+		return nil
+	})
+	conn := jsonrpc2.NewConn(jsonrpc2.NewStream(serverSide))
+	conn.Go(ctx, jsonrpc2.MethodNotFoundHandler)
+	server.SetConnection(conn)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := server.ExecuteCommand(ctx, &protocol.ExecuteCommandParams{
+			Command:   ExtractScriptCommand,
+			Arguments: []interface{}{string(uri), float64(3)},
+		})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("ExecuteCommand failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the command to reply without waiting for the client to apply the edit")
+	}
+	close(returned)
+
+	select {
+	case params := <-applied:
+		if params.Label != "Extract command to script" || len(params.Edit.DocumentChanges) != 3 {
+			t.Errorf("Expected the script's creation and the step's rewrite, got %+v", params)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the client to be asked to apply the edit")
+	}
+
+	// The script is marked executable once the client has created it
+	deadline := time.Now().Add(time.Second)
+	for {
+		info, err := os.Stat(script)
+		if err == nil && info.Mode().Perm()&0o111 == 0o111 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the script to be marked executable, got %v, %v", info, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServer_ExecuteCommandArguments(t *testing.T) {
+	server := newTestServer()
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		params protocol.ExecuteCommandParams
+	}{
+		{name: "unknown command", params: protocol.ExecuteCommandParams{Command: "buildkite.unknown"}},
+		{name: "missing arguments", params: protocol.ExecuteCommandParams{Command: ExtractScriptCommand}},
+		{name: "document not open", params: protocol.ExecuteCommandParams{Command: ExtractScriptCommand, Arguments: []interface{}{"file:///repo/.buildkite/pipeline.yml", float64(3)}}},
+		{name: "import without a path", params: protocol.ExecuteCommandParams{Command: ImportCommand}},
+		{name: "import of a missing file", params: protocol.ExecuteCommandParams{Command: ImportCommand, Arguments: []interface{}{"/repo/.github/workflows/missing.yml"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := server.ExecuteCommand(ctx, &tt.params); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package lsp
+
+import (
+	"context"
+	"strings"
+
+	"go.lsp.dev/protocol"
+
+	bkcontext "github.com/mcncl/buildkite-ls/internal/context"
+	"github.com/mcncl/buildkite-ls/internal/plugins"
+)
+
+func (s *Server) FoldingRanges(ctx context.Context, params *protocol.FoldingRangeParams) ([]protocol.FoldingRange, error) {
+	if !s.isBuildkiteFile(string(params.TextDocument.URI)) {
+		return nil, nil
+	}
+
+	doc, exists := s.documentManager.GetDocument(params.TextDocument.URI)
+	if !exists {
+		s.logger.Printf("Document not found: %s", params.TextDocument.URI)
+		return nil, nil
+	}
+
+	return s.computeFoldingRanges(doc.Lines), nil
+}
+
+// computeFoldingRanges folds every block whose following lines are indented further,
+// marking kubernetes podSpec blocks as regions so they can be folded as a unit
+func (s *Server) computeFoldingRanges(lines []string) []protocol.FoldingRange {
+	var ranges []protocol.FoldingRange
+
+	podSpecStarts := make(map[int]bool)
+	for _, block := range s.findPodSpecBlocks(lines) {
+		podSpecStarts[block.start] = true
+	}
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		end := s.blockEnd(lines, i)
+		if end <= i {
+			continue
+		}
+
+		foldingRange := protocol.FoldingRange{
+			StartLine: uint32(i),
+			EndLine:   uint32(end),
+		}
+		if podSpecStarts[i] {
+			foldingRange.Kind = protocol.RegionFoldingRange
+		}
+		ranges = append(ranges, foldingRange)
+	}
+
+	return ranges
+}
+
+// lineRange is an inclusive range of line indexes
+type lineRange struct {
+	start int
+	end   int
+}
+
+// blockEnd returns the last line belonging to the block started at line start,
+// i.e. the last non-blank line indented further than it. List items own the
+// keys indented under their content as well.
+func (s *Server) blockEnd(lines []string, start int) int {
+	indent := s.getIndentLevel(lines[start])
+	if strings.HasPrefix(strings.TrimSpace(lines[start]), "- ") {
+		indent++
+	}
+
+	end := start
+	for j := start + 1; j < len(lines); j++ {
+		trimmed := strings.TrimSpace(lines[j])
+		if trimmed == "" {
+			continue
+		}
+		if s.getIndentLevel(lines[j]) <= indent && !strings.HasPrefix(trimmed, "#") {
+			break
+		}
+		end = j
+	}
+
+	// Don't swallow trailing comments that belong to the next block
+	for end > start && strings.HasPrefix(strings.TrimSpace(lines[end]), "#") {
+		end--
+	}
+
+	return end
+}
+
+// findPodSpecBlocks locates podSpec/podSpecPatch blocks inside kubernetes plugin configs.
+// These hold raw Kubernetes YAML rather than Buildkite properties.
+func (s *Server) findPodSpecBlocks(lines []string) []lineRange {
+	var blocks []lineRange
+
+	for i, line := range lines {
+		key := yamlKey(line)
+		if !plugins.IsPodSpecKey(key) {
+			continue
+		}
+
+		if !plugins.IsKubernetesPlugin(s.parentKey(lines, i)) {
+			continue
+		}
+
+		blocks = append(blocks, lineRange{start: i, end: s.blockEnd(lines, i)})
+	}
+
+	return blocks
+}
+
+// yamlKey returns the mapping key declared on a line, ignoring any list item marker
+func yamlKey(line string) string {
+	trimmed := strings.TrimSpace(line)
+	trimmed = strings.TrimPrefix(trimmed, "- ")
+	if strings.HasPrefix(trimmed, "#") {
+		return ""
+	}
+
+	colonIndex := bkcontext.KeyColon(trimmed)
+	if colonIndex == -1 {
+		return ""
+	}
+	return strings.Trim(strings.TrimSpace(trimmed[:colonIndex]), `"'`)
+}
+
+// parentKey returns the key of the nearest less-indented line above the given line
+func (s *Server) parentKey(lines []string, index int) string {
+	indent := s.getIndentLevel(lines[index])
+	if strings.HasPrefix(strings.TrimSpace(lines[index]), "- ") {
+		return ""
+	}
+
+	for i := index - 1; i >= 0; i-- {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		lineIndent := s.getIndentLevel(lines[i])
+		// Keys on a list item line sit after the "- " marker
+		if strings.HasPrefix(trimmed, "- ") {
+			lineIndent += 2
+			if lineIndent == indent {
+				// Sibling key on the same list item; keep looking above it
+				return ""
+			}
+		}
+
+		if lineIndent < indent {
+			return yamlKey(lines[i])
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,169 @@
+package lsp
+
+import (
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+const kubernetesPipeline = `steps:
+  - label: "Build"
+    command: "make build"
+    plugins:
+      - kubernetes:
+          checkout:
+            cloneFlags: "--depth=1"
+          podSpec:
+            containers:
+              - image: "golang:1.22"
+                resources:
+                  limits:
+                    memory: "1Gi"
+  - wait: ~`
+
+func TestServer_FoldingRanges(t *testing.T) {
+	server := newTestServer()
+	lines := strings.Split(kubernetesPipeline, "\n")
+
+	ranges := server.computeFoldingRanges(lines)
+
+	expected := map[uint32]uint32{
+		0:  13, // steps
+		1:  12, // build step
+		3:  12, // plugins
+		4:  12, // kubernetes
+		5:  6,  // checkout
+		7:  12, // podSpec
+		8:  12, // containers
+		9:  12, // container item
+		10: 12, // resources
+		11: 12, // limits
+	}
+
+	if len(ranges) != len(expected) {
+		t.Fatalf("Expected %d folding ranges, got %d: %+v", len(expected), len(ranges), ranges)
+	}
+
+	for _, r := range ranges {
+		end, ok := expected[r.StartLine]
+		if !ok {
+			t.Errorf("Unexpected folding range starting at line %d", r.StartLine)
+			continue
+		}
+		if r.EndLine != end {
+			t.Errorf("Folding range at line %d: expected end %d, got %d", r.StartLine, end, r.EndLine)
+		}
+
+		if r.StartLine == 7 && r.Kind != protocol.RegionFoldingRange {
+			t.Errorf("Expected podSpec block to be a region, got kind %q", r.Kind)
+		}
+		if r.StartLine != 7 && r.Kind != "" {
+			t.Errorf("Expected plain folding range at line %d, got kind %q", r.StartLine, r.Kind)
+		}
+	}
+}
+
+func TestServer_FindPodSpecBlocks(t *testing.T) {
+	server := newTestServer()
+
+	tests := []struct {
+		name     string
+		content  string
+		expected []lineRange
+	}{
+		{
+			name:     "podSpec in kubernetes plugin",
+			content:  kubernetesPipeline,
+			expected: []lineRange{{start: 7, end: 12}},
+		},
+		{
+			name: "versioned kubernetes plugin with podSpecPatch",
+			content: `steps:
+  - command: "make"
+    plugins:
+      - kubernetes#v1.0.0:
+          podSpecPatch:
+            serviceAccountName: "builder"`,
+			expected: []lineRange{{start: 4, end: 5}},
+		},
+		{
+			name: "podSpec outside kubernetes plugin",
+			content: `steps:
+  - command: "make"
+    plugins:
+      - docker#v5.13.0:
+          podSpec:
+            image: "node"`,
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks := server.findPodSpecBlocks(strings.Split(tt.content, "\n"))
+			if len(blocks) != len(tt.expected) {
+				t.Fatalf("Expected %d podSpec blocks, got %d: %+v", len(tt.expected), len(blocks), blocks)
+			}
+			for i, block := range blocks {
+				if block != tt.expected[i] {
+					t.Errorf("Block %d: expected %+v, got %+v", i, tt.expected[i], block)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_PodSpecSemanticTokens(t *testing.T) {
+	server := newTestServer()
+	lines := strings.Split(kubernetesPipeline, "\n")
+
+	tokens := server.generateSemanticTokens(lines)
+	structIndex := uint32(server.getTokenTypeIndex("struct"))
+
+	// Decode the relative positions and collect the lines carrying struct tokens
+	structLines := make(map[uint32]bool)
+	line := uint32(0)
+	for i := 0; i < len(tokens.Data); i += 5 {
+		line += tokens.Data[i]
+		if tokens.Data[i+3] == structIndex {
+			structLines[line] = true
+		}
+	}
+
+	for _, expected := range []uint32{8, 10, 11, 12} {
+		if !structLines[expected] {
+			t.Errorf("Expected struct token on line %d", expected)
+		}
+	}
+
+	for _, unexpected := range []uint32{5, 6, 7} {
+		if structLines[unexpected] {
+			t.Errorf("Did not expect struct token on line %d", unexpected)
+		}
+	}
+}
+
+func TestServer_PodSpecSemanticTokensRange(t *testing.T) {
+	server := newTestServer()
+	lines := strings.Split(kubernetesPipeline, "\n")
+
+	// The range starts inside the podSpec block, below the kubernetes plugin that owns it
+	tokens := server.generateSemanticTokensForRange(lines, 10, 12)
+	structIndex := uint32(server.getTokenTypeIndex("struct"))
+
+	structLines := make(map[uint32]bool)
+	line := uint32(0)
+	for i := 0; i < len(tokens.Data); i += 5 {
+		line += tokens.Data[i]
+		if tokens.Data[i+3] == structIndex {
+			structLines[line] = true
+		}
+	}
+
+	for _, expected := range []uint32{10, 11, 12} {
+		if !structLines[expected] {
+			t.Errorf("Expected struct token on line %d", expected)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package lsp
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.lsp.dev/protocol"
+
+	"github.com/mcncl/buildkite-ls/internal/context"
+	"github.com/mcncl/buildkite-ls/internal/plugins"
+)
+
+// hostedQueue is a queue served by Buildkite hosted agents
+type hostedQueue struct {
+	Name     string
+	Platform string
+	Size     string
+}
+
+// hostedQueues are the hosted agent queues: `hosted` for the default Linux agents,
+// else `hosted-<platform>-<size>`
+var hostedQueues = []hostedQueue{
+	{"hosted", "linux", "2 vCPU, 4 GB (default)"},
+	{"hosted-linux-small", "linux", "2 vCPU, 4 GB"},
+	{"hosted-linux-medium", "linux", "4 vCPU, 16 GB"},
+	{"hosted-linux-large", "linux", "8 vCPU, 32 GB"},
+	{"hosted-linux-xlarge", "linux", "16 vCPU, 64 GB"},
+	{"hosted-macos-small", "macos", "Apple silicon, 4 vCPU, 7 GB"},
+	{"hosted-macos-medium", "macos", "Apple silicon, 6 vCPU, 14 GB"},
+	{"hosted-macos-large", "macos", "Apple silicon, 12 vCPU, 28 GB"},
+}
+
+// queueValuePattern matches a `queue:` value that is still being typed
+var queueValuePattern = regexp.MustCompile(`^\s*queue:\s*["']?[\w-]*$`)
+
+// dockerPlugins are the plugins that run the step inside containers
+var dockerPlugins = map[string]bool{
+	"docker":         true,
+	"docker-compose": true,
+}
+
+// getHostedQueueCompletions offers the hosted agent queues for an agents `queue:` value
+func (cp *CompletionProvider) getHostedQueueCompletions(posCtx *context.PositionContext) ([]protocol.CompletionItem, bool) {
+	beforeCursor := posCtx.CurrentLine
+	if posCtx.CharIndex <= len(beforeCursor) {
+		beforeCursor = beforeCursor[:posCtx.CharIndex]
+	}
+
+	if !queueValuePattern.MatchString(beforeCursor) || enclosingKey(posCtx.ContextLines) != "agents" {
+		return nil, false
+	}
+
+	items := make([]protocol.CompletionItem, 0, len(hostedQueues))
+	for i, queue := range hostedQueues {
+		items = append(items, protocol.CompletionItem{
+			Label:    queue.Name,
+			Kind:     protocol.CompletionItemKindValue,
+			Detail:   fmt.Sprintf("Buildkite hosted %s agent, %s", platformName(queue.Platform), queue.Size),
+			SortText: fmt.Sprintf("%02d", i),
+		})
+	}
+	return items, true
+}
+
+// enclosingKey returns the key of the nearest less-indented line above the last line
+func enclosingKey(lines []string) string {
+	if line := enclosingKeyLine(lines); line >= 0 {
+		return yamlKey(lines[line])
+	}
+	return ""
+}
+
+// enclosingKeyLine returns the index of the nearest less-indented line above the last line, or -1
+func enclosingKeyLine(lines []string) int {
+	if len(lines) == 0 {
+		return -1
+	}
+
+	current := lines[len(lines)-1]
+	indent := len(current) - len(strings.TrimLeft(current, " \t"))
+
+	for i := len(lines) - 2; i >= 0; i-- {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		lineIndent := len(lines[i]) - len(strings.TrimLeft(lines[i], " \t"))
+		// Keys on a list item line sit after the "- " marker
+		if strings.HasPrefix(trimmed, "- ") {
+			lineIndent += 2
+		}
+		if lineIndent < indent {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// isHostedQueue reports whether a queue is served by Buildkite hosted agents
+func isHostedQueue(queue string) bool {
+	return queue == "hosted" || strings.HasPrefix(queue, "hosted-")
+}
+
+// hostedQueuePlatform returns the platform of a hosted queue, or "" for hosted queues
+// that don't follow the `hosted-<platform>-<size>` naming
+func hostedQueuePlatform(queue string) string {
+	for _, hosted := range hostedQueues {
+		if hosted.Name == queue {
+			return hosted.Platform
+		}
+	}
+	for _, platform := range []string{"linux", "macos"} {
+		if strings.HasPrefix(queue, "hosted-"+platform+"-") {
+			return platform
+		}
+	}
+	return ""
+}
+
+// isKnownHostedQueue reports whether a queue is one of the hostedQueues
+func isKnownHostedQueue(queue string) bool {
+	for _, hosted := range hostedQueues {
+		if hosted.Name == queue {
+			return true
+		}
+	}
+	return false
+}
+
+func platformName(platform string) string {
+	if platform == "macos" {
+		return "macOS"
+	}
+	return "Linux"
+}
+
+// agentQueue returns the queue targeted by an agents value, in map or `queue=name` list form
+func agentQueue(agents interface{}) string {
+	switch v := agents.(type) {
+	case map[string]interface{}:
+		queue, _ := v["queue"].(string)
+		return queue
+	case []interface{}:
+		for _, item := range v {
+			if tag, ok := item.(string); ok {
+				if queue, found := strings.CutPrefix(tag, "queue="); found {
+					return queue
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// validateHostedQueues flags hosted queue names with an unknown size, and steps on hosted
+// queues that rely on things hosted agents don't provide
+func (s *Server) validateHostedQueues(pipelineData map[string]interface{}, lines []string) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	defaultQueue := agentQueue(pipelineData["agents"])
+	if isHostedQueue(defaultQueue) {
+		agentsLine := s.findTopLevelProperty("agents", lines)
+		diagnostics = append(diagnostics, s.unknownHostedQueueDiagnostics(defaultQueue, lines, agentsLine, len(lines)-1)...)
+	}
+
+	steps, ok := pipelineData["steps"].([]interface{})
+	if !ok {
+		return diagnostics
+	}
+
+	stepLines := s.findStepLines(lines)
+
+	for stepIndex, stepItem := range steps {
+		stepData, ok := stepItem.(map[string]interface{})
+		if !ok || stepIndex >= len(stepLines) {
+			continue
+		}
+
+		stepInfo := s.stepContainingLine(lines, stepLines[stepIndex])
+		if stepInfo == nil {
+			continue
+		}
+
+		queue := defaultQueue
+		if stepQueue := agentQueue(stepData["agents"]); stepQueue != "" {
+			queue = stepQueue
+			if isHostedQueue(queue) {
+				diagnostics = append(diagnostics, s.unknownHostedQueueDiagnostics(queue, lines, stepInfo.StartLine, stepInfo.EndLine)...)
+			}
+		}
+		if !isHostedQueue(queue) {
+			continue
+		}
+
+		diagnostics = append(diagnostics, s.hostedPluginConflicts(stepData, stepIndex+1, queue, lines, stepInfo)...)
+	}
+
+	return diagnostics
+}
+
+// unknownHostedQueueDiagnostics flags a `hosted-linux-` or `hosted-macos-` queue whose size
+// isn't one hosted agents offer, pointing at its `queue` line between start and end
+func (s *Server) unknownHostedQueueDiagnostics(queue string, lines []string, start, end int) []protocol.Diagnostic {
+	// Queues interpolated on upload, such as hosted-linux-${SIZE}, can't be checked here
+	if hostedQueuePlatform(queue) == "" || isKnownHostedQueue(queue) || hasInterpolation(queue) {
+		return nil
+	}
+
+	lineNum := start
+	for i := start; i <= end && i < len(lines); i++ {
+		if strings.Contains(lines[i], queue) {
+			lineNum = i
+			break
+		}
+	}
+	column := max(strings.Index(lines[lineNum], queue), 0)
+
+	var sizes []string
+	for _, hosted := range hostedQueues {
+		if hosted.Platform == hostedQueuePlatform(queue) && hosted.Name != "hosted" {
+			sizes = append(sizes, hosted.Name)
+		}
+	}
+
+	return []protocol.Diagnostic{{
+		Range: protocol.Range{
+			Start: protocol.Position{Line: uint32(lineNum), Character: uint32(column)},
+			End:   protocol.Position{Line: uint32(lineNum), Character: uint32(column + len(queue))},
+		},
+		Severity: protocol.DiagnosticSeverityWarning,
+		Message:  fmt.Sprintf("Unknown hosted agent queue '%s'; expected one of %s", queue, strings.Join(sizes, ", ")),
+		Source:   "buildkite-ls",
+		Code:     "unknown-hosted-queue",
+	}}
+}
+
+// hostedPluginConflicts flags the step's plugins that can't work on hosted agents
+func (s *Server) hostedPluginConflicts(stepData map[string]interface{}, stepNumber int, queue string, lines []string, stepInfo *StepInfo) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	references := findPluginReferences("", lines)
+	platform := hostedQueuePlatform(queue)
+
+	for _, pluginRef := range plugins.ParsePluginFromStep(stepData) {
+		parsed := plugins.ParsePluginReference(s.pluginRegistry.ResolveAlias(pluginRef.Name))
+		if parsed == nil {
+			continue
+		}
+
+		var message string
+		switch {
+		case plugins.IsKubernetesPlugin(pluginRef.Name):
+			message = fmt.Sprintf("Step %d runs on hosted queue '%s', but the kubernetes plugin needs the Agent Stack for Kubernetes", stepNumber, queue)
+		case parsed.Org == "buildkite-plugins" && dockerPlugins[parsed.Name] && platform == "macos":
+			message = fmt.Sprintf("Step %d uses the %s plugin, but macOS hosted agents can't run Docker containers", stepNumber, parsed.Name)
+		case parsed.Org == "buildkite-plugins" && dockerPlugins[parsed.Name] && isPrivileged(pluginRef.Config):
+			message = fmt.Sprintf("Step %d runs on hosted queue '%s', which doesn't allow privileged containers", stepNumber, queue)
+		default:
+			continue
+		}
+
+		// Point at the plugin's reference within the step
+		rng := protocol.Range{
+			Start: protocol.Position{Line: uint32(stepInfo.StartLine)},
+			End:   protocol.Position{Line: uint32(stepInfo.StartLine), Character: uint32(len(lines[stepInfo.StartLine]))},
+		}
+		for _, usage := range references {
+			line := int(usage.Location.Range.Start.Line)
+			ref := usage.Plugin
+			if usage.Version != "" {
+				ref += "#" + usage.Version
+			}
+			if line >= stepInfo.StartLine && line <= stepInfo.EndLine && ref == pluginRef.Name {
+				rng = usage.Location.Range
+				break
+			}
+		}
+
+		diagnostics = append(diagnostics, protocol.Diagnostic{
+			Range:    rng,
+			Severity: protocol.DiagnosticSeverityWarning,
+			Message:  message,
+			Source:   "buildkite-ls",
+			Code:     "hosted-queue-conflict",
+		})
+	}
+
+	return diagnostics
+}
+
+// isPrivileged reports whether a docker plugin config asks for a privileged container
+func isPrivileged(config interface{}) bool {
+	configMap, ok := config.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	privileged, _ := configMap["privileged"].(bool)
+	return privileged
+}
@@ -0,0 +1,109 @@
+package lsp
+
+import (
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+func TestCompletionProvider_HostedQueues(t *testing.T) {
+	provider := newTestCompletionProvider()
+
+	tests := []struct {
+		name    string
+		content string
+		hosted  bool
+	}{
+		{name: "step agents", content: "steps:\n  - command: \"make\"\n    agents:\n      queue: ", hosted: true},
+		{name: "partially typed", content: "steps:\n  - command: \"make\"\n    agents:\n      os: linux\n      queue: \"hosted-li", hosted: true},
+		{name: "pipeline agents", content: "agents:\n  queue: ", hosted: true},
+		{name: "queue outside agents", content: "steps:\n  - command: \"make\"\n    env:\n      queue: ", hosted: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			completions := provider.GetCompletions(blockStepPositionContext(tt.content))
+
+			found := false
+			for _, completion := range completions {
+				if completion.Label == "hosted-macos-medium" {
+					found = true
+				}
+			}
+			if found != tt.hosted {
+				t.Errorf("Expected hosted queue completions: %v, got %+v", tt.hosted, completions)
+			}
+		})
+	}
+}
+
+func TestServer_ValidateHostedQueues(t *testing.T) {
+	content := `agents:
+  queue: "hosted"
+steps:
+  - label: "Build"
+    command: "make build"
+    plugins:
+      - docker#v5.13.0:
+          image: "golang"
+          privileged: true
+  - label: "iOS"
+    command: "make ios"
+    agents:
+      queue: "hosted-macos-medium"
+    plugins:
+      - docker-compose#v5.0.0:
+          run: app
+  - label: "Huge"
+    command: "make"
+    agents:
+      queue: "hosted-linux-huge"
+  - label: "Self-hosted"
+    command: "make"
+    agents:
+      queue: "default"
+    plugins:
+      - docker#v5.13.0:
+          image: "golang"
+          privileged: true`
+
+	pipeline, err := parser.ParseYAML([]byte(content))
+	if err != nil {
+		t.Fatalf("Failed to parse YAML: %v", err)
+	}
+
+	var diagnostics []protocol.Diagnostic
+	for _, diagnostic := range newTestServer().validatePlugins(pipeline) {
+		if diagnostic.Code == "hosted-queue-conflict" || diagnostic.Code == "unknown-hosted-queue" {
+			diagnostics = append(diagnostics, diagnostic)
+		}
+	}
+
+	expected := []struct {
+		code    string
+		line    uint32
+		message string
+	}{
+		{code: "hosted-queue-conflict", line: 6, message: "doesn't allow privileged containers"},
+		{code: "hosted-queue-conflict", line: 14, message: "macOS hosted agents can't run Docker"},
+		{code: "unknown-hosted-queue", line: 19, message: "hosted-linux-huge"},
+	}
+
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("Expected %d diagnostics, got %d: %+v", len(expected), len(diagnostics), diagnostics)
+	}
+
+	for i, want := range expected {
+		diagnostic := diagnostics[i]
+		if diagnostic.Code != want.code || diagnostic.Range.Start.Line != want.line {
+			t.Errorf("Diagnostic %d: expected %s on line %d, got %s on line %d", i, want.code, want.line,
+				diagnostic.Code, diagnostic.Range.Start.Line)
+		}
+		if !strings.Contains(diagnostic.Message, want.message) {
+			t.Errorf("Diagnostic %d: expected message to mention %q, got %q", i, want.message, diagnostic.Message)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package lsp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+
+	"github.com/mcncl/buildkite-ls/internal/importer"
+)
+
+// ImportCommand converts another CI system's configuration into a new pipeline file. Its
+// argument is the path or file URI of a GitHub Actions workflow or a GitLab CI file.
+const ImportCommand = "buildkite.importFrom"
+
+// ImportResult is the pipeline an import produced
+type ImportResult struct {
+	// URI is where the pipeline is created
+	URI protocol.DocumentURI `json:"uri"`
+	// Pipeline is the converted pipeline, for clients that can't create files to show themselves
+	Pipeline string `json:"pipeline"`
+}
+
+// importPipeline converts the CI file and, when the client can create files, asks it to
+// create the pipeline next to the repository's other pipelines
+func (s *Server) importPipeline(source string) (*ImportResult, error) {
+	path := source
+	if filePath, ok := uriPath(protocol.DocumentURI(source)); ok {
+		path = filePath
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	pipeline, err := importer.Import(path, content)
+	if err != nil {
+		return nil, err
+	}
+
+	target := filepath.Join(s.importRoot(path), ".buildkite", importedPipelineName(path))
+	if _, err := os.Stat(target); err == nil {
+		return nil, fmt.Errorf("%s already exists", target)
+	}
+	result := &ImportResult{URI: uri.File(target), Pipeline: pipeline}
+
+	if s.conn != nil && s.ClientFeatures().CreateFiles {
+		s.applyEdit(importEditParams(result), func(err error) {
+			if err != nil {
+				s.logger.Printf("Failed to create imported pipeline: %v", err)
+			}
+		})
+	}
+
+	return result, nil
+}
+
+// importEditParams ask the client to create the imported pipeline
+func importEditParams(result *ImportResult) applyCreateFileEditParams {
+	return applyCreateFileEditParams{
+		Label: "Import pipeline",
+		Edit: createFileEdit{
+			DocumentChanges: []interface{}{
+				protocol.CreateFile{Kind: protocol.CreateResourceOperation, URI: result.URI},
+				protocol.TextDocumentEdit{
+					TextDocument: protocol.OptionalVersionedTextDocumentIdentifier{
+						TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: result.URI},
+					},
+					Edits: []protocol.TextEdit{{NewText: result.Pipeline}},
+				},
+			},
+		},
+	}
+}
+
+// importRoot is the repository the CI file belongs to: the directory holding .github, the
+// workspace folder containing the file, or else the file's own directory
+func (s *Server) importRoot(path string) string {
+	if index := strings.Index(path, "/.github/"); index >= 0 {
+		return path[:index]
+	}
+
+	s.settingsMu.RLock()
+	roots := s.workspaceRoots
+	s.settingsMu.RUnlock()
+
+	for _, root := range roots {
+		if strings.HasPrefix(path, strings.TrimSuffix(root, "/")+"/") {
+			return root
+		}
+	}
+	return filepath.Dir(path)
+}
+
+// importedPipelineName names the pipeline after the workflow it came from, as a variant
+// file, e.g. .github/workflows/ci.yml becomes pipeline.ci.yml
+func importedPipelineName(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if name = keyFromLabel(strings.TrimPrefix(name, ".")); name == "" || name == "gitlab-ci" {
+		name = "imported"
+	}
+	return "pipeline." + name + ".yml"
+}
@@ -0,0 +1,91 @@
+package lsp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+)
+
+func TestServer_ImportFrom(t *testing.T) {
+	server := newTestServer()
+	// The space is escaped in the workflow's and the pipeline's URIs
+	root := filepath.Join(t.TempDir(), "my repo")
+	workflow := filepath.Join(root, ".github", "workflows", "ci.yml")
+	if err := os.MkdirAll(filepath.Dir(workflow), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(workflow, []byte(`on: push
+jobs:
+  test:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v4
+      - run: go test ./...
+  release:
+    needs: test
+    runs-on: ubuntu-latest
+    steps:
+      - run: ./release.sh ${{ github.sha }}
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := server.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{
+		Command:   ImportCommand,
+		Arguments: []interface{}{string(uri.File(workflow))},
+	})
+	if err != nil {
+		t.Fatalf("ExecuteCommand failed: %v", err)
+	}
+
+	imported, ok := result.(*ImportResult)
+	if !ok {
+		t.Fatalf("Expected an import result, got %T", result)
+	}
+	expectedURI := uri.File(filepath.Join(root, ".buildkite", "pipeline.ci.yml"))
+	if imported.URI != expectedURI {
+		t.Errorf("Expected the pipeline to be created at %s, got %s", expectedURI, imported.URI)
+	}
+
+	// The scaffold is a pipeline the server accepts
+	for _, diagnostic := range server.Diagnose(imported.Pipeline) {
+		if diagnostic.Severity == protocol.DiagnosticSeverityError {
+			t.Errorf("Expected no errors in the imported pipeline, got %s: %s\n%s", diagnostic.Code, diagnostic.Message, imported.Pipeline)
+		}
+	}
+	if !strings.Contains(imported.Pipeline, "depends_on: test") {
+		t.Errorf("Expected needs to become depends_on, got:\n%s", imported.Pipeline)
+	}
+
+	// An existing pipeline is never overwritten
+	if err := os.MkdirAll(filepath.Join(root, ".buildkite"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, ".buildkite", "pipeline.ci.yml"), []byte("steps: []\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{
+		Command:   ImportCommand,
+		Arguments: []interface{}{workflow},
+	}); err == nil {
+		t.Error("Expected an error when the pipeline already exists")
+	}
+}
+
+func TestImportedPipelineName(t *testing.T) {
+	tests := map[string]string{
+		"/repo/.github/workflows/ci.yml":          "pipeline.ci.yml",
+		"/repo/.github/workflows/Deploy App.yaml": "pipeline.deploy-app.yml",
+		"/repo/.gitlab-ci.yml":                    "pipeline.imported.yml",
+	}
+	for path, expected := range tests {
+		if name := importedPipelineName(path); name != expected {
+			t.Errorf("importedPipelineName(%q) = %q, expected %q", path, name, expected)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.lsp.dev/protocol"
+)
+
+// InsertWaitAfterStepCommand inserts a wait step after the step containing a position. Its
+// arguments are the document URI and the position.
+const InsertWaitAfterStepCommand = "buildkite.insertWaitAfterStep"
+
+// InsertBlockAfterStepCommand inserts a block step after the step containing a position. Its
+// arguments are the document URI, the position and optionally the block step's label.
+const InsertBlockAfterStepCommand = "buildkite.insertBlockAfterStep"
+
+// defaultBlockLabel labels inserted block steps when the command isn't given one
+const defaultBlockLabel = "Continue?"
+
+// insertStepAfterCommand reads the arguments of the insert commands, builds the edit and,
+// when there's a client to apply it, asks the client to apply it. The edit is returned
+// either way, for extensions that apply it themselves.
+func (s *Server) insertStepAfterCommand(command string, arguments []interface{}) (*protocol.WorkspaceEdit, error) {
+	if len(arguments) < 2 {
+		return nil, fmt.Errorf("%s expects a document URI and a position", command)
+	}
+	uri, ok := arguments[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("%s expects a document URI, got %v", command, arguments[0])
+	}
+	position, err := positionArgument(arguments[1])
+	if err != nil {
+		return nil, fmt.Errorf("%s expects a position: %w", command, err)
+	}
+
+	step, title := "wait", "Insert wait step"
+	if command == InsertBlockAfterStepCommand {
+		label := defaultBlockLabel
+		if len(arguments) > 2 {
+			if custom, ok := arguments[2].(string); ok && custom != "" {
+				label = custom
+			}
+		}
+		step, title = "block: "+strconv.Quote(label), "Insert block step"
+	}
+
+	edit, err := s.insertStepAfter(protocol.DocumentURI(uri), position, step)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.conn != nil {
+		s.applyEdit(protocol.ApplyWorkspaceEditParams{Label: title, Edit: *edit}, func(err error) {
+			if err != nil {
+				s.logger.Printf("Failed to insert step: %v", err)
+			}
+		})
+	}
+
+	return edit, nil
+}
+
+// insertStepAfter builds an edit adding the step after the innermost step containing the
+// position, at the same indentation so steps inside a group stay inside it
+func (s *Server) insertStepAfter(uri protocol.DocumentURI, position protocol.Position, step string) (*protocol.WorkspaceEdit, error) {
+	stepRange, err := s.StepRangeAt(context.Background(), &protocol.TextDocumentPositionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Position:     position,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if stepRange == nil {
+		return nil, fmt.Errorf("no step at line %d", position.Line+1)
+	}
+
+	end := stepRange.Range.End
+	indent := strings.Repeat(" ", int(stepRange.Range.Start.Character))
+	edit := &protocol.WorkspaceEdit{
+		Changes: map[protocol.DocumentURI][]protocol.TextEdit{
+			uri: {{Range: protocol.Range{Start: end, End: end}, NewText: "\n" + indent + "- " + step}},
+		},
+	}
+	s.matchLineEndings(edit)
+	return edit, nil
+}
+
+// positionArgument reads a command argument holding an LSP position
+func positionArgument(argument interface{}) (protocol.Position, error) {
+	var position protocol.Position
+	object, ok := argument.(map[string]interface{})
+	if !ok {
+		return position, fmt.Errorf("got %v", argument)
+	}
+	if _, hasLine := object["line"]; !hasLine {
+		return position, fmt.Errorf("got %v", argument)
+	}
+
+	data, err := json.Marshal(object)
+	if err != nil {
+		return position, err
+	}
+	if err := json.Unmarshal(data, &position); err != nil {
+		return position, fmt.Errorf("got %v", argument)
+	}
+	return position, nil
+}
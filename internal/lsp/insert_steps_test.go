@@ -0,0 +1,103 @@
+package lsp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+func TestServer_InsertStepAfterCommands(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	content := `steps:
+  - label: Build
+    command: make
+
+  - group: Checks
+    steps:
+      - label: Lint
+        command: make lint
+      - label: Test
+        command: make test
+  - label: Deploy
+    command: make deploy`
+	server.documentManager.OpenDocument(uri, 1, content)
+
+	tests := []struct {
+		name      string
+		command   string
+		arguments []interface{}
+		expected  string
+	}{
+		{
+			name:      "wait after a step",
+			command:   InsertWaitAfterStepCommand,
+			arguments: []interface{}{string(uri), map[string]interface{}{"line": float64(2), "character": float64(6)}},
+			expected: `steps:
+  - label: Build
+    command: make
+  - wait
+
+  - group: Checks`,
+		},
+		{
+			name:      "block after a step in a group",
+			command:   InsertBlockAfterStepCommand,
+			arguments: []interface{}{string(uri), map[string]interface{}{"line": float64(6), "character": float64(10)}},
+			expected: `      - label: Lint
+        command: make lint
+      - block: "Continue?"
+      - label: Test`,
+		},
+		{
+			name:      "block with a label after the last step",
+			command:   InsertBlockAfterStepCommand,
+			arguments: []interface{}{string(uri), map[string]interface{}{"line": float64(10), "character": float64(0)}, "Ship it?"},
+			expected: `  - label: Deploy
+    command: make deploy
+  - block: "Ship it?"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := server.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{Command: tt.command, Arguments: tt.arguments})
+			if err != nil {
+				t.Fatalf("ExecuteCommand failed: %v", err)
+			}
+			edit, ok := result.(*protocol.WorkspaceEdit)
+			if !ok || len(edit.Changes[uri]) != 1 {
+				t.Fatalf("Expected a single edit to the document, got %+v", result)
+			}
+			if updated := applyTextEdits(content, edit.Changes[uri]); !strings.Contains(updated, tt.expected) {
+				t.Errorf("Expected the document to contain:\n%s\ngot:\n%s", tt.expected, updated)
+			}
+		})
+	}
+}
+
+func TestServer_InsertStepAfterCommandErrors(t *testing.T) {
+	server := newTestServer()
+	uri := "file:///test/.buildkite/pipeline.yml"
+	server.documentManager.OpenDocument(protocol.DocumentURI(uri), 1, "env:\n  FOO: bar\nsteps:\n  - command: make")
+
+	tests := []struct {
+		name      string
+		arguments []interface{}
+	}{
+		{"missing position", []interface{}{uri}},
+		{"position that isn't an object", []interface{}{uri, float64(3)}},
+		{"position outside a step", []interface{}{uri, map[string]interface{}{"line": float64(1), "character": float64(2)}}},
+		{"document not open", []interface{}{"file:///test/other.yml", map[string]interface{}{"line": float64(3), "character": float64(2)}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := server.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{Command: InsertWaitAfterStepCommand, Arguments: tt.arguments}); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
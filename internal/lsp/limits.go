@@ -0,0 +1,53 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"go.lsp.dev/protocol"
+)
+
+// documentLimitExceeded describes how a document is over the configured size limits,
+// or returns "" when it's within them
+func (s Settings) documentLimitExceeded(size, lines int) string {
+	if s.MaxDocumentSizeBytes > 0 && size > s.MaxDocumentSizeBytes {
+		return fmt.Sprintf("%d bytes, over the limit of %d", size, s.MaxDocumentSizeBytes)
+	}
+	if s.MaxDocumentLines > 0 && lines > s.MaxDocumentLines {
+		return fmt.Sprintf("%d lines, over the limit of %d", lines, s.MaxDocumentLines)
+	}
+	return ""
+}
+
+// contentLimitExceeded checks document content against the size limits
+func (s *Server) contentLimitExceeded(content string) string {
+	return s.Settings().documentLimitExceeded(len(content), strings.Count(content, "\n")+1)
+}
+
+// warnOversizedDocument tells the user, once per document, that features are reduced for it
+func (s *Server) warnOversizedDocument(ctx context.Context, uri protocol.DocumentURI, reason string) {
+	s.settingsMu.Lock()
+	warned := s.oversizedDocuments[uri]
+	s.oversizedDocuments[uri] = true
+	s.settingsMu.Unlock()
+
+	if warned {
+		return
+	}
+
+	s.logger.Printf("Document %s is oversized (%s); reducing diagnostics and semantic tokens", uri, reason)
+	if s.conn == nil {
+		return
+	}
+
+	params := protocol.ShowMessageParams{
+		Type: protocol.MessageTypeWarning,
+		Message: fmt.Sprintf("%s is %s. Only YAML and schema errors are reported for it, and highlighting covers the visible range only. "+
+			"Raise maxDocumentSizeBytes or maxDocumentLines to enable every feature.", filepath.Base(string(uri)), reason),
+	}
+	if err := s.conn.Notify(ctx, "window/showMessage", params); err != nil {
+		s.logger.Printf("Failed to send oversized document warning: %v", err)
+	}
+}
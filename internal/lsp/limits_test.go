@@ -0,0 +1,104 @@
+package lsp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+func TestSettings_DocumentLimitExceeded(t *testing.T) {
+	settings := Settings{MaxDocumentSizeBytes: 100, MaxDocumentLines: 10}
+
+	tests := []struct {
+		name     string
+		size     int
+		lines    int
+		expected string
+	}{
+		{"within limits", 100, 10, ""},
+		{"too large", 101, 1, "101 bytes, over the limit of 100"},
+		{"too many lines", 50, 11, "11 lines, over the limit of 10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := settings.documentLimitExceeded(tt.size, tt.lines); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	if got := (Settings{}).documentLimitExceeded(1<<30, 1<<20); got != "" {
+		t.Errorf("Expected zero limits to be disabled, got %q", got)
+	}
+}
+
+func TestServer_OversizedDocuments(t *testing.T) {
+	server := newTestServer()
+	settings := DefaultSettings()
+	settings.MaxDocumentLines = 5
+	server.SetSettings(settings)
+
+	// The step checks would flag the missing labels and trailing wait, but only structural errors are reported
+	content := `steps:
+  - command: make build
+    key: build
+  - command: make test
+    key: build
+  - wait`
+	if diagnostics := server.Diagnose(content); len(diagnostics) != 0 {
+		t.Errorf("Expected no step diagnostics for an oversized document, got %+v", diagnostics)
+	}
+	if diagnostics := server.Diagnose(content + "\n  - command: [unclosed"); len(diagnostics) == 0 {
+		t.Error("Expected YAML errors to still be reported for an oversized document")
+	}
+
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	server.documentManager.OpenDocument(uri, 1, content)
+
+	full, err := server.SemanticTokensFull(context.Background(), &protocol.SemanticTokensParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+	})
+	if err != nil || len(full.Data) != 0 {
+		t.Errorf("Expected no full semantic tokens, got %v (%v)", full, err)
+	}
+
+	ranged, err := server.SemanticTokensRange(context.Background(), &protocol.SemanticTokensRangeParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Range:        protocol.Range{End: protocol.Position{Line: 2}},
+	})
+	if err != nil || len(ranged.Data) == 0 {
+		t.Errorf("Expected range semantic tokens, got %v (%v)", ranged, err)
+	}
+
+	server.validateDocument(context.Background(), uri, content)
+	server.validateDocument(context.Background(), uri, content)
+	if !server.oversizedDocuments[uri] {
+		t.Error("Expected the oversized document to be recorded as warned")
+	}
+}
+
+func TestServer_WorkspaceSkipsOversizedPipelines(t *testing.T) {
+	server := newTestServer()
+	settings := DefaultSettings()
+	settings.MaxDocumentSizeBytes = 200
+	server.SetSettings(settings)
+
+	root := t.TempDir()
+	writeWorkspacePipeline(t, root, "pipeline.yml", `steps:
+  - plugins:
+      - docker#v5.13.0: ~`)
+	writeWorkspacePipeline(t, root, "generated.yml", "steps:\n  - plugins:\n      - docker#v5.13.0: ~\n"+
+		strings.Repeat("  - command: make\n", 20))
+	server.SetWorkspaceRoots([]string{root})
+
+	usages, err := server.PluginUsages(context.Background(), &PluginUsagesParams{Plugin: "docker"})
+	if err != nil {
+		t.Fatalf("PluginUsages failed: %v", err)
+	}
+	if len(usages) != 1 || !strings.HasSuffix(string(usages[0].Location.URI), "/pipeline.yml") {
+		t.Errorf("Expected only the small pipeline's usage, got %+v", usages)
+	}
+}
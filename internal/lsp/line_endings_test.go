@@ -0,0 +1,120 @@
+package lsp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+func TestDetectLineEnding(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected string
+	}{
+		{"steps:\n  - wait\n", "\n"},
+		{"steps:\r\n  - wait\r\n", "\r\n"},
+		{"steps:\r\n  - wait\r\n  - block: Go\n", "\r\n"},
+		{"steps:\r\n  - wait\n  - block: Go\n", "\n"},
+		{"steps: []", "\n"},
+	}
+
+	for _, tt := range tests {
+		if got := detectLineEnding(tt.content); got != tt.expected {
+			t.Errorf("detectLineEnding(%q) = %q, expected %q", tt.content, got, tt.expected)
+		}
+	}
+}
+
+func TestDocumentLines(t *testing.T) {
+	lines := documentLines("steps:\r\n  - wait\n  - block: Go\r\n")
+	expected := []string{"steps:", "  - wait", "  - block: Go", ""}
+	if strings.Join(lines, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %q, got %q", expected, lines)
+	}
+}
+
+func TestWithLineEnding(t *testing.T) {
+	if got := withLineEnding("a\nb\r\nc", "\r\n"); got != "a\r\nb\r\nc" {
+		t.Errorf("Expected CRLF endings throughout, got %q", got)
+	}
+	if got := withLineEnding("a\r\nb\nc", "\n"); got != "a\nb\nc" {
+		t.Errorf("Expected LF endings throughout, got %q", got)
+	}
+}
+
+func TestServer_CRLFDiagnosticRanges(t *testing.T) {
+	server := newTestServer()
+	content := "steps:\n  - label: Build\n    command: make\n    timeout_in_minutes: 90000\n    env:\n      DEBUG: true\n"
+
+	lf := server.Diagnose(content)
+	crlf := server.Diagnose(strings.ReplaceAll(content, "\n", "\r\n"))
+	if len(lf) == 0 || len(lf) != len(crlf) {
+		t.Fatalf("Expected the same diagnostics for both endings, got %+v and %+v", lf, crlf)
+	}
+	for i := range lf {
+		if lf[i].Range != crlf[i].Range || lf[i].Message != crlf[i].Message {
+			t.Errorf("Expected %q at %+v with CRLF endings, got %q at %+v", lf[i].Message, lf[i].Range, crlf[i].Message, crlf[i].Range)
+		}
+	}
+}
+
+// applyEditsAsClient applies edits to content byte for byte, carriage returns included, as
+// a client would
+func applyEditsAsClient(content string, edits []protocol.TextEdit) string {
+	dm := NewDocumentManager()
+	uri := protocol.DocumentURI("file:///tmp/edited.yml")
+	dm.OpenDocument(uri, 1, content)
+
+	// Applied last to first, so each range is still where the edits were made for
+	var changes []ContentChange
+	for i := len(edits) - 1; i >= 0; i-- {
+		changes = append(changes, ContentChange{Range: &edits[i].Range, Text: edits[i].NewText})
+	}
+	return dm.ApplyChanges(uri, 2, changes)
+}
+
+func TestServer_CRLFEditsKeepLineEndings(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	content := "steps:\r\n  - label: Build\r\n    command: make\r\n  - label: Test\r\n    command: make test\r\n"
+	server.documentManager.OpenDocument(uri, 1, content)
+
+	result, err := server.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{
+		Command:   InsertWaitAfterStepCommand,
+		Arguments: []interface{}{string(uri), map[string]interface{}{"line": float64(1), "character": float64(4)}},
+	})
+	if err != nil {
+		t.Fatalf("ExecuteCommand failed: %v", err)
+	}
+	updated := applyEditsAsClient(content, result.(*protocol.WorkspaceEdit).Changes[uri])
+	expected := "steps:\r\n  - label: Build\r\n    command: make\r\n  - wait\r\n  - label: Test\r\n"
+	if !strings.HasPrefix(updated, expected) {
+		t.Errorf("Expected %q, got %q", expected, updated)
+	}
+
+	// Code actions come back in the document's endings too
+	actions, err := server.CodeAction(context.Background(), &protocol.CodeActionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Range:        protocol.Range{Start: protocol.Position{Line: 2, Character: 6}, End: protocol.Position{Line: 2, Character: 6}},
+	})
+	if err != nil {
+		t.Fatalf("CodeAction failed: %v", err)
+	}
+	checked := 0
+	for _, action := range actions {
+		if action.Edit == nil {
+			continue
+		}
+		for _, edit := range action.Edit.Changes[uri] {
+			if strings.Contains(strings.ReplaceAll(edit.NewText, "\r\n", ""), "\n") {
+				t.Errorf("Expected %q to use CRLF endings, got %q", action.Title, edit.NewText)
+			}
+			checked++
+		}
+	}
+	if checked == 0 {
+		t.Error("Expected code actions with edits to check")
+	}
+}
@@ -0,0 +1,77 @@
+package lsp
+
+import (
+	"strings"
+
+	"go.lsp.dev/protocol"
+
+	bkcontext "github.com/mcncl/buildkite-ls/internal/context"
+)
+
+// listItemCompletions are the list items offered on an empty line directly under a key
+// holding a list, by that key, each with a snippet for the kind of item the list holds
+var listItemCompletions = map[string]protocol.CompletionItem{
+	"steps": listItemCompletion("step", "Add a step to the list",
+		"Insert a list item for adding a command step", "- label: \"${1:label}\"\n  command: \"${2:command}\""),
+	"commands": listItemCompletion("command", "Add a command to the list",
+		"Insert a list item for adding a command", "- \"${1:command}\""),
+	"depends_on": listItemCompletion("dependency", "Add a step dependency to the list",
+		"Insert a list item for adding the key of a step this step depends on", "- \"${1:step-key}\""),
+	"artifact_paths": listItemCompletion("artifact path", "Add an artifact glob to the list",
+		"Insert a list item for adding a glob of files to upload once the step finishes", "- \"${1:build/**/*}\""),
+	"fields": listItemCompletion("field", "Add a field to the list",
+		"Insert a list item for adding a text field, whose value is stored in the meta-data key", "- text: \"${1:label}\"\n  key: \"${2:meta-data-key}\""),
+	"notify": listItemCompletion("notification", "Add a notification to the list",
+		"Insert a list item for adding a Slack notification", "- slack: \"${1:#channel}\""),
+	"plugins": listItemCompletion("plugin", "Add a plugin to the list",
+		"Insert a list item for adding a plugin", "- ${1:plugin-name}#${2:version}:\n    ${3:config}: \"${4:value}\""),
+}
+
+// listItemCompletion builds the list item snippet for a kind of item, sorted above the
+// other completions
+func listItemCompletion(noun, detail, documentation, snippet string) protocol.CompletionItem {
+	return protocol.CompletionItem{
+		Label:            "- (add " + noun + ")",
+		Kind:             protocol.CompletionItemKindSnippet,
+		Detail:           detail,
+		Documentation:    &protocol.MarkupContent{Kind: protocol.Markdown, Value: documentation},
+		InsertText:       snippet,
+		InsertTextFormat: protocol.InsertTextFormatSnippet,
+		SortText:         "00-list-item",
+	}
+}
+
+// getListItemCompletions returns the list item to offer when the cursor is on an empty line
+// directly under a key holding a list, whether the list is empty or not. An empty steps
+// list is offered a scaffold for each type of step.
+func (cp *CompletionProvider) getListItemCompletions(posCtx *bkcontext.PositionContext, contextInfo *bkcontext.ContextInfo) ([]protocol.CompletionItem, bool) {
+	if posCtx == nil || contextInfo == nil {
+		return nil, false
+	}
+	if items, ok := cp.getEmptyStepsArrayCompletions(posCtx); ok {
+		return items, true
+	}
+
+	// A line with a dash already has its list item
+	if !contextInfo.InArray || strings.TrimSpace(posCtx.CurrentLine) != "" {
+		return nil, false
+	}
+
+	// Only block and input steps take fields
+	if contextInfo.ArrayContext == "fields" {
+		stepType := enclosingStepType(splitLines(posCtx.FullContent), int(posCtx.Position.Line))
+		if stepType != "block" && stepType != "input" {
+			return nil, false
+		}
+	}
+
+	if contextInfo.ArrayContext == "steps" && isEmptyStepsList(splitLines(posCtx.FullContent), int(posCtx.Position.Line)) {
+		return stepScaffoldCompletions(), true
+	}
+
+	item, ok := listItemCompletions[contextInfo.ArrayContext]
+	if !ok {
+		return nil, false
+	}
+	return []protocol.CompletionItem{item}, true
+}
@@ -0,0 +1,115 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"go.lsp.dev/jsonrpc2"
+)
+
+// ServerStatusMethod is the custom request describing the running server, with its most
+// recent log entries, for attaching to bug reports
+const ServerStatusMethod = "buildkite/serverStatus"
+
+// logHistorySize is how many of the most recent log entries are kept for serverStatus
+const logHistorySize = 200
+
+// ServerStatusParams are the parameters of a buildkite/serverStatus request
+type ServerStatusParams struct {
+	// LogEntries limits how many of the most recent log entries are returned. Zero returns
+	// every entry kept.
+	LogEntries int `json:"logEntries,omitempty"`
+}
+
+// ServerStatus describes the running server
+type ServerStatus struct {
+	Version       string   `json:"version"`
+	SchemaVersion string   `json:"schemaVersion"`
+	OpenDocuments int      `json:"openDocuments"`
+	Logs          []string `json:"logs"`
+}
+
+// requestLog is the server's log output. Each entry written while a message is handled is
+// tagged with the message's ID and method, e.g. `[#12 textDocument/hover]`, so the logs of
+// one request can be told apart from the next. Requests are handled one at a time, so the
+// entries logged in between, by work running in the background, carry no tag.
+// Notifications have no ID, so they're numbered as they arrive: `[n7 textDocument/didChange]`.
+type requestLog struct {
+	mu            sync.Mutex
+	out           io.Writer
+	tag           string
+	notifications int
+	// entries holds the most recent entries, oldest first
+	entries []string
+}
+
+func newRequestLog(out io.Writer) *requestLog {
+	return &requestLog{out: out}
+}
+
+// Write writes a log entry, tagged with the message being handled
+func (l *requestLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry := l.tag + string(p)
+	if len(l.entries) == logHistorySize {
+		l.entries = l.entries[1:]
+	}
+	l.entries = append(l.entries, strings.TrimSuffix(entry, "\n"))
+
+	if _, err := io.WriteString(l.out, entry); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// begin tags the entries written until the returned function is called with the message's
+// ID and method
+func (l *requestLog) begin(req jsonrpc2.Request) (end func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if call, ok := req.(*jsonrpc2.Call); ok {
+		l.tag = fmt.Sprintf("[%q %s] ", call.ID(), req.Method())
+	} else {
+		l.notifications++
+		l.tag = fmt.Sprintf("[n%d %s] ", l.notifications, req.Method())
+	}
+	tag := l.tag
+
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		// A message handled meanwhile has tagged the entries since
+		if l.tag == tag {
+			l.tag = ""
+		}
+	}
+}
+
+// recent returns up to limit of the most recent entries, oldest first. A limit of zero
+// returns every entry kept.
+func (l *requestLog) recent(limit int) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := l.entries
+	if limit > 0 && limit < len(entries) {
+		entries = entries[len(entries)-limit:]
+	}
+	return append([]string{}, entries...)
+}
+
+// ServerStatus describes the running server, with its most recent log entries
+func (s *Server) ServerStatus(ctx context.Context, params *ServerStatusParams) (*ServerStatus, error) {
+	return &ServerStatus{
+		Version:       serverVersion,
+		SchemaVersion: s.schemaLoader.Version().String(),
+		OpenDocuments: len(s.documentManager.AllDocuments()),
+		Logs:          s.logs.recent(params.LogEntries),
+	}, nil
+}
@@ -0,0 +1,88 @@
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/jsonrpc2"
+	"go.lsp.dev/protocol"
+)
+
+func TestServer_RequestLogTags(t *testing.T) {
+	server := newTestServer()
+
+	var output bytes.Buffer
+	server.logs = newRequestLog(&output)
+	server.logger = log.New(server.logs, "", 0)
+
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	notification, err := jsonrpc2.NewNotification("textDocument/didOpen", protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: uri, Version: 1, Text: "steps:\n  - command: test\n"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create notification: %v", err)
+	}
+	call, err := jsonrpc2.NewCall(jsonrpc2.NewNumberID(7), ServerStatusMethod, ServerStatusParams{})
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+
+	handler := server.Handler()
+	noReply := func(ctx context.Context, result interface{}, err error) error { return nil }
+	if err := handler(context.Background(), noReply, notification); err != nil {
+		t.Fatalf("Handling didOpen failed: %v", err)
+	}
+	server.logger.Printf("Between messages")
+
+	var status *ServerStatus
+	reply := func(ctx context.Context, result interface{}, err error) error {
+		status, _ = result.(*ServerStatus)
+		return err
+	}
+	if err := handler(context.Background(), reply, call); err != nil {
+		t.Fatalf("Handling serverStatus failed: %v", err)
+	}
+
+	for _, expected := range []string{
+		"[n1 textDocument/didOpen] Received method: textDocument/didOpen",
+		"[n1 textDocument/didOpen] Document opened: " + string(uri),
+		"\nBetween messages\n",
+		"[#7 buildkite/serverStatus] Received method: buildkite/serverStatus",
+	} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("Expected the log to contain %q, got:\n%s", expected, output.String())
+		}
+	}
+
+	if status == nil {
+		t.Fatal("Expected a server status")
+	}
+	if status.Version != serverVersion || status.SchemaVersion == "" || status.OpenDocuments != 1 {
+		t.Errorf("Expected the server's versions and one open document, got %+v", status)
+	}
+	if last := status.Logs[len(status.Logs)-1]; last != "[#7 buildkite/serverStatus] Received method: buildkite/serverStatus" {
+		t.Errorf("Expected the status request's own entry last, got %q", last)
+	}
+}
+
+func TestRequestLog_Recent(t *testing.T) {
+	logs := newRequestLog(&bytes.Buffer{})
+	logger := log.New(logs, "", 0)
+	for i := range logHistorySize + 5 {
+		logger.Printf("entry %d", i)
+	}
+
+	all := logs.recent(0)
+	if len(all) != logHistorySize || all[0] != "entry 5" {
+		t.Errorf("Expected the last %d entries from entry 5, got %d from %q", logHistorySize, len(all), all[0])
+	}
+
+	last := logs.recent(2)
+	if expected := []string{fmt.Sprintf("entry %d", logHistorySize+3), fmt.Sprintf("entry %d", logHistorySize+4)}; strings.Join(last, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v, got %v", expected, last)
+	}
+}
@@ -0,0 +1,198 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+)
+
+// MatrixPreviewMethod is the custom request expanding the matrix of the step containing a
+// position into the jobs it will run, so editor extensions can preview them as a table
+const MatrixPreviewMethod = "buildkite/matrixPreview"
+
+// MatrixPreview is the result of a buildkite/matrixPreview request
+type MatrixPreview struct {
+	// Dimensions name the matrix's dimensions as they are interpolated: "matrix" for a
+	// single-dimension matrix, "matrix.<name>" for each dimension of a setup mapping
+	Dimensions []string `json:"dimensions"`
+	// Jobs are every combination of dimension values, in the order Buildkite creates them,
+	// followed by combinations adjustments add. Skipped combinations are included and marked.
+	Jobs []MatrixJob `json:"jobs"`
+	// Count is the number of jobs that will run, leaving out skipped combinations
+	Count int `json:"count"`
+}
+
+// MatrixJob is one combination of matrix dimension values
+type MatrixJob struct {
+	// Values hold the value of each of the preview's dimensions, in the same order
+	Values []string `json:"values"`
+	// Skipped is set when an adjustment skips the combination
+	Skipped bool `json:"skipped,omitempty"`
+	// SoftFail is set when an adjustment lets the combination fail without failing the build
+	SoftFail bool `json:"softFail,omitempty"`
+	// Added is set for combinations an adjustment adds beyond the setup
+	Added bool `json:"added,omitempty"`
+}
+
+// MatrixPreview expands the matrix of the innermost step containing the position. It returns
+// nil when the position isn't inside a step with a matrix.
+func (s *Server) MatrixPreview(ctx context.Context, params *protocol.TextDocumentPositionParams) (*MatrixPreview, error) {
+	doc, exists := s.documentManager.GetDocument(params.TextDocument.URI)
+	if !exists {
+		return nil, fmt.Errorf("document not found: %s", params.TextDocument.URI)
+	}
+
+	if !s.isBuildkiteFile(string(params.TextDocument.URI)) {
+		return nil, nil
+	}
+
+	_, step := stepEditOf(doc.Lines, int(params.Position.Line))
+	if step == nil {
+		return nil, nil
+	}
+	return expandMatrix(mappingValue(step, "matrix")), nil
+}
+
+// expandMatrix expands a step's matrix into its jobs, or returns nil if it has no dimensions.
+// A matrix is either a list of values, or a mapping with a setup of one list of values or
+// of named lists, and adjustments to particular combinations.
+func expandMatrix(matrix *yaml.Node) *MatrixPreview {
+	if matrix == nil {
+		return nil
+	}
+
+	setup, adjustments := matrix, (*yaml.Node)(nil)
+	if matrix.Kind == yaml.MappingNode {
+		setup = mappingValue(matrix, "setup")
+		adjustments = mappingValue(matrix, "adjustments")
+	}
+	if setup == nil {
+		return nil
+	}
+
+	// Each dimension's values, with names only for the dimensions of a setup mapping
+	var names []string
+	var values [][]string
+	switch setup.Kind {
+	case yaml.SequenceNode:
+		names = []string{""}
+		values = [][]string{scalarValues(setup)}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(setup.Content); i += 2 {
+			names = append(names, setup.Content[i].Value)
+			values = append(values, scalarValues(setup.Content[i+1]))
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	preview := &MatrixPreview{}
+	for _, name := range names {
+		if name == "" {
+			preview.Dimensions = append(preview.Dimensions, "matrix")
+		} else {
+			preview.Dimensions = append(preview.Dimensions, "matrix."+name)
+		}
+	}
+
+	// The cartesian product, varying the last dimension fastest
+	combinations := [][]string{{}}
+	for _, dimension := range values {
+		var next [][]string
+		for _, combination := range combinations {
+			for _, value := range dimension {
+				next = append(next, append(append([]string(nil), combination...), value))
+			}
+		}
+		combinations = next
+	}
+	for _, combination := range combinations {
+		preview.Jobs = append(preview.Jobs, MatrixJob{Values: combination})
+	}
+
+	if adjustments != nil && adjustments.Kind == yaml.SequenceNode {
+		for _, adjustment := range adjustments.Content {
+			applyMatrixAdjustment(preview, names, adjustment)
+		}
+	}
+
+	for _, job := range preview.Jobs {
+		if !job.Skipped {
+			preview.Count++
+		}
+	}
+	return preview
+}
+
+// applyMatrixAdjustment skips, soft fails or adds the combination an adjustment names with
+// `with`. Adjustments naming only some of the dimensions match nothing, as in Buildkite.
+func applyMatrixAdjustment(preview *MatrixPreview, names []string, adjustment *yaml.Node) {
+	with := mappingValue(adjustment, "with")
+	if with == nil {
+		return
+	}
+
+	combination := make([]string, len(names))
+	switch {
+	case with.Kind == yaml.ScalarNode && len(names) == 1 && names[0] == "":
+		combination[0] = with.Value
+	case with.Kind == yaml.MappingNode && names[0] != "":
+		if len(with.Content) != 2*len(names) {
+			return
+		}
+		for i, name := range names {
+			value := mappingValue(with, name)
+			if value == nil || value.Kind != yaml.ScalarNode {
+				return
+			}
+			combination[i] = value.Value
+		}
+	default:
+		return
+	}
+
+	job := matchingMatrixJob(preview.Jobs, combination)
+	if job == nil {
+		preview.Jobs = append(preview.Jobs, MatrixJob{Values: combination, Added: true})
+		job = &preview.Jobs[len(preview.Jobs)-1]
+	}
+
+	// skip and soft_fail take a boolean, or a reason and exit statuses respectively
+	if skip := mappingValue(adjustment, "skip"); skip != nil && skip.Kind == yaml.ScalarNode {
+		job.Skipped = skip.Value != "false" && skip.Value != ""
+	}
+	if softFail := mappingValue(adjustment, "soft_fail"); softFail != nil {
+		job.SoftFail = softFail.Kind != yaml.ScalarNode || softFail.Value != "false"
+	}
+}
+
+// matchingMatrixJob finds the job with the combination of values
+func matchingMatrixJob(jobs []MatrixJob, combination []string) *MatrixJob {
+	for i := range jobs {
+		matches := len(jobs[i].Values) == len(combination)
+		for j := 0; matches && j < len(combination); j++ {
+			matches = jobs[i].Values[j] == combination[j]
+		}
+		if matches {
+			return &jobs[i]
+		}
+	}
+	return nil
+}
+
+// scalarValues lists the scalar items of a sequence
+func scalarValues(list *yaml.Node) []string {
+	var values []string
+	if list == nil || list.Kind != yaml.SequenceNode {
+		return values
+	}
+	for _, item := range list.Content {
+		if item.Kind == yaml.ScalarNode {
+			values = append(values, item.Value)
+		}
+	}
+	return values
+}
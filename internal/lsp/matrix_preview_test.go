@@ -0,0 +1,125 @@
+package lsp
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+const matrixPreviewPipeline = `steps:
+  - label: "Test {{matrix.os}} {{matrix.arch}}"
+    command: make test
+    matrix:
+      setup:
+        os: [linux, darwin]
+        arch: [amd64, arm64]
+      adjustments:
+        - with:
+            os: darwin
+            arch: amd64
+          skip: "No Intel runners"
+        - with:
+            os: linux
+            arch: arm64
+          soft_fail: true
+        - with:
+            os: windows
+            arch: amd64
+        - with:
+            os: linux
+          skip: true
+  - label: "Lint {{matrix}}"
+    command: make lint
+    matrix:
+      - go
+      - shell
+  - command: make build`
+
+func TestServer_MatrixPreview(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///.buildkite/pipeline.yml")
+	server.documentManager.OpenDocument(uri, 1, matrixPreviewPipeline)
+
+	preview := func(line uint32) *MatrixPreview {
+		t.Helper()
+		result, err := server.MatrixPreview(context.Background(), &protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: line, Character: 4},
+		})
+		if err != nil {
+			t.Fatalf("MatrixPreview failed: %v", err)
+		}
+		return result
+	}
+
+	expected := &MatrixPreview{
+		Dimensions: []string{"matrix.os", "matrix.arch"},
+		Jobs: []MatrixJob{
+			{Values: []string{"linux", "amd64"}},
+			{Values: []string{"linux", "arm64"}, SoftFail: true},
+			{Values: []string{"darwin", "amd64"}, Skipped: true},
+			{Values: []string{"darwin", "arm64"}},
+			{Values: []string{"windows", "amd64"}, Added: true},
+		},
+		Count: 4,
+	}
+	// From within the adjustments too
+	for _, line := range []uint32{2, 11} {
+		if got := preview(line); !reflect.DeepEqual(got, expected) {
+			t.Errorf("Expected at line %d:\n%+v\ngot:\n%+v", line, expected, got)
+		}
+	}
+
+	expected = &MatrixPreview{
+		Dimensions: []string{"matrix"},
+		Jobs:       []MatrixJob{{Values: []string{"go"}}, {Values: []string{"shell"}}},
+		Count:      2,
+	}
+	if got := preview(25); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected the single-dimension matrix:\n%+v\ngot:\n%+v", expected, got)
+	}
+
+	if got := preview(30); got != nil {
+		t.Errorf("Expected no preview for a step without a matrix, got %+v", got)
+	}
+}
+
+func TestExpandMatrixSingleDimensionSetup(t *testing.T) {
+	pipeline := `steps:
+  - command: make
+    matrix:
+      setup: [1, 2, 3]
+      adjustments:
+        - with: 2
+          skip: true
+        - with: 4
+          soft_fail:
+            - exit_status: 1`
+
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///.buildkite/pipeline.yml")
+	server.documentManager.OpenDocument(uri, 1, pipeline)
+	result, err := server.MatrixPreview(context.Background(), &protocol.TextDocumentPositionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Position:     protocol.Position{Line: 1, Character: 4},
+	})
+	if err != nil {
+		t.Fatalf("MatrixPreview failed: %v", err)
+	}
+
+	expected := &MatrixPreview{
+		Dimensions: []string{"matrix"},
+		Jobs: []MatrixJob{
+			{Values: []string{"1"}},
+			{Values: []string{"2"}, Skipped: true},
+			{Values: []string{"3"}},
+			{Values: []string{"4"}, SoftFail: true, Added: true},
+		},
+		Count: 3,
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected:\n%+v\ngot:\n%+v", expected, result)
+	}
+}
@@ -0,0 +1,157 @@
+package lsp
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.lsp.dev/protocol"
+
+	"github.com/mcncl/buildkite-ls/internal/context"
+)
+
+// metaDataKeyChar matches a character of a meta-data key, which ends at a quote,
+// an escape, or a shell metacharacter such as the `)` closing a $(...) substitution
+const metaDataKeyChar = "[^\"'\\s\\\\`;|&()<>]"
+
+var (
+	// metaDataGetPattern matches `buildkite-agent meta-data get <key>` with an optionally quoted key
+	metaDataGetPattern = regexp.MustCompile(`buildkite-agent\s+meta-data\s+get\s+\\?["']?(` + metaDataKeyChar + `+)`)
+	// metaDataSetPattern matches `buildkite-agent meta-data set <key>` with an optionally quoted key
+	metaDataSetPattern = regexp.MustCompile(`buildkite-agent\s+meta-data\s+set\s+\\?["']?(` + metaDataKeyChar + `+)`)
+	// metaDataGetPrefixPattern matches a meta-data get whose key is still being typed
+	metaDataGetPrefixPattern = regexp.MustCompile(`buildkite-agent\s+meta-data\s+get\s+\\?["']?(` + metaDataKeyChar + `*)$`)
+)
+
+// metaDataField is a block/input step field whose value is stored as build meta-data
+type metaDataField struct {
+	Key       string
+	StepLabel string
+}
+
+// declaredMetaDataFields scans block and input steps for the keys of their fields
+func declaredMetaDataFields(lines []string) []metaDataField {
+	var fields []metaDataField
+
+	stepLabel := ""
+	inFields := false
+	fieldsIndent := -1
+
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		indent := 0
+		for indent < len(line) && (line[indent] == ' ' || line[indent] == '\t') {
+			indent++
+		}
+
+		if inFields && indent <= fieldsIndent {
+			inFields = false
+		}
+
+		key := yamlKey(line)
+		value := ""
+		if colonIndex := strings.Index(trimmed, ":"); colonIndex != -1 {
+			value = strings.Trim(strings.TrimSpace(trimmed[colonIndex+1:]), `"'`)
+		}
+
+		switch {
+		case inFields && key == "key" && value != "":
+			fields = append(fields, metaDataField{Key: value, StepLabel: stepLabel})
+		case !inFields && (key == "block" || key == "input"):
+			stepLabel = value
+		case !inFields && key == "fields":
+			inFields = true
+			fieldsIndent = indent
+		}
+	}
+
+	return fields
+}
+
+// getMetaDataKeyCompletions offers field keys declared by earlier block/input steps
+// when the cursor is on the key argument of `buildkite-agent meta-data get`
+func (cp *CompletionProvider) getMetaDataKeyCompletions(posCtx *context.PositionContext) ([]protocol.CompletionItem, bool) {
+	beforeCursor := posCtx.CurrentLine
+	if posCtx.CharIndex <= len(beforeCursor) {
+		beforeCursor = beforeCursor[:posCtx.CharIndex]
+	}
+
+	if !metaDataGetPrefixPattern.MatchString(beforeCursor) {
+		return nil, false
+	}
+
+	// Only steps above the current line can have collected the value
+	earlierLines := posCtx.ContextLines
+	if len(earlierLines) > 0 {
+		earlierLines = earlierLines[:len(earlierLines)-1]
+	}
+
+	items := []protocol.CompletionItem{}
+	seen := make(map[string]bool)
+	for _, field := range declaredMetaDataFields(earlierLines) {
+		if seen[field.Key] {
+			continue
+		}
+		seen[field.Key] = true
+
+		detail := "Meta-data field"
+		if field.StepLabel != "" {
+			detail = fmt.Sprintf("Field from step '%s'", field.StepLabel)
+		}
+
+		items = append(items, protocol.CompletionItem{
+			Label:  field.Key,
+			Kind:   protocol.CompletionItemKindValue,
+			Detail: detail,
+		})
+	}
+
+	return items, true
+}
+
+// validateMetaDataReferences warns when a command reads a meta-data key that no block or
+// input step field declares and no command sets
+func (s *Server) validateMetaDataReferences(lines []string) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	declared := make(map[string]bool)
+	for _, field := range declaredMetaDataFields(lines) {
+		declared[field.Key] = true
+	}
+	for _, line := range lines {
+		for _, match := range metaDataSetPattern.FindAllStringSubmatch(line, -1) {
+			declared[match[1]] = true
+		}
+	}
+
+	for lineNum, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		for _, match := range metaDataGetPattern.FindAllStringSubmatchIndex(line, -1) {
+			key := line[match[2]:match[3]]
+			// Keys built from shell variables can't be checked statically
+			if declared[key] || strings.Contains(key, "$") {
+				continue
+			}
+
+			diagnostics = append(diagnostics, protocol.Diagnostic{
+				Range: protocol.Range{
+					Start: protocol.Position{Line: uint32(lineNum), Character: uint32(match[2])},
+					End:   protocol.Position{Line: uint32(lineNum), Character: uint32(match[3])},
+				},
+				Severity: protocol.DiagnosticSeverityWarning,
+				Message:  fmt.Sprintf("Meta-data key '%s' is not declared by any block or input step field", key),
+				Source:   "buildkite-ls",
+				Code:     "undeclared-meta-data-key",
+			})
+		}
+	}
+
+	return diagnostics
+}
@@ -0,0 +1,146 @@
+package lsp
+
+import (
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+
+	"github.com/mcncl/buildkite-ls/internal/context"
+)
+
+const metaDataPipeline = `steps:
+  - block: "Release"
+    fields:
+      - text: "Version"
+        key: "release-version"
+      - select: "Channel"
+        key: channel
+        options:
+          - label: "Stable"
+            value: "stable"
+  - input: "Notes"
+    fields:
+      - text: "Notes"
+        key: "release-notes"
+  - label: "Publish"
+    command: buildkite-agent meta-data get "release-version"`
+
+func TestDeclaredMetaDataFields(t *testing.T) {
+	fields := declaredMetaDataFields(strings.Split(metaDataPipeline, "\n"))
+
+	expected := []metaDataField{
+		{Key: "release-version", StepLabel: "Release"},
+		{Key: "channel", StepLabel: "Release"},
+		{Key: "release-notes", StepLabel: "Notes"},
+	}
+
+	if len(fields) != len(expected) {
+		t.Fatalf("Expected %d fields, got %d: %+v", len(expected), len(fields), fields)
+	}
+
+	for i, field := range fields {
+		if field != expected[i] {
+			t.Errorf("Field %d: expected %+v, got %+v", i, expected[i], field)
+		}
+	}
+}
+
+func TestCompletionProvider_MetaDataKeys(t *testing.T) {
+	provider := newTestCompletionProvider()
+
+	lines := strings.Split(metaDataPipeline, "\n")
+	currentLine := `    command: buildkite-agent meta-data get "rel`
+	lines[len(lines)-1] = currentLine
+
+	posCtx := &context.PositionContext{
+		URI:          protocol.DocumentURI("file:///test.yml"),
+		Position:     protocol.Position{Line: uint32(len(lines) - 1), Character: uint32(len(currentLine))},
+		CurrentLine:  currentLine,
+		CharIndex:    len(currentLine),
+		ContextLines: lines,
+		FullContent:  strings.Join(lines, "\n"),
+	}
+
+	completions := provider.GetCompletions(posCtx)
+	if len(completions) != 3 {
+		t.Fatalf("Expected 3 meta-data key completions, got %d: %+v", len(completions), completions)
+	}
+
+	if completions[0].Label != "release-version" {
+		t.Errorf("Expected first completion 'release-version', got %q", completions[0].Label)
+	}
+
+	if completions[0].Detail != "Field from step 'Release'" {
+		t.Errorf("Unexpected completion detail: %q", completions[0].Detail)
+	}
+}
+
+func TestServer_ValidateMetaDataReferences(t *testing.T) {
+	server := newTestServer()
+
+	tests := []struct {
+		name         string
+		content      string
+		expectedKeys []string
+	}{
+		{
+			name:         "declared field key",
+			content:      metaDataPipeline,
+			expectedKeys: nil,
+		},
+		{
+			name: "undeclared key",
+			content: `steps:
+  - label: "Deploy"
+    commands:
+      - buildkite-agent meta-data get "target-env"
+      - buildkite-agent meta-data get \"$${KEY}\"`,
+			expectedKeys: []string{"target-env"},
+		},
+		{
+			name: "key read by a command substitution",
+			content: `steps:
+  - block: "Release"
+    fields:
+      - text: "Environment"
+        key: env
+  - label: "Deploy"
+    commands:
+      - export TARGET=$(buildkite-agent meta-data get env)
+      - export CHANNEL=` + "`buildkite-agent meta-data get env`" + `
+      - buildkite-agent meta-data get env; echo done
+      - echo "$(buildkite-agent meta-data get target-env)"`,
+			expectedKeys: []string{"target-env"},
+		},
+		{
+			name: "key set by an earlier command",
+			content: `steps:
+  - command: buildkite-agent meta-data set "target-env" "prod"
+  - command: "buildkite-agent meta-data get \"target-env\""`,
+			expectedKeys: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diagnostics := server.validateMetaDataReferences(strings.Split(tt.content, "\n"))
+			if len(diagnostics) != len(tt.expectedKeys) {
+				t.Fatalf("Expected %d diagnostics, got %d: %+v", len(tt.expectedKeys), len(diagnostics), diagnostics)
+			}
+
+			for i, key := range tt.expectedKeys {
+				diagnostic := diagnostics[i]
+				if diagnostic.Code != "undeclared-meta-data-key" {
+					t.Errorf("Expected code undeclared-meta-data-key, got %v", diagnostic.Code)
+				}
+				if diagnostic.Severity != protocol.DiagnosticSeverityWarning {
+					t.Errorf("Expected warning severity, got %v", diagnostic.Severity)
+				}
+				if !strings.Contains(diagnostic.Message, "'"+key+"'") {
+					t.Errorf("Expected message to mention %q, got %q", key, diagnostic.Message)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package lsp
+
+import (
+	"sync"
+
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+// lastParse holds the parse of the content nodePathAt last looked in. A completion or hover
+// looks up several paths in the same document, which is then parsed once. Its nodes are
+// shared between callers, so they must not be written to.
+var lastParse struct {
+	mu       sync.Mutex
+	content  string
+	pipeline *parser.Pipeline
+	err      error
+	parsed   bool
+}
+
+// parseContent parses the content, reusing the last parse when the content hasn't changed
+func parseContent(content string) (*parser.Pipeline, error) {
+	lastParse.mu.Lock()
+	if lastParse.parsed && lastParse.content == content {
+		pipeline, err := lastParse.pipeline, lastParse.err
+		lastParse.mu.Unlock()
+		return pipeline, err
+	}
+	lastParse.mu.Unlock()
+
+	pipeline, err := parser.ParseYAML([]byte(content))
+
+	lastParse.mu.Lock()
+	lastParse.content, lastParse.pipeline, lastParse.err, lastParse.parsed = content, pipeline, err, true
+	lastParse.mu.Unlock()
+	return pipeline, err
+}
+
+// nodePathAt returns the path to the node at the position in the content. It reports false
+// when the content isn't valid YAML, as while a line is half typed, leaving callers to read
+// the lines instead.
+func nodePathAt(content string, position protocol.Position) (parser.NodePath, bool) {
+	pipeline, err := parseContent(content)
+	if err != nil || pipeline.YAMLNode == nil || len(pipeline.YAMLNode.Content) == 0 {
+		return parser.NodePath{}, false
+	}
+	return pipeline.NodeAtPosition(int(position.Line), int(position.Character)), true
+}
+
+// pathStepIndex returns the index on the path of the innermost step: an item of the steps
+// list of the pipeline or of a group. It returns -1 when the path isn't inside a step.
+func pathStepIndex(path parser.NodePath) int {
+	step := -1
+	owner := 0 // the pipeline, then each step found, whose steps list is looked for
+	for i := 1; i+1 < len(path.Nodes); i++ {
+		if i-1 != owner || path.Nodes[i].Key == nil || path.Nodes[i].Key.Value != "steps" {
+			continue
+		}
+		step, owner = i+1, i+1
+	}
+	return step
+}
+
+// pathStep returns the innermost step on the path, or nil when the path isn't inside a step
+func pathStep(path parser.NodePath) *yaml.Node {
+	if i := pathStepIndex(path); i >= 0 {
+		return path.Nodes[i].Node
+	}
+	return nil
+}
+
+// pathStepProperty returns the step property the path is in, as in `plugins` for a plugin's
+// options, or "" when the path ends at the step
+func pathStepProperty(path parser.NodePath) string {
+	i := pathStepIndex(path)
+	if i < 0 || i+1 >= len(path.Nodes) || path.Nodes[i+1].Key == nil {
+		return ""
+	}
+	return path.Nodes[i+1].Key.Value
+}
+
+// stepNodeType returns the type of a step from its type key or `type:`, or "" when the step
+// doesn't have one yet
+func stepNodeType(step *yaml.Node) string {
+	if step.Kind == yaml.ScalarNode {
+		return stepTypeKeys[step.Value]
+	}
+	if step.Kind != yaml.MappingNode {
+		return ""
+	}
+	for i := 0; i+1 < len(step.Content); i += 2 {
+		key := step.Content[i].Value
+		if key == "type" {
+			key = stringNodeValue(step.Content[i+1])
+		}
+		if stepType, ok := stepTypeKeys[key]; ok {
+			return stepType
+		}
+	}
+	return ""
+}
+
+// stepInfoOf describes a step mapping for the code actions offered on it
+func stepInfoOf(edit *structuredEdit, step *yaml.Node) *StepInfo {
+	info := &StepInfo{
+		StartLine: step.Line - 1,
+		EndLine:   int(edit.nodeEnd(step).Line),
+	}
+
+	for i := 0; i+1 < len(step.Content); i += 2 {
+		key, value := step.Content[i], step.Content[i+1]
+		line := key.Line - 1
+		switch key.Value {
+		case "label":
+			info.HasLabel = true
+			info.LabelLine = line
+		case "name":
+			info.HasName = true
+			info.NameLine = line
+		case "key":
+			info.HasKey = true
+		case "command", "commands":
+			info.IsCommandStep = true
+			info.HasStepType = true
+			info.CommandLine = line
+			info.StepTypeLine = line
+			if key.Value == "command" && value.Kind == yaml.ScalarNode {
+				if value.Value == "" {
+					info.HasEmptyCommand = true
+				} else {
+					info.HasSingleCommand = true
+				}
+			}
+		case "wait", "waiter", "block", "input", "trigger", "group":
+			info.HasStepType = true
+			info.StepTypeLine = line
+		}
+	}
+
+	return info
+}
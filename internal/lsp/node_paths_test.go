@@ -0,0 +1,155 @@
+package lsp
+
+import (
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+
+	bkcontext "github.com/mcncl/buildkite-ls/internal/context"
+)
+
+// nodePathPipeline has the YAML the line scanning misread: block scalars holding text that
+// looks like keys, flow-style steps, comments and properties after a step's plugins
+var nodePathPipeline = []string{
+	"steps:",
+	"  - label: |",
+	"      wait: for the deploy",
+	"    # command: make",
+	"    trigger: deploy",
+	"  - { label: \"Build\", key: build, command: \"\" }",
+	"  - label: Test",
+	"    plugins:",
+	"      - docker#v5.13.0:",
+	"          image: golang",
+	"    command: make test",
+	"    depends_on: [build, lint]",
+	"  - group: Checks",
+	"    steps:",
+	"      - block: Release",
+	"",
+}
+
+func nodePathContext(line, char int) *bkcontext.PositionContext {
+	return &bkcontext.PositionContext{
+		URI:         "file:///test.yml",
+		Position:    protocol.Position{Line: uint32(line), Character: uint32(char)},
+		CurrentLine: nodePathPipeline[line],
+		CharIndex:   char,
+		FullContent: strings.Join(nodePathPipeline, "\n"),
+	}
+}
+
+func TestServer_DetectStepType_AST(t *testing.T) {
+	server := newTestServer()
+
+	tests := []struct {
+		name      string
+		line, col int
+		expected  string
+	}{
+		{"block scalar reading like a wait", 2, 8, "trigger"},
+		{"comment reading like a command", 3, 6, "trigger"},
+		{"flow-style step", 5, 30, "command"},
+		{"after the plugins", 10, 6, "command"},
+		{"step in a group", 14, 10, "block"},
+		{"group itself", 12, 6, "group"},
+		{"outside the steps", 0, 2, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if stepType := server.detectStepType(nodePathContext(tt.line, tt.col)); stepType != tt.expected {
+				t.Errorf("Expected step type %q, got %q", tt.expected, stepType)
+			}
+		})
+	}
+}
+
+func TestServer_PluginContext_AST(t *testing.T) {
+	server := newTestServer()
+
+	if !server.isInPluginContext(nodePathContext(9, 12)) {
+		t.Error("Expected a plugin's options to be in the plugin context")
+	}
+	// The line scanning found plugins: above the command and took it for a plugin option
+	if server.isInPluginContext(nodePathContext(10, 6)) {
+		t.Error("Expected the command after the plugins not to be in the plugin context")
+	}
+	if !server.isInStepContext(nodePathContext(10, 6)) {
+		t.Error("Expected the command to be in the step context")
+	}
+}
+
+func TestServer_StepReference_AST(t *testing.T) {
+	server := newTestServer()
+
+	ctx := nodePathContext(11, 19)
+	if !server.isStepReference(ctx, "build") {
+		t.Fatal("Expected an entry of a flow-style depends_on to be a step reference")
+	}
+	location := server.findStepDefinition(ctx, "build")
+	if location == nil || location.Range.Start.Line != 5 {
+		t.Errorf("Expected the flow-style step on line 5, got %+v", location)
+	}
+
+	if server.isStepReference(nodePathContext(10, 14), "make") {
+		t.Error("Expected a command not to be a step reference")
+	}
+}
+
+func TestServer_AnalyzeStepAtRange_AST(t *testing.T) {
+	server := newTestServer()
+
+	info := server.analyzeStepAtRange(protocol.Range{Start: protocol.Position{Line: 5, Character: 10}}, nodePathPipeline)
+	if info == nil {
+		t.Fatal("Expected the flow-style step to be found")
+	}
+	if !info.HasLabel || !info.HasKey || !info.IsCommandStep || !info.HasEmptyCommand || info.StartLine != 5 || info.EndLine != 5 {
+		t.Errorf("Unexpected step info for the flow-style step: %+v", info)
+	}
+
+	// A position inside the step's lines finds it, not only its first line
+	info = server.analyzeStepAtRange(protocol.Range{Start: protocol.Position{Line: 9, Character: 12}}, nodePathPipeline)
+	if info == nil || info.StartLine != 6 || info.EndLine != 11 || !info.HasSingleCommand || info.CommandLine != 10 {
+		t.Errorf("Unexpected step info for the step with plugins: %+v", info)
+	}
+
+	info = server.analyzeStepAtRange(protocol.Range{Start: protocol.Position{Line: 2, Character: 8}}, nodePathPipeline)
+	if info == nil || !info.HasStepType || info.StepTypeLine != 4 || info.IsCommandStep {
+		t.Errorf("Unexpected step info for the trigger step: %+v", info)
+	}
+}
+
+func TestServer_DetectStepType_Unparsed(t *testing.T) {
+	server := newTestServer()
+
+	// Half-typed documents don't parse, so the lines are read instead
+	content := "steps:\n  - command: make\n    key: [build\n"
+	ctx := &bkcontext.PositionContext{
+		Position:    protocol.Position{Line: 2, Character: 4},
+		CurrentLine: "    key: [build",
+		FullContent: content,
+	}
+	if stepType := server.detectStepType(ctx); stepType != "command" {
+		t.Errorf("Expected step type command, got %q", stepType)
+	}
+}
+
+func TestNodePathAt_ReusesParse(t *testing.T) {
+	content := strings.Join(nodePathPipeline, "\n")
+
+	first, ok := nodePathAt(content, protocol.Position{Line: 4, Character: 6})
+	if !ok {
+		t.Fatal("Expected the pipeline to parse")
+	}
+	second, _ := nodePathAt(content, protocol.Position{Line: 9, Character: 12})
+	if first.Nodes[0].Node != second.Nodes[0].Node {
+		t.Error("Expected lookups in the same content to share one parse")
+	}
+
+	edited, _ := nodePathAt(content+"      - wait\n", protocol.Position{Line: 4, Character: 6})
+	if edited.Nodes[0].Node == first.Nodes[0].Node {
+		t.Error("Expected changed content to be parsed again")
+	}
+}
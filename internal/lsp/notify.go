@@ -0,0 +1,508 @@
+package lsp
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+
+	"github.com/mcncl/buildkite-ls/internal/context"
+	"github.com/mcncl/buildkite-ls/internal/expression"
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+// buildkiteEnvVars are the BUILDKITE_ environment variables the agent sets for a job, and so
+// the ones a pipeline upload can interpolate
+var buildkiteEnvVars = map[string]bool{
+	"BUILDKITE_AGENT_ID":                           true,
+	"BUILDKITE_AGENT_NAME":                         true,
+	"BUILDKITE_ARTIFACT_PATHS":                     true,
+	"BUILDKITE_BRANCH":                             true,
+	"BUILDKITE_BUILD_AUTHOR":                       true,
+	"BUILDKITE_BUILD_AUTHOR_EMAIL":                 true,
+	"BUILDKITE_BUILD_CHECKOUT_PATH":                true,
+	"BUILDKITE_BUILD_CREATOR":                      true,
+	"BUILDKITE_BUILD_CREATOR_EMAIL":                true,
+	"BUILDKITE_BUILD_CREATOR_TEAMS":                true,
+	"BUILDKITE_BUILD_ID":                           true,
+	"BUILDKITE_BUILD_NUMBER":                       true,
+	"BUILDKITE_BUILD_URL":                          true,
+	"BUILDKITE_COMMAND":                            true,
+	"BUILDKITE_COMMIT":                             true,
+	"BUILDKITE_GROUP_ID":                           true,
+	"BUILDKITE_GROUP_KEY":                          true,
+	"BUILDKITE_GROUP_LABEL":                        true,
+	"BUILDKITE_JOB_ID":                             true,
+	"BUILDKITE_LABEL":                              true,
+	"BUILDKITE_MESSAGE":                            true,
+	"BUILDKITE_ORGANIZATION_SLUG":                  true,
+	"BUILDKITE_PARALLEL_JOB":                       true,
+	"BUILDKITE_PARALLEL_JOB_COUNT":                 true,
+	"BUILDKITE_PIPELINE_DEFAULT_BRANCH":            true,
+	"BUILDKITE_PIPELINE_ID":                        true,
+	"BUILDKITE_PIPELINE_NAME":                      true,
+	"BUILDKITE_PIPELINE_PROVIDER":                  true,
+	"BUILDKITE_PIPELINE_SLUG":                      true,
+	"BUILDKITE_PIPELINE_TEAMS":                     true,
+	"BUILDKITE_PULL_REQUEST":                       true,
+	"BUILDKITE_PULL_REQUEST_BASE_BRANCH":           true,
+	"BUILDKITE_PULL_REQUEST_DRAFT":                 true,
+	"BUILDKITE_PULL_REQUEST_LABELS":                true,
+	"BUILDKITE_PULL_REQUEST_REPO":                  true,
+	"BUILDKITE_REBUILT_FROM_BUILD_ID":              true,
+	"BUILDKITE_REBUILT_FROM_BUILD_NUMBER":          true,
+	"BUILDKITE_REPO":                               true,
+	"BUILDKITE_RETRY_COUNT":                        true,
+	"BUILDKITE_SOURCE":                             true,
+	"BUILDKITE_STEP_ID":                            true,
+	"BUILDKITE_STEP_KEY":                           true,
+	"BUILDKITE_TAG":                                true,
+	"BUILDKITE_TIMEOUT":                            true,
+	"BUILDKITE_TRIGGERED_FROM_BUILD_ID":            true,
+	"BUILDKITE_TRIGGERED_FROM_BUILD_NUMBER":        true,
+	"BUILDKITE_TRIGGERED_FROM_BUILD_PIPELINE_SLUG": true,
+	"BUILDKITE_UNBLOCKER":                          true,
+	"BUILDKITE_UNBLOCKER_EMAIL":                    true,
+	"BUILDKITE_UNBLOCKER_ID":                       true,
+	"BUILDKITE_UNBLOCKER_TEAMS":                    true,
+}
+
+// buildkiteVarPattern matches $BUILDKITE_X and ${BUILDKITE_X} interpolations, capturing the
+// character before so $$-escaped ones can be skipped
+var buildkiteVarPattern = regexp.MustCompile(`(^|[^$])\$\{?(BUILDKITE_[A-Z0-9_]+)`)
+
+// slackKeyPattern matches a key that is still being typed on its own line
+var slackKeyPattern = regexp.MustCompile(`^\s*\w*$`)
+
+// slackNotifyKeys are the keys of the object form of a Slack notification
+var slackNotifyKeys = []protocol.CompletionItem{
+	{
+		Label:            "channels",
+		Kind:             protocol.CompletionItemKindProperty,
+		Detail:           "Slack channels to notify",
+		Documentation:    &protocol.MarkupContent{Kind: protocol.Markdown, Value: "Channels or users to notify, e.g. `#deploys`, `@jane` or `my-workspace#deploys` for a specific workspace."},
+		InsertText:       "channels:\n  - \"${1:#channel}\"",
+		InsertTextFormat: protocol.InsertTextFormatSnippet,
+	},
+	{
+		Label:            "message",
+		Kind:             protocol.CompletionItemKindProperty,
+		Detail:           "Custom notification message",
+		Documentation:    &protocol.MarkupContent{Kind: protocol.Markdown, Value: "Message sent in place of the default one. `BUILDKITE_` environment variables such as `${BUILDKITE_BUILD_NUMBER}` are interpolated when the pipeline is uploaded."},
+		InsertText:       "message: \"${1:Build ${BUILDKITE_BUILD_NUMBER} finished}\"",
+		InsertTextFormat: protocol.InsertTextFormatSnippet,
+	},
+}
+
+// getSlackNotifyCompletions offers the keys of a Slack notification's object form
+func (cp *CompletionProvider) getSlackNotifyCompletions(posCtx *context.PositionContext) ([]protocol.CompletionItem, bool) {
+	beforeCursor := posCtx.CurrentLine
+	if posCtx.CharIndex <= len(beforeCursor) {
+		beforeCursor = beforeCursor[:posCtx.CharIndex]
+	}
+	if !slackKeyPattern.MatchString(beforeCursor) {
+		return nil, false
+	}
+
+	lines := posCtx.ContextLines
+	slackLine := enclosingKeyLine(lines)
+	if slackLine < 0 || yamlKey(lines[slackLine]) != "slack" || enclosingKey(lines[:slackLine+1]) != "notify" {
+		return nil, false
+	}
+
+	// Keys already set on the notification aren't offered again
+	existing := make(map[string]bool)
+	indent := len(lines[len(lines)-1]) - len(strings.TrimLeft(lines[len(lines)-1], " "))
+	for i := slackLine + 1; i < len(lines)-1; i++ {
+		if len(lines[i])-len(strings.TrimLeft(lines[i], " ")) == indent {
+			existing[yamlKey(lines[i])] = true
+		}
+	}
+
+	var items []protocol.CompletionItem
+	for _, item := range slackNotifyKeys {
+		if !existing[item.Label] {
+			items = append(items, item)
+		}
+	}
+	return items, true
+}
+
+// notifyItemPattern matches a notify list item whose service is still being typed
+var notifyItemPattern = regexp.MustCompile(`^\s*-\s*\w*$`)
+
+// notifyServiceCompletions are the notify entries for each service, written in the form the
+// service takes: a string for most, an object for the GitHub ones
+var notifyServiceCompletions = map[string]protocol.CompletionItem{
+	"slack": {
+		Label:            "slack",
+		Detail:           "Slack notification",
+		Kind:             protocol.CompletionItemKindProperty,
+		Documentation:    &protocol.MarkupContent{Kind: protocol.Markdown, Value: "Posts to a Slack channel, e.g. `#deploys`. Use the object form with `channels` and `message` to post to several channels or customize the message."},
+		InsertText:       "slack: \"${1:#channel}\"",
+		InsertTextFormat: protocol.InsertTextFormatSnippet,
+	},
+	"email": {
+		Label:            "email",
+		Detail:           "Email notification",
+		Kind:             protocol.CompletionItemKindProperty,
+		Documentation:    &protocol.MarkupContent{Kind: protocol.Markdown, Value: "Emails the build's result to the address."},
+		InsertText:       "email: \"${1:dev@example.com}\"",
+		InsertTextFormat: protocol.InsertTextFormatSnippet,
+	},
+	"webhook": {
+		Label:            "webhook",
+		Detail:           "Webhook notification",
+		Kind:             protocol.CompletionItemKindProperty,
+		Documentation:    &protocol.MarkupContent{Kind: protocol.Markdown, Value: "Sends the build's events as JSON in a POST request to the URL."},
+		InsertText:       "webhook: \"${1:https://example.com/buildkite}\"",
+		InsertTextFormat: protocol.InsertTextFormatSnippet,
+	},
+	"pagerduty_change_event": {
+		Label:            "pagerduty_change_event",
+		Detail:           "PagerDuty change event",
+		Kind:             protocol.CompletionItemKindProperty,
+		Documentation:    &protocol.MarkupContent{Kind: protocol.Markdown, Value: "Creates a change event in PagerDuty when the build finishes. The value is the integration key of a Change Events integration on the PagerDuty service."},
+		InsertText:       "pagerduty_change_event: \"${1:integration-key}\"",
+		InsertTextFormat: protocol.InsertTextFormatSnippet,
+	},
+	"github_commit_status": {
+		Label:            "github_commit_status",
+		Detail:           "GitHub commit status",
+		Kind:             protocol.CompletionItemKindProperty,
+		Documentation:    &protocol.MarkupContent{Kind: protocol.Markdown, Value: "Reports the result as a commit status on GitHub, named by `context`."},
+		InsertText:       "github_commit_status:\n  context: \"${1:buildkite/pipeline}\"",
+		InsertTextFormat: protocol.InsertTextFormatSnippet,
+	},
+	"github_check": {
+		Label:            "github_check",
+		Detail:           "GitHub check",
+		Kind:             protocol.CompletionItemKindProperty,
+		Documentation:    &protocol.MarkupContent{Kind: protocol.Markdown, Value: "Reports the result as a GitHub check run, named by `context`."},
+		InsertText:       "github_check:\n  context: \"${1:buildkite/pipeline}\"",
+		InsertTextFormat: protocol.InsertTextFormatSnippet,
+	},
+	"basecamp_campfire": {
+		Label:            "basecamp_campfire",
+		Detail:           "Basecamp Campfire notification",
+		Kind:             protocol.CompletionItemKindProperty,
+		Documentation:    &protocol.MarkupContent{Kind: protocol.Markdown, Value: "Posts to a Basecamp Campfire chat through its chatbot URL."},
+		InsertText:       "basecamp_campfire: \"${1:https://3.basecamp.com/}\"",
+		InsertTextFormat: protocol.InsertTextFormatSnippet,
+	},
+}
+
+// notifyConditionCompletion is the key limiting a notify entry to some builds
+var notifyConditionCompletion = protocol.CompletionItem{
+	Label:            "if",
+	Kind:             protocol.CompletionItemKindProperty,
+	Detail:           "Only notify when the condition is true",
+	Documentation:    &protocol.MarkupContent{Kind: protocol.Markdown, Value: "A [conditional](https://buildkite.com/docs/pipelines/conditionals) checked when the notification is due, e.g. `build.state == \"failed\"`."},
+	InsertText:       "if: ${1:build.state == \"failed\"}",
+	InsertTextFormat: protocol.InsertTextFormatSnippet,
+}
+
+// getNotifyEntryCompletions offers the services a notify list item can use, each in the form
+// it takes, and `if` on the lines after an entry's service
+func (cp *CompletionProvider) getNotifyEntryCompletions(posCtx *context.PositionContext) ([]protocol.CompletionItem, bool) {
+	beforeCursor := posCtx.CurrentLine
+	if posCtx.CharIndex <= len(beforeCursor) {
+		beforeCursor = beforeCursor[:posCtx.CharIndex]
+	}
+
+	lines := posCtx.ContextLines
+	notifyLine := enclosingKeyLine(lines)
+	if notifyLine < 0 || yamlKey(lines[notifyLine]) != "notify" {
+		return nil, false
+	}
+
+	if notifyItemPattern.MatchString(beforeCursor) {
+		// The pipeline's notify is the top-level one; any other belongs to a step
+		services := stepNotifyTypes
+		if indentOf(lines[notifyLine]) == 0 {
+			services = pipelineNotifyTypes
+		}
+
+		items := make([]protocol.CompletionItem, 0, len(services))
+		for i, service := range services {
+			item := notifyServiceCompletions[service]
+			item.SortText = fmt.Sprintf("%02d", i)
+			items = append(items, item)
+		}
+		return items, true
+	}
+
+	if !slackKeyPattern.MatchString(beforeCursor) {
+		return nil, false
+	}
+
+	// The entry is the nearest list item whose keys line up with the cursor
+	indent := indentOf(lines[len(lines)-1])
+	for i := len(lines) - 2; i > notifyLine; i-- {
+		trimmed := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(trimmed, "- ") || indentOf(lines[i])+2 != indent {
+			continue
+		}
+		for j := i + 1; j < len(lines)-1; j++ {
+			if indentOf(lines[j]) == indent && yamlKey(lines[j]) == "if" {
+				return nil, true
+			}
+		}
+		if yamlKey(strings.TrimPrefix(trimmed, "- ")) == "if" {
+			return nil, true
+		}
+		return []protocol.CompletionItem{notifyConditionCompletion}, true
+	}
+	return nil, false
+}
+
+// indentOf counts the spaces a line starts with
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// validateNotifications checks the conditions of notify entries and the variables Slack
+// messages interpolate, at the pipeline level and on every step
+func (s *Server) validateNotifications(pipeline *parser.Pipeline, lines []string) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	root := pipeline.YAMLNode
+	if root == nil || len(root.Content) == 0 {
+		return diagnostics
+	}
+	for _, notify := range notifyLists(root.Content[0]) {
+		diagnostics = append(diagnostics, s.validateNotifyEntries(notify, lines)...)
+	}
+
+	return diagnostics
+}
+
+// validateNotifyServices checks the webhook and PagerDuty entries of every notify list
+func (s *Server) validateNotifyServices(pipeline *parser.Pipeline) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	root := pipeline.YAMLNode
+	if root == nil || len(root.Content) == 0 {
+		return diagnostics
+	}
+
+	for _, notify := range notifyLists(root.Content[0]) {
+		if notify.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, entry := range notify.Content {
+			diagnostics = append(diagnostics, notifyServiceDiagnostics(entry)...)
+		}
+	}
+
+	return diagnostics
+}
+
+// notifyLists returns the pipeline's notify value followed by those of its steps
+func notifyLists(root *yaml.Node) []*yaml.Node {
+	var lists []*yaml.Node
+	if notify := mappingValue(root, "notify"); notify != nil {
+		lists = append(lists, notify)
+	}
+
+	var walkSteps func(steps *yaml.Node)
+	walkSteps = func(steps *yaml.Node) {
+		if steps == nil || steps.Kind != yaml.SequenceNode {
+			return
+		}
+		for _, step := range steps.Content {
+			if notify := mappingValue(step, "notify"); notify != nil {
+				lists = append(lists, notify)
+			}
+			walkSteps(mappingValue(step, "steps"))
+		}
+	}
+	walkSteps(mappingValue(root, "steps"))
+
+	return lists
+}
+
+// validateNotifyEntries checks each entry of a notify list
+func (s *Server) validateNotifyEntries(notify *yaml.Node, lines []string) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+	if notify == nil || notify.Kind != yaml.SequenceNode {
+		return diagnostics
+	}
+
+	for _, entry := range notify.Content {
+		if condition := mappingValue(entry, "if"); condition != nil && condition.Kind == yaml.ScalarNode {
+			if _, err := expression.Parse(condition.Value); err != nil {
+				diagnostics = append(diagnostics, protocol.Diagnostic{
+					Range:    conditionErrorRange(condition, err, lines),
+					Severity: protocol.DiagnosticSeverityError,
+					Message:  fmt.Sprintf("Invalid notification condition: %v", err),
+					Source:   "buildkite-ls",
+					Code:     "invalid-notify-condition",
+				})
+			}
+		}
+
+		slack := mappingValue(entry, "slack")
+		if slack == nil || slack.Kind != yaml.MappingNode {
+			continue
+		}
+		if message := mappingValue(slack, "message"); message != nil && message.Kind == yaml.ScalarNode {
+			diagnostics = append(diagnostics, unknownVariableDiagnostics(message, lines)...)
+		}
+	}
+
+	return diagnostics
+}
+
+// notifyServiceValues describes the value of each notify service that takes a string, for
+// messages about entries without one
+var notifyServiceValues = map[string]string{
+	"webhook":                "the URL to send build events to",
+	"pagerduty_change_event": "the integration key of a PagerDuty Change Events integration",
+}
+
+// notifyServiceDiagnostics checks the value of a webhook or PagerDuty notify entry, and that
+// it has no keys other than its service and `if`
+func notifyServiceDiagnostics(entry *yaml.Node) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	// A bare service name leaves out the value the service needs
+	if entry.Kind == yaml.ScalarNode {
+		if value, ok := notifyServiceValues[entry.Value]; ok {
+			diagnostics = append(diagnostics, nodeDiagnostic(entry, protocol.DiagnosticSeverityError, "missing-notify-value",
+				fmt.Sprintf("A %s notification needs %s: write it as `%s: \"...\"`", entry.Value, value, entry.Value)))
+		}
+		return diagnostics
+	}
+	if entry.Kind != yaml.MappingNode {
+		return diagnostics
+	}
+
+	var service string
+	for i := 0; i+1 < len(entry.Content); i += 2 {
+		if _, ok := notifyServiceValues[entry.Content[i].Value]; ok {
+			service = entry.Content[i].Value
+		}
+	}
+	if service == "" {
+		return diagnostics
+	}
+
+	for i := 0; i+1 < len(entry.Content); i += 2 {
+		key, value := entry.Content[i], entry.Content[i+1]
+		switch key.Value {
+		case "if":
+		case service:
+			diagnostics = append(diagnostics, notifyServiceValueDiagnostics(service, key, value)...)
+		default:
+			diagnostics = append(diagnostics, nodeDiagnostic(key, protocol.DiagnosticSeverityError, "unknown-notify-key",
+				fmt.Sprintf("'%s' isn't a key of a %s notification, which only takes `%s` and `if`", key.Value, service, service)))
+		}
+	}
+
+	return diagnostics
+}
+
+// notifyServiceValueDiagnostics checks the string a webhook or PagerDuty notification takes
+func notifyServiceValueDiagnostics(service string, key, value *yaml.Node) []protocol.Diagnostic {
+	switch {
+	case isImplicitNull(value) || (value.Kind == yaml.ScalarNode && strings.TrimSpace(value.Value) == ""):
+		return []protocol.Diagnostic{nodeDiagnostic(key, protocol.DiagnosticSeverityError, "missing-notify-value",
+			fmt.Sprintf("A %s notification needs %s", service, notifyServiceValues[service]))}
+	case value.Kind != yaml.ScalarNode || value.Tag != "!!str":
+		return []protocol.Diagnostic{nodeDiagnostic(value, protocol.DiagnosticSeverityError, "invalid-notify-value",
+			fmt.Sprintf("%s takes a string: %s", service, notifyServiceValues[service]))}
+	case service == "webhook" && !strings.HasPrefix(value.Value, "https://") && !strings.HasPrefix(value.Value, "http://") &&
+		!strings.Contains(value.Value, "$"):
+		return []protocol.Diagnostic{nodeDiagnostic(value, protocol.DiagnosticSeverityError, "invalid-notify-value",
+			fmt.Sprintf("'%s' isn't a URL: webhook notifications are sent to an http:// or https:// address", value.Value))}
+	case service == "pagerduty_change_event" && strings.ContainsAny(value.Value, " /:") && !strings.Contains(value.Value, "$"):
+		return []protocol.Diagnostic{nodeDiagnostic(value, protocol.DiagnosticSeverityWarning, "invalid-notify-value",
+			"This doesn't look like a PagerDuty integration key, which is a 32 character string from the service's Change Events integration")}
+	}
+	return nil
+}
+
+// unknownVariableDiagnostics flags BUILDKITE_ variables in a message that the agent doesn't set
+func unknownVariableDiagnostics(message *yaml.Node, lines []string) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	// Block scalars start on the line after their key
+	first := message.Line - 1
+	last := first + strings.Count(message.Value, "\n") + 1
+	searchFrom := message.Column - 1
+
+	for _, match := range buildkiteVarPattern.FindAllStringSubmatch(message.Value, -1) {
+		name := match[2]
+		if buildkiteEnvVars[name] || strings.HasPrefix(name, "BUILDKITE_AGENT_META_DATA_") {
+			continue
+		}
+
+		line, start := first, -1
+		for ; line <= last && line < len(lines); line++ {
+			from := 0
+			if line == first {
+				from = min(searchFrom, len(lines[line]))
+			}
+			if index := strings.Index(lines[line][from:], name); index >= 0 {
+				start = from + index
+				break
+			}
+		}
+		if start < 0 {
+			line, start = first, 0
+		}
+
+		diagnostics = append(diagnostics, protocol.Diagnostic{
+			Range: protocol.Range{
+				Start: protocol.Position{Line: uint32(line), Character: uint32(start)},
+				End:   protocol.Position{Line: uint32(line), Character: uint32(start + len(name))},
+			},
+			Severity: protocol.DiagnosticSeverityWarning,
+			Message:  fmt.Sprintf("Unknown Buildkite variable '%s' - it will be empty in the Slack message", name),
+			Source:   "buildkite-ls",
+			Code:     "unknown-buildkite-variable",
+		})
+	}
+
+	return diagnostics
+}
+
+// conditionErrorRange points at where a condition failed to parse, or the whole condition
+// when it spans lines
+func conditionErrorRange(condition *yaml.Node, err error, lines []string) protocol.Range {
+	var syntaxErr *expression.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return conditionOffsetRange(condition, syntaxErr.Offset, 1, lines)
+	}
+	return conditionOffsetRange(condition, -1, 0, lines)
+}
+
+// conditionOffsetRange points at length bytes from an offset into a condition, or the whole
+// condition when it spans lines, the offset is negative or it's at the condition's end
+func conditionOffsetRange(condition *yaml.Node, offset, length int, lines []string) protocol.Range {
+	line := condition.Line - 1
+	start := condition.Column - 1
+	end := 0
+	if line < len(lines) {
+		end = len(lines[line])
+	}
+
+	if offset >= 0 && condition.Style&(yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+		if condition.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0 {
+			start++
+		}
+		// Offsets at the end of the condition highlight all of it
+		if offsetStart := start + offset; offsetStart < end {
+			start, end = offsetStart, min(offsetStart+length, end)
+		}
+	}
+
+	return protocol.Range{
+		Start: protocol.Position{Line: uint32(line), Character: uint32(min(start, end))},
+		End:   protocol.Position{Line: uint32(line), Character: uint32(end)},
+	}
+}
@@ -0,0 +1,226 @@
+package lsp
+
+import (
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+func TestServer_NotifyDiagnostics(t *testing.T) {
+	server := newTestServer()
+
+	content := `notify:
+  - slack:
+      channels:
+        - "#deploys"
+      message: "Build ${BUILDKITE_BUILD_NUMBER} on $BUILDKITE_BRANCH by ${BUILDKITE_BUILD_AUTHR}"
+    if: build.state == "failed"
+  - email: "dev@example.com"
+    if: build.state == "failed" &&
+steps:
+  - command: make
+    notify:
+      - slack:
+          message: |
+            Step finished for ${BUILDKITE_PIPELINE_SLUG}
+            Cost $$BUILDKITE_NOT_INTERPOLATED and ${BUILDKITE_STEPS}
+        if: 'build.branch == "main"'`
+
+	var notify []protocol.Diagnostic
+	for _, diagnostic := range server.Diagnose(content) {
+		if diagnostic.Code == "unknown-buildkite-variable" || diagnostic.Code == "invalid-notify-condition" {
+			notify = append(notify, diagnostic)
+		}
+	}
+
+	expected := []struct {
+		code    string
+		line    uint32
+		char    uint32
+		message string
+	}{
+		{"unknown-buildkite-variable", 4, 74, "'BUILDKITE_BUILD_AUTHR'"},
+		{"invalid-notify-condition", 7, 8, "Invalid notification condition"},
+		{"unknown-buildkite-variable", 14, 52, "'BUILDKITE_STEPS'"},
+	}
+
+	if len(notify) != len(expected) {
+		t.Fatalf("Expected %d diagnostics, got %+v", len(expected), notify)
+	}
+	for i, want := range expected {
+		got := notify[i]
+		if got.Code != want.code || got.Range.Start.Line != want.line || got.Range.Start.Character != want.char {
+			t.Errorf("Diagnostic %d: expected %s at %d:%d, got %s at %d:%d", i, want.code, want.line, want.char,
+				got.Code, got.Range.Start.Line, got.Range.Start.Character)
+		}
+		if !strings.Contains(got.Message, want.message) {
+			t.Errorf("Diagnostic %d: expected message containing %q, got %q", i, want.message, got.Message)
+		}
+	}
+}
+
+func TestCompletionProvider_SlackNotifyKeys(t *testing.T) {
+	provider := newTestCompletionProvider()
+
+	tests := []struct {
+		name     string
+		content  string
+		expected []string
+	}{
+		{
+			name: "pipeline notify",
+			content: `notify:
+  - slack:
+      `,
+			expected: []string{"channels", "message"},
+		},
+		{
+			name: "step notify with channels set",
+			content: `steps:
+  - command: make
+    notify:
+      - slack:
+          channels: ["#deploys"]
+          `,
+			expected: []string{"message"},
+		},
+		{
+			name: "slack plugin config",
+			content: `steps:
+  - plugins:
+      - slack:
+          `,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, ok := provider.getSlackNotifyCompletions(blockStepPositionContext(tt.content))
+			if ok != (tt.expected != nil) {
+				t.Fatalf("Expected completions: %t, got %t", tt.expected != nil, ok)
+			}
+
+			var labels []string
+			for _, item := range items {
+				labels = append(labels, item.Label)
+			}
+			if strings.Join(labels, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Expected %v, got %v", tt.expected, labels)
+			}
+		})
+	}
+}
+
+func TestServer_NotifyServiceDiagnostics(t *testing.T) {
+	server := newTestServer()
+
+	content := `notify:
+  - webhook
+  - webhook: "example.com/hooks"
+    channel: "#deploys"
+  - pagerduty_change_event:
+  - pagerduty_change_event: "https://events.pagerduty.com"
+  - webhook:
+      url: "https://example.com"
+  - webhook: "https://example.com/hooks"
+    if: build.state == "failed"
+  - pagerduty_change_event: "${PAGERDUTY_KEY}"
+steps:
+  - command: make`
+
+	var notify []protocol.Diagnostic
+	for _, diagnostic := range server.Diagnose(content) {
+		switch diagnostic.Code {
+		case "missing-notify-value", "invalid-notify-value", "unknown-notify-key":
+			notify = append(notify, diagnostic)
+		}
+	}
+
+	expected := []struct {
+		code    string
+		line    uint32
+		message string
+	}{
+		{"missing-notify-value", 1, "needs the URL to send build events to"},
+		{"invalid-notify-value", 2, "'example.com/hooks' isn't a URL"},
+		{"unknown-notify-key", 3, "'channel' isn't a key of a webhook notification"},
+		{"missing-notify-value", 4, "needs the integration key"},
+		{"invalid-notify-value", 5, "doesn't look like a PagerDuty integration key"},
+		{"invalid-notify-value", 7, "webhook takes a string"},
+	}
+
+	if len(notify) != len(expected) {
+		t.Fatalf("Expected %d diagnostics, got %+v", len(expected), notify)
+	}
+	for i, want := range expected {
+		got := notify[i]
+		if got.Code != want.code || got.Range.Start.Line != want.line {
+			t.Errorf("Diagnostic %d: expected %s on line %d, got %s on line %d", i, want.code, want.line, got.Code, got.Range.Start.Line)
+		}
+		if !strings.Contains(got.Message, want.message) {
+			t.Errorf("Diagnostic %d: expected message containing %q, got %q", i, want.message, got.Message)
+		}
+	}
+}
+
+func TestCompletionProvider_NotifyEntries(t *testing.T) {
+	provider := newTestCompletionProvider()
+
+	tests := []struct {
+		name     string
+		content  string
+		expected []string
+		insert   map[string]string
+	}{
+		{
+			name:     "pipeline notify item",
+			content:  "notify:\n  - ",
+			expected: pipelineNotifyTypes,
+			insert: map[string]string{
+				"webhook":                "webhook: \"${1:https://example.com/buildkite}\"",
+				"pagerduty_change_event": "pagerduty_change_event: \"${1:integration-key}\"",
+				"github_commit_status":   "github_commit_status:\n  context: \"${1:buildkite/pipeline}\"",
+			},
+		},
+		{
+			name:     "step notify item",
+			content:  "steps:\n  - command: make\n    notify:\n      - git",
+			expected: stepNotifyTypes,
+		},
+		{
+			name:     "condition after a webhook",
+			content:  "notify:\n  - webhook: \"https://example.com\"\n    ",
+			expected: []string{"if"},
+		},
+		{
+			name:     "condition already set",
+			content:  "notify:\n  - pagerduty_change_event: \"key\"\n    if: build.state == \"failed\"\n    ",
+			expected: []string{},
+		},
+		{
+			name:    "plugin list",
+			content: "steps:\n  - plugins:\n      - ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, ok := provider.getNotifyEntryCompletions(blockStepPositionContext(tt.content))
+			if ok != (tt.expected != nil) {
+				t.Fatalf("Expected completions: %t, got %t", tt.expected != nil, ok)
+			}
+
+			labels := []string{}
+			for _, item := range items {
+				labels = append(labels, item.Label)
+				if insert, ok := tt.insert[item.Label]; ok && item.InsertText != insert {
+					t.Errorf("Expected %s to insert %q, got %q", item.Label, insert, item.InsertText)
+				}
+			}
+			if strings.Join(labels, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Expected %v, got %v", tt.expected, labels)
+			}
+		})
+	}
+}
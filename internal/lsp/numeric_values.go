@@ -0,0 +1,162 @@
+package lsp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+
+	bkcontext "github.com/mcncl/buildkite-ls/internal/context"
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+// numericLimits are the values above which a numeric property is probably a mistake
+var numericLimits = map[string]int{
+	"timeout_in_minutes": 24 * 60,
+	"parallelism":        100,
+	"concurrency":        100,
+}
+
+// formatMinutes formats a number of minutes as days, hours and minutes, e.g. 90 -> 1h30m
+func formatMinutes(minutes int) string {
+	if minutes <= 0 {
+		return "0m"
+	}
+
+	var parts strings.Builder
+	if days := minutes / (24 * 60); days > 0 {
+		fmt.Fprintf(&parts, "%dd", days)
+	}
+	if hours := minutes / 60 % 24; hours > 0 {
+		fmt.Fprintf(&parts, "%dh", hours)
+	}
+	if rest := minutes % 60; rest > 0 {
+		fmt.Fprintf(&parts, "%dm", rest)
+	}
+	return parts.String()
+}
+
+// pluralJobs formats a job count
+func pluralJobs(count int) string {
+	if count == 1 {
+		return "1 job"
+	}
+	return fmt.Sprintf("%d jobs", count)
+}
+
+// getNumericValueHoverContent describes what the value of timeout_in_minutes, parallelism or
+// concurrency works out to, when hovering over the value
+func (s *Server) getNumericValueHoverContent(posCtx *bkcontext.PositionContext) string {
+	key := yamlKey(posCtx.CurrentLine)
+	if _, ok := numericLimits[key]; !ok {
+		return ""
+	}
+	colon := strings.Index(posCtx.CurrentLine, ":")
+	if posCtx.CharIndex <= colon {
+		return ""
+	}
+	raw := strings.TrimSpace(posCtx.CurrentLine[colon+1:])
+	if comment := strings.Index(raw, " #"); comment >= 0 {
+		raw = strings.TrimSpace(raw[:comment])
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return ""
+	}
+
+	var content string
+	switch key {
+	case "timeout_in_minutes":
+		content = fmt.Sprintf("**timeout_in_minutes: %d** → %s\n\nThe job is cancelled if it is still running after %s.", value, formatMinutes(value), formatMinutes(value))
+	case "parallelism":
+		content = fmt.Sprintf("**parallelism: %d** → %s\n\nThe step runs as %s at once, each with its own `BUILDKITE_PARALLEL_JOB` index from 0 to %d.",
+			value, pluralJobs(value), pluralJobs(value), value-1)
+	case "concurrency":
+		content = fmt.Sprintf("**concurrency: %d** → at most %s at a time", value, pluralJobs(value))
+		if group := s.concurrencyGroupAt(posCtx); group != "" {
+			content += fmt.Sprintf("\n\nAcross every build, no more than %s in the `%s` concurrency group run at once; the rest wait for a free slot.", pluralJobs(value), group)
+		} else {
+			content += "\n\n⚠️ `concurrency` only takes effect together with `concurrency_group`."
+		}
+	}
+
+	if warning := numericValueWarning(key, value); warning != "" {
+		content += "\n\n⚠️ " + warning
+	}
+	return content
+}
+
+// concurrencyGroupAt returns the concurrency_group of the step at the hover position
+func (s *Server) concurrencyGroupAt(posCtx *bkcontext.PositionContext) string {
+	_, step := stepEditOf(splitLines(posCtx.FullContent), int(posCtx.Position.Line))
+	return stringNodeValue(mappingValue(step, "concurrency_group"))
+}
+
+// numericValueWarning explains why a value is suspiciously large, or returns "" when it isn't
+func numericValueWarning(key string, value int) string {
+	limit, ok := numericLimits[key]
+	if !ok || value <= limit {
+		return ""
+	}
+
+	switch key {
+	case "timeout_in_minutes":
+		warning := fmt.Sprintf("A timeout of %s is unusually long.", formatMinutes(value))
+		if value%60 == 0 {
+			warning += fmt.Sprintf(" timeout_in_minutes is in minutes; if %d was meant as seconds, use %d.", value, value/60)
+		}
+		return warning
+	case "parallelism":
+		return fmt.Sprintf("Running %s for one step is unusually many, and each needs an agent.", pluralJobs(value))
+	default:
+		return fmt.Sprintf("A concurrency limit of %d is unusually high, so it is unlikely to limit anything.", value)
+	}
+}
+
+// validateNumericValues warns about timeouts, parallelism and concurrency limits that are
+// suspiciously large
+func (s *Server) validateNumericValues(pipeline *parser.Pipeline) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	root := pipeline.YAMLNode
+	if root == nil || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return diagnostics
+	}
+
+	check := func(mapping *yaml.Node) {
+		for _, key := range []string{"timeout_in_minutes", "parallelism", "concurrency"} {
+			entry := mappingKey(mapping, key)
+			if entry == nil || entry.value.Tag != "!!int" {
+				continue
+			}
+			value, err := strconv.Atoi(entry.value.Value)
+			if err != nil {
+				continue
+			}
+			if warning := numericValueWarning(key, value); warning != "" {
+				diagnostics = append(diagnostics, nodeDiagnostic(entry.value, protocol.DiagnosticSeverityWarning, "large-value", warning))
+			}
+		}
+	}
+
+	var walkSteps func(steps *yaml.Node)
+	walkSteps = func(steps *yaml.Node) {
+		if steps == nil || steps.Kind != yaml.SequenceNode {
+			return
+		}
+		for _, step := range steps.Content {
+			if step.Kind != yaml.MappingNode {
+				continue
+			}
+			check(step)
+			walkSteps(mappingValue(step, "steps"))
+		}
+	}
+
+	check(root.Content[0])
+	walkSteps(mappingValue(root.Content[0], "steps"))
+
+	return diagnostics
+}
@@ -0,0 +1,131 @@
+package lsp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+func TestFormatMinutes(t *testing.T) {
+	tests := map[int]string{
+		0:    "0m",
+		45:   "45m",
+		60:   "1h",
+		90:   "1h30m",
+		1440: "1d",
+		3600: "2d12h",
+	}
+	for minutes, expected := range tests {
+		if got := formatMinutes(minutes); got != expected {
+			t.Errorf("formatMinutes(%d) = %q, expected %q", minutes, got, expected)
+		}
+	}
+}
+
+func TestServer_NumericValueHover(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+
+	content := `steps:
+  - command: make test
+    timeout_in_minutes: 90
+    parallelism: 20 # shards
+  - command: deploy
+    concurrency: 1
+    concurrency_group: production/deploy
+  - command: make
+    concurrency: 2
+    timeout_in_minutes: 3600`
+	server.documentManager.OpenDocument(uri, 1, content)
+
+	tests := []struct {
+		name     string
+		line     uint32
+		char     uint32
+		expected []string
+	}{
+		{"timeout", 2, 25, []string{"**timeout_in_minutes: 90** → 1h30m"}},
+		{"parallelism", 3, 18, []string{"→ 20 jobs", "from 0 to 19"}},
+		{"concurrency with a group", 5, 18, []string{"at most 1 job at a time", "`production/deploy`"}},
+		{"concurrency without a group", 8, 18, []string{"only takes effect together with `concurrency_group`"}},
+		{"large timeout", 9, 25, []string{"2d12h", "if 3600 was meant as seconds, use 60"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hover, err := server.Hover(context.Background(), &protocol.HoverParams{
+				TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+					TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+					Position:     protocol.Position{Line: tt.line, Character: tt.char},
+				},
+			})
+			if err != nil || hover == nil {
+				t.Fatalf("Expected hover content, got %v (%v)", hover, err)
+			}
+			for _, expected := range tt.expected {
+				if !strings.Contains(hover.Contents.Value, expected) {
+					t.Errorf("Expected hover to contain %q, got:\n%s", expected, hover.Contents.Value)
+				}
+			}
+		})
+	}
+
+	// The key itself keeps its property docs
+	hover, err := server.Hover(context.Background(), &protocol.HoverParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 2, Character: 8},
+		},
+	})
+	if err != nil || hover == nil || !strings.Contains(hover.Contents.Value, "**timeout_in_minutes** - Job timeout") {
+		t.Errorf("Expected the property docs on the key, got %v (%v)", hover, err)
+	}
+}
+
+func TestServer_ValidateNumericValues(t *testing.T) {
+	server := newTestServer()
+
+	content := `steps:
+  - command: make
+    timeout_in_minutes: 3600
+  - group: Tests
+    steps:
+      - command: make test
+        parallelism: 500
+        concurrency: 1000
+        concurrency_group: tests
+  - command: make lint
+    timeout_in_minutes: 60
+    parallelism: 10`
+
+	var diagnostics []protocol.Diagnostic
+	for _, diagnostic := range server.Diagnose(content) {
+		if diagnostic.Code == "large-value" {
+			diagnostics = append(diagnostics, diagnostic)
+		}
+	}
+
+	expected := []struct {
+		line    uint32
+		char    uint32
+		message string
+	}{
+		{2, 24, "if 3600 was meant as seconds, use 60"},
+		{6, 21, "500 jobs"},
+		{7, 21, "concurrency limit of 1000"},
+	}
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("Expected %d diagnostics, got %+v", len(expected), diagnostics)
+	}
+	for i, want := range expected {
+		got := diagnostics[i]
+		if got.Range.Start.Line != want.line || got.Range.Start.Character != want.char || got.Severity != protocol.DiagnosticSeverityWarning {
+			t.Errorf("Diagnostic %d: expected a warning at %d:%d, got %+v", i, want.line, want.char, got)
+		}
+		if !strings.Contains(got.Message, want.message) {
+			t.Errorf("Diagnostic %d: expected message containing %q, got %q", i, want.message, got.Message)
+		}
+	}
+}
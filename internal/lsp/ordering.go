@@ -0,0 +1,251 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.lsp.dev/protocol"
+
+	bkcontext "github.com/mcncl/buildkite-ls/internal/context"
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+// stepDependency is a single entry of a step's depends_on
+type stepDependency struct {
+	Key          string
+	AllowFailure bool
+}
+
+// stepDependencies reads depends_on in any of its forms: a key, a list of keys, or a list
+// of {step, allow_failure} entries
+func stepDependencies(stepData map[string]interface{}) []stepDependency {
+	switch v := stepData["depends_on"].(type) {
+	case string:
+		return []stepDependency{{Key: v}}
+	case []interface{}:
+		var dependencies []stepDependency
+		for _, entry := range v {
+			switch e := entry.(type) {
+			case string:
+				dependencies = append(dependencies, stepDependency{Key: e})
+			case map[string]interface{}:
+				key, _ := e["step"].(string)
+				allowFailure, _ := e["allow_failure"].(bool)
+				if key != "" {
+					dependencies = append(dependencies, stepDependency{Key: key, AllowFailure: allowFailure})
+				}
+			}
+		}
+		return dependencies
+	}
+	return nil
+}
+
+// stepKeys returns the keys defined by a step, including the steps nested in a group
+func stepKeys(step interface{}) []string {
+	stepData, ok := step.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	var keys []string
+	for _, field := range []string{"key", "id", "identifier"} {
+		if key, ok := stepData[field].(string); ok && key != "" {
+			keys = append(keys, key)
+		}
+	}
+	if nested, ok := stepData["steps"].([]interface{}); ok {
+		for _, nestedStep := range nested {
+			keys = append(keys, stepKeys(nestedStep)...)
+		}
+	}
+	return keys
+}
+
+// stepDataKey returns the key a step can be depended on by, whichever of key, id and
+// identifier sets it. Unquoted numbers are read as the key they spell.
+func stepDataKey(stepData map[string]interface{}) string {
+	for _, field := range []string{"key", "id", "identifier"} {
+		switch key := stepData[field].(type) {
+		case string:
+			if key != "" {
+				return key
+			}
+		case int, float64:
+			return fmt.Sprint(key)
+		}
+	}
+	return ""
+}
+
+// continuesOnFailure reports whether a wait step lets later steps run after earlier ones fail
+func continuesOnFailure(step interface{}) bool {
+	stepData, ok := step.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	continueOnFailure, _ := stepData["continue_on_failure"].(bool)
+	return continueOnFailure
+}
+
+// validateWaitDependencies hints at depends_on entries naming steps that a wait step between
+// them already orders before the dependent step
+func (s *Server) validateWaitDependencies(pipelineData map[string]interface{}, lines []string) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	steps, ok := pipelineData["steps"].([]interface{})
+	if !ok {
+		return diagnostics
+	}
+	stepLines := s.findStepLines(lines)
+
+	// Keys of the steps that finish before a blocking wait, mapped to that wait's index
+	waitedFor := make(map[string]int)
+	var pending []string
+
+	for stepIndex, stepItem := range steps {
+		if stepIndex >= len(stepLines) {
+			break
+		}
+
+		if isWaitStep(stepItem) {
+			// A wait that continues on failure lets later steps run even when earlier ones
+			// failed, which an explicit dependency wouldn't
+			if !continuesOnFailure(stepItem) {
+				for _, key := range pending {
+					waitedFor[key] = stepIndex
+				}
+				pending = nil
+			}
+			continue
+		}
+
+		pending = append(pending, stepKeys(stepItem)...)
+
+		stepData, ok := stepItem.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		lineNum := stepLines[stepIndex]
+		for _, dependency := range stepDependencies(stepData) {
+			waitIndex, waited := waitedFor[dependency.Key]
+			if !waited || dependency.AllowFailure {
+				continue
+			}
+
+			depLine := s.findDependencyLine(lines, lineNum, dependency.Key)
+			start := strings.Index(lines[depLine], dependency.Key)
+			end := start + len(dependency.Key)
+			if start < 0 {
+				start, end = 0, len(lines[depLine])
+			}
+
+			diagnostics = append(diagnostics, protocol.Diagnostic{
+				Range: protocol.Range{
+					Start: protocol.Position{Line: uint32(depLine), Character: uint32(start)},
+					End:   protocol.Position{Line: uint32(depLine), Character: uint32(end)},
+				},
+				Severity: protocol.DiagnosticSeverityHint,
+				Message: fmt.Sprintf("Step %d already runs after '%s' because of the wait step on line %d; the depends_on entry is redundant",
+					stepIndex+1, dependency.Key, stepLines[waitIndex]+1),
+				Source: "buildkite-ls",
+				Code:   "redundant-depends-on",
+				Tags:   []protocol.DiagnosticTag{protocol.DiagnosticTagUnnecessary},
+			})
+		}
+	}
+
+	return diagnostics
+}
+
+// findDependencyLine returns the line of the step's depends_on that names the key
+func (s *Server) findDependencyLine(lines []string, stepLine int, key string) int {
+	dependsLine := s.findStepPropertyLine("depends_on", lines, stepLine)
+	if strings.Contains(lines[dependsLine], key) {
+		return dependsLine
+	}
+
+	// List entries are indented past depends_on, or level with it when they start with "- "
+	indent := s.getIndentLevel(lines[dependsLine])
+	for i := dependsLine + 1; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" {
+			continue
+		}
+		lineIndent := s.getIndentLevel(lines[i])
+		if lineIndent < indent || (lineIndent == indent && !strings.HasPrefix(trimmed, "- ")) {
+			break
+		}
+		if strings.Contains(lines[i], key) {
+			return i
+		}
+	}
+	return dependsLine
+}
+
+// isWaitLine reports whether the line is a wait step, in either its string or map form
+func isWaitLine(line string) bool {
+	trimmed := strings.TrimPrefix(strings.TrimSpace(line), "- ")
+	return yamlKey(line) == "wait" || strings.Trim(trimmed, `"'`) == "wait"
+}
+
+// getWaitHoverContent explains which steps the wait under the cursor orders, and how the same
+// ordering is written with depends_on
+func (s *Server) getWaitHoverContent(posCtx *bkcontext.PositionContext) string {
+	var content strings.Builder
+	content.WriteString("**Implicit dependencies**\n\n")
+	content.WriteString("Every step after a wait implicitly depends on every step before it, and only runs once they've all passed ")
+	content.WriteString("(or finished, with `continue_on_failure: true`). ")
+	content.WriteString("Explicit `depends_on` dependencies let unrelated steps run in parallel instead of waiting for everything before them.")
+
+	lines := splitLines(posCtx.FullContent)
+	waitIndex := slices.Index(s.findStepLines(lines), int(posCtx.Position.Line))
+	if waitIndex <= 0 {
+		return content.String()
+	}
+
+	pipeline, err := parser.ParseYAML([]byte(posCtx.FullContent))
+	if err != nil {
+		return content.String()
+	}
+	var pipelineData map[string]interface{}
+	if err := json.Unmarshal(pipeline.JSONBytes, &pipelineData); err != nil {
+		return content.String()
+	}
+	steps, _ := pipelineData["steps"].([]interface{})
+	if waitIndex >= len(steps) || !isWaitStep(steps[waitIndex]) {
+		return content.String()
+	}
+
+	// The wait orders the steps back to the previous wait; earlier ones are ordered by that wait
+	first := waitIndex
+	var keys []string
+	for first > 0 && !isWaitStep(steps[first-1]) {
+		first--
+	}
+	if first == waitIndex {
+		return content.String()
+	}
+	for _, step := range steps[first:waitIndex] {
+		keys = append(keys, stepKeys(step)...)
+	}
+
+	if first+1 == waitIndex {
+		fmt.Fprintf(&content, "\n\nThe steps after this wait run once step %d has finished.", waitIndex)
+	} else {
+		fmt.Fprintf(&content, "\n\nThe steps after this wait run once steps %d to %d have finished.", first+1, waitIndex)
+	}
+	if len(keys) > 0 {
+		content.WriteString(" To depend on them explicitly instead, remove the wait and add to the steps after it:\n")
+		content.WriteString("```yaml\ndepends_on:\n")
+		for _, key := range keys {
+			fmt.Fprintf(&content, "  - %q\n", key)
+		}
+		content.WriteString("```")
+	}
+
+	return content.String()
+}
@@ -0,0 +1,140 @@
+package lsp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+func TestServer_RedundantDependsOn(t *testing.T) {
+	server := newTestServer()
+
+	tests := []struct {
+		name     string
+		content  string
+		expected []string
+		lines    []uint32
+	}{
+		{
+			name: "dependency on a step before a wait",
+			content: `steps:
+  - command: make build
+    key: build
+  - wait
+  - command: make test
+    depends_on: build`,
+			expected: []string{"Step 3 already runs after 'build' because of the wait step on line 4"},
+			lines:    []uint32{5},
+		},
+		{
+			name: "list entries and groups",
+			content: `steps:
+  - group: Build
+    key: build
+    steps:
+      - command: make
+        key: compile
+  - command: make lint
+    key: lint
+  - wait: ~
+  - command: make test
+    depends_on:
+      - lint
+      - step: compile
+      - other`,
+			expected: []string{"'lint'", "'compile'"},
+			lines:    []uint32{11, 12},
+		},
+		{
+			name: "dependency within the same phase",
+			content: `steps:
+  - wait
+  - command: make build
+    key: build
+  - command: make test
+    depends_on: build`,
+		},
+		{
+			name: "wait that continues on failure",
+			content: `steps:
+  - command: make build
+    key: build
+  - wait: ~
+    continue_on_failure: true
+  - command: make test
+    depends_on: build`,
+		},
+		{
+			name: "dependency that allows failure",
+			content: `steps:
+  - command: make build
+    key: build
+  - wait
+  - command: make test
+    depends_on:
+      - step: build
+        allow_failure: true`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var redundant []protocol.Diagnostic
+			for _, diagnostic := range server.Diagnose(tt.content) {
+				if diagnostic.Code == "redundant-depends-on" {
+					redundant = append(redundant, diagnostic)
+				}
+			}
+
+			if len(redundant) != len(tt.expected) {
+				t.Fatalf("Expected %d redundant dependencies, got %+v", len(tt.expected), redundant)
+			}
+			for i, diagnostic := range redundant {
+				if !strings.Contains(diagnostic.Message, tt.expected[i]) {
+					t.Errorf("Expected message containing %q, got %q", tt.expected[i], diagnostic.Message)
+				}
+				if diagnostic.Range.Start.Line != tt.lines[i] {
+					t.Errorf("Expected diagnostic on line %d, got %d", tt.lines[i], diagnostic.Range.Start.Line)
+				}
+				if diagnostic.Severity != protocol.DiagnosticSeverityHint {
+					t.Errorf("Expected a hint, got severity %v", diagnostic.Severity)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_WaitHover(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	server.documentManager.OpenDocument(uri, 1, `steps:
+  - command: make build
+    key: build
+  - command: make lint
+    key: lint
+  - wait
+  - command: make test`)
+
+	hover, err := server.Hover(context.Background(), &protocol.HoverParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 5, Character: 5},
+		},
+	})
+	if err != nil || hover == nil {
+		t.Fatalf("Expected hover content, got %v (%v)", hover, err)
+	}
+
+	for _, expected := range []string{
+		"**wait**",
+		"Implicit dependencies",
+		"run once steps 1 to 2 have finished",
+		"depends_on:\n  - \"build\"\n  - \"lint\"",
+	} {
+		if !strings.Contains(hover.Contents.Value, expected) {
+			t.Errorf("Expected hover to contain %q, got:\n%s", expected, hover.Contents.Value)
+		}
+	}
+}
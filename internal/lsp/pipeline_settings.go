@@ -0,0 +1,70 @@
+package lsp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.lsp.dev/protocol"
+)
+
+// topLevelKeys are the keys a pipeline's YAML can set at the top level
+var topLevelKeys = map[string]bool{
+	"steps":              true,
+	"env":                true,
+	"agents":             true,
+	"notify":             true,
+	"timeout_in_minutes": true,
+}
+
+// pipelineSettingKeys are options that live in the pipeline's settings on Buildkite rather
+// than in its YAML, mapped to where they're configured. The schema allows unknown top-level
+// keys, so without this they are silently ignored.
+var pipelineSettingKeys = map[string]string{
+	"cancel_running_branch_builds":           "enable \"Cancel Running Intermediate Builds\" under the pipeline's Builds settings",
+	"cancel_running_branch_builds_filter":    "set the branch filter for \"Cancel Running Intermediate Builds\" under the pipeline's Builds settings",
+	"skip_intermediate_builds":               "enable \"Skip Intermediate Builds\" under the pipeline's Builds settings",
+	"skip_intermediate_builds_branch_filter": "set the branch filter for \"Skip Intermediate Builds\" under the pipeline's Builds settings",
+	"default_branch":                         "set the default branch under the pipeline's General settings",
+	"branch_configuration":                   "set the branch filter under the pipeline's General settings",
+	"provider_settings":                      "configure it under the pipeline's repository provider (e.g. GitHub) settings",
+	"repository_provider_settings":           "configure it under the pipeline's repository provider (e.g. GitHub) settings",
+}
+
+// validatePipelineSettingKeys flags top-level keys that are pipeline settings, which have
+// no effect when written in the YAML
+func (s *Server) validatePipelineSettingKeys(pipelineData map[string]interface{}, lines []string) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	// Report in document order rather than map order
+	var keys []string
+	for key := range pipelineData {
+		if _, isSetting := pipelineSettingKeys[key]; isSetting {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return s.findTopLevelProperty(keys[i], lines) < s.findTopLevelProperty(keys[j], lines)
+	})
+
+	for _, key := range keys {
+		lineNum := s.findTopLevelProperty(key, lines)
+		if lineNum < 0 || lineNum >= len(lines) || !strings.HasPrefix(lines[lineNum], key+":") {
+			continue
+		}
+
+		diagnostics = append(diagnostics, protocol.Diagnostic{
+			Range: protocol.Range{
+				Start: protocol.Position{Line: uint32(lineNum), Character: 0},
+				End:   protocol.Position{Line: uint32(lineNum), Character: uint32(len(key))},
+			},
+			Severity: protocol.DiagnosticSeverityWarning,
+			Message: fmt.Sprintf("'%s' is a pipeline setting, not a pipeline YAML key, and has no effect here; %s",
+				key, pipelineSettingKeys[key]),
+			Source: "buildkite-ls",
+			Code:   "pipeline-setting-key",
+		})
+	}
+
+	return diagnostics
+}
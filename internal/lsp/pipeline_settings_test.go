@@ -0,0 +1,64 @@
+package lsp
+
+import (
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+func TestServer_PipelineSettingKeys(t *testing.T) {
+	server := newTestServer()
+
+	diagnostics := server.Diagnose(`skip_intermediate_builds: true
+env:
+  FOO: bar
+cancel_running_branch_builds: true
+steps:
+  - command: "make"`)
+
+	var settings []protocol.Diagnostic
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Code == "pipeline-setting-key" {
+			settings = append(settings, diagnostic)
+		}
+	}
+
+	expected := []struct {
+		line uint32
+		key  string
+	}{
+		{line: 0, key: "skip_intermediate_builds"},
+		{line: 3, key: "cancel_running_branch_builds"},
+	}
+
+	if len(settings) != len(expected) {
+		t.Fatalf("Expected %d diagnostics, got %d: %+v", len(expected), len(settings), diagnostics)
+	}
+
+	for i, want := range expected {
+		diagnostic := settings[i]
+		if diagnostic.Range.Start.Line != want.line || diagnostic.Range.End.Character != uint32(len(want.key)) {
+			t.Errorf("Diagnostic %d: expected %s highlighted on line %d, got %+v", i, want.key, want.line, diagnostic.Range)
+		}
+		if !strings.Contains(diagnostic.Message, want.key) || !strings.Contains(diagnostic.Message, "pipeline's Builds settings") {
+			t.Errorf("Diagnostic %d: expected an explanation for %s, got %q", i, want.key, diagnostic.Message)
+		}
+		if diagnostic.Severity != protocol.DiagnosticSeverityWarning {
+			t.Errorf("Diagnostic %d: expected warning severity, got %v", i, diagnostic.Severity)
+		}
+	}
+}
+
+func TestCompletionProvider_TopLevelKeysAreAllowlisted(t *testing.T) {
+	provider := newTestCompletionProvider()
+
+	for _, completion := range provider.getTopLevelCompletions() {
+		if !topLevelKeys[completion.Label] {
+			t.Errorf("Completion offers '%s', which isn't a top-level pipeline key", completion.Label)
+		}
+		if _, isSetting := pipelineSettingKeys[completion.Label]; isSetting {
+			t.Errorf("Completion offers the pipeline setting '%s'", completion.Label)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.lsp.dev/protocol"
+)
+
+// getRequiredConfigActions offers to scaffold the required configuration keys the schema of
+// the plugin under the cursor lists but its config doesn't set yet
+func (s *Server) getRequiredConfigActions(ctx context.Context, params *protocol.CodeActionParams, doc *Document) []protocol.CodeAction {
+	lines := doc.Lines
+	cursor := int(params.Range.Start.Line)
+
+	for _, usage := range findPluginReferences(params.TextDocument.URI, lines) {
+		refLine := int(usage.Location.Range.Start.Line)
+		if cursor < refLine {
+			continue
+		}
+
+		lastLine := pluginBlockEnd(lines, refLine)
+		if cursor > lastLine {
+			continue
+		}
+
+		action := s.createRequiredConfigAction(ctx, params.TextDocument.URI, lines, usage, lastLine)
+		if action == nil {
+			return nil
+		}
+		return []protocol.CodeAction{*action}
+	}
+
+	return nil
+}
+
+// createRequiredConfigAction builds the edit inserting the plugin's missing required keys
+// after the last line of its config block
+func (s *Server) createRequiredConfigAction(ctx context.Context, uri protocol.DocumentURI, lines []string, usage PluginUsage, lastLine int) *protocol.CodeAction {
+	refLine := int(usage.Location.Range.Start.Line)
+	line := lines[refLine]
+
+	// Only plain `- plugin#version:` items can grow a nested config; inline configs are left alone
+	rest := strings.TrimLeft(line[usage.Location.Range.End.Character:], `"'`)
+	hasColon := strings.HasPrefix(rest, ":")
+	if hasColon && strings.TrimSpace(rest[1:]) != "" {
+		return nil
+	}
+
+	ref := usage.Plugin
+	if usage.Version != "" {
+		ref += "#" + usage.Version
+	}
+
+	schema, err := s.pluginRegistry.GetPluginSchema(ctx, ref)
+	if err != nil {
+		return nil
+	}
+
+	required := schema.RequiredProperties()
+	if len(required) == 0 {
+		return nil
+	}
+
+	// Config keys sit two columns past the plugin name, unless the block already says otherwise
+	configIndent := strings.Index(line, "- ") + 4
+	existing := make(map[string]bool)
+	for i := refLine + 1; i <= lastLine; i++ {
+		if strings.TrimSpace(lines[i]) == "" {
+			continue
+		}
+		if i == refLine+1 || s.getIndentLevel(lines[i]) < configIndent {
+			configIndent = s.getIndentLevel(lines[i])
+		}
+		if s.getIndentLevel(lines[i]) == configIndent {
+			existing[yamlKey(lines[i])] = true
+		}
+	}
+
+	properties, _ := schema.Configuration["properties"].(map[string]interface{})
+	indent := strings.Repeat(" ", configIndent)
+
+	var newText strings.Builder
+	if !hasColon {
+		newText.WriteString(":")
+	}
+	for _, name := range required {
+		if existing[name] {
+			continue
+		}
+		propDef, _ := properties[name].(map[string]interface{})
+		fmt.Fprintf(&newText, "\n%s%s: %s", indent, name, placeholderValue(propDef))
+	}
+	if newText.Len() <= 1 {
+		return nil
+	}
+
+	end := protocol.Position{Line: uint32(lastLine), Character: uint32(len(lines[lastLine]))}
+	return &protocol.CodeAction{
+		Title: fmt.Sprintf("Add required configuration for %s", usage.Plugin),
+		Kind:  protocol.QuickFix,
+		Edit: &protocol.WorkspaceEdit{
+			Changes: map[protocol.DocumentURI][]protocol.TextEdit{
+				uri: {{Range: protocol.Range{Start: end, End: end}, NewText: newText.String()}},
+			},
+		},
+	}
+}
+
+// pluginBlockEnd returns the last non-blank line belonging to the plugins list item on refLine
+func pluginBlockEnd(lines []string, refLine int) int {
+	itemIndent := strings.Index(lines[refLine], "- ")
+
+	last := refLine
+	for i := refLine + 1; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if len(lines[i])-len(strings.TrimLeft(lines[i], " ")) <= itemIndent {
+			break
+		}
+		last = i
+	}
+	return last
+}
+
+// placeholderValue picks a value for a scaffolded key: the schema's default or first allowed
+// value, else an empty value of the property's type
+func placeholderValue(propDef map[string]interface{}) string {
+	if enumVal, ok := propDef["enum"].([]interface{}); ok && len(enumVal) > 0 {
+		return yamlScalar(enumVal[0])
+	}
+	if defaultVal, ok := propDef["default"]; ok {
+		return yamlScalar(defaultVal)
+	}
+
+	switch propDef["type"] {
+	case "boolean":
+		return "false"
+	case "integer", "number":
+		return "0"
+	case "array":
+		return "[]"
+	case "object":
+		return "{}"
+	default:
+		return `""`
+	}
+}
+
+// yamlScalar formats a schema value as a YAML scalar
+func yamlScalar(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return fmt.Sprintf("%q", v)
+	case nil:
+		return `""`
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,182 @@
+package lsp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+
+	"github.com/mcncl/buildkite-ls/internal/plugins"
+)
+
+var deployPluginSchema = &plugins.PluginSchema{
+	Name: "Deploy",
+	Configuration: map[string]any{
+		"properties": map[string]interface{}{
+			"environment": map[string]interface{}{"type": "string", "enum": []interface{}{"staging", "production"}},
+			"region":      map[string]interface{}{"type": "string", "default": "us-east-1"},
+			"replicas":    map[string]interface{}{"type": "integer"},
+			"dry-run":     map[string]interface{}{"type": "boolean"},
+		},
+		"required": []interface{}{"environment", "region", "replicas"},
+	},
+}
+
+func TestServer_RequiredConfigAction(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		line     uint32
+		expected string
+		at       protocol.Position
+	}{
+		{
+			name: "partial config",
+			content: `steps:
+  - command: "make deploy"
+    plugins:
+      - my-org/deploy#v1.0.0:
+          region: "eu-west-1"
+          dry-run: true
+  - command: "make test"`,
+			line:     4,
+			expected: "\n          environment: \"staging\"\n          replicas: 0",
+			at:       protocol.Position{Line: 5, Character: 23},
+		},
+		{
+			name: "reference without config",
+			content: `steps:
+  - command: "make deploy"
+    plugins:
+      - "my-org/deploy#v1.0.0"`,
+			line:     3,
+			expected: ":\n          environment: \"staging\"\n          region: \"us-east-1\"\n          replicas: 0",
+			at:       protocol.Position{Line: 3, Character: 30},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer()
+			server.pluginRegistry.CacheSchema("my-org/deploy#v1.0.0", deployPluginSchema)
+
+			uri := protocol.DocumentURI("file:///.buildkite/pipeline.yml")
+			server.documentManager.OpenDocument(uri, 1, tt.content)
+
+			actions, err := server.CodeAction(context.Background(), &protocol.CodeActionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+				Range:        protocol.Range{Start: protocol.Position{Line: tt.line}, End: protocol.Position{Line: tt.line}},
+			})
+			if err != nil {
+				t.Fatalf("CodeAction failed: %v", err)
+			}
+
+			var action *protocol.CodeAction
+			for i := range actions {
+				if actions[i].Title == "Add required configuration for my-org/deploy" {
+					action = &actions[i]
+				}
+			}
+			if action == nil {
+				t.Fatalf("Expected a required configuration action, got %+v", actions)
+			}
+
+			edits := action.Edit.Changes[uri]
+			if len(edits) != 1 {
+				t.Fatalf("Expected 1 edit, got %d", len(edits))
+			}
+			if edits[0].NewText != tt.expected {
+				t.Errorf("Unexpected edit text:\nexpected: %q\ngot:      %q", tt.expected, edits[0].NewText)
+			}
+			if edits[0].Range.Start != tt.at {
+				t.Errorf("Expected the edit at %+v, got %+v", tt.at, edits[0].Range.Start)
+			}
+		})
+	}
+
+	t.Run("complete config", func(t *testing.T) {
+		server := newTestServer()
+		server.pluginRegistry.CacheSchema("my-org/deploy#v1.0.0", deployPluginSchema)
+
+		lines := splitLines(`steps:
+  - plugins:
+      - my-org/deploy#v1.0.0:
+          environment: "production"
+          region: "us-east-1"
+          replicas: 3`)
+		actions := server.getRequiredConfigActions(context.Background(), &protocol.CodeActionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: "file:///.buildkite/pipeline.yml"},
+			Range:        protocol.Range{Start: protocol.Position{Line: 2}},
+		}, &Document{Lines: lines})
+		if len(actions) != 0 {
+			t.Errorf("Expected no action when every required key is set, got %+v", actions)
+		}
+	})
+}
+
+func TestCompletionProvider_RequiredConfigKeysFirst(t *testing.T) {
+	provider := newTestCompletionProvider()
+
+	completions := provider.generateCompletionsFromSchema(deployPluginSchema, "my-org/deploy", 10)
+	if len(completions) != 4 {
+		t.Fatalf("Expected 4 completions, got %d", len(completions))
+	}
+
+	for _, completion := range completions {
+		required := completion.Label != "dry-run"
+		if required && completion.SortText != "0-"+completion.Label {
+			t.Errorf("Expected required key %s to sort first, got %q", completion.Label, completion.SortText)
+		}
+		if !required && completion.SortText != "1-dry-run" {
+			t.Errorf("Expected optional key to sort after required ones, got %q", completion.SortText)
+		}
+	}
+}
+
+func TestCompletionProvider_RequirementGroupCompletions(t *testing.T) {
+	provider := newTestCompletionProvider()
+
+	schema := &plugins.PluginSchema{
+		Configuration: map[string]any{
+			"properties": map[string]interface{}{
+				"image":  map[string]interface{}{"type": "string"},
+				"build":  map[string]interface{}{"type": "string"},
+				"push":   map[string]interface{}{"type": "boolean"},
+				"shell":  map[string]interface{}{"type": "array"},
+				"region": map[string]interface{}{"type": "string"},
+			},
+			"required": []interface{}{"region"},
+			"oneOf": []interface{}{
+				map[string]interface{}{"required": []interface{}{"image"}},
+				map[string]interface{}{"required": []interface{}{"build", "push"}},
+			},
+		},
+	}
+
+	completions := provider.generateCompletionsFromSchema(schema, "my-org/images", 10)
+
+	labels := make([]string, 0, len(completions))
+	for _, completion := range completions {
+		labels = append(labels, completion.Label)
+	}
+	expected := []string{"build", "image", "push", "region", "build + push", "shell"}
+	if strings.Join(labels, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Expected completions %v, got %v", expected, labels)
+	}
+
+	if !strings.HasPrefix(completions[0].Detail, "(required: one of image, build + push)") {
+		t.Errorf("Expected alternative key to describe its group, got %q", completions[0].Detail)
+	}
+	if completions[3].Detail != "(required)" {
+		t.Errorf("Expected required key to be marked, got %q", completions[3].Detail)
+	}
+
+	group := completions[4]
+	if group.Kind != protocol.CompletionItemKindSnippet {
+		t.Errorf("Expected group completion to be a snippet, got %v", group.Kind)
+	}
+	if group.InsertText != "build: \"${1}\"\npush: ${2|true,false|}" {
+		t.Errorf("Unexpected group snippet %q", group.InsertText)
+	}
+}
@@ -0,0 +1,223 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+
+	bkcontext "github.com/mcncl/buildkite-ls/internal/context"
+	"github.com/mcncl/buildkite-ls/internal/parser"
+	"github.com/mcncl/buildkite-ls/internal/plugins"
+)
+
+// pluginPathOptions are the options of popular plugins that take paths in the checkout, by
+// plugin name, for plugins whose schema doesn't make it clear
+var pluginPathOptions = map[string][]string{
+	"docker-compose": {"config", "env-file"},
+	"shellcheck":     {"files"},
+	"cache":          {"path", "manifest"},
+	"test-collector": {"files"},
+}
+
+// pathWords mark a schema option as taking a path, in its name or description
+var pathWords = []string{"file", "path", "dir", "dockerfile"}
+
+// maxPathCompletions bounds the entries offered from one directory
+const maxPathCompletions = 200
+
+// pluginPathValue is a value of a plugin option taking paths
+type pluginPathValue struct {
+	// plugin is the plugin reference and option the option's name
+	plugin, option string
+	// value is the scalar, or nil for a value not written yet
+	value *yaml.Node
+}
+
+// pluginPathValueAt returns the value of a plugin option taking paths at the position: the
+// option's own value, or an entry of its list
+func (s *Server) pluginPathValueAt(ctx context.Context, content string, position protocol.Position) (pluginPathValue, bool) {
+	path, ok := nodePathAt(content, position)
+	if !ok || path.OnKey || pathStepProperty(path) != "plugins" {
+		return pluginPathValue{}, false
+	}
+
+	// The step's plugins list, its item, the plugin's options and the option's value, and
+	// for lists the entry
+	nodes := path.Nodes[pathStepIndex(path)+1:]
+	if len(nodes) < 4 || len(nodes) > 5 || nodes[2].Key == nil || nodes[3].Key == nil {
+		return pluginPathValue{}, false
+	}
+	value := nodes[len(nodes)-1].Node
+	if value.Kind != yaml.ScalarNode || (len(nodes) == 5 && nodes[3].Node.Kind != yaml.SequenceNode) {
+		return pluginPathValue{}, false
+	}
+
+	found := pluginPathValue{plugin: nodes[2].Key.Value, option: nodes[3].Key.Value}
+	if !isImplicitNull(value) {
+		found.value = value
+	}
+	return found, s.takesPaths(ctx, found.plugin, found.option)
+}
+
+// takesPaths reports whether a plugin's option takes paths in the checkout: it's one of the
+// curated pluginPathOptions, or the plugin's schema describes a string or list of strings
+// named or described as a file, path or directory, and not one in the container
+func (s *Server) takesPaths(ctx context.Context, plugin, option string) bool {
+	if parsed := plugins.ParsePluginReference(s.pluginRegistry.ResolveAlias(plugin)); parsed != nil && slices.Contains(pluginPathOptions[parsed.Name], option) {
+		return true
+	}
+
+	schema, err := s.pluginRegistry.GetPluginSchema(ctx, plugin)
+	if err != nil || schema.Configuration == nil {
+		return false
+	}
+	properties, _ := schema.Configuration["properties"].(map[string]interface{})
+	property, _ := properties[option].(map[string]interface{})
+	if property == nil {
+		return false
+	}
+
+	valueType, _ := property["type"].(string)
+	if valueType == "array" {
+		items, _ := property["items"].(map[string]interface{})
+		valueType, _ = items["type"].(string)
+	}
+	if valueType != "string" {
+		return false
+	}
+
+	description, _ := property["description"].(string)
+	description = strings.ToLower(description)
+	if strings.Contains(description, "container") || strings.Contains(description, "url") {
+		return false
+	}
+	name := strings.ToLower(option)
+	return slices.ContainsFunc(pathWords, func(word string) bool {
+		return strings.Contains(name, word) || strings.Contains(description, word)
+	})
+}
+
+// getPluginPathCompletions completes the files and directories of the checkout in the values
+// of plugin options taking paths, such as docker-compose's config. Agents run plugins from
+// the checkout root, so paths are relative to it.
+func (s *Server) getPluginPathCompletions(ctx context.Context, posCtx *bkcontext.PositionContext) ([]protocol.CompletionItem, bool) {
+	docPath, isFile := uriPath(posCtx.URI)
+	if !isFile {
+		return nil, false
+	}
+	found, ok := s.pluginPathValueAt(ctx, posCtx.FullContent, posCtx.Position)
+	if !ok {
+		return nil, false
+	}
+
+	// The path typed so far runs from the start of the value to the cursor
+	line := posCtx.CurrentLine
+	cursor := min(posCtx.CharIndex, len(line))
+	start := cursor
+	if found.value != nil && found.value.Line-1 == int(posCtx.Position.Line) {
+		start = found.value.Column - 1
+		if found.value.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0 {
+			start++
+		}
+	}
+	if start > cursor {
+		return nil, false
+	}
+	typed := line[start:cursor]
+	if filepath.IsAbs(typed) || strings.ContainsAny(typed, "$*?[") {
+		return nil, false
+	}
+
+	dir, base := "", typed
+	if slash := strings.LastIndex(typed, "/"); slash >= 0 {
+		dir, base = typed[:slash+1], typed[slash+1:]
+	}
+	root := s.checkoutRoot(docPath)
+	entries, err := os.ReadDir(filepath.Join(root, dir))
+	if err != nil {
+		return nil, false
+	}
+
+	replace := protocol.Range{
+		Start: protocol.Position{Line: posCtx.Position.Line, Character: uint32(start + len(dir))},
+		End:   protocol.Position{Line: posCtx.Position.Line, Character: uint32(cursor)},
+	}
+	items := []protocol.CompletionItem{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == ".git" || !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+
+		// Directories come first, ending in a slash to carry on into them
+		item := protocol.CompletionItem{
+			Label:    name,
+			Kind:     protocol.CompletionItemKindFile,
+			Detail:   fmt.Sprintf("%s for %s", dir+name, found.option),
+			SortText: "1-" + name,
+		}
+		if entry.IsDir() {
+			item.Label += "/"
+			item.Kind = protocol.CompletionItemKindFolder
+			item.SortText = "0-" + name
+		}
+		item.TextEdit = &protocol.TextEdit{Range: replace, NewText: item.Label}
+		items = append(items, item)
+		if len(items) == maxPathCompletions {
+			break
+		}
+	}
+	return items, true
+}
+
+// validatePluginPaths warns about paths in plugin options taking them that don't exist in the
+// checkout, when the validatePluginPaths setting is on. Globs, interpolated and absolute
+// paths, which may only exist on the agent, aren't checked.
+func (s *Server) validatePluginPaths(uri protocol.DocumentURI, pipeline *parser.Pipeline) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	root := pipeline.YAMLNode
+	docPath, isFile := uriPath(uri)
+	if !s.Settings().ValidatePluginPaths || !isFile || root == nil || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return diagnostics
+	}
+	checkout := s.checkoutRoot(docPath)
+
+	for _, step := range dependableSteps(mappingValue(root.Content[0], "steps")) {
+		for _, entry := range stepPluginEntries(mappingValue(step, "plugins")) {
+			if entry.config == nil || entry.config.Kind != yaml.MappingNode {
+				continue
+			}
+			for i := 0; i+1 < len(entry.config.Content); i += 2 {
+				option, value := entry.config.Content[i], entry.config.Content[i+1]
+				values := []*yaml.Node{value}
+				if value.Kind == yaml.SequenceNode {
+					values = value.Content
+				}
+				if !s.takesPaths(context.Background(), entry.key.Value, option.Value) {
+					continue
+				}
+
+				for _, path := range values {
+					if path.Kind != yaml.ScalarNode || path.Tag != "!!str" || path.Value == "" ||
+						filepath.IsAbs(path.Value) || strings.ContainsAny(path.Value, "$*?[") || strings.Contains(path.Value, "://") {
+						continue
+					}
+					if _, err := os.Stat(filepath.Join(checkout, path.Value)); err == nil {
+						continue
+					}
+					diagnostics = append(diagnostics, nodeDiagnostic(path, protocol.DiagnosticSeverityWarning, "plugin-path-not-found",
+						fmt.Sprintf("%s for the %s plugin's %s option doesn't exist in the checkout", path.Value, pluginDisplayName(entry.key.Value), option.Value)))
+				}
+			}
+		}
+	}
+
+	return diagnostics
+}
@@ -0,0 +1,160 @@
+package lsp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+
+	"github.com/mcncl/buildkite-ls/internal/plugins"
+)
+
+const pluginPathsPipeline = `steps:
+  - command: make test
+    plugins:
+      - docker-compose#v5.0.0:
+          config: 
+          run: app
+      - docker-compose#v5.0.0:
+          config: docker/D
+      - shellcheck#v1.4.0:
+          files:
+            - 
+      - my-org/lint#v1.0.0:
+          dockerfile-path: "do"
+          workdir: 
+`
+
+// pluginPathsCheckout creates a checkout holding a pipeline, returning the pipeline's URI
+func pluginPathsCheckout(t *testing.T) protocol.DocumentURI {
+	// The space is escaped in the pipeline's URI
+	root := filepath.Join(t.TempDir(), "my repo")
+	for _, dir := range []string{".buildkite", "docker", ".hidden"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{"docker-compose.yml", "docker/Dockerfile", "docker/compose.ci.yml", "README.md"} {
+		if err := os.WriteFile(filepath.Join(root, file), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return uri.File(filepath.Join(root, ".buildkite", "pipeline.yml"))
+}
+
+// newPluginPathsServer returns a server knowing the schemas of the pipeline's plugins, so
+// nothing is fetched
+func newPluginPathsServer() *Server {
+	server := newTestServer()
+	for _, ref := range []string{"docker-compose#v5.0.0", "shellcheck#v1.4.0"} {
+		server.pluginRegistry.CacheSchema(ref, &plugins.PluginSchema{Name: ref})
+	}
+	server.pluginRegistry.CacheSchema("my-org/lint#v1.0.0", &plugins.PluginSchema{
+		Name: "lint",
+		Configuration: map[string]interface{}{
+			"properties": map[string]interface{}{
+				"dockerfile-path": map[string]interface{}{"type": "string", "description": "Path to the Dockerfile to lint"},
+				"workdir":         map[string]interface{}{"type": "string", "description": "Working directory in the container"},
+			},
+		},
+	})
+	return server
+}
+
+func TestServer_PluginPathCompletions(t *testing.T) {
+	server := newPluginPathsServer()
+	uri := pluginPathsCheckout(t)
+	server.documentManager.OpenDocument(uri, 1, pluginPathsPipeline)
+
+	tests := []struct {
+		name     string
+		line     uint32
+		char     uint32
+		expected []string
+		start    uint32
+	}{
+		{"curated option", 4, 18, []string{"docker/", "README.md", "docker-compose.yml"}, 18},
+		{"inside a directory", 7, 26, []string{"Dockerfile"}, 25},
+		{"list entry", 10, 14, []string{"docker/", "README.md", "docker-compose.yml"}, 14},
+		{"option the schema describes as a path", 12, 30, []string{"docker/", "docker-compose.yml"}, 28},
+		{"container path", 13, 19, nil, 0},
+		{"option that isn't a path", 5, 15, nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := server.Completion(context.Background(), &protocol.CompletionParams{
+				TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+					TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+					Position:     protocol.Position{Line: tt.line, Character: tt.char},
+				},
+			})
+			if err != nil {
+				t.Fatalf("Completion failed: %v", err)
+			}
+
+			var labels []string
+			for _, item := range list.Items {
+				if item.Kind == protocol.CompletionItemKindFile || item.Kind == protocol.CompletionItemKindFolder {
+					labels = append(labels, item.Label)
+					if item.TextEdit == nil || item.TextEdit.Range.Start.Character != tt.start || item.TextEdit.Range.End.Character != tt.char {
+						t.Errorf("Expected %s to replace %d-%d, got %+v", item.Label, tt.start, tt.char, item.TextEdit)
+					}
+				}
+			}
+			if !slices.Equal(labels, tt.expected) {
+				t.Errorf("Expected paths %v, got %v", tt.expected, labels)
+			}
+		})
+	}
+}
+
+func TestServer_ValidatePluginPaths(t *testing.T) {
+	server := newPluginPathsServer()
+	uri := pluginPathsCheckout(t)
+	content := `steps:
+  - command: make test
+    plugins:
+      - docker-compose#v5.0.0:
+          config:
+            - docker-compose.yml
+            - docker/compose.test.yml
+            - docker/compose.${ENV}.yml
+      - shellcheck#v1.4.0:
+          files: scripts/*.sh
+`
+
+	pluginPathDiagnostics := func() []protocol.Diagnostic {
+		var diagnostics []protocol.Diagnostic
+		for _, diagnostic := range server.diagnose(uri, content) {
+			if diagnostic.Code == "plugin-path-not-found" {
+				diagnostics = append(diagnostics, diagnostic)
+			}
+		}
+		return diagnostics
+	}
+
+	if diagnostics := pluginPathDiagnostics(); len(diagnostics) != 0 {
+		t.Fatalf("Expected paths not to be checked by default, got %+v", diagnostics)
+	}
+
+	settings := DefaultSettings()
+	settings.ValidatePluginPaths = true
+	server.SetSettings(settings)
+
+	diagnostics := pluginPathDiagnostics()
+	if len(diagnostics) != 1 {
+		t.Fatalf("Expected 1 missing path warning, got %+v", diagnostics)
+	}
+	got := diagnostics[0]
+	if got.Severity != protocol.DiagnosticSeverityWarning || got.Range.Start.Line != 6 || got.Range.Start.Character != 14 {
+		t.Errorf("Expected a warning on docker/compose.test.yml, got %+v", got)
+	}
+	if expected := "docker/compose.test.yml for the docker-compose plugin's config option doesn't exist in the checkout"; got.Message != expected {
+		t.Errorf("Expected message %q, got %q", expected, got.Message)
+	}
+}
@@ -0,0 +1,40 @@
+package lsp
+
+import (
+	"context"
+
+	"go.lsp.dev/protocol"
+
+	"github.com/mcncl/buildkite-ls/internal/plugins"
+)
+
+// prefetchPluginSchemas fetches the schemas of every plugin a document uses in the
+// background, a few at a time, so the first completion or hover inside a plugin's
+// configuration doesn't wait on the network. Validation joins the fetches in flight.
+func (s *Server) prefetchPluginSchemas(uri protocol.DocumentURI, content string) {
+	if !s.isBuildkiteFile(string(uri)) {
+		return
+	}
+
+	refs := documentPluginRefs(uri, content)
+	if len(refs) == 0 {
+		return
+	}
+
+	s.logger.Printf("Prefetching %d plugin schema(s) for %s", len(refs), uri)
+	go s.pluginRegistry.Prefetch(context.Background(), refs, plugins.DefaultPrefetchParallelism)
+}
+
+// documentPluginRefs lists the plugin references in a document's plugins blocks, with their
+// versions, as the registry looks them up
+func documentPluginRefs(uri protocol.DocumentURI, content string) []string {
+	var refs []string
+	for _, usage := range findPluginReferences(uri, splitLines(content)) {
+		ref := usage.Plugin
+		if usage.Version != "" {
+			ref += "#" + usage.Version
+		}
+		refs = append(refs, ref)
+	}
+	return refs
+}
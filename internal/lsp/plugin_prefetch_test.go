@@ -0,0 +1,32 @@
+package lsp
+
+import (
+	"reflect"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+func TestDocumentPluginRefs(t *testing.T) {
+	content := `steps:
+  - command: make
+    plugins:
+      - docker#v5.13.0:
+          image: golang
+      - "my-org/deploy#v1.0.0":
+          environment: production
+  - group: Checks
+    steps:
+      - command: make lint
+        plugins:
+          - shellcheck:
+              files: ["*.sh"]
+          - docker#v5.13.0:
+              image: koalaman/shellcheck`
+
+	refs := documentPluginRefs(protocol.DocumentURI("file:///test/.buildkite/pipeline.yml"), content)
+	expected := []string{"docker#v5.13.0", "my-org/deploy#v1.0.0", "shellcheck", "docker#v5.13.0"}
+	if !reflect.DeepEqual(refs, expected) {
+		t.Errorf("Expected %v, got %v", expected, refs)
+	}
+}
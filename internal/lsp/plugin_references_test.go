@@ -0,0 +1,133 @@
+package lsp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+
+	bkcontext "github.com/mcncl/buildkite-ls/internal/context"
+)
+
+const pluginReferencesPipeline = `steps:
+  - label: Deploy
+    command: make deploy
+    plugins:
+      - ssh://git@gitlab.example.com/ci/deploy.git#v1.0:
+          target: staging
+      - my.plugin#v1.2.3:
+          mode: fast
+      - docker:
+          image: node:20
+      - ./.buildkite/plugins/notify:
+          channel: "#builds"`
+
+func TestServer_DetectPluginName_References(t *testing.T) {
+	server := newTestServer()
+	lines := splitLines(pluginReferencesPipeline)
+
+	tests := []struct {
+		line     uint32
+		expected string
+	}{
+		{4, "ssh://git@gitlab.example.com/ci/deploy.git#v1.0"},
+		{5, "ssh://git@gitlab.example.com/ci/deploy.git#v1.0"},
+		{7, "my.plugin#v1.2.3"},
+		{9, "docker"},
+		{11, "./.buildkite/plugins/notify"},
+		{2, ""},
+	}
+
+	for _, tt := range tests {
+		posCtx := &bkcontext.PositionContext{
+			Position:    protocol.Position{Line: tt.line, Character: uint32(len(lines[tt.line]))},
+			CurrentLine: lines[tt.line],
+			CharIndex:   len(lines[tt.line]),
+			FullContent: pluginReferencesPipeline,
+		}
+		if got := server.detectPluginName(posCtx); got != tt.expected {
+			t.Errorf("Line %d: expected plugin %q, got %q", tt.line, tt.expected, got)
+		}
+	}
+}
+
+func TestServer_PluginReferenceHover(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	server.documentManager.OpenDocument(uri, 1, pluginReferencesPipeline)
+
+	tests := []struct {
+		name     string
+		line     uint32
+		char     uint32
+		expected []string
+	}{
+		{"ssh reference", 4, 30, []string{"**Source**", "gitlab.example.com"}},
+		{"local plugin", 10, 20, []string{"**Source**", "./.buildkite/plugins/notify"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hover, err := server.Hover(context.Background(), &protocol.HoverParams{
+				TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+					TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+					Position:     protocol.Position{Line: tt.line, Character: tt.char},
+				},
+			})
+			if err != nil || hover == nil {
+				t.Fatalf("Expected hover content, got %v (%v)", hover, err)
+			}
+			for _, expected := range tt.expected {
+				if !strings.Contains(hover.Contents.Value, expected) {
+					t.Errorf("Expected hover to contain %q, got:\n%s", expected, hover.Contents.Value)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_PluginReferenceSemanticTokens(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	server.documentManager.OpenDocument(uri, 1, pluginReferencesPipeline)
+
+	result, err := server.SemanticTokensFull(context.Background(), &protocol.SemanticTokensParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+	})
+	if err != nil {
+		t.Fatalf("SemanticTokensFull failed: %v", err)
+	}
+
+	// Decode the relative lines into the type of the first token after the dash on each line
+	keyTypes := make(map[uint32]uint32)
+	var line uint32
+	for i := 0; i+4 < len(result.Data); i += 5 {
+		line += result.Data[i]
+		tokenType := result.Data[i+3]
+		if _, seen := keyTypes[line]; !seen && tokenType != uint32(server.getTokenTypeIndex("operator")) {
+			keyTypes[line] = tokenType
+		}
+	}
+
+	function := uint32(server.getTokenTypeIndex("function"))
+	for _, entry := range []uint32{4, 6, 8, 10} {
+		if keyTypes[entry] != function {
+			t.Errorf("Line %d: expected the plugin reference to be a function token, got type %d", entry, keyTypes[entry])
+		}
+	}
+	if keyTypes[9] == function {
+		t.Errorf("Expected the plugin's image option not to be a function token")
+	}
+}
+
+func TestServer_PluginReferenceDiagnostics(t *testing.T) {
+	server := newTestServer()
+
+	// Plugins outside GitHub have no schema to fetch, so they must never fail validation
+	for _, diagnostic := range server.Diagnose(pluginReferencesPipeline) {
+		if strings.Contains(diagnostic.Message, "gitlab.example.com") || strings.Contains(diagnostic.Message, ".buildkite/plugins/notify") {
+			t.Errorf("Expected no diagnostics for git URLs or local plugins, got %+v", diagnostic)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package lsp
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/mcncl/buildkite-ls/internal/context"
+)
+
+// stepPlugin is a plugin used by a step, with the config it is given
+type stepPlugin struct {
+	Ref    string
+	Config interface{}
+}
+
+// pluginsKeyAt returns the value of the plugins key on the 0-based line, or nil
+func pluginsKeyAt(node *yaml.Node, line int) *yaml.Node {
+	if node.Kind == yaml.MappingNode {
+		if entry := mappingKey(node, "plugins"); entry != nil && entry.key.Line == line+1 {
+			return entry.value
+		}
+	}
+	for _, child := range node.Content {
+		if value := pluginsKeyAt(child, line); value != nil {
+			return value
+		}
+	}
+	return nil
+}
+
+// pluginsFromNode lists the plugins of a plugins value, in list or map form
+func pluginsFromNode(node *yaml.Node) []stepPlugin {
+	var entries []*yaml.Node
+	switch node.Kind {
+	case yaml.SequenceNode:
+		entries = node.Content
+	case yaml.MappingNode:
+		entries = []*yaml.Node{node}
+	}
+
+	var used []stepPlugin
+	for _, entry := range entries {
+		switch entry.Kind {
+		case yaml.ScalarNode:
+			used = append(used, stepPlugin{Ref: entry.Value})
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(entry.Content); i += 2 {
+				var config interface{}
+				if err := entry.Content[i+1].Decode(&config); err != nil {
+					config = nil
+				}
+				used = append(used, stepPlugin{Ref: entry.Content[i].Value, Config: config})
+			}
+		}
+	}
+	return used
+}
+
+// getPluginsSummaryHoverContent summarises the plugins a step's plugins key lists: their
+// versions, whether their schemas are cached, and how their configs validate. Nothing is
+// fetched, so plugins the server hasn't looked up yet are reported as such.
+func (s *Server) getPluginsSummaryHoverContent(posCtx *context.PositionContext) string {
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte(posCtx.FullContent), &root); err != nil {
+		return ""
+	}
+
+	value := pluginsKeyAt(&root, int(posCtx.Position.Line))
+	if value == nil {
+		return ""
+	}
+	used := pluginsFromNode(value)
+	if len(used) == 0 {
+		return ""
+	}
+
+	var cached, failed int
+	var rows strings.Builder
+	for _, plugin := range used {
+		name, version, pinned := strings.Cut(plugin.Ref, "#")
+		if pinned {
+			version = "`" + version + "`"
+		} else {
+			version = "unpinned"
+		}
+
+		status := s.pluginRegistry.CachedStatus(plugin.Ref, plugin.Config)
+		schema, validation := "not fetched yet", "-"
+		if status.Schema != nil {
+			cached++
+			schema = "cached"
+			if status.Expired {
+				schema = "cached (refreshing)"
+			}
+			validation = "no config schema"
+			if status.Schema.SchemaErr != nil {
+				validation = "schema not supported"
+			}
+		}
+		if status.Validated {
+			validation = "valid"
+			if status.ValidationErr != nil {
+				failed++
+				validation = "⚠️ " + strings.ReplaceAll(status.ValidationErr.Error(), "|", "\\|")
+			}
+		}
+		fmt.Fprintf(&rows, "| `%s` | %s | %s | %s |\n", name, version, schema, validation)
+	}
+
+	noun := "plugins"
+	if len(used) == 1 {
+		noun = "plugin"
+	}
+	content := fmt.Sprintf("**%d %s on this step**\n\n", len(used), noun)
+	content += fmt.Sprintf("%d of %d schemas cached, %d failed validation\n\n", cached, len(used), failed)
+	content += "| Plugin | Version | Schema | Validation |\n|---|---|---|---|\n" + rows.String()
+	return content
+}
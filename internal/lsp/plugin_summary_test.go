@@ -0,0 +1,60 @@
+package lsp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+
+	"github.com/mcncl/buildkite-ls/internal/plugins"
+)
+
+func TestServer_PluginsSummaryHover(t *testing.T) {
+	server := newTestServer()
+	server.pluginRegistry.CacheSchema("docker#v5.13.0", &plugins.PluginSchema{
+		Name:       "Docker",
+		SchemaData: []byte(`{"type": "object", "required": ["image"]}`),
+	})
+	server.pluginRegistry.CacheSchema("my-org/deploy#v1.0.0", &plugins.PluginSchema{
+		Name:       "Deploy",
+		SchemaData: []byte(`{"type": "object"}`),
+	})
+
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	server.documentManager.OpenDocument(uri, 1, `steps:
+  - command: make build
+    plugins:
+      - docker#v5.13.0:
+          workdir: /app
+      - my-org/deploy#v1.0.0:
+          env: production
+      - other-org/unfetched
+`)
+
+	hover, err := server.Hover(context.Background(), &protocol.HoverParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 2, Character: 6},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Hover failed: %v", err)
+	}
+	if hover == nil {
+		t.Fatal("Expected hover content")
+	}
+
+	for _, expected := range []string{
+		"List of plugins",
+		"**3 plugins on this step**",
+		"2 of 3 schemas cached, 1 failed validation",
+		"| `docker` | `v5.13.0` | cached | ⚠️",
+		"| `my-org/deploy` | `v1.0.0` | cached | valid |",
+		"| `other-org/unfetched` | unpinned | not fetched yet | - |",
+	} {
+		if !strings.Contains(hover.Contents.Value, expected) {
+			t.Errorf("Expected hover to contain %q, got:\n%s", expected, hover.Contents.Value)
+		}
+	}
+}
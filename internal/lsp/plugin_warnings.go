@@ -0,0 +1,43 @@
+package lsp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.lsp.dev/protocol"
+)
+
+// warnPluginFetchFailure tells the user, once per plugin per session, that a plugin's schema
+// couldn't be loaded, so its configuration isn't checked and completion falls back to
+// generic options. Every version of a plugin shares the one warning.
+func (s *Server) warnPluginFetchFailure(pluginName string, err error) {
+	name, _, _ := strings.Cut(pluginName, "#")
+
+	s.settingsMu.Lock()
+	warned := s.pluginFetchWarnings[name]
+	s.pluginFetchWarnings[name] = true
+	s.settingsMu.Unlock()
+
+	s.logger.Printf("Failed to load plugin schema for %s: %v", pluginName, err)
+	if warned || s.conn == nil {
+		return
+	}
+
+	// The registry wraps the underlying failure with the plugin's details, which the
+	// message already names
+	reason := err
+	if inner := errors.Unwrap(err); inner != nil {
+		reason = inner
+	}
+
+	params := protocol.ShowMessageParams{
+		Type: protocol.MessageTypeWarning,
+		Message: fmt.Sprintf("Couldn't load the schema of plugin %s: %v. Its configuration isn't validated, "+
+			"and completion offers generic options only.", pluginName, reason),
+	}
+	if err := s.conn.Notify(context.Background(), "window/showMessage", params); err != nil {
+		s.logger.Printf("Failed to send plugin schema warning: %v", err)
+	}
+}
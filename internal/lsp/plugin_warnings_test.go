@@ -0,0 +1,71 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"go.lsp.dev/jsonrpc2"
+	"go.lsp.dev/protocol"
+)
+
+func TestServer_WarnPluginFetchFailureOncePerPlugin(t *testing.T) {
+	server := newTestServer()
+	ctx := context.Background()
+
+	serverSide, clientSide := net.Pipe()
+	defer serverSide.Close()
+	defer clientSide.Close()
+
+	messages := make(chan protocol.ShowMessageParams, 4)
+	client := jsonrpc2.NewConn(jsonrpc2.NewStream(clientSide))
+	client.Go(ctx, func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		if req.Method() == "window/showMessage" {
+			var params protocol.ShowMessageParams
+			if err := json.Unmarshal(req.Params(), &params); err == nil {
+				messages <- params
+			}
+		}
+		return reply(ctx, nil, nil)
+	})
+	conn := jsonrpc2.NewConn(jsonrpc2.NewStream(serverSide))
+	conn.Go(ctx, jsonrpc2.MethodNotFoundHandler)
+	server.SetConnection(conn)
+
+	notFound := fmt.Errorf("failed to fetch plugin schema for my-org/private#v1.0.0: %w", fmt.Errorf("HTTP 404 from https://example.com/plugin.yml"))
+	server.warnPluginFetchFailure("my-org/private#v1.0.0", notFound)
+	server.warnPluginFetchFailure("my-org/private#v1.0.0", notFound)
+	server.warnPluginFetchFailure("my-org/private#v2.0.0", notFound)
+	server.warnPluginFetchFailure("docker#v5.13.0", fmt.Errorf("connection refused"))
+
+	var received []protocol.ShowMessageParams
+	for len(received) < 2 {
+		select {
+		case message := <-messages:
+			received = append(received, message)
+		case <-time.After(time.Second):
+			t.Fatalf("Expected a warning per plugin, got %+v", received)
+		}
+	}
+
+	first := received[0]
+	if first.Type != protocol.MessageTypeWarning {
+		t.Errorf("Expected a warning, got type %v", first.Type)
+	}
+	if !strings.Contains(first.Message, "plugin my-org/private#v1.0.0: HTTP 404 from https://example.com/plugin.yml.") {
+		t.Errorf("Expected the plugin and the reason in the message, got %q", first.Message)
+	}
+	if !strings.Contains(received[1].Message, "plugin docker#v5.13.0: connection refused") {
+		t.Errorf("Expected the second plugin's warning, got %q", received[1].Message)
+	}
+
+	select {
+	case message := <-messages:
+		t.Errorf("Expected no further warnings, got %+v", message)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
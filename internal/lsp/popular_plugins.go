@@ -0,0 +1,41 @@
+package lsp
+
+import "time"
+
+// pluginSchemaRefreshInterval is how often expired plugin schemas are looked for and fetched
+// again in the background
+const pluginSchemaRefreshInterval = 15 * time.Minute
+
+// popularPluginsRefreshInterval is how often the popular plugins manifest is checked for
+// new versions, and how long a cached copy is trusted
+const popularPluginsRefreshInterval = 24 * time.Hour
+
+// startPopularPluginsRefresh keeps the popular plugins manifest and the cached plugin schemas
+// current for the rest of the session. Refreshes of the manifest do nothing while it's
+// pinned to the bundled copy.
+func (s *Server) startPopularPluginsRefresh() {
+	stop := s.popularPlugins.RefreshEvery(popularPluginsRefreshInterval, func(err error) {
+		s.logger.Printf("%v", err)
+	})
+	stopSchemas := s.pluginRegistry.RefreshEvery(pluginSchemaRefreshInterval)
+
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+	if s.stopPopularRefresh != nil {
+		s.stopPopularRefresh()
+	}
+	s.stopPopularRefresh = func() {
+		stop()
+		stopSchemas()
+	}
+}
+
+// stopPopularPluginsRefresh stops refreshing the popular plugins manifest and plugin schemas
+func (s *Server) stopPopularPluginsRefresh() {
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+	if s.stopPopularRefresh != nil {
+		s.stopPopularRefresh()
+		s.stopPopularRefresh = nil
+	}
+}
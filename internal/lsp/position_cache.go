@@ -0,0 +1,100 @@
+package lsp
+
+import (
+	"container/list"
+	"sync"
+
+	"go.lsp.dev/protocol"
+)
+
+// positionCacheSize is how many lines' position contexts are kept. Typing fires completion,
+// hover and signature help on the same few lines, so a small cache covers them.
+const positionCacheSize = 64
+
+// positionKey identifies a line of a version of a document
+type positionKey struct {
+	uri     protocol.DocumentURI
+	version int32
+	line    int
+}
+
+// lineContext is the part of a position context that depends only on the line. Its slices
+// share the document's lines, which are replaced rather than changed on edit, so they must
+// not be written to.
+type lineContext struct {
+	currentLine  string
+	contextLines []string
+	fullContent  string
+}
+
+type positionEntry struct {
+	key     positionKey
+	context lineContext
+}
+
+// positionCache is a least recently used cache of line contexts
+type positionCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[positionKey]*list.Element
+}
+
+func newPositionCache(size int) *positionCache {
+	return &positionCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[positionKey]*list.Element),
+	}
+}
+
+func (c *positionCache) get(key positionKey) (lineContext, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return lineContext{}, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*positionEntry).context, true
+}
+
+func (c *positionCache) put(key positionKey, context lineContext) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*positionEntry).context = context
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&positionEntry{key: key, context: context})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*positionEntry).key)
+	}
+}
+
+// forget drops a document's entries. Clients may reuse a version number when they reopen a
+// document, so its entries go whenever its content is replaced.
+func (c *positionCache) forget(uri protocol.DocumentURI) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, element := range c.entries {
+		if key.uri == uri {
+			c.order.Remove(element)
+			delete(c.entries, key)
+		}
+	}
+}
+
+// len reports the number of cached lines
+func (c *positionCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
@@ -0,0 +1,17 @@
+package lsp
+
+// Replies follow one convention for "nothing here", so strict clients see the same shape
+// whichever way a handler finds there's nothing to return. Requests answered with a list,
+// such as code actions, document symbols and folding ranges, reply with an empty list and
+// never null. Requests answered with a single object, such as hover, signature help and
+// the custom step requests, reply null. Completion always replies with a completion list,
+// and semantic tokens with a result, both empty when there's nothing to offer.
+
+// listResult returns the items, or an empty list in place of nil, which would be sent as
+// null
+func listResult[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
@@ -0,0 +1,411 @@
+package lsp
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+
+	"github.com/mcncl/buildkite-ls/internal/context"
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+// Bounds of an automatic retry rule's limit
+const (
+	minRetryLimit = 1
+	maxRetryLimit = 10
+)
+
+// signalReasons are the values signal_reason matches, in the order they're offered
+var signalReasons = []struct {
+	Reason      string
+	Description string
+}{
+	{"*", "Any signal reason"},
+	{"none", "The job wasn't stopped by a signal"},
+	{"agent_refused", "The agent refused the job, e.g. from a pre-bootstrap hook"},
+	{"agent_stop", "The agent was stopped while running the job"},
+	{"cancel", "The job was cancelled"},
+	{"process_run_error", "The job's process couldn't be started"},
+	{"signature_rejected", "The job's signature failed verification"},
+}
+
+// manualRetryKeys are the settings of a step's retry.manual
+var manualRetryKeys = map[string]string{
+	"allowed":          "**allowed** - Whether the job can be retried manually\n\nDefaults to `true`. With `false`, the Retry button is disabled and shows the `reason`.\n\nExample: `allowed: false`",
+	"permit_on_passed": "**permit_on_passed** - Whether the job can be retried after it passes\n\nDefaults to `true`. With `false`, only failed jobs can be retried, which suits steps such as deploys that shouldn't run twice.\n\nExample: `permit_on_passed: false`",
+	"reason":           "**reason** - Why the job can't be retried\n\nShown in a tooltip on the disabled Retry button. Buildkite only displays it when `allowed` is `false`.\n\nExample: `reason: \"Deploys can't be retried, trigger a new build instead\"`",
+}
+
+var (
+	// exitStatusValuePattern matches an `exit_status:` value that is still being typed
+	exitStatusValuePattern = regexp.MustCompile(`^\s*(-\s+)?exit_status:\s*["']?[-*\d]*$`)
+	// signalReasonValuePattern matches a `signal_reason:` value that is still being typed
+	signalReasonValuePattern = regexp.MustCompile(`^\s*(-\s+)?signal_reason:\s*["']?[\w*]*$`)
+)
+
+// getRetryValueCompletions offers the wildcard and agent-lost statuses for exit_status, and
+// the signal_reason values
+func (cp *CompletionProvider) getRetryValueCompletions(posCtx *context.PositionContext) ([]protocol.CompletionItem, bool) {
+	beforeCursor := posCtx.CurrentLine
+	if posCtx.CharIndex <= len(beforeCursor) {
+		beforeCursor = beforeCursor[:posCtx.CharIndex]
+	}
+
+	switch {
+	case exitStatusValuePattern.MatchString(beforeCursor):
+		return []protocol.CompletionItem{
+			{
+				Label:      `"*"`,
+				Kind:       protocol.CompletionItemKindEnumMember,
+				Detail:     "Any exit status",
+				InsertText: `"*"`,
+				SortText:   "0",
+			},
+			{
+				Label:    "-1",
+				Kind:     protocol.CompletionItemKindEnumMember,
+				Detail:   "The agent was lost while running the job",
+				SortText: "1",
+			},
+		}, true
+	case signalReasonValuePattern.MatchString(beforeCursor):
+		items := make([]protocol.CompletionItem, 0, len(signalReasons))
+		for i, reason := range signalReasons {
+			label := reason.Reason
+			if label == "*" {
+				label = `"*"`
+			}
+			items = append(items, protocol.CompletionItem{
+				Label:    label,
+				Kind:     protocol.CompletionItemKindEnumMember,
+				Detail:   reason.Description,
+				SortText: fmt.Sprintf("%d", i),
+			})
+		}
+		return items, true
+	}
+
+	return nil, false
+}
+
+// getManualRetryCompletions offers the settings of retry.manual that aren't set yet
+func (cp *CompletionProvider) getManualRetryCompletions(posCtx *context.PositionContext) []protocol.CompletionItem {
+	existing := siblingKeys(posCtx)
+
+	items := []protocol.CompletionItem{}
+	for _, key := range slices.Sorted(maps.Keys(manualRetryKeys)) {
+		if existing[key] {
+			continue
+		}
+		detail, _, _ := strings.Cut(strings.TrimPrefix(manualRetryKeys[key], "**"+key+"** - "), "\n")
+		items = append(items, protocol.CompletionItem{
+			Label:         key,
+			Kind:          protocol.CompletionItemKindProperty,
+			Detail:        detail,
+			Documentation: &protocol.MarkupContent{Kind: protocol.Markdown, Value: manualRetryKeys[key]},
+			InsertText:    key + ": ",
+		})
+	}
+	return items
+}
+
+// getManualRetryHoverContent documents the settings of retry.manual, which would otherwise
+// fall through to step property docs
+func getManualRetryHoverContent(posCtx *context.PositionContext, currentWord string, contextInfo *context.ContextInfo) (string, bool) {
+	if !contextInfo.IsInRetryManual() || currentWord == "" || yamlKey(posCtx.CurrentLine) != currentWord {
+		return "", false
+	}
+	return manualRetryKeys[currentWord], true
+}
+
+// validateRetry checks the retry settings of every step: that automatic rules' exit statuses
+// are integers, -1 or "*", that their limits are in bounds, that no two rules match the same
+// jobs, and that manual retry settings have the right types
+func (s *Server) validateRetry(pipeline *parser.Pipeline) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	root := pipeline.YAMLNode
+	if root == nil || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return diagnostics
+	}
+	root = root.Content[0]
+
+	var walkSteps func(steps *yaml.Node)
+	walkSteps = func(steps *yaml.Node) {
+		if steps == nil || steps.Kind != yaml.SequenceNode {
+			return
+		}
+		for _, step := range steps.Content {
+			if step.Kind != yaml.MappingNode {
+				continue
+			}
+			if retry := mappingValue(step, "retry"); retry != nil && retry.Kind == yaml.MappingNode {
+				diagnostics = append(diagnostics, automaticRetryDiagnostics(mappingValue(retry, "automatic"))...)
+				diagnostics = append(diagnostics, manualRetryDiagnostics(mappingValue(retry, "manual"))...)
+			}
+			walkSteps(mappingValue(step, "steps"))
+		}
+	}
+	walkSteps(mappingValue(root, "steps"))
+
+	return diagnostics
+}
+
+// retryRule is the first rule seen matching a combination of exit status and signal
+type retryRule struct {
+	exitStatus *yaml.Node
+	limit      string
+}
+
+// automaticRetryDiagnostics checks a step's automatic retry rules, given as one rule or a list
+func automaticRetryDiagnostics(automatic *yaml.Node) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+	if automatic == nil {
+		return diagnostics
+	}
+
+	var rules []*yaml.Node
+	switch automatic.Kind {
+	case yaml.MappingNode:
+		rules = []*yaml.Node{automatic}
+	case yaml.SequenceNode:
+		rules = automatic.Content
+	}
+
+	seen := make(map[string]retryRule)
+	for _, rule := range rules {
+		if rule.Kind != yaml.MappingNode {
+			continue
+		}
+
+		if limit := mappingValue(rule, "limit"); limit != nil {
+			if diagnostic := retryLimitDiagnostic(limit); diagnostic != nil {
+				diagnostics = append(diagnostics, *diagnostic)
+			}
+		}
+
+		if reason := mappingValue(rule, "signal_reason"); reason != nil && reason.Kind == yaml.ScalarNode && !isSignalReason(reason.Value) {
+			diagnostics = append(diagnostics, nodeDiagnostic(reason, protocol.DiagnosticSeverityError, "invalid-signal-reason",
+				fmt.Sprintf("Unknown signal_reason %q. Use one of: %s", reason.Value, strings.Join(signalReasonNames(), ", "))))
+		}
+
+		exitStatus := mappingValue(rule, "exit_status")
+		if exitStatus == nil {
+			continue
+		}
+
+		statuses := []*yaml.Node{exitStatus}
+		if exitStatus.Kind == yaml.SequenceNode {
+			statuses = exitStatus.Content
+		}
+
+		// Rules apply to the combination of exit status and signal they match
+		signal := fmt.Sprintf("%s|%s", stringNodeValue(mappingValue(rule, "signal")), stringNodeValue(mappingValue(rule, "signal_reason")))
+		limit := stringNodeValue(mappingValue(rule, "limit"))
+
+		for _, status := range statuses {
+			value, diagnostic := exitStatusValue(status, exitStatus.Kind == yaml.SequenceNode)
+			if diagnostic != nil {
+				diagnostics = append(diagnostics, *diagnostic)
+				continue
+			}
+
+			key := value + "|" + signal
+			first, duplicate := seen[key]
+			if !duplicate {
+				seen[key] = retryRule{exitStatus: status, limit: limit}
+				continue
+			}
+
+			message := fmt.Sprintf("exit_status %s is already retried by the rule on line %d", value, first.exitStatus.Line)
+			if first.limit != limit {
+				message = fmt.Sprintf("exit_status %s is already retried with limit %s by the rule on line %d; only the first matching rule applies", value, orUnset(first.limit), first.exitStatus.Line)
+			}
+			diagnostics = append(diagnostics, nodeDiagnostic(status, protocol.DiagnosticSeverityWarning, "duplicate-exit-status", message))
+		}
+	}
+
+	return diagnostics
+}
+
+// manualRetryDiagnostics checks retry.manual, given as a boolean or as its settings: allowed
+// and permit_on_passed are booleans and reason a string, which is only shown when the job
+// can't be retried
+func manualRetryDiagnostics(manual *yaml.Node) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+	if manual == nil {
+		return diagnostics
+	}
+
+	if manual.Kind != yaml.MappingNode {
+		if manual.Kind != yaml.ScalarNode || manual.Tag != "!!bool" {
+			diagnostics = append(diagnostics, nodeDiagnostic(manual, protocol.DiagnosticSeverityError, "invalid-manual-retry",
+				"retry.manual must be true, false or a mapping of allowed, permit_on_passed and reason"))
+		}
+		return diagnostics
+	}
+
+	for i := 0; i+1 < len(manual.Content); i += 2 {
+		key, value := manual.Content[i], manual.Content[i+1]
+		switch key.Value {
+		case "allowed", "permit_on_passed":
+			if value.Kind != yaml.ScalarNode || value.Tag != "!!bool" {
+				message := fmt.Sprintf("retry.manual.%s must be true or false", key.Value)
+				if value.Kind == yaml.ScalarNode && (value.Value == "true" || value.Value == "false") {
+					message = fmt.Sprintf("retry.manual.%s %q is a string. Remove the quotes to make it a boolean", key.Value, value.Value)
+				}
+				diagnostics = append(diagnostics, nodeDiagnostic(value, protocol.DiagnosticSeverityError, "invalid-manual-retry", message))
+			}
+		case "reason":
+			if value.Kind != yaml.ScalarNode || isImplicitNull(value) {
+				diagnostics = append(diagnostics, nodeDiagnostic(value, protocol.DiagnosticSeverityError, "invalid-manual-retry",
+					"retry.manual.reason must be a string"))
+			}
+		default:
+			diagnostics = append(diagnostics, nodeDiagnostic(key, protocol.DiagnosticSeverityError, "invalid-manual-retry",
+				fmt.Sprintf("retry.manual cannot set '%s'. It takes: %s", key.Value, strings.Join(slices.Sorted(maps.Keys(manualRetryKeys)), ", "))))
+		}
+	}
+
+	// The reason explains a disabled Retry button, so it's hidden while retrying is allowed
+	if reason := mappingKey(manual, "reason"); reason != nil {
+		if allowed := mappingValue(manual, "allowed"); allowed == nil || allowed.Value != "false" {
+			diagnostics = append(diagnostics, nodeDiagnostic(reason.key, protocol.DiagnosticSeverityWarning, "unshown-retry-reason",
+				"retry.manual.reason is only shown when allowed is false, so it's never displayed here"))
+		}
+	}
+
+	return diagnostics
+}
+
+// exitStatusValue normalises an exit status, or explains why it isn't one. Lists only take
+// integers, so the wildcard has to be on its own.
+func exitStatusValue(status *yaml.Node, inList bool) (string, *protocol.Diagnostic) {
+	if status.Kind != yaml.ScalarNode {
+		diagnostic := nodeDiagnostic(status, protocol.DiagnosticSeverityError, "invalid-exit-status", `exit_status must be an integer, -1 or "*"`)
+		return "", &diagnostic
+	}
+
+	if status.Tag == "!!int" {
+		number, err := strconv.Atoi(status.Value)
+		switch {
+		case err != nil:
+		case number < -1:
+			diagnostic := nodeDiagnostic(status, protocol.DiagnosticSeverityError, "invalid-exit-status",
+				fmt.Sprintf("exit_status %d never happens. Exit statuses are 0-255, or -1 when the agent is lost", number))
+			return "", &diagnostic
+		case number > 255:
+			diagnostic := nodeDiagnostic(status, protocol.DiagnosticSeverityWarning, "invalid-exit-status",
+				fmt.Sprintf("exit_status %d never happens: exit statuses are 0-255, so it is reported as %d", number, number%256))
+			return "", &diagnostic
+		default:
+			return strconv.Itoa(number), nil
+		}
+	}
+
+	if status.Value == "*" && !inList {
+		return "*", nil
+	}
+
+	message := fmt.Sprintf(`exit_status %q must be an integer, -1 or "*"`, status.Value)
+	switch {
+	case status.Value == "*":
+		message = `"*" can't be part of an exit_status list. Use it on its own to retry any exit status`
+	case status.Tag == "!!str" && isInteger(status.Value):
+		message = fmt.Sprintf("exit_status %q is a string. Remove the quotes to match the exit status %s", status.Value, status.Value)
+	}
+	diagnostic := nodeDiagnostic(status, protocol.DiagnosticSeverityError, "invalid-exit-status", message)
+	return "", &diagnostic
+}
+
+// retryLimitDiagnostic flags a limit that isn't an integer within the allowed bounds
+func retryLimitDiagnostic(limit *yaml.Node) *protocol.Diagnostic {
+	number, err := strconv.Atoi(limit.Value)
+	if limit.Kind != yaml.ScalarNode || limit.Tag != "!!int" || err != nil {
+		diagnostic := nodeDiagnostic(limit, protocol.DiagnosticSeverityError, "invalid-retry-limit",
+			fmt.Sprintf("Retry limit must be an integer from %d to %d", minRetryLimit, maxRetryLimit))
+		return &diagnostic
+	}
+	if number < minRetryLimit || number > maxRetryLimit {
+		diagnostic := nodeDiagnostic(limit, protocol.DiagnosticSeverityError, "invalid-retry-limit",
+			fmt.Sprintf("Retry limit %d is out of bounds: a job can be retried automatically %d to %d times", number, minRetryLimit, maxRetryLimit))
+		return &diagnostic
+	}
+	return nil
+}
+
+// nodeDiagnostic reports a problem with a scalar, or the start of a collection
+func nodeDiagnostic(node *yaml.Node, severity protocol.DiagnosticSeverity, code, message string) protocol.Diagnostic {
+	return protocol.Diagnostic{
+		Range:    nodeRange(node),
+		Severity: severity,
+		Message:  message,
+		Source:   "buildkite-ls",
+		Code:     code,
+	}
+}
+
+// nodeRange spans a scalar, including its quotes, or the start of a collection
+func nodeRange(node *yaml.Node) protocol.Range {
+	length := len(node.Value)
+	switch node.Style {
+	case yaml.DoubleQuotedStyle, yaml.SingleQuotedStyle:
+		length += 2
+	}
+	if node.Kind != yaml.ScalarNode {
+		length = 1
+	}
+
+	line, column := uint32(node.Line-1), uint32(node.Column-1)
+	return protocol.Range{
+		Start: protocol.Position{Line: line, Character: column},
+		End:   protocol.Position{Line: line, Character: column + uint32(length)},
+	}
+}
+
+// isSignalReason reports whether the value is one signal_reason accepts
+func isSignalReason(value string) bool {
+	for _, reason := range signalReasons {
+		if reason.Reason == value {
+			return true
+		}
+	}
+	return false
+}
+
+// signalReasonNames lists the values signal_reason accepts
+func signalReasonNames() []string {
+	names := make([]string, 0, len(signalReasons))
+	for _, reason := range signalReasons {
+		names = append(names, reason.Reason)
+	}
+	return names
+}
+
+// stringNodeValue is a scalar's value, or "" for anything else
+func stringNodeValue(node *yaml.Node) string {
+	if node == nil || node.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return node.Value
+}
+
+// isInteger reports whether the string is a whole number, e.g. a quoted exit status
+func isInteger(value string) bool {
+	_, err := strconv.Atoi(value)
+	return err == nil
+}
+
+// orUnset describes an option that may be missing
+func orUnset(value string) string {
+	if value == "" {
+		return "unset"
+	}
+	return value
+}
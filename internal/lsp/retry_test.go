@@ -0,0 +1,244 @@
+package lsp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+// retryDiagnostics returns the diagnostics raised for retry settings
+func retryDiagnostics(server *Server, content string) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+	for _, diagnostic := range server.Diagnose(content) {
+		switch diagnostic.Code {
+		case "invalid-exit-status", "invalid-retry-limit", "invalid-signal-reason", "duplicate-exit-status",
+			"invalid-manual-retry", "unshown-retry-reason":
+			diagnostics = append(diagnostics, diagnostic)
+		}
+	}
+	return diagnostics
+}
+
+func TestServer_ValidateRetry(t *testing.T) {
+	server := newTestServer()
+
+	tests := []struct {
+		name    string
+		content string
+		code    string
+		line    uint32
+		char    uint32
+		message string
+	}{
+		{
+			name:    "limit above the maximum",
+			content: "steps:\n  - command: make\n    retry:\n      automatic:\n        - exit_status: 1\n          limit: 11\n",
+			code:    "invalid-retry-limit",
+			line:    5, char: 17,
+			message: "Retry limit 11 is out of bounds",
+		},
+		{
+			name:    "limit of zero",
+			content: "steps:\n  - command: make\n    retry:\n      automatic:\n        limit: 0\n",
+			code:    "invalid-retry-limit",
+			line:    4, char: 15,
+			message: "Retry limit 0 is out of bounds",
+		},
+		{
+			name:    "quoted exit status",
+			content: "steps:\n  - command: make\n    retry:\n      automatic:\n        - exit_status: \"1\"\n          limit: 2\n",
+			code:    "invalid-exit-status",
+			line:    4, char: 23,
+			message: `exit_status "1" is a string`,
+		},
+		{
+			name:    "negative exit status",
+			content: "steps:\n  - command: make\n    retry:\n      automatic:\n        - exit_status: -2\n",
+			code:    "invalid-exit-status",
+			line:    4, char: 23,
+			message: "exit_status -2 never happens",
+		},
+		{
+			name:    "wildcard in a list",
+			content: "steps:\n  - command: make\n    retry:\n      automatic:\n        - exit_status: [1, \"*\"]\n",
+			code:    "invalid-exit-status",
+			line:    4, char: 27,
+			message: `"*" can't be part of an exit_status list`,
+		},
+		{
+			name:    "unknown signal reason",
+			content: "steps:\n  - command: make\n    retry:\n      automatic:\n        - signal_reason: killed\n",
+			code:    "invalid-signal-reason",
+			line:    4, char: 25,
+			message: `Unknown signal_reason "killed"`,
+		},
+		{
+			name:    "conflicting limits",
+			content: "steps:\n  - command: make\n    retry:\n      automatic:\n        - exit_status: -1\n          limit: 2\n        - exit_status: [1, -1]\n          limit: 3\n",
+			code:    "duplicate-exit-status",
+			line:    6, char: 27,
+			message: "exit_status -1 is already retried with limit 2 by the rule on line 5",
+		},
+		{
+			name:    "duplicate rules in a group",
+			content: "steps:\n  - group: \"Tests\"\n    steps:\n      - command: make\n        retry:\n          automatic:\n            - exit_status: \"*\"\n            - exit_status: \"*\"\n",
+			code:    "duplicate-exit-status",
+			line:    7, char: 27,
+			message: "exit_status * is already retried by the rule on line 7",
+		},
+		{
+			name:    "quoted manual retry setting",
+			content: "steps:\n  - command: make\n    retry:\n      manual:\n        permit_on_passed: \"false\"\n",
+			code:    "invalid-manual-retry",
+			line:    4, char: 26,
+			message: `retry.manual.permit_on_passed "false" is a string`,
+		},
+		{
+			name:    "unknown manual retry setting",
+			content: "steps:\n  - command: make\n    retry:\n      manual:\n        allowed: false\n        limit: 2\n",
+			code:    "invalid-manual-retry",
+			line:    5, char: 8,
+			message: "retry.manual cannot set 'limit'. It takes: allowed, permit_on_passed, reason",
+		},
+		{
+			name:    "manual retry reason that is a list",
+			content: "steps:\n  - command: make\n    retry:\n      manual:\n        allowed: false\n        reason: [deploys]\n",
+			code:    "invalid-manual-retry",
+			line:    5, char: 16,
+			message: "retry.manual.reason must be a string",
+		},
+		{
+			name:    "manual retry reason while retrying is allowed",
+			content: "steps:\n  - command: make\n    retry:\n      manual:\n        permit_on_passed: false\n        reason: Deploys only run once\n",
+			code:    "unshown-retry-reason",
+			line:    5, char: 8,
+			message: "only shown when allowed is false",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diagnostics := retryDiagnostics(server, tt.content)
+			if len(diagnostics) != 1 {
+				t.Fatalf("Expected 1 retry diagnostic, got %+v", diagnostics)
+			}
+
+			got := diagnostics[0]
+			if got.Code != tt.code {
+				t.Errorf("Expected code %s, got %v", tt.code, got.Code)
+			}
+			if got.Range.Start.Line != tt.line || got.Range.Start.Character != tt.char {
+				t.Errorf("Expected %d:%d, got %d:%d", tt.line, tt.char, got.Range.Start.Line, got.Range.Start.Character)
+			}
+			if !strings.Contains(got.Message, tt.message) {
+				t.Errorf("Expected message containing %q, got %q", tt.message, got.Message)
+			}
+		})
+	}
+}
+
+func TestServer_ValidateRetry_Valid(t *testing.T) {
+	server := newTestServer()
+
+	content := `steps:
+  - command: make
+    retry:
+      automatic:
+        - exit_status: -1
+          limit: 2
+        - exit_status: [1, 2]
+          limit: 1
+        - exit_status: "*"
+          signal_reason: agent_stop
+          limit: 10
+        - exit_status: "*"
+          signal_reason: cancel
+  - command: make test
+    retry:
+      automatic: true
+      manual:
+        allowed: false
+        permit_on_passed: false
+        reason: "Deploys only run once"
+  - command: make lint
+    retry:
+      manual: false`
+
+	if diagnostics := retryDiagnostics(server, content); len(diagnostics) != 0 {
+		t.Errorf("Expected no retry diagnostics, got %+v", diagnostics)
+	}
+}
+
+func TestCompletionProvider_RetryValues(t *testing.T) {
+	provider := newTestCompletionProvider()
+
+	tests := []struct {
+		name     string
+		content  string
+		expected []string
+	}{
+		{
+			name:     "exit_status value",
+			content:  "steps:\n  - command: make\n    retry:\n      automatic:\n        - exit_status: ",
+			expected: []string{`"*"`, "-1"},
+		},
+		{
+			name:     "signal_reason value",
+			content:  "steps:\n  - command: make\n    retry:\n      automatic:\n        - exit_status: -1\n          signal_reason: ag",
+			expected: []string{`"*"`, "none", "agent_refused", "agent_stop", "cancel", "process_run_error", "signature_rejected"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			completions := provider.GetCompletions(blockStepPositionContext(tt.content))
+
+			if len(completions) != len(tt.expected) {
+				t.Fatalf("Expected %d completions, got %d: %+v", len(tt.expected), len(completions), completions)
+			}
+			for i, label := range tt.expected {
+				if completions[i].Label != label {
+					t.Errorf("Completion %d: expected %q, got %q", i, label, completions[i].Label)
+				}
+			}
+		})
+	}
+}
+
+func TestCompletionProvider_ManualRetryKeys(t *testing.T) {
+	provider := newTestCompletionProvider()
+
+	var labels []string
+	for _, completion := range provider.GetCompletions(blockStepPositionContext("steps:\n  - command: make\n    retry:\n      manual:\n        allowed: false\n        ")) {
+		labels = append(labels, completion.Label)
+	}
+	if expected := []string{"permit_on_passed", "reason"}; strings.Join(labels, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v in retry.manual, got %v", expected, labels)
+	}
+}
+
+func TestServer_ManualRetryHover(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	server.documentManager.OpenDocument(uri, 1, "steps:\n  - command: make\n    retry:\n      manual:\n        permit_on_passed: false\n        reason: Deploys only run once\n")
+
+	for line, expected := range map[uint32]string{
+		4: "Whether the job can be retried after it passes",
+		5: "Buildkite only displays it when `allowed` is `false`",
+	} {
+		result, err := server.Hover(context.Background(), &protocol.HoverParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+				Position:     protocol.Position{Line: line, Character: 10},
+			},
+		})
+		if err != nil {
+			t.Fatalf("Hover failed: %v", err)
+		}
+		if result == nil || !strings.Contains(result.Contents.Value, expected) {
+			t.Errorf("Expected line %d documented with %q, got %+v", line, expected, result)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package lsp
+
+import (
+	"encoding/json"
+	"sync"
+
+	"go.lsp.dev/protocol"
+)
+
+// validatedStep holds the diagnostics of a single step from the last time it was validated.
+// Generated pipelines can have hundreds of steps, so on each change only the steps whose
+// content or position in the list changed are validated again.
+type validatedStep struct {
+	// Source is the step's parsed content, compared to tell whether the step changed
+	Source string
+	// Line is the line the step started on when it was validated
+	Line uint32
+
+	Structure []protocol.Diagnostic
+	Plugins   []protocol.Diagnostic
+	// SchemaUnavailable is set when a plugin's schema couldn't be looked up, so the step is
+	// validated again next time rather than keep reporting a failure that may have passed
+	SchemaUnavailable bool
+}
+
+// stepResultCache remembers the per-step results of each open document
+type stepResultCache struct {
+	mu      sync.Mutex
+	results map[protocol.DocumentURI][]validatedStep
+	// generation is bumped by clear, so results worked out before it aren't stored after it
+	generation int
+}
+
+func newStepResultCache() *stepResultCache {
+	return &stepResultCache{
+		results: make(map[protocol.DocumentURI][]validatedStep),
+	}
+}
+
+// get returns a document's results with the cache's generation, to be passed to set
+func (c *stepResultCache) get(uri protocol.DocumentURI) ([]validatedStep, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.results[uri], c.generation
+}
+
+// set stores a document's results, unless the cache was cleared since the generation
+func (c *stepResultCache) set(uri protocol.DocumentURI, steps []validatedStep, generation int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation == c.generation {
+		c.results[uri] = steps
+	}
+}
+
+func (c *stepResultCache) forget(uri protocol.DocumentURI) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.results, uri)
+}
+
+// clear drops every cached result, e.g. when settings that affect validation change
+func (c *stepResultCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.results = make(map[protocol.DocumentURI][]validatedStep)
+	c.generation++
+}
+
+// validateStepsIncrementally runs the per-step validators over each step, reusing the
+// previous result for a step at the same index whose content hasn't changed. Reused
+// diagnostics are moved to the step's new line.
+func (s *Server) validateStepsIncrementally(pipelineData map[string]interface{}, lines []string, previous []validatedStep) []validatedStep {
+	steps, ok := pipelineData["steps"].([]interface{})
+	if !ok {
+		return nil
+	}
+
+	stepLines := s.findStepLines(lines)
+	results := make([]validatedStep, 0, len(steps))
+	revalidated := 0
+
+	for stepIndex, stepItem := range steps {
+		// Get the actual line number for this step
+		lineNum := uint32(stepIndex)
+		if stepIndex < len(stepLines) {
+			lineNum = uint32(stepLines[stepIndex])
+		}
+
+		source, err := json.Marshal(stepItem)
+		if err != nil {
+			source = nil
+		}
+
+		// Step numbers appear in messages, so results are only reused at the same index
+		if stepIndex < len(previous) && source != nil && previous[stepIndex].Source == string(source) && !previous[stepIndex].SchemaUnavailable {
+			cached := previous[stepIndex]
+			results = append(results, validatedStep{
+				Source:    cached.Source,
+				Line:      lineNum,
+				Structure: shiftDiagnostics(cached.Structure, int(lineNum)-int(cached.Line)),
+				Plugins:   shiftDiagnostics(cached.Plugins, int(lineNum)-int(cached.Line)),
+			})
+			continue
+		}
+
+		step := validatedStep{Source: string(source), Line: lineNum}
+		if stepData, ok := stepItem.(map[string]interface{}); ok {
+			step.Structure = s.validateSingleStep(stepData, lineNum, stepIndex+1)
+			step.Plugins, step.SchemaUnavailable = s.validateStepPlugins(stepData, lineNum)
+		}
+		results = append(results, step)
+		revalidated++
+	}
+
+	if previous != nil {
+		s.logger.Printf("Revalidated %d of %d steps", revalidated, len(steps))
+	}
+
+	return results
+}
+
+// shiftDiagnostics returns copies of the diagnostics moved down by delta lines
+func shiftDiagnostics(diagnostics []protocol.Diagnostic, delta int) []protocol.Diagnostic {
+	if delta == 0 || len(diagnostics) == 0 {
+		return diagnostics
+	}
+
+	shifted := make([]protocol.Diagnostic, len(diagnostics))
+	for i, diagnostic := range diagnostics {
+		diagnostic.Range.Start.Line = uint32(int(diagnostic.Range.Start.Line) + delta)
+		diagnostic.Range.End.Line = uint32(int(diagnostic.Range.End.Line) + delta)
+		shifted[i] = diagnostic
+	}
+	return shifted
+}
@@ -0,0 +1,134 @@
+package lsp
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+
+	"github.com/mcncl/buildkite-ls/internal/plugins"
+)
+
+const revalidationPipeline = `steps:
+  - command: "make build"
+  - label: "Test"
+    command: "make test"
+  - command: "make deploy"`
+
+func TestServer_DiagnoseRevalidatesChangedSteps(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///.buildkite/pipeline.yml")
+
+	first := server.diagnose(uri, revalidationPipeline)
+	if !reflect.DeepEqual(first, server.Diagnose(revalidationPipeline)) {
+		t.Fatalf("Cached validation differs from full validation:\n%+v\n%+v", first, server.Diagnose(revalidationPipeline))
+	}
+
+	// Mark the cached result of the last step so a reuse can be told apart from a revalidation
+	steps, _ := server.stepResults.get(uri)
+	if len(steps) != 3 {
+		t.Fatalf("Expected 3 cached steps, got %d", len(steps))
+	}
+	steps[2].Structure = []protocol.Diagnostic{{
+		Range:   protocol.Range{Start: protocol.Position{Line: 4}, End: protocol.Position{Line: 4}},
+		Message: "cached",
+	}}
+
+	// Adding a label to the first step pushes the others down a line
+	changed := `steps:
+  - label: "Build"
+    command: "make build"
+  - label: "Test"
+    command: "make test"
+  - command: "make deploy"`
+
+	diagnostics := server.diagnose(uri, changed)
+
+	var cached *protocol.Diagnostic
+	for i, diagnostic := range diagnostics {
+		if diagnostic.Code == "missing-label" && diagnostic.Range.Start.Line == 1 {
+			t.Errorf("The labelled first step should have been revalidated: %+v", diagnostic)
+		}
+		if diagnostic.Message == "cached" {
+			cached = &diagnostics[i]
+		}
+	}
+
+	if cached == nil {
+		t.Fatalf("Expected the unchanged last step to reuse its cached diagnostics, got %+v", diagnostics)
+	}
+	if cached.Range.Start.Line != 5 {
+		t.Errorf("Expected the reused diagnostic to move to line 5, got %d", cached.Range.Start.Line)
+	}
+}
+
+func TestServer_DiagnoseMatchesFullValidation(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///.buildkite/pipeline.yml")
+
+	versions := []string{
+		revalidationPipeline,
+		`steps:
+  - command: "make build"
+  - wait
+  - label: "Test"
+    command: "make test"
+  - command: "make deploy"`,
+		`steps:
+  - command: "make build"
+  - label: "Test"
+    command: ""`,
+	}
+
+	for i, content := range versions {
+		incremental := server.diagnose(uri, content)
+		full := server.Diagnose(content)
+		if !reflect.DeepEqual(incremental, full) {
+			t.Errorf("Version %d: incremental diagnostics differ from full validation:\n%+v\n%+v", i, incremental, full)
+		}
+	}
+
+	server.stepResults.forget(uri)
+	if steps, _ := server.stepResults.get(uri); steps != nil {
+		t.Errorf("Expected forgotten document to have no cached steps, got %d", len(steps))
+	}
+}
+
+func TestServer_DiagnoseRevalidatesStepsWithoutSchemas(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///.buildkite/pipeline.yml")
+	plugin := "my-org/#v1.0.0" // has no name, so its schema can't be looked up
+	content := "steps:\n  - label: \"Build\"\n    command: make\n    plugins:\n      - " + plugin + ": ~\n"
+
+	hasSchemaError := func(diagnostics []protocol.Diagnostic) bool {
+		for _, diagnostic := range diagnostics {
+			if strings.Contains(diagnostic.Message, "failed to get schema") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !hasSchemaError(server.diagnose(uri, content)) {
+		t.Fatal("Expected the schema lookup to fail")
+	}
+	if steps, _ := server.stepResults.get(uri); len(steps) != 1 || !steps[0].SchemaUnavailable {
+		t.Fatalf("Expected the step marked for validation again, got %+v", steps)
+	}
+
+	// Storing a schema drops every cached result, including ones stored too late to see it
+	_, generation := server.stepResults.get(uri)
+	server.pluginRegistry.CacheSchema(plugin, &plugins.PluginSchema{Name: "private"})
+	if steps, _ := server.stepResults.get(uri); steps != nil {
+		t.Errorf("Expected cached steps dropped once a schema was stored, got %+v", steps)
+	}
+	server.stepResults.set(uri, []validatedStep{{Source: "stale"}}, generation)
+	if steps, _ := server.stepResults.get(uri); steps != nil {
+		t.Errorf("Expected results from before the schema was stored to be ignored, got %+v", steps)
+	}
+
+	if diagnostics := server.diagnose(uri, content); hasSchemaError(diagnostics) {
+		t.Errorf("Expected the step validated against the stored schema, got %+v", diagnostics)
+	}
+}
@@ -0,0 +1,104 @@
+package lsp
+
+import (
+	"fmt"
+	"strings"
+
+	"go.lsp.dev/protocol"
+
+	bkcontext "github.com/mcncl/buildkite-ls/internal/context"
+	"github.com/mcncl/buildkite-ls/internal/schema"
+)
+
+// schemaFieldNote marks docs taken from the bundled schema, for keys written docs don't cover
+// yet, such as fields added upstream since
+const schemaFieldNote = "_From the pipeline schema. There are no detailed docs for this field here yet._"
+
+// unofferedSchemaKeys are schema keys completions leave out: aliases of key and label, and
+// type, which the step type keys make unnecessary
+var unofferedSchemaKeys = map[string]bool{"id": true, "identifier": true, "name": true, "type": true}
+
+// schemaStepKeys returns the keys the bundled schema allows on a step of the type
+func schemaStepKeys(stepType string) map[string]bool {
+	keys := make(map[string]bool)
+	for _, property := range schema.NewLoader().StepProperties(stepType) {
+		keys[property.Name] = true
+	}
+	return keys
+}
+
+// schemaProperty finds a key among the pipeline's top-level keys or, elsewhere, among the
+// keys of any step type, preferring one with a description
+func schemaProperty(loader *schema.Loader, name string, topLevel bool) (schema.Property, bool) {
+	candidates := loader.PipelineProperties()
+	if !topLevel {
+		candidates = nil
+		for _, stepType := range []string{"command", "trigger", "group", "block", "input", "wait"} {
+			candidates = append(candidates, loader.StepProperties(stepType)...)
+		}
+	}
+
+	var found schema.Property
+	var ok bool
+	for _, property := range candidates {
+		if property.Name == name && (!ok || found.Description == "") {
+			found, ok = property, true
+		}
+	}
+	return found, ok
+}
+
+// getSchemaPropertyHoverContent documents a pipeline or step key from the bundled schema, so
+// fields added to the schema get docs before they're written here. Keys the schema has
+// no description for are still marked as known fields rather than unknown ones.
+func (s *Server) getSchemaPropertyHoverContent(property string, contextInfo *bkcontext.ContextInfo) string {
+	if !contextInfo.IsAtTopLevel() && !contextInfo.IsInStepContext() {
+		return ""
+	}
+	found, ok := schemaProperty(s.schemaLoader, property, contextInfo.IsAtTopLevel())
+	if !ok {
+		return ""
+	}
+
+	if found.Description == "" {
+		return fmt.Sprintf("**%s** - New field, no docs yet\n\nThe pipeline schema allows `%s`, but doesn't describe it yet.\n\n[Buildkite Documentation](https://buildkite.com/docs/pipelines/configure/defining-steps)", property, property)
+	}
+	return fmt.Sprintf("**%s** - %s\n\n%s\n\n[Buildkite Documentation](https://buildkite.com/docs/pipelines/configure/defining-steps)", property, found.Description, schemaFieldNote)
+}
+
+// withSchemaProperties adds the schema's keys missing from written completion items, so keys
+// added to the schema are offered as soon as it's updated
+func withSchemaProperties(items []protocol.CompletionItem, properties []schema.Property) []protocol.CompletionItem {
+	offered := make(map[string]bool, len(items))
+	for _, item := range items {
+		offered[item.Label] = true
+	}
+
+	for _, property := range properties {
+		if offered[property.Name] || unofferedSchemaKeys[property.Name] {
+			continue
+		}
+		detail := "Pipeline schema field"
+		if property.Description != "" {
+			detail, _, _ = strings.Cut(property.Description, ". ")
+		}
+		items = append(items, protocol.CompletionItem{
+			Label:         property.Name,
+			Kind:          protocol.CompletionItemKindProperty,
+			Detail:        detail,
+			Documentation: &protocol.MarkupContent{Kind: protocol.Markdown, Value: strings.TrimSpace(property.Description + "\n\n" + schemaFieldNote)},
+			InsertText:    property.Name + ": ",
+		})
+	}
+	return items
+}
+
+// getSchemaStepCompletions adds the keys the schema allows on the enclosing step to the
+// written step completions. Steps without a type yet are command steps.
+func (cp *CompletionProvider) getSchemaStepCompletions(items []protocol.CompletionItem, posCtx *bkcontext.PositionContext) []protocol.CompletionItem {
+	stepType := enclosingStepType(splitLines(posCtx.FullContent), int(posCtx.Position.Line))
+	if stepType == "" {
+		stepType = "command"
+	}
+	return withSchemaProperties(items, cp.schemaLoader.StepProperties(stepType))
+}
@@ -0,0 +1,90 @@
+package lsp
+
+import (
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+
+	bkcontext "github.com/mcncl/buildkite-ls/internal/context"
+	"github.com/mcncl/buildkite-ls/internal/schema"
+)
+
+func TestWithSchemaProperties(t *testing.T) {
+	written := []protocol.CompletionItem{{Label: "label", Detail: "Step label"}}
+	properties := []schema.Property{
+		{Name: "label", Description: "The label"},
+		{Name: "idempotency_key", Description: "A key making the step idempotent. Longer explanation"},
+		{Name: "hosted_cache", Description: ""},
+		{Name: "identifier", Description: "A string identifier"},
+	}
+
+	items := withSchemaProperties(written, properties)
+	var labels []string
+	for _, item := range items {
+		labels = append(labels, item.Label)
+	}
+	if strings.Join(labels, ",") != "label,idempotency_key,hosted_cache" {
+		t.Fatalf("Expected the new fields after the written ones, got %v", labels)
+	}
+	if items[0].Detail != "Step label" {
+		t.Errorf("Expected the written item to be kept, got %+v", items[0])
+	}
+	if items[1].Detail != "A key making the step idempotent" || items[1].InsertText != "idempotency_key: " {
+		t.Errorf("Expected the first sentence as the detail, got %+v", items[1])
+	}
+	if items[2].Detail != "Pipeline schema field" {
+		t.Errorf("Expected a generic detail without a description, got %+v", items[2])
+	}
+}
+
+func TestCompletionProvider_SchemaStepProperties(t *testing.T) {
+	provider := newTestCompletionProvider()
+
+	labels := func(content string) map[string]bool {
+		found := make(map[string]bool)
+		for _, item := range provider.GetCompletions(blockStepPositionContext(content)) {
+			found[item.Label] = true
+		}
+		return found
+	}
+
+	command := labels("steps:\n  - command: make\n    ")
+	for _, key := range []string{"secrets", "env", "priority"} {
+		if !command[key] {
+			t.Errorf("Expected command steps to offer %s from the schema", key)
+		}
+	}
+	if command["identifier"] || command["type"] {
+		t.Error("Did not expect aliases or type to be offered")
+	}
+
+	if trigger := labels("steps:\n  - trigger: deploy\n    "); trigger["secrets"] || !trigger["async"] {
+		t.Errorf("Expected trigger steps to be offered only trigger keys, got %v", trigger)
+	}
+}
+
+func TestServer_SchemaPropertyHover(t *testing.T) {
+	server := newTestServer()
+	step := &bkcontext.ContextInfo{Type: bkcontext.ContextStep}
+
+	tests := []struct {
+		property string
+		contains []string
+	}{
+		{"priority", []string{"**priority** - Priority of the job", schemaFieldNote}},
+		{"secrets", []string{"**secrets** - New field, no docs yet"}},
+		{"unknown_prop", []string{"No specific documentation available"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.property, func(t *testing.T) {
+			content := server.getPropertyHoverContent(tt.property, step)
+			for _, want := range tt.contains {
+				if !strings.Contains(content, want) {
+					t.Errorf("Expected hover to contain %q, got:\n%s", want, content)
+				}
+			}
+		})
+	}
+}
@@ -285,6 +285,7 @@ func TestServer_SemanticTokensHelpers(t *testing.T) {
 			{"namespace", 5},
 			{"operator", 6},
 			{"comment", 7},
+			{"struct", 8},
 			{"unknown", 0}, // should default to keyword
 		}
 
@@ -332,6 +333,8 @@ func TestServer_SemanticTokensHelpers(t *testing.T) {
 			{"env", false, "variable"},
 			{"plugins", true, "function"},
 			{"docker#v5.13.0", true, "function"},
+			{"ssh://git@github.com/my-org/deploy.git#v1.0", true, "function"},
+			{"my.plugin#v1", true, "function"},
 			{"timeout_in_minutes", true, "property"},
 			{"unknown_prop", true, "property"},
 		}
@@ -3,15 +3,21 @@ package lsp
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"go.lsp.dev/jsonrpc2"
 	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
 
 	bkcontext "github.com/mcncl/buildkite-ls/internal/context"
 	"github.com/mcncl/buildkite-ls/internal/parser"
@@ -19,18 +25,53 @@ import (
 	"github.com/mcncl/buildkite-ls/internal/schema"
 )
 
+// serverVersion is the version reported to clients
+const serverVersion = "0.1.0"
+
 type Server struct {
 	client             protocol.Client
 	logger             *log.Logger
+	logs               *requestLog
 	schemaLoader       *schema.Loader
 	pluginRegistry     *plugins.Registry
 	documentManager    *DocumentManager
 	completionProvider *CompletionProvider
+	stepResults        *stepResultCache
+	stepKeys           *stepKeyHistory
+	workspaceIndex     *workspaceIndex
+	usage              *usageRecorder
+	completionDocs     *completionDocCache
+	published          *publishedDiagnostics
 	conn               jsonrpc2.Conn
+
+	settingsMu     sync.RWMutex
+	settings       Settings
+	clientFeatures ClientFeatures
+	workspaceRoots []string
+	// initializationOptions are the settings sent with initialize, which pulled
+	// configuration is layered over
+	initializationOptions interface{}
+	// cancelWorkspaceValidation stops the workspace validation running in the background
+	cancelWorkspaceValidation context.CancelFunc
+
+	// pipelineDocuments are open documents marked as pipelines whatever their URI
+	pipelineDocuments map[protocol.DocumentURI]bool
+	// oversizedDocuments are the documents the user has been warned are over the size limits
+	oversizedDocuments map[protocol.DocumentURI]bool
+	// pluginFetchWarnings are the plugins the user has been told had schemas fail to load
+	pluginFetchWarnings map[string]bool
+	// externalValidatorWarnings are the validator commands the user has been told failed
+	externalValidatorWarnings map[string]bool
+
+	// popularPlugins serves the plugins offered when completing plugin names, and
+	// stopPopularRefresh stops keeping it and the plugin schemas current
+	popularPlugins     *plugins.PopularChannel
+	stopPopularRefresh func()
 }
 
 func NewServer() *Server {
 	pluginRegistry := plugins.NewRegistry()
+	pluginRegistry.SetSchemaCacheDir(plugins.DefaultSchemaCacheDir())
 
 	// Create debug log file
 	debugFile, err := os.OpenFile("/tmp/buildkite-ls-debug.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o666)
@@ -38,15 +79,38 @@ func NewServer() *Server {
 		debugFile = os.Stderr // Fallback to stderr
 	}
 
-	logger := log.New(debugFile, "[buildkite-ls] ", log.LstdFlags|log.Lshortfile)
-
-	return &Server{
-		logger:             logger,
-		schemaLoader:       schema.NewLoader(),
-		pluginRegistry:     pluginRegistry,
-		documentManager:    NewDocumentManager(),
-		completionProvider: NewCompletionProvider(pluginRegistry, logger),
-	}
+	logs := newRequestLog(debugFile)
+	logger := log.New(logs, "[buildkite-ls] ", log.LstdFlags|log.Lshortfile)
+
+	popularPlugins := plugins.NewPopularChannel(plugins.DefaultPopularCachePath(), popularPluginsRefreshInterval)
+	completionProvider := NewCompletionProvider(pluginRegistry, logger)
+	completionProvider.SetPopularPlugins(popularPlugins)
+
+	server := &Server{
+		logger:                    logger,
+		logs:                      logs,
+		schemaLoader:              schema.NewLoader(),
+		pluginRegistry:            pluginRegistry,
+		documentManager:           NewDocumentManager(),
+		completionProvider:        completionProvider,
+		stepResults:               newStepResultCache(),
+		stepKeys:                  newStepKeyHistory(),
+		workspaceIndex:            newWorkspaceIndex(),
+		usage:                     newUsageRecorder(),
+		completionDocs:            newCompletionDocCache(),
+		published:                 newPublishedDiagnostics(),
+		settings:                  DefaultSettings(),
+		clientFeatures:            DefaultClientFeatures(),
+		pipelineDocuments:         make(map[protocol.DocumentURI]bool),
+		oversizedDocuments:        make(map[protocol.DocumentURI]bool),
+		pluginFetchWarnings:       make(map[string]bool),
+		externalValidatorWarnings: make(map[string]bool),
+		popularPlugins:            popularPlugins,
+	}
+	pluginRegistry.OnFetchFailure(server.warnPluginFetchFailure)
+	// Steps validated without a schema, or against an older one, are validated again
+	pluginRegistry.OnSchemaStored(func(string) { server.stepResults.clear() })
+	return server
 }
 
 func (s *Server) SetClient(client protocol.Client) {
@@ -61,68 +125,154 @@ func (s *Server) Logger() *log.Logger {
 	return s.logger
 }
 
+// Settings returns the current server settings
+func (s *Server) Settings() Settings {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
+	return s.settings
+}
+
+// SetSettings replaces the current server settings
+func (s *Server) SetSettings(settings Settings) {
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+	s.settings = settings
+}
+
+// ClientFeatures returns the optional features the client declared support for
+func (s *Server) ClientFeatures() ClientFeatures {
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
+	return s.clientFeatures
+}
+
+// SetClientFeatures replaces the features the client declared support for
+func (s *Server) SetClientFeatures(features ClientFeatures) {
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+	s.clientFeatures = features
+}
+
+// applySettings stores new settings and pushes them to the components that use them
+func (s *Server) applySettings(settings Settings) {
+	s.SetSettings(settings)
+	s.pluginRegistry.SetAliases(settings.PluginAliases)
+	s.completionProvider.SetTeams(settings.Teams)
+	s.popularPlugins.SetPinned(settings.PinPopularPlugins)
+	// Plugin aliases change how steps validate, so nothing cached can be reused
+	s.stepResults.clear()
+	// Pipeline file patterns and size limits change which workspace files are read
+	s.workspaceIndex.invalidate()
+}
+
 func (s *Server) Initialize(ctx context.Context, params *protocol.InitializeParams) (*protocol.InitializeResult, error) {
 	s.logger.Printf("Initializing buildkite-ls server")
+	s.logger.Printf("Using pipeline schema %s", s.schemaLoader.Version())
+
+	s.settingsMu.Lock()
+	s.initializationOptions = params.InitializationOptions
+	s.settingsMu.Unlock()
+	s.applySettings(parseSettings(params.InitializationOptions))
+
+	features := parseClientFeatures(params.Capabilities)
+	s.SetClientFeatures(features)
+	s.logger.Printf("Client features: %+v", features)
+
+	s.SetWorkspaceRoots(workspaceRootsFromParams(params))
 
 	completionOptions := &protocol.CompletionOptions{
-		TriggerCharacters: []string{" ", ":", "-"},
+		TriggerCharacters: []string{" ", ":", "-", "/"},
+		// Documentation can be left out of completion lists and resolved per item
+		ResolveProvider: true,
 	}
 
 	s.logger.Printf("Advertising completion capabilities with triggers: %v", completionOptions.TriggerCharacters)
 
-	return &protocol.InitializeResult{
-		Capabilities: protocol.ServerCapabilities{
-			TextDocumentSync: &protocol.TextDocumentSyncOptions{
-				OpenClose: true,
-				Change:    protocol.TextDocumentSyncKindFull,
+	capabilities := protocol.ServerCapabilities{
+		TextDocumentSync: &protocol.TextDocumentSyncOptions{
+			OpenClose: true,
+			Change:    protocol.TextDocumentSyncKindFull,
+		},
+		HoverProvider:          true,
+		CompletionProvider:     completionOptions,
+		DocumentSymbolProvider: true,
+		DefinitionProvider:     true,
+		DocumentLinkProvider:   &protocol.DocumentLinkOptions{},
+		// Typing Enter after `command: |` indents the new line into the block
+		DocumentOnTypeFormattingProvider: &protocol.DocumentOnTypeFormattingOptions{
+			FirstTriggerCharacter: "\n",
+		},
+		WorkspaceSymbolProvider: true,
+		CodeActionProvider: &protocol.CodeActionOptions{
+			CodeActionKinds: []protocol.CodeActionKind{
+				protocol.QuickFix,
+				protocol.Refactor,
+				protocol.RefactorRewrite,
+				protocol.RefactorExtract,
 			},
-			HoverProvider:          true,
-			CompletionProvider:     completionOptions,
-			DocumentSymbolProvider: true,
-			DefinitionProvider:     true,
-			CodeActionProvider: &protocol.CodeActionOptions{
-				CodeActionKinds: []protocol.CodeActionKind{
-					protocol.QuickFix,
-					protocol.Refactor,
-					protocol.RefactorRewrite,
+		},
+		ExecuteCommandProvider: &protocol.ExecuteCommandOptions{
+			Commands: []string{ExtractScriptCommand, ImportCommand, InsertWaitAfterStepCommand, InsertBlockAfterStepCommand, SelectRangeCommand, ToggleSkipCommand, ExplainDiagnosticCommand},
+		},
+	}
+
+	// Only advertise providers the client can make use of
+	if features.FoldingRanges {
+		capabilities.FoldingRangeProvider = true
+	}
+
+	if features.SemanticTokens {
+		capabilities.SemanticTokensProvider = map[string]interface{}{
+			"legend": map[string]interface{}{
+				"tokenTypes": []string{
+					"keyword",   // step types (command, wait, block, etc.)
+					"string",    // labels, commands, values
+					"property",  // YAML property keys
+					"variable",  // environment variables
+					"function",  // plugin names
+					"namespace", // step keys for reference
+					"operator",  // YAML operators like :, -, |
+					"comment",   // YAML comments
+					"struct",    // raw Kubernetes keys inside podSpec blocks
 				},
-			},
-			SemanticTokensProvider: map[string]interface{}{
-				"legend": map[string]interface{}{
-					"tokenTypes": []string{
-						"keyword",   // step types (command, wait, block, etc.)
-						"string",    // labels, commands, values
-						"property",  // YAML property keys
-						"variable",  // environment variables
-						"function",  // plugin names
-						"namespace", // step keys for reference
-						"operator",  // YAML operators like :, -, |
-						"comment",   // YAML comments
-					},
-					"tokenModifiers": []string{
-						"definition", // when defining a step or plugin
-						"readonly",   // for immutable values
-						"deprecated", // for deprecated properties
-					},
+				"tokenModifiers": []string{
+					"definition", // when defining a step or plugin
+					"readonly",   // for immutable values
+					"deprecated", // for deprecated properties
 				},
-				"range": true,
-				"full":  true,
 			},
-		},
+			"range": true,
+			"full":  true,
+		}
+	}
+
+	return &protocol.InitializeResult{
+		Capabilities: capabilities,
 		ServerInfo: &protocol.ServerInfo{
 			Name:    "buildkite-ls",
-			Version: "0.1.0",
+			Version: serverVersion,
 		},
 	}, nil
 }
 
 func (s *Server) Initialized(ctx context.Context, params *protocol.InitializedParams) error {
 	s.logger.Printf("Server initialized - ready to receive document events")
+
+	// Settings in the client's configuration override the initialization options. The
+	// workspace is validated once they're applied.
+	if !s.refreshConfiguration() && s.Settings().WorkspaceDiagnostics {
+		s.validateWorkspaceInBackground()
+	}
+	go s.registerFileWatchers(context.Background())
+	s.startPopularPluginsRefresh()
 	return nil
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
 	s.logger.Printf("Server shutting down")
+	// Report what's left of the current usage batch rather than dropping it
+	s.flushUsage(ctx, true)
+	s.stopPopularPluginsRefresh()
 	return nil
 }
 
@@ -134,27 +284,38 @@ func (s *Server) Exit(ctx context.Context) error {
 func (s *Server) DidOpen(ctx context.Context, params *protocol.DidOpenTextDocumentParams) error {
 	s.logger.Printf("Document opened: %s", params.TextDocument.URI)
 	s.logger.Printf("Document language: %s", params.TextDocument.LanguageID)
+
+	// Documents in a pipeline language are pipelines wherever they live
+	if slices.Contains(s.Settings().PipelineLanguageIDs, string(params.TextDocument.LanguageID)) {
+		s.setPipelineDocument(params.TextDocument.URI, true)
+	}
 	s.logger.Printf("Is Buildkite file: %t", s.isBuildkiteFile(string(params.TextDocument.URI)))
+	if variant := pipelineVariant(string(params.TextDocument.URI)); variant != "" {
+		s.logger.Printf("Pipeline variant: %s", variant)
+	}
 
 	// Store document content
 	s.documentManager.OpenDocument(params.TextDocument.URI, params.TextDocument.Version, params.TextDocument.Text)
+	s.workspaceIndex.markStale(params.TextDocument.URI)
+
+	// Start fetching plugin schemas before validation, which then waits on them together
+	s.prefetchPluginSchemas(params.TextDocument.URI, params.TextDocument.Text)
 
 	// Validate the document
 	s.validateDocument(ctx, params.TextDocument.URI, params.TextDocument.Text)
 	return nil
 }
 
-func (s *Server) DidChange(ctx context.Context, params *protocol.DidChangeTextDocumentParams) error {
+func (s *Server) DidChange(ctx context.Context, params *DidChangeParams) error {
 	s.logger.Printf("Document changed: %s", params.TextDocument.URI)
 
 	if len(params.ContentChanges) > 0 {
-		lastChange := params.ContentChanges[len(params.ContentChanges)-1]
-
-		// Update document content
-		s.documentManager.UpdateDocument(params.TextDocument.URI, params.TextDocument.Version, lastChange.Text)
+		// Clients can batch several changes, each applying to the result of the one before
+		content := s.documentManager.ApplyChanges(params.TextDocument.URI, params.TextDocument.Version, params.ContentChanges)
+		s.workspaceIndex.markStale(params.TextDocument.URI)
 
 		// Validate the updated document
-		s.validateDocument(ctx, params.TextDocument.URI, lastChange.Text)
+		s.validateDocument(ctx, params.TextDocument.URI, content)
 	}
 	return nil
 }
@@ -164,6 +325,12 @@ func (s *Server) DidClose(ctx context.Context, params *protocol.DidCloseTextDocu
 
 	// Remove document from cache
 	s.documentManager.CloseDocument(params.TextDocument.URI)
+	s.workspaceIndex.markStale(params.TextDocument.URI)
+	s.stepResults.forget(params.TextDocument.URI)
+	s.stepKeys.forget(params.TextDocument.URI)
+	s.published.forget(params.TextDocument.URI)
+	s.setPipelineDocument(params.TextDocument.URI, false)
+	s.revalidateClosedDocument(ctx, params.TextDocument.URI)
 	return nil
 }
 
@@ -179,20 +346,20 @@ func (s *Server) Hover(ctx context.Context, params *protocol.HoverParams) (*prot
 		return nil, nil
 	}
 
-	hoverContent := s.getContextualHoverContent(posCtx)
+	hoverContent := s.getContextualHoverContent(ctx, posCtx)
 	if hoverContent == "" {
 		return nil, nil // No hover content available
 	}
 
 	return &protocol.Hover{
-		Contents: protocol.MarkupContent{
+		Contents: adaptMarkupContent(protocol.MarkupContent{
 			Kind:  protocol.Markdown,
 			Value: hoverContent,
-		},
+		}, s.ClientFeatures().HoverMarkdown),
 	}, nil
 }
 
-func (s *Server) getContextualHoverContent(posCtx *bkcontext.PositionContext) string {
+func (s *Server) getContextualHoverContent(ctx context.Context, posCtx *bkcontext.PositionContext) string {
 	if posCtx == nil {
 		return ""
 	}
@@ -202,13 +369,104 @@ func (s *Server) getContextualHoverContent(posCtx *bkcontext.PositionContext) st
 
 	// Extract the word/property at cursor position
 	currentWord := s.extractWordAtPosition(posCtx)
+
+	// Conditionals show how they evaluate; the key itself keeps its docs above the table
+	if yamlKey(posCtx.CurrentLine) == "if" {
+		evaluation := s.getConditionalHoverContent(posCtx)
+		if evaluation != "" && s.enclosingStepIsWait(splitLines(posCtx.FullContent), int(posCtx.Position.Line)) {
+			evaluation = waitConditionNote + "\n\n" + evaluation
+		}
+		if posCtx.CharIndex > strings.Index(posCtx.CurrentLine, ":") {
+			return evaluation
+		}
+		if currentWord == "if" && evaluation != "" {
+			return s.getPropertyHoverContent(currentWord, contextInfo) + "\n\n" + evaluation
+		}
+	}
+
+	// Wait steps explain the ordering they imply
+	if currentWord == "wait" && isWaitLine(posCtx.CurrentLine) {
+		return s.getPropertyHoverContent(currentWord, contextInfo) + "\n\n" + waitFormDescription(posCtx.CurrentLine) +
+			"\n\n" + s.getWaitHoverContent(posCtx)
+	}
+
+	// continue_on_failure only means something on a wait step
+	if currentWord == "continue_on_failure" && yamlKey(posCtx.CurrentLine) == currentWord {
+		return s.getContinueOnFailureHoverContent(posCtx)
+	}
+
+	// A trigger step's build takes its own keys, which aren't step keys
+	if content, ok := getTriggerBuildHoverContent(posCtx, currentWord, contextInfo); ok {
+		return content
+	}
+
+	// retry.manual's settings aren't step keys either
+	if content, ok := getManualRetryHoverContent(posCtx, currentWord, contextInfo); ok {
+		return content
+	}
+
+	// The docker plugin's most used options have docs beyond its schema's
+	if content := s.getDockerPluginHoverContent(posCtx, currentWord, contextInfo); content != "" {
+		return content
+	}
+
+	// blocked_state describes each state's effect, and branches what it means on a block step
+	if content := s.getBlockStepHoverContent(posCtx, currentWord, contextInfo); content != "" {
+		return content
+	}
+
+	// Template references describe the template the step extends
+	if template := s.getTemplateHoverContent(posCtx); template != "" {
+		return template
+	}
+
+	// Upload commands describe the pipeline file they upload
+	if upload := getUploadHoverContent(posCtx.ContextLines, posCtx.Position); upload != "" {
+		return upload
+	}
+
+	// Timeouts, parallelism and concurrency say what their value works out to
+	if numeric := s.getNumericValueHoverContent(posCtx); numeric != "" {
+		return numeric
+	}
+
+	// Interpolations in agent requirements say when they are substituted
+	if content := s.getAgentInterpolationHoverContent(posCtx); content != "" {
+		return content
+	}
+
+	// Plugin references, including git URLs and paths that aren't a single word
+	if contextInfo.IsInPluginsArray() {
+		if ref := pluginReferenceAtCursor(posCtx); ref != "" {
+			content := s.getPluginHoverContent(ctx, ref)
+			if note := s.getDuplicatePluginHoverNote(splitLines(posCtx.FullContent), int(posCtx.Position.Line)); note != "" {
+				content = strings.TrimRight(content, "\n") + "\n\n" + note
+			}
+			return content
+		}
+	}
+
 	if currentWord == "" {
 		return ""
 	}
 
-	// Check if hovering over a plugin reference
-	if strings.Contains(currentWord, "#") && contextInfo.IsInPluginsArray() {
-		return s.getPluginHoverContent(currentWord)
+	// Top-level keys of variant files say which variant they belong to
+	if variant := pipelineVariant(string(posCtx.URI)); variant != "" && s.getIndentLevel(posCtx.CurrentLine) == 0 {
+		if content := s.getPropertyHoverContent(currentWord, contextInfo); content != "" {
+			return content + fmt.Sprintf("\n\n_Pipeline variant: **%s**_", variant)
+		}
+	}
+
+	// Agent tags explain how steps target agents
+	if content := s.getAgentTagHoverContent(posCtx, currentWord); content != "" {
+		return content
+	}
+
+	// A step's plugins key summarises the plugins it lists below its docs
+	if currentWord == "plugins" && yamlKey(posCtx.CurrentLine) == "plugins" {
+		if summary := s.getPluginsSummaryHoverContent(posCtx); summary != "" {
+			return s.getPropertyHoverContent(currentWord, contextInfo) + "\n\n" + summary
+		}
 	}
 
 	// Provide property-specific documentation
@@ -246,18 +504,46 @@ func (s *Server) extractWordAtPosition(posCtx *bkcontext.PositionContext) string
 	return strings.TrimSuffix(word, ":")
 }
 
+// pluginReferenceAtCursor returns the key of a plugins entry when the cursor is on it
+func pluginReferenceAtCursor(posCtx *bkcontext.PositionContext) string {
+	line := posCtx.CurrentLine
+	start := indentOf(line)
+	if strings.HasPrefix(line[start:], "- ") {
+		start += 2
+		for start < len(line) && line[start] == ' ' {
+			start++
+		}
+	}
+
+	colon := bkcontext.KeyColon(line[start:])
+	if colon <= 0 || posCtx.CharIndex < start || posCtx.CharIndex >= start+colon {
+		return ""
+	}
+	return strings.Trim(strings.TrimSpace(line[start:start+colon]), `"'`)
+}
+
 func isAlphanumeric(b byte) bool {
 	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9') || b == '.' || b == '@'
 }
 
-func (s *Server) getPluginHoverContent(pluginName string) string {
-	schema, err := s.pluginRegistry.GetPluginSchema(pluginName)
+func (s *Server) getPluginHoverContent(ctx context.Context, pluginName string) string {
+	schema, err := s.pluginRegistry.GetPluginSchema(ctx, pluginName)
 	if err != nil {
 		return fmt.Sprintf("Plugin: %s\n\nUnable to load plugin information.", pluginName)
 	}
 
 	content := fmt.Sprintf("# %s Plugin\n\n%s\n\n", schema.Name, schema.Description)
 
+	if resolved := s.pluginRegistry.ResolveAlias(pluginName); resolved != pluginName {
+		content += fmt.Sprintf("**Alias for**: `%s`\n\n", resolved)
+	}
+
+	// Only GitHub plugins have a schema to fetch, so say where the others come from
+	if parsed := plugins.ParsePluginReference(s.pluginRegistry.ResolveAlias(pluginName)); parsed != nil && !parsed.IsGitHub() {
+		content += fmt.Sprintf("**Source**: `%s` (version `%s`)\n\n", parsed.GetRepositoryURL(), parsed.Version)
+		content += "Its plugin.yml isn't fetched from outside GitHub, so its configuration isn't checked.\n\n"
+	}
+
 	if schema.Author != "" {
 		content += fmt.Sprintf("**Author**: %s\n\n", schema.Author)
 	}
@@ -292,20 +578,25 @@ func (s *Server) getPropertyHoverContent(property string, contextInfo *bkcontext
 		"plugins": "**plugins** - List of plugins to enhance the step\n\nEach plugin provides additional functionality like Docker support, caching, or artifact management. Plugins are specified with their name and version.\n\n[Plugin Directory](https://buildkite.com/plugins)",
 
 		// Advanced step properties
-		"depends_on":         "**depends_on** - Step dependencies\n\nSpecifies which steps must complete before this step runs. Can reference steps by label or use step keys.\n\nExample:\n```yaml\ndepends_on:\n  - \"build\"\n  - step: \"test\"\n    allow_failure: true\n```",
+		"depends_on": "**depends_on** - Step dependencies\n\nSpecifies which steps must complete before this step runs. Can reference steps by label or use step keys.\n\nOn a group step, every step inside the group waits for the dependency. Depending on a group's key waits for all of the steps in the group to finish.\n\nExample:\n```yaml\ndepends_on:\n  - \"build\"\n  - step: \"test\"\n    allow_failure: true\n```",
+		"allow_dependency_failure": "**allow_dependency_failure** - Run even if dependencies fail\n\nBy default a step doesn't run when a step in its `depends_on` fails. With `allow_dependency_failure: true` it runs once its dependencies finish, passed or not, which suits cleanup and reporting steps.\n\n" +
+			"**With `depends_on.allow_failure`**\n- `allow_dependency_failure: true` allows every dependency to fail, so `allow_failure` on a `depends_on` entry adds nothing\n- To tolerate only some failures, leave `allow_dependency_failure` out and set `allow_failure: true` on those entries\n\n" +
+			"Example:\n```yaml\ndepends_on:\n  - \"build\"\n  - step: \"lint\"\n    allow_failure: true\n```",
 		"if":                 "**if** - Conditional execution\n\nStep will only run if the condition evaluates to true. Supports environment variables and build metadata.\n\nExample: `if: build.branch == \"main\"`",
 		"retry":              "**retry** - Automatic and manual retry configuration\n\nDefines how the step should be retried on failure.\n\nExample:\n```yaml\nretry:\n  automatic:\n    - exit_status: -1\n      limit: 2\n  manual:\n    allowed: true\n```",
-		"timeout_in_minutes": "**timeout_in_minutes** - Step timeout\n\nMaximum time the step can run before being cancelled. Defaults to no timeout.\n\nExample: `timeout_in_minutes: 30`",
+		"timeout_in_minutes": "**timeout_in_minutes** - Job timeout\n\nMaximum time a job can run before being cancelled.\n\nWhich timeout wins:\n1. The step's own `timeout_in_minutes`\n2. The pipeline-level `timeout_in_minutes` default in this file\n3. The default command step timeout from the pipeline settings\n\nA step timeout can't exceed the maximum timeout set in the pipeline settings, and it applies to all of the step's commands together.\n\nExample: `timeout_in_minutes: 30`",
 		"artifact_paths":     "**artifact_paths** - Glob patterns for build artifacts\n\nSpecifies which files/directories to upload as build artifacts after the step completes.\n\nExample: `artifact_paths: \"dist/**/*\"`",
 		"branches":           "**branches** - Branch filtering\n\nControls which branches this step runs on. Supports glob patterns and negation.\n\nExample: `branches: \"main release/*\"`",
 		"concurrency":        "**concurrency** - Parallel execution limit\n\nLimits how many instances of this step can run simultaneously across all agents.\n\nExample: `concurrency: 1`",
 		"concurrency_group":  "**concurrency_group** - Concurrency grouping\n\nGroups steps together for concurrency limiting. Steps in the same group share concurrency limits.\n\nExample: `concurrency_group: \"deploy\"`",
 
 		// Special step types
-		"wait":    "**wait** - Wait step\n\nPauses the pipeline until all previous steps have completed. Useful for creating pipeline phases.\n\nExample: `wait: ~` or `wait: \"Continue to deploy?\"`",
-		"block":   "**block** - Manual approval step\n\nPauses the pipeline and waits for manual approval before continuing.\n\nExample: `block: \"Deploy to production?\"`",
-		"input":   "**input** - Input step\n\nCollects input from users before continuing the pipeline.\n\nExample:\n```yaml\ninput: \"Release details\"\nfields:\n  - text: \"version\"\n    required: true\n```",
-		"trigger": "**trigger** - Trigger another pipeline\n\nTriggers another pipeline and optionally waits for it to complete.\n\nExample:\n```yaml\ntrigger: \"my-deployment-pipeline\"\nbuild:\n  message: \"Triggered from ${BUILDKITE_MESSAGE}\"\n```",
+		"wait":          "**wait** - Wait step\n\nPauses the pipeline until all previous steps have completed. Useful for creating pipeline phases.\n\nExample: `wait: ~` or `wait: \"Continue to deploy?\"`",
+		"block":         "**block** - Manual approval step\n\nPauses the pipeline and waits for manual approval before continuing.\n\nExample: `block: \"Deploy to production?\"`",
+		"input":         "**input** - Input step\n\nCollects input from users before continuing the pipeline.\n\nExample:\n```yaml\ninput: \"Release details\"\nfields:\n  - text: \"version\"\n    required: true\n```",
+		"blocked_state": "**blocked_state** - Build state while blocked\n\nThe state the build shows while it waits on this block or input step: `passed` (default), `failed` or `running`.\n\nUse `running` so the build doesn't look finished, or `failed` when an unblocked build should draw attention.\n\nExample: `blocked_state: running`",
+		"allowed_teams": "**allowed_teams** - Teams allowed to unblock\n\nOnly members of the listed teams can unblock this step. Everyone else, including whoever triggered the build, sees the step but can't continue it.\n\nPermission implications:\n- Teams are matched by slug, so a misspelled or renamed team locks out the people meant to unblock the step\n- The team also needs access to the pipeline, or its members won't see the step\n- Leaving `allowed_teams` out lets anyone with build access unblock the step\n\nExample:\n```yaml\nblock: \"Deploy to production?\"\nallowed_teams:\n  - \"release-managers\"\n```\n\n[Block Step Documentation](https://buildkite.com/docs/pipelines/configure/step-types/block-step)",
+		"trigger":       "**trigger** - Trigger another pipeline\n\nTriggers another pipeline and optionally waits for it to complete.\n\nExample:\n```yaml\ntrigger: \"my-deployment-pipeline\"\nbuild:\n  message: \"Triggered from ${BUILDKITE_MESSAGE}\"\n```",
 
 		// Plugin-specific (common ones)
 		"image":   "**image** - Docker image to use\n\nSpecifies the Docker image for the docker plugin.\n\nExample: `image: \"node:18\"`",
@@ -319,6 +610,11 @@ func (s *Server) getPropertyHoverContent(property string, contextInfo *bkcontext
 		return doc
 	}
 
+	// Keys the schema knows but the docs above don't yet
+	if doc := s.getSchemaPropertyHoverContent(property, contextInfo); doc != "" {
+		return doc
+	}
+
 	// For unknown properties, provide basic context-aware help
 	contextType := "unknown"
 	if contextInfo.IsAtTopLevel() {
@@ -342,15 +638,29 @@ func (s *Server) Completion(ctx context.Context, params *protocol.CompletionPara
 
 	// Get document content and position context
 	positionContext, err := s.documentManager.GetContentAtPosition(params.TextDocument.URI, params.Position)
-	if err != nil {
+	if err != nil || positionContext == nil {
+		// The document isn't open, or the position is past its end
 		s.logger.Printf("Failed to get position context: %v", err)
 		return &protocol.CompletionList{IsIncomplete: false, Items: []protocol.CompletionItem{}}, nil
 	}
 
 	s.logger.Printf("Position context - Current line: '%s', Char index: %d", positionContext.CurrentLine, positionContext.CharIndex)
 
-	// Get context-aware completions
-	items := s.completionProvider.GetCompletions(positionContext)
+	// Get context-aware completions. Paths in plugin options are relative to the document's
+	// checkout, which only the server knows.
+	items, ok := s.getPluginPathCompletions(ctx, positionContext)
+	if ok {
+		items = rankCompletions(items, positionContext)
+	} else {
+		items = s.completionProvider.GetCompletionsContext(ctx, positionContext)
+	}
+	items = adaptCompletionItems(items, s.ClientFeatures())
+	items = s.gateAgentFeatureCompletions(items)
+
+	// Keep the list small for slow connections; the client resolves the selected item's docs
+	if s.Settings().CompletionDocumentation == CompletionDocumentationLazy {
+		s.completionDocs.deferDocumentation(items)
+	}
 
 	s.logger.Printf("Generated %d completion items", len(items))
 
@@ -370,7 +680,8 @@ func (s *Server) SignatureHelp(ctx context.Context, params *protocol.SignatureHe
 
 	// Get document content and position context
 	positionContext, err := s.documentManager.GetContentAtPosition(params.TextDocument.URI, params.Position)
-	if err != nil {
+	if err != nil || positionContext == nil {
+		// The document isn't open, or the position is past its end
 		s.logger.Printf("Failed to get position context: %v", err)
 		return nil, nil
 	}
@@ -378,37 +689,42 @@ func (s *Server) SignatureHelp(ctx context.Context, params *protocol.SignatureHe
 	s.logger.Printf("SignatureHelp context - Current line: '%s', Char index: %d", positionContext.CurrentLine, positionContext.CharIndex)
 
 	// Get signature help based on context
-	signatures := s.getSignatureHelp(positionContext)
+	signatures := s.getSignatureHelp(ctx, positionContext)
 
 	if len(signatures) == 0 {
 		return nil, nil
 	}
 
 	return &protocol.SignatureHelp{
-		Signatures:      signatures,
+		Signatures:      adaptSignatures(signatures, s.ClientFeatures().SignatureHelpMarkdown),
 		ActiveSignature: 0,
 		ActiveParameter: s.getActiveParameter(positionContext, signatures[0]),
 	}, nil
 }
 
-func (s *Server) getSignatureHelp(ctx *bkcontext.PositionContext) []protocol.SignatureInformation {
+func (s *Server) getSignatureHelp(ctx context.Context, posCtx *bkcontext.PositionContext) []protocol.SignatureInformation {
 	var signatures []protocol.SignatureInformation
 
 	// Detect context - plugin configuration, step properties, etc.
-	if s.isInPluginContext(ctx) {
-		signatures = append(signatures, s.getPluginSignatures(ctx)...)
-	} else if s.isInStepContext(ctx) {
-		signatures = append(signatures, s.getStepSignatures(ctx)...)
+	if s.isInPluginContext(posCtx) {
+		signatures = append(signatures, s.getPluginSignatures(ctx, posCtx)...)
+	} else if s.isInStepContext(posCtx) {
+		signatures = append(signatures, s.getStepSignatures(posCtx)...)
 	}
 
 	return signatures
 }
 
 func (s *Server) isInPluginContext(ctx *bkcontext.PositionContext) bool {
-	// Check if we're in a plugin configuration context
-	// Look for "plugins:" section and check if we're inside it
-	lines := strings.Split(ctx.FullContent, "\n")
+	if path, ok := nodePathAt(ctx.FullContent, ctx.Position); ok {
+		return pathStepProperty(path) == "plugins"
+	}
+
+	// The document doesn't parse while it's being typed, so look for a "plugins:" section
+	// above the line instead
+	lines := documentLines(ctx.FullContent)
 	currentLine := int(ctx.Position.Line)
+	stepIndent := s.stepIndentOf(lines)
 
 	// Go backwards to find if we're in a plugins section
 	inStepsSection := false
@@ -427,7 +743,7 @@ func (s *Server) isInPluginContext(ctx *bkcontext.PositionContext) bool {
 		}
 
 		// Check if we're in a step
-		if strings.HasPrefix(strings.TrimLeft(lines[i], " \t"), "- ") && s.getIndentLevel(lines[i]) == 2 {
+		if s.isStepLine(lines[i], stepIndent) {
 			inStepsSection = true
 		}
 
@@ -441,9 +757,14 @@ func (s *Server) isInPluginContext(ctx *bkcontext.PositionContext) bool {
 }
 
 func (s *Server) isInStepContext(ctx *bkcontext.PositionContext) bool {
+	if path, ok := nodePathAt(ctx.FullContent, ctx.Position); ok {
+		return pathStep(path) != nil
+	}
+
 	// Check if we're configuring step properties
-	lines := strings.Split(ctx.FullContent, "\n")
+	lines := documentLines(ctx.FullContent)
 	currentLine := int(ctx.Position.Line)
+	stepIndent := s.stepIndentOf(lines)
 
 	// Go backwards to find if we're in a step
 	for i := currentLine; i >= 0; i-- {
@@ -452,8 +773,8 @@ func (s *Server) isInStepContext(ctx *bkcontext.PositionContext) bool {
 		}
 		line := lines[i]
 
-		// Check if we're in a step (starts with "- " at 2-space indentation)
-		if strings.HasPrefix(strings.TrimLeft(line, " \t"), "- ") && s.getIndentLevel(line) == 2 {
+		// Check if we're in a step (starts with "- " at the step indentation)
+		if s.isStepLine(line, stepIndent) {
 			return true
 		}
 
@@ -467,17 +788,17 @@ func (s *Server) isInStepContext(ctx *bkcontext.PositionContext) bool {
 	return false
 }
 
-func (s *Server) getPluginSignatures(ctx *bkcontext.PositionContext) []protocol.SignatureInformation {
+func (s *Server) getPluginSignatures(ctx context.Context, posCtx *bkcontext.PositionContext) []protocol.SignatureInformation {
 	var signatures []protocol.SignatureInformation
 
 	// Detect which plugin we're configuring
-	pluginName := s.detectPluginName(ctx)
+	pluginName := s.detectPluginName(posCtx)
 	if pluginName == "" {
 		return signatures
 	}
 
 	// Get plugin configuration from registry
-	if pluginSchema, err := s.pluginRegistry.GetPluginSchema(pluginName); err == nil && pluginSchema != nil {
+	if pluginSchema, err := s.pluginRegistry.GetPluginSchema(ctx, pluginName); err == nil && pluginSchema != nil {
 		signature := protocol.SignatureInformation{
 			Label: fmt.Sprintf("%s plugin configuration", pluginName),
 			Documentation: &protocol.MarkupContent{
@@ -509,35 +830,43 @@ func (s *Server) getStepSignatures(ctx *bkcontext.PositionContext) []protocol.Si
 	return signatures
 }
 
+// detectPluginName returns the plugin reference on the cursor's line, or the one whose
+// configuration the cursor is in. Keys end at the colon YAML ends them at, so references
+// with colons of their own, like git URLs, come through whole.
 func (s *Server) detectPluginName(ctx *bkcontext.PositionContext) string {
-	lines := strings.Split(ctx.FullContent, "\n")
-	currentLine := int(ctx.Position.Line)
+	lines := splitLines(ctx.FullContent)
+	line := int(ctx.Position.Line)
+	if line >= len(lines) {
+		return ""
+	}
 
-	// Go backwards to find the plugin name
-	for i := currentLine; i >= 0; i-- {
-		if i >= len(lines) {
-			continue
-		}
-		line := strings.TrimSpace(lines[i])
+	contextInfo := s.completionProvider.GetContextAnalyzer().AnalyzeContext(&bkcontext.PositionContext{
+		Position:     ctx.Position,
+		CurrentLine:  lines[line],
+		CharIndex:    ctx.CharIndex,
+		ContextLines: lines[:line+1],
+	})
 
-		// Look for plugin name (key before configuration)
-		if strings.Contains(line, ":") && !strings.HasPrefix(line, "-") {
-			parts := strings.Split(line, ":")
-			if len(parts) > 0 {
-				pluginName := strings.TrimSpace(parts[0])
-				// Remove quotes if present
-				pluginName = strings.Trim(pluginName, `"'`)
-				return pluginName
-			}
-		}
+	switch contextInfo.Type {
+	case bkcontext.ContextPluginConfig:
+		return contextInfo.PluginName
+	case bkcontext.ContextPlugins:
+		return yamlKey(lines[line])
 	}
-
 	return ""
 }
 
 func (s *Server) detectStepType(ctx *bkcontext.PositionContext) string {
-	lines := strings.Split(ctx.FullContent, "\n")
+	if path, ok := nodePathAt(ctx.FullContent, ctx.Position); ok {
+		if step := pathStep(path); step != nil {
+			return stepNodeType(step)
+		}
+		return ""
+	}
+
+	lines := documentLines(ctx.FullContent)
 	currentLine := int(ctx.Position.Line)
+	stepIndent := s.stepIndentOf(lines)
 
 	// Look for step type in current step
 	for i := currentLine; i >= 0; i-- {
@@ -546,7 +875,7 @@ func (s *Server) detectStepType(ctx *bkcontext.PositionContext) string {
 		}
 
 		// Stop at step boundary
-		if strings.HasPrefix(strings.TrimLeft(lines[i], " \t"), "- ") && s.getIndentLevel(lines[i]) == 2 {
+		if s.isStepLine(lines[i], stepIndent) {
 			// Look forward in this step for the type
 			for j := i; j < len(lines) && j <= currentLine+10; j++ {
 				stepLine := strings.TrimSpace(lines[j])
@@ -693,6 +1022,37 @@ done:
 	return count
 }
 
+// defaultStepIndent is the indentation of steps in a document whose steps list has none yet
+const defaultStepIndent = 2
+
+// stepIndentOf returns the indentation of a document's steps: that of the first list item
+// under the top-level steps key, as pipelines are written with 2, 4 or more spaces, or tabs
+func (s *Server) stepIndentOf(lines []string) int {
+	for i, line := range lines {
+		if yamlKey(line) != "steps" || s.getIndentLevel(line) != 0 {
+			continue
+		}
+		for _, next := range lines[i+1:] {
+			trimmed := strings.TrimSpace(next)
+			if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+				continue
+			}
+			if indent := s.getIndentLevel(next); indent > 0 && strings.HasPrefix(trimmed, "-") {
+				return indent
+			}
+			break
+		}
+		break
+	}
+	return defaultStepIndent
+}
+
+// isStepLine reports whether a line starts one of the top-level steps, given the document's
+// step indentation
+func (s *Server) isStepLine(line string, stepIndent int) bool {
+	return strings.HasPrefix(strings.TrimLeft(line, " \t"), "- ") && s.getIndentLevel(line) == stepIndent
+}
+
 func (s *Server) Definition(ctx context.Context, params *protocol.DefinitionParams) ([]protocol.Location, error) {
 	s.logger.Printf("Definition requested for URI: %s, Position: %d:%d", params.TextDocument.URI, params.Position.Line, params.Position.Character)
 
@@ -703,7 +1063,8 @@ func (s *Server) Definition(ctx context.Context, params *protocol.DefinitionPara
 
 	// Get document content and position context
 	positionContext, err := s.documentManager.GetContentAtPosition(params.TextDocument.URI, params.Position)
-	if err != nil {
+	if err != nil || positionContext == nil {
+		// The document isn't open, or the position is past its end
 		s.logger.Printf("Failed to get position context: %v", err)
 		return nil, nil
 	}
@@ -720,6 +1081,16 @@ func (s *Server) Definition(ctx context.Context, params *protocol.DefinitionPara
 func (s *Server) findDefinitions(ctx *bkcontext.PositionContext) []protocol.Location {
 	var locations []protocol.Location
 
+	// Template references lead to the template in its file
+	if templateLocation := s.findTemplateDefinition(ctx); templateLocation != nil {
+		return append(locations, *templateLocation)
+	}
+
+	// Upload commands lead to the pipeline file they upload
+	if uploadLocation := s.findUploadDefinition(ctx.URI, ctx.ContextLines, ctx.Position); uploadLocation != nil {
+		return append(locations, *uploadLocation)
+	}
+
 	// Get the word/identifier under the cursor
 	word := s.getWordAtPosition(ctx)
 	if word == "" {
@@ -782,6 +1153,10 @@ func (s *Server) getWordAtPosition(ctx *bkcontext.PositionContext) string {
 }
 
 func (s *Server) isStepReference(ctx *bkcontext.PositionContext, word string) bool {
+	if path, ok := nodePathAt(ctx.FullContent, ctx.Position); ok {
+		return pathStepProperty(path) == "depends_on" && !(path.OnKey && len(path.Nodes) == pathStepIndex(path)+2)
+	}
+
 	line := strings.TrimSpace(ctx.CurrentLine)
 
 	// Check if we're in a depends_on array
@@ -796,10 +1171,15 @@ func (s *Server) isStepReference(ctx *bkcontext.PositionContext, word string) bo
 }
 
 func (s *Server) isPluginReference(ctx *bkcontext.PositionContext, word string) bool {
+	if path, ok := nodePathAt(ctx.FullContent, ctx.Position); ok {
+		return pathStepProperty(path) == "plugins"
+	}
+
 	// Check if we're in a plugin configuration context
 	// This could be in plugins array or plugin references
-	lines := strings.Split(ctx.FullContent, "\n")
+	lines := documentLines(ctx.FullContent)
 	currentLine := int(ctx.Position.Line)
+	stepIndent := s.stepIndentOf(lines)
 
 	// Check if we're in a plugins section
 	for i := currentLine; i >= 0; i-- {
@@ -813,7 +1193,7 @@ func (s *Server) isPluginReference(ctx *bkcontext.PositionContext, word string)
 		}
 
 		// Stop at step boundary or top-level
-		if strings.HasPrefix(strings.TrimLeft(lines[i], " \t"), "- ") && s.getIndentLevel(lines[i]) == 2 {
+		if s.isStepLine(lines[i], stepIndent) {
 			break
 		}
 		if len(line) > 0 && lines[i][0] != ' ' && lines[i][0] != '\t' {
@@ -825,7 +1205,34 @@ func (s *Server) isPluginReference(ctx *bkcontext.PositionContext, word string)
 }
 
 func (s *Server) findStepDefinition(ctx *bkcontext.PositionContext, stepKey string) *protocol.Location {
-	lines := strings.Split(ctx.FullContent, "\n")
+	lines := documentLines(ctx.FullContent)
+
+	if edit := newStructuredEdit(lines); edit != nil {
+		if edit.root.Kind != yaml.MappingNode {
+			return nil
+		}
+		for _, step := range dependableSteps(mappingValue(edit.root, "steps")) {
+			// A step without a key is found by the key its label would give it
+			key := stepNodeKey(step)
+			if key == "" {
+				key = stepLabelKey(step)
+			}
+			if key != stepKey {
+				continue
+			}
+			line := step.Line - 1
+			return &protocol.Location{
+				URI: ctx.URI,
+				Range: protocol.Range{
+					Start: protocol.Position{Line: uint32(line), Character: 0},
+					End:   protocol.Position{Line: uint32(line), Character: uint32(len(lines[line]))},
+				},
+			}
+		}
+		return nil
+	}
+
+	stepIndent := s.stepIndentOf(lines)
 
 	// Find all step definitions and look for one with matching key
 	inSteps := false
@@ -845,7 +1252,7 @@ func (s *Server) findStepDefinition(ctx *bkcontext.PositionContext, stepKey stri
 		}
 
 		// Look for step definitions (- at step level indentation)
-		if inSteps && strings.HasPrefix(strings.TrimLeft(line, " \t"), "- ") && s.getIndentLevel(line) == 2 {
+		if inSteps && s.isStepLine(line, stepIndent) {
 			// Look ahead in this step for a key property
 			foundStepKey := s.findStepKey(lines, i)
 			if foundStepKey == stepKey {
@@ -965,6 +1372,34 @@ func (s *Server) CodeAction(ctx context.Context, params *protocol.CodeActionPara
 	// Generate refactoring actions based on context
 	actions = append(actions, s.getRefactorActions(params, doc)...)
 
+	// Offer to key every step, ahead of adding dependencies between them
+	if action := s.createGenerateKeysAction(params.TextDocument.URI, doc.Lines); action != nil {
+		actions = append(actions, *action)
+	}
+
+	// Offer to align plugin versions across the workspace
+	actions = append(actions, s.getPluginBumpActions(params, doc)...)
+
+	// Offer to pin a plugin referenced without a version
+	actions = append(actions, s.getPluginPinActions(params, doc)...)
+
+	// Offer to scaffold the required keys of the plugin under the cursor
+	actions = append(actions, s.getRequiredConfigActions(ctx, params, doc)...)
+
+	// Offer to move long inline scripts into their own file
+	actions = append(actions, s.getExtractScriptActions(params, doc)...)
+
+	// Offer to switch artifact_paths between a string and a list
+	actions = append(actions, s.getArtifactPathsActions(params, doc)...)
+
+	// Offer to escape interpolations in agent requirements
+	actions = append(actions, s.getAgentInterpolationActions(params, doc)...)
+
+	// Edits are built with "\n" line breaks, which CRLF documents get in their own endings
+	for i := range actions {
+		s.matchLineEndings(actions[i].Edit)
+	}
+
 	s.logger.Printf("Generated %d code actions", len(actions))
 	return actions, nil
 }
@@ -974,6 +1409,45 @@ func (s *Server) getQuickFixActions(params *protocol.CodeActionParams, doc *Docu
 
 	lines := doc.Lines
 
+	// Quick fixes driven by reported diagnostics
+	for _, diagnostic := range params.Context.Diagnostics {
+		if diagnostic.Code == "redundant-timeout" {
+			actions = append(actions, s.createRemoveEntryAction(params.TextDocument.URI, "Remove redundant step timeout", diagnostic))
+		}
+		if diagnostic.Code == "unquoted-env-value" {
+			if action := s.createQuoteEnvValueAction(params.TextDocument.URI, lines, diagnostic); action != nil {
+				actions = append(actions, *action)
+			}
+		}
+		switch diagnostic.Code {
+		case "artifact-path-separator", "duplicate-artifact-path", "mixed-artifact-separators":
+			if action := s.createNormalizeArtifactPathsAction(params.TextDocument.URI, lines, diagnostic); action != nil {
+				actions = append(actions, *action)
+			}
+		}
+		if diagnostic.Code == "wait-label-looks-like-block" {
+			if action := s.createWaitToBlockAction(params.TextDocument.URI, lines, diagnostic); action != nil {
+				actions = append(actions, *action)
+			}
+		}
+		if diagnostic.Code == "unknown-condition-variable" {
+			if action := s.createConditionVariableAction(params.TextDocument.URI, lines, diagnostic); action != nil {
+				actions = append(actions, *action)
+			}
+		}
+		if diagnostic.Code == "missing-depends-on" {
+			if action := s.createAddDependsOnAction(params.TextDocument.URI, lines, diagnostic); action != nil {
+				actions = append(actions, *action)
+			}
+		}
+		if diagnostic.Code == "dangling-depends-on" {
+			actions = append(actions, s.createDanglingDependencyActions(params.TextDocument.URI, lines, diagnostic)...)
+		}
+		if diagnostic.Code == "duplicate-plugin" || diagnostic.Code == "plugin-version-conflict" {
+			actions = append(actions, s.createDuplicatePluginActions(params.TextDocument.URI, lines, diagnostic)...)
+		}
+	}
+
 	// Check if we're in a step context
 	stepInfo := s.analyzeStepAtRange(params.Range, lines)
 	if stepInfo == nil {
@@ -1013,17 +1487,40 @@ func (s *Server) getRefactorActions(params *protocol.CodeActionParams, doc *Docu
 
 	lines := doc.Lines
 
+	// Refactor: Copy the step below itself, to tweak the copy. This finds the step from the
+	// parsed document, so is offered on groups and lines outside a step context too.
+	duplicates := s.getDuplicateStepActions(params.TextDocument.URI, lines, int(params.Range.Start.Line))
+
+	// Refactor: Skip the step, or stop skipping it, a common temporary edit during incidents
+	if action := s.createToggleSkipAction(params.TextDocument.URI, lines, int(params.Range.Start.Line)); action != nil {
+		duplicates = append(duplicates, *action)
+	}
+
 	// Check if we're in a step context
 	stepInfo := s.analyzeStepAtRange(params.Range, lines)
 	if stepInfo == nil {
-		return actions
+		return duplicates
 	}
 
 	// Refactor: Convert single command to commands array
 	if stepInfo.IsCommandStep && stepInfo.HasSingleCommand {
-		actions = append(actions, s.createConvertToCommandsArrayAction(params.TextDocument.URI, stepInfo))
+		if action := s.createConvertToCommandsArrayAction(params.TextDocument.URI, lines, stepInfo); action != nil {
+			actions = append(actions, *action)
+		}
+	}
+
+	// Refactor: Merge commands array into a single command
+	if action := s.createMergeCommandsAction(params.TextDocument.URI, lines, stepInfo); action != nil {
+		actions = append(actions, *action)
 	}
 
+	// Refactor: Wrap the step in a group of its own
+	if action := s.createWrapInGroupAction(params.TextDocument.URI, stepInfo); action != nil {
+		actions = append(actions, *action)
+	}
+
+	actions = append(actions, duplicates...)
+
 	// Refactor: Extract step to separate step with dependency
 	if stepInfo.IsCommandStep {
 		actions = append(actions, s.createExtractStepAction(params.TextDocument.URI, stepInfo))
@@ -1049,7 +1546,17 @@ type StepInfo struct {
 }
 
 func (s *Server) analyzeStepAtRange(rang protocol.Range, lines []string) *StepInfo {
+	if edit := newStructuredEdit(lines); edit != nil {
+		path, _ := nodePathAt(strings.Join(lines, "\n"), rang.Start)
+		step := pathStep(path)
+		if step == nil || step.Kind != yaml.MappingNode {
+			return nil
+		}
+		return stepInfoOf(edit, step)
+	}
+
 	startLine := int(rang.Start.Line)
+	stepIndent := s.stepIndentOf(lines)
 
 	// Find the step that contains this range
 	stepStart := -1
@@ -1059,7 +1566,7 @@ func (s *Server) analyzeStepAtRange(rang protocol.Range, lines []string) *StepIn
 	// First, check if we're already on a step start line
 	if startLine < len(lines) {
 		currentLine := lines[startLine]
-		if strings.HasPrefix(strings.TrimLeft(currentLine, " \t"), "- ") && s.getIndentLevel(currentLine) == 2 {
+		if s.isStepLine(currentLine, stepIndent) {
 			// Check if we're in steps section by looking backwards for "steps:"
 			for i := startLine - 1; i >= 0; i-- {
 				line := strings.TrimSpace(lines[i])
@@ -1091,7 +1598,7 @@ func (s *Server) analyzeStepAtRange(rang protocol.Range, lines []string) *StepIn
 			}
 
 			// Check if this is a step start
-			if inSteps && strings.HasPrefix(strings.TrimLeft(lines[i], " \t"), "- ") && s.getIndentLevel(lines[i]) == 2 {
+			if inSteps && s.isStepLine(lines[i], stepIndent) {
 				stepStart = i
 				break
 			}
@@ -1112,7 +1619,7 @@ func (s *Server) analyzeStepAtRange(rang protocol.Range, lines []string) *StepIn
 		line := lines[i]
 
 		// Stop at next step or top-level property
-		if (strings.HasPrefix(strings.TrimLeft(line, " \t"), "- ") && s.getIndentLevel(line) == 2) ||
+		if s.isStepLine(line, stepIndent) ||
 			(len(strings.TrimSpace(line)) > 0 && line[0] != ' ' && line[0] != '\t') {
 			stepEnd = i - 1
 			break
@@ -1179,177 +1686,213 @@ func (s *Server) analyzeStepAtRange(rang protocol.Range, lines []string) *StepIn
 	return info
 }
 
-func (s *Server) createConvertNameToLabelAction(uri protocol.DocumentURI, stepInfo *StepInfo) protocol.CodeAction {
-	// Get the document to read the actual line content
+// stepEdit starts a structured edit of the open document, returning the step at the line.
+// It returns nil when the document isn't open or isn't valid YAML, or no step is there.
+func (s *Server) stepEdit(uri protocol.DocumentURI, line int) (*structuredEdit, *yaml.Node) {
 	doc, exists := s.documentManager.GetDocument(uri)
-	if !exists || stepInfo.NameLine >= len(doc.Lines) {
-		// Fallback if we can't read the document
-		return protocol.CodeAction{
-			Title: "Convert 'name' to 'label'",
-			Kind:  protocol.QuickFix,
-			Edit: &protocol.WorkspaceEdit{
-				Changes: map[protocol.DocumentURI][]protocol.TextEdit{
-					uri: {
-						{
-							Range: protocol.Range{
-								Start: protocol.Position{Line: uint32(stepInfo.NameLine), Character: 0},
-								End:   protocol.Position{Line: uint32(stepInfo.NameLine), Character: 999},
-							},
-							NewText: "    label: \"TODO: Add label\"",
-						},
-					},
-				},
-			},
-		}
+	if !exists {
+		return nil, nil
 	}
+	return stepEditOf(doc.Lines, line)
+}
 
-	// Read the actual line and replace 'name:' with 'label:'
-	originalLine := doc.Lines[stepInfo.NameLine]
-	newLine := strings.Replace(originalLine, "name:", "label:", 1)
+// stepEditOf starts a structured edit of the lines, returning the step at the line
+func stepEditOf(lines []string, line int) (*structuredEdit, *yaml.Node) {
+	edit := newStructuredEdit(lines)
+	if edit == nil {
+		return nil, nil
+	}
+	step := edit.stepAt(line)
+	if step == nil {
+		return nil, nil
+	}
+	return edit, step
+}
 
+// quickFix wraps text edits to a document in a quick fix
+func quickFix(uri protocol.DocumentURI, title string, edits []protocol.TextEdit) protocol.CodeAction {
 	return protocol.CodeAction{
-		Title: "Convert 'name' to 'label'",
+		Title: title,
 		Kind:  protocol.QuickFix,
 		Edit: &protocol.WorkspaceEdit{
-			Changes: map[protocol.DocumentURI][]protocol.TextEdit{
-				uri: {
-					{
-						Range: protocol.Range{
-							Start: protocol.Position{Line: uint32(stepInfo.NameLine), Character: 0},
-							End:   protocol.Position{Line: uint32(stepInfo.NameLine), Character: uint32(len(originalLine))},
-						},
-						NewText: newLine,
-					},
-				},
-			},
+			Changes: map[protocol.DocumentURI][]protocol.TextEdit{uri: edits},
 		},
 	}
 }
 
+// matchLineEndings rewrites the line breaks of edits to open documents to each document's
+// own line ending, so edits don't leave CRLF documents with mixed endings
+func (s *Server) matchLineEndings(edit *protocol.WorkspaceEdit) {
+	if edit == nil {
+		return
+	}
+	for uri, edits := range edit.Changes {
+		doc, exists := s.documentManager.GetDocument(uri)
+		if !exists || doc.LineEnding != "\r\n" {
+			continue
+		}
+		for i := range edits {
+			edits[i].NewText = withLineEnding(edits[i].NewText, doc.LineEnding)
+		}
+	}
+}
+
+func (s *Server) createConvertNameToLabelAction(uri protocol.DocumentURI, stepInfo *StepInfo) protocol.CodeAction {
+	const title = "Convert 'name' to 'label'"
+	if edit, step := s.stepEdit(uri, stepInfo.NameLine); edit != nil {
+		if entry := mappingKey(step, "name"); entry != nil {
+			edit.renameKey(entry, "label")
+			return quickFix(uri, title, edit.textEdits())
+		}
+	}
+
+	// Fallback if we can't read the document
+	return quickFix(uri, title, []protocol.TextEdit{{
+		Range: protocol.Range{
+			Start: protocol.Position{Line: uint32(stepInfo.NameLine), Character: 0},
+			End:   protocol.Position{Line: uint32(stepInfo.NameLine), Character: 999},
+		},
+		NewText: "    label: \"TODO: Add label\"",
+	}})
+}
+
 func (s *Server) createAddLabelAction(uri protocol.DocumentURI, stepInfo *StepInfo) protocol.CodeAction {
+	const title = "Add label to step"
+
 	// Generate a suggested label based on the step content or position
-	suggestedLabel := fmt.Sprintf("Step %d", stepInfo.StartLine)
+	suggestedLabel := fmt.Sprintf("%q", fmt.Sprintf("Step %d", stepInfo.StartLine))
 
-	// Insert label after the step start line
-	insertLine := stepInfo.StartLine + 1
-	newText := fmt.Sprintf("    label: \"%s\"\n", suggestedLabel)
+	// The label goes after the step's first property, whatever lines its value takes
+	if edit, step := s.stepEdit(uri, stepInfo.StartLine); edit != nil {
+		edit.addProperty(step, &mappingEntry{key: step.Content[0], value: step.Content[1]}, "label", suggestedLabel)
+		return quickFix(uri, title, edit.textEdits())
+	}
 
-	return protocol.CodeAction{
-		Title: "Add label to step",
-		Kind:  protocol.QuickFix,
-		Edit: &protocol.WorkspaceEdit{
-			Changes: map[protocol.DocumentURI][]protocol.TextEdit{
-				uri: {
-					{
-						Range: protocol.Range{
-							Start: protocol.Position{Line: uint32(insertLine), Character: 0},
-							End:   protocol.Position{Line: uint32(insertLine), Character: 0},
-						},
-						NewText: newText,
-					},
-				},
-			},
+	insertLine := uint32(stepInfo.StartLine + 1)
+	return quickFix(uri, title, []protocol.TextEdit{{
+		Range: protocol.Range{
+			Start: protocol.Position{Line: insertLine, Character: 0},
+			End:   protocol.Position{Line: insertLine, Character: 0},
 		},
-	}
+		NewText: fmt.Sprintf("    label: %s\n", suggestedLabel),
+	}})
 }
 
 func (s *Server) createAddKeyAction(uri protocol.DocumentURI, stepInfo *StepInfo) protocol.CodeAction {
+	const title = "Add key to step"
+
 	// Generate key from label if possible, otherwise use generic key
-	suggestedKey := fmt.Sprintf("step-%d", stepInfo.StartLine)
+	suggestedKey := fmt.Sprintf("%q", fmt.Sprintf("step-%d", stepInfo.StartLine))
 
-	// Insert key after label line
-	insertLine := stepInfo.LabelLine + 1
-	newText := fmt.Sprintf("    key: \"%s\"\n", suggestedKey)
+	// The key goes after the label
+	if edit, step := s.stepEdit(uri, stepInfo.StartLine); edit != nil {
+		var after *mappingEntry
+		for _, field := range stepLabelFields {
+			if after = mappingKey(step, field); after != nil {
+				break
+			}
+		}
+		if after == nil {
+			after = &mappingEntry{key: step.Content[0], value: step.Content[1]}
+		}
+		edit.addProperty(step, after, "key", suggestedKey)
+		return quickFix(uri, title, edit.textEdits())
+	}
 
-	return protocol.CodeAction{
-		Title: "Add key to step",
-		Kind:  protocol.QuickFix,
-		Edit: &protocol.WorkspaceEdit{
-			Changes: map[protocol.DocumentURI][]protocol.TextEdit{
-				uri: {
-					{
-						Range: protocol.Range{
-							Start: protocol.Position{Line: uint32(insertLine), Character: 0},
-							End:   protocol.Position{Line: uint32(insertLine), Character: 0},
-						},
-						NewText: newText,
-					},
-				},
-			},
+	insertLine := uint32(stepInfo.LabelLine + 1)
+	return quickFix(uri, title, []protocol.TextEdit{{
+		Range: protocol.Range{
+			Start: protocol.Position{Line: insertLine, Character: 0},
+			End:   protocol.Position{Line: insertLine, Character: 0},
 		},
-	}
+		NewText: fmt.Sprintf("    key: %s\n", suggestedKey),
+	}})
 }
 
+// placeholderCommand stands in for a command the user has yet to write
+const placeholderCommand = `"echo 'TODO: Add command'"`
+
 func (s *Server) createFixEmptyCommandAction(uri protocol.DocumentURI, stepInfo *StepInfo) protocol.CodeAction {
-	// Replace empty command with placeholder
-	newText := `    command: "echo 'TODO: Add command'"`
+	const title = "Fix empty command"
 
-	return protocol.CodeAction{
-		Title: "Fix empty command",
-		Kind:  protocol.QuickFix,
-		Edit: &protocol.WorkspaceEdit{
-			Changes: map[protocol.DocumentURI][]protocol.TextEdit{
-				uri: {
-					{
-						Range: protocol.Range{
-							Start: protocol.Position{Line: uint32(stepInfo.CommandLine), Character: 0},
-							End:   protocol.Position{Line: uint32(stepInfo.CommandLine + 1), Character: 0},
-						},
-						NewText: newText + "\n",
-					},
-				},
-			},
-		},
+	// Replace empty command with placeholder, keeping any comment after it
+	if edit, step := s.stepEdit(uri, stepInfo.CommandLine); edit != nil {
+		if entry := mappingKey(step, "command"); entry != nil {
+			edit.setValue(entry, placeholderCommand)
+			return quickFix(uri, title, edit.textEdits())
+		}
 	}
+
+	return quickFix(uri, title, []protocol.TextEdit{{
+		Range: protocol.Range{
+			Start: protocol.Position{Line: uint32(stepInfo.CommandLine), Character: 0},
+			End:   protocol.Position{Line: uint32(stepInfo.CommandLine + 1), Character: 0},
+		},
+		NewText: "    command: " + placeholderCommand + "\n",
+	}})
 }
 
 func (s *Server) createAddStepTypeAction(uri protocol.DocumentURI, stepInfo *StepInfo) protocol.CodeAction {
+	const title = "Add command to step"
+
 	// Add command as default step type
-	insertLine := stepInfo.StartLine + 1
-	newText := `    command: "echo 'TODO: Add command'"` + "\n"
+	if edit, step := s.stepEdit(uri, stepInfo.StartLine); edit != nil {
+		edit.addProperty(step, nil, "command", placeholderCommand)
+		return quickFix(uri, title, edit.textEdits())
+	}
 
-	return protocol.CodeAction{
-		Title: "Add command to step",
-		Kind:  protocol.QuickFix,
-		Edit: &protocol.WorkspaceEdit{
-			Changes: map[protocol.DocumentURI][]protocol.TextEdit{
-				uri: {
-					{
-						Range: protocol.Range{
-							Start: protocol.Position{Line: uint32(insertLine), Character: 0},
-							End:   protocol.Position{Line: uint32(insertLine), Character: 0},
-						},
-						NewText: newText,
-					},
-				},
-			},
+	insertLine := uint32(stepInfo.StartLine + 1)
+	return quickFix(uri, title, []protocol.TextEdit{{
+		Range: protocol.Range{
+			Start: protocol.Position{Line: insertLine, Character: 0},
+			End:   protocol.Position{Line: insertLine, Character: 0},
 		},
-	}
+		NewText: "    command: " + placeholderCommand + "\n",
+	}})
 }
 
-func (s *Server) createConvertToCommandsArrayAction(uri protocol.DocumentURI, stepInfo *StepInfo) protocol.CodeAction {
-	// Convert single command to commands array
-	newText := `    commands:
-      - "echo 'TODO: Add first command'"
-      - "echo 'TODO: Add second command'"`
+// createRemoveEntryAction removes the step property the diagnostic is on, with every line
+// its value takes
+func (s *Server) createRemoveEntryAction(uri protocol.DocumentURI, title string, diagnostic protocol.Diagnostic) protocol.CodeAction {
+	line := diagnostic.Range.Start.Line
 
-	return protocol.CodeAction{
-		Title: "Convert to commands array",
-		Kind:  protocol.RefactorRewrite,
-		Edit: &protocol.WorkspaceEdit{
-			Changes: map[protocol.DocumentURI][]protocol.TextEdit{
-				uri: {
-					{
-						Range: protocol.Range{
-							Start: protocol.Position{Line: uint32(stepInfo.CommandLine), Character: 0},
-							End:   protocol.Position{Line: uint32(stepInfo.CommandLine + 1), Character: 0},
-						},
-						NewText: newText + "\n",
-					},
-				},
-			},
+	edits := []protocol.TextEdit{{
+		Range: protocol.Range{
+			Start: protocol.Position{Line: line, Character: 0},
+			End:   protocol.Position{Line: line + 1, Character: 0},
 		},
+	}}
+	if edit, step := s.stepEdit(uri, int(line)); edit != nil {
+		if entry := entryOnLine(step, int(line)); entry != nil {
+			edit.deleteEntry(step, entry)
+			edits = edit.textEdits()
+		}
 	}
+
+	action := quickFix(uri, title, edits)
+	action.Diagnostics = []protocol.Diagnostic{diagnostic}
+	return action
+}
+
+// createWrapInGroupAction moves a top-level step into a new group step named after it
+func (s *Server) createWrapInGroupAction(uri protocol.DocumentURI, stepInfo *StepInfo) *protocol.CodeAction {
+	edit, step := s.stepEdit(uri, stepInfo.StartLine)
+	if edit == nil || step.Line-1 != stepInfo.StartLine || mappingKey(step, "group") != nil {
+		return nil
+	}
+
+	label := "Group"
+	for _, field := range stepLabelFields {
+		if value := mappingValue(step, field); value != nil && value.Kind == yaml.ScalarNode && value.Value != "" {
+			label = value.Value
+			break
+		}
+	}
+
+	edit.wrapInGroup(step, label)
+	action := quickFix(uri, "Wrap step in a group", edit.textEdits())
+	action.Kind = protocol.RefactorRewrite
+	return &action
 }
 
 func (s *Server) createExtractStepAction(uri protocol.DocumentURI, stepInfo *StepInfo) protocol.CodeAction {
@@ -1369,7 +1912,8 @@ func (s *Server) DocumentSymbol(ctx context.Context, params *protocol.DocumentSy
 	// Get document content
 	doc, exists := s.documentManager.GetDocument(params.TextDocument.URI)
 	if !exists {
-		return nil, fmt.Errorf("document not found: %s", params.TextDocument.URI)
+		// Like other requests on documents that aren't open, there's nothing to return
+		return nil, nil
 	}
 
 	// Parse YAML to extract symbols
@@ -1384,7 +1928,7 @@ func (s *Server) DocumentSymbol(ctx context.Context, params *protocol.DocumentSy
 
 func (s *Server) extractDocumentSymbols(content string, lines []string) ([]protocol.DocumentSymbol, error) {
 	// Parse YAML first to validate it
-	_, err := parser.ParseYAML([]byte(content))
+	pipeline, err := parser.ParseYAML([]byte(content))
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse YAML: %w", err)
 	}
@@ -1401,8 +1945,10 @@ func (s *Server) extractDocumentSymbols(content string, lines []string) ([]proto
 	}
 
 	// Extract steps (the most important part)
-	if stepsSymbol := s.extractStepsSymbol(lines); stepsSymbol != nil {
-		symbols = append(symbols, *stepsSymbol)
+	if root := pipeline.YAMLNode; root != nil && len(root.Content) > 0 {
+		if stepsSymbol := s.extractStepsSymbol(root.Content[0], lines); stepsSymbol != nil {
+			symbols = append(symbols, *stepsSymbol)
+		}
 	}
 
 	// Extract other top-level properties
@@ -1412,153 +1958,145 @@ func (s *Server) extractDocumentSymbols(content string, lines []string) ([]proto
 	return symbols, nil
 }
 
-func (s *Server) extractStepsSymbol(lines []string) *protocol.DocumentSymbol {
-	stepsLine := -1
-
-	// Find the steps: line
-	for i, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		if trimmed == "steps:" {
-			stepsLine = i
-			break
-		}
-	}
-
-	if stepsLine == -1 {
+// extractStepsSymbol builds the steps symbol, with a child for each step and the steps of
+// groups nested under them, so outlines and breadcrumbs follow the pipeline's structure
+func (s *Server) extractStepsSymbol(root *yaml.Node, lines []string) *protocol.DocumentSymbol {
+	steps := mappingKey(root, "steps")
+	if steps == nil {
 		return nil
 	}
 
-	// Extract individual steps as children
-	var children []protocol.DocumentSymbol
-	currentStepStart := -1
-	stepIndex := 0
-
-	for i := stepsLine + 1; i < len(lines); i++ {
-		line := lines[i]
-
-		// Stop if we hit another top-level property
-		if len(line) > 0 && line[0] != ' ' && line[0] != '\t' {
-			break
-		}
-
-		// Look for step indicators (- at step level indentation)
-		// Steps should be at 2-space indentation level under "steps:"
-		trimmedLeft := strings.TrimLeft(line, " \t")
-		if strings.HasPrefix(trimmedLeft, "- ") {
-			// Check if this is at the correct step indentation level (2 spaces)
-			// Count leading spaces
-			leadingSpaces := len(line) - len(strings.TrimLeft(line, " "))
-			if leadingSpaces == 2 {
-				// Finish previous step if exists
-				if currentStepStart != -1 {
-					stepSymbol := s.createStepSymbol(lines, stepIndex, currentStepStart, i-1)
-					if stepSymbol != nil {
-						children = append(children, *stepSymbol)
-					}
-					stepIndex++
-				}
-				currentStepStart = i
-			}
-		}
-	}
-
-	// Don't forget the last step
-	if currentStepStart != -1 {
-		stepSymbol := s.createStepSymbol(lines, stepIndex, currentStepStart, len(lines)-1)
-		if stepSymbol != nil {
-			children = append(children, *stepSymbol)
-		}
-	}
-
-	// Calculate end line for steps section
-	endLine := len(lines) - 1
-	for i := stepsLine + 1; i < len(lines); i++ {
-		line := lines[i]
-		if len(line) > 0 && line[0] != ' ' && line[0] != '\t' {
-			endLine = i - 1
-			break
-		}
-	}
+	edit := &structuredEdit{lines: lines, root: root}
+	children := s.stepSymbols(edit, steps.value)
+	start := nodeStart(steps.key)
 
 	return &protocol.DocumentSymbol{
-		Name: fmt.Sprintf("steps (%d)", len(children)),
-		Kind: protocol.SymbolKindArray,
+		Name:   "steps",
+		Detail: fmt.Sprintf("%d steps", len(children)),
+		Kind:   protocol.SymbolKindArray,
 		Range: protocol.Range{
-			Start: protocol.Position{Line: uint32(stepsLine), Character: 0},
-			End:   protocol.Position{Line: uint32(endLine), Character: 0},
+			Start: start,
+			End:   edit.entryEnd(steps),
 		},
 		SelectionRange: protocol.Range{
-			Start: protocol.Position{Line: uint32(stepsLine), Character: 0},
-			End:   protocol.Position{Line: uint32(stepsLine), Character: uint32(len("steps:"))},
+			Start: start,
+			End:   protocol.Position{Line: start.Line, Character: start.Character + uint32(len("steps"))},
 		},
 		Children: children,
 	}
 }
 
-func (s *Server) createStepSymbol(lines []string, index int, startLine, endLine int) *protocol.DocumentSymbol {
-	if startLine >= len(lines) {
-		return nil
+// stepSymbols returns a symbol for each step of a steps list
+func (s *Server) stepSymbols(edit *structuredEdit, list *yaml.Node) []protocol.DocumentSymbol {
+	var symbols []protocol.DocumentSymbol
+	if list == nil || list.Kind != yaml.SequenceNode {
+		return symbols
+	}
+	for i, step := range list.Content {
+		symbols = append(symbols, s.createStepSymbol(edit, step, i))
 	}
+	return symbols
+}
 
-	// Determine step type and label
-	stepType := "Step"
-	stepLabel := fmt.Sprintf("Step %d", index+1)
-	stepKind := protocol.SymbolKindObject
+// createStepSymbol describes a step by its type and label. Command steps are functions,
+// wait, block, input and trigger steps are events, and groups are namespaces holding their
+// steps.
+func (s *Server) createStepSymbol(edit *structuredEdit, step *yaml.Node, index int) protocol.DocumentSymbol {
+	symbol := protocol.DocumentSymbol{
+		Name:   fmt.Sprintf("Step %d", index+1),
+		Detail: "Step",
+		Kind:   protocol.SymbolKindObject,
+	}
 
-	// Analyze step content to get a better name
-	for i := startLine; i <= endLine && i < len(lines); i++ {
-		line := strings.TrimSpace(lines[i])
+	// The step's text starts at its dash
+	start := nodeStart(step)
+	if line := int(start.Line); line < len(edit.lines) {
+		if dash := strings.LastIndex(edit.lines[line][:min(int(start.Character), len(edit.lines[line]))], "-"); dash >= 0 {
+			start.Character = uint32(dash)
+		}
+		symbol.SelectionRange = protocol.Range{
+			Start: start,
+			End:   protocol.Position{Line: start.Line, Character: utf16Length(edit.lines[line])},
+		}
+	}
+	symbol.Range = protocol.Range{Start: start, End: edit.nodeEnd(step)}
+	if symbol.Range.End.Line < symbol.SelectionRange.End.Line ||
+		(symbol.Range.End.Line == symbol.SelectionRange.End.Line && symbol.Range.End.Character < symbol.SelectionRange.End.Character) {
+		symbol.Range.End = symbol.SelectionRange.End
+	}
 
-		// Look for different step types
-		if strings.HasPrefix(line, "label:") || strings.HasPrefix(line, "- label:") {
-			if label := extractQuotedValue(line); label != "" {
-				stepLabel = label
-				stepType = "Command Step"
-			}
-		} else if strings.HasPrefix(line, "wait:") || line == "wait" || strings.HasPrefix(line, "- wait") {
-			stepType = "Wait"
-			stepLabel = "Wait Step"
-			stepKind = protocol.SymbolKindEvent
-			if value := extractQuotedValue(line); value != "" {
-				stepLabel = fmt.Sprintf("Wait: %s", value)
-			}
-		} else if strings.HasPrefix(line, "block:") || strings.HasPrefix(line, "- block:") {
-			stepType = "Block"
-			stepLabel = "Manual Approval"
-			stepKind = protocol.SymbolKindEvent
-			if value := extractQuotedValue(line); value != "" {
-				stepLabel = fmt.Sprintf("Block: %s", value)
-			}
-		} else if strings.HasPrefix(line, "input:") || strings.HasPrefix(line, "- input:") {
-			stepType = "Input"
-			stepLabel = "Input Step"
-			stepKind = protocol.SymbolKindEvent
-			if value := extractQuotedValue(line); value != "" {
-				stepLabel = fmt.Sprintf("Input: %s", value)
+	// Event steps are named by their type and the label given to them
+	named := func(detail, unlabeled, value string) {
+		symbol.Detail, symbol.Kind, symbol.Name = detail, protocol.SymbolKindEvent, unlabeled
+		if value != "" {
+			symbol.Name = fmt.Sprintf("%s: %s", detail, value)
+		}
+	}
+
+	switch step.Kind {
+	case yaml.ScalarNode:
+		switch step.Value {
+		case "wait", "waiter":
+			named("Wait", "Wait Step", "")
+		case "block":
+			named("Block", "Manual Approval", "")
+		case "input":
+			named("Input", "Input Step", "")
+		}
+	case yaml.MappingNode:
+		label := stringNodeValue(mappingValue(step, "label"))
+		if label == "" {
+			label = stringNodeValue(mappingValue(step, "name"))
+		}
+
+		switch {
+		case mappingKey(step, "group") != nil:
+			symbol.Detail, symbol.Kind, symbol.Name = "Group", protocol.SymbolKindNamespace, fmt.Sprintf("Group %d", index+1)
+			if group := stringNodeValue(mappingValue(step, "group")); group != "" {
+				symbol.Name = group
+			} else if label != "" {
+				symbol.Name = label
 			}
-		} else if strings.HasPrefix(line, "trigger:") || strings.HasPrefix(line, "- trigger:") {
-			stepType = "Trigger"
-			stepLabel = "Trigger Step"
-			stepKind = protocol.SymbolKindEvent
-			if value := extractQuotedValue(line); value != "" {
-				stepLabel = fmt.Sprintf("Trigger: %s", value)
+			symbol.Children = s.stepSymbols(edit, mappingValue(step, "steps"))
+		case mappingKey(step, "wait") != nil || mappingKey(step, "waiter") != nil:
+			named("Wait", "Wait Step", stringNodeValue(mappingValue(step, "wait")))
+		case mappingKey(step, "block") != nil:
+			named("Block", "Manual Approval", stringNodeValue(mappingValue(step, "block")))
+		case mappingKey(step, "input") != nil:
+			named("Input", "Input Step", stringNodeValue(mappingValue(step, "input")))
+		case mappingKey(step, "trigger") != nil:
+			named("Trigger", "Trigger Step", stringNodeValue(mappingValue(step, "trigger")))
+		case mappingKey(step, "command") != nil || mappingKey(step, "commands") != nil ||
+			mappingKey(step, "plugins") != nil || label != "":
+			symbol.Detail, symbol.Kind = "Command Step", protocol.SymbolKindFunction
+			if label != "" {
+				symbol.Name = label
 			}
 		}
 	}
 
-	return &protocol.DocumentSymbol{
-		Name: stepLabel,
-		Kind: stepKind,
-		Range: protocol.Range{
-			Start: protocol.Position{Line: uint32(startLine), Character: 0},
-			End:   protocol.Position{Line: uint32(endLine), Character: 0},
-		},
-		SelectionRange: protocol.Range{
-			Start: protocol.Position{Line: uint32(startLine), Character: 0},
-			End:   protocol.Position{Line: uint32(startLine), Character: uint32(len(lines[startLine]))},
-		},
-		Detail: stepType,
+	return symbol
+}
+
+// flattenSymbols lists document symbols for clients without hierarchical symbol support,
+// naming the symbols each is nested in as its container, e.g. "steps > Deploy"
+func flattenSymbols(uri protocol.DocumentURI, symbols []protocol.DocumentSymbol, container string) []protocol.SymbolInformation {
+	var flattened []protocol.SymbolInformation
+	for _, symbol := range symbols {
+		flattened = append(flattened, protocol.SymbolInformation{
+			Name:          symbol.Name,
+			Kind:          symbol.Kind,
+			Location:      protocol.Location{URI: uri, Range: symbol.Range},
+			ContainerName: container,
+		})
+
+		nested := symbol.Name
+		if container != "" {
+			nested = container + " > " + symbol.Name
+		}
+		flattened = append(flattened, flattenSymbols(uri, symbol.Children, nested)...)
 	}
+	return flattened
 }
 
 func (s *Server) extractEnvSymbol(lines []string) *protocol.DocumentSymbol {
@@ -1627,48 +2165,67 @@ func (s *Server) extractTopLevelSymbol(lines []string, property string, kind pro
 	return nil
 }
 
-// Helper function to extract quoted values from YAML lines
-func extractQuotedValue(line string) string {
-	// Look for quoted values after colon
-	if colonIndex := strings.Index(line, ":"); colonIndex != -1 {
-		afterColon := strings.TrimSpace(line[colonIndex+1:])
-		if len(afterColon) >= 2 && (afterColon[0] == '"' || afterColon[0] == '\'') {
-			quote := afterColon[0]
-			if endQuote := strings.LastIndex(afterColon, string(quote)); endQuote > 0 {
-				return afterColon[1:endQuote]
-			}
-		}
-		// Handle unquoted values
-		if afterColon != "" && !strings.HasPrefix(afterColon, "[") && !strings.HasPrefix(afterColon, "{") {
-			return afterColon
-		}
-	}
-	return ""
-}
-
 func (s *Server) validateDocument(ctx context.Context, uri protocol.DocumentURI, content string) {
 	if !s.isBuildkiteFile(string(uri)) {
 		return
 	}
 
+	if reason := s.contentLimitExceeded(content); reason != "" {
+		s.warnOversizedDocument(ctx, uri, reason)
+	}
+
+	start := time.Now()
+
+	// Organization-specific rules from external validators are published alongside our own
+	diagnostics, parseDuration := s.diagnoseTimed(uri, content)
+	diagnostics = append(diagnostics, s.runExternalValidators(ctx, uri, content)...)
+	diagnostics = s.identifyDiagnostics(content, diagnostics)
+	s.recordDiagnosticUsage(ctx, diagnostics)
+	s.sendDiagnostics(ctx, uri, diagnostics)
+	s.notifyDocumentValidated(ctx, uri, diagnostics, parseDuration, time.Since(start))
+}
+
+// Diagnose runs the full diagnostic pipeline - YAML parsing, schema validation and
+// pipeline checks - over a document's content. Checks that read the files around a
+// document, such as step templates and trigger cycles, are skipped as it has no location.
+func (s *Server) Diagnose(content string) []protocol.Diagnostic {
+	return s.diagnose("", content)
+}
+
+// diagnose runs the diagnostic pipeline for an open document, only revalidating the
+// steps that changed since its last validation. An empty URI disables the step cache.
+func (s *Server) diagnose(uri protocol.DocumentURI, content string) []protocol.Diagnostic {
+	diagnostics, _ := s.diagnoseTimed(uri, content)
+	return diagnostics
+}
+
+// diagnoseTimed runs diagnose, also reporting how long parsing the YAML took
+func (s *Server) diagnoseTimed(uri protocol.DocumentURI, content string) ([]protocol.Diagnostic, time.Duration) {
+	parseStart := time.Now()
 	pipeline, err := parser.ParseYAML([]byte(content))
-	if err != nil {
-		s.sendDiagnostics(ctx, uri, []protocol.Diagnostic{
-			{
-				Range: protocol.Range{
-					Start: protocol.Position{Line: 0, Character: 0},
-					End:   protocol.Position{Line: 0, Character: 0},
-				},
-				Severity: protocol.DiagnosticSeverityError,
-				Message:  "YAML parse error: " + err.Error(),
-			},
-		})
-		return
+	parseDuration := time.Since(parseStart)
+	return s.diagnoseParsed(uri, content, pipeline, err), parseDuration
+}
+
+// diagnoseParsed runs the diagnostic pipeline over a document's parse result
+func (s *Server) diagnoseParsed(uri protocol.DocumentURI, content string, pipeline *parser.Pipeline, parseErr error) []protocol.Diagnostic {
+	if parseErr != nil {
+		// Script lines dedented out of a block scalar are a common cause of parse errors
+		diagnostics := s.syntaxErrorDiagnostics(parseErr, content)
+		return append(diagnostics, s.validateBlockScalarIndentation(splitLines(content))...)
+	}
+
+	// A pipeline without steps yet gets one hint, not the schema's errors about the empty list
+	if diagnostic, ok := emptyStepsDiagnostic(pipeline); ok {
+		return []protocol.Diagnostic{diagnostic}
 	}
 
+	// Steps extending shared templates are validated as merged with them
+	templateDiagnostics := s.resolveTemplates(uri, pipeline)
+
 	validationErr, err := s.schemaLoader.ValidateJSON(pipeline.JSONBytes)
 	if err != nil {
-		s.sendDiagnostics(ctx, uri, []protocol.Diagnostic{
+		return []protocol.Diagnostic{
 			{
 				Range: protocol.Range{
 					Start: protocol.Position{Line: 0, Character: 0},
@@ -1677,48 +2234,167 @@ func (s *Server) validateDocument(ctx context.Context, uri protocol.DocumentURI,
 				Severity: protocol.DiagnosticSeverityError,
 				Message:  "Schema loading error: " + err.Error(),
 			},
-		})
-		return
+		}
 	}
 
 	if validationErr != nil {
 		line := pipeline.GetLineForError(validationErr.Message)
-		s.sendDiagnostics(ctx, uri, []protocol.Diagnostic{
+		severity := protocol.DiagnosticSeverityError
+		message := "Schema validation error: " + validationErr.Message
+		if validationErr.UnknownProperty && !s.schemaLoader.Version().Vendored() {
+			// The hand-maintained schema may leave out keys Buildkite accepts
+			severity = protocol.DiagnosticSeverityWarning
+			message += ". The bundled schema is a hand-maintained subset, so the key may still be valid"
+		}
+		diagnostics := []protocol.Diagnostic{
 			{
 				Range: protocol.Range{
 					Start: protocol.Position{Line: uint32(line - 1), Character: 0},
 					End:   protocol.Position{Line: uint32(line - 1), Character: 999},
 				},
-				Severity: protocol.DiagnosticSeverityError,
-				Message:  "Schema validation error: " + validationErr.Message,
+				Severity: severity,
+				Message:  message,
 			},
-		})
-		return
+		}
+		// The schema rejects bad retry rules, wait step options, notify entries,
+		// allow_dependency_failure values, trigger step keys, field keys and soft_fail entries
+		// without saying where they are
+		diagnostics = append(diagnostics, s.validateRetry(pipeline)...)
+		diagnostics = append(diagnostics, s.validateWaitSteps(pipeline, splitLines(content))...)
+		diagnostics = append(diagnostics, s.validateNotifyServices(pipeline)...)
+		diagnostics = append(diagnostics, s.validateDependencyFailure(pipeline)...)
+		diagnostics = append(diagnostics, s.validateTriggerSteps(pipeline)...)
+		diagnostics = append(diagnostics, s.validateBlockFields(uri, pipeline)...)
+		diagnostics = append(diagnostics, s.validateSoftFail(pipeline)...)
+		diagnostics = append(diagnostics, s.validateAnchors(pipeline)...)
+		return append(diagnostics, templateDiagnostics...)
+	}
+
+	// Oversized documents stop at structural errors, skipping the per-step checks
+	if reason := s.contentLimitExceeded(content); reason != "" {
+		s.logger.Printf("Skipping pipeline checks for oversized document (%s)", reason)
+		return nil
 	}
 
 	// All basic schema validation passed, now validate plugins
-	diagnostics := s.validatePlugins(pipeline)
+	var diagnostics []protocol.Diagnostic
+	if uri == "" {
+		diagnostics = s.validatePlugins(pipeline)
+	} else {
+		previous, generation := s.stepResults.get(uri)
+		var steps []validatedStep
+		diagnostics, steps = s.validatePipeline(pipeline, previous)
+		s.stepResults.set(uri, steps, generation)
+	}
+	diagnostics = append(diagnostics, templateDiagnostics...)
+	diagnostics = append(diagnostics, s.validateAnchors(pipeline)...)
+	diagnostics = append(diagnostics, s.validateArtifactFlow(uri, pipeline, splitLines(content))...)
+	diagnostics = append(diagnostics, s.validateStepOrder(uri, pipeline, splitLines(content))...)
+	diagnostics = append(diagnostics, s.validateDanglingDependencies(uri, pipeline)...)
+	diagnostics = append(diagnostics, s.validateUnknownDependencies(uri, pipeline)...)
+	diagnostics = append(diagnostics, s.validateDuplicatePlugins(uri, pipeline)...)
+	diagnostics = append(diagnostics, s.validateBlockFields(uri, pipeline)...)
+
+	// Plugin paths and trigger cycles are checked against the files around the document
+	if uri == "" {
+		return diagnostics
+	}
+	diagnostics = append(diagnostics, s.validatePluginPaths(uri, pipeline)...)
+	return append(diagnostics, s.validateTriggerCycles(uri, splitLines(content))...)
+}
 
-	// If no validation errors, send empty diagnostics to clear any existing ones
-	s.sendDiagnostics(ctx, uri, diagnostics)
+// syntaxErrorDiagnostics converts a YAML parse error into diagnostics at the reported positions
+func (s *Server) syntaxErrorDiagnostics(err error, content string) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	lines := documentLines(content)
+	for _, syntaxErr := range parser.SyntaxErrors(err, []byte(content)) {
+		line := 0
+		if syntaxErr.Line > 0 && syntaxErr.Line <= len(lines) {
+			line = syntaxErr.Line - 1
+		}
+
+		// Highlight from the reported column, or the first non-blank character, to the end of the line
+		lineText := ""
+		if line < len(lines) {
+			lineText = lines[line]
+		}
+		start := len(lineText) - len(strings.TrimLeft(lineText, " \t"))
+		if syntaxErr.Column > 0 && syntaxErr.Column-1 < len(lineText) {
+			start = syntaxErr.Column - 1
+		}
+
+		message := "YAML parse error: " + syntaxErr.Message
+		if syntaxErr.Hint != "" {
+			message += " (" + syntaxErr.Hint + ")"
+		}
+
+		diagnostics = append(diagnostics, protocol.Diagnostic{
+			Range: protocol.Range{
+				Start: protocol.Position{Line: uint32(line), Character: uint32(start)},
+				End:   protocol.Position{Line: uint32(line), Character: uint32(len(lineText))},
+			},
+			Severity: protocol.DiagnosticSeverityError,
+			Message:  message,
+			Source:   "buildkite-ls",
+			Code:     "yaml-syntax-error",
+		})
+	}
+
+	return diagnostics
 }
 
 func (s *Server) validatePlugins(pipeline *parser.Pipeline) []protocol.Diagnostic {
+	diagnostics, _ := s.validatePipeline(pipeline, nil)
+	return diagnostics
+}
+
+// validatePipeline runs the pipeline checks, reusing the per-step results in previous for
+// steps that haven't changed. It returns the per-step results to pass in next time.
+func (s *Server) validatePipeline(pipeline *parser.Pipeline, previous []validatedStep) ([]protocol.Diagnostic, []validatedStep) {
 	var diagnostics []protocol.Diagnostic
 
 	// Parse the pipeline JSON to extract steps with plugins
 	var pipelineData map[string]interface{}
 	if err := json.Unmarshal(pipeline.JSONBytes, &pipelineData); err != nil {
-		return diagnostics
+		return diagnostics, previous
 	}
 
 	// Enhanced validation with multiple checks
-	lines := strings.Split(string(pipeline.Content), "\n")
-	diagnostics = append(diagnostics, s.validatePipelineStructure(pipelineData, lines)...)
-	diagnostics = append(diagnostics, s.validateSteps(pipelineData, lines)...)
-	diagnostics = append(diagnostics, s.validatePluginConfigurations(pipelineData, lines)...)
+	lines := documentLines(string(pipeline.Content))
+	steps := s.validateStepsIncrementally(pipelineData, lines, previous)
 
-	return diagnostics
+	diagnostics = append(diagnostics, s.validatePipelineStructure(pipelineData, lines)...)
+	for _, step := range steps {
+		diagnostics = append(diagnostics, step.Structure...)
+	}
+	for _, step := range steps {
+		diagnostics = append(diagnostics, step.Plugins...)
+	}
+	diagnostics = append(diagnostics, s.validateMetaDataReferences(lines)...)
+	diagnostics = append(diagnostics, s.validateTimeouts(pipelineData, lines)...)
+	diagnostics = append(diagnostics, s.validateNumericValues(pipeline)...)
+	diagnostics = append(diagnostics, s.validateWaitDependencies(pipelineData, lines)...)
+	diagnostics = append(diagnostics, s.validateRedundancies(pipelineData, lines)...)
+	diagnostics = append(diagnostics, s.validateAllowedTeams(pipelineData, lines)...)
+	diagnostics = append(diagnostics, s.validateHostedQueues(pipelineData, lines)...)
+	diagnostics = append(diagnostics, s.validateAgentInterpolation(pipeline, lines)...)
+	diagnostics = append(diagnostics, s.validateAgentVersion(pipeline)...)
+	diagnostics = append(diagnostics, s.validatePipelineSettingKeys(pipelineData, lines)...)
+	diagnostics = append(diagnostics, s.validateNotifications(pipeline, lines)...)
+	diagnostics = append(diagnostics, s.validateNotifyServices(pipeline)...)
+	diagnostics = append(diagnostics, s.validateEnvValueTypes(pipeline)...)
+	diagnostics = append(diagnostics, s.validateRetry(pipeline)...)
+	diagnostics = append(diagnostics, s.validateSoftFail(pipeline)...)
+	diagnostics = append(diagnostics, s.validateWaitSteps(pipeline, lines)...)
+	diagnostics = append(diagnostics, s.validateConditions(pipeline, lines)...)
+	diagnostics = append(diagnostics, s.validateDependencyFailure(pipeline)...)
+	diagnostics = append(diagnostics, s.validateTriggerSteps(pipeline)...)
+	diagnostics = append(diagnostics, s.validateArtifactPaths(pipeline)...)
+	diagnostics = append(diagnostics, s.validateDockerPlugins(pipeline)...)
+	diagnostics = append(diagnostics, s.validateComplexity(pipeline, lines)...)
+
+	return diagnostics, steps
 }
 
 func (s *Server) validatePipelineStructure(pipelineData map[string]interface{}, lines []string) []protocol.Diagnostic {
@@ -1757,33 +2433,9 @@ func (s *Server) validatePipelineStructure(pipelineData map[string]interface{},
 		}
 	}
 
-	return diagnostics
-}
-
-func (s *Server) validateSteps(pipelineData map[string]interface{}, lines []string) []protocol.Diagnostic {
-	var diagnostics []protocol.Diagnostic
-
-	steps, ok := pipelineData["steps"].([]interface{})
-	if !ok {
-		return diagnostics
-	}
-
-	stepLines := s.findStepLines(lines)
-
-	for stepIndex, stepItem := range steps {
-		stepData, ok := stepItem.(map[string]interface{})
-		if !ok {
-			continue
-		}
-
-		// Get the actual line number for this step
-		lineNum := uint32(stepIndex)
-		if stepIndex < len(stepLines) {
-			lineNum = uint32(stepLines[stepIndex])
-		}
-
-		// Validate step structure
-		diagnostics = append(diagnostics, s.validateSingleStep(stepData, lineNum, stepIndex+1)...)
+	if notify, hasNotify := pipelineData["notify"]; hasNotify {
+		lineNum := s.findTopLevelProperty("notify", lines)
+		diagnostics = append(diagnostics, s.validateNotify(notify, pipelineNotifyTypes, uint32(lineNum), 0)...)
 	}
 
 	return diagnostics
@@ -1906,6 +2558,7 @@ func (s *Server) validateSingleStep(stepData map[string]interface{}, lineNum uin
 				Message:  "Use 'label' instead of 'name' - 'label' is the standard Buildkite field for step display names",
 				Source:   "buildkite-ls",
 				Code:     "use-label-not-name",
+				Tags:     []protocol.DiagnosticTag{protocol.DiagnosticTagDeprecated},
 			})
 		}
 
@@ -1997,12 +2650,200 @@ func (s *Server) validateSingleStep(stepData map[string]interface{}, lineNum uin
 		}
 	}
 
+	// Validate group steps
+	if hasGroup {
+		diagnostics = append(diagnostics, s.validateGroupStep(stepData, lineNum, stepNumber)...)
+	}
+
+	if notify, hasNotify := stepData["notify"]; hasNotify {
+		diagnostics = append(diagnostics, s.validateNotify(notify, stepNotifyTypes, lineNum, stepNumber)...)
+	}
+
+	return diagnostics
+}
+
+// pipelineNotifyTypes lists the notification services available on the pipeline-level notify
+var pipelineNotifyTypes = []string{
+	"slack",
+	"email",
+	"webhook",
+	"pagerduty_change_event",
+	"github_commit_status",
+	"github_check",
+	"basecamp_campfire",
+}
+
+// stepNotifyTypes lists the notification services available on a step-level notify
+var stepNotifyTypes = []string{
+	"slack",
+	"github_commit_status",
+	"github_check",
+	"basecamp_campfire",
+}
+
+// validateNotify checks each notify entry against the services allowed at its level.
+// A stepNumber of 0 means the pipeline-level notify.
+func (s *Server) validateNotify(notify interface{}, allowed []string, lineNum uint32, stepNumber int) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	entries, ok := notify.([]interface{})
+	if !ok {
+		return diagnostics
+	}
+
+	character := uint32(0)
+	if stepNumber > 0 {
+		character = 2
+	}
+
+	for _, entry := range entries {
+		var notifyType string
+		switch e := entry.(type) {
+		case string:
+			// Shorthand entries such as "- github_commit_status"
+			notifyType = e
+		case map[string]interface{}:
+			for key := range e {
+				if key != "if" {
+					notifyType = key
+					break
+				}
+			}
+		}
+		if notifyType == "" || slices.Contains(allowed, notifyType) {
+			continue
+		}
+
+		diagnostic := protocol.Diagnostic{
+			Range: protocol.Range{
+				Start: protocol.Position{Line: lineNum, Character: character},
+				End:   protocol.Position{Line: lineNum, Character: 999},
+			},
+			Source: "buildkite-ls",
+		}
+
+		switch {
+		case stepNumber > 0 && slices.Contains(pipelineNotifyTypes, notifyType):
+			diagnostic.Severity = protocol.DiagnosticSeverityError
+			diagnostic.Message = fmt.Sprintf("Step %d cannot use '%s' notifications - move it to the pipeline-level notify", stepNumber, notifyType)
+			diagnostic.Code = "pipeline-only-notify"
+		default:
+			diagnostic.Severity = protocol.DiagnosticSeverityWarning
+			diagnostic.Message = fmt.Sprintf("Unknown notification type '%s' - expected one of: %s", notifyType, strings.Join(allowed, ", "))
+			diagnostic.Code = "unknown-notify-type"
+		}
+
+		diagnostics = append(diagnostics, diagnostic)
+	}
+
+	return diagnostics
+}
+
+// groupStepKeys are the keys the bundled schema allows a group step to declare
+var groupStepKeys = schemaStepKeys("group")
+
+func (s *Server) validateGroupStep(stepData map[string]interface{}, lineNum uint32, stepNumber int) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	// Report keys that only make sense on the nested steps, in a stable order
+	var invalidKeys []string
+	for key := range stepData {
+		if !groupStepKeys[key] {
+			invalidKeys = append(invalidKeys, key)
+		}
+	}
+	sort.Strings(invalidKeys)
+
+	for _, key := range invalidKeys {
+		diagnostics = append(diagnostics, protocol.Diagnostic{
+			Range: protocol.Range{
+				Start: protocol.Position{Line: lineNum, Character: 2},
+				End:   protocol.Position{Line: lineNum, Character: 999},
+			},
+			Severity: protocol.DiagnosticSeverityError,
+			Message:  fmt.Sprintf("Group step %d cannot use '%s' - set it on the steps inside the group instead", stepNumber, key),
+			Source:   "buildkite-ls",
+			Code:     "invalid-group-key",
+		})
+	}
+
+	// Nested steps share the key namespace with the group itself, whichever alias sets it
+	groupKey := stepDataKey(stepData)
+	if groupKey == "" {
+		return diagnostics
+	}
+
+	nestedSteps, _ := stepData["steps"].([]interface{})
+	for _, nested := range nestedSteps {
+		nestedData, ok := nested.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if stepDataKey(nestedData) == groupKey {
+			diagnostics = append(diagnostics, protocol.Diagnostic{
+				Range: protocol.Range{
+					Start: protocol.Position{Line: lineNum, Character: 2},
+					End:   protocol.Position{Line: lineNum, Character: 999},
+				},
+				Severity: protocol.DiagnosticSeverityError,
+				Message:  fmt.Sprintf("Step inside group %d uses key '%s', which is already used by the group", stepNumber, groupKey),
+				Source:   "buildkite-ls",
+				Code:     "group-key-collision",
+			})
+		}
+	}
+
 	return diagnostics
 }
 
-func (s *Server) validatePluginConfigurations(pipelineData map[string]interface{}, lines []string) []protocol.Diagnostic {
+// validateStepPlugins checks the configuration of each plugin used by a step, reporting
+// whether a plugin's schema couldn't be looked up, so the result shouldn't be reused
+func (s *Server) validateStepPlugins(stepData map[string]interface{}, lineNum uint32) ([]protocol.Diagnostic, bool) {
+	var diagnostics []protocol.Diagnostic
+	unavailable := false
+
+	pluginRefs := plugins.ParsePluginFromStep(stepData)
+	for _, pluginRef := range pluginRefs {
+		if err := s.pluginRegistry.ValidatePluginConfig(pluginRef.Name, pluginRef.Config); err != nil {
+			var schemaErr *plugins.SchemaUnavailableError
+			unavailable = unavailable || errors.As(err, &schemaErr)
+			diagnostics = append(diagnostics, protocol.Diagnostic{
+				Range: protocol.Range{
+					Start: protocol.Position{Line: lineNum, Character: 0},
+					End:   protocol.Position{Line: lineNum, Character: 999},
+				},
+				Severity: protocol.DiagnosticSeverityError,
+				Message:  fmt.Sprintf("Plugin '%s' configuration error: %s", pluginRef.Name, err.Error()),
+				Source:   "buildkite-ls",
+				Code:     "plugin-config-error",
+			})
+		}
+	}
+
+	return diagnostics, unavailable
+}
+
+// validateTimeouts checks step timeouts against the pipeline-level default
+func (s *Server) validateTimeouts(pipelineData map[string]interface{}, lines []string) []protocol.Diagnostic {
 	var diagnostics []protocol.Diagnostic
 
+	pipelineTimeout, hasPipelineTimeout := timeoutMinutes(pipelineData)
+	if hasPipelineTimeout && pipelineTimeout <= 0 {
+		lineNum := s.findTopLevelProperty("timeout_in_minutes", lines)
+		diagnostics = append(diagnostics, protocol.Diagnostic{
+			Range: protocol.Range{
+				Start: protocol.Position{Line: uint32(lineNum), Character: 0},
+				End:   protocol.Position{Line: uint32(lineNum), Character: uint32(len(lines[lineNum]))},
+			},
+			Severity: protocol.DiagnosticSeverityError,
+			Message:  fmt.Sprintf("Pipeline timeout_in_minutes must be a positive number of minutes, got %d", pipelineTimeout),
+			Source:   "buildkite-ls",
+			Code:     "invalid-timeout",
+		})
+		hasPipelineTimeout = false
+	}
+
 	steps, ok := pipelineData["steps"].([]interface{})
 	if !ok {
 		return diagnostics
@@ -2012,36 +2853,186 @@ func (s *Server) validatePluginConfigurations(pipelineData map[string]interface{
 
 	for stepIndex, stepItem := range steps {
 		stepData, ok := stepItem.(map[string]interface{})
-		if !ok {
+		if !ok || stepIndex >= len(stepLines) {
 			continue
 		}
 
-		// Get the actual line number for this step
-		lineNum := uint32(stepIndex)
-		if stepIndex < len(stepLines) {
-			lineNum = uint32(stepLines[stepIndex])
+		stepTimeout, hasStepTimeout := timeoutMinutes(stepData)
+		if !hasStepTimeout {
+			continue
+		}
+
+		lineNum := s.findStepPropertyLine("timeout_in_minutes", lines, stepLines[stepIndex])
+		timeoutRange := protocol.Range{
+			Start: protocol.Position{Line: uint32(lineNum), Character: uint32(len(lines[lineNum]) - len(strings.TrimLeft(lines[lineNum], " -")))},
+			End:   protocol.Position{Line: uint32(lineNum), Character: uint32(len(lines[lineNum]))},
+		}
+
+		switch {
+		case stepTimeout <= 0:
+			diagnostics = append(diagnostics, protocol.Diagnostic{
+				Range:    timeoutRange,
+				Severity: protocol.DiagnosticSeverityError,
+				Message:  fmt.Sprintf("Step %d timeout_in_minutes must be a positive number of minutes, got %d", stepIndex+1, stepTimeout),
+				Source:   "buildkite-ls",
+				Code:     "invalid-timeout",
+			})
+		case hasPipelineTimeout && stepTimeout > pipelineTimeout:
+			diagnostics = append(diagnostics, protocol.Diagnostic{
+				Range:    timeoutRange,
+				Severity: protocol.DiagnosticSeverityWarning,
+				Message:  fmt.Sprintf("Step %d timeout of %d minutes exceeds the pipeline default of %d minutes", stepIndex+1, stepTimeout, pipelineTimeout),
+				Source:   "buildkite-ls",
+				Code:     "timeout-exceeds-default",
+			})
+		case hasPipelineTimeout && stepTimeout == pipelineTimeout:
+			diagnostics = append(diagnostics, protocol.Diagnostic{
+				Range:    timeoutRange,
+				Severity: protocol.DiagnosticSeverityHint,
+				Message:  fmt.Sprintf("Step %d timeout matches the pipeline default of %d minutes and can be removed", stepIndex+1, pipelineTimeout),
+				Source:   "buildkite-ls",
+				Code:     "redundant-timeout",
+				Tags:     []protocol.DiagnosticTag{protocol.DiagnosticTagUnnecessary},
+			})
 		}
+	}
+
+	return diagnostics
+}
+
+// validateRedundancies reports properties and steps that have no effect, tagged so
+// editors can fade them out
+func (s *Server) validateRedundancies(pipelineData map[string]interface{}, lines []string) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	steps, ok := pipelineData["steps"].([]interface{})
+	if !ok {
+		return diagnostics
+	}
+
+	pipelineEnv, _ := pipelineData["env"].(map[string]interface{})
+	stepLines := s.findStepLines(lines)
+
+	// Waits only order other steps, so skip the check while the pipeline has nothing else
+	hasOtherSteps := slices.ContainsFunc(steps, func(step interface{}) bool { return !isWaitStep(step) })
+
+	for stepIndex, stepItem := range steps {
+		if stepIndex >= len(stepLines) {
+			break
+		}
+		lineNum := stepLines[stepIndex]
+
+		// A wait with nothing before it, nothing after it, or straight after another wait does nothing
+		if isWaitStep(stepItem) {
+			if !hasOtherSteps {
+				continue
+			}
+
+			first := stepIndex == 0
+			last := stepIndex == len(steps)-1
+			if first || last || isWaitStep(steps[stepIndex-1]) {
+				reason := "directly follows another wait step"
+				switch {
+				case first:
+					reason = "is the first step, so there is nothing to wait for"
+				case last:
+					reason = "is the last step, so nothing runs after it"
+				}
 
-		pluginRefs := plugins.ParsePluginFromStep(stepData)
-		for _, pluginRef := range pluginRefs {
-			if err := s.pluginRegistry.ValidatePluginConfig(pluginRef.Name, pluginRef.Config); err != nil {
 				diagnostics = append(diagnostics, protocol.Diagnostic{
 					Range: protocol.Range{
-						Start: protocol.Position{Line: lineNum, Character: 0},
-						End:   protocol.Position{Line: lineNum, Character: 999},
+						Start: protocol.Position{Line: uint32(lineNum), Character: 2},
+						End:   protocol.Position{Line: uint32(lineNum), Character: uint32(len(lines[lineNum]))},
 					},
-					Severity: protocol.DiagnosticSeverityError,
-					Message:  fmt.Sprintf("Plugin '%s' configuration error: %s", pluginRef.Name, err.Error()),
+					Severity: protocol.DiagnosticSeverityHint,
+					Message:  fmt.Sprintf("Wait step %d has no effect - it %s", stepIndex+1, reason),
 					Source:   "buildkite-ls",
-					Code:     "plugin-config-error",
+					Code:     "noop-wait",
+					Tags:     []protocol.DiagnosticTag{protocol.DiagnosticTagUnnecessary},
 				})
 			}
+			continue
+		}
+
+		stepData, ok := stepItem.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		// Step env entries that repeat the pipeline env are inherited anyway
+		stepEnv, _ := stepData["env"].(map[string]interface{})
+		envKeys := make([]string, 0, len(stepEnv))
+		for key := range stepEnv {
+			envKeys = append(envKeys, key)
+		}
+		sort.Strings(envKeys)
+
+		for _, key := range envKeys {
+			pipelineValue, inherited := pipelineEnv[key]
+			if !inherited || fmt.Sprint(pipelineValue) != fmt.Sprint(stepEnv[key]) {
+				continue
+			}
+
+			envLine := s.findStepPropertyLine(key, lines, lineNum)
+			diagnostics = append(diagnostics, protocol.Diagnostic{
+				Range: protocol.Range{
+					Start: protocol.Position{Line: uint32(envLine), Character: uint32(len(lines[envLine]) - len(strings.TrimLeft(lines[envLine], " -")))},
+					End:   protocol.Position{Line: uint32(envLine), Character: uint32(len(lines[envLine]))},
+				},
+				Severity: protocol.DiagnosticSeverityHint,
+				Message:  fmt.Sprintf("Step %d sets %s to the same value as the pipeline env", stepIndex+1, key),
+				Source:   "buildkite-ls",
+				Code:     "redundant-env",
+				Tags:     []protocol.DiagnosticTag{protocol.DiagnosticTagUnnecessary},
+			})
 		}
 	}
 
 	return diagnostics
 }
 
+// isWaitStep reports whether a step is only a wait step, in either the "wait" string or map form
+func isWaitStep(step interface{}) bool {
+	switch v := step.(type) {
+	case string:
+		return v == "wait"
+	case map[string]interface{}:
+		if _, hasWait := v["wait"]; !hasWait {
+			return false
+		}
+		for _, stepType := range []string{"command", "commands", "block", "input", "trigger", "group"} {
+			if v[stepType] != nil {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// timeoutMinutes reads a numeric timeout_in_minutes value
+func timeoutMinutes(data map[string]interface{}) (int, bool) {
+	timeout, ok := data["timeout_in_minutes"].(float64)
+	if !ok {
+		return 0, false
+	}
+	return int(timeout), true
+}
+
+// Helper function to find the line of a property within the step starting at stepLine
+func (s *Server) findStepPropertyLine(property string, lines []string, stepLine int) int {
+	stepIndent := s.stepIndentOf(lines)
+	for i := stepLine; i < len(lines); i++ {
+		if i > stepLine && s.isStepLine(lines[i], stepIndent) {
+			break
+		}
+		if yamlKey(lines[i]) == property {
+			return i
+		}
+	}
+	return stepLine
+}
+
 // Helper function to find the line number for a top-level property
 func (s *Server) findLineForProperty(property string, lines []string) int {
 	for i, line := range lines {
@@ -2054,10 +3045,21 @@ func (s *Server) findLineForProperty(property string, lines []string) int {
 	return len(lines) - 1
 }
 
+// Helper function to find the line number for an unindented top-level property
+func (s *Server) findTopLevelProperty(property string, lines []string) int {
+	for i, line := range lines {
+		if strings.HasPrefix(line, property+":") {
+			return i
+		}
+	}
+	return len(lines) - 1
+}
+
 // Helper function to find the line numbers where steps begin
 func (s *Server) findStepLines(lines []string) []int {
 	var stepLines []int
 	inSteps := false
+	stepIndent := s.stepIndentOf(lines)
 
 	for i, line := range lines {
 		trimmed := strings.TrimSpace(line)
@@ -2074,12 +3076,8 @@ func (s *Server) findStepLines(lines []string) []int {
 		}
 
 		// Look for step indicators (- at step level indentation)
-		if inSteps && strings.HasPrefix(strings.TrimLeft(line, " \t"), "- ") {
-			// Check if this is at the correct step indentation level (2 spaces)
-			leadingSpaces := len(line) - len(strings.TrimLeft(line, " "))
-			if leadingSpaces == 2 {
-				stepLines = append(stepLines, i)
-			}
+		if inSteps && s.isStepLine(line, stepIndent) {
+			stepLines = append(stepLines, i)
 		}
 	}
 
@@ -2087,12 +3085,26 @@ func (s *Server) findStepLines(lines []string) []int {
 }
 
 func (s *Server) isBuildkiteFile(uri string) bool {
+	if s.isMarkedPipeline(protocol.DocumentURI(uri)) {
+		return true
+	}
+
+	// Unsaved buffers have no path to go on
+	if isUntitledURI(uri) {
+		return s.Settings().UntitledPipelines
+	}
+
 	// Convert URI to file path (remove file:// prefix if present)
 	filePath := uri
 	if strings.HasPrefix(uri, "file://") {
 		filePath = strings.TrimPrefix(uri, "file://")
 	}
 
+	// Template files hold step templates, not pipelines
+	if isTemplateFile(filePath) {
+		return false
+	}
+
 	// Check if file is in .buildkite directory and is YAML
 	if strings.Contains(filePath, ".buildkite/") {
 		return strings.HasSuffix(filePath, ".yml") || strings.HasSuffix(filePath, ".yaml")
@@ -2101,7 +3113,8 @@ func (s *Server) isBuildkiteFile(uri string) bool {
 	// Check for standalone pipeline files (common pattern)
 	fileName := filepath.Base(filePath)
 	return fileName == "pipeline.yml" || fileName == "pipeline.yaml" ||
-		fileName == "buildkite.yml" || fileName == "buildkite.yaml"
+		fileName == "buildkite.yml" || fileName == "buildkite.yaml" ||
+		pipelineVariant(fileName) != ""
 }
 
 func (s *Server) sendDiagnostics(ctx context.Context, uri protocol.DocumentURI, diagnostics []protocol.Diagnostic) {
@@ -2117,6 +3130,12 @@ func (s *Server) sendDiagnostics(ctx context.Context, uri protocol.DocumentURI,
 		diagnostics = []protocol.Diagnostic{}
 	}
 
+	// Republishing an identical set makes clients redraw their problems list for nothing
+	if !s.published.changed(uri, diagnostics) {
+		s.logger.Printf("Diagnostics for %s are unchanged, not republishing", uri)
+		return
+	}
+
 	// Send diagnostics notification to client
 	params := protocol.PublishDiagnosticsParams{
 		URI:         uri,
@@ -2145,6 +3164,12 @@ func (s *Server) SemanticTokensFull(ctx context.Context, params *protocol.Semant
 		return &protocol.SemanticTokens{Data: []uint32{}}, nil
 	}
 
+	// Oversized documents are only highlighted through range requests
+	if reason := s.Settings().documentLimitExceeded(len(doc.Content), len(doc.Lines)); reason != "" {
+		s.logger.Printf("Skipping full semantic tokens for oversized document (%s)", reason)
+		return &protocol.SemanticTokens{Data: []uint32{}}, nil
+	}
+
 	// Generate semantic tokens
 	tokens := s.generateSemanticTokens(doc.Lines)
 
@@ -2178,33 +3203,46 @@ func (s *Server) SemanticTokensRange(ctx context.Context, params *protocol.Seman
 		return &protocol.SemanticTokens{Data: []uint32{}}, nil
 	}
 
-	rangeLines := doc.Lines[startLine : endLine+1]
-
 	// Generate semantic tokens for the range
-	tokens := s.generateSemanticTokensForRange(rangeLines, startLine)
+	tokens := s.generateSemanticTokensForRange(doc.Lines, startLine, endLine)
 
 	s.logger.Printf("Generated %d semantic tokens for range", len(tokens.Data)/5)
 	return tokens, nil
 }
 
 func (s *Server) generateSemanticTokens(lines []string) *protocol.SemanticTokens {
-	return s.generateSemanticTokensForRange(lines, 0)
+	return s.generateSemanticTokensForRange(lines, 0, len(lines)-1)
 }
 
-func (s *Server) generateSemanticTokensForRange(lines []string, startLineOffset int) *protocol.SemanticTokens {
+// generateSemanticTokensForRange tokenizes the document's lines from startLine to endLine.
+// Blocks are found in the whole document, so a range starting inside one is still
+// highlighted as part of it.
+func (s *Server) generateSemanticTokensForRange(lines []string, startLine, endLine int) *protocol.SemanticTokens {
 	var data []uint32
+	stepIndent := s.stepIndentOf(lines)
 
 	// Track context
 	inSteps := false
 	inStep := false
-	stepIndent := -1
+
+	// Keys inside kubernetes podSpec blocks are Kubernetes fields, not Buildkite properties
+	podSpecLines := make(map[int]bool)
+	for _, block := range s.findPodSpecBlocks(lines) {
+		for i := block.start + 1; i <= block.end; i++ {
+			podSpecLines[i] = true
+		}
+	}
+
+	// Entries under plugins name plugins even without a version
+	pluginLines := s.pluginEntryLines(lines)
 
 	prevLine := uint32(0)
 	prevStart := uint32(0)
 
-	for lineIndex, line := range lines {
-		actualLineNumber := uint32(lineIndex + startLineOffset)
-		lineTokens := s.tokenizeLine(line, actualLineNumber, &inSteps, &inStep, &stepIndent)
+	for lineIndex := startLine; lineIndex <= endLine; lineIndex++ {
+		line := lines[lineIndex]
+		actualLineNumber := uint32(lineIndex)
+		lineTokens := s.tokenizeLine(line, actualLineNumber, &inSteps, &inStep, &stepIndent, podSpecLines[lineIndex], pluginLines[lineIndex])
 
 		// Convert absolute positions to relative (LSP semantic tokens format)
 		for i := 0; i < len(lineTokens); i += 5 {
@@ -2233,7 +3271,40 @@ func (s *Server) generateSemanticTokensForRange(lines []string, startLineOffset
 	}
 }
 
-func (s *Server) tokenizeLine(line string, lineNumber uint32, inSteps *bool, inStep *bool, stepIndent *int) []uint32 {
+// pluginEntryLines finds the lines naming a plugin: the entries directly under a plugins key,
+// in list or map form
+func (s *Server) pluginEntryLines(lines []string) map[int]bool {
+	entries := make(map[int]bool)
+
+	for i, line := range lines {
+		if yamlKey(line) != "plugins" {
+			continue
+		}
+
+		parentIndent := s.getIndentLevel(line)
+		entryIndent := -1
+		for j := i + 1; j < len(lines); j++ {
+			trimmed := strings.TrimSpace(lines[j])
+			if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+				continue
+			}
+			indent := s.getIndentLevel(lines[j])
+			if indent < parentIndent || (indent == parentIndent && !strings.HasPrefix(trimmed, "- ")) {
+				break
+			}
+			if entryIndent == -1 {
+				entryIndent = indent
+			}
+			if indent == entryIndent && yamlKey(lines[j]) != "" {
+				entries[j] = true
+			}
+		}
+	}
+
+	return entries
+}
+
+func (s *Server) tokenizeLine(line string, lineNumber uint32, inSteps *bool, inStep *bool, stepIndent *int, inPodSpec bool, pluginEntry bool) []uint32 {
 	var tokens []uint32
 
 	trimmed := strings.TrimSpace(line)
@@ -2266,9 +3337,8 @@ func (s *Server) tokenizeLine(line string, lineNumber uint32, inSteps *bool, inS
 	}
 
 	// Check if we're starting a new step
-	if *inSteps && strings.HasPrefix(strings.TrimLeft(line, " \t"), "- ") && indent == 2 {
+	if *inSteps && strings.HasPrefix(strings.TrimLeft(line, " \t"), "- ") && indent == *stepIndent {
 		*inStep = true
-		*stepIndent = indent
 
 		// Highlight the step dash as operator
 		dashPos := strings.Index(line, "- ")
@@ -2289,18 +3359,39 @@ func (s *Server) tokenizeLine(line string, lineNumber uint32, inSteps *bool, inS
 	}
 
 	// Parse YAML key-value pairs
-	if colonIndex := strings.Index(line, ":"); colonIndex != -1 {
-		keyStart := 0
-		for keyStart < len(line) && (line[keyStart] == ' ' || line[keyStart] == '\t') {
+	keyStart := 0
+	for keyStart < len(line) && (line[keyStart] == ' ' || line[keyStart] == '\t') {
+		keyStart++
+	}
+	dashPos := -1
+	if strings.HasPrefix(line[keyStart:], "- ") {
+		dashPos = keyStart
+		keyStart += 2
+		for keyStart < len(line) && line[keyStart] == ' ' {
 			keyStart++
 		}
+	}
 
+	if colonOffset := bkcontext.KeyColon(line[keyStart:]); colonOffset != -1 {
+		colonIndex := keyStart + colonOffset
 		key := strings.TrimSpace(line[keyStart:colonIndex])
 		value := strings.TrimSpace(line[colonIndex+1:])
 
+		// Highlight the list item dash
+		if dashPos >= 0 {
+			tokens = append(tokens, s.createToken(lineNumber, uint32(dashPos), 1, "operator", nil)...)
+		}
+
 		// Determine token types based on context and key
 		keyTokenType := s.getKeyTokenType(key, *inStep)
 		keyModifiers := s.getKeyModifiers(key, *inStep)
+		if pluginEntry {
+			keyTokenType = "function"
+		}
+		if inPodSpec {
+			keyTokenType = "struct"
+			keyModifiers = nil
+		}
 
 		// Highlight the key
 		tokens = append(tokens, s.createToken(lineNumber, uint32(keyStart), uint32(len(key)), keyTokenType, keyModifiers)...)
@@ -2329,7 +3420,7 @@ func (s *Server) parseStepContent(content string, line uint32, startChar uint32)
 	var tokens []uint32
 
 	// Check if this is a step type definition on the same line (e.g., "- command: make build")
-	if colonIndex := strings.Index(content, ":"); colonIndex != -1 {
+	if colonIndex := bkcontext.KeyColon(content); colonIndex != -1 {
 		key := strings.TrimSpace(content[:colonIndex])
 		value := strings.TrimSpace(content[colonIndex+1:])
 
@@ -2381,7 +3472,7 @@ func (s *Server) getKeyTokenType(key string, inStep bool) string {
 	}
 
 	// Plugin-related
-	if key == "plugins" || strings.Contains(key, "#") {
+	if key == "plugins" || plugins.IsPluginReference(strings.Trim(key, `"'`)) {
 		return "function"
 	}
 
@@ -2416,8 +3507,8 @@ func (s *Server) getValueTokenType(key string, value string, inStep bool) (strin
 	// Remove quotes from value for analysis
 	cleanValue := strings.Trim(value, `"'`)
 
-	// Plugin names (contain #)
-	if strings.Contains(cleanValue, "#") {
+	// Plugin references, e.g. in a plugins list of names
+	if plugins.IsPluginReference(cleanValue) {
 		return "function", modifiers
 	}
 
@@ -2459,7 +3550,7 @@ func (s *Server) createToken(line, start, length uint32, tokenType string, modif
 
 func (s *Server) getTokenTypeIndex(tokenType string) int {
 	tokenTypes := []string{
-		"keyword", "string", "property", "variable", "function", "namespace", "operator", "comment",
+		"keyword", "string", "property", "variable", "function", "namespace", "operator", "comment", "struct",
 	}
 
 	for i, t := range tokenTypes {
@@ -2486,9 +3577,16 @@ func (s *Server) getTokenModifierBits(modifiers []string) int {
 	return bits
 }
 
+// Handler dispatches JSON-RPC messages to the server's handlers. List results are sent as
+// empty lists rather than null, as results.go describes.
 func (s *Server) Handler() jsonrpc2.Handler {
 	return func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		// Everything logged while handling the message is tagged with its ID and method
+		defer s.logs.begin(req)()
 		s.logger.Printf("Received method: %s", req.Method())
+		defer s.traceRequest(ctx, req, time.Now())
+		s.recordFeatureUsage(ctx, req.Method())
+
 		switch req.Method() {
 		case "initialize":
 			var params protocol.InitializeParams
@@ -2512,13 +3610,29 @@ func (s *Server) Handler() jsonrpc2.Handler {
 			err := s.Initialized(ctx, &params)
 			return reply(ctx, nil, err)
 
+		case "workspace/didChangeConfiguration":
+			var params protocol.DidChangeConfigurationParams
+			if err := json.Unmarshal(req.Params(), &params); err != nil {
+				return reply(ctx, nil, err)
+			}
+			err := s.DidChangeConfiguration(ctx, &params)
+			return reply(ctx, nil, err)
+
+		case "workspace/didChangeWatchedFiles":
+			var params protocol.DidChangeWatchedFilesParams
+			if err := json.Unmarshal(req.Params(), &params); err != nil {
+				return reply(ctx, nil, err)
+			}
+			err := s.DidChangeWatchedFiles(ctx, &params)
+			return reply(ctx, nil, err)
+
 		case "shutdown":
 			err := s.Shutdown(ctx)
 			return reply(ctx, nil, err)
 
 		case "exit":
-			_ = s.Exit(ctx)
-			return nil
+			err := s.Exit(ctx)
+			return reply(ctx, nil, err)
 
 		case "textDocument/didOpen":
 			var params protocol.DidOpenTextDocumentParams
@@ -2529,7 +3643,7 @@ func (s *Server) Handler() jsonrpc2.Handler {
 			return reply(ctx, nil, err)
 
 		case "textDocument/didChange":
-			var params protocol.DidChangeTextDocumentParams
+			var params DidChangeParams
 			if err := json.Unmarshal(req.Params(), &params); err != nil {
 				return reply(ctx, nil, err)
 			}
@@ -2566,6 +3680,14 @@ func (s *Server) Handler() jsonrpc2.Handler {
 				len(result.Items), err)
 			return reply(ctx, result, err)
 
+		case "completionItem/resolve":
+			var params protocol.CompletionItem
+			if err := json.Unmarshal(req.Params(), &params); err != nil {
+				return reply(ctx, nil, err)
+			}
+			result, err := s.ResolveCompletionItem(ctx, &params)
+			return reply(ctx, result, err)
+
 		case "textDocument/documentSymbol":
 			s.logger.Printf("Received textDocument/documentSymbol request")
 			var params protocol.DocumentSymbolParams
@@ -2577,7 +3699,10 @@ func (s *Server) Handler() jsonrpc2.Handler {
 			result, err := s.DocumentSymbol(ctx, &params)
 			s.logger.Printf("DocumentSymbol result: %d symbols, error: %v",
 				len(result), err)
-			return reply(ctx, result, err)
+			if err == nil && !s.ClientFeatures().HierarchicalSymbols {
+				return reply(ctx, listResult(flattenSymbols(params.TextDocument.URI, result, "")), nil)
+			}
+			return reply(ctx, listResult(result), err)
 
 		case "textDocument/signatureHelp":
 			s.logger.Printf("Received textDocument/signatureHelp request")
@@ -2607,7 +3732,23 @@ func (s *Server) Handler() jsonrpc2.Handler {
 			result, err := s.Definition(ctx, &params)
 			s.logger.Printf("Definition result: %d locations, error: %v",
 				len(result), err)
-			return reply(ctx, result, err)
+			return reply(ctx, listResult(result), err)
+
+		case "textDocument/onTypeFormatting":
+			var params protocol.DocumentOnTypeFormattingParams
+			if err := json.Unmarshal(req.Params(), &params); err != nil {
+				return reply(ctx, nil, err)
+			}
+			result, err := s.OnTypeFormatting(ctx, &params)
+			return reply(ctx, listResult(result), err)
+
+		case "textDocument/documentLink":
+			var params protocol.DocumentLinkParams
+			if err := json.Unmarshal(req.Params(), &params); err != nil {
+				return reply(ctx, nil, err)
+			}
+			result, err := s.DocumentLink(ctx, &params)
+			return reply(ctx, listResult(result), err)
 
 		case "textDocument/codeAction":
 			s.logger.Printf("Received textDocument/codeAction request")
@@ -2620,8 +3761,103 @@ func (s *Server) Handler() jsonrpc2.Handler {
 			result, err := s.CodeAction(ctx, &params)
 			s.logger.Printf("CodeAction result: %d actions, error: %v",
 				len(result), err)
+			return reply(ctx, listResult(result), err)
+
+		case "workspace/symbol":
+			s.logger.Printf("Received workspace/symbol request")
+			var params protocol.WorkspaceSymbolParams
+			if err := json.Unmarshal(req.Params(), &params); err != nil {
+				s.logger.Printf("Error unmarshaling workspace symbol params: %v", err)
+				return reply(ctx, nil, err)
+			}
+			result, err := s.WorkspaceSymbol(ctx, &params)
+			s.logger.Printf("WorkspaceSymbol result: %d symbols, error: %v",
+				len(result), err)
+			return reply(ctx, listResult(result), err)
+
+		case PluginUsagesMethod:
+			s.logger.Printf("Received %s request", PluginUsagesMethod)
+			var params PluginUsagesParams
+			if err := json.Unmarshal(req.Params(), &params); err != nil {
+				s.logger.Printf("Error unmarshaling plugin usages params: %v", err)
+				return reply(ctx, nil, err)
+			}
+			result, err := s.PluginUsages(ctx, &params)
+			s.logger.Printf("PluginUsages result: %d usages, error: %v",
+				len(result), err)
+			return reply(ctx, listResult(result), err)
+
+		case "workspace/executeCommand":
+			s.logger.Printf("Received workspace/executeCommand request")
+			var params protocol.ExecuteCommandParams
+			if err := json.Unmarshal(req.Params(), &params); err != nil {
+				s.logger.Printf("Error unmarshaling execute command params: %v", err)
+				return reply(ctx, nil, err)
+			}
+			result, err := s.ExecuteCommand(ctx, &params)
+			s.logger.Printf("ExecuteCommand %s error: %v", params.Command, err)
+			return reply(ctx, result, err)
+
+		case StepRangeAtMethod:
+			var params protocol.TextDocumentPositionParams
+			if err := json.Unmarshal(req.Params(), &params); err != nil {
+				return reply(ctx, nil, err)
+			}
+			result, err := s.StepRangeAt(ctx, &params)
 			return reply(ctx, result, err)
 
+		case MatrixPreviewMethod:
+			var params protocol.TextDocumentPositionParams
+			if err := json.Unmarshal(req.Params(), &params); err != nil {
+				return reply(ctx, nil, err)
+			}
+			result, err := s.MatrixPreview(ctx, &params)
+			return reply(ctx, result, err)
+
+		case PipelineOverviewMethod:
+			var params PipelineOverviewParams
+			if err := json.Unmarshal(req.Params(), &params); err != nil {
+				return reply(ctx, nil, err)
+			}
+			result, err := s.PipelineOverview(ctx, &params)
+			return reply(ctx, result, err)
+
+		case DryRunMethod:
+			var params DryRunParams
+			if err := json.Unmarshal(req.Params(), &params); err != nil {
+				return reply(ctx, nil, err)
+			}
+			result, err := s.DryRun(ctx, &params)
+			return reply(ctx, result, err)
+
+		case ServerStatusMethod:
+			var params ServerStatusParams
+			if err := json.Unmarshal(req.Params(), &params); err != nil {
+				return reply(ctx, nil, err)
+			}
+			result, err := s.ServerStatus(ctx, &params)
+			return reply(ctx, result, err)
+
+		case MarkPipelineMethod:
+			var params MarkPipelineParams
+			if err := json.Unmarshal(req.Params(), &params); err != nil {
+				return reply(ctx, nil, err)
+			}
+			err := s.MarkPipeline(ctx, &params)
+			return reply(ctx, nil, err)
+
+		case "textDocument/foldingRange":
+			s.logger.Printf("Received textDocument/foldingRange request")
+			var params protocol.FoldingRangeParams
+			if err := json.Unmarshal(req.Params(), &params); err != nil {
+				s.logger.Printf("Error unmarshaling folding range params: %v", err)
+				return reply(ctx, nil, err)
+			}
+			result, err := s.FoldingRanges(ctx, &params)
+			s.logger.Printf("FoldingRanges result: %d ranges, error: %v",
+				len(result), err)
+			return reply(ctx, listResult(result), err)
+
 		case "textDocument/semanticTokens/full":
 			s.logger.Printf("Received textDocument/semanticTokens/full request")
 			var params protocol.SemanticTokensParams
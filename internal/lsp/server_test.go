@@ -50,7 +50,7 @@ func TestServer_Initialize(t *testing.T) {
 		t.Error("Expected completion trigger characters")
 	}
 
-	expectedTriggers := []string{" ", ":", "-"}
+	expectedTriggers := []string{" ", ":", "-", "/"}
 	for _, expected := range expectedTriggers {
 		found := false
 		for _, trigger := range caps.CompletionProvider.TriggerCharacters {
@@ -137,14 +137,14 @@ func TestServer_DidChange(t *testing.T) {
 	}
 
 	// Now change the document
-	changeParams := &protocol.DidChangeTextDocumentParams{
+	changeParams := &DidChangeParams{
 		TextDocument: protocol.VersionedTextDocumentIdentifier{
 			TextDocumentIdentifier: protocol.TextDocumentIdentifier{
 				URI: "file:///test.yml",
 			},
 			Version: 2,
 		},
-		ContentChanges: []protocol.TextDocumentContentChangeEvent{
+		ContentChanges: []ContentChange{
 			{
 				Text: "steps:\n  - label: \"updated\"",
 			},
@@ -167,6 +167,49 @@ func TestServer_DidChange(t *testing.T) {
 	}
 }
 
+func TestServer_DidChange_MultipleChanges(t *testing.T) {
+	server := newTestServer()
+	ctx := context.Background()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+
+	err := server.DidOpen(ctx, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: uri, LanguageID: "yaml", Version: 1, Text: "steps:\n  - label: \"Test\"\n    command: make test"},
+	})
+	if err != nil {
+		t.Fatalf("DidOpen failed: %v", err)
+	}
+
+	// A batch of incremental edits, such as a client sends after a multi-cursor change
+	err = server.DidChange(ctx, &DidChangeParams{
+		TextDocument: protocol.VersionedTextDocumentIdentifier{
+			TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri},
+			Version:                2,
+		},
+		ContentChanges: []ContentChange{
+			{
+				Range: &protocol.Range{Start: protocol.Position{Line: 2, Character: 22}, End: protocol.Position{Line: 2, Character: 22}},
+				Text:  "\n  - label: \"Lint\"\n    command: make lint",
+			},
+			{
+				Range: &protocol.Range{Start: protocol.Position{Line: 1, Character: 12}, End: protocol.Position{Line: 1, Character: 16}},
+				Text:  "Unit tests",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("DidChange failed: %v", err)
+	}
+
+	doc, _ := server.documentManager.GetDocument(uri)
+	expected := "steps:\n  - label: \"Unit tests\"\n    command: make test\n  - label: \"Lint\"\n    command: make lint"
+	if doc.Content != expected {
+		t.Errorf("Expected both changes applied, got %q", doc.Content)
+	}
+	if doc.Version != 2 {
+		t.Errorf("Expected version 2, got %d", doc.Version)
+	}
+}
+
 func TestServer_DidClose(t *testing.T) {
 	server := newTestServer()
 
@@ -537,6 +580,7 @@ func TestServer_isBuildkiteFile(t *testing.T) {
 		{"file:///project/buildkite.yml", true},
 		{"file:///project/buildkite.yaml", true},
 		{"file:///project/pipeline.yml", true}, // This should be true - standalone pipeline files are valid
+		{"file:///project/pipeline.deploy.yml", true},
 		{"file:///project/other.yml", false},
 		{"file:///project/test.json", false},
 	}
@@ -759,8 +803,8 @@ func TestServer_DocumentSymbol_SimpleSteps(t *testing.T) {
 			t.Errorf("Step %d expected type 'Command Step', got '%s'", i, child.Detail)
 		}
 
-		if child.Kind != protocol.SymbolKindObject {
-			t.Errorf("Step %d expected kind Object, got %v", i, child.Kind)
+		if child.Kind != protocol.SymbolKindFunction {
+			t.Errorf("Step %d expected kind Function, got %v", i, child.Kind)
 		}
 	}
 }
@@ -958,3 +1002,66 @@ func TestServer_DocumentSymbol_InvalidYAML(t *testing.T) {
 		t.Error("Expected no symbols for invalid YAML")
 	}
 }
+
+func TestServer_DocumentSymbol_Groups(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	server.documentManager.OpenDocument(uri, 1, `steps:
+  - label: Build
+    command: make
+  - wait
+  - group: Deploy group
+    steps:
+      - label: Run migrations
+        command: make migrate
+      - block: "Ship it?"
+  - command: make report`)
+
+	symbols, err := server.DocumentSymbol(context.Background(), &protocol.DocumentSymbolParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+	})
+	if err != nil || len(symbols) != 1 {
+		t.Fatalf("Expected a steps symbol, got %+v (%v)", symbols, err)
+	}
+
+	steps := symbols[0]
+	if steps.Name != "steps" || steps.Detail != "4 steps" || len(steps.Children) != 4 {
+		t.Fatalf("Expected a steps symbol with 4 children, got %s (%s) with %d", steps.Name, steps.Detail, len(steps.Children))
+	}
+
+	group := steps.Children[2]
+	if group.Name != "Deploy group" || group.Kind != protocol.SymbolKindNamespace || len(group.Children) != 2 {
+		t.Fatalf("Expected the group as a namespace holding its 2 steps, got %+v", group)
+	}
+	if group.Range.Start.Line != 4 || group.Range.End.Line != 8 {
+		t.Errorf("Expected the group to span lines 4-8, got %d-%d", group.Range.Start.Line, group.Range.End.Line)
+	}
+
+	expected := []struct {
+		name string
+		kind protocol.SymbolKind
+	}{
+		{"Run migrations", protocol.SymbolKindFunction},
+		{"Block: Ship it?", protocol.SymbolKindEvent},
+	}
+	for i, want := range expected {
+		if got := group.Children[i]; got.Name != want.name || got.Kind != want.kind {
+			t.Errorf("Group step %d: expected %s (%v), got %s (%v)", i, want.name, want.kind, got.Name, got.Kind)
+		}
+	}
+	if unlabeled := steps.Children[3]; unlabeled.Name != "Step 4" || unlabeled.Kind != protocol.SymbolKindFunction {
+		t.Errorf("Expected an unlabeled command step as a function named by position, got %+v", unlabeled)
+	}
+
+	// Clients without nested symbols get each symbol's containers as its container name
+	var migrations *protocol.SymbolInformation
+	flattened := flattenSymbols(uri, symbols, "")
+	for i := range flattened {
+		if flattened[i].Name == "Run migrations" {
+			migrations = &flattened[i]
+		}
+	}
+	if migrations == nil || migrations.ContainerName != "steps > Deploy group" || migrations.Location.Range.Start.Line != 6 {
+		t.Errorf("Expected 'Run migrations' in 'steps > Deploy group' on line 6, got %+v", migrations)
+	}
+}
@@ -0,0 +1,138 @@
+package lsp
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Settings holds user-configurable server options.
+// Clients pass them as initializationOptions.
+type Settings struct {
+	// SlowRequestThresholdMs logs any request that takes longer than this many milliseconds.
+	// Zero disables slow request logging.
+	SlowRequestThresholdMs int `json:"slowRequestThresholdMs"`
+
+	// SlowRequestTelemetry also reports slow requests to the client as telemetry/event notifications
+	SlowRequestTelemetry bool `json:"slowRequestTelemetry"`
+
+	// UsageTelemetry reports how often each feature is used and each diagnostic code is raised
+	// to the client as batched telemetry/event notifications. Off unless the user opts in.
+	UsageTelemetry bool `json:"usageTelemetry"`
+
+	// UsageTelemetryIntervalSeconds is how often batched usage counts are reported
+	UsageTelemetryIntervalSeconds int `json:"usageTelemetryIntervalSeconds"`
+
+	// CompletionDocumentation is "inline" to send documentation with every completion item,
+	// or "lazy" to send it only for the item the user selects, which suits slow connections
+	CompletionDocumentation string `json:"completionDocumentation"`
+
+	// ComplexityMetrics reports pipelines over the complexity thresholds as information
+	// diagnostics, nudging teams towards splitting them up
+	ComplexityMetrics bool `json:"complexityMetrics"`
+
+	// ComplexityThresholds are the limits complexity metrics are reported against
+	ComplexityThresholds ComplexityThresholds `json:"complexityThresholds"`
+
+	// MaxDocumentSizeBytes and MaxDocumentLines bound the documents every feature runs on.
+	// Past either, diagnostics stop at YAML and schema errors, full semantic tokens are
+	// skipped in favour of range requests, and workspace scans skip the file. Zero disables a limit.
+	MaxDocumentSizeBytes int `json:"maxDocumentSizeBytes"`
+	MaxDocumentLines     int `json:"maxDocumentLines"`
+
+	// PluginAliases maps short plugin names to the plugin references they stand for,
+	// e.g. {"dockerx": "my-org/dockerx"}
+	PluginAliases map[string]string `json:"pluginAliases"`
+
+	// PinPopularPlugins completes plugin names with the versions bundled with the server,
+	// rather than the published popular plugins manifest fetched at startup and daily after
+	PinPopularPlugins bool `json:"pinPopularPlugins"`
+
+	// Teams lists the organization's team slugs, offered when completing allowed_teams.
+	// When set, allowed_teams entries that aren't in the list are flagged.
+	Teams []string `json:"teams"`
+
+	// PipelineSlugs maps Buildkite pipeline slugs to the workspace files that define them,
+	// absolute or relative to a workspace root, so trigger steps can be followed across files
+	PipelineSlugs map[string]string `json:"pipelineSlugs"`
+
+	// WorkspaceDiagnostics validates every pipeline file in the workspace roots at startup
+	// and publishes its diagnostics, not just those of open documents
+	WorkspaceDiagnostics bool `json:"workspaceDiagnostics"`
+
+	// UntitledPipelines treats every unsaved `untitled:` buffer as a pipeline
+	UntitledPipelines bool `json:"untitledPipelines"`
+
+	// PipelineLanguageIDs are the document language IDs that mark a document as a pipeline,
+	// whatever its path, e.g. a custom language the client maps pipeline files to
+	PipelineLanguageIDs []string `json:"pipelineLanguageIds"`
+
+	// ExternalValidators are executables run over every pipeline, whose diagnostics are
+	// published alongside the server's own
+	ExternalValidators []ExternalValidator `json:"externalValidators"`
+
+	// DocumentValidatedNotifications sends a buildkite/documentValidated notification after
+	// every validation, for companion extensions showing the pipeline's status
+	DocumentValidatedNotifications bool `json:"documentValidatedNotifications"`
+
+	// AgentVersion is the oldest Buildkite agent version the organization runs, e.g. "3.45.0".
+	// Step fields it doesn't support are flagged and left out of completions. Empty assumes
+	// the latest agent.
+	AgentVersion string `json:"agentVersion"`
+
+	// ValidatePluginPaths warns about paths in plugin options taking files, such as
+	// docker-compose's config, that don't exist in the document's checkout
+	ValidatePluginPaths bool `json:"validatePluginPaths"`
+}
+
+// DefaultSettings returns the settings used when the client doesn't provide any
+func DefaultSettings() Settings {
+	return Settings{
+		SlowRequestThresholdMs:        500,
+		UsageTelemetryIntervalSeconds: 300,
+		CompletionDocumentation:       CompletionDocumentationInline,
+		ComplexityThresholds: ComplexityThresholds{
+			Steps:          100,
+			NestingDepth:   10,
+			YAMLSizeBytes:  100 * 1024,
+			PluginsPerStep: 5,
+		},
+		MaxDocumentSizeBytes: 2 * 1024 * 1024,
+		MaxDocumentLines:     50000,
+		PipelineLanguageIDs:  []string{"buildkite"},
+	}
+}
+
+// parseSettings overlays client-provided options onto the defaults, each layer overriding
+// the ones before it. Unknown options are ignored, as are malformed layers.
+func parseSettings(layers ...interface{}) Settings {
+	settings := DefaultSettings()
+
+	for _, raw := range layers {
+		if raw == nil {
+			continue
+		}
+
+		data, err := json.Marshal(raw)
+		if err != nil {
+			continue
+		}
+
+		overlay := settings
+		if err := json.Unmarshal(data, &overlay); err != nil {
+			continue
+		}
+		settings = overlay
+	}
+
+	return settings
+}
+
+// SlowRequestThreshold returns the slow request threshold as a duration
+func (s Settings) SlowRequestThreshold() time.Duration {
+	return time.Duration(s.SlowRequestThresholdMs) * time.Millisecond
+}
+
+// UsageTelemetryInterval returns how often batched usage counts are reported as a duration
+func (s Settings) UsageTelemetryInterval() time.Duration {
+	return time.Duration(s.UsageTelemetryIntervalSeconds) * time.Second
+}
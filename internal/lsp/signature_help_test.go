@@ -273,3 +273,20 @@ func getSignatureLabels(signatures []protocol.SignatureInformation) []string {
 	}
 	return labels
 }
+
+func TestServer_PositionRequestsOnClosedDocument(t *testing.T) {
+	server := newTestServer()
+	position := protocol.TextDocumentPositionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: "file:///test/.buildkite/closed.yml"},
+	}
+
+	if result, err := server.SignatureHelp(context.Background(), &protocol.SignatureHelpParams{TextDocumentPositionParams: position}); result != nil || err != nil {
+		t.Errorf("Expected no signature help, got %+v, %v", result, err)
+	}
+	if result, err := server.Completion(context.Background(), &protocol.CompletionParams{TextDocumentPositionParams: position}); err != nil || result == nil || len(result.Items) != 0 {
+		t.Errorf("Expected an empty completion list, got %+v, %v", result, err)
+	}
+	if result, err := server.Definition(context.Background(), &protocol.DefinitionParams{TextDocumentPositionParams: position}); result != nil || err != nil {
+		t.Errorf("Expected no definition, got %+v, %v", result, err)
+	}
+}
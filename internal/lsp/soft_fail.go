@@ -0,0 +1,166 @@
+package lsp
+
+import (
+	"fmt"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+
+	"github.com/mcncl/buildkite-ls/internal/context"
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+// softFailExitStatuses are the exit statuses offered for soft_fail entries, in order
+var softFailExitStatuses = []struct {
+	Value       string
+	Description string
+}{
+	{`"*"`, "Any exit status"},
+	{"1", "General errors, the usual exit status of a failed command"},
+	{"2", "Misused shell builtins and command line usage errors"},
+}
+
+// getSoftFailCompletions offers the exit_status key for the entries of a soft_fail list, and
+// the common exit statuses for its value
+func (cp *CompletionProvider) getSoftFailCompletions(posCtx *context.PositionContext) ([]protocol.CompletionItem, bool) {
+	beforeCursor := posCtx.CurrentLine
+	if posCtx.CharIndex <= len(beforeCursor) {
+		beforeCursor = beforeCursor[:posCtx.CharIndex]
+	}
+
+	lines := posCtx.ContextLines
+	switch {
+	case listItemValuePattern.MatchString(beforeCursor) && listParentKey(lines) == "soft_fail":
+		return []protocol.CompletionItem{{
+			Label:            "exit_status",
+			Kind:             protocol.CompletionItemKindProperty,
+			Detail:           "Exit status that soft fails the job",
+			Documentation:    &protocol.MarkupContent{Kind: protocol.Markdown, Value: "An exit status, or `\"*\"` for any, that lets the job fail without failing the build."},
+			InsertText:       `exit_status: ${1|1,2,"*"|}`,
+			InsertTextFormat: protocol.InsertTextFormatSnippet,
+		}}, true
+	case exitStatusValuePattern.MatchString(beforeCursor) && inSoftFailEntry(lines):
+		items := make([]protocol.CompletionItem, 0, len(softFailExitStatuses))
+		for i, status := range softFailExitStatuses {
+			items = append(items, protocol.CompletionItem{
+				Label:    status.Value,
+				Kind:     protocol.CompletionItemKindEnumMember,
+				Detail:   status.Description,
+				SortText: fmt.Sprintf("%d", i),
+			})
+		}
+		return items, true
+	}
+
+	return nil, false
+}
+
+// inSoftFailEntry reports whether the last line is in an entry of a soft_fail list, on the
+// entry's "- " line or a key below it
+func inSoftFailEntry(lines []string) bool {
+	if len(lines) == 0 {
+		return false
+	}
+	if strings.HasPrefix(strings.TrimSpace(lines[len(lines)-1]), "-") {
+		return listParentKey(lines) == "soft_fail"
+	}
+
+	indent := indentOf(lines[len(lines)-1])
+	for i := len(lines) - 2; i >= 0; i-- {
+		if strings.HasPrefix(strings.TrimSpace(lines[i]), "- ") && indentOf(lines[i])+2 == indent {
+			return listParentKey(lines[:i+1]) == "soft_fail"
+		}
+		if trimmed := strings.TrimSpace(lines[i]); trimmed != "" && indentOf(lines[i]) < indent {
+			return false
+		}
+	}
+	return false
+}
+
+// validateSoftFail checks every step's soft_fail: that its list form only holds exit_status
+// entries, and that matrix adjustments don't switch between the list form and true
+func (s *Server) validateSoftFail(pipeline *parser.Pipeline) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	root := pipeline.YAMLNode
+	if root == nil || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return diagnostics
+	}
+
+	var walkSteps func(steps *yaml.Node)
+	walkSteps = func(steps *yaml.Node) {
+		if steps == nil || steps.Kind != yaml.SequenceNode {
+			return
+		}
+		for _, step := range steps.Content {
+			if step.Kind != yaml.MappingNode {
+				continue
+			}
+			diagnostics = append(diagnostics, softFailDiagnostics(step)...)
+			walkSteps(mappingValue(step, "steps"))
+		}
+	}
+	walkSteps(mappingValue(root.Content[0], "steps"))
+
+	return diagnostics
+}
+
+// softFailDiagnostics checks the soft_fail of a single step and of its matrix adjustments
+func softFailDiagnostics(step *yaml.Node) []protocol.Diagnostic {
+	softFail := mappingValue(step, "soft_fail")
+	diagnostics := softFailEntryDiagnostics(softFail)
+
+	matrix := mappingValue(step, "matrix")
+	if matrix == nil || matrix.Kind != yaml.MappingNode {
+		return diagnostics
+	}
+	adjustments := mappingValue(matrix, "adjustments")
+	if adjustments == nil || adjustments.Kind != yaml.SequenceNode {
+		return diagnostics
+	}
+
+	for _, adjustment := range adjustments.Content {
+		adjusted := mappingValue(adjustment, "soft_fail")
+		diagnostics = append(diagnostics, softFailEntryDiagnostics(adjusted)...)
+		// Turning soft failing off goes with either form
+		if softFail == nil || adjusted == nil || softFail.Value == "false" || adjusted.Value == "false" {
+			continue
+		}
+
+		switch {
+		case softFail.Kind == yaml.SequenceNode && adjusted.Kind == yaml.ScalarNode:
+			diagnostics = append(diagnostics, nodeDiagnostic(adjusted, protocol.DiagnosticSeverityWarning, "mixed-soft-fail",
+				"The step's soft_fail lists exit statuses, but this adjustment sets it to true, which applies to every exit status. List exit_status entries here too"))
+		case softFail.Kind == yaml.ScalarNode && adjusted.Kind == yaml.SequenceNode:
+			diagnostics = append(diagnostics, nodeDiagnostic(adjusted, protocol.DiagnosticSeverityWarning, "mixed-soft-fail",
+				"The step's soft_fail is true, but this adjustment lists exit statuses. Use the same form for the step and its adjustments"))
+		}
+	}
+
+	return diagnostics
+}
+
+// softFailEntryDiagnostics checks the entries of soft_fail's list form, which each take an
+// exit_status of an integer or "*"
+func softFailEntryDiagnostics(softFail *yaml.Node) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+	if softFail == nil || softFail.Kind != yaml.SequenceNode {
+		return diagnostics
+	}
+
+	for _, entry := range softFail.Content {
+		if entry.Kind != yaml.MappingNode {
+			diagnostics = append(diagnostics, nodeDiagnostic(entry, protocol.DiagnosticSeverityError, "invalid-soft-fail",
+				"soft_fail lists only take exit_status entries. Use soft_fail: true on its own to soft fail on any exit status"))
+			continue
+		}
+		if status := mappingValue(entry, "exit_status"); status != nil {
+			if _, diagnostic := exitStatusValue(status, false); diagnostic != nil {
+				diagnostics = append(diagnostics, *diagnostic)
+			}
+		}
+	}
+
+	return diagnostics
+}
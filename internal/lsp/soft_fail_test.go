@@ -0,0 +1,107 @@
+package lsp
+
+import (
+	"testing"
+
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+func TestCompletionProvider_SoftFail(t *testing.T) {
+	provider := newTestCompletionProvider()
+
+	tests := []struct {
+		name     string
+		content  string
+		expected []string
+	}{
+		{
+			name:     "exit_status key",
+			content:  "steps:\n  - command: make\n    soft_fail:\n      - ",
+			expected: []string{"exit_status"},
+		},
+		{
+			name:     "exit_status value",
+			content:  "steps:\n  - command: make\n    soft_fail:\n      - exit_status: ",
+			expected: []string{`"*"`, "1", "2"},
+		},
+		{
+			name:     "matrix adjustment",
+			content:  "steps:\n  - command: make\n    matrix:\n      setup: [a, b]\n      adjustments:\n        - with: a\n          soft_fail:\n            - exit_status: ",
+			expected: []string{`"*"`, "1", "2"},
+		},
+		{
+			name:     "retry rules keep their own values",
+			content:  "steps:\n  - command: make\n    retry:\n      automatic:\n        - exit_status: ",
+			expected: []string{`"*"`, "-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			completions := provider.GetCompletions(blockStepPositionContext(tt.content))
+
+			if len(completions) != len(tt.expected) {
+				t.Fatalf("Expected %d completions, got %d: %+v", len(tt.expected), len(completions), completions)
+			}
+			for i, label := range tt.expected {
+				if completions[i].Label != label {
+					t.Errorf("Completion %d: expected %q, got %q", i, label, completions[i].Label)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_ValidateSoftFail(t *testing.T) {
+	content := `steps:
+  - command: make
+    soft_fail: [true]
+  - command: make test
+    soft_fail:
+      - exit_status: one
+      - exit_status: "*"
+  - group: Matrix
+    steps:
+      - command: make {{matrix}}
+        soft_fail:
+          - exit_status: 1
+        matrix:
+          setup: [a, b, c]
+          adjustments:
+            - with: a
+              soft_fail: true
+            - with: b
+              soft_fail: false
+  - command: make lint
+    soft_fail: true
+    matrix:
+      setup: [a, b]
+      adjustments:
+        - with: a
+          soft_fail:
+            - exit_status: 2`
+
+	pipeline, err := parser.ParseYAML([]byte(content))
+	if err != nil {
+		t.Fatalf("Failed to parse YAML: %v", err)
+	}
+	diagnostics := newTestServer().validateSoftFail(pipeline)
+
+	expected := []struct {
+		code string
+		line uint32
+	}{
+		{"invalid-soft-fail", 2},
+		{"invalid-exit-status", 5},
+		{"mixed-soft-fail", 16},
+		{"mixed-soft-fail", 26},
+	}
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("Expected %d diagnostics, got %+v", len(expected), diagnostics)
+	}
+	for i, want := range expected {
+		if got := diagnostics[i]; got.Code != want.code || got.Range.Start.Line != want.line {
+			t.Errorf("Expected %s at line %d, got %+v", want.code, want.line, got)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package lsp
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+// stepIndentPipeline returns a pipeline whose steps start with the given indentation
+func stepIndentPipeline(indent string) []string {
+	return []string{
+		"steps:",
+		indent + "- label: Build",
+		indent + "  key: build",
+		indent + "  command: make",
+		indent + "- wait",
+		indent + "- label: Test",
+		indent + "  command: |",
+		indent + "    make test",
+		indent + "  depends_on: build",
+	}
+}
+
+func TestServer_StepIndentation(t *testing.T) {
+	server := newTestServer()
+	reference := stepIndentPipeline("  ")
+
+	for _, unit := range []string{"    ", "      ", "\t"} {
+		t.Run(strings.ReplaceAll(unit, "\t", "tab"), func(t *testing.T) {
+			lines := stepIndentPipeline(unit)
+
+			if indent := server.stepIndentOf(lines); indent != server.getIndentLevel(unit) {
+				t.Errorf("Expected a step indentation of %d, got %d", server.getIndentLevel(unit), indent)
+			}
+			if stepLines := server.findStepLines(lines); !slices.Equal(stepLines, []int{1, 4, 5}) {
+				t.Errorf("Expected steps on lines 1, 4 and 5, got %v", stepLines)
+			}
+			if line := server.findStepPropertyLine("depends_on", lines, 5); line != 8 {
+				t.Errorf("Expected depends_on found on line 8, got %d", line)
+			}
+
+			info := server.analyzeStepAtRange(protocol.Range{Start: protocol.Position{Line: 5}, End: protocol.Position{Line: 5}}, lines)
+			if info == nil || info.StartLine != 5 || info.EndLine != 8 || !info.HasLabel || !info.IsCommandStep {
+				t.Fatalf("Expected the Test step on lines 5-8, got %+v", info)
+			}
+			if !server.isStepPropertyLine(lines, info, 8) || server.isStepPropertyLine(lines, info, 7) {
+				t.Error("Expected depends_on to be one of the step's properties, and the script line not")
+			}
+
+			// The same tokens as the 2-space pipeline, shifted along
+			expected := server.generateSemanticTokens(reference).Data
+			got := server.generateSemanticTokens(lines).Data
+			if len(got) != len(expected) {
+				t.Fatalf("Expected %d tokens, got %d", len(expected)/5, len(got)/5)
+			}
+			for i := 3; i < len(got); i += 5 {
+				if got[i] != expected[i] {
+					t.Errorf("Token %d: expected type %d, got %d", i/5, expected[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestServer_StepIndentOf_Default(t *testing.T) {
+	server := newTestServer()
+
+	for _, content := range []string{"", "steps:\n", "env:\n  A: b\nsteps: []\n"} {
+		if indent := server.stepIndentOf(splitLines(content)); indent != defaultStepIndent {
+			t.Errorf("Expected the default step indentation for %q, got %d", content, indent)
+		}
+	}
+}
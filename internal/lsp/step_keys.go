@@ -0,0 +1,127 @@
+package lsp
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+)
+
+// emojiPattern matches Buildkite emoji codes such as :rocket: in a label
+var emojiPattern = regexp.MustCompile(`:[a-z0-9_+-]+:`)
+
+// keyInvalidChars matches the runs of characters replaced with a dash in a generated key
+var keyInvalidChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// stepLabelFields are the fields naming a step, in the order a key is derived from them
+var stepLabelFields = []string{"label", "name", "group", "block", "input"}
+
+// keyFromLabel derives a kebab-case step key from a label, ignoring emoji
+func keyFromLabel(label string) string {
+	label = strings.ToLower(emojiPattern.ReplaceAllString(label, " "))
+	return strings.Trim(keyInvalidChars.ReplaceAllString(label, "-"), "-")
+}
+
+// stepLabelKey returns the key a step without one would be given from its label, which is
+// what go to definition resolves a dependency to and what the unknown-dependency check
+// suggests adding. Buildkite doesn't derive keys itself, so it's "" for a step with a key.
+func stepLabelKey(step *yaml.Node) string {
+	if stepNodeKey(step) != "" {
+		return ""
+	}
+	for _, field := range stepLabelFields {
+		if label := mappingValue(step, field); label != nil && label.Kind == yaml.ScalarNode {
+			return keyFromLabel(label.Value)
+		}
+	}
+	return ""
+}
+
+// uniqueKey returns the key, suffixed with the first free number when it's already taken,
+// and records it as taken
+func uniqueKey(key string, taken map[string]bool) string {
+	unique := key
+	for n := 2; taken[unique]; n++ {
+		unique = fmt.Sprintf("%s-%d", key, n)
+	}
+	taken[unique] = true
+	return unique
+}
+
+// createGenerateKeysAction adds a key derived from its label to every step without one,
+// including the steps inside groups
+func (s *Server) createGenerateKeysAction(uri protocol.DocumentURI, lines []string) *protocol.CodeAction {
+	edit := newStructuredEdit(lines)
+	if edit == nil || edit.root.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	var steps []*yaml.Node
+	var collect func(list *yaml.Node)
+	collect = func(list *yaml.Node) {
+		if list == nil || list.Kind != yaml.SequenceNode {
+			return
+		}
+		for _, step := range list.Content {
+			if step.Kind != yaml.MappingNode {
+				continue
+			}
+			steps = append(steps, step)
+			collect(mappingValue(step, "steps"))
+		}
+	}
+	collect(mappingValue(edit.root, "steps"))
+
+	// Generated keys mustn't collide with the keys already in the pipeline
+	taken := make(map[string]bool)
+	for _, step := range steps {
+		for _, field := range []string{"key", "id", "identifier"} {
+			if value := mappingValue(step, field); value != nil {
+				taken[value.Value] = true
+			}
+		}
+	}
+
+	for _, step := range steps {
+		if step.Style&yaml.FlowStyle != 0 {
+			continue
+		}
+		if mappingKey(step, "key") != nil || mappingKey(step, "id") != nil || mappingKey(step, "identifier") != nil {
+			continue
+		}
+
+		var label *mappingEntry
+		for _, field := range stepLabelFields {
+			if label = mappingKey(step, field); label != nil && label.value.Kind == yaml.ScalarNode {
+				break
+			}
+		}
+		if label == nil || label.value.Kind != yaml.ScalarNode {
+			continue
+		}
+		key := keyFromLabel(label.value.Value)
+		if key == "" {
+			continue
+		}
+
+		// The key goes after the label's value, which can span several lines
+		edit.addProperty(step, label, "key", fmt.Sprintf("%q", uniqueKey(key, taken)))
+	}
+
+	edits := edit.textEdits()
+	if len(edits) == 0 {
+		return nil
+	}
+
+	return &protocol.CodeAction{
+		Title: "Generate keys for all steps",
+		Kind:  protocol.Source,
+		Edit: &protocol.WorkspaceEdit{
+			Changes: map[protocol.DocumentURI][]protocol.TextEdit{
+				uri: edits,
+			},
+		},
+	}
+}
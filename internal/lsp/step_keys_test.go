@@ -0,0 +1,81 @@
+package lsp
+
+import (
+	"testing"
+)
+
+func TestKeyFromLabel(t *testing.T) {
+	tests := map[string]string{
+		":rocket: Deploy to production": "deploy-to-production",
+		"Run Tests (unit)":              "run-tests-unit",
+		"  build_linux-amd64 ":          "build-linux-amd64",
+		":pipeline:":                    "",
+	}
+
+	for label, expected := range tests {
+		if got := keyFromLabel(label); got != expected {
+			t.Errorf("keyFromLabel(%q) = %q, expected %q", label, got, expected)
+		}
+	}
+}
+
+func TestServer_GenerateKeysAction(t *testing.T) {
+	server := newTestServer()
+
+	content := `steps:
+  - label: ":hammer: Build"
+    command: make build
+  - label: "Build"
+    key: build-2
+    command: make build
+  - wait
+  - group: "Tests"
+    steps:
+      - label: >-
+          Build
+        command: make test
+      - command: make lint
+  - block: "Release"`
+
+	action := server.createGenerateKeysAction("file:///test/.buildkite/pipeline.yml", splitLines(content))
+	if action == nil {
+		t.Fatal("Expected a generate keys action")
+	}
+	if action.Title != "Generate keys for all steps" {
+		t.Errorf("Unexpected title %q", action.Title)
+	}
+
+	edits := action.Edit.Changes["file:///test/.buildkite/pipeline.yml"]
+	result := content
+	for i := len(edits) - 1; i >= 0; i-- {
+		result = applyTextEdit(result, edits[i])
+	}
+
+	expected := `steps:
+  - label: ":hammer: Build"
+    key: "build"
+    command: make build
+  - label: "Build"
+    key: build-2
+    command: make build
+  - wait
+  - group: "Tests"
+    key: "tests"
+    steps:
+      - label: >-
+          Build
+        key: "build-3"
+        command: make test
+      - command: make lint
+  - block: "Release"
+    key: "release"`
+
+	if result != expected {
+		t.Errorf("Unexpected result:\n%s\n\nexpected:\n%s", result, expected)
+	}
+
+	keyed := "steps:\n  - label: Build\n    key: build\n  - command: make\n"
+	if action := server.createGenerateKeysAction("file:///test/.buildkite/pipeline.yml", splitLines(keyed)); action != nil {
+		t.Errorf("Expected no action when every labelled step has a key, got %+v", action)
+	}
+}
@@ -0,0 +1,317 @@
+package lsp
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+// orderedStep is a step placed among the waits and block steps that order it
+type orderedStep struct {
+	Node *yaml.Node
+	// Key is the step's own key, and GroupKey the key of the group it's in
+	Key      string
+	GroupKey string
+	// Group is the index within `steps` of the step, or of the group it's in
+	Group int
+	// Barriers counts the waits and block steps before the step at the top level, and
+	// GroupBarriers those before it within its group
+	Barriers      int
+	GroupBarriers int
+	// DependsOn are the keys the step, or its group, depends on
+	DependsOn []string
+}
+
+// orderedAfter reports whether something already makes the step run after the earlier one:
+// a wait or block step between them, or a depends_on naming it or its group
+func (s orderedStep) orderedAfter(earlier orderedStep) bool {
+	if s.Barriers > earlier.Barriers {
+		return true
+	}
+	if s.Group == earlier.Group && s.GroupKey == earlier.GroupKey && s.GroupBarriers > earlier.GroupBarriers {
+		return true
+	}
+	return (earlier.Key != "" && slices.Contains(s.DependsOn, earlier.Key)) ||
+		(earlier.GroupKey != "" && slices.Contains(s.DependsOn, earlier.GroupKey))
+}
+
+// stepOutput is an artifact or meta-data key a step produces or consumes
+type stepOutput struct {
+	Name     string
+	Step     int
+	Location protocol.Location
+}
+
+// validateStepOrder hints at steps that download an artifact or read meta-data a single
+// earlier step produces, when nothing orders them after that step. Without a wait or
+// depends_on the two run in parallel, and the consumer can start before the value exists.
+// The hint carries the producer's key in its data for the quick fix adding depends_on.
+func (s *Server) validateStepOrder(uri protocol.DocumentURI, pipeline *parser.Pipeline, lines []string) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	root := pipeline.YAMLNode
+	if root == nil || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return diagnostics
+	}
+	steps := orderSteps(mappingValue(root.Content[0], "steps"))
+
+	var uploads []artifactReference
+	var downloads []artifactReference
+	var sets, gets []stepOutput
+	for i, step := range steps {
+		artifacts := s.collectStepArtifacts(uri, step.Node, i, lines)
+		uploads = append(uploads, artifacts.Uploads...)
+		downloads = append(downloads, artifacts.Downloads...)
+
+		stepSets, stepGets := stepMetaData(uri, step.Node, i, lines)
+		sets = append(sets, stepSets...)
+		gets = append(gets, stepGets...)
+	}
+
+	hint := func(consumer protocol.Location, step int, producers []int, message string, related protocol.Location) {
+		if len(producers) != 1 || producers[0] >= step {
+			return
+		}
+		producer := steps[producers[0]]
+		if producer.Key == "" || steps[step].orderedAfter(producer) {
+			return
+		}
+		diagnostics = append(diagnostics, protocol.Diagnostic{
+			Range:    consumer.Range,
+			Severity: protocol.DiagnosticSeverityHint,
+			Message:  fmt.Sprintf(message, producer.Key) + fmt.Sprintf(". Add `depends_on: %s` so this step runs after it", producer.Key),
+			Source:   "buildkite-ls",
+			Code:     "missing-depends-on",
+			RelatedInformation: []protocol.DiagnosticRelatedInformation{{
+				Location: related,
+				Message:  fmt.Sprintf("Produced by step '%s'", producer.Key),
+			}},
+			Data: map[string]interface{}{"dependsOn": producer.Key},
+		})
+	}
+
+	for _, download := range downloads {
+		var producers []int
+		var related protocol.Location
+		for _, upload := range uploads {
+			if upload.Step != download.Step && artifactGlobsOverlap(upload.Path, download.Path) && !slices.Contains(producers, upload.Step) {
+				producers = append(producers, upload.Step)
+				related = upload.Location
+			}
+		}
+		hint(download.Location, download.Step, producers,
+			fmt.Sprintf("'%s' is uploaded by step '%%s', which may still be running when this step downloads it", download.Path), related)
+	}
+
+	for _, get := range gets {
+		var producers []int
+		var related protocol.Location
+		for _, set := range sets {
+			if set.Step != get.Step && set.Name == get.Name && !slices.Contains(producers, set.Step) {
+				producers = append(producers, set.Step)
+				related = set.Location
+			}
+		}
+		hint(get.Location, get.Step, producers,
+			fmt.Sprintf("Meta-data '%s' is set by step '%%s', which may still be running when this step reads it", get.Name), related)
+	}
+
+	return diagnostics
+}
+
+// orderSteps lists the steps of a pipeline in order, with the steps of groups in place of
+// the groups, placing each among the waits and block steps before it
+func orderSteps(list *yaml.Node) []orderedStep {
+	var steps []orderedStep
+	if list == nil || list.Kind != yaml.SequenceNode {
+		return steps
+	}
+
+	barriers := 0
+	for index, item := range list.Content {
+		if isBarrierStep(item) {
+			barriers++
+			continue
+		}
+		if item.Kind != yaml.MappingNode {
+			continue
+		}
+
+		nested := mappingValue(item, "steps")
+		if nested == nil || nested.Kind != yaml.SequenceNode {
+			steps = append(steps, orderedStep{
+				Node:      item,
+				Key:       stepNodeKey(item),
+				Group:     index,
+				Barriers:  barriers,
+				DependsOn: nodeDependencies(item),
+			})
+			continue
+		}
+
+		groupKey := stepNodeKey(item)
+		groupDependencies := nodeDependencies(item)
+		groupBarriers := 0
+		for _, step := range nested.Content {
+			if isBarrierStep(step) {
+				groupBarriers++
+				continue
+			}
+			if step.Kind != yaml.MappingNode {
+				continue
+			}
+			steps = append(steps, orderedStep{
+				Node:          step,
+				Key:           stepNodeKey(step),
+				GroupKey:      groupKey,
+				Group:         index,
+				Barriers:      barriers,
+				GroupBarriers: groupBarriers,
+				DependsOn:     append(nodeDependencies(step), groupDependencies...),
+			})
+		}
+	}
+	return steps
+}
+
+// isBarrierStep reports whether a step holds back the steps after it: a wait or block step.
+// Input steps don't, so later steps run while they wait for input.
+func isBarrierStep(step *yaml.Node) bool {
+	if step.Kind == yaml.ScalarNode {
+		return step.Value == "wait" || step.Value == "block"
+	}
+	if step.Kind != yaml.MappingNode {
+		return false
+	}
+	return isWaitStepNode(step) || mappingKey(step, "block") != nil || stringNodeValue(mappingValue(step, "type")) == "block"
+}
+
+// stepNodeKey returns the key a step can be depended on by
+func stepNodeKey(step *yaml.Node) string {
+	for _, field := range []string{"key", "id", "identifier"} {
+		if key := stringNodeValue(mappingValue(step, field)); key != "" {
+			return key
+		}
+	}
+	return ""
+}
+
+// nodeDependencies reads depends_on in any of its forms: a key, a list of keys, or a list of
+// {step, allow_failure} entries
+func nodeDependencies(step *yaml.Node) []string {
+	value := mappingValue(step, "depends_on")
+	if value == nil {
+		return nil
+	}
+	entries := []*yaml.Node{value}
+	if value.Kind == yaml.SequenceNode {
+		entries = value.Content
+	}
+
+	var keys []string
+	for _, entry := range entries {
+		if entry.Kind == yaml.MappingNode {
+			entry = mappingValue(entry, "step")
+		}
+		if key := stringNodeValue(entry); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// stepMetaData finds the meta-data keys a step sets, through its commands or the fields of
+// an input or block step, and the keys its commands read
+func stepMetaData(uri protocol.DocumentURI, step *yaml.Node, index int, lines []string) (sets, gets []stepOutput) {
+	output := func(node *yaml.Node, name string) stepOutput {
+		return stepOutput{Name: name, Step: index, Location: protocol.Location{URI: uri, Range: nodeTextRange(node, name, lines)}}
+	}
+
+	if fields := mappingValue(step, "fields"); fields != nil && fields.Kind == yaml.SequenceNode {
+		for _, field := range fields.Content {
+			if key := mappingValue(field, "key"); key != nil && key.Kind == yaml.ScalarNode && key.Value != "" {
+				sets = append(sets, output(key, key.Value))
+			}
+		}
+	}
+
+	for _, key := range []string{"command", "commands"} {
+		value := mappingValue(step, key)
+		if value == nil {
+			continue
+		}
+		entries := []*yaml.Node{value}
+		if value.Kind == yaml.SequenceNode {
+			entries = value.Content
+		}
+		for _, entry := range entries {
+			if entry.Kind != yaml.ScalarNode {
+				continue
+			}
+			for _, match := range metaDataSetPattern.FindAllStringSubmatch(entry.Value, -1) {
+				sets = append(sets, output(entry, match[1]))
+			}
+			for _, match := range metaDataGetPattern.FindAllStringSubmatch(entry.Value, -1) {
+				// Keys built from shell variables can't be matched statically
+				if !strings.Contains(match[1], "$") {
+					gets = append(gets, output(entry, match[1]))
+				}
+			}
+		}
+	}
+	return sets, gets
+}
+
+// createAddDependsOnAction adds the producer named by a missing-depends-on hint to the
+// depends_on of the step the hint is on, creating depends_on if the step has none
+func (s *Server) createAddDependsOnAction(uri protocol.DocumentURI, lines []string, diagnostic protocol.Diagnostic) *protocol.CodeAction {
+	data, _ := diagnostic.Data.(map[string]interface{})
+	key, _ := data["dependsOn"].(string)
+	if key == "" {
+		return nil
+	}
+	edit, step := stepEditOf(lines, int(diagnostic.Range.Start.Line))
+	if edit == nil {
+		return nil
+	}
+
+	entry := mappingKey(step, "depends_on")
+	switch {
+	case entry == nil:
+		// Next to the step's key, where readers look for what it depends on
+		edit.addProperty(step, mappingKey(step, "key"), "depends_on", yamlString(key))
+	case entry.value.Kind == yaml.ScalarNode && !isImplicitNull(entry.value):
+		edit.setValue(entry, "["+yamlString(entry.value.Value)+", "+yamlString(key)+"]")
+	case entry.value.Kind == yaml.SequenceNode && len(entry.value.Content) > 0:
+		end := edit.nodeEnd(entry.value)
+		if entry.value.Style&yaml.FlowStyle != 0 {
+			// Before the closing bracket
+			end.Character--
+			edit.replace(end, end, ", "+yamlString(key))
+			break
+		}
+		first := entry.value.Content[0]
+		dash := strings.LastIndex(lines[first.Line-1][:first.Column-1], "-")
+		if dash < 0 {
+			return nil
+		}
+		edit.replace(end, end, "\n"+strings.Repeat(" ", dash)+"- "+yamlString(key))
+	default:
+		edit.setValue(entry, yamlString(key))
+	}
+
+	return &protocol.CodeAction{
+		Title:       fmt.Sprintf("Add depends_on: %s", key),
+		Kind:        protocol.QuickFix,
+		Diagnostics: []protocol.Diagnostic{diagnostic},
+		IsPreferred: true,
+		Edit: &protocol.WorkspaceEdit{
+			Changes: map[protocol.DocumentURI][]protocol.TextEdit{uri: edit.textEdits()},
+		},
+	}
+}
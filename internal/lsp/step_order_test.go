@@ -0,0 +1,233 @@
+package lsp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+const stepOrderPipeline = `steps:
+  - key: build
+    command: make && buildkite-agent artifact upload dist/app.tar.gz
+  - input: Release details
+    key: details
+    fields:
+      - text: Version
+        key: release-version
+  - label: Package
+    key: package
+    command: buildkite-agent artifact download dist/app.tar.gz . && buildkite-agent meta-data get release-version
+  - label: Announce
+    depends_on: details
+    command: buildkite-agent meta-data get release-version
+  - wait
+  - label: Publish
+    command: buildkite-agent artifact download dist/app.tar.gz .`
+
+// stepOrderDiagnosticsFor returns the missing-depends-on hints for a pipeline
+func stepOrderDiagnosticsFor(t *testing.T, server *Server, uri protocol.DocumentURI, content string) []protocol.Diagnostic {
+	t.Helper()
+	pipeline, err := parser.ParseYAML([]byte(content))
+	if err != nil {
+		t.Fatalf("Failed to parse YAML: %v", err)
+	}
+	return server.validateStepOrder(uri, pipeline, splitLines(content))
+}
+
+func TestServer_ValidateStepOrder(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+
+	diagnostics := stepOrderDiagnosticsFor(t, server, uri, stepOrderPipeline)
+	expected := []struct {
+		producer string
+		line     uint32
+		text     string
+	}{
+		{"build", 10, "dist/app.tar.gz"},
+		{"details", 10, "release-version"},
+	}
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("Expected %d hints, got %+v", len(expected), diagnostics)
+	}
+
+	lines := splitLines(stepOrderPipeline)
+	for i, want := range expected {
+		got := diagnostics[i]
+		if got.Code != "missing-depends-on" || got.Severity != protocol.DiagnosticSeverityHint {
+			t.Errorf("Expected a missing-depends-on hint, got %+v", got)
+		}
+		if text := lines[got.Range.Start.Line][got.Range.Start.Character:got.Range.End.Character]; got.Range.Start.Line != want.line || text != want.text {
+			t.Errorf("Expected the hint on %q at line %d, got %q at line %d", want.text, want.line, text, got.Range.Start.Line)
+		}
+		if !strings.Contains(got.Message, "depends_on: "+want.producer) {
+			t.Errorf("Expected the message to suggest depending on %s, got %q", want.producer, got.Message)
+		}
+		if data, _ := got.Data.(map[string]interface{}); data["dependsOn"] != want.producer {
+			t.Errorf("Expected the producer in the hint's data, got %+v", got.Data)
+		}
+		if len(got.RelatedInformation) != 1 {
+			t.Errorf("Expected the producer as related information, got %+v", got.RelatedInformation)
+		}
+	}
+}
+
+func TestServer_ValidateStepOrderSkips(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name: "producer without a key",
+			content: `steps:
+  - command: buildkite-agent meta-data set version 1.0
+  - command: buildkite-agent meta-data get version`,
+		},
+		{
+			name: "more than one producer",
+			content: `steps:
+  - key: linux
+    command: buildkite-agent artifact upload "pkg/*"
+  - key: darwin
+    command: buildkite-agent artifact upload "pkg/*"
+  - command: buildkite-agent artifact download "pkg/*" .`,
+		},
+		{
+			name: "ordered by a block step",
+			content: `steps:
+  - key: build
+    command: buildkite-agent meta-data set version 1.0
+  - block: Release?
+  - command: buildkite-agent meta-data get version`,
+		},
+		{
+			name: "ordered by a wait within a group",
+			content: `steps:
+  - group: Release
+    steps:
+      - key: build
+        command: buildkite-agent meta-data set version 1.0
+      - wait
+      - command: buildkite-agent meta-data get version`,
+		},
+		{
+			name: "group depends on the producer",
+			content: `steps:
+  - key: build
+    command: buildkite-agent meta-data set version 1.0
+  - group: Release
+    depends_on:
+      - step: build
+    steps:
+      - command: buildkite-agent meta-data get version`,
+		},
+		{
+			name: "depends on the producer's group",
+			content: `steps:
+  - group: Build
+    key: build-group
+    steps:
+      - key: build
+        command: buildkite-agent meta-data set version 1.0
+  - depends_on: build-group
+    command: buildkite-agent meta-data get version`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diagnostics := stepOrderDiagnosticsFor(t, server, uri, tt.content); len(diagnostics) != 0 {
+				t.Errorf("Expected no hints, got %+v", diagnostics)
+			}
+		})
+	}
+}
+
+func TestServer_AddDependsOnAction(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{
+			name:     "without depends_on",
+			content:  stepOrderPipeline,
+			expected: "  - label: Package\n    key: package\n    depends_on: build\n    command:",
+		},
+		{
+			name: "with a single dependency",
+			content: `steps:
+  - key: build
+    command: buildkite-agent meta-data set version 1.0
+  - key: lint
+    command: make lint
+  - depends_on: lint
+    command: buildkite-agent meta-data get version`,
+			expected: "  - depends_on: [lint, build]\n",
+		},
+		{
+			name: "with a list of dependencies",
+			content: `steps:
+  - key: build
+    command: buildkite-agent meta-data set version 1.0
+  - key: lint
+    command: make lint
+  - depends_on:
+      - lint
+    command: buildkite-agent meta-data get version`,
+			expected: "  - depends_on:\n      - lint\n      - build\n    command:",
+		},
+		{
+			name: "with a flow list of dependencies",
+			content: `steps:
+  - key: build
+    command: buildkite-agent meta-data set version 1.0
+  - key: lint
+    command: make lint
+  - depends_on: [lint]
+    command: buildkite-agent meta-data get version`,
+			expected: "  - depends_on: [lint, build]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer()
+			uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+			server.documentManager.OpenDocument(uri, 1, tt.content)
+
+			diagnostics := stepOrderDiagnosticsFor(t, server, uri, tt.content)
+			if len(diagnostics) == 0 {
+				t.Fatal("Expected a missing-depends-on hint")
+			}
+			actions, err := server.CodeAction(context.Background(), &protocol.CodeActionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+				Range:        diagnostics[0].Range,
+				Context:      protocol.CodeActionContext{Diagnostics: diagnostics[:1]},
+			})
+			if err != nil {
+				t.Fatalf("CodeAction failed: %v", err)
+			}
+
+			var fix *protocol.CodeAction
+			for i := range actions {
+				if strings.HasPrefix(actions[i].Title, "Add depends_on") {
+					fix = &actions[i]
+				}
+			}
+			if fix == nil {
+				t.Fatalf("Expected an add depends_on action, got %+v", actions)
+			}
+			if updated := applyTextEdits(tt.content, fix.Edit.Changes[uri]); !strings.Contains(updated, tt.expected) {
+				t.Errorf("Expected the document to contain:\n%s\ngot:\n%s", tt.expected, updated)
+			}
+		})
+	}
+}
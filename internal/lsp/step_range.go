@@ -0,0 +1,231 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"go.lsp.dev/protocol"
+
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+// StepRangeAtMethod is the custom request returning the step containing a position, so
+// editor extensions can act on whole steps without detecting them themselves
+const StepRangeAtMethod = "buildkite/stepRangeAt"
+
+// StepRange describes a step in a pipeline document
+type StepRange struct {
+	// Range spans the step from its "- " marker to the end of its last non-blank line
+	Range protocol.Range `json:"range"`
+	// Type is one of command, wait, block, input, trigger or group
+	Type string `json:"type"`
+	// Key is the step's key (or its id/identifier alias), if it has one
+	Key   string `json:"key,omitempty"`
+	Label string `json:"label,omitempty"`
+	// Path locates the step by index: [2] is the third step, [2, 0] the first step of that group
+	Path []int `json:"path"`
+}
+
+// StepRangeAt returns the innermost step containing the position, or nil when the position
+// isn't inside a step
+func (s *Server) StepRangeAt(ctx context.Context, params *protocol.TextDocumentPositionParams) (*StepRange, error) {
+	doc, exists := s.documentManager.GetDocument(params.TextDocument.URI)
+	if !exists {
+		return nil, fmt.Errorf("document not found: %s", params.TextDocument.URI)
+	}
+
+	if !s.isBuildkiteFile(string(params.TextDocument.URI)) {
+		return nil, nil
+	}
+
+	pipeline, err := parser.ParseYAML([]byte(doc.Content))
+	if err != nil {
+		return nil, nil
+	}
+	var pipelineData map[string]interface{}
+	if err := json.Unmarshal(pipeline.JSONBytes, &pipelineData); err != nil {
+		return nil, nil
+	}
+	steps, _ := pipelineData["steps"].([]interface{})
+
+	return s.stepRangeAt(doc.Lines, steps, int(params.Position.Line)), nil
+}
+
+// stepRangeAt finds the top-level step containing the line, then descends into group steps
+func (s *Server) stepRangeAt(lines []string, steps []interface{}, line int) *StepRange {
+	stepInfo := s.stepContainingLine(lines, line)
+	if stepInfo == nil || line < stepInfo.StartLine {
+		return nil
+	}
+
+	index := -1
+	for i, stepLine := range s.findStepLines(lines) {
+		if stepLine == stepInfo.StartLine {
+			index = i
+		}
+	}
+	if index < 0 || index >= len(steps) {
+		return nil
+	}
+
+	result := newStepRange(lines, steps[index], stepInfo.StartLine, stepInfo.EndLine, []int{index})
+
+	// Group steps hold their own list of steps; groups can't be nested any deeper
+	if result.Type == "group" {
+		group, _ := steps[index].(map[string]interface{})
+		steps, _ = group["steps"].([]interface{})
+
+		start, end := nestedStepSpan(lines, int(result.Range.Start.Line), int(result.Range.End.Line), line)
+		for i, itemLine := range nestedStepLines(lines, int(result.Range.Start.Line), int(result.Range.End.Line)) {
+			if itemLine == start && start >= 0 && i < len(steps) {
+				return newStepRange(lines, steps[i], start, end, append(result.Path, i))
+			}
+		}
+	}
+
+	return result
+}
+
+// newStepRange describes the step spanning startLine to endLine
+func newStepRange(lines []string, step interface{}, startLine, endLine int, path []int) *StepRange {
+	// Trailing blank lines and comments separate steps rather than belong to them
+	for endLine > startLine {
+		trimmed := strings.TrimSpace(lines[endLine])
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			break
+		}
+		endLine--
+	}
+
+	result := &StepRange{
+		Range: protocol.Range{
+			Start: protocol.Position{Line: uint32(startLine), Character: uint32(strings.Index(lines[startLine], "-"))},
+			End:   protocol.Position{Line: uint32(endLine), Character: uint32(len(lines[endLine]))},
+		},
+		Type: stepType(step),
+		Path: path,
+	}
+
+	if stepData, ok := step.(map[string]interface{}); ok {
+		for _, key := range []string{"key", "id", "identifier"} {
+			if value, ok := stepData[key].(string); ok {
+				result.Key = value
+				break
+			}
+		}
+		for _, key := range []string{"label", "name", "group", "block", "input", "trigger"} {
+			if value, ok := stepData[key].(string); ok {
+				result.Label = value
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+// stepType names the kind of a step, as written in the pipeline
+func stepType(step interface{}) string {
+	switch v := step.(type) {
+	case string:
+		switch v {
+		case "wait", "waiter":
+			return "wait"
+		case "block", "input":
+			return v
+		}
+	case map[string]interface{}:
+		for _, stepType := range []string{"group", "trigger", "block", "input"} {
+			if _, ok := v[stepType]; ok {
+				return stepType
+			}
+		}
+		if _, ok := v["wait"]; ok {
+			return "wait"
+		}
+		if _, ok := v["waiter"]; ok {
+			return "wait"
+		}
+		// Steps with neither a command nor another type are command steps run by their plugins
+		return "command"
+	}
+	return ""
+}
+
+// nestedStepLines returns the start lines of the items of the `steps:` list nested in a group
+func nestedStepLines(lines []string, groupStart, groupEnd int) []int {
+	var itemLines []int
+
+	stepsLine := -1
+	for i := groupStart + 1; i <= groupEnd; i++ {
+		if yamlKey(lines[i]) == "steps" {
+			stepsLine = i
+			break
+		}
+	}
+	if stepsLine < 0 {
+		return nil
+	}
+
+	itemIndent := -1
+	for i := stepsLine + 1; i <= groupEnd; i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		indent := len(lines[i]) - len(strings.TrimLeft(lines[i], " "))
+		if itemIndent < 0 {
+			if !strings.HasPrefix(trimmed, "-") {
+				return nil
+			}
+			itemIndent = indent
+		}
+		if indent < itemIndent {
+			break
+		}
+		if indent == itemIndent && strings.HasPrefix(trimmed, "-") {
+			itemLines = append(itemLines, i)
+		}
+	}
+
+	return itemLines
+}
+
+// nestedStepSpan returns the lines of the group's nested step containing the line, or -1, -1
+func nestedStepSpan(lines []string, groupStart, groupEnd, line int) (int, int) {
+	itemLines := nestedStepLines(lines, groupStart, groupEnd)
+	if len(itemLines) == 0 {
+		return -1, -1
+	}
+
+	itemIndent := len(lines[itemLines[0]]) - len(strings.TrimLeft(lines[itemLines[0]], " "))
+	for i := len(itemLines) - 1; i >= 0; i-- {
+		if itemLines[i] > line {
+			continue
+		}
+
+		end := groupEnd
+		if i+1 < len(itemLines) {
+			end = itemLines[i+1] - 1
+		} else {
+			// The last nested step runs until the group's next less-indented key
+			for j := itemLines[i] + 1; j <= groupEnd; j++ {
+				trimmed := strings.TrimSpace(lines[j])
+				if trimmed != "" && len(lines[j])-len(strings.TrimLeft(lines[j], " ")) <= itemIndent {
+					end = j - 1
+					break
+				}
+			}
+		}
+
+		if line > end {
+			return -1, -1
+		}
+		return itemLines[i], end
+	}
+
+	return -1, -1
+}
@@ -0,0 +1,98 @@
+package lsp
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+const stepRangePipeline = `env:
+  FOO: bar
+steps:
+  - label: "Build"
+    key: "build"
+    command: "make build"
+
+  - wait
+
+  - group: "Tests"
+    key: "tests"
+    steps:
+      - label: "Unit"
+        command: "make unit"
+      - block: "Approve"
+        id: "approve"
+  - trigger: "deploy"
+    label: "Deploy"`
+
+func TestServer_StepRangeAt(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///.buildkite/pipeline.yml")
+	server.documentManager.OpenDocument(uri, 1, stepRangePipeline)
+
+	stepRange := func(line, end, endChar uint32, start uint32) protocol.Range {
+		return protocol.Range{
+			Start: protocol.Position{Line: line, Character: start},
+			End:   protocol.Position{Line: end, Character: endChar},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		line     uint32
+		expected *StepRange
+	}{
+		{
+			name:     "command step",
+			line:     5,
+			expected: &StepRange{Range: stepRange(3, 5, 25, 2), Type: "command", Key: "build", Label: "Build", Path: []int{0}},
+		},
+		{
+			name:     "wait step",
+			line:     7,
+			expected: &StepRange{Range: stepRange(7, 7, 8, 2), Type: "wait", Path: []int{1}},
+		},
+		{
+			name:     "group header",
+			line:     10,
+			expected: &StepRange{Range: stepRange(9, 15, 21, 2), Type: "group", Key: "tests", Label: "Tests", Path: []int{2}},
+		},
+		{
+			name:     "step inside a group",
+			line:     15,
+			expected: &StepRange{Range: stepRange(14, 15, 21, 6), Type: "block", Key: "approve", Label: "Approve", Path: []int{2, 1}},
+		},
+		{
+			name:     "last step",
+			line:     17,
+			expected: &StepRange{Range: stepRange(16, 17, 19, 2), Type: "trigger", Label: "Deploy", Path: []int{3}},
+		},
+		{
+			name: "outside the steps",
+			line: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := server.StepRangeAt(context.Background(), &protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+				Position:     protocol.Position{Line: tt.line, Character: 4},
+			})
+			if err != nil {
+				t.Fatalf("StepRangeAt failed: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, result)
+			}
+		})
+	}
+
+	if _, err := server.StepRangeAt(context.Background(), &protocol.TextDocumentPositionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: "file:///.buildkite/missing.yml"},
+	}); err == nil {
+		t.Error("Expected an error for a document that isn't open")
+	}
+}
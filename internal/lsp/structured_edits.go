@@ -0,0 +1,401 @@
+package lsp
+
+import (
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+)
+
+// structuredEdit turns changes to a document's YAML nodes, such as adding a property to a
+// step or changing a value, into the smallest text edits that make them. Only the text of
+// the nodes changed is touched, so comments, blank lines and the formatting of everything
+// else stay as written.
+type structuredEdit struct {
+	lines []string
+	root  *yaml.Node
+	edits []protocol.TextEdit
+}
+
+// newStructuredEdit parses the document's lines, returning nil if they aren't valid YAML
+func newStructuredEdit(lines []string) *structuredEdit {
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte(strings.Join(lines, "\n")), &root); err != nil || len(root.Content) == 0 {
+		return nil
+	}
+	return &structuredEdit{lines: lines, root: root.Content[0]}
+}
+
+// textEdits returns the edits made so far
+func (e *structuredEdit) textEdits() []protocol.TextEdit {
+	return e.edits
+}
+
+// stepAt returns the innermost step whose lines include the line, looking inside groups
+func (e *structuredEdit) stepAt(line int) *yaml.Node {
+	var found *yaml.Node
+	var walk func(steps *yaml.Node)
+	walk = func(steps *yaml.Node) {
+		if steps == nil || steps.Kind != yaml.SequenceNode {
+			return
+		}
+		for _, step := range steps.Content {
+			if step.Kind != yaml.MappingNode || line < step.Line-1 || line > int(e.nodeEnd(step).Line) {
+				continue
+			}
+			found = step
+			walk(mappingValue(step, "steps"))
+		}
+	}
+	if e.root.Kind == yaml.MappingNode {
+		walk(mappingValue(e.root, "steps"))
+	}
+	return found
+}
+
+// entryOnLine returns the entry of the mapping whose key is on the line
+func entryOnLine(mapping *yaml.Node, line int) *mappingEntry {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Line-1 == line {
+			return &mappingEntry{key: mapping.Content[i], value: mapping.Content[i+1]}
+		}
+	}
+	return nil
+}
+
+// replace records an edit replacing the text between two positions
+func (e *structuredEdit) replace(start, end protocol.Position, text string) {
+	e.edits = append(e.edits, protocol.TextEdit{Range: protocol.Range{Start: start, End: end}, NewText: text})
+}
+
+// renameKey changes the name of a mapping key, leaving its value as it is
+func (e *structuredEdit) renameKey(entry *mappingEntry, name string) {
+	e.replace(nodeStart(entry.key), e.nodeEnd(entry.key), name)
+}
+
+// setValue replaces the value of an entry with YAML text, filling in a value left empty
+func (e *structuredEdit) setValue(entry *mappingEntry, text string) {
+	if isImplicitNull(entry.value) {
+		position := nodeStart(entry.value)
+		e.replace(position, position, " "+text)
+		return
+	}
+	e.replace(nodeStart(entry.value), e.entryEnd(entry), text)
+}
+
+// replaceEntry replaces an entry, key and value, with YAML text whose lines after the first
+// are indented relative to the key. Text following the entry on its last line, such as a
+// comment, is kept.
+func (e *structuredEdit) replaceEntry(entry *mappingEntry, text string) {
+	indent := strings.Repeat(" ", entry.key.Column-1)
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	for i := 1; i < len(lines); i++ {
+		if lines[i] != "" {
+			lines[i] = indent + lines[i]
+		}
+	}
+	e.replace(nodeStart(entry.key), e.entryEnd(entry), strings.Join(lines, "\n"))
+}
+
+// addProperty adds a key and YAML value to a block mapping on a line of its own, after the
+// given entry or, when that's nil, after the mapping's last entry
+func (e *structuredEdit) addProperty(mapping *yaml.Node, after *mappingEntry, key, value string) {
+	if after == nil {
+		last := len(mapping.Content) - 2
+		after = &mappingEntry{key: mapping.Content[last], value: mapping.Content[last+1]}
+	}
+
+	line := e.entryEnd(after).Line
+	newText := strings.Repeat(" ", mapping.Content[0].Column-1) + key + ": " + value
+	if int(line)+1 >= len(e.lines) {
+		// Past the last line, the property starts a new line of its own
+		end := protocol.Position{Line: line, Character: utf16Length(e.lines[line])}
+		e.replace(end, end, "\n"+newText)
+		return
+	}
+	start := protocol.Position{Line: line + 1}
+	e.replace(start, start, newText+"\n")
+}
+
+// deleteEntry removes an entry from a block mapping. An entry on lines of its own goes with
+// its lines; the first entry of a list item leaves the item's dash for the next entry.
+func (e *structuredEdit) deleteEntry(mapping *yaml.Node, entry *mappingEntry) {
+	start := nodeStart(entry.key)
+	end := e.entryEnd(entry)
+	prefix := e.lines[start.Line][:entry.key.Column-1]
+
+	if strings.TrimSpace(prefix) == "" {
+		if int(end.Line)+1 < len(e.lines) {
+			e.replace(protocol.Position{Line: start.Line}, protocol.Position{Line: end.Line + 1}, "")
+		} else if start.Line > 0 {
+			// The last line has no line after it to delete up to, so it goes with the newline before it
+			previous := start.Line - 1
+			e.replace(protocol.Position{Line: previous, Character: utf16Length(e.lines[previous])},
+				e.position(int(end.Line), len(e.lines[end.Line])), "")
+		}
+		return
+	}
+
+	// Pull the next entry up to take the removed one's place after the dash
+	for i := 0; i+3 < len(mapping.Content); i += 2 {
+		if mapping.Content[i] == entry.key {
+			e.replace(start, nodeStart(mapping.Content[i+2]), "")
+			return
+		}
+	}
+	e.replace(start, end, "{}")
+}
+
+// deleteItem removes an item from a sequence with other items. A block item goes with its
+// lines, and a flow item with the comma separating it from its neighbour.
+func (e *structuredEdit) deleteItem(sequence, item *yaml.Node) {
+	index := slices.Index(sequence.Content, item)
+	if index < 0 || len(sequence.Content) < 2 {
+		return
+	}
+
+	if sequence.Style&yaml.FlowStyle != 0 {
+		if index+1 < len(sequence.Content) {
+			e.replace(nodeStart(item), nodeStart(sequence.Content[index+1]), "")
+		} else {
+			e.replace(e.nodeEnd(sequence.Content[index-1]), e.nodeEnd(item), "")
+		}
+		return
+	}
+
+	start, end := item.Line-1, int(e.nodeEnd(item).Line)
+	if end+1 < len(e.lines) {
+		e.replace(protocol.Position{Line: uint32(start)}, protocol.Position{Line: uint32(end + 1)}, "")
+		return
+	}
+	// The last line has no line after it to delete up to, so it goes with the newline before it
+	previous := start - 1
+	e.replace(protocol.Position{Line: uint32(previous), Character: utf16Length(e.lines[previous])},
+		e.position(end, len(e.lines[end])), "")
+}
+
+// wrapInGroup moves a list item into the steps of a new group step with the label
+func (e *structuredEdit) wrapInGroup(item *yaml.Node, label string) {
+	line := item.Line - 1
+	dash := strings.LastIndex(e.lines[line][:item.Column-1], "-")
+	if dash < 0 {
+		return
+	}
+	indent := strings.Repeat(" ", dash)
+
+	start := protocol.Position{Line: uint32(line), Character: uint32(dash)}
+	e.replace(start, start, "- group: "+yamlString(label)+"\n"+indent+"  steps:\n"+indent+"    ")
+
+	// Indenting every line of the item keeps block scalars within it intact
+	last := int(e.nodeEnd(item).Line)
+	for i := line + 1; i <= last; i++ {
+		if strings.TrimSpace(e.lines[i]) != "" {
+			e.replace(protocol.Position{Line: uint32(i)}, protocol.Position{Line: uint32(i)}, "    ")
+		}
+	}
+}
+
+// yamlString is a string as a YAML scalar, quoted only when it has to be
+func yamlString(value string) string {
+	encoded, err := yaml.Marshal(value)
+	if err != nil {
+		return `"` + value + `"`
+	}
+	return strings.TrimSuffix(string(encoded), "\n")
+}
+
+// nodeStart is where a node's text starts
+func nodeStart(node *yaml.Node) protocol.Position {
+	return protocol.Position{Line: uint32(node.Line - 1), Character: uint32(node.Column - 1)}
+}
+
+// isImplicitNull reports whether a value was left out entirely, as in `command:`
+func isImplicitNull(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.Tag == "!!null" && node.Value == ""
+}
+
+// entryEnd is where an entry's text ends: after its value, or its colon when it has none
+func (e *structuredEdit) entryEnd(entry *mappingEntry) protocol.Position {
+	if isImplicitNull(entry.value) {
+		return nodeStart(entry.value)
+	}
+	return e.nodeEnd(entry.value)
+}
+
+// nodeEnd is where a node's text ends, not counting any comment after it
+func (e *structuredEdit) nodeEnd(node *yaml.Node) protocol.Position {
+	line, offset := node.Line-1, node.Column-1
+	if line >= len(e.lines) {
+		return protocol.Position{Line: uint32(line)}
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode, yaml.SequenceNode:
+		if node.Style&yaml.FlowStyle != 0 {
+			line, offset = e.flowEnd(line, offset)
+			break
+		}
+		if len(node.Content) == 0 {
+			return e.position(line, offset)
+		}
+		last := node.Content[len(node.Content)-1]
+		if node.Kind == yaml.MappingNode && isImplicitNull(last) {
+			return nodeStart(last)
+		}
+		return e.nodeEnd(last)
+	case yaml.ScalarNode, yaml.AliasNode:
+		switch node.Style {
+		case yaml.LiteralStyle, yaml.FoldedStyle:
+			line, offset = e.blockScalarEnd(line)
+		case yaml.DoubleQuotedStyle, yaml.SingleQuotedStyle:
+			line, offset = e.quotedEnd(line, offset, node.Style == yaml.DoubleQuotedStyle)
+		default:
+			line, offset = e.plainEnd(line, offset, node.Value)
+		}
+	}
+	return e.position(line, offset)
+}
+
+// position converts a byte offset within a line to an LSP position
+func (e *structuredEdit) position(line, offset int) protocol.Position {
+	offset = min(offset, len(e.lines[line]))
+	return protocol.Position{Line: uint32(line), Character: utf16Length(e.lines[line][:offset])}
+}
+
+// utf16Length counts a string's UTF-16 code units
+func utf16Length(text string) uint32 {
+	if !utf8.ValidString(text) {
+		return uint32(len(text))
+	}
+	units := uint32(0)
+	for _, r := range text {
+		units++
+		if r >= 0x10000 {
+			units++
+		}
+	}
+	return units
+}
+
+// blockScalarEnd finds the end of the last line of a `|` or `>` scalar's content
+func (e *structuredEdit) blockScalarEnd(header int) (int, int) {
+	headerIndent := len(e.lines[header]) - len(strings.TrimLeft(e.lines[header], " "))
+	last, contentIndent := header, -1
+	for i := header + 1; i < len(e.lines); i++ {
+		if strings.TrimSpace(e.lines[i]) == "" {
+			continue
+		}
+		indent := len(e.lines[i]) - len(strings.TrimLeft(e.lines[i], " "))
+		if contentIndent < 0 {
+			if indent <= headerIndent {
+				break
+			}
+			contentIndent = indent
+		}
+		if indent < contentIndent {
+			break
+		}
+		last = i
+	}
+	if last == header {
+		return header, len(strings.TrimRight(e.lines[header], " "))
+	}
+	return last, len(e.lines[last])
+}
+
+// quotedEnd finds the closing quote of a quoted scalar starting at the offset
+func (e *structuredEdit) quotedEnd(line, offset int, double bool) (int, int) {
+	quote := byte('\'')
+	if double {
+		quote = '"'
+	}
+	i := offset + 1
+	for ; line < len(e.lines); line, i = line+1, 0 {
+		text := e.lines[line]
+		for ; i < len(text); i++ {
+			switch {
+			case double && text[i] == '\\':
+				i++
+			case text[i] == quote && !double && i+1 < len(text) && text[i+1] == '\'':
+				// Single quotes are escaped by doubling them
+				i++
+			case text[i] == quote:
+				return line, i + 1
+			}
+		}
+	}
+	last := len(e.lines) - 1
+	return last, len(e.lines[last])
+}
+
+// plainEnd finds the end of a plain scalar, which can continue onto following lines
+func (e *structuredEdit) plainEnd(line, offset int, value string) (int, int) {
+	end := plainTokenEnd(e.lines[line], offset)
+	consumed := len(strings.Fields(e.lines[line][offset:end]))
+	words := len(strings.Fields(value))
+
+	for next := line + 1; consumed < words && next < len(e.lines); next++ {
+		trimmed := strings.TrimSpace(e.lines[next])
+		if trimmed == "" {
+			continue
+		}
+		start := strings.Index(e.lines[next], trimmed)
+		end = plainTokenEnd(e.lines[next], start)
+		consumed += len(strings.Fields(e.lines[next][start:end]))
+		line = next
+	}
+	return line, end
+}
+
+// plainTokenEnd finds where a plain scalar on a line stops: at a comment, at the colon after
+// a key, or at the end of the line
+func plainTokenEnd(text string, offset int) int {
+	end := len(text)
+	for i := offset + 1; i < len(text); i++ {
+		if text[i] == '#' && (text[i-1] == ' ' || text[i-1] == '\t') {
+			end = i
+			break
+		}
+		if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ' || text[i+1] == '\t') {
+			end = i
+			break
+		}
+	}
+	return offset + len(strings.TrimRight(text[offset:end], " \t"))
+}
+
+// flowEnd finds the bracket closing a flow collection starting at the offset
+func (e *structuredEdit) flowEnd(line, offset int) (int, int) {
+	depth := 0
+	for i := offset; line < len(e.lines); line, i = line+1, 0 {
+		text := e.lines[line]
+		for ; i < len(text); i++ {
+			switch text[i] {
+			case '[', '{':
+				depth++
+			case ']', '}':
+				depth--
+				if depth == 0 {
+					return line, i + 1
+				}
+			case '"', '\'':
+				endLine, endOffset := e.quotedEnd(line, i, text[i] == '"')
+				if endLine != line {
+					line, text = endLine, e.lines[endLine]
+				}
+				i = endOffset - 1
+			case '#':
+				if i > 0 && text[i-1] == ' ' {
+					i = len(text)
+				}
+			}
+		}
+	}
+	last := len(e.lines) - 1
+	return last, len(e.lines[last])
+}
@@ -0,0 +1,245 @@
+package lsp
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+// applyTextEdits applies edits that don't overlap, from the bottom of the document up so
+// earlier positions stay valid
+func applyTextEdits(content string, edits []protocol.TextEdit) string {
+	sorted := append([]protocol.TextEdit(nil), edits...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i].Range.Start, sorted[j].Range.Start
+		return a.Line > b.Line || (a.Line == b.Line && a.Character > b.Character)
+	})
+	for _, edit := range sorted {
+		content = applyTextEdit(content, edit)
+	}
+	return content
+}
+
+func TestStructuredEdit(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		line     int
+		edit     func(e *structuredEdit, step *mappingEntry)
+		expected string
+	}{
+		{
+			name:    "rename a key keeps its comment",
+			content: "steps:\n  - name: Build # the build\n    command: make",
+			line:    1,
+			edit: func(e *structuredEdit, entry *mappingEntry) {
+				e.renameKey(entry, "label")
+			},
+			expected: "steps:\n  - label: Build # the build\n    command: make",
+		},
+		{
+			name:    "set an empty value",
+			content: "steps:\n  - label: Build\n    command:\n    # keep me\n  - wait",
+			line:    2,
+			edit: func(e *structuredEdit, entry *mappingEntry) {
+				e.setValue(entry, "make")
+			},
+			expected: "steps:\n  - label: Build\n    command: make\n    # keep me\n  - wait",
+		},
+		{
+			name:    "set a value keeps its comment",
+			content: "steps:\n  - label: Build\n    timeout_in_minutes: 5 # minutes",
+			line:    2,
+			edit: func(e *structuredEdit, entry *mappingEntry) {
+				e.setValue(entry, "10")
+			},
+			expected: "steps:\n  - label: Build\n    timeout_in_minutes: 10 # minutes",
+		},
+		{
+			name:    "set a quoted value spanning lines",
+			content: "steps:\n  - label: \"Build \\\"it\\\"\n      all\"\n    command: make",
+			line:    1,
+			edit: func(e *structuredEdit, entry *mappingEntry) {
+				e.setValue(entry, "Build")
+			},
+			expected: "steps:\n  - label: Build\n    command: make",
+		},
+		{
+			name:    "replace an entry with several lines",
+			content: "steps:\n  - label: Build\n    command: make # build it",
+			line:    2,
+			edit: func(e *structuredEdit, entry *mappingEntry) {
+				e.replaceEntry(entry, "commands:\n  - make\n")
+			},
+			expected: "steps:\n  - label: Build\n    commands:\n      - make # build it",
+		},
+		{
+			name:    "delete an entry on its own line",
+			content: "steps:\n  - label: Build\n    # why\n    timeout_in_minutes: 5\n    command: make",
+			line:    3,
+			edit: func(e *structuredEdit, entry *mappingEntry) {
+				e.deleteEntry(e.stepAt(3), entry)
+			},
+			expected: "steps:\n  - label: Build\n    # why\n    command: make",
+		},
+		{
+			name:    "delete the last line",
+			content: "steps:\n  - label: Build\n    command: make",
+			line:    2,
+			edit: func(e *structuredEdit, entry *mappingEntry) {
+				e.deleteEntry(e.stepAt(2), entry)
+			},
+			expected: "steps:\n  - label: Build",
+		},
+		{
+			name:    "delete the first entry of a list item",
+			content: "steps:\n  - timeout_in_minutes: 5\n    command: make",
+			line:    1,
+			edit: func(e *structuredEdit, entry *mappingEntry) {
+				e.deleteEntry(e.stepAt(1), entry)
+			},
+			expected: "steps:\n  - command: make",
+		},
+		{
+			name:    "delete a block scalar",
+			content: "steps:\n  - label: Build\n    command: |\n      make\n\n      make test\n    key: build",
+			line:    2,
+			edit: func(e *structuredEdit, entry *mappingEntry) {
+				e.deleteEntry(e.stepAt(2), entry)
+			},
+			expected: "steps:\n  - label: Build\n    key: build",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := splitLines(tt.content)
+			edit := newStructuredEdit(lines)
+			if edit == nil {
+				t.Fatal("Expected the content to parse")
+			}
+			entry := entryOnLine(edit.stepAt(tt.line), tt.line)
+			if entry == nil {
+				t.Fatalf("Expected an entry on line %d", tt.line)
+			}
+			tt.edit(edit, entry)
+
+			if got := applyTextEdits(tt.content, edit.textEdits()); got != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestStructuredEdit_AddProperty(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		after    string
+		expected string
+	}{
+		{
+			name:     "after a multi-line plain value",
+			content:  "steps:\n  - label: Build\n      everything\n    command: make",
+			after:    "label",
+			expected: "steps:\n  - label: Build\n      everything\n    key: build\n    command: make",
+		},
+		{
+			name:     "after a block scalar",
+			content:  "steps:\n  - command: |\n      make\n\n      make test\n  # next\n  - wait",
+			after:    "command",
+			expected: "steps:\n  - command: |\n      make\n\n      make test\n    key: build\n  # next\n  - wait",
+		},
+		{
+			name:     "after a flow list",
+			content:  "steps:\n  - command: make\n    depends_on: [\n      lint, test ]",
+			after:    "depends_on",
+			expected: "steps:\n  - command: make\n    depends_on: [\n      lint, test ]\n    key: build",
+		},
+		{
+			name:     "at the end of the file",
+			content:  "steps:\n  - command: make # build",
+			after:    "",
+			expected: "steps:\n  - command: make # build\n    key: build",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edit := newStructuredEdit(splitLines(tt.content))
+			if edit == nil {
+				t.Fatal("Expected the content to parse")
+			}
+			step := edit.stepAt(1)
+			var after *mappingEntry
+			if tt.after != "" {
+				after = mappingKey(step, tt.after)
+			}
+			edit.addProperty(step, after, "key", "build")
+
+			if got := applyTextEdits(tt.content, edit.textEdits()); got != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestStructuredEdit_WrapInGroup(t *testing.T) {
+	content := `steps:
+  - label: "Build: all" # the build
+    command: |
+      make
+
+      make test
+
+  - wait`
+	edit := newStructuredEdit(splitLines(content))
+	step := edit.stepAt(1)
+	edit.wrapInGroup(step, "Build: all")
+
+	expected := `steps:
+  - group: 'Build: all'
+    steps:
+      - label: "Build: all" # the build
+        command: |
+          make
+
+          make test
+
+  - wait`
+	if got := applyTextEdits(content, edit.textEdits()); got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestServer_WrapInGroupAction(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	content := "steps:\n  - label: Build\n    command: make\n  - wait"
+	server.documentManager.OpenDocument(uri, 1, content)
+
+	actions, err := server.CodeAction(context.Background(), &protocol.CodeActionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Range:        protocol.Range{Start: protocol.Position{Line: 1, Character: 4}, End: protocol.Position{Line: 1, Character: 4}},
+	})
+	if err != nil {
+		t.Fatalf("CodeAction failed: %v", err)
+	}
+
+	var wrap *protocol.CodeAction
+	for i := range actions {
+		if actions[i].Title == "Wrap step in a group" {
+			wrap = &actions[i]
+		}
+	}
+	if wrap == nil {
+		t.Fatalf("Expected 'Wrap step in a group' action, got %+v", actions)
+	}
+
+	expected := "steps:\n  - group: Build\n    steps:\n      - label: Build\n        command: make\n  - wait"
+	if got := applyTextEdits(content, wrap.Edit.Changes[uri]); got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
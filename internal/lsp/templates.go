@@ -0,0 +1,330 @@
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+	"gopkg.in/yaml.v3"
+
+	bkcontext "github.com/mcncl/buildkite-ls/internal/context"
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+// templatesDir holds shared step templates, relative to the checkout root. Each file maps
+// template names to the step properties they provide.
+const templatesDir = ".buildkite/templates"
+
+var (
+	// templateDirectivePattern matches a `# buildkite-ls: extends <name>` comment, which
+	// applies to the step directly below it
+	templateDirectivePattern = regexp.MustCompile(`^(\s*#\s*buildkite-ls:\s*extends\s+)([\w.-]+)\s*$`)
+	// extendsKeyPattern matches an `extends: <name>` step property
+	extendsKeyPattern = regexp.MustCompile(`^(\s*(?:-\s+)?extends:\s*["']?)([\w.-]+)["']?\s*(?:#.*)?$`)
+)
+
+// stepTemplate is a named step template
+type stepTemplate struct {
+	Name string
+	URI  protocol.DocumentURI
+	// Line is the 0-based line of the template's name
+	Line int
+	Node *yaml.Node
+}
+
+// templateReference is a step's reference to a template, by key or comment directive
+type templateReference struct {
+	Name       string
+	Line       int
+	Start, End int
+}
+
+// templateReferenceAt returns the template reference on the line, if it has one
+func templateReferenceAt(line string, lineNum int) *templateReference {
+	match := extendsKeyPattern.FindStringSubmatchIndex(line)
+	if match == nil {
+		match = templateDirectivePattern.FindStringSubmatchIndex(line)
+	}
+	if match == nil {
+		return nil
+	}
+	return &templateReference{Name: line[match[4]:match[5]], Line: lineNum, Start: match[4], End: match[5]}
+}
+
+// isTemplateFile reports whether the path is in a templates directory, whose files hold
+// step templates rather than pipelines
+func isTemplateFile(path string) bool {
+	return strings.Contains(filepath.ToSlash(path), "/"+templatesDir+"/")
+}
+
+// stepTemplates loads the templates available to the document, the first definition of a
+// name winning. Open template files are read from the editor rather than disk.
+func (s *Server) stepTemplates(documentURI protocol.DocumentURI) map[string]stepTemplate {
+	templates := make(map[string]stepTemplate)
+	docPath, ok := uriPath(documentURI)
+	if !ok {
+		return templates
+	}
+
+	dir := filepath.Join(s.checkoutRoot(docPath), templatesDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return templates
+	}
+
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yml" && ext != ".yaml") {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		fileURI := uri.File(path)
+		var content []byte
+		if doc, open := s.documentManager.GetDocument(fileURI); open {
+			content = []byte(doc.Content)
+		} else if content, err = os.ReadFile(path); err != nil {
+			s.logger.Printf("Failed to read step templates %s: %v", path, err)
+			continue
+		}
+
+		var root yaml.Node
+		if err := yaml.Unmarshal(content, &root); err != nil || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+			s.logger.Printf("Skipping step templates %s: not a mapping of template names", path)
+			continue
+		}
+		mapping := root.Content[0]
+		for i := 0; i+1 < len(mapping.Content); i += 2 {
+			name, step := mapping.Content[i], mapping.Content[i+1]
+			if _, taken := templates[name.Value]; taken || step.Kind != yaml.MappingNode {
+				continue
+			}
+			templates[name.Value] = stepTemplate{Name: name.Value, URI: fileURI, Line: name.Line - 1, Node: step}
+		}
+	}
+
+	return templates
+}
+
+// stepTemplateReference finds the template a step extends: its `extends` key, or a directive
+// in the comments directly above it
+func stepTemplateReference(step *yaml.Node, lines []string) *templateReference {
+	if entry := mappingKey(step, "extends"); entry != nil && entry.value.Kind == yaml.ScalarNode {
+		line := entry.value.Line - 1
+		if line < len(lines) {
+			if reference := templateReferenceAt(lines[line], line); reference != nil {
+				return reference
+			}
+		}
+		start := entry.value.Column - 1
+		return &templateReference{Name: entry.value.Value, Line: line, Start: start, End: start + len(entry.value.Value)}
+	}
+
+	for line := step.Line - 2; line >= 0 && line < len(lines); line-- {
+		if !strings.HasPrefix(strings.TrimSpace(lines[line]), "#") {
+			break
+		}
+		if reference := templateReferenceAt(lines[line], line); reference != nil {
+			return reference
+		}
+	}
+	return nil
+}
+
+// resolveTemplates merges the templates steps extend into the pipeline's data, so the
+// merged steps are what gets validated, and reports references to unknown templates. The
+// YAML node tree is left as written, keeping positions in the document.
+func (s *Server) resolveTemplates(uri protocol.DocumentURI, pipeline *parser.Pipeline) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	content := string(pipeline.Content)
+	if uri == "" || !strings.Contains(content, "extends") {
+		return diagnostics
+	}
+
+	root := pipeline.YAMLNode
+	if root == nil || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return diagnostics
+	}
+	var pipelineData map[string]interface{}
+	if err := json.Unmarshal(pipeline.JSONBytes, &pipelineData); err != nil {
+		return diagnostics
+	}
+
+	lines := splitLines(content)
+	var templates map[string]stepTemplate
+
+	var walkSteps func(steps *yaml.Node, data []interface{})
+	walkSteps = func(steps *yaml.Node, data []interface{}) {
+		if steps == nil || steps.Kind != yaml.SequenceNode {
+			return
+		}
+		for i, step := range steps.Content {
+			stepData, ok := data[i].(map[string]interface{})
+			if step.Kind != yaml.MappingNode || !ok {
+				continue
+			}
+			if nested, ok := stepData["steps"].([]interface{}); ok && len(nested) == len(mappingValueOrEmpty(step, "steps")) {
+				walkSteps(mappingValue(step, "steps"), nested)
+			}
+
+			reference := stepTemplateReference(step, lines)
+			if reference == nil {
+				continue
+			}
+			delete(stepData, "extends")
+
+			if templates == nil {
+				templates = s.stepTemplates(uri)
+			}
+			template, ok := templates[reference.Name]
+			if !ok {
+				diagnostics = append(diagnostics, unknownTemplateDiagnostic(reference, templates))
+				continue
+			}
+
+			var templateData map[string]interface{}
+			if err := template.Node.Decode(&templateData); err != nil {
+				continue
+			}
+			data[i] = mergeTemplate(templateData, stepData)
+		}
+	}
+
+	steps, _ := pipelineData["steps"].([]interface{})
+	if stepsNode := mappingValue(root.Content[0], "steps"); stepsNode != nil && len(steps) == len(stepsNode.Content) {
+		walkSteps(stepsNode, steps)
+	}
+
+	if merged, err := json.Marshal(pipelineData); err == nil {
+		pipeline.JSONBytes = merged
+	}
+	return diagnostics
+}
+
+// mappingValueOrEmpty returns the items of a sequence value, or nothing
+func mappingValueOrEmpty(node *yaml.Node, key string) []*yaml.Node {
+	if value := mappingValue(node, key); value != nil && value.Kind == yaml.SequenceNode {
+		return value.Content
+	}
+	return nil
+}
+
+// mergeTemplate lays a step over the template it extends. The step's properties win, except
+// env and agents, whose entries are merged.
+func mergeTemplate(template, step map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(template)+len(step))
+	for key, value := range template {
+		if key != "extends" {
+			merged[key] = value
+		}
+	}
+
+	for key, value := range step {
+		base, baseIsMap := merged[key].(map[string]interface{})
+		overlay, overlayIsMap := value.(map[string]interface{})
+		if (key == "env" || key == "agents") && baseIsMap && overlayIsMap {
+			combined := make(map[string]interface{}, len(base)+len(overlay))
+			for k, v := range base {
+				combined[k] = v
+			}
+			for k, v := range overlay {
+				combined[k] = v
+			}
+			merged[key] = combined
+			continue
+		}
+		merged[key] = value
+	}
+
+	// Decoded YAML keeps its own number types, which the schema validator reads through JSON
+	if encoded, err := json.Marshal(merged); err == nil {
+		var normalized map[string]interface{}
+		if json.Unmarshal(encoded, &normalized) == nil {
+			return normalized
+		}
+	}
+	return merged
+}
+
+// unknownTemplateDiagnostic flags a reference to a template that isn't defined
+func unknownTemplateDiagnostic(reference *templateReference, templates map[string]stepTemplate) protocol.Diagnostic {
+	message := fmt.Sprintf("Unknown step template '%s'. Templates are defined in %s/*.yml", reference.Name, templatesDir)
+	if len(templates) > 0 {
+		names := make([]string, 0, len(templates))
+		for name := range templates {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		message += fmt.Sprintf(" (available: %s)", strings.Join(names, ", "))
+	}
+
+	return protocol.Diagnostic{
+		Range: protocol.Range{
+			Start: protocol.Position{Line: uint32(reference.Line), Character: uint32(reference.Start)},
+			End:   protocol.Position{Line: uint32(reference.Line), Character: uint32(reference.End)},
+		},
+		Severity: protocol.DiagnosticSeverityWarning,
+		Message:  message,
+		Source:   "buildkite-ls",
+		Code:     "unknown-template",
+	}
+}
+
+// templateAt returns the template referenced on the cursor's line
+func (s *Server) templateAt(posCtx *bkcontext.PositionContext) (*stepTemplate, *templateReference) {
+	reference := templateReferenceAt(posCtx.CurrentLine, int(posCtx.Position.Line))
+	if reference == nil {
+		return nil, nil
+	}
+	template, ok := s.stepTemplates(posCtx.URI)[reference.Name]
+	if !ok {
+		return nil, reference
+	}
+	return &template, reference
+}
+
+// getTemplateHoverContent describes the template a step extends, with its properties
+func (s *Server) getTemplateHoverContent(posCtx *bkcontext.PositionContext) string {
+	template, reference := s.templateAt(posCtx)
+	if reference == nil {
+		return ""
+	}
+	if template == nil {
+		return fmt.Sprintf("**Extends template** `%s`\n\nNo template with this name is defined in `%s/`.", reference.Name, templatesDir)
+	}
+
+	var body bytes.Buffer
+	encoder := yaml.NewEncoder(&body)
+	encoder.SetIndent(2)
+	_ = encoder.Encode(template.Node)
+	_ = encoder.Close()
+
+	file := filepath.Base(template.URI.Filename())
+	return fmt.Sprintf("**This step extends template** `%s` from `%s/%s`\n\n"+
+		"The step's own properties override the template's, and `env` and `agents` entries are merged.\n\n```yaml\n%s```",
+		template.Name, templatesDir, file, body.String())
+}
+
+// findTemplateDefinition locates the template referenced under the cursor
+func (s *Server) findTemplateDefinition(posCtx *bkcontext.PositionContext) *protocol.Location {
+	template, reference := s.templateAt(posCtx)
+	if template == nil || posCtx.CharIndex < reference.Start || posCtx.CharIndex > reference.End {
+		return nil
+	}
+
+	return &protocol.Location{
+		URI: template.URI,
+		Range: protocol.Range{
+			Start: protocol.Position{Line: uint32(template.Line), Character: 0},
+			End:   protocol.Position{Line: uint32(template.Line), Character: uint32(len(template.Name))},
+		},
+	}
+}
@@ -0,0 +1,139 @@
+package lsp
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+)
+
+const testStepTemplates = `docker-build:
+  command: make build
+  agents:
+    queue: docker
+  env:
+    DOCKER_BUILDKIT: "1"
+
+broken:
+  soft_fail: sometimes
+`
+
+// writeStepTemplates writes the test templates into the checkout at root
+func writeStepTemplates(t *testing.T, root string) protocol.DocumentURI {
+	t.Helper()
+	return writeWorkspacePipeline(t, root, filepath.Join("templates", "steps.yml"), testStepTemplates)
+}
+
+func TestServer_StepTemplateValidation(t *testing.T) {
+	server := newTestServer()
+	root := t.TempDir()
+	writeStepTemplates(t, root)
+	uri := protocol.DocumentURI("file://" + filepath.Join(root, ".buildkite", "pipeline.yml"))
+
+	codes := func(content string) map[string]string {
+		found := make(map[string]string)
+		for _, diagnostic := range server.diagnose(uri, content) {
+			code, _ := diagnostic.Code.(string)
+			found[code] = diagnostic.Message
+		}
+		return found
+	}
+
+	t.Run("extends key", func(t *testing.T) {
+		found := codes("steps:\n  - label: Build\n    key: build\n    extends: docker-build\n    agents:\n      arch: arm64\n")
+		if len(found) != 0 {
+			t.Errorf("Expected the merged step to be valid, got %v", found)
+		}
+	})
+
+	t.Run("comment directive", func(t *testing.T) {
+		found := codes("steps:\n  # Build the image\n  # buildkite-ls: extends docker-build\n  - label: Build\n    key: build\n")
+		if len(found) != 0 {
+			t.Errorf("Expected the merged step to be valid, got %v", found)
+		}
+	})
+
+	t.Run("merged result is validated", func(t *testing.T) {
+		found := codes("steps:\n  - label: Build\n    command: make\n    extends: broken\n")
+		if message, ok := found[""]; !ok || !strings.Contains(message, "Schema validation error") {
+			t.Errorf("Expected the template's soft_fail to fail schema validation, got %v", found)
+		}
+	})
+
+	t.Run("unknown template", func(t *testing.T) {
+		diagnostics := server.diagnose(uri, "steps:\n  - label: Build\n    command: make\n    extends: docker\n")
+		if len(diagnostics) != 1 || diagnostics[0].Code != "unknown-template" {
+			t.Fatalf("Expected an unknown-template diagnostic, got %+v", diagnostics)
+		}
+		if diagnostics[0].Range.Start.Line != 3 || diagnostics[0].Range.Start.Character != 13 {
+			t.Errorf("Expected the diagnostic on the template name, got %+v", diagnostics[0].Range)
+		}
+		if !strings.Contains(diagnostics[0].Message, "available: broken, docker-build") {
+			t.Errorf("Expected the available templates in the message, got %q", diagnostics[0].Message)
+		}
+	})
+
+	t.Run("steps without templates", func(t *testing.T) {
+		if found := codes("steps:\n  - label: Build\n    key: build\n"); found["missing-step-type"] == "" {
+			t.Errorf("Expected a step without a template to still need a type, got %v", found)
+		}
+	})
+}
+
+func TestServer_StepTemplateHoverAndDefinition(t *testing.T) {
+	server := newTestServer()
+	// The space is escaped in the pipeline's and the templates' URIs
+	root := filepath.Join(t.TempDir(), "my repo")
+	templatesURI := writeStepTemplates(t, root)
+	uri := uri.File(filepath.Join(root, ".buildkite", "pipeline.yml"))
+	server.documentManager.OpenDocument(uri, 1, "steps:\n  - label: Build\n    extends: docker-build\n")
+
+	hover, err := server.Hover(context.Background(), &protocol.HoverParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 2, Character: 16},
+		},
+	})
+	if err != nil || hover == nil {
+		t.Fatalf("Expected hover content, got %v, %v", hover, err)
+	}
+	for _, expected := range []string{"This step extends template** `docker-build`", ".buildkite/templates/steps.yml", "queue: docker"} {
+		if !strings.Contains(hover.Contents.Value, expected) {
+			t.Errorf("Expected hover to contain %q, got %q", expected, hover.Contents.Value)
+		}
+	}
+
+	locations, err := server.Definition(context.Background(), &protocol.DefinitionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 2, Character: 16},
+		},
+	})
+	if err != nil || len(locations) != 1 {
+		t.Fatalf("Expected one definition, got %+v, %v", locations, err)
+	}
+	if locations[0].URI != templatesURI || locations[0].Range.Start.Line != 0 {
+		t.Errorf("Expected the template's name in its file, got %+v", locations[0])
+	}
+}
+
+func TestServer_StepTemplatesFromOpenDocument(t *testing.T) {
+	server := newTestServer()
+	// The space is escaped in the pipeline's and the templates' URIs
+	root := filepath.Join(t.TempDir(), "my repo")
+	templatesURI := writeStepTemplates(t, root)
+	uri := uri.File(filepath.Join(root, ".buildkite", "pipeline.yml"))
+
+	// Unsaved edits to the templates are used over the file on disk
+	server.documentManager.OpenDocument(templatesURI, 1, testStepTemplates+"\nlint:\n  command: make lint\n")
+	if _, ok := server.stepTemplates(uri)["lint"]; !ok {
+		t.Error("Expected the template added in the editor to be found")
+	}
+
+	if server.isBuildkiteFile(string(templatesURI)) {
+		t.Error("Expected template files not to be treated as pipelines")
+	}
+}
@@ -0,0 +1,105 @@
+package lsp
+
+import (
+	"fmt"
+	"strconv"
+
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+)
+
+// ToggleSkipCommand skips the step containing a position, or stops skipping it when it's
+// already skipped. Its arguments are the document URI, the position and optionally the
+// reason the step is skipped for.
+const ToggleSkipCommand = "buildkite.toggleSkip"
+
+// skippableStepTypes are the steps that take skip
+var skippableStepTypes = map[string]bool{"command": true, "trigger": true, "group": true}
+
+// toggleSkipCommand reads the arguments of the toggle skip command, builds the edit and,
+// when there's a client to apply it, asks the client to apply it. The edit is returned
+// either way, for extensions that apply it themselves.
+func (s *Server) toggleSkipCommand(arguments []interface{}) (*protocol.WorkspaceEdit, error) {
+	if len(arguments) < 2 {
+		return nil, fmt.Errorf("%s expects a document URI and a position", ToggleSkipCommand)
+	}
+	uri, ok := arguments[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("%s expects a document URI, got %v", ToggleSkipCommand, arguments[0])
+	}
+	position, err := positionArgument(arguments[1])
+	if err != nil {
+		return nil, fmt.Errorf("%s expects a position: %w", ToggleSkipCommand, err)
+	}
+	var reason string
+	if len(arguments) > 2 {
+		if reason, ok = arguments[2].(string); !ok {
+			return nil, fmt.Errorf("%s expects a reason, got %v", ToggleSkipCommand, arguments[2])
+		}
+	}
+
+	doc, exists := s.documentManager.GetDocument(protocol.DocumentURI(uri))
+	if !exists {
+		return nil, fmt.Errorf("document not found: %s", uri)
+	}
+	title, edits := toggleSkipEdits(doc.Lines, int(position.Line), reason)
+	if edits == nil {
+		return nil, fmt.Errorf("no step that can be skipped at line %d", position.Line+1)
+	}
+	edit := &protocol.WorkspaceEdit{Changes: map[protocol.DocumentURI][]protocol.TextEdit{protocol.DocumentURI(uri): edits}}
+	s.matchLineEndings(edit)
+
+	if s.conn != nil {
+		s.applyEdit(protocol.ApplyWorkspaceEditParams{Label: title, Edit: *edit}, func(err error) {
+			if err != nil {
+				s.logger.Printf("Failed to toggle skip: %v", err)
+			}
+		})
+	}
+
+	return edit, nil
+}
+
+// createToggleSkipAction offers to skip the step at the line, or to stop skipping it
+func (s *Server) createToggleSkipAction(uri protocol.DocumentURI, lines []string, line int) *protocol.CodeAction {
+	title, edits := toggleSkipEdits(lines, line, "")
+	if edits == nil {
+		return nil
+	}
+	action := quickFix(uri, title, edits)
+	action.Kind = protocol.RefactorRewrite
+	return &action
+}
+
+// toggleSkipEdits removes the skip of the innermost step containing the line, or when it
+// isn't skipped, skips it with the reason, or true without one. skip goes after the step's
+// first entry, where it's seen next to the label. It returns no edits when the line isn't
+// in a step that takes skip.
+func toggleSkipEdits(lines []string, line int, reason string) (string, []protocol.TextEdit) {
+	edit, step := stepEditOf(lines, line)
+	if edit == nil || step.Style&yaml.FlowStyle != 0 || len(step.Content) == 0 {
+		return "", nil
+	}
+	var decoded interface{}
+	if err := step.Decode(&decoded); err != nil || !skippableStepTypes[stepType(decoded)] {
+		return "", nil
+	}
+
+	value := "true"
+	if reason != "" {
+		value = strconv.Quote(reason)
+	}
+
+	entry := mappingKey(step, "skip")
+	switch {
+	case entry == nil:
+		edit.addProperty(step, &mappingEntry{key: step.Content[0], value: step.Content[1]}, "skip", value)
+		return "Skip this step", edit.textEdits()
+	case entry.value.Kind == yaml.ScalarNode && (entry.value.Value == "false" || isImplicitNull(entry.value)):
+		edit.setValue(entry, value)
+		return "Skip this step", edit.textEdits()
+	default:
+		edit.deleteEntry(step, entry)
+		return "Stop skipping this step", edit.textEdits()
+	}
+}
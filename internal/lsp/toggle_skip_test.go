@@ -0,0 +1,143 @@
+package lsp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+func TestServer_ToggleSkipCommand(t *testing.T) {
+	content := `steps:
+  - label: Build
+    command: make
+  - label: Deploy
+    skip: "Incident 42"
+    command: make deploy
+  - group: Checks
+    steps:
+      - label: Lint
+        command: make lint
+        skip: false
+  - wait
+  - block: Release`
+
+	tests := []struct {
+		name      string
+		line      float64
+		reason    interface{}
+		expected  string
+		expectErr bool
+	}{
+		{
+			name: "skips a step",
+			line: 2,
+			expected: `steps:
+  - label: Build
+    skip: true
+    command: make
+  - label: Deploy`,
+		},
+		{
+			name:   "skips a step with a reason",
+			line:   1,
+			reason: "Flaky: see #123",
+			expected: `  - label: Build
+    skip: "Flaky: see #123"
+    command: make`,
+		},
+		{
+			name: "stops skipping a step",
+			line: 5,
+			expected: `  - label: Deploy
+    command: make deploy`,
+		},
+		{
+			name: "skips a step in a group",
+			line: 9,
+			expected: `      - label: Lint
+        command: make lint
+        skip: true`,
+		},
+		{
+			name: "skips a group",
+			line: 6,
+			expected: `  - group: Checks
+    skip: true
+    steps:`,
+		},
+		{
+			name:      "wait steps can't be skipped",
+			line:      11,
+			expectErr: true,
+		},
+		{
+			name:      "block steps can't be skipped",
+			line:      12,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer()
+			uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+			server.documentManager.OpenDocument(uri, 1, content)
+
+			arguments := []interface{}{string(uri), map[string]interface{}{"line": tt.line, "character": float64(4)}}
+			if tt.reason != nil {
+				arguments = append(arguments, tt.reason)
+			}
+			result, err := server.ExecuteCommand(context.Background(), &protocol.ExecuteCommandParams{Command: ToggleSkipCommand, Arguments: arguments})
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("Expected an error, got %+v", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExecuteCommand failed: %v", err)
+			}
+
+			edit, ok := result.(*protocol.WorkspaceEdit)
+			if !ok {
+				t.Fatalf("Expected a workspace edit, got %+v", result)
+			}
+			if updated := applyTextEdits(content, edit.Changes[uri]); !strings.Contains(updated, tt.expected) {
+				t.Errorf("Expected the document to contain:\n%s\ngot:\n%s", tt.expected, updated)
+			}
+		})
+	}
+}
+
+func TestServer_ToggleSkipAction(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	server.documentManager.OpenDocument(uri, 1, "steps:\n  - command: make\n    skip: true\n  - wait")
+
+	titles := func(line uint32) []string {
+		position := protocol.Position{Line: line, Character: 4}
+		actions, err := server.CodeAction(context.Background(), &protocol.CodeActionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Range:        protocol.Range{Start: position, End: position},
+		})
+		if err != nil {
+			t.Fatalf("CodeAction failed: %v", err)
+		}
+		var found []string
+		for _, action := range actions {
+			if action.Title == "Skip this step" || action.Title == "Stop skipping this step" {
+				found = append(found, action.Title)
+			}
+		}
+		return found
+	}
+
+	if got := titles(1); len(got) != 1 || got[0] != "Stop skipping this step" {
+		t.Errorf("Expected to stop skipping the skipped step, got %v", got)
+	}
+	if got := titles(3); len(got) != 0 {
+		t.Errorf("Expected no skip action on a wait step, got %v", got)
+	}
+}
@@ -0,0 +1,68 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"go.lsp.dev/jsonrpc2"
+	"go.lsp.dev/protocol"
+)
+
+// SlowRequestEvent is sent as a telemetry/event payload when a request exceeds the configured threshold
+type SlowRequestEvent struct {
+	Event         string `json:"event"`
+	Method        string `json:"method"`
+	DurationMs    int64  `json:"durationMs"`
+	URI           string `json:"uri,omitempty"`
+	DocumentSize  int    `json:"documentSize,omitempty"`
+	DocumentLines int    `json:"documentLines,omitempty"`
+}
+
+// traceRequest logs requests that took longer than the configured threshold
+func (s *Server) traceRequest(ctx context.Context, req jsonrpc2.Request, start time.Time) {
+	elapsed := time.Since(start)
+
+	settings := s.Settings()
+	threshold := settings.SlowRequestThreshold()
+	if threshold <= 0 || elapsed < threshold {
+		return
+	}
+
+	event := SlowRequestEvent{
+		Event:      "slowRequest",
+		Method:     req.Method(),
+		DurationMs: elapsed.Milliseconds(),
+	}
+
+	// Most requests carry a text document, which is usually what makes them slow
+	if uri := requestDocumentURI(req); uri != "" {
+		event.URI = string(uri)
+		if doc, exists := s.documentManager.GetDocument(uri); exists {
+			event.DocumentSize = len(doc.Content)
+			event.DocumentLines = len(doc.Lines)
+		}
+	}
+
+	s.logger.Printf("Slow request: %s took %v (threshold %v, uri: %s, size: %d bytes, %d lines)",
+		event.Method, elapsed, threshold, event.URI, event.DocumentSize, event.DocumentLines)
+
+	if settings.SlowRequestTelemetry && s.conn != nil {
+		if err := s.conn.Notify(ctx, "telemetry/event", event); err != nil {
+			s.logger.Printf("Failed to send slow request telemetry: %v", err)
+		}
+	}
+}
+
+// requestDocumentURI extracts textDocument.uri from a request's params, if present
+func requestDocumentURI(req jsonrpc2.Request) protocol.DocumentURI {
+	var params struct {
+		TextDocument struct {
+			URI protocol.DocumentURI `json:"uri"`
+		} `json:"textDocument"`
+	}
+	if err := json.Unmarshal(req.Params(), &params); err != nil {
+		return ""
+	}
+	return params.TextDocument.URI
+}
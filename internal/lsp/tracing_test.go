@@ -0,0 +1,88 @@
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.lsp.dev/jsonrpc2"
+	"go.lsp.dev/protocol"
+)
+
+func TestServer_TraceRequest(t *testing.T) {
+	server := newTestServer()
+
+	var logs bytes.Buffer
+	server.logger = log.New(&logs, "", 0)
+
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	server.documentManager.OpenDocument(uri, 1, "steps:\n  - command: test\n")
+
+	req, err := jsonrpc2.NewCall(jsonrpc2.NewNumberID(1), "textDocument/hover", protocol.HoverParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+
+	t.Run("fast request is not logged", func(t *testing.T) {
+		logs.Reset()
+		server.traceRequest(context.Background(), req, time.Now())
+
+		if strings.Contains(logs.String(), "Slow request") {
+			t.Errorf("Expected no slow request log, got: %s", logs.String())
+		}
+	})
+
+	t.Run("slow request is logged with document details", func(t *testing.T) {
+		logs.Reset()
+		server.traceRequest(context.Background(), req, time.Now().Add(-time.Second))
+
+		output := logs.String()
+		for _, expected := range []string{"Slow request", "textDocument/hover", string(uri), "2 lines"} {
+			if !strings.Contains(output, expected) {
+				t.Errorf("Expected log to contain %q, got: %s", expected, output)
+			}
+		}
+	})
+
+	t.Run("zero threshold disables logging", func(t *testing.T) {
+		logs.Reset()
+		server.SetSettings(Settings{SlowRequestThresholdMs: 0})
+		server.traceRequest(context.Background(), req, time.Now().Add(-time.Second))
+
+		if logs.Len() != 0 {
+			t.Errorf("Expected no logs, got: %s", logs.String())
+		}
+	})
+}
+
+func TestParseSettings(t *testing.T) {
+	defaults := DefaultSettings()
+
+	if settings := parseSettings(nil); !reflect.DeepEqual(settings, defaults) {
+		t.Errorf("Expected defaults for nil options, got %+v", settings)
+	}
+
+	settings := parseSettings(map[string]interface{}{
+		"slowRequestThresholdMs": 100,
+		"slowRequestTelemetry":   true,
+	})
+	if settings.SlowRequestThreshold() != 100*time.Millisecond {
+		t.Errorf("Expected 100ms threshold, got %v", settings.SlowRequestThreshold())
+	}
+	if !settings.SlowRequestTelemetry {
+		t.Error("Expected slow request telemetry to be enabled")
+	}
+
+	// Malformed options fall back to the defaults
+	if settings := parseSettings(map[string]interface{}{"slowRequestThresholdMs": "fast"}); !reflect.DeepEqual(settings, defaults) {
+		t.Errorf("Expected defaults for malformed options, got %+v", settings)
+	}
+}
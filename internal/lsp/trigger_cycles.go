@@ -0,0 +1,177 @@
+package lsp
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.lsp.dev/protocol"
+)
+
+// triggerReference is a trigger step's pipeline slug and where it is written
+type triggerReference struct {
+	Pipeline string
+	Location protocol.Location
+}
+
+// findTriggerReferences locates the pipeline slugs of trigger steps, e.g. `- trigger: "deploy"`
+func findTriggerReferences(uri protocol.DocumentURI, lines []string) []triggerReference {
+	var references []triggerReference
+	for i, line := range lines {
+		if yamlKey(line) != "trigger" {
+			continue
+		}
+
+		colon := strings.Index(line, ":")
+		value := strings.TrimSpace(line[colon+1:])
+		if comment := strings.Index(value, " #"); comment >= 0 {
+			value = strings.TrimSpace(value[:comment])
+		}
+		slug := strings.Trim(value, `"'`)
+		if slug == "" {
+			continue
+		}
+
+		start := colon + 1 + strings.Index(line[colon+1:], slug)
+		references = append(references, triggerReference{
+			Pipeline: slug,
+			Location: protocol.Location{
+				URI: uri,
+				Range: protocol.Range{
+					Start: protocol.Position{Line: uint32(i), Character: uint32(start)},
+					End:   protocol.Position{Line: uint32(i), Character: uint32(start + len(slug))},
+				},
+			},
+		})
+	}
+	return references
+}
+
+// pipelineSlug returns the slug the pipelineSlugs setting gives the file, or "" if it has none.
+// Paths are absolute or relative to a workspace root.
+func (s *Server) pipelineSlug(uri protocol.DocumentURI) string {
+	slugs := s.Settings().PipelineSlugs
+	if len(slugs) == 0 {
+		return ""
+	}
+
+	s.settingsMu.RLock()
+	roots := s.workspaceRoots
+	s.settingsMu.RUnlock()
+
+	path, ok := uriPath(uri)
+	if !ok {
+		return ""
+	}
+	names := make([]string, 0, len(slugs))
+	for slug := range slugs {
+		names = append(names, slug)
+	}
+	sort.Strings(names)
+
+	for _, slug := range names {
+		file := slugs[slug]
+		if filepath.IsAbs(file) {
+			if filepath.Clean(file) == path {
+				return slug
+			}
+			continue
+		}
+		for _, root := range roots {
+			if filepath.Join(root, file) == path {
+				return slug
+			}
+		}
+	}
+	return ""
+}
+
+// validateTriggerCycles warns on trigger steps whose pipeline, directly or through the
+// pipelines it triggers, triggers this pipeline again. Pipelines are matched to workspace
+// files with the pipelineSlugs setting, so nothing is checked until it is configured.
+func (s *Server) validateTriggerCycles(uri protocol.DocumentURI, lines []string) []protocol.Diagnostic {
+	self := s.pipelineSlug(uri)
+	if self == "" {
+		return nil
+	}
+
+	// The triggers of every pipeline with a known slug, this document's as currently edited
+	documents := s.workspaceDocuments()
+	documents[uri] = lines
+	triggers := make(map[string][]triggerReference)
+	for documentURI, documentLines := range documents {
+		if slug := s.pipelineSlug(documentURI); slug != "" {
+			triggers[slug] = append(triggers[slug], findTriggerReferences(documentURI, documentLines)...)
+		}
+	}
+
+	var diagnostics []protocol.Diagnostic
+	for _, reference := range findTriggerReferences(uri, lines) {
+		chain := triggerPath(triggers, reference.Pipeline, self)
+		if chain == nil {
+			continue
+		}
+
+		pipelines := []string{self, reference.Pipeline}
+		var related []protocol.DiagnosticRelatedInformation
+		for _, link := range chain {
+			pipelines = append(pipelines, link.Pipeline)
+			related = append(related, protocol.DiagnosticRelatedInformation{
+				Location: link.Location,
+				Message:  fmt.Sprintf("'%s' is triggered here", link.Pipeline),
+			})
+		}
+
+		message := fmt.Sprintf("Pipeline '%s' triggers itself", self)
+		if len(pipelines) > 2 {
+			message = "Trigger cycle: " + strings.Join(pipelines, " → ")
+		}
+		diagnostics = append(diagnostics, protocol.Diagnostic{
+			Range:              reference.Location.Range,
+			Severity:           protocol.DiagnosticSeverityWarning,
+			Message:            message + ". Each build would trigger another without end.",
+			Source:             "buildkite-ls",
+			Code:               "trigger-cycle",
+			RelatedInformation: related,
+		})
+	}
+	return diagnostics
+}
+
+// triggerPath returns the shortest chain of trigger steps leading from one pipeline to
+// another, empty if they are the same pipeline, or nil if there is none
+func triggerPath(triggers map[string][]triggerReference, from, to string) []triggerReference {
+	if from == to {
+		return []triggerReference{}
+	}
+
+	// Breadth-first, remembering the trigger step and pipeline each pipeline was first reached from
+	reachedBy := map[string]triggerReference{}
+	parent := map[string]string{}
+	visited := map[string]bool{from: true}
+	queue := []string{from}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, reference := range triggers[current] {
+			if visited[reference.Pipeline] {
+				continue
+			}
+			visited[reference.Pipeline] = true
+			reachedBy[reference.Pipeline], parent[reference.Pipeline] = reference, current
+			if reference.Pipeline != to {
+				queue = append(queue, reference.Pipeline)
+				continue
+			}
+
+			var chain []triggerReference
+			for pipeline := to; pipeline != from; pipeline = parent[pipeline] {
+				chain = append([]triggerReference{reachedBy[pipeline]}, chain...)
+			}
+			return chain
+		}
+	}
+	return nil
+}
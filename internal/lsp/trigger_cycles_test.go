@@ -0,0 +1,77 @@
+package lsp
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestServer_TriggerCycles(t *testing.T) {
+	server := newTestServer()
+	// The space and percent sign are escaped in the files' URIs
+	root := filepath.Join(t.TempDir(), "my repo 100%")
+	appURI := writeWorkspacePipeline(t, root, "pipeline.yml", `steps:
+  - label: "Build"
+    command: make
+  - trigger: "my-app-deploy"
+    label: "Deploy"`)
+	deployURI := writeWorkspacePipeline(t, root, "pipeline.deploy.yml", `steps:
+  - trigger: "my-app-smoke"`)
+	writeWorkspacePipeline(t, root, "pipeline.smoke.yml", `steps:
+  - trigger: my-app # re-run everything
+  - trigger: "unrelated"`)
+
+	server.SetWorkspaceRoots([]string{root})
+	settings := DefaultSettings()
+	settings.PipelineSlugs = map[string]string{
+		"my-app":        ".buildkite/pipeline.yml",
+		"my-app-deploy": ".buildkite/pipeline.deploy.yml",
+		"my-app-smoke":  root + "/.buildkite/pipeline.smoke.yml",
+	}
+	server.applySettings(settings)
+
+	lines := strings.Split(`steps:
+  - label: "Build"
+    command: make
+  - trigger: "my-app-deploy"
+    label: "Deploy"`, "\n")
+	diagnostics := server.validateTriggerCycles(appURI, lines)
+	if len(diagnostics) != 1 {
+		t.Fatalf("Expected 1 trigger cycle, got %+v", diagnostics)
+	}
+
+	diagnostic := diagnostics[0]
+	if diagnostic.Code != "trigger-cycle" || diagnostic.Range.Start.Line != 3 || diagnostic.Range.Start.Character != 14 {
+		t.Errorf("Expected a trigger-cycle on the trigger's slug, got %+v", diagnostic)
+	}
+	if !strings.Contains(diagnostic.Message, "my-app → my-app-deploy → my-app-smoke → my-app") {
+		t.Errorf("Expected the cycle in the message, got %q", diagnostic.Message)
+	}
+	if len(diagnostic.RelatedInformation) != 2 || diagnostic.RelatedInformation[0].Location.URI != deployURI {
+		t.Errorf("Expected the other trigger steps as related locations, got %+v", diagnostic.RelatedInformation)
+	}
+
+	// Breaking the chain in the open document clears the warning
+	lines[3] = `  - trigger: "my-app-docs"`
+	if diagnostics := server.validateTriggerCycles(appURI, lines); len(diagnostics) != 0 {
+		t.Errorf("Expected no cycle once the chain is broken, got %+v", diagnostics)
+	}
+
+	// A pipeline triggering itself is a cycle too
+	lines[3] = `  - trigger: "my-app"`
+	if diagnostics := server.validateTriggerCycles(appURI, lines); len(diagnostics) != 1 || !strings.Contains(diagnostics[0].Message, "triggers itself") {
+		t.Errorf("Expected a self-trigger warning, got %+v", diagnostics)
+	}
+}
+
+func TestServer_TriggerCycles_WithoutSlugs(t *testing.T) {
+	server := newTestServer()
+	root := t.TempDir()
+	uri := writeWorkspacePipeline(t, root, "pipeline.yml", `steps:
+  - trigger: "my-app"`)
+	server.SetWorkspaceRoots([]string{root})
+
+	if diagnostics := server.validateTriggerCycles(uri, []string{"steps:", `  - trigger: "my-app"`}); len(diagnostics) != 0 {
+		t.Errorf("Expected nothing checked without pipeline slugs, got %+v", diagnostics)
+	}
+}
@@ -0,0 +1,208 @@
+package lsp
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+
+	"github.com/mcncl/buildkite-ls/internal/context"
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+// triggerStepKeys lists the keys a trigger step is allowed to declare, as the bundled schema
+// does, so keys added upstream are allowed as soon as the schema is updated
+var triggerStepKeys = schemaStepKeys("trigger")
+
+// triggerBuildKeys are the keys of the build a trigger step creates, as the schema allows
+var triggerBuildKeys = map[string]string{
+	"message":   "**message** - Message of the triggered build\n\nShown as the build's title in Buildkite. Defaults to the message of the build that triggers it.\n\nExample: `message: \"${BUILDKITE_MESSAGE}\"`",
+	"commit":    "**commit** - Commit the triggered build runs on\n\nA commit SHA or ref of the triggered pipeline's repository. Defaults to `HEAD`.\n\nExample: `commit: \"${BUILDKITE_COMMIT}\"`",
+	"branch":    "**branch** - Branch the triggered build runs on\n\nDefaults to the triggered pipeline's default branch.\n\nExample: `branch: \"${BUILDKITE_BRANCH}\"`",
+	"meta_data": "**meta_data** - Meta-data of the triggered build\n\nKey-value pairs set on the triggered build, readable there with `buildkite-agent meta-data get`.\n\nExample:\n```yaml\nmeta_data:\n  release-version: \"1.1\"\n```",
+	"env":       "**env** - Environment variables of the triggered build\n\nSet on every job of the triggered build.\n\nExample:\n```yaml\nenv:\n  DEPLOY_ENV: production\n```",
+}
+
+// getTriggerBuildCompletions offers the keys of a trigger step's build the build doesn't
+// set yet. Step keys such as agents don't apply there.
+func (cp *CompletionProvider) getTriggerBuildCompletions(posCtx *context.PositionContext) []protocol.CompletionItem {
+	existing := siblingKeys(posCtx)
+
+	items := []protocol.CompletionItem{}
+	for _, key := range slices.Sorted(maps.Keys(triggerBuildKeys)) {
+		if existing[key] {
+			continue
+		}
+		detail, _, _ := strings.Cut(strings.TrimPrefix(triggerBuildKeys[key], "**"+key+"** - "), "\n")
+		item := protocol.CompletionItem{
+			Label:         key,
+			Kind:          protocol.CompletionItemKindProperty,
+			Detail:        detail,
+			Documentation: &protocol.MarkupContent{Kind: protocol.Markdown, Value: triggerBuildKeys[key]},
+			InsertText:    key + ": ",
+		}
+		if key == "env" || key == "meta_data" {
+			item.InsertText = key + ":\n  $0"
+			item.InsertTextFormat = protocol.InsertTextFormatSnippet
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// siblingKeys returns the keys level with the cursor's line, above and below it, in the
+// mapping the cursor is in
+func siblingKeys(posCtx *context.PositionContext) map[string]bool {
+	lines := splitLines(posCtx.FullContent)
+	line := int(posCtx.Position.Line)
+	indent := indentOf(posCtx.CurrentLine)
+
+	existing := make(map[string]bool)
+	for _, step := range []int{-1, 1} {
+		for i := line + step; i >= 0 && i < len(lines); i += step {
+			trimmed := strings.TrimSpace(lines[i])
+			if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+				continue
+			}
+			if indentOf(lines[i]) < indent {
+				break
+			}
+			if indentOf(lines[i]) == indent {
+				existing[yamlKey(lines[i])] = true
+			}
+		}
+	}
+	return existing
+}
+
+// getTriggerBuildHoverContent documents the keys of a trigger step's build, and leaves other
+// keys there undocumented rather than describing them as step keys
+func getTriggerBuildHoverContent(posCtx *context.PositionContext, currentWord string, contextInfo *context.ContextInfo) (string, bool) {
+	if !contextInfo.IsInTriggerBuild() || currentWord == "" || yamlKey(posCtx.CurrentLine) != currentWord {
+		return "", false
+	}
+	return triggerBuildKeys[currentWord], true
+}
+
+// validateTriggerSteps checks every trigger step for keys trigger steps or their build don't
+// take, which the schema rejects without saying which, and for a build.branch that can't be
+// a branch
+func (s *Server) validateTriggerSteps(pipeline *parser.Pipeline) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	root := pipeline.YAMLNode
+	if root == nil || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return diagnostics
+	}
+	root = root.Content[0]
+
+	var walkSteps func(steps *yaml.Node)
+	walkSteps = func(steps *yaml.Node) {
+		if steps == nil || steps.Kind != yaml.SequenceNode {
+			return
+		}
+		for _, step := range steps.Content {
+			if step.Kind != yaml.MappingNode {
+				continue
+			}
+			if mappingKey(step, "trigger") != nil || stringNodeValue(mappingValue(step, "type")) == "trigger" {
+				diagnostics = append(diagnostics, triggerStepDiagnostics(step)...)
+			}
+			walkSteps(mappingValue(step, "steps"))
+		}
+	}
+	walkSteps(mappingValue(root, "steps"))
+
+	return diagnostics
+}
+
+// triggerStepDiagnostics checks a single trigger step's keys, and its build's keys and branch
+func triggerStepDiagnostics(step *yaml.Node) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	for i := 0; i+1 < len(step.Content); i += 2 {
+		key := step.Content[i]
+		if triggerStepKeys[key.Value] {
+			continue
+		}
+		diagnostics = append(diagnostics, nodeDiagnostic(key, protocol.DiagnosticSeverityError, "invalid-trigger-key",
+			fmt.Sprintf("Trigger steps cannot use '%s'. They take: %s", key.Value, strings.Join(triggerStepKeyNames(), ", "))))
+	}
+
+	build := mappingValue(step, "build")
+	if build == nil || build.Kind != yaml.MappingNode {
+		return diagnostics
+	}
+	for i := 0; i+1 < len(build.Content); i += 2 {
+		key := build.Content[i]
+		if _, ok := triggerBuildKeys[key.Value]; ok {
+			continue
+		}
+		diagnostics = append(diagnostics, nodeDiagnostic(key, protocol.DiagnosticSeverityError, "invalid-trigger-build-key",
+			fmt.Sprintf("The build of a trigger step cannot set '%s'. It takes: %s", key.Value, strings.Join(slices.Sorted(maps.Keys(triggerBuildKeys)), ", "))))
+	}
+
+	branch := mappingValue(build, "branch")
+	if branch == nil || branch.Kind != yaml.ScalarNode {
+		return diagnostics
+	}
+	if problem := branchNameProblem(branch.Value); problem != "" {
+		diagnostics = append(diagnostics, nodeDiagnostic(branch, protocol.DiagnosticSeverityWarning, "invalid-trigger-branch",
+			fmt.Sprintf("build.branch %q is not a valid branch name: %s", branch.Value, problem)))
+	}
+
+	return diagnostics
+}
+
+// triggerStepKeyNames lists the keys trigger steps take, in a stable order
+func triggerStepKeyNames() []string {
+	names := make([]string, 0, len(triggerStepKeys))
+	for name := range triggerStepKeys {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// branchNameProblem explains why a name can't be a git branch, following the rules of
+// `git check-ref-format`, or returns "" if it can be. Names built from environment
+// variables are only known at upload, so they pass.
+func branchNameProblem(name string) string {
+	if strings.Contains(name, "$") {
+		return ""
+	}
+
+	switch {
+	case strings.TrimSpace(name) == "":
+		return "it is empty"
+	case name == "@":
+		return "it can't be '@'"
+	case strings.IndexFunc(name, func(r rune) bool { return r <= ' ' || r == 0x7f }) >= 0:
+		return "it can't contain spaces or control characters"
+	case strings.ContainsAny(name, "~^:?*[\\"):
+		return `it can't contain ~ ^ : ? * [ or \`
+	case strings.Contains(name, ".."):
+		return "it can't contain '..'"
+	case strings.Contains(name, "@{"):
+		return "it can't contain '@{'"
+	case strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") || strings.Contains(name, "//"):
+		return "it can't start or end with '/', or contain '//'"
+	case strings.HasSuffix(name, "."):
+		return "it can't end with '.'"
+	case strings.HasPrefix(name, "-"):
+		return "it can't start with '-'"
+	}
+
+	for _, component := range strings.Split(name, "/") {
+		if strings.HasPrefix(component, ".") {
+			return "no part of it can start with '.'"
+		}
+		if strings.HasSuffix(component, ".lock") {
+			return "no part of it can end with '.lock'"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,146 @@
+package lsp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+func TestCompletionProvider_TriggerStepProperties(t *testing.T) {
+	provider := newTestCompletionProvider()
+
+	labels := make(map[string]bool)
+	for _, completion := range provider.GetCompletions(blockStepPositionContext("steps:\n  - trigger: deploy\n    ")) {
+		labels[completion.Label] = true
+	}
+	for _, label := range []string{"branches", "skip", "build", "async", "if", "depends_on", "soft_fail"} {
+		if !labels[label] {
+			t.Errorf("Expected %s to be offered on a trigger step", label)
+		}
+	}
+	for _, label := range []string{"command", "agents", "plugins", "matrix", "blocked_state"} {
+		if labels[label] {
+			t.Errorf("Expected %s not to be offered on a trigger step", label)
+		}
+	}
+}
+
+func TestCompletionProvider_TriggerBuildKeys(t *testing.T) {
+	provider := newTestCompletionProvider()
+
+	var labels []string
+	for _, completion := range provider.GetCompletions(blockStepPositionContext("steps:\n  - trigger: deploy\n    build:\n      message: Deploy\n      ")) {
+		labels = append(labels, completion.Label)
+	}
+	if expected := []string{"branch", "commit", "env", "meta_data"}; strings.Join(labels, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v in a trigger build, got %v", expected, labels)
+	}
+}
+
+func TestServer_TriggerBuildHover(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	server.documentManager.OpenDocument(uri, 1, "steps:\n  - trigger: deploy\n    build:\n      message: Deploy\n      agents:\n        queue: deploy\n")
+
+	hover := func(line uint32) string {
+		result, err := server.Hover(context.Background(), &protocol.HoverParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+				Position:     protocol.Position{Line: line, Character: 8},
+			},
+		})
+		if err != nil {
+			t.Fatalf("Hover failed: %v", err)
+		}
+		if result == nil {
+			return ""
+		}
+		return result.Contents.Value
+	}
+
+	if content := hover(3); !strings.Contains(content, "Message of the triggered build") {
+		t.Errorf("Expected the build's message documented, got %q", content)
+	}
+	if content := hover(4); content != "" {
+		t.Errorf("Expected no step docs for agents in a trigger build, got %q", content)
+	}
+}
+
+func TestServer_ValidateTriggerSteps(t *testing.T) {
+	content := `steps:
+  - trigger: deploy
+    label: Deploy
+    branches: main release/*
+    skip: "Deploys are paused"
+    build:
+      branch: "${BUILDKITE_BRANCH}"
+  - group: Downstream
+    steps:
+      - trigger: docs
+        command: make docs
+        build:
+          branch: feature..docs
+  - trigger: release
+    build:
+      branch: release/v1.2`
+
+	pipeline, err := parser.ParseYAML([]byte(content))
+	if err != nil {
+		t.Fatalf("Failed to parse YAML: %v", err)
+	}
+	server := newTestServer()
+
+	diagnostics := server.validateTriggerSteps(pipeline)
+	if len(diagnostics) != 2 {
+		t.Fatalf("Expected 2 diagnostics, got %+v", diagnostics)
+	}
+
+	if got := diagnostics[0]; got.Code != "invalid-trigger-key" || got.Range.Start.Line != 10 || got.Range.Start.Character != 8 ||
+		!strings.Contains(got.Message, "'command'") || !strings.Contains(got.Message, "branches") {
+		t.Errorf("Expected command flagged on the trigger step, got %+v", got)
+	}
+	if got := diagnostics[1]; got.Code != "invalid-trigger-branch" || got.Severity != protocol.DiagnosticSeverityWarning ||
+		got.Range.Start.Line != 12 || !strings.Contains(got.Message, "'..'") {
+		t.Errorf("Expected the branch flagged, got %+v", got)
+	}
+
+	// Step keys in the build are pointed out too
+	pipeline, err = parser.ParseYAML([]byte("steps:\n  - trigger: deploy\n    build:\n      message: Deploy\n      agents:\n        queue: deploy\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse YAML: %v", err)
+	}
+	diagnostics = server.validateTriggerSteps(pipeline)
+	if len(diagnostics) != 1 || diagnostics[0].Code != "invalid-trigger-build-key" || diagnostics[0].Range.Start.Line != 4 ||
+		!strings.Contains(diagnostics[0].Message, "'agents'") || !strings.Contains(diagnostics[0].Message, "meta_data") {
+		t.Errorf("Expected agents flagged in the build, got %+v", diagnostics)
+	}
+
+	// The schema rejects the key too, without saying which, so the key is still pointed out
+	var found bool
+	for _, diagnostic := range server.Diagnose(content) {
+		found = found || diagnostic.Code == "invalid-trigger-key"
+	}
+	if !found {
+		t.Error("Expected the invalid key to be reported alongside the schema error")
+	}
+}
+
+func TestBranchNameProblem(t *testing.T) {
+	valid := []string{"main", "release/v1.2", "feature/JIRA-123_fix", "${BUILDKITE_BRANCH}", "deps/@types"}
+	for _, name := range valid {
+		if problem := branchNameProblem(name); problem != "" {
+			t.Errorf("branchNameProblem(%q) = %q, expected a valid name", name, problem)
+		}
+	}
+
+	invalid := []string{"", "@", "my branch", "fix:bug", "a..b", "main@{1}", "/main", "main/", "a//b", "main.", "-main", "feature/.hidden", "main.lock", "what?"}
+	for _, name := range invalid {
+		if branchNameProblem(name) == "" {
+			t.Errorf("branchNameProblem(%q) = \"\", expected a problem", name)
+		}
+	}
+}
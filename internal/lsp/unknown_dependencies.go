@@ -0,0 +1,140 @@
+package lsp
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+// validateUnknownDependencies reports depends_on entries naming a key no step defines, which
+// Buildkite only rejects once the build runs. Keys defined by the other pipeline files in
+// the workspace count as defined, as their steps may be uploaded into the same build, and
+// so do interpolated keys. Keys the document has defined since it was opened are left to
+// the dangling-depends-on warning. A key a step's label would give it is only a hint, as go
+// to definition finds that step, but the dependency still fails until the key is added.
+func (s *Server) validateUnknownDependencies(uri protocol.DocumentURI, pipeline *parser.Pipeline) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	root := pipeline.YAMLNode
+	if root == nil || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return diagnostics
+	}
+	steps := dependableSteps(mappingValue(root.Content[0], "steps"))
+
+	keys := make(map[string]bool)
+	labelKeys := make(map[string]bool)
+	for _, step := range steps {
+		if key := stepNodeKey(step); key != "" {
+			keys[key] = true
+		} else if key := stepLabelKey(step); key != "" {
+			labelKeys[key] = true
+		}
+	}
+
+	var unknown []*yaml.Node
+	for _, step := range steps {
+		for _, dependency := range dependencyNodes(step) {
+			if keys[dependency.Value] || strings.Contains(dependency.Value, "$") || s.stepKeys.defined(uri, dependency.Value) {
+				continue
+			}
+			unknown = append(unknown, dependency)
+		}
+	}
+	if len(unknown) == 0 {
+		return diagnostics
+	}
+
+	// The workspace is only read once a dependency isn't met by the document itself
+	workspaceKeys := s.workspaceStepKeys(uri)
+	for _, dependency := range unknown {
+		if workspaceKeys[dependency.Value] {
+			continue
+		}
+		severity := protocol.DiagnosticSeverityError
+		if labelKeys[dependency.Value] {
+			severity = protocol.DiagnosticSeverityHint
+		}
+		diagnostics = append(diagnostics, nodeDiagnostic(dependency, severity, "unknown-dependency",
+			unknownDependencyMessage(dependency.Value, steps)))
+	}
+
+	return diagnostics
+}
+
+// unknownDependencyMessage explains a dependency on a key no step defines, pointing at the
+// step it most likely means: one without a key whose label it names, or the closest key
+func unknownDependencyMessage(key string, steps []*yaml.Node) string {
+	message := fmt.Sprintf("No step has the key '%s', so this dependency can't be met", key)
+
+	var candidates []string
+	for _, step := range steps {
+		if other := stepNodeKey(step); other != "" {
+			candidates = append(candidates, other)
+			continue
+		}
+		for _, field := range stepLabelFields {
+			label := mappingValue(step, field)
+			if label == nil || label.Kind != yaml.ScalarNode {
+				continue
+			}
+			if label.Value == key || stepLabelKey(step) == key {
+				return fmt.Sprintf("%s. The step '%s' has no key: add `key: %s` to it", message, label.Value, stepLabelKey(step))
+			}
+			break
+		}
+	}
+
+	slices.SortStableFunc(candidates, func(a, b string) int {
+		return parser.EditDistance(key, a) - parser.EditDistance(key, b)
+	})
+	if len(candidates) > 0 && parser.EditDistance(key, candidates[0]) <= max(2, len(key)/3) {
+		return fmt.Sprintf("%s. Did you mean '%s'?", message, candidates[0])
+	}
+	return message
+}
+
+// workspaceStepKeys returns the step keys defined by the workspace's pipeline files other
+// than the document. The keys of files on disk are kept in the workspace index, so only the
+// open documents are parsed.
+func (s *Server) workspaceStepKeys(uri protocol.DocumentURI) map[string]bool {
+	open := s.openPipelines()
+
+	keys := make(map[string]bool)
+	for fileURI, file := range s.workspaceFiles() {
+		if _, isOpen := open[fileURI]; isOpen || fileURI == uri {
+			continue
+		}
+		for _, key := range file.keys {
+			keys[key] = true
+		}
+	}
+	for documentURI, lines := range open {
+		if documentURI == uri {
+			continue
+		}
+		for _, key := range pipelineStepKeys(lines) {
+			keys[key] = true
+		}
+	}
+	return keys
+}
+
+// pipelineStepKeys returns the keys of a pipeline's steps, including those inside groups
+func pipelineStepKeys(lines []string) []string {
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte(strings.Join(lines, "\n")), &root); err != nil || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+	var keys []string
+	for _, step := range dependableSteps(mappingValue(root.Content[0], "steps")) {
+		if key := stepNodeKey(step); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,151 @@
+package lsp
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+
+	bkcontext "github.com/mcncl/buildkite-ls/internal/context"
+)
+
+// unknownDependencies returns the unknown-dependency diagnostics raised for a document
+func unknownDependencies(server *Server, uri protocol.DocumentURI, content string) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+	for _, diagnostic := range server.diagnose(uri, content) {
+		if diagnostic.Code == "unknown-dependency" {
+			diagnostics = append(diagnostics, diagnostic)
+		}
+	}
+	return diagnostics
+}
+
+func TestServer_ValidateUnknownDependencies(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+
+	content := `steps:
+  - label: Build
+    command: make
+  - label: Lint
+    key: lint
+    command: make lint
+  - label: Test
+    key: test
+    command: make test
+    depends_on:
+      - build
+      - step: lnit
+        allow_failure: true
+      - lint
+      - ${UPSTREAM_KEY}
+  - label: Deploy
+    command: make deploy
+    depends_on: release
+`
+	diagnostics := unknownDependencies(server, uri, content)
+	if len(diagnostics) != 3 {
+		t.Fatalf("Expected 3 unknown dependencies, got %d: %+v", len(diagnostics), diagnostics)
+	}
+
+	for i, expected := range []struct {
+		line     uint32
+		severity protocol.DiagnosticSeverity
+		message  string
+	}{
+		// Go to definition finds the step by the key its label would give it
+		{10, protocol.DiagnosticSeverityHint, "The step 'Build' has no key: add `key: build` to it"},
+		{11, protocol.DiagnosticSeverityError, "Did you mean 'lint'?"},
+		{17, protocol.DiagnosticSeverityError, "No step has the key 'release', so this dependency can't be met"},
+	} {
+		got := diagnostics[i]
+		if got.Severity != expected.severity || got.Range.Start.Line != expected.line {
+			t.Errorf("Expected severity %v on line %d, got %+v", expected.severity, expected.line, got)
+		}
+		if !strings.Contains(got.Message, expected.message) {
+			t.Errorf("Expected message containing %q, got %q", expected.message, got.Message)
+		}
+	}
+	if strings.Contains(diagnostics[2].Message, "Did you mean") {
+		t.Errorf("Expected no suggestion for a key unlike any other, got %q", diagnostics[2].Message)
+	}
+
+	ctx := &bkcontext.PositionContext{URI: uri, FullContent: content}
+	if location := server.findStepDefinition(ctx, "build"); location == nil || location.Range.Start.Line != 1 {
+		t.Errorf("Expected the hinted dependency to resolve to the Build step, got %+v", location)
+	}
+	if location := server.findStepDefinition(ctx, "release"); location != nil {
+		t.Errorf("Expected the unknown dependency not to resolve, got %+v", location)
+	}
+}
+
+func TestServer_ValidateUnknownDependencies_Workspace(t *testing.T) {
+	server := newTestServer()
+	root := t.TempDir()
+	writeWorkspacePipeline(t, root, filepath.Join(".buildkite", "release.yml"), "steps:\n  - label: Release\n    key: release\n    command: make release\n")
+	server.SetWorkspaceRoots([]string{root})
+	uri := protocol.DocumentURI("file://" + filepath.Join(root, ".buildkite", "pipeline.yml"))
+
+	content := "steps:\n  - label: Deploy\n    command: make deploy\n    depends_on: release\n"
+	if diagnostics := unknownDependencies(server, uri, content); len(diagnostics) != 0 {
+		t.Errorf("Expected a key uploaded by another workspace pipeline to count, got %+v", diagnostics)
+	}
+}
+
+func TestServer_ValidateUnknownDependencies_WorkspaceIndex(t *testing.T) {
+	server := newTestServer()
+	// The space is escaped in the pipeline URIs
+	root := filepath.Join(t.TempDir(), "my repo")
+	releaseURI := writeWorkspacePipeline(t, root, "pipeline.release.yml", "steps:\n  - label: Release\n    key: release\n    command: make release\n")
+	server.SetWorkspaceRoots([]string{root})
+	documentURI := uri.File(filepath.Join(root, ".buildkite", "pipeline.yml"))
+	content := "steps:\n  - label: Deploy\n    command: make deploy\n    depends_on: release\n"
+
+	if diagnostics := unknownDependencies(server, documentURI, content); len(diagnostics) != 0 {
+		t.Fatalf("Expected the key from the workspace index, got %+v", diagnostics)
+	}
+
+	// The keys are read with the file, so a change on disk is seen once it's reported
+	writeWorkspacePipeline(t, root, "pipeline.release.yml", "steps:\n  - label: Release\n    key: publish\n    command: make release\n")
+	if diagnostics := unknownDependencies(server, documentURI, content); len(diagnostics) != 0 {
+		t.Fatalf("Expected the indexed keys to be reused, got %+v", diagnostics)
+	}
+	err := server.DidChangeWatchedFiles(context.Background(), &protocol.DidChangeWatchedFilesParams{
+		Changes: []*protocol.FileEvent{{Type: protocol.FileChangeTypeChanged, URI: releaseURI}},
+	})
+	if err != nil {
+		t.Fatalf("DidChangeWatchedFiles failed: %v", err)
+	}
+	if diagnostics := unknownDependencies(server, documentURI, content); len(diagnostics) != 1 {
+		t.Fatalf("Expected the renamed key to be unknown, got %+v", diagnostics)
+	}
+
+	// Open documents are read from the editor instead
+	if err := server.DidOpen(context.Background(), &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: releaseURI, LanguageID: "yaml", Version: 1, Text: "steps:\n  - label: Release\n    key: release\n    command: make release\n"},
+	}); err != nil {
+		t.Fatalf("DidOpen failed: %v", err)
+	}
+	if diagnostics := unknownDependencies(server, documentURI, content); len(diagnostics) != 0 {
+		t.Errorf("Expected the key from the open document, got %+v", diagnostics)
+	}
+}
+
+func TestServer_ValidateUnknownDependencies_Removed(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+
+	original := "steps:\n  - label: Build\n    key: build\n    command: make\n  - label: Test\n    command: make test\n    depends_on: build\n"
+	if diagnostics := unknownDependencies(server, uri, original); len(diagnostics) != 0 {
+		t.Fatalf("Expected no unknown dependencies, got %+v", diagnostics)
+	}
+
+	// A key removed since the document was opened is a dangling dependency instead
+	rekeyed := strings.Replace(original, "key: build", "key: compile", 1)
+	if diagnostics := unknownDependencies(server, uri, rekeyed); len(diagnostics) != 0 {
+		t.Errorf("Expected the removed key left to dangling-depends-on, got %+v", diagnostics)
+	}
+}
@@ -0,0 +1,134 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.lsp.dev/protocol"
+)
+
+// UsageEvent is sent as a telemetry/event payload summarising feature usage since the last one.
+// It only carries counts keyed by LSP method and diagnostic code, never document content or URIs.
+type UsageEvent struct {
+	Event         string         `json:"event"`
+	PeriodSeconds int64          `json:"periodSeconds"`
+	Features      map[string]int `json:"features,omitempty"`
+	Diagnostics   map[string]int `json:"diagnostics,omitempty"`
+}
+
+// untrackedMethods are lifecycle and document sync messages rather than features users invoke
+var untrackedMethods = map[string]bool{
+	"initialize":                       true,
+	"initialized":                      true,
+	"shutdown":                         true,
+	"exit":                             true,
+	"$/cancelRequest":                  true,
+	"textDocument/didOpen":             true,
+	"textDocument/didChange":           true,
+	"textDocument/didClose":            true,
+	"workspace/didChangeConfiguration": true,
+	"workspace/didChangeWatchedFiles":  true,
+}
+
+// usageRecorder batches usage counts so they're reported in one event per interval
+// rather than a notification per request
+type usageRecorder struct {
+	mu          sync.Mutex
+	since       time.Time
+	features    map[string]int
+	diagnostics map[string]int
+}
+
+func newUsageRecorder() *usageRecorder {
+	return &usageRecorder{
+		since:       time.Now(),
+		features:    make(map[string]int),
+		diagnostics: make(map[string]int),
+	}
+}
+
+func (r *usageRecorder) recordFeature(method string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.features[method]++
+}
+
+func (r *usageRecorder) recordDiagnostics(diagnostics []protocol.Diagnostic) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Code == nil {
+			continue
+		}
+		r.diagnostics[fmt.Sprint(diagnostic.Code)]++
+	}
+}
+
+// due reports whether the current batch has been collecting for at least the interval
+func (r *usageRecorder) due(now time.Time, interval time.Duration) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return now.Sub(r.since) >= interval
+}
+
+// take returns the current batch and starts a new one, or nil if nothing was recorded
+func (r *usageRecorder) take(now time.Time) *UsageEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	event := &UsageEvent{
+		Event:         "usage",
+		PeriodSeconds: int64(now.Sub(r.since).Seconds()),
+		Features:      r.features,
+		Diagnostics:   r.diagnostics,
+	}
+
+	r.since = now
+	r.features = make(map[string]int)
+	r.diagnostics = make(map[string]int)
+
+	if len(event.Features) == 0 && len(event.Diagnostics) == 0 {
+		return nil
+	}
+	return event
+}
+
+// recordFeatureUsage counts a request towards the usage telemetry, if the user opted in
+func (s *Server) recordFeatureUsage(ctx context.Context, method string) {
+	if !s.Settings().UsageTelemetry || untrackedMethods[method] {
+		return
+	}
+	s.usage.recordFeature(method)
+	s.flushUsage(ctx, false)
+}
+
+// recordDiagnosticUsage counts the codes of a document's diagnostics towards the usage
+// telemetry, if the user opted in
+func (s *Server) recordDiagnosticUsage(ctx context.Context, diagnostics []protocol.Diagnostic) {
+	if !s.Settings().UsageTelemetry {
+		return
+	}
+	s.usage.recordDiagnostics(diagnostics)
+	s.flushUsage(ctx, false)
+}
+
+// flushUsage sends the batched usage counts once the reporting interval has passed,
+// or straight away when forced
+func (s *Server) flushUsage(ctx context.Context, force bool) {
+	settings := s.Settings()
+	now := time.Now()
+	if !force && !s.usage.due(now, settings.UsageTelemetryInterval()) {
+		return
+	}
+
+	event := s.usage.take(now)
+	if event == nil || !settings.UsageTelemetry || s.conn == nil {
+		return
+	}
+
+	if err := s.conn.Notify(ctx, "telemetry/event", event); err != nil {
+		s.logger.Printf("Failed to send usage telemetry: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"go.lsp.dev/jsonrpc2"
+	"go.lsp.dev/protocol"
+)
+
+func TestServer_UsageTelemetryIsOptIn(t *testing.T) {
+	server := newTestServer()
+	ctx := context.Background()
+
+	server.recordFeatureUsage(ctx, "textDocument/hover")
+	server.recordDiagnosticUsage(ctx, []protocol.Diagnostic{{Code: "missing-label"}})
+
+	if event := server.usage.take(time.Now()); event != nil {
+		t.Errorf("Expected nothing recorded without opting in, got %+v", event)
+	}
+}
+
+func TestServer_UsageTelemetryBatches(t *testing.T) {
+	server := newTestServer()
+	ctx := context.Background()
+
+	settings := DefaultSettings()
+	settings.UsageTelemetry = true
+	server.applySettings(settings)
+
+	server.recordFeatureUsage(ctx, "textDocument/hover")
+	server.recordFeatureUsage(ctx, "textDocument/hover")
+	server.recordFeatureUsage(ctx, "textDocument/completion")
+	server.recordFeatureUsage(ctx, "textDocument/didChange")
+	server.recordDiagnosticUsage(ctx, []protocol.Diagnostic{
+		{Code: "missing-label"},
+		{Code: "missing-label"},
+		{Code: "unknown-team"},
+		{Message: "no code"},
+	})
+
+	event := server.usage.take(time.Now())
+	if event == nil {
+		t.Fatal("Expected a batch of usage counts")
+	}
+
+	expectedFeatures := map[string]int{"textDocument/hover": 2, "textDocument/completion": 1}
+	if len(event.Features) != len(expectedFeatures) {
+		t.Errorf("Expected features %v, got %v", expectedFeatures, event.Features)
+	}
+	for method, count := range expectedFeatures {
+		if event.Features[method] != count {
+			t.Errorf("Expected %s counted %d times, got %d", method, count, event.Features[method])
+		}
+	}
+
+	if event.Diagnostics["missing-label"] != 2 || event.Diagnostics["unknown-team"] != 1 || len(event.Diagnostics) != 2 {
+		t.Errorf("Unexpected diagnostic counts %v", event.Diagnostics)
+	}
+
+	if next := server.usage.take(time.Now()); next != nil {
+		t.Errorf("Expected taking the batch to reset it, got %+v", next)
+	}
+}
+
+func TestServer_FlushUsageSendsTelemetryEvent(t *testing.T) {
+	server := newTestServer()
+	ctx := context.Background()
+
+	settings := DefaultSettings()
+	settings.UsageTelemetry = true
+	server.applySettings(settings)
+
+	serverSide, clientSide := net.Pipe()
+	defer serverSide.Close()
+	defer clientSide.Close()
+
+	events := make(chan UsageEvent, 1)
+	client := jsonrpc2.NewConn(jsonrpc2.NewStream(clientSide))
+	client.Go(ctx, func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		if req.Method() == "telemetry/event" {
+			var event UsageEvent
+			if err := json.Unmarshal(req.Params(), &event); err == nil {
+				events <- event
+			}
+		}
+		return reply(ctx, nil, nil)
+	})
+	conn := jsonrpc2.NewConn(jsonrpc2.NewStream(serverSide))
+	conn.Go(ctx, jsonrpc2.MethodNotFoundHandler)
+	server.SetConnection(conn)
+
+	// Within the interval the counts are only batched
+	server.recordFeatureUsage(ctx, "textDocument/definition")
+	select {
+	case event := <-events:
+		t.Fatalf("Expected no event before the interval passed, got %+v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	select {
+	case event := <-events:
+		if event.Event != "usage" || event.Features["textDocument/definition"] != 1 {
+			t.Errorf("Unexpected usage event %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected shutdown to flush the usage batch")
+	}
+}
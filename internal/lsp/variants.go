@@ -0,0 +1,166 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+)
+
+// variantFilePattern matches pipeline variant files such as pipeline.deploy.yml, capturing the variant
+var variantFilePattern = regexp.MustCompile(`^pipeline\.([\w-]+)\.ya?ml$`)
+
+// pipelineUploadPattern matches the file uploaded by a `buildkite-agent pipeline upload` command,
+// skipping any flags before it
+var pipelineUploadPattern = regexp.MustCompile(`buildkite-agent\s+pipeline\s+upload\s+(?:--?[\w-]+(?:=\S+)?\s+)*["']?([^\s"';&|]+\.ya?ml)`)
+
+// pipelineUpload is a pipeline file referenced by an upload command in a pipeline
+type pipelineUpload struct {
+	Path  string
+	Range protocol.Range
+}
+
+// pipelineVariant returns the variant named by a pipeline file, e.g. "deploy" for
+// .buildkite/pipeline.deploy.yml, or "" for any other file
+func pipelineVariant(uri string) string {
+	if match := variantFilePattern.FindStringSubmatch(filepath.Base(uri)); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// findPipelineUploads returns the pipeline files uploaded by commands in the document
+func findPipelineUploads(lines []string) []pipelineUpload {
+	var uploads []pipelineUpload
+	for i, line := range lines {
+		for _, match := range pipelineUploadPattern.FindAllStringSubmatchIndex(line, -1) {
+			uploads = append(uploads, pipelineUpload{
+				Path: line[match[2]:match[3]],
+				Range: protocol.Range{
+					Start: protocol.Position{Line: uint32(i), Character: uint32(match[2])},
+					End:   protocol.Position{Line: uint32(i), Character: uint32(match[3])},
+				},
+			})
+		}
+	}
+	return uploads
+}
+
+// pipelineUploadAt returns the upload reference under the position, if any
+func pipelineUploadAt(lines []string, position protocol.Position) *pipelineUpload {
+	for _, upload := range findPipelineUploads(lines) {
+		if upload.Range.Start.Line == position.Line &&
+			position.Character >= upload.Range.Start.Character && position.Character <= upload.Range.End.Character {
+			return &upload
+		}
+	}
+	return nil
+}
+
+// resolvePipelineUpload finds the file an upload command in the document refers to. Agents run
+// uploads from the checkout root, which is the directory holding the document's .buildkite
+// directory, or else the workspace folder containing it. Files that don't exist aren't resolved.
+func (s *Server) resolvePipelineUpload(documentURI protocol.DocumentURI, path string) (protocol.DocumentURI, bool) {
+	docPath, ok := uriPath(documentURI)
+	if !ok {
+		return "", false
+	}
+
+	target := path
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(s.checkoutRoot(docPath), path)
+	}
+	target = filepath.Clean(target)
+
+	targetURI := uri.File(target)
+	if _, open := s.documentManager.GetDocument(targetURI); open {
+		return targetURI, true
+	}
+	if info, err := os.Stat(target); err != nil || info.IsDir() {
+		return "", false
+	}
+	return targetURI, true
+}
+
+// checkoutRoot guesses the directory pipeline uploads in the document are run from
+func (s *Server) checkoutRoot(docPath string) string {
+	if index := strings.LastIndex(docPath, "/.buildkite/"); index >= 0 {
+		return docPath[:index]
+	}
+
+	s.settingsMu.RLock()
+	defer s.settingsMu.RUnlock()
+	for _, root := range s.workspaceRoots {
+		if strings.HasPrefix(docPath, strings.TrimSuffix(root, "/")+"/") {
+			return root
+		}
+	}
+
+	return filepath.Dir(docPath)
+}
+
+// DocumentLink links the files uploaded by `buildkite-agent pipeline upload` commands
+func (s *Server) DocumentLink(ctx context.Context, params *protocol.DocumentLinkParams) ([]protocol.DocumentLink, error) {
+	if !s.isBuildkiteFile(string(params.TextDocument.URI)) {
+		return nil, nil
+	}
+
+	doc, exists := s.documentManager.GetDocument(params.TextDocument.URI)
+	if !exists {
+		return nil, nil
+	}
+
+	var links []protocol.DocumentLink
+	for _, upload := range findPipelineUploads(doc.Lines) {
+		target, ok := s.resolvePipelineUpload(params.TextDocument.URI, upload.Path)
+		if !ok {
+			continue
+		}
+
+		tooltip := "Open uploaded pipeline"
+		if variant := pipelineVariant(upload.Path); variant != "" {
+			tooltip = fmt.Sprintf("Open %s pipeline variant", variant)
+		}
+
+		links = append(links, protocol.DocumentLink{
+			Range:   upload.Range,
+			Target:  target,
+			Tooltip: tooltip,
+		})
+	}
+
+	return links, nil
+}
+
+// findUploadDefinition returns the start of the pipeline file uploaded at the position
+func (s *Server) findUploadDefinition(uri protocol.DocumentURI, lines []string, position protocol.Position) *protocol.Location {
+	upload := pipelineUploadAt(lines, position)
+	if upload == nil {
+		return nil
+	}
+
+	target, ok := s.resolvePipelineUpload(uri, upload.Path)
+	if !ok {
+		return nil
+	}
+	return &protocol.Location{URI: target}
+}
+
+// getUploadHoverContent describes the pipeline file uploaded at the position
+func getUploadHoverContent(lines []string, position protocol.Position) string {
+	upload := pipelineUploadAt(lines, position)
+	if upload == nil {
+		return ""
+	}
+
+	content := fmt.Sprintf("**Uploads pipeline** `%s`", upload.Path)
+	if variant := pipelineVariant(upload.Path); variant != "" {
+		content += fmt.Sprintf("\n\nVariant: **%s**", variant)
+	}
+	return content + "\n\nSteps in the file are added to the build after this step."
+}
@@ -0,0 +1,128 @@
+package lsp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+)
+
+func TestPipelineVariant(t *testing.T) {
+	tests := map[string]string{
+		"file:///repo/.buildkite/pipeline.deploy.yml":   "deploy",
+		"file:///repo/.buildkite/pipeline.nightly.yaml": "nightly",
+		"file:///repo/.buildkite/pipeline.yml":          "",
+		"file:///repo/.buildkite/release.yml":           "",
+		".buildkite/pipeline.pre-merge.yml":             "pre-merge",
+	}
+
+	for uri, expected := range tests {
+		if variant := pipelineVariant(uri); variant != expected {
+			t.Errorf("pipelineVariant(%q) = %q, expected %q", uri, variant, expected)
+		}
+	}
+}
+
+func TestFindPipelineUploads(t *testing.T) {
+	lines := splitLines(`steps:
+  - command: buildkite-agent pipeline upload .buildkite/pipeline.deploy.yml
+  - command: "buildkite-agent pipeline upload --replace .buildkite/pipeline.nightly.yaml"
+  - command: |
+      buildkite-agent pipeline upload
+      ./generate.sh | buildkite-agent pipeline upload`)
+
+	uploads := findPipelineUploads(lines)
+	if len(uploads) != 2 {
+		t.Fatalf("Expected 2 uploads, got %+v", uploads)
+	}
+
+	if uploads[0].Path != ".buildkite/pipeline.deploy.yml" || uploads[0].Range.Start.Line != 1 ||
+		lines[1][uploads[0].Range.Start.Character:uploads[0].Range.End.Character] != uploads[0].Path {
+		t.Errorf("Unexpected first upload: %+v", uploads[0])
+	}
+	if uploads[1].Path != ".buildkite/pipeline.nightly.yaml" || uploads[1].Range.Start.Line != 2 {
+		t.Errorf("Unexpected second upload: %+v", uploads[1])
+	}
+}
+
+func TestServer_PipelineUploadNavigation(t *testing.T) {
+	// The space is escaped in the pipelines' URIs
+	root := filepath.Join(t.TempDir(), "my repo")
+	if err := os.MkdirAll(filepath.Join(root, ".buildkite"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	deployPath := filepath.Join(root, ".buildkite", "pipeline.deploy.yml")
+	if err := os.WriteFile(deployPath, []byte("steps:\n  - command: deploy\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	deployURI := uri.File(deployPath)
+
+	server := newTestServer()
+	uri := uri.File(filepath.Join(root, ".buildkite", "pipeline.yml"))
+	server.documentManager.OpenDocument(uri, 1, `steps:
+  - command: buildkite-agent pipeline upload .buildkite/pipeline.deploy.yml
+  - command: buildkite-agent pipeline upload .buildkite/pipeline.missing.yml`)
+
+	links, err := server.DocumentLink(context.Background(), &protocol.DocumentLinkParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+	})
+	if err != nil {
+		t.Fatalf("DocumentLink failed: %v", err)
+	}
+	if len(links) != 1 {
+		t.Fatalf("Expected a link to the existing file only, got %+v", links)
+	}
+	if links[0].Target != deployURI || !strings.Contains(links[0].Tooltip, "deploy") {
+		t.Errorf("Unexpected link: %+v", links[0])
+	}
+
+	locations, err := server.Definition(context.Background(), &protocol.DefinitionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 1, Character: 55},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Definition failed: %v", err)
+	}
+	if len(locations) != 1 || locations[0].URI != deployURI {
+		t.Errorf("Expected definition in %s, got %+v", deployPath, locations)
+	}
+
+	hover, err := server.Hover(context.Background(), &protocol.HoverParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 1, Character: 55},
+		},
+	})
+	if err != nil || hover == nil {
+		t.Fatalf("Expected hover content, got %v (%v)", hover, err)
+	}
+	if !strings.Contains(hover.Contents.Value, "Variant: **deploy**") {
+		t.Errorf("Expected the upload's variant in hover, got %q", hover.Contents.Value)
+	}
+}
+
+func TestServer_VariantHover(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///repo/.buildkite/pipeline.nightly.yml")
+	server.documentManager.OpenDocument(uri, 1, "steps:\n  - command: make\n")
+
+	hover, err := server.Hover(context.Background(), &protocol.HoverParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 0, Character: 2},
+		},
+	})
+	if err != nil || hover == nil {
+		t.Fatalf("Expected hover content, got %v (%v)", hover, err)
+	}
+	if !strings.Contains(hover.Contents.Value, "Pipeline variant: **nightly**") {
+		t.Errorf("Expected the variant in hover, got %q", hover.Contents.Value)
+	}
+}
@@ -0,0 +1,239 @@
+package lsp
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"gopkg.in/yaml.v3"
+
+	bkcontext "github.com/mcncl/buildkite-ls/internal/context"
+	"github.com/mcncl/buildkite-ls/internal/expression"
+	"github.com/mcncl/buildkite-ls/internal/parser"
+)
+
+var (
+	// approvalLabelPattern matches wait labels that read as asking someone to approve
+	approvalLabelPattern = regexp.MustCompile(`(?i)\?\s*$|\b(approve|approval|confirm|proceed|unblock|sign[- ]?off)\b`)
+	// waitKeyPattern matches the `wait` key of a map-form wait step
+	waitKeyPattern = regexp.MustCompile(`^(\s*(?:-\s+)?)(wait)(\s*:)`)
+)
+
+// isWaitStepNode reports whether a step mapping is a wait step
+func isWaitStepNode(step *yaml.Node) bool {
+	if mappingKey(step, "wait") != nil || mappingKey(step, "waiter") != nil {
+		return true
+	}
+	stepType := stringNodeValue(mappingValue(step, "type"))
+	return stepType == "wait" || stepType == "waiter"
+}
+
+// validateWaitSteps checks continue_on_failure and if on wait steps, and points out wait
+// labels that read as though the wait asks for approval
+func (s *Server) validateWaitSteps(pipeline *parser.Pipeline, lines []string) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+
+	root := pipeline.YAMLNode
+	if root == nil || len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return diagnostics
+	}
+
+	var walkSteps func(steps *yaml.Node)
+	walkSteps = func(steps *yaml.Node) {
+		if steps == nil || steps.Kind != yaml.SequenceNode {
+			return
+		}
+		for _, step := range steps.Content {
+			if step.Kind != yaml.MappingNode {
+				continue
+			}
+			diagnostics = append(diagnostics, waitStepDiagnostics(step, lines)...)
+			walkSteps(mappingValue(step, "steps"))
+		}
+	}
+	walkSteps(mappingValue(root.Content[0], "steps"))
+
+	return diagnostics
+}
+
+// waitStepDiagnostics checks a single step
+func waitStepDiagnostics(step *yaml.Node, lines []string) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+	isWait := isWaitStepNode(step)
+
+	if entry := mappingKey(step, "continue_on_failure"); entry != nil {
+		switch {
+		case !isWait:
+			diagnostics = append(diagnostics, nodeDiagnostic(entry.key, protocol.DiagnosticSeverityError, "continue-on-failure-not-wait",
+				"continue_on_failure only applies to wait steps. To keep going when this step fails, use soft_fail on it, "+
+					"or allow_failure in the depends_on of the steps after it"))
+		case entry.value.Tag != "!!bool":
+			diagnostics = append(diagnostics, nodeDiagnostic(entry.value, protocol.DiagnosticSeverityError, "invalid-continue-on-failure",
+				"continue_on_failure must be true or false"))
+		}
+	}
+
+	if !isWait {
+		return diagnostics
+	}
+
+	if condition := mappingValue(step, "if"); condition != nil && condition.Kind == yaml.ScalarNode {
+		if _, err := expression.Parse(condition.Value); err != nil {
+			diagnostics = append(diagnostics, protocol.Diagnostic{
+				Range:    conditionErrorRange(condition, err, lines),
+				Severity: protocol.DiagnosticSeverityError,
+				Message:  fmt.Sprintf("Invalid wait step condition: %v", err),
+				Source:   "buildkite-ls",
+				Code:     "invalid-wait-condition",
+			})
+		}
+	}
+
+	if label := mappingValue(step, "wait"); label != nil && label.Tag == "!!str" && approvalLabelPattern.MatchString(label.Value) {
+		diagnostics = append(diagnostics, nodeDiagnostic(label, protocol.DiagnosticSeverityInformation, "wait-label-looks-like-block",
+			fmt.Sprintf("The wait step's label %q reads like a request for approval, but wait steps don't pause for anyone: "+
+				"the build continues as soon as the steps before it pass. Use a block step to wait for someone to unblock it", label.Value)))
+	}
+
+	return diagnostics
+}
+
+// createWaitToBlockAction turns a labeled wait step into a block step with the same label,
+// dropping continue_on_failure, which block steps don't take
+func (s *Server) createWaitToBlockAction(uri protocol.DocumentURI, lines []string, diagnostic protocol.Diagnostic) *protocol.CodeAction {
+	edit, step := stepEditOf(lines, int(diagnostic.Range.Start.Line))
+	if edit == nil {
+		return nil
+	}
+	wait := mappingKey(step, "wait")
+	if wait == nil {
+		return nil
+	}
+
+	edit.renameKey(wait, "block")
+	if entry := mappingKey(step, "continue_on_failure"); entry != nil {
+		edit.deleteEntry(step, entry)
+	}
+
+	return &protocol.CodeAction{
+		Title:       "Convert to a block step",
+		Kind:        protocol.QuickFix,
+		Diagnostics: []protocol.Diagnostic{diagnostic},
+		IsPreferred: true,
+		Edit: &protocol.WorkspaceEdit{
+			Changes: map[protocol.DocumentURI][]protocol.TextEdit{uri: edit.textEdits()},
+		},
+	}
+}
+
+// waitFormDescription explains the form of the wait step on the line
+func waitFormDescription(line string) string {
+	trimmed := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "-"))
+	if strings.Trim(trimmed, `"'`) == "wait" {
+		return "`- wait` is the shortest form of a wait step. Use the map form, `- wait: ~`, to add `continue_on_failure`, `if`, `depends_on` or a `key`."
+	}
+
+	_, value, _ := strings.Cut(trimmed, ":")
+	value = strings.TrimSpace(value)
+	if index := strings.Index(value, " #"); index >= 0 {
+		value = strings.TrimSpace(value[:index])
+	}
+	switch value {
+	case "", "~", "null", "Null", "NULL":
+		return "`wait: ~` is the same wait as `- wait`, in map form so it can take `continue_on_failure`, `if`, `depends_on` or a `key`."
+	}
+	return fmt.Sprintf("`wait: %s` labels the wait in the build's job list. It doesn't pause for anyone: "+
+		"the build continues as soon as the steps before it pass. To wait for someone's approval, use a `block` step.", value)
+}
+
+// enclosingStepIsWait reports whether the line belongs to a map-form wait step
+func (s *Server) enclosingStepIsWait(lines []string, line int) bool {
+	return enclosingStepType(lines, line) == "wait"
+}
+
+// stepTypeKeys maps the keys that give a step its type to that type
+var stepTypeKeys = map[string]string{
+	"command":  "command",
+	"commands": "command",
+	"wait":     "wait",
+	"waiter":   "wait",
+	"block":    "block",
+	"input":    "input",
+	"trigger":  "trigger",
+	"group":    "group",
+}
+
+// enclosingStepType returns the type of the step the line belongs to, from its type key or
+// `type:`, or "" when the step doesn't have one yet
+func enclosingStepType(lines []string, line int) string {
+	if line >= len(lines) {
+		return ""
+	}
+
+	// The line's end is where its text is typed, so a blank line belongs to the step it's
+	// indented into
+	if path, ok := nodePathAt(strings.Join(lines, "\n"), protocol.Position{Line: uint32(line), Character: uint32(len(lines[line]))}); ok {
+		if step := pathStep(path); step != nil {
+			return stepNodeType(step)
+		}
+		return ""
+	}
+
+	// The step starts at the closest "- " item above that is indented less than the line
+	indent := indentOf(lines[line])
+	start := -1
+	for i := line; i >= 0; i-- {
+		trimmed := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(trimmed, "- ") && (i == line || indentOf(lines[i]) < indent) {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return ""
+	}
+
+	propertyIndent := indentOf(lines[start]) + 2
+	for i := start; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if i > start && (indentOf(lines[i]) < propertyIndent || (indentOf(lines[i]) == propertyIndent-2 && strings.HasPrefix(trimmed, "- "))) {
+			break
+		}
+		if i > start && indentOf(lines[i]) != propertyIndent {
+			continue
+		}
+		key := yamlKey(lines[i])
+		if key == "type" {
+			_, value, _ := strings.Cut(lines[i], ":")
+			key = strings.Trim(strings.TrimSpace(value), `"'`)
+		}
+		if stepType, ok := stepTypeKeys[key]; ok {
+			return stepType
+		}
+	}
+	return ""
+}
+
+// getContinueOnFailureHoverContent explains continue_on_failure, warning when it's on a step
+// that isn't a wait
+func (s *Server) getContinueOnFailureHoverContent(posCtx *bkcontext.PositionContext) string {
+	var content strings.Builder
+	content.WriteString("**continue_on_failure** - Run the steps after this wait even when steps before it failed\n\n")
+	content.WriteString("By default a wait step stops the build at the first failure. With `continue_on_failure: true` ")
+	content.WriteString("the steps after it run once the steps before have finished, passed or not, which suits cleanup ")
+	content.WriteString("and reporting steps. The build still fails.\n\nExample:\n```yaml\n- wait: ~\n  continue_on_failure: true\n```")
+
+	lines := splitLines(posCtx.FullContent)
+	if !s.enclosingStepIsWait(lines, int(posCtx.Position.Line)) {
+		content.WriteString("\n\n⚠️ This step isn't a wait step, so `continue_on_failure` has no effect here. ")
+		content.WriteString("Use `soft_fail` to let this step fail without failing the build, or `allow_failure` in the `depends_on` of the steps after it.")
+	}
+	return content.String()
+}
+
+// waitConditionNote explains what skipping a wait step does to the steps around it
+const waitConditionNote = "**On a wait step**, a false condition skips the wait, so the steps after it no longer wait for the steps before it and can run alongside them."
@@ -0,0 +1,250 @@
+package lsp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+)
+
+// waitStepDiagnosticsFor returns the diagnostics raised for wait step options
+func waitStepDiagnosticsFor(server *Server, content string) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+	for _, diagnostic := range server.Diagnose(content) {
+		switch diagnostic.Code {
+		case "continue-on-failure-not-wait", "invalid-continue-on-failure", "invalid-wait-condition", "wait-label-looks-like-block":
+			diagnostics = append(diagnostics, diagnostic)
+		}
+	}
+	return diagnostics
+}
+
+func TestServer_ValidateWaitSteps(t *testing.T) {
+	server := newTestServer()
+
+	tests := []struct {
+		name     string
+		content  string
+		code     string
+		line     uint32
+		char     uint32
+		severity protocol.DiagnosticSeverity
+		message  string
+	}{
+		{
+			name:    "continue_on_failure on a command step",
+			content: "steps:\n  - command: make\n    continue_on_failure: true\n",
+			code:    "continue-on-failure-not-wait",
+			line:    2, char: 4,
+			severity: protocol.DiagnosticSeverityError,
+			message:  "use soft_fail on it",
+		},
+		{
+			name:    "continue_on_failure that isn't a bool",
+			content: "steps:\n  - command: make\n  - wait: ~\n    continue_on_failure: \"yes\"\n",
+			code:    "invalid-continue-on-failure",
+			line:    3, char: 25,
+			severity: protocol.DiagnosticSeverityError,
+			message:  "must be true or false",
+		},
+		{
+			name:     "condition that doesn't parse",
+			content:  "steps:\n  - command: make\n  - wait: ~\n    if: build.branch ==\n",
+			code:     "invalid-wait-condition",
+			line:     3,
+			severity: protocol.DiagnosticSeverityError,
+			message:  "Invalid wait step condition",
+		},
+		{
+			name:    "label asking for approval",
+			content: "steps:\n  - command: make\n  - wait: \"Deploy to production?\"\n  - command: make deploy\n",
+			code:    "wait-label-looks-like-block",
+			line:    2, char: 10,
+			severity: protocol.DiagnosticSeverityInformation,
+			message:  "Use a block step",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diagnostics := waitStepDiagnosticsFor(server, tt.content)
+			if len(diagnostics) != 1 {
+				t.Fatalf("Expected 1 wait step diagnostic, got %+v", diagnostics)
+			}
+
+			got := diagnostics[0]
+			if got.Code != tt.code {
+				t.Errorf("Expected code %s, got %v", tt.code, got.Code)
+			}
+			if got.Severity != tt.severity {
+				t.Errorf("Expected severity %v, got %v", tt.severity, got.Severity)
+			}
+			if got.Range.Start.Line != tt.line || (tt.char != 0 && got.Range.Start.Character != tt.char) {
+				t.Errorf("Expected %d:%d, got %d:%d", tt.line, tt.char, got.Range.Start.Line, got.Range.Start.Character)
+			}
+			if !strings.Contains(got.Message, tt.message) {
+				t.Errorf("Expected message containing %q, got %q", tt.message, got.Message)
+			}
+		})
+	}
+}
+
+func TestServer_ValidateWaitSteps_Valid(t *testing.T) {
+	server := newTestServer()
+
+	content := `steps:
+  - command: make
+  - wait
+  - command: make test
+  - wait: ~
+    continue_on_failure: true
+    if: build.branch == "main"
+  - wait: "Tests passed"
+  - command: make report`
+
+	if diagnostics := waitStepDiagnosticsFor(server, content); len(diagnostics) != 0 {
+		t.Errorf("Expected no wait step diagnostics, got %+v", diagnostics)
+	}
+}
+
+func TestServer_WaitToBlockAction(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	content := `steps:
+  - command: make
+  - wait: "Deploy to production?"
+    continue_on_failure: true
+    key: approve
+  - command: make deploy`
+	server.documentManager.OpenDocument(uri, 1, content)
+
+	diagnostics := waitStepDiagnosticsFor(server, content)
+	if len(diagnostics) != 1 {
+		t.Fatalf("Expected a single wait-label-looks-like-block diagnostic, got %+v", diagnostics)
+	}
+
+	actions, err := server.CodeAction(context.Background(), &protocol.CodeActionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Range:        diagnostics[0].Range,
+		Context:      protocol.CodeActionContext{Diagnostics: diagnostics},
+	})
+	if err != nil {
+		t.Fatalf("CodeAction failed: %v", err)
+	}
+
+	var convert *protocol.CodeAction
+	for i := range actions {
+		if actions[i].Title == "Convert to a block step" {
+			convert = &actions[i]
+		}
+	}
+	if convert == nil {
+		t.Fatalf("Expected 'Convert to a block step' action, got %+v", actions)
+	}
+
+	// Apply the edits from the bottom up so earlier positions stay valid
+	edits := convert.Edit.Changes[uri]
+	fixed := content
+	for i := len(edits) - 1; i >= 0; i-- {
+		fixed = applyTextEdit(fixed, edits[i])
+	}
+
+	expected := `steps:
+  - command: make
+  - block: "Deploy to production?"
+    key: approve
+  - command: make deploy`
+	if fixed != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, fixed)
+	}
+}
+
+func TestServer_WaitStepHover(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	server.documentManager.OpenDocument(uri, 1, `steps:
+  - command: make
+    continue_on_failure: true
+  - wait: ~
+    continue_on_failure: true
+    if: build.branch == "main"
+  - wait: "Tests passed"
+  - command: make report`)
+
+	tests := []struct {
+		name        string
+		position    protocol.Position
+		expected    []string
+		notExpected []string
+	}{
+		{
+			name:     "map form wait",
+			position: protocol.Position{Line: 3, Character: 5},
+			expected: []string{"`wait: ~` is the same wait as `- wait`"},
+		},
+		{
+			name:     "labeled wait",
+			position: protocol.Position{Line: 6, Character: 5},
+			expected: []string{"`wait: \"Tests passed\"` labels the wait", "use a `block` step"},
+		},
+		{
+			name:        "continue_on_failure on a wait step",
+			position:    protocol.Position{Line: 4, Character: 8},
+			expected:    []string{"**continue_on_failure**"},
+			notExpected: []string{"isn't a wait step"},
+		},
+		{
+			name:     "continue_on_failure on a command step",
+			position: protocol.Position{Line: 2, Character: 8},
+			expected: []string{"**continue_on_failure**", "isn't a wait step", "soft_fail"},
+		},
+		{
+			name:     "condition on a wait step",
+			position: protocol.Position{Line: 5, Character: 12},
+			expected: []string{"**On a wait step**"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hover, err := server.Hover(context.Background(), &protocol.HoverParams{
+				TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+					TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+					Position:     tt.position,
+				},
+			})
+			if err != nil || hover == nil {
+				t.Fatalf("Expected hover content, got %v (%v)", hover, err)
+			}
+			for _, expected := range tt.expected {
+				if !strings.Contains(hover.Contents.Value, expected) {
+					t.Errorf("Expected hover to contain %q, got:\n%s", expected, hover.Contents.Value)
+				}
+			}
+			for _, unexpected := range tt.notExpected {
+				if strings.Contains(hover.Contents.Value, unexpected) {
+					t.Errorf("Expected hover not to contain %q, got:\n%s", unexpected, hover.Contents.Value)
+				}
+			}
+		})
+	}
+}
+
+func TestWaitFormDescription(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{"  - wait", "shortest form"},
+		{"  - wait: ~", "`wait: ~` is the same wait"},
+		{"  - wait: null # comment", "`wait: ~` is the same wait"},
+		{`  - wait: "Deploy?"`, "labels the wait"},
+	}
+
+	for _, tt := range tests {
+		if got := waitFormDescription(tt.line); !strings.Contains(got, tt.expected) {
+			t.Errorf("waitFormDescription(%q) = %q, expected it to contain %q", tt.line, got, tt.expected)
+		}
+	}
+}
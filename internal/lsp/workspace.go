@@ -0,0 +1,640 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+
+	bkcontext "github.com/mcncl/buildkite-ls/internal/context"
+	"github.com/mcncl/buildkite-ls/internal/plugins"
+)
+
+// PluginUsagesMethod is the custom request listing every step that uses a plugin
+const PluginUsagesMethod = "buildkite/pluginUsages"
+
+// PluginUsagesParams are the parameters of a buildkite/pluginUsages request
+type PluginUsagesParams struct {
+	// Plugin is the plugin to search for, e.g. "docker" or "my-org/deploy". Versions are ignored.
+	Plugin string `json:"plugin"`
+}
+
+// PluginUsage is a single plugin reference in a pipeline file
+type PluginUsage struct {
+	Plugin   string            `json:"plugin"`
+	Version  string            `json:"version,omitempty"`
+	Location protocol.Location `json:"location"`
+}
+
+// skippedWorkspaceDirs are never searched for pipeline files
+var skippedWorkspaceDirs = map[string]bool{
+	".git":         true,
+	"node_modules": true,
+	"vendor":       true,
+}
+
+// workspaceIndex caches the lines of the pipeline files on disk in the workspace roots, so
+// requests needing every pipeline, such as code actions, don't walk and read the workspace
+// each time. Files reported changed are read again on next use.
+type workspaceIndex struct {
+	mu sync.Mutex
+	// files are the pipeline files found on disk, nil until the workspace is scanned
+	files map[protocol.DocumentURI]workspaceFile
+	// stale are files changed since they were read, on disk or in the editor
+	stale map[protocol.DocumentURI]bool
+}
+
+// workspaceFile is a pipeline file on disk, with what the checks across files need from it
+// read once along with it
+type workspaceFile struct {
+	lines []string
+	// keys are the step keys the file defines
+	keys []string
+}
+
+func newWorkspaceFile(lines []string) workspaceFile {
+	return workspaceFile{lines: lines, keys: pipelineStepKeys(lines)}
+}
+
+func newWorkspaceIndex() *workspaceIndex {
+	return &workspaceIndex{}
+}
+
+// invalidate drops the index, so the workspace is scanned again, e.g. when the roots or the
+// settings deciding which files are read change
+func (i *workspaceIndex) invalidate() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.files, i.stale = nil, nil
+}
+
+// markStale has a file read again on next use, whether it was changed, created or deleted
+func (i *workspaceIndex) markStale(uri protocol.DocumentURI) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.files == nil {
+		return
+	}
+	if i.stale == nil {
+		i.stale = make(map[protocol.DocumentURI]bool)
+	}
+	i.stale[uri] = true
+}
+
+// SetWorkspaceRoots records the workspace folders searched for pipeline files
+func (s *Server) SetWorkspaceRoots(roots []string) {
+	s.settingsMu.Lock()
+	s.workspaceRoots = roots
+	s.settingsMu.Unlock()
+	s.workspaceIndex.invalidate()
+}
+
+// DidChangeWatchedFiles has the pipeline files changed, created or deleted on disk read again
+func (s *Server) DidChangeWatchedFiles(ctx context.Context, params *protocol.DidChangeWatchedFilesParams) error {
+	for _, change := range params.Changes {
+		s.workspaceIndex.markStale(change.URI)
+	}
+	return nil
+}
+
+// watchedFilesRegistrationID identifies the file watchers registered with the client
+const watchedFilesRegistrationID = "buildkite-ls-watched-files"
+
+// registerFileWatchers asks the client to report changes to YAML files on disk, which keep the
+// workspace index up to date
+func (s *Server) registerFileWatchers(ctx context.Context) {
+	if s.conn == nil || !s.ClientFeatures().WatchFiles {
+		return
+	}
+
+	params := protocol.RegistrationParams{
+		Registrations: []protocol.Registration{{
+			ID:     watchedFilesRegistrationID,
+			Method: "workspace/didChangeWatchedFiles",
+			RegisterOptions: protocol.DidChangeWatchedFilesRegistrationOptions{
+				Watchers: []protocol.FileSystemWatcher{{GlobPattern: "**/*.{yml,yaml}"}},
+			},
+		}},
+	}
+	if _, err := s.conn.Call(ctx, "client/registerCapability", params, nil); err != nil {
+		s.logger.Printf("Failed to register file watchers: %v", err)
+	}
+}
+
+// uriPath returns the path of a file URI, decoding escapes such as %20, or false for URIs of
+// other schemes such as untitled:
+func uriPath(documentURI protocol.DocumentURI) (string, bool) {
+	if _, err := url.ParseRequestURI(string(documentURI)); err != nil || !strings.HasPrefix(string(documentURI), uri.FileScheme+"://") {
+		return "", false
+	}
+	return documentURI.Filename(), true
+}
+
+// workspaceRootsFromParams reads the workspace folders, falling back to the deprecated root URI
+func workspaceRootsFromParams(params *protocol.InitializeParams) []string {
+	var roots []string
+	for _, folder := range params.WorkspaceFolders {
+		if root, ok := uriPath(protocol.DocumentURI(folder.URI)); ok {
+			roots = append(roots, root)
+		}
+	}
+
+	if len(roots) == 0 && params.RootURI != "" {
+		if root, ok := uriPath(params.RootURI); ok {
+			roots = append(roots, root)
+		}
+	}
+
+	return roots
+}
+
+func (s *Server) PluginUsages(ctx context.Context, params *PluginUsagesParams) ([]PluginUsage, error) {
+	if params.Plugin == "" {
+		return nil, fmt.Errorf("plugin is required")
+	}
+
+	return s.findPluginUsages(params.Plugin), nil
+}
+
+// WorkspaceSymbol lists plugin references across the workspace whose name matches the query
+func (s *Server) WorkspaceSymbol(ctx context.Context, params *protocol.WorkspaceSymbolParams) ([]protocol.SymbolInformation, error) {
+	query := strings.ToLower(params.Query)
+
+	var symbols []protocol.SymbolInformation
+	for _, usage := range s.allPluginUsages() {
+		if !strings.Contains(strings.ToLower(usage.Plugin), query) {
+			continue
+		}
+
+		name := usage.Plugin
+		if usage.Version != "" {
+			name += "#" + usage.Version
+		}
+
+		symbols = append(symbols, protocol.SymbolInformation{
+			Name:          name,
+			Kind:          protocol.SymbolKindFunction,
+			Location:      usage.Location,
+			ContainerName: filepath.Base(string(usage.Location.URI)),
+		})
+	}
+
+	return symbols, nil
+}
+
+// findPluginUsages returns every reference to the named plugin, regardless of version
+func (s *Server) findPluginUsages(plugin string) []PluginUsage {
+	name, _, _ := strings.Cut(plugin, "#")
+
+	var usages []PluginUsage
+	for _, usage := range s.allPluginUsages() {
+		if samePlugin(usage.Plugin, name) {
+			usages = append(usages, usage)
+		}
+	}
+	return usages
+}
+
+// samePlugin compares plugin names, treating "docker" and "buildkite-plugins/docker" as equal
+func samePlugin(a, b string) bool {
+	aRef := plugins.ParsePluginReference(a)
+	bRef := plugins.ParsePluginReference(b)
+	if aRef == nil || bRef == nil {
+		return false
+	}
+	return aRef.Org == bRef.Org && aRef.Name == bRef.Name && aRef.Host == bRef.Host && aRef.Path == bRef.Path
+}
+
+// allPluginUsages collects the plugin references in every pipeline file in the workspace
+func (s *Server) allPluginUsages() []PluginUsage {
+	documents := s.workspaceDocuments()
+
+	uris := make([]string, 0, len(documents))
+	for uri := range documents {
+		uris = append(uris, string(uri))
+	}
+	sort.Strings(uris)
+
+	var usages []PluginUsage
+	for _, uri := range uris {
+		usages = append(usages, findPluginReferences(protocol.DocumentURI(uri), documents[protocol.DocumentURI(uri)])...)
+	}
+	return usages
+}
+
+// workspaceDocuments returns the lines of every pipeline file in the workspace roots,
+// preferring the editor's copy of open documents over what is on disk. Files on disk come
+// from the workspace index, which is scanned on first use.
+func (s *Server) workspaceDocuments() map[protocol.DocumentURI][]string {
+	files := s.workspaceFiles()
+	documents := make(map[protocol.DocumentURI][]string, len(files))
+	for uri, file := range files {
+		documents[uri] = file.lines
+	}
+	for uri, lines := range s.openPipelines() {
+		if lines == nil {
+			delete(documents, uri)
+			continue
+		}
+		documents[uri] = lines
+	}
+	return documents
+}
+
+// workspaceFiles returns the pipeline files on disk in the workspace roots from the index,
+// scanning the workspace on first use and reading again the files changed since
+func (s *Server) workspaceFiles() map[protocol.DocumentURI]workspaceFile {
+	settings := s.Settings()
+	index := s.workspaceIndex
+
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	if index.files == nil {
+		index.files, index.stale = s.scanWorkspace(settings), nil
+	}
+	for stale := range index.stale {
+		// Open documents are read from the editor, so they're read from disk once closed
+		if _, open := s.documentManager.GetDocument(stale); open {
+			continue
+		}
+		delete(index.files, stale)
+		if path, ok := uriPath(stale); ok && s.inWorkspace(path) {
+			if lines, ok := s.readWorkspacePipeline(path, settings); ok {
+				index.files[stale] = newWorkspaceFile(lines)
+			}
+		}
+		delete(index.stale, stale)
+	}
+
+	files := make(map[protocol.DocumentURI]workspaceFile, len(index.files))
+	for uri, file := range index.files {
+		files[uri] = file
+	}
+	return files
+}
+
+// openPipelines returns the lines of the open pipeline documents, which take the place of
+// their files on disk. Documents too large to scan have nil lines, as their files are too.
+func (s *Server) openPipelines() map[protocol.DocumentURI][]string {
+	settings := s.Settings()
+	documents := make(map[protocol.DocumentURI][]string)
+	for _, doc := range s.documentManager.AllDocuments() {
+		if !s.isBuildkiteFile(string(doc.URI)) {
+			continue
+		}
+		if settings.documentLimitExceeded(len(doc.Content), len(doc.Lines)) != "" {
+			documents[doc.URI] = nil
+			continue
+		}
+		documents[doc.URI] = doc.Lines
+	}
+	return documents
+}
+
+// scanWorkspace reads every pipeline file on disk in the workspace roots
+func (s *Server) scanWorkspace(settings Settings) map[protocol.DocumentURI]workspaceFile {
+	files := make(map[protocol.DocumentURI]workspaceFile)
+
+	s.settingsMu.RLock()
+	roots := s.workspaceRoots
+	s.settingsMu.RUnlock()
+
+	for _, root := range roots {
+		_ = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if entry.IsDir() {
+				if skippedWorkspaceDirs[entry.Name()] {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if lines, ok := s.readWorkspacePipeline(path, settings); ok {
+				files[uri.File(path)] = newWorkspaceFile(lines)
+			}
+			return nil
+		})
+	}
+
+	return files
+}
+
+// readWorkspacePipeline reads the lines of a pipeline file on disk, reporting false for files
+// that aren't pipelines, can't be read or are oversized. Oversized files aren't read at all.
+func (s *Server) readWorkspacePipeline(path string, settings Settings) ([]string, bool) {
+	if !s.isBuildkiteFile(string(uri.File(path))) {
+		return nil, false
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return nil, false
+	}
+	if settings.documentLimitExceeded(int(info.Size()), 0) != "" {
+		s.logger.Printf("Skipping oversized workspace pipeline %s (%d bytes)", path, info.Size())
+		return nil, false
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		s.logger.Printf("Failed to read workspace pipeline %s: %v", path, err)
+		return nil, false
+	}
+	lines := splitLines(string(content))
+	if reason := settings.documentLimitExceeded(len(content), len(lines)); reason != "" {
+		s.logger.Printf("Skipping oversized workspace pipeline %s (%s)", path, reason)
+		return nil, false
+	}
+	return lines, true
+}
+
+// inWorkspace reports whether a path is inside one of the workspace roots
+func (s *Server) inWorkspace(path string) bool {
+	s.settingsMu.RLock()
+	roots := s.workspaceRoots
+	s.settingsMu.RUnlock()
+
+	for _, root := range roots {
+		if strings.HasPrefix(path, filepath.Clean(root)+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateWorkspace publishes diagnostics for every pipeline file in the workspace roots
+// that isn't open, so broken pipelines show up before they're opened. Open documents are
+// validated as they change.
+func (s *Server) validateWorkspace(ctx context.Context) {
+	documents := s.workspaceDocuments()
+
+	uris := make([]string, 0, len(documents))
+	for uri := range documents {
+		uris = append(uris, string(uri))
+	}
+	sort.Strings(uris)
+
+	validated := 0
+	for _, uri := range uris {
+		if ctx.Err() != nil {
+			s.logger.Printf("Workspace validation cancelled after %d files", validated)
+			return
+		}
+		if _, open := s.documentManager.GetDocument(protocol.DocumentURI(uri)); open {
+			continue
+		}
+		s.validateWorkspaceFile(ctx, protocol.DocumentURI(uri), strings.Join(documents[protocol.DocumentURI(uri)], "\n"))
+		validated++
+	}
+	s.logger.Printf("Validated %d workspace pipeline files", validated)
+}
+
+// validateWorkspaceInBackground validates the workspace without holding up the requests
+// queued behind the one starting it, cancelling a validation an earlier one started
+func (s *Server) validateWorkspaceInBackground() {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s.settingsMu.Lock()
+	if s.cancelWorkspaceValidation != nil {
+		s.cancelWorkspaceValidation()
+	}
+	s.cancelWorkspaceValidation = cancel
+	s.settingsMu.Unlock()
+
+	go func() {
+		defer cancel()
+		s.validateWorkspace(ctx)
+	}()
+}
+
+// validateWorkspaceFile publishes the diagnostics of a pipeline file that isn't open. External
+// validators aren't run, as they'd be started once for every file in the workspace.
+func (s *Server) validateWorkspaceFile(ctx context.Context, uri protocol.DocumentURI, content string) {
+	diagnostics := s.diagnose(uri, content)
+
+	// Only open documents keep their results between validations
+	s.stepResults.forget(uri)
+	s.stepKeys.forget(uri)
+
+	s.sendDiagnostics(ctx, uri, s.identifyDiagnostics(content, diagnostics))
+}
+
+// revalidateClosedDocument replaces the diagnostics of a document closed with unsaved changes
+// by those of the file on disk, when the workspace is validated and the file is in it
+func (s *Server) revalidateClosedDocument(ctx context.Context, uri protocol.DocumentURI) {
+	if !s.Settings().WorkspaceDiagnostics || !s.isBuildkiteFile(string(uri)) {
+		return
+	}
+
+	path, ok := uriPath(uri)
+	if !ok || !s.inWorkspace(path) {
+		return
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	if s.contentLimitExceeded(string(content)) != "" {
+		return
+	}
+	s.validateWorkspaceFile(ctx, uri, string(content))
+}
+
+// findPluginReferences locates the plugin references inside plugins blocks,
+// e.g. `- docker#v5.13.0:` or `- "my-org/deploy#v1.0.0"`
+func findPluginReferences(uri protocol.DocumentURI, lines []string) []PluginUsage {
+	var usages []PluginUsage
+
+	pluginsIndent, itemIndent := -1, -1
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		isListItem := strings.HasPrefix(trimmed, "- ")
+
+		// The plugins block ends at the next line that isn't nested under it
+		if pluginsIndent >= 0 && (indent < pluginsIndent || (indent == pluginsIndent && !isListItem)) {
+			pluginsIndent, itemIndent = -1, -1
+		}
+
+		if yamlKey(line) == "plugins" {
+			pluginsIndent, itemIndent = indent, -1
+			if isListItem {
+				// "- plugins:" opens a step, so the key sits after the dash
+				pluginsIndent += 2
+			}
+			continue
+		}
+
+		if pluginsIndent < 0 || !isListItem {
+			continue
+		}
+
+		// Only the items of the plugins list are references; deeper lists belong to plugin configs
+		if itemIndent < 0 {
+			itemIndent = indent
+		}
+		if indent != itemIndent {
+			continue
+		}
+
+		start, end := pluginReferenceSpan(line)
+		if start < 0 {
+			continue
+		}
+
+		ref := line[start:end]
+		plugin, version, _ := strings.Cut(ref, "#")
+		usages = append(usages, PluginUsage{
+			Plugin:  plugin,
+			Version: version,
+			Location: protocol.Location{
+				URI: uri,
+				Range: protocol.Range{
+					Start: protocol.Position{Line: uint32(i), Character: uint32(start)},
+					End:   protocol.Position{Line: uint32(i), Character: uint32(end)},
+				},
+			},
+		})
+	}
+
+	return usages
+}
+
+// pluginReferenceSpan returns the byte offsets of the plugin reference on a plugins list item
+// line. Unquoted references end where YAML ends the key, so git URLs keep their colons.
+func pluginReferenceSpan(line string) (int, int) {
+	start := strings.Index(line, "- ") + 2
+	for start < len(line) && line[start] == ' ' {
+		start++
+	}
+
+	if start < len(line) && (line[start] == '"' || line[start] == '\'') {
+		end := strings.IndexByte(line[start+1:], line[start])
+		if end <= 0 {
+			return -1, -1
+		}
+		return start + 1, start + 1 + end
+	}
+
+	rest := line[start:]
+	if colon := bkcontext.KeyColon(rest); colon >= 0 {
+		rest = rest[:colon]
+	} else if comment := strings.Index(rest, " #"); comment >= 0 {
+		rest = rest[:comment]
+	}
+	rest = strings.TrimRight(rest, " ")
+
+	if rest == "" {
+		return -1, -1
+	}
+	return start, start + len(rest)
+}
+
+// getPluginBumpActions offers to move every usage of the plugin under the cursor to the
+// newest version referenced anywhere in the workspace
+func (s *Server) getPluginBumpActions(params *protocol.CodeActionParams, doc *Document) []protocol.CodeAction {
+	var target *PluginUsage
+	for _, usage := range findPluginReferences(params.TextDocument.URI, doc.Lines) {
+		if usage.Location.Range.Start.Line == params.Range.Start.Line {
+			target = &usage
+			break
+		}
+	}
+	if target == nil {
+		return nil
+	}
+
+	usages := s.findPluginUsages(target.Plugin)
+
+	latest := ""
+	for _, usage := range usages {
+		if usage.Version != "" && (latest == "" || plugins.CompareVersions(usage.Version, latest) > 0) {
+			latest = usage.Version
+		}
+	}
+	if latest == "" {
+		return nil
+	}
+
+	changes := make(map[protocol.DocumentURI][]protocol.TextEdit)
+	for _, usage := range usages {
+		// Unpinned references already track the latest release
+		if usage.Version == "" || plugins.CompareVersions(usage.Version, latest) >= 0 {
+			continue
+		}
+
+		versionStart := usage.Location.Range.End.Character - uint32(len(usage.Version))
+		changes[usage.Location.URI] = append(changes[usage.Location.URI], protocol.TextEdit{
+			Range: protocol.Range{
+				Start: protocol.Position{Line: usage.Location.Range.Start.Line, Character: versionStart},
+				End:   usage.Location.Range.End,
+			},
+			NewText: latest,
+		})
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	return []protocol.CodeAction{
+		{
+			Title: fmt.Sprintf("Bump %s plugin to %s everywhere", target.Plugin, latest),
+			Kind:  protocol.RefactorRewrite,
+			Edit:  &protocol.WorkspaceEdit{Changes: changes},
+		},
+	}
+}
+
+// getPluginPinActions offers to pin a plugin referenced without a version to its latest known
+// release: the newest of the popular plugins manifest and the versions used in the
+// workspace. Only the reference is edited, so its quotes and configuration stay as written.
+func (s *Server) getPluginPinActions(params *protocol.CodeActionParams, doc *Document) []protocol.CodeAction {
+	var target *PluginUsage
+	for _, usage := range findPluginReferences(params.TextDocument.URI, doc.Lines) {
+		if usage.Location.Range.Start.Line == params.Range.Start.Line {
+			target = &usage
+			break
+		}
+	}
+	// Plugins on disk have no releases to pin to
+	if target == nil || target.Version != "" {
+		return nil
+	}
+	if parsed := plugins.ParsePluginReference(target.Plugin); parsed == nil || parsed.Path != "" {
+		return nil
+	}
+
+	latest := ""
+	for _, popular := range s.completionProvider.PopularPlugins() {
+		if samePlugin(popular.Name, target.Plugin) {
+			latest = popular.Version
+		}
+	}
+	for _, usage := range s.findPluginUsages(target.Plugin) {
+		if usage.Version != "" && (latest == "" || plugins.CompareVersions(usage.Version, latest) > 0) {
+			latest = usage.Version
+		}
+	}
+	if latest == "" {
+		return nil
+	}
+
+	end := target.Location.Range.End
+	action := quickFix(params.TextDocument.URI, fmt.Sprintf("Pin to %s (latest)", latest),
+		[]protocol.TextEdit{{Range: protocol.Range{Start: end, End: end}, NewText: "#" + latest}})
+	return []protocol.CodeAction{action}
+}
@@ -0,0 +1,375 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.lsp.dev/jsonrpc2"
+	"go.lsp.dev/protocol"
+	"go.lsp.dev/uri"
+)
+
+func writeWorkspacePipeline(t *testing.T, root, name, content string) protocol.DocumentURI {
+	t.Helper()
+
+	path := filepath.Join(root, ".buildkite", name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return uri.File(path)
+}
+
+func TestFindPluginReferences(t *testing.T) {
+	content := `steps:
+  - label: "Build"
+    plugins:
+      - docker#v5.13.0:
+          image: "golang:1.22"
+          volumes:
+            - "/cache:/cache"
+      - "my-org/deploy#v1.0.0"
+  - plugins:
+      - cache:
+          path: node_modules
+      - ssh://git@gitlab.example.com/ci/deploy.git#v1.0:
+          target: staging
+    command: "make"`
+
+	usages := findPluginReferences("file:///pipeline.yml", strings.Split(content, "\n"))
+
+	expected := []struct {
+		plugin  string
+		version string
+		line    uint32
+		start   uint32
+	}{
+		{"docker", "v5.13.0", 3, 8},
+		{"my-org/deploy", "v1.0.0", 7, 9},
+		{"cache", "", 9, 8},
+		{"ssh://git@gitlab.example.com/ci/deploy.git", "v1.0", 11, 8},
+	}
+
+	if len(usages) != len(expected) {
+		t.Fatalf("Expected %d plugin references, got %d: %+v", len(expected), len(usages), usages)
+	}
+
+	for i, want := range expected {
+		got := usages[i]
+		if got.Plugin != want.plugin || got.Version != want.version {
+			t.Errorf("Usage %d: expected %s#%s, got %s#%s", i, want.plugin, want.version, got.Plugin, got.Version)
+		}
+		if got.Location.Range.Start.Line != want.line || got.Location.Range.Start.Character != want.start {
+			t.Errorf("Usage %d: expected position %d:%d, got %d:%d", i, want.line, want.start,
+				got.Location.Range.Start.Line, got.Location.Range.Start.Character)
+		}
+	}
+}
+
+func TestServer_PluginUsagesAcrossWorkspace(t *testing.T) {
+	server := newTestServer()
+	root := t.TempDir()
+
+	buildURI := writeWorkspacePipeline(t, root, "pipeline.yml", `steps:
+  - command: "make"
+    plugins:
+      - docker#v5.13.0:
+          image: "golang:1.22"`)
+	deployURI := writeWorkspacePipeline(t, root, "deploy.yml", `steps:
+  - command: "deploy"
+    plugins:
+      - docker#v5.9.0:
+          image: "alpine"
+      - buildkite-plugins/docker#v5.10.0: ~`)
+	writeWorkspacePipeline(t, root, "node_modules/pipeline.yml", `steps:
+  - plugins:
+      - docker#v1.0.0: ~`)
+
+	server.SetWorkspaceRoots([]string{root})
+
+	usages, err := server.PluginUsages(context.Background(), &PluginUsagesParams{Plugin: "docker"})
+	if err != nil {
+		t.Fatalf("PluginUsages failed: %v", err)
+	}
+	if len(usages) != 3 {
+		t.Fatalf("Expected 3 docker usages, got %d: %+v", len(usages), usages)
+	}
+
+	symbols, err := server.WorkspaceSymbol(context.Background(), &protocol.WorkspaceSymbolParams{Query: "dock"})
+	if err != nil {
+		t.Fatalf("WorkspaceSymbol failed: %v", err)
+	}
+	if len(symbols) != 3 || symbols[0].Kind != protocol.SymbolKindFunction {
+		t.Errorf("Expected 3 plugin symbols, got %+v", symbols)
+	}
+
+	// Open the deploy pipeline in the editor and bump from its docker reference
+	content, err := os.ReadFile(strings.TrimPrefix(string(deployURI), "file://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.documentManager.OpenDocument(deployURI, 1, string(content))
+	doc, _ := server.documentManager.GetDocument(deployURI)
+
+	actions := server.getPluginBumpActions(&protocol.CodeActionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: deployURI},
+		Range:        protocol.Range{Start: protocol.Position{Line: 3, Character: 10}},
+	}, doc)
+
+	if len(actions) != 1 {
+		t.Fatalf("Expected 1 bump action, got %d", len(actions))
+	}
+
+	action := actions[0]
+	if action.Title != "Bump docker plugin to v5.13.0 everywhere" {
+		t.Errorf("Unexpected action title: %q", action.Title)
+	}
+
+	changes := action.Edit.Changes
+	if _, ok := changes[buildURI]; ok {
+		t.Error("Did not expect edits to the pipeline already on the latest version")
+	}
+
+	edits := changes[deployURI]
+	if len(edits) != 2 {
+		t.Fatalf("Expected 2 edits in the deploy pipeline, got %+v", edits)
+	}
+	if edits[0].NewText != "v5.13.0" || edits[0].Range.Start.Character != 15 || edits[0].Range.End.Character != 21 {
+		t.Errorf("Unexpected first edit: %+v", edits[0])
+	}
+}
+
+func TestServer_WorkspaceIndex(t *testing.T) {
+	server := newTestServer()
+	// Paths with spaces and percent signs are escaped in URIs
+	root := filepath.Join(t.TempDir(), "my repo 100%")
+	server.SetWorkspaceRoots(workspaceRootsFromParams(&protocol.InitializeParams{
+		WorkspaceFolders: []protocol.WorkspaceFolder{{URI: string(uri.File(root)), Name: "my repo"}},
+	}))
+
+	buildURI := writeWorkspacePipeline(t, root, "pipeline.yml", "steps:\n  - plugins:\n      - docker#v5.0.0: ~\n")
+	if usages := server.findPluginUsages("docker"); len(usages) != 1 || usages[0].Location.URI != buildURI {
+		t.Fatalf("Expected the usage in %s, got %+v", buildURI, usages)
+	}
+	if !strings.Contains(string(buildURI), "my%20repo%20100%25") {
+		t.Errorf("Expected an escaped URI, got %s", buildURI)
+	}
+
+	// Files on disk are read once, until they're reported changed
+	deployURI := writeWorkspacePipeline(t, root, "pipeline.deploy.yml", "steps:\n  - plugins:\n      - docker#v5.1.0: ~\n")
+	if usages := server.findPluginUsages("docker"); len(usages) != 1 {
+		t.Fatalf("Expected the index to be reused, got %+v", usages)
+	}
+
+	err := server.DidChangeWatchedFiles(context.Background(), &protocol.DidChangeWatchedFilesParams{
+		Changes: []*protocol.FileEvent{{Type: protocol.FileChangeTypeCreated, URI: deployURI}},
+	})
+	if err != nil {
+		t.Fatalf("DidChangeWatchedFiles failed: %v", err)
+	}
+	if usages := server.findPluginUsages("docker"); len(usages) != 2 {
+		t.Fatalf("Expected the created file to be read, got %+v", usages)
+	}
+
+	// Closing a document reads the saved file again
+	if err := server.DidOpen(context.Background(), &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: buildURI, LanguageID: "yaml", Version: 1, Text: "steps:\n  - plugins:\n      - docker#v5.0.0: ~\n"},
+	}); err != nil {
+		t.Fatalf("DidOpen failed: %v", err)
+	}
+	if err := os.Remove(buildURI.Filename()); err != nil {
+		t.Fatal(err)
+	}
+	if usages := server.findPluginUsages("docker"); len(usages) != 2 {
+		t.Fatalf("Expected the open document to be read from the editor, got %+v", usages)
+	}
+	if err := server.DidClose(context.Background(), &protocol.DidCloseTextDocumentParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: buildURI},
+	}); err != nil {
+		t.Fatalf("DidClose failed: %v", err)
+	}
+	if usages := server.findPluginUsages("docker"); len(usages) != 1 || usages[0].Location.URI != deployURI {
+		t.Errorf("Expected only the file left on disk, got %+v", usages)
+	}
+}
+
+func TestServer_PluginPinActions(t *testing.T) {
+	server := newTestServer()
+	uri := protocol.DocumentURI("file:///test/.buildkite/pipeline.yml")
+	content := `steps:
+  - command: make
+    plugins:
+      - docker:
+          image: "golang:1.22"
+      - "my-org/deploy": ~
+      - my-org/deploy#v1.2.0: ~
+      - my-org/other: ~
+      - ./.buildkite/plugins/local: ~
+      - shellcheck#v1.4.0: ~`
+	server.documentManager.OpenDocument(uri, 1, content)
+	doc, _ := server.documentManager.GetDocument(uri)
+
+	dockerVersion := ""
+	for _, popular := range server.completionProvider.PopularPlugins() {
+		if popular.Name == "docker" {
+			dockerVersion = popular.Version
+		}
+	}
+
+	tests := []struct {
+		name     string
+		line     uint32
+		title    string
+		expected string
+	}{
+		{"popular plugin", 3, "Pin to " + dockerVersion + " (latest)", "      - docker#" + dockerVersion + ":"},
+		{"version used elsewhere, keeping the quotes", 5, "Pin to v1.2.0 (latest)", `      - "my-org/deploy#v1.2.0": ~`},
+		{"no known version", 7, "", ""},
+		{"local plugin", 8, "", ""},
+		{"already pinned", 9, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actions := server.getPluginPinActions(&protocol.CodeActionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+				Range:        protocol.Range{Start: protocol.Position{Line: tt.line, Character: 8}},
+			}, doc)
+
+			if tt.title == "" {
+				if len(actions) != 0 {
+					t.Errorf("Expected no pin action, got %+v", actions)
+				}
+				return
+			}
+			if len(actions) != 1 || actions[0].Title != tt.title || actions[0].Kind != protocol.QuickFix {
+				t.Fatalf("Expected a %q quick fix, got %+v", tt.title, actions)
+			}
+			updated := strings.Split(applyTextEdits(content, actions[0].Edit.Changes[uri]), "\n")
+			if updated[tt.line] != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, updated[tt.line])
+			}
+		})
+	}
+}
+
+func TestServer_WorkspaceDiagnostics(t *testing.T) {
+	server := newTestServer()
+	ctx := context.Background()
+
+	serverSide, clientSide := net.Pipe()
+	defer serverSide.Close()
+	defer clientSide.Close()
+
+	published := make(chan protocol.PublishDiagnosticsParams, 8)
+	client := jsonrpc2.NewConn(jsonrpc2.NewStream(clientSide))
+	client.Go(ctx, func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		if req.Method() == "textDocument/publishDiagnostics" {
+			var params protocol.PublishDiagnosticsParams
+			if err := json.Unmarshal(req.Params(), &params); err == nil {
+				published <- params
+			}
+		}
+		return reply(ctx, nil, nil)
+	})
+	conn := jsonrpc2.NewConn(jsonrpc2.NewStream(serverSide))
+	conn.Go(ctx, jsonrpc2.MethodNotFoundHandler)
+	server.SetConnection(conn)
+
+	root := t.TempDir()
+	broken := writeWorkspacePipeline(t, root, "pipeline.yml", "steps:\n  - key: build\n    label: Build\n    command: make\n    env:\n      DEBUG: true\n")
+	opened := writeWorkspacePipeline(t, root, "pipeline.deploy.yml", "steps:\n  - label: Deploy\n    command: deploy\n")
+	if err := os.WriteFile(filepath.Join(root, "README.md"), []byte("steps:"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	server.SetWorkspaceRoots([]string{root})
+	server.documentManager.OpenDocument(opened, 1, "steps:\n  - label: Deploy\n    command: deploy\n    env:\n      DRY_RUN: yes\n")
+
+	received := func() map[protocol.DocumentURI][]protocol.Diagnostic {
+		t.Helper()
+		byURI := make(map[protocol.DocumentURI][]protocol.Diagnostic)
+		for {
+			select {
+			case params := <-published:
+				byURI[params.URI] = params.Diagnostics
+			case <-time.After(200 * time.Millisecond):
+				return byURI
+			}
+		}
+	}
+
+	// Off unless the client asks for it
+	server.applyConfiguration(ctx, nil)
+	if byURI := received(); len(byURI[broken]) != 0 {
+		t.Fatalf("Expected no workspace diagnostics by default, got %+v", byURI)
+	}
+
+	server.applyConfiguration(ctx, map[string]interface{}{"workspaceDiagnostics": true})
+	byURI := received()
+	if diagnostics, ok := byURI[broken]; !ok || len(diagnostics) != 1 || diagnostics[0].Code != "unquoted-env-value" {
+		t.Errorf("Expected the unopened pipeline's unquoted env value reported, got %+v", byURI)
+	}
+	if _, ok := byURI[opened]; ok && len(byURI[opened]) != 1 {
+		t.Errorf("Expected the open document validated from the editor's copy, got %+v", byURI[opened])
+	}
+
+	// Closing a document with unsaved changes goes back to the file on disk's diagnostics
+	server.documentManager.OpenDocument(broken, 1, "steps:\n  - key: build\n    label: Build\n    command: make\n")
+	server.validateDocument(ctx, broken, "steps:\n  - key: build\n    label: Build\n    command: make\n")
+	if diagnostics := received()[broken]; len(diagnostics) != 0 {
+		t.Fatalf("Expected the fixed document to have no diagnostics, got %+v", diagnostics)
+	}
+	if err := server.DidClose(ctx, &protocol.DidCloseTextDocumentParams{TextDocument: protocol.TextDocumentIdentifier{URI: broken}}); err != nil {
+		t.Fatal(err)
+	}
+	if diagnostics := received()[broken]; len(diagnostics) != 1 {
+		t.Errorf("Expected the file on disk's diagnostics once closed, got %+v", diagnostics)
+	}
+}
+
+func TestServer_ApplyConfigurationValidatesWorkspaceInBackground(t *testing.T) {
+	server := newTestServer()
+	ctx := context.Background()
+
+	serverSide, clientSide := net.Pipe()
+	defer serverSide.Close()
+	defer clientSide.Close()
+
+	// The client doesn't read the published diagnostics until released
+	release := make(chan struct{})
+	client := jsonrpc2.NewConn(jsonrpc2.NewStream(clientSide))
+	client.Go(ctx, func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		if req.Method() == "textDocument/publishDiagnostics" {
+			<-release
+		}
+		return reply(ctx, nil, nil)
+	})
+	conn := jsonrpc2.NewConn(jsonrpc2.NewStream(serverSide))
+	conn.Go(ctx, jsonrpc2.MethodNotFoundHandler)
+	server.SetConnection(conn)
+
+	root := t.TempDir()
+	writeWorkspacePipeline(t, root, "pipeline.yml", "steps:\n  - label: Build\n    command: make\n")
+	writeWorkspacePipeline(t, root, "pipeline.deploy.yml", "steps:\n  - label: Deploy\n    command: deploy\n")
+	server.SetWorkspaceRoots([]string{root})
+
+	applied := make(chan struct{})
+	go func() {
+		server.applyConfiguration(ctx, map[string]interface{}{"workspaceDiagnostics": true})
+		close(applied)
+	}()
+	select {
+	case <-applied:
+	case <-time.After(2 * time.Second):
+		t.Error("Expected the configuration to be applied without waiting for the workspace")
+	}
+	close(release)
+}
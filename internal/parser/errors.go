@@ -0,0 +1,213 @@
+package parser
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SyntaxError describes a YAML parse error at a specific location
+type SyntaxError struct {
+	Line    int    // 1-based line number, 0 if unknown
+	Column  int    // 1-based column, 0 if unknown
+	Message string // Error message without the "yaml:" prefix
+	Hint    string // Short human-readable suggestion, may be empty
+}
+
+var (
+	lineColumnPattern = regexp.MustCompile(`^line (\d+)(?:, column (\d+))?: (.*)$`)
+	tabIndentPattern  = regexp.MustCompile(`^[ ]*\t`)
+	// unknownAnchorPattern matches the error for an alias to an anchor that isn't defined
+	unknownAnchorPattern = regexp.MustCompile(`unknown anchor '([^']*)' referenced`)
+	// anchorPattern matches an anchor such as &defaults, capturing its name
+	anchorPattern = regexp.MustCompile(`(?:^|[\s\[{,])&([^\s,\[\]{}]+)`)
+)
+
+// SyntaxErrors extracts positioned errors from a YAML parse error.
+// yaml.v3 reports positions in the message text, and a TypeError can
+// carry several of them at once.
+func SyntaxErrors(err error, content []byte) []SyntaxError {
+	if err == nil {
+		return nil
+	}
+
+	lines := strings.Split(string(content), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+
+	var messages []string
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	} else {
+		messages = []string{rootMessage(err)}
+	}
+
+	result := make([]SyntaxError, 0, len(messages))
+	for _, msg := range messages {
+		result = append(result, newSyntaxError(strings.TrimSpace(msg), lines))
+	}
+
+	return result
+}
+
+// rootMessage strips our own wrapping and the yaml prefix from an error
+func rootMessage(err error) string {
+	for {
+		next := errors.Unwrap(err)
+		if next == nil {
+			break
+		}
+		err = next
+	}
+	return strings.TrimPrefix(err.Error(), "yaml: ")
+}
+
+func newSyntaxError(msg string, lines []string) SyntaxError {
+	syntaxErr := SyntaxError{Message: msg}
+
+	if match := lineColumnPattern.FindStringSubmatch(msg); match != nil {
+		syntaxErr.Line, _ = strconv.Atoi(match[1])
+		if match[2] != "" {
+			syntaxErr.Column, _ = strconv.Atoi(match[2])
+		}
+		syntaxErr.Message = match[3]
+	}
+
+	// yaml.v3 doesn't report a position for these, so find the likely culprit
+	if syntaxErr.Line == 0 && strings.Contains(syntaxErr.Message, "mapping values are not allowed") {
+		syntaxErr.Line = findNestedMappingValue(lines)
+	}
+	if match := unknownAnchorPattern.FindStringSubmatch(syntaxErr.Message); syntaxErr.Line == 0 && match != nil {
+		syntaxErr.Line, syntaxErr.Column = findAlias(lines, match[1])
+	}
+
+	syntaxErr.Hint = syntaxHint(syntaxErr, lines)
+	return syntaxErr
+}
+
+// syntaxHint suggests a likely cause for common yaml.v3 errors
+func syntaxHint(syntaxErr SyntaxError, lines []string) string {
+	line := ""
+	if syntaxErr.Line > 0 && syntaxErr.Line <= len(lines) {
+		line = lines[syntaxErr.Line-1]
+	}
+
+	msg := syntaxErr.Message
+	switch {
+	case strings.Contains(msg, "tab character") || tabIndentPattern.MatchString(line):
+		return "unexpected tab character - YAML indentation must use spaces"
+	case strings.Contains(msg, "found character that cannot start any token"):
+		return "values starting with characters like @ or ` must be quoted"
+	case strings.Contains(msg, "mapping values are not allowed"):
+		return "quote values that contain ': ' or check the indentation"
+	case strings.Contains(msg, "did not find expected key"):
+		return "check the indentation of this line and the keys around it"
+	case strings.Contains(msg, "did not find expected '-' indicator"):
+		return "list items must all be indented to the same level"
+	case strings.Contains(msg, "could not find expected ':'"):
+		return "a key is missing its ':'"
+	case strings.Contains(msg, "found unexpected end of stream"):
+		return "a quoted string or flow collection is never closed"
+	case strings.Contains(msg, "did not find expected ',' or ']'"):
+		return "a '[' list is never closed"
+	case strings.Contains(msg, "did not find expected ',' or '}'"):
+		return "a '{' mapping is never closed"
+	case strings.Contains(msg, "already defined"):
+		return "duplicate keys are not allowed in the same mapping"
+	case strings.Contains(msg, "unknown anchor"):
+		if match := unknownAnchorPattern.FindStringSubmatch(msg); match != nil {
+			if anchor := closestAnchor(match[1], lines); anchor != "" {
+				return "the alias refers to an anchor that isn't defined, did you mean *" + anchor + "?"
+			}
+		}
+		return "the alias refers to an anchor that isn't defined"
+	default:
+		return ""
+	}
+}
+
+// findNestedMappingValue returns the first line (1-based) whose value contains
+// an unquoted ": ", or 0 if there isn't one
+func findNestedMappingValue(lines []string) int {
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		trimmed = strings.TrimPrefix(trimmed, "- ")
+
+		colonIndex := strings.Index(trimmed, ": ")
+		if colonIndex == -1 {
+			continue
+		}
+
+		value := strings.TrimSpace(trimmed[colonIndex+2:])
+		if value == "" || value[0] == '"' || value[0] == '\'' || value[0] == '{' || value[0] == '|' || value[0] == '>' {
+			continue
+		}
+
+		if strings.Contains(value, ": ") {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// findAlias returns the line and column (1-based) of the first alias to the anchor, or
+// zeros if there isn't one
+func findAlias(lines []string, anchor string) (int, int) {
+	aliasPattern := regexp.MustCompile(`(?:^|[\s\[{,])(\*` + regexp.QuoteMeta(anchor) + `)(?:$|[\s,\]}])`)
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		if match := aliasPattern.FindStringSubmatchIndex(line); match != nil {
+			return i + 1, match[2] + 1
+		}
+	}
+	return 0, 0
+}
+
+// closestAnchor returns the anchor defined in the lines whose name is closest to a missing
+// one, such as &defaults for *default, or "" if none is close
+func closestAnchor(missing string, lines []string) string {
+	closest, best := "", 3
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		for _, match := range anchorPattern.FindAllStringSubmatch(line, -1) {
+			if distance := EditDistance(missing, match[1]); distance < best && distance < len(missing) {
+				closest, best = match[1], distance
+			}
+		}
+	}
+	return closest
+}
+
+// EditDistance counts the single character insertions, deletions and substitutions that
+// turn a into b
+func EditDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
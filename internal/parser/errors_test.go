@@ -0,0 +1,100 @@
+package parser
+
+import (
+	"testing"
+)
+
+func TestSyntaxErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		expectedLine int
+		expectedHint string
+	}{
+		{
+			name:         "tab indentation",
+			content:      "steps:\n\t- label: test\n",
+			expectedLine: 2,
+			expectedHint: "unexpected tab character - YAML indentation must use spaces",
+		},
+		{
+			name:         "unterminated string",
+			content:      "steps:\n  - label: \"test\n",
+			expectedLine: 2,
+			expectedHint: "a quoted string or flow collection is never closed",
+		},
+		{
+			name:         "nested mapping value without position",
+			content:      "steps:\n  - label: Build: app\n",
+			expectedLine: 2,
+			expectedHint: "quote values that contain ': ' or check the indentation",
+		},
+		{
+			name:         "unclosed flow sequence",
+			content:      "steps: [1, 2\n",
+			expectedLine: 1,
+			expectedHint: "a '[' list is never closed",
+		},
+		{
+			name:         "misspelt alias",
+			content:      "defaults: &defaults\n  timeout_in_minutes: 10\nsteps:\n  - <<: *default\n    command: make\n",
+			expectedLine: 4,
+			expectedHint: "the alias refers to an anchor that isn't defined, did you mean *defaults?",
+		},
+		{
+			name:         "undefined alias",
+			content:      "steps:\n  - command: make\n    env: *environment\n",
+			expectedLine: 3,
+			expectedHint: "the alias refers to an anchor that isn't defined",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseYAML([]byte(tt.content))
+			if err == nil {
+				t.Fatal("Expected parse error")
+			}
+
+			syntaxErrors := SyntaxErrors(err, []byte(tt.content))
+			if len(syntaxErrors) != 1 {
+				t.Fatalf("Expected 1 syntax error, got %d: %+v", len(syntaxErrors), syntaxErrors)
+			}
+
+			if syntaxErrors[0].Line != tt.expectedLine {
+				t.Errorf("Expected line %d, got %d (%s)", tt.expectedLine, syntaxErrors[0].Line, syntaxErrors[0].Message)
+			}
+
+			if syntaxErrors[0].Hint != tt.expectedHint {
+				t.Errorf("Expected hint %q, got %q", tt.expectedHint, syntaxErrors[0].Hint)
+			}
+		})
+	}
+}
+
+func TestSyntaxErrors_TypeError(t *testing.T) {
+	// A TypeError can carry several positioned messages
+	content := []byte("a: 1\na: 2\nb: 1\nb: 2\n")
+
+	_, err := ParseYAML(content)
+	if err == nil {
+		t.Fatal("Expected parse error for duplicate keys")
+	}
+
+	syntaxErrors := SyntaxErrors(err, content)
+	if len(syntaxErrors) == 0 {
+		t.Fatal("Expected syntax errors")
+	}
+
+	for _, syntaxErr := range syntaxErrors {
+		if syntaxErr.Line == 0 {
+			t.Errorf("Expected a line number for %q", syntaxErr.Message)
+		}
+	}
+}
+
+func TestSyntaxErrors_Nil(t *testing.T) {
+	if errs := SyntaxErrors(nil, nil); errs != nil {
+		t.Errorf("Expected nil for nil error, got %+v", errs)
+	}
+}
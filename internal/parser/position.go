@@ -0,0 +1,213 @@
+package parser
+
+import (
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PathNode is a node on the path to a position, with the mapping key it is the value of.
+// Key is nil for the document's root and for list items.
+type PathNode struct {
+	Key  *yaml.Node
+	Node *yaml.Node
+}
+
+// NodePath is the chain of nodes from a document's root to the innermost node at a
+// position, outermost first
+type NodePath struct {
+	Nodes []PathNode
+	// OnKey is set when the position is on the key of the innermost node rather than on
+	// the node itself
+	OnKey bool
+}
+
+// Leaf returns the innermost node on the path, or nil when the path is empty
+func (p NodePath) Leaf() *PathNode {
+	if len(p.Nodes) == 0 {
+		return nil
+	}
+	return &p.Nodes[len(p.Nodes)-1]
+}
+
+// Keys returns the mapping keys along the path, outermost first, leaving out list items
+func (p NodePath) Keys() []string {
+	var keys []string
+	for _, node := range p.Nodes {
+		if node.Key != nil {
+			keys = append(keys, node.Key.Value)
+		}
+	}
+	return keys
+}
+
+// position is a 0-based line and column
+type position struct {
+	line, col int
+}
+
+func (a position) before(b position) bool {
+	return a.line < b.line || (a.line == b.line && a.col < b.col)
+}
+
+func nodeStart(node *yaml.Node) position {
+	return position{node.Line - 1, node.Column - 1}
+}
+
+// NodeAtPosition returns the path to the innermost node at the 0-based line and column.
+// On a line with text, the column counts from no further left than the text, so the
+// indentation decides where the line belongs. Blank lines belong to the deepest block
+// collection the column is indented into, so the path at a new line inside a step ends
+// at the step.
+func (p *Pipeline) NodeAtPosition(line, col int) NodePath {
+	var path NodePath
+	if p.YAMLNode == nil || len(p.YAMLNode.Content) == 0 {
+		return path
+	}
+
+	walker := &pathWalker{lines: strings.Split(string(p.Content), "\n")}
+	if line < len(walker.lines) {
+		text := walker.lines[line]
+		if trimmed := strings.TrimSpace(text); trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			col = max(col, len(text)-len(strings.TrimLeft(text, " ")))
+		}
+	}
+	walker.pos = position{line, col}
+
+	root := p.YAMLNode.Content[0]
+	path.Nodes = append(path.Nodes, PathNode{Node: root})
+	walker.descend(&path, root)
+	return path
+}
+
+// pathWalker follows the nodes containing a position down from the root
+type pathWalker struct {
+	lines []string
+	pos   position
+}
+
+func (w *pathWalker) descend(path *NodePath, node *yaml.Node) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		// The entry is the last one starting at or before the position
+		var key, value *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if !w.pos.before(nodeStart(node.Content[i])) {
+				key, value = node.Content[i], node.Content[i+1]
+			}
+		}
+		if key == nil {
+			return
+		}
+		if w.pos.line == key.Line-1 && w.pos.col < key.Column-1+len(key.Value) {
+			path.Nodes = append(path.Nodes, PathNode{Key: key, Node: value})
+			path.OnKey = true
+			return
+		}
+		if !w.valueContains(key, value) {
+			return
+		}
+		path.Nodes = append(path.Nodes, PathNode{Key: key, Node: value})
+		w.descend(path, value)
+
+	case yaml.SequenceNode:
+		var item *yaml.Node
+		for _, candidate := range node.Content {
+			if !w.pos.before(w.itemStart(node, candidate)) {
+				item = candidate
+			}
+		}
+		if item == nil || !w.itemContains(item) {
+			return
+		}
+		path.Nodes = append(path.Nodes, PathNode{Node: item})
+		w.descend(path, item)
+	}
+}
+
+// itemStart is where a list item starts: at its dash in a block list
+func (w *pathWalker) itemStart(list, item *yaml.Node) position {
+	start := nodeStart(item)
+	if list.Style&yaml.FlowStyle == 0 {
+		start.col = min(start.col, list.Column-1)
+	}
+	return start
+}
+
+// valueContains reports whether the position, at or after the key, is in its value
+func (w *pathWalker) valueContains(key, value *yaml.Node) bool {
+	if w.pos.line == key.Line-1 {
+		return true
+	}
+	keyCol := key.Column - 1
+
+	switch value.Kind {
+	case yaml.MappingNode, yaml.SequenceNode:
+		if value.Style&yaml.FlowStyle != 0 {
+			return w.pos.line <= w.lastLine(value)
+		}
+		if w.pos.col > keyCol {
+			return true
+		}
+		// A list can start at its key's column, so a line there holding an item is in it
+		return value.Kind == yaml.SequenceNode && value.Column-1 == keyCol && w.pos.col == keyCol && w.lineStartsItem()
+	case yaml.ScalarNode:
+		if value.Tag == "!!null" && value.Value == "" {
+			// A value left out is being written on the lines indented under its key
+			return w.pos.col > keyCol
+		}
+		return w.pos.line <= w.lastLine(value)
+	}
+	return false
+}
+
+// itemContains reports whether the position, at or after a list item's dash, is in it
+func (w *pathWalker) itemContains(item *yaml.Node) bool {
+	if w.pos.line == item.Line-1 {
+		return true
+	}
+	switch item.Kind {
+	case yaml.MappingNode, yaml.SequenceNode:
+		if item.Style&yaml.FlowStyle != 0 {
+			return w.pos.line <= w.lastLine(item)
+		}
+		return w.pos.col >= item.Column-1
+	case yaml.ScalarNode:
+		return w.pos.line <= w.lastLine(item)
+	}
+	return false
+}
+
+// lastLine is the last line a scalar or flow collection can reach. Block scalars start on
+// the line after their `|` or `>`.
+func (w *pathWalker) lastLine(node *yaml.Node) int {
+	switch {
+	case node.Kind == yaml.ScalarNode && (node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0):
+		return node.Line - 1 + strings.Count(strings.TrimRight(node.Value, "\n"), "\n") + 1
+	case node.Kind == yaml.ScalarNode:
+		return node.Line - 1 + strings.Count(node.Value, "\n")
+	}
+
+	// A flow collection ends on the line of its closing bracket
+	opening, closing := "[", "]"
+	if node.Kind == yaml.MappingNode {
+		opening, closing = "{", "}"
+	}
+	depth := 0
+	for i := node.Line - 1; i < len(w.lines); i++ {
+		text := w.lines[i]
+		if i == node.Line-1 {
+			text = text[min(node.Column-1, len(text)):]
+		}
+		depth += strings.Count(text, opening) - strings.Count(text, closing)
+		if depth <= 0 {
+			return i
+		}
+	}
+	return len(w.lines) - 1
+}
+
+// lineStartsItem reports whether the position's line holds a list item
+func (w *pathWalker) lineStartsItem() bool {
+	return w.pos.line < len(w.lines) && strings.HasPrefix(strings.TrimSpace(w.lines[w.pos.line]), "-")
+}
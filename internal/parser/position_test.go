@@ -0,0 +1,93 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNodeAtPosition(t *testing.T) {
+	content := []byte(`# Deploys the app
+steps:
+  - label: "Test"
+    # Runs the suite
+    command: |
+      make test
+      make lint
+    plugins:
+      - docker#v5.13.0:
+          image: golang
+
+  - { label: "Flow", key: flow, depends_on: [test, lint] }
+  - wait
+  - block: "Release"
+    fields:
+      - text: "Version"
+        key: version
+env:
+  DEBUG: "true"
+`)
+
+	pipeline, err := ParseYAML(content)
+	if err != nil {
+		t.Fatalf("ParseYAML failed: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		line, col int
+		keys      []string
+		onKey     bool
+	}{
+		{"comment before the steps", 0, 0, nil, false},
+		{"steps key", 1, 2, []string{"steps"}, true},
+		{"label value", 2, 14, []string{"steps", "label"}, false},
+		{"comment inside a step", 3, 6, []string{"steps"}, false},
+		{"block scalar line", 5, 8, []string{"steps", "command"}, false},
+		{"last block scalar line", 6, 6, []string{"steps", "command"}, false},
+		{"plugin option", 9, 12, []string{"steps", "plugins", "docker#v5.13.0", "image"}, true},
+		{"blank line in a step", 10, 4, []string{"steps"}, false},
+		{"flow mapping key", 11, 22, []string{"steps", "key"}, true},
+		{"flow mapping value", 11, 29, []string{"steps", "key"}, false},
+		{"flow sequence", 11, 53, []string{"steps", "depends_on"}, false},
+		{"scalar step", 12, 6, []string{"steps"}, false},
+		{"block step", 13, 6, []string{"steps", "block"}, true},
+		{"nested field", 16, 8, []string{"steps", "fields", "key"}, true},
+		{"top-level mapping", 18, 4, []string{"env", "DEBUG"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := pipeline.NodeAtPosition(tt.line, tt.col)
+			if keys := path.Keys(); !reflect.DeepEqual(keys, tt.keys) {
+				t.Errorf("Expected keys %v, got %v", tt.keys, keys)
+			}
+			if path.OnKey != tt.onKey {
+				t.Errorf("Expected OnKey %v, got %v", tt.onKey, path.OnKey)
+			}
+		})
+	}
+}
+
+func TestNodeAtPosition_StepItems(t *testing.T) {
+	content := []byte(`steps:
+  - command: "make"
+  - wait
+  - trigger: deploy
+`)
+
+	pipeline, err := ParseYAML(content)
+	if err != nil {
+		t.Fatalf("ParseYAML failed: %v", err)
+	}
+
+	for line, want := range map[int]int{1: 0, 2: 1, 3: 2} {
+		path := pipeline.NodeAtPosition(line, 4)
+		if len(path.Nodes) < 3 {
+			t.Fatalf("Expected a path through a step on line %d, got %d nodes", line, len(path.Nodes))
+		}
+		steps := path.Nodes[1].Node
+		if steps.Content[want] != path.Nodes[2].Node {
+			t.Errorf("Expected step %d on line %d", want, line)
+		}
+	}
+}
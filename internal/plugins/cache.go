@@ -0,0 +1,144 @@
+package plugins
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CacheDir is the directory the server keeps its on-disk caches in, or "" when the user
+// has no cache directory
+func CacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "buildkite-ls")
+}
+
+// DefaultSchemaCacheDir is where fetched plugin schemas are cached between runs, or ""
+// when there is no cache directory
+func DefaultSchemaCacheDir() string {
+	dir := CacheDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "plugin-schemas")
+}
+
+// ClearCache removes an on-disk cache directory and everything in it. A directory that
+// doesn't exist is already clear.
+func ClearCache(dir string) error {
+	if dir == "" {
+		return nil
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to clear cache %s: %w", dir, err)
+	}
+	return nil
+}
+
+// SetSchemaCacheDir caches fetched plugin.yml files in dir, so schemas survive restarts and
+// are available offline. An empty dir disables the disk cache.
+func (r *Registry) SetSchemaCacheDir(dir string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.schemaCacheDir = dir
+}
+
+// schemaCachePath is where the plugin.yml of a parsed reference is cached, or "" when the
+// disk cache is disabled
+func (r *Registry) schemaCachePath(parsed *ParsedPluginRef) string {
+	r.mu.RLock()
+	dir := r.schemaCacheDir
+	r.mu.RUnlock()
+
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, url.PathEscape(parsed.Org), url.PathEscape(parsed.Name+"@"+parsed.Version)+".yml")
+}
+
+// readCachedSchema returns the cached plugin.yml at path and how old it is
+func readCachedSchema(path string) ([]byte, time.Duration, bool) {
+	if path == "" {
+		return nil, 0, false
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, 0, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, false
+	}
+	return data, time.Since(info.ModTime()), true
+}
+
+// writeCachedSchema stores a downloaded plugin.yml for the next run. Failing to write the
+// cache doesn't fail the fetch, the schema is just downloaded again next time. The copy is
+// replaced in one step, so a write that's cut short never loses the last good schema.
+func writeCachedSchema(path string, data []byte) {
+	if path == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return
+	}
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return
+	}
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(temp.Name(), 0o644)
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(temp.Name())
+	}
+}
+
+// loadPersistedSchema caches the schema an earlier run fetched for a plugin, however old, so
+// looking it up doesn't wait on a download or fail while GitHub is unreachable. It expires as
+// though it had been fetched when it was written, so an old copy is refreshed like any other.
+func (r *Registry) loadPersistedSchema(pluginName string) (*CachedPluginSchema, bool) {
+	r.mu.RLock()
+	ref := resolveAlias(r.aliases, pluginName)
+	generation := r.generation
+	r.mu.RUnlock()
+
+	parsed := ParsePluginReference(ref)
+	if parsed == nil || !parsed.IsGitHub() {
+		return nil, false
+	}
+	data, age, exists := readCachedSchema(r.schemaCachePath(parsed))
+	if !exists {
+		return nil, false
+	}
+	schema, err := parsePluginSchema(data)
+	if err != nil {
+		return nil, false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if generation != r.generation {
+		// The aliases changed while reading, so the copy may be for the wrong plugin
+		return nil, false
+	}
+	if cached, exists := r.plugins[pluginName]; exists {
+		return cached, true
+	}
+	cachedAt := time.Now().Add(-age)
+	cached := &CachedPluginSchema{Schema: schema, CachedAt: cachedAt, ExpiresAt: r.expiry(cachedAt)}
+	r.plugins[pluginName] = cached
+	return cached, true
+}
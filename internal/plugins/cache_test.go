@@ -0,0 +1,97 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testPluginYAML = `name: Docker
+configuration:
+  properties:
+    image:
+      type: string
+`
+
+// newTestDiskRegistry creates a registry caching schemas in a temporary directory, counting downloads
+func newTestDiskRegistry(t *testing.T, data string, err error) (*Registry, *int) {
+	t.Helper()
+	registry := NewRegistryWithTTL(time.Hour)
+	registry.SetSchemaCacheDir(t.TempDir())
+	downloads := 0
+	registry.download = func(ctx context.Context, url string) ([]byte, error) {
+		downloads++
+		return []byte(data), err
+	}
+	return registry, &downloads
+}
+
+func TestRegistry_DiskCache_StoresDownloads(t *testing.T) {
+	registry, downloads := newTestDiskRegistry(t, testPluginYAML, nil)
+
+	if _, err := registry.fetchPluginSchema(context.Background(), "docker#v5.13.0", "docker#v5.13.0"); err != nil {
+		t.Fatalf("fetchPluginSchema failed: %v", err)
+	}
+	path := registry.schemaCachePath(ParsePluginReference("docker#v5.13.0"))
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("Expected the schema to be cached at %s: %v", path, err)
+	}
+
+	// A fresh registry sharing the directory reads the cached copy instead of downloading
+	second, secondDownloads := newTestDiskRegistry(t, "", errors.New("offline"))
+	second.SetSchemaCacheDir(filepath.Dir(filepath.Dir(path)))
+	schema, err := second.fetchPluginSchema(context.Background(), "docker#v5.13.0", "docker#v5.13.0")
+	if err != nil {
+		t.Fatalf("Expected the cached schema, got %v", err)
+	}
+	if schema.Name != "Docker" || schema.SchemaData == nil {
+		t.Errorf("Expected the cached schema to be parsed, got %+v", schema)
+	}
+	if *downloads != 1 || *secondDownloads != 0 {
+		t.Errorf("Expected 1 download, got %d and %d", *downloads, *secondDownloads)
+	}
+}
+
+func TestRegistry_DiskCache_StaleCopyUsedWhenOffline(t *testing.T) {
+	registry, downloads := newTestDiskRegistry(t, "", errors.New("offline"))
+
+	path := registry.schemaCachePath(ParsePluginReference("docker#v5.13.0"))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(testPluginYAML), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	schema, err := registry.fetchPluginSchema(context.Background(), "docker#v5.13.0", "docker#v5.13.0")
+	if err != nil || schema.Name != "Docker" {
+		t.Fatalf("Expected the stale cached schema, got %+v, %v", schema, err)
+	}
+	if *downloads == 0 {
+		t.Error("Expected a stale copy to be refreshed before falling back to it")
+	}
+}
+
+func TestClearCache(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "buildkite-ls")
+	if err := os.MkdirAll(filepath.Join(dir, "plugin-schemas"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ClearCache(dir); err != nil {
+		t.Fatalf("ClearCache failed: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be removed, got %v", dir, err)
+	}
+	if err := ClearCache(dir); err != nil {
+		t.Errorf("Expected clearing a missing cache to succeed, got %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package plugins
+
+import (
+	"regexp"
+	"slices"
+)
+
+// subschemaKeys hold a single schema
+var subschemaKeys = []string{"additionalProperties", "additionalItems", "items", "not", "if", "then", "else", "contains", "propertyNames"}
+
+// subschemaListKeys hold a list of schemas
+var subschemaListKeys = []string{"allOf", "anyOf", "oneOf", "items"}
+
+// subschemaMapKeys hold schemas by name
+var subschemaMapKeys = []string{"properties", "patternProperties", "definitions", "$defs", "dependencies"}
+
+// normalizeSchema rewrites a plugin's configuration schema into the draft-07 form gojsonschema
+// validates reliably. Plugin schemas are written against whatever draft their authors knew,
+// and gojsonschema rejects or skips several constructs from the drafts either side:
+//
+//   - `$schema` is dropped, so if/then/else and the other draft-07 keywords apply even when
+//     the schema claims an older draft
+//   - draft-03 `required: true` on a property moves into its parent's `required` list
+//   - OpenAPI `nullable: true` adds "null" to the property's types
+//   - 2019-09 `dependentRequired` and `dependentSchemas` become `dependencies`
+//   - 2020-12 `prefixItems` becomes a list of `items`, and its `items` becomes `additionalItems`
+//   - `pattern` and `patternProperties` regular expressions Go can't compile, such as those
+//     with lookarounds, are dropped, along with `additionalProperties: false` next to them
+//
+// The schema is modified in place and returned.
+func normalizeSchema(schema map[string]any) map[string]any {
+	delete(schema, "$schema")
+	normalizeSubschema(schema)
+	return schema
+}
+
+// normalizeSubschema normalizes a schema and everything nested in it
+func normalizeSubschema(schema map[string]any) {
+	// A required flag outside properties has no parent to move to
+	if _, ok := schema["required"].(bool); ok {
+		delete(schema, "required")
+	}
+	moveRequiredFlags(schema)
+	normalizeNullable(schema)
+	normalizeDependencies(schema)
+	normalizePrefixItems(schema)
+	dropUncompilablePatterns(schema)
+
+	for _, key := range subschemaKeys {
+		if nested, ok := schema[key].(map[string]any); ok {
+			normalizeSubschema(nested)
+		}
+	}
+	for _, key := range subschemaListKeys {
+		if list, ok := schema[key].([]any); ok {
+			for _, item := range list {
+				if nested, ok := item.(map[string]any); ok {
+					normalizeSubschema(nested)
+				}
+			}
+		}
+	}
+	for _, key := range subschemaMapKeys {
+		if named, ok := schema[key].(map[string]any); ok {
+			for _, item := range named {
+				if nested, ok := item.(map[string]any); ok {
+					normalizeSubschema(nested)
+				}
+			}
+		}
+	}
+}
+
+// moveRequiredFlags turns `required: true` on properties into the parent's required list
+func moveRequiredFlags(schema map[string]any) {
+	properties, ok := schema["properties"].(map[string]any)
+	if !ok {
+		return
+	}
+
+	// Sorted so the required list comes out the same every time
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		property, ok := properties[name].(map[string]any)
+		if !ok {
+			continue
+		}
+		flag, ok := property["required"].(bool)
+		if !ok {
+			continue
+		}
+		delete(property, "required")
+		if !flag {
+			continue
+		}
+
+		required, _ := schema["required"].([]any)
+		if !slices.Contains(required, any(name)) {
+			schema["required"] = append(required, name)
+		}
+	}
+}
+
+// normalizeNullable turns OpenAPI's `nullable: true` into a "null" type
+func normalizeNullable(schema map[string]any) {
+	nullable, ok := schema["nullable"].(bool)
+	if !ok {
+		return
+	}
+	delete(schema, "nullable")
+	if !nullable {
+		return
+	}
+
+	switch types := schema["type"].(type) {
+	case string:
+		schema["type"] = []any{types, "null"}
+	case []any:
+		if !slices.Contains(types, any("null")) {
+			schema["type"] = append(types, "null")
+		}
+	}
+}
+
+// normalizeDependencies merges dependentRequired and dependentSchemas into dependencies
+func normalizeDependencies(schema map[string]any) {
+	for _, key := range []string{"dependentRequired", "dependentSchemas"} {
+		dependent, ok := schema[key].(map[string]any)
+		if !ok {
+			continue
+		}
+		delete(schema, key)
+
+		dependencies, ok := schema["dependencies"].(map[string]any)
+		if !ok {
+			dependencies = make(map[string]any)
+			schema["dependencies"] = dependencies
+		}
+		for name, dependency := range dependent {
+			if _, exists := dependencies[name]; !exists {
+				dependencies[name] = dependency
+			}
+		}
+	}
+}
+
+// normalizePrefixItems turns 2020-12 tuple validation into the draft-07 form
+func normalizePrefixItems(schema map[string]any) {
+	prefixItems, ok := schema["prefixItems"].([]any)
+	if !ok {
+		return
+	}
+	delete(schema, "prefixItems")
+
+	if rest, ok := schema["items"]; ok {
+		schema["additionalItems"] = rest
+	}
+	schema["items"] = prefixItems
+}
+
+// dropUncompilablePatterns removes the regular expressions gojsonschema would fail to compile,
+// which would otherwise fail the whole schema
+func dropUncompilablePatterns(schema map[string]any) {
+	if pattern, ok := schema["pattern"].(string); ok {
+		if _, err := regexp.Compile(pattern); err != nil {
+			delete(schema, "pattern")
+		}
+	}
+
+	patternProperties, ok := schema["patternProperties"].(map[string]any)
+	if !ok {
+		return
+	}
+	dropped := false
+	for pattern := range patternProperties {
+		if _, err := regexp.Compile(pattern); err != nil {
+			delete(patternProperties, pattern)
+			dropped = true
+		}
+	}
+	// The keys the dropped patterns allowed would otherwise be rejected
+	if dropped && schema["additionalProperties"] == false {
+		delete(schema, "additionalProperties")
+	}
+}
@@ -0,0 +1,165 @@
+package plugins
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePluginSchema_Compatibility(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		valid   []string
+		invalid []string
+	}{
+		{
+			name: "if/then under an older draft",
+			schema: `
+  $schema: http://json-schema.org/draft-04/schema#
+  type: object
+  properties:
+    push:
+      type: boolean
+    image:
+      type: string
+  if:
+    properties:
+      push:
+        const: true
+    required: [push]
+  then:
+    required: [image]`,
+			valid:   []string{`{"push": false}`, `{"push": true, "image": "app"}`},
+			invalid: []string{`{"push": true}`},
+		},
+		{
+			name: "draft-03 required flags",
+			schema: `
+  type: object
+  properties:
+    image:
+      type: string
+      required: true
+    tag:
+      type: string
+      required: false`,
+			valid:   []string{`{"image": "app"}`},
+			invalid: []string{`{"tag": "v1"}`},
+		},
+		{
+			name: "OpenAPI nullable",
+			schema: `
+  type: object
+  properties:
+    region:
+      type: string
+      nullable: true`,
+			valid:   []string{`{"region": null}`, `{"region": "us-east-1"}`},
+			invalid: []string{`{"region": 1}`},
+		},
+		{
+			name: "2019-09 dependent keywords",
+			schema: `
+  $schema: https://json-schema.org/draft/2019-09/schema
+  type: object
+  dependentRequired:
+    username: [password]
+  dependentSchemas:
+    tls:
+      required: [certificate]`,
+			valid:   []string{`{}`, `{"username": "u", "password": "p"}`},
+			invalid: []string{`{"username": "u"}`, `{"tls": true}`},
+		},
+		{
+			name: "2020-12 prefixItems",
+			schema: `
+  type: object
+  properties:
+    ports:
+      type: array
+      prefixItems:
+        - type: integer
+        - type: string
+      items: false`,
+			valid:   []string{`{"ports": [80, "http"]}`},
+			invalid: []string{`{"ports": ["http"]}`, `{"ports": [80, "http", "extra"]}`},
+		},
+		{
+			name: "patterns Go can't compile",
+			schema: `
+  type: object
+  properties:
+    name:
+      type: string
+      pattern: "^(?!-)[a-z-]+$"
+  patternProperties:
+    "^(?=x-)": {}
+    "^name$": {}
+  additionalProperties: false`,
+			valid:   []string{`{"name": "app"}`, `{"x-extra": 1}`},
+			invalid: []string{`{"name": 1}`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := parsePluginSchema([]byte("name: test\nconfiguration:" + tt.schema))
+			if err != nil {
+				t.Fatalf("Failed to parse schema: %v", err)
+			}
+			if schema.SchemaErr != nil || schema.SchemaData == nil {
+				t.Fatalf("Expected a usable schema, got %v", schema.SchemaErr)
+			}
+			for _, config := range tt.valid {
+				if err := validateConfigJSON("test", schema.SchemaData, []byte(config)); err != nil {
+					t.Errorf("Expected %s to be valid, got %v", config, err)
+				}
+			}
+			for _, config := range tt.invalid {
+				if err := validateConfigJSON("test", schema.SchemaData, []byte(config)); err == nil {
+					t.Errorf("Expected %s to be invalid", config)
+				}
+			}
+		})
+	}
+}
+
+func TestParsePluginSchema_Unsupported(t *testing.T) {
+	schema, err := parsePluginSchema([]byte(`name: test
+configuration:
+  type: object
+  properties:
+    image:
+      $ref: "#/definitions/missing"`))
+	if err != nil {
+		t.Fatalf("Failed to parse schema: %v", err)
+	}
+	if schema.SchemaData != nil {
+		t.Errorf("Expected a schema that doesn't compile not to be used")
+	}
+	if schema.SchemaErr == nil || !strings.Contains(schema.SchemaErr.Error(), "unsupported configuration schema") {
+		t.Errorf("Expected the reason to be kept, got %v", schema.SchemaErr)
+	}
+
+	registry := NewRegistry()
+	registry.CacheSchema("test", schema)
+	if err := registry.ValidatePluginConfig("test", map[string]interface{}{"image": 1}); err != nil {
+		t.Errorf("Expected configs not to be validated against an unsupported schema, got %v", err)
+	}
+}
+
+func TestNormalizeSchema_RequiredOrder(t *testing.T) {
+	schema := normalizeSchema(map[string]any{
+		"required": []any{"image"},
+		"properties": map[string]any{
+			"tag":   map[string]any{"required": true},
+			"image": map[string]any{"required": true},
+			"build": map[string]any{"required": true},
+		},
+	})
+
+	required, _ := schema["required"].([]any)
+	if len(required) != 3 || required[0] != "image" || required[1] != "build" || required[2] != "tag" {
+		t.Errorf("Expected existing required keys first, then flagged ones in name order, got %v", required)
+	}
+}
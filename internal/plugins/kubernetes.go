@@ -0,0 +1,28 @@
+package plugins
+
+import "strings"
+
+// KubernetesPluginName is the plugin handled by the Buildkite Agent Stack for Kubernetes.
+// It has no plugin repository; its config embeds raw Kubernetes podSpec YAML.
+const KubernetesPluginName = "kubernetes"
+
+// kubernetesPluginSchema describes the kubernetes plugin without fetching anything
+var kubernetesPluginSchema = &PluginSchema{
+	Name:        "Kubernetes",
+	Description: "Runs the step as a Kubernetes Job using the Buildkite Agent Stack for Kubernetes. The `podSpec` (or `podSpecPatch`) key holds a standard Kubernetes PodSpec.",
+	Author:      "Buildkite",
+	Requirements: []string{
+		"agent-stack-k8s controller",
+	},
+}
+
+// IsKubernetesPlugin reports whether a plugin reference refers to the kubernetes plugin
+func IsKubernetesPlugin(ref string) bool {
+	name, _, _ := strings.Cut(ref, "#")
+	return strings.Trim(name, `"'`) == KubernetesPluginName
+}
+
+// IsPodSpecKey reports whether a kubernetes plugin config key holds raw Kubernetes YAML
+func IsPodSpecKey(key string) bool {
+	return key == "podSpec" || key == "podSpecPatch"
+}
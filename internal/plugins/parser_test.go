@@ -101,6 +101,76 @@ func TestParsePluginReference(t *testing.T) {
 	}
 }
 
+func TestParsePluginReference_Sources(t *testing.T) {
+	tests := []struct {
+		input      string
+		org        string
+		name       string
+		version    string
+		host       string
+		path       string
+		repository string
+	}{
+		{"ssh://git@gitlab.example.com/ci/deploy.git#v1.0", "ci", "deploy", "v1.0", "gitlab.example.com", "", "https://gitlab.example.com/ci/deploy"},
+		{"git@github.com:my-org/deploy-buildkite-plugin.git#v2.1.0", "my-org", "deploy", "v2.1.0", "", "", "https://github.com/my-org/deploy-buildkite-plugin"},
+		{"https://github.com/my-org/tools.git#main", "my-org", "tools", "main", "", "", "https://github.com/my-org/tools"},
+		{"github.com/my-org/deploy-buildkite-plugin#v1", "my-org", "deploy", "v1", "", "", "https://github.com/my-org/deploy-buildkite-plugin"},
+		{"my.plugin#v1.2.3", "buildkite-plugins", "my.plugin", "v1.2.3", "", "", "https://github.com/buildkite-plugins/my.plugin-buildkite-plugin"},
+		{"./.buildkite/plugins/deploy", "", "deploy", "latest", "", "./.buildkite/plugins/deploy", "./.buildkite/plugins/deploy"},
+		{"file:///opt/plugins/deploy-buildkite-plugin#v3", "", "deploy", "v3", "", "/opt/plugins/deploy-buildkite-plugin", "/opt/plugins/deploy-buildkite-plugin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			parsed := ParsePluginReference(tt.input)
+			if parsed == nil {
+				t.Fatal("Expected the reference to parse")
+			}
+			if parsed.Org != tt.org || parsed.Name != tt.name || parsed.Version != tt.version || parsed.Host != tt.host || parsed.Path != tt.path {
+				t.Errorf("Expected %s/%s#%s on %q at %q, got %+v", tt.org, tt.name, tt.version, tt.host, tt.path, parsed)
+			}
+			if got := parsed.GetRepositoryURL(); got != tt.repository {
+				t.Errorf("Expected repository %s, got %s", tt.repository, got)
+			}
+			if parsed.IsGitHub() != (len(parsed.GetAllSchemaURLs()) > 0) {
+				t.Errorf("Expected schema URLs only for GitHub plugins, got %v", parsed.GetAllSchemaURLs())
+			}
+		})
+	}
+
+	github := ParsePluginReference("https://github.com/my-org/tools.git#main")
+	if url := github.GetSchemaURL(); url != "https://raw.githubusercontent.com/my-org/tools/main/plugin.yml" {
+		t.Errorf("Expected the schema URL to use the repository name, got %s", url)
+	}
+
+	for _, invalid := range []string{"#v1", "ssh://#v1", "/#v1.0"} {
+		if parsed := ParsePluginReference(invalid); parsed != nil && parsed.Path == "" {
+			t.Errorf("Expected %q not to parse, got %+v", invalid, parsed)
+		}
+	}
+}
+
+func TestIsPluginReference(t *testing.T) {
+	tests := map[string]bool{
+		"docker#v5.13.0":                     true,
+		"my.plugin#v1":                       true,
+		"ssh://git@host/repo#v1.0":           true,
+		"git@github.com:org/repo.git":        true,
+		"./.buildkite/plugins/deploy":        true,
+		"file:///opt/plugins/deploy":         true,
+		"docker":                             false,
+		"timeout_in_minutes":                 false,
+		"echo foo#bar":                       false,
+		"docker#":                            false,
+		"https://example.com/hook with text": false,
+	}
+	for text, expected := range tests {
+		if got := IsPluginReference(text); got != expected {
+			t.Errorf("IsPluginReference(%q) = %t, expected %t", text, got, expected)
+		}
+	}
+}
+
 func TestParsedPluginRef_GetRepositoryURL(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -160,3 +230,25 @@ func TestParsedPluginRef_GetAllSchemaURLs(t *testing.T) {
 		}
 	}
 }
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"v5.13.0", "v5.13.0", 0},
+		{"v5.2.0", "v5.13.0", -1},
+		{"v5.13.1", "v5.13.0", 1},
+		{"v5.13", "v5.13.0", 0},
+		{"v5.14", "v5.13.2", 1},
+		{"5.13.0", "v5.13.0", 0},
+		{"v2.0.0-beta", "v2.0.0", -1},
+		{"v2.0.0-beta", "v2.0.0-alpha", 1},
+	}
+
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.expected {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.expected)
+		}
+	}
+}
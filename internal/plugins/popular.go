@@ -0,0 +1,229 @@
+package plugins
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// PopularPluginsURL is where the popular plugins manifest is published. The bundled copy in
+// popular.json is the manifest as of the release.
+const PopularPluginsURL = "https://raw.githubusercontent.com/mcncl/buildkite-ls/main/internal/plugins/popular.json"
+
+//go:embed popular.json
+var bundledPopularManifest []byte
+
+// PopularPlugin represents a commonly used plugin with its latest version
+type PopularPlugin struct {
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+}
+
+// PopularManifest lists the most commonly used plugins and their latest versions
+type PopularManifest struct {
+	UpdatedAt string          `json:"updatedAt"`
+	Plugins   []PopularPlugin `json:"plugins"`
+}
+
+// parsePopularManifest reads a manifest, rejecting one without usable plugins
+func parsePopularManifest(data []byte) (*PopularManifest, error) {
+	var manifest PopularManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid popular plugins manifest: %w", err)
+	}
+	if len(manifest.Plugins) == 0 {
+		return nil, fmt.Errorf("popular plugins manifest lists no plugins")
+	}
+	for _, plugin := range manifest.Plugins {
+		if plugin.Name == "" || plugin.Version == "" {
+			return nil, fmt.Errorf("popular plugins manifest has a plugin without a name or version")
+		}
+	}
+	return &manifest, nil
+}
+
+// bundledPopular is the manifest built into the binary
+var bundledPopular = func() *PopularManifest {
+	manifest, err := parsePopularManifest(bundledPopularManifest)
+	if err != nil {
+		panic(err)
+	}
+	return manifest
+}()
+
+// GetPopularPlugins returns the most commonly used Buildkite plugins from the bundled manifest
+func GetPopularPlugins() []PopularPlugin {
+	return append([]PopularPlugin(nil), bundledPopular.Plugins...)
+}
+
+// PopularChannel serves the popular plugins manifest, keeping it current by fetching the
+// published copy and caching it on disk between runs. Until a newer manifest is found, or
+// when pinned, it serves the bundled one.
+type PopularChannel struct {
+	mu        sync.RWMutex
+	manifest  *PopularManifest
+	pinned    bool
+	cachePath string        // Where fetched manifests are cached; empty disables the disk cache
+	maxAge    time.Duration // How old the cache can get before the manifest is fetched again
+
+	// fetch retrieves the published manifest
+	fetch func() ([]byte, error)
+}
+
+// NewPopularChannel creates a channel caching the manifest at cachePath
+func NewPopularChannel(cachePath string, maxAge time.Duration) *PopularChannel {
+	return &PopularChannel{
+		manifest:  bundledPopular,
+		cachePath: cachePath,
+		maxAge:    maxAge,
+		fetch:     fetchPopularManifest,
+	}
+}
+
+// DefaultPopularCachePath is where the manifest is cached in the user's cache directory,
+// or "" when there isn't one
+func DefaultPopularCachePath() string {
+	dir := CacheDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "popular-plugins.json")
+}
+
+// Plugins returns the popular plugins of the current manifest
+func (c *PopularChannel) Plugins() []PopularPlugin {
+	return append([]PopularPlugin(nil), c.Manifest().Plugins...)
+}
+
+// Manifest returns the manifest being served
+func (c *PopularChannel) Manifest() *PopularManifest {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.pinned {
+		return bundledPopular
+	}
+	return c.manifest
+}
+
+// SetPinned serves the bundled manifest regardless of what has been fetched
+func (c *PopularChannel) SetPinned(pinned bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pinned = pinned
+}
+
+// Refresh loads the cached manifest, and fetches the published one when the cache is
+// missing or older than the maximum age. A failed fetch keeps the manifest already served.
+func (c *PopularChannel) Refresh() error {
+	c.mu.RLock()
+	pinned := c.pinned
+	c.mu.RUnlock()
+	if pinned {
+		return nil
+	}
+
+	if c.loadCache() {
+		return nil
+	}
+
+	data, err := c.fetch()
+	if err != nil {
+		return fmt.Errorf("failed to fetch popular plugins manifest: %w", err)
+	}
+	manifest, err := parsePopularManifest(data)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.manifest = manifest
+	c.mu.Unlock()
+
+	return c.writeCache(data)
+}
+
+// RefreshEvery refreshes the manifest now and then at every interval, reporting failures to
+// onError. Calling the returned function stops it.
+func (c *PopularChannel) RefreshEvery(interval time.Duration, onError func(error)) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := c.Refresh(); err != nil {
+				onError(err)
+			}
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// loadCache serves the cached manifest if there is one, reporting whether it is fresh
+// enough to skip fetching
+func (c *PopularChannel) loadCache() bool {
+	if c.cachePath == "" {
+		return false
+	}
+
+	info, err := os.Stat(c.cachePath)
+	if err != nil {
+		return false
+	}
+	data, err := os.ReadFile(c.cachePath)
+	if err != nil {
+		return false
+	}
+	manifest, err := parsePopularManifest(data)
+	if err != nil {
+		return false
+	}
+
+	c.mu.Lock()
+	c.manifest = manifest
+	c.mu.Unlock()
+
+	return time.Since(info.ModTime()) < c.maxAge
+}
+
+// writeCache stores a fetched manifest for the next run
+func (c *PopularChannel) writeCache(data []byte) error {
+	if c.cachePath == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(c.cachePath), 0o755); err != nil {
+		return fmt.Errorf("failed to cache popular plugins manifest: %w", err)
+	}
+	if err := os.WriteFile(c.cachePath, data, 0o644); err != nil {
+		return fmt.Errorf("failed to cache popular plugins manifest: %w", err)
+	}
+	return nil
+}
+
+// fetchPopularManifest downloads the published manifest
+func fetchPopularManifest() ([]byte, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(PopularPluginsURL)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d from %s", resp.StatusCode, PopularPluginsURL)
+	}
+	return io.ReadAll(resp.Body)
+}
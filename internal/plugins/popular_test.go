@@ -0,0 +1,128 @@
+package plugins
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testPopularManifest = `{"updatedAt": "2030-01-01", "plugins": [{"name": "docker", "version": "v9.0.0", "description": "Run steps in Docker"}]}`
+
+// newTestPopularChannel creates a channel caching in a temporary directory, counting fetches
+func newTestPopularChannel(t *testing.T, data string, err error) (*PopularChannel, *int) {
+	t.Helper()
+	channel := NewPopularChannel(filepath.Join(t.TempDir(), "popular-plugins.json"), time.Hour)
+	fetches := 0
+	channel.fetch = func() ([]byte, error) {
+		fetches++
+		return []byte(data), err
+	}
+	return channel, &fetches
+}
+
+func TestBundledPopularManifest(t *testing.T) {
+	if bundledPopular.UpdatedAt == "" {
+		t.Error("Expected the bundled manifest to record when it was updated")
+	}
+	if len(GetPopularPlugins()) != len(bundledPopular.Plugins) {
+		t.Error("Expected GetPopularPlugins to return the bundled plugins")
+	}
+}
+
+func TestParsePopularManifest_Invalid(t *testing.T) {
+	for _, data := range []string{
+		`not json`,
+		`{"plugins": []}`,
+		`{"plugins": [{"name": "docker"}]}`,
+	} {
+		if _, err := parsePopularManifest([]byte(data)); err == nil {
+			t.Errorf("Expected %s to be rejected", data)
+		}
+	}
+}
+
+func TestPopularChannel_Refresh(t *testing.T) {
+	channel, fetches := newTestPopularChannel(t, testPopularManifest, nil)
+
+	if channel.Manifest() != bundledPopular {
+		t.Fatal("Expected the bundled manifest before refreshing")
+	}
+	if err := channel.Refresh(); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+
+	plugins := channel.Plugins()
+	if len(plugins) != 1 || plugins[0].Version != "v9.0.0" {
+		t.Errorf("Expected the fetched manifest, got %+v", plugins)
+	}
+	if _, err := os.Stat(channel.cachePath); err != nil {
+		t.Errorf("Expected the fetched manifest to be cached: %v", err)
+	}
+
+	// A fresh cache is used as is
+	if err := channel.Refresh(); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if *fetches != 1 {
+		t.Errorf("Expected a fresh cache to skip fetching, fetched %d times", *fetches)
+	}
+}
+
+func TestPopularChannel_StaleCache(t *testing.T) {
+	channel, fetches := newTestPopularChannel(t, testPopularManifest, nil)
+	if err := os.WriteFile(channel.cachePath, []byte(testPopularManifest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stale := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(channel.cachePath, stale, stale); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := channel.Refresh(); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if *fetches != 1 {
+		t.Errorf("Expected a stale cache to be fetched again, fetched %d times", *fetches)
+	}
+}
+
+func TestPopularChannel_FailedFetch(t *testing.T) {
+	channel, _ := newTestPopularChannel(t, "", errors.New("offline"))
+
+	if err := channel.Refresh(); err == nil {
+		t.Error("Expected the failed fetch to be reported")
+	}
+	if channel.Manifest() != bundledPopular {
+		t.Error("Expected a failed fetch to keep the bundled manifest")
+	}
+
+	channel, _ = newTestPopularChannel(t, `{"plugins": []}`, nil)
+	if err := channel.Refresh(); err == nil {
+		t.Error("Expected an invalid manifest to be reported")
+	}
+	if channel.Manifest() != bundledPopular {
+		t.Error("Expected an invalid manifest to keep the bundled manifest")
+	}
+}
+
+func TestPopularChannel_Pinned(t *testing.T) {
+	channel, fetches := newTestPopularChannel(t, testPopularManifest, nil)
+	if err := channel.Refresh(); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+
+	channel.SetPinned(true)
+	if channel.Manifest() != bundledPopular {
+		t.Error("Expected a pinned channel to serve the bundled manifest")
+	}
+	if err := channel.Refresh(); err != nil || *fetches != 1 {
+		t.Errorf("Expected a pinned channel not to fetch, got %v after %d fetches", err, *fetches)
+	}
+
+	channel.SetPinned(false)
+	if channel.Plugins()[0].Version != "v9.0.0" {
+		t.Error("Expected unpinning to serve the fetched manifest again")
+	}
+}
@@ -0,0 +1,90 @@
+package plugins
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// expiryJitterDivisor spreads expiries over a slice of the TTL: a schema expires up to
+// TTL/expiryJitterDivisor after the TTL, so schemas cached together don't expire together
+const expiryJitterDivisor = 10
+
+// expiry is when a schema cached at the given time expires
+func (r *Registry) expiry(cachedAt time.Time) time.Time {
+	return cachedAt.Add(r.cacheTTL + jitter(r.cacheTTL/expiryJitterDivisor))
+}
+
+// jitter is a random duration from zero up to limit
+func jitter(limit time.Duration) time.Duration {
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(limit)))
+}
+
+// RefreshEvery looks for expired schemas at every interval and fetches fresh copies in the
+// background, each after a random delay within the interval so they aren't all fetched at
+// once. While it runs, lookups of an expired schema return it without fetching anything.
+// A failed refresh keeps the expired schema, so editing is never held up by GitHub being
+// unreachable. Calling the returned function stops it.
+func (r *Registry) RefreshEvery(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+
+	r.mu.Lock()
+	r.refreshers++
+	r.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			for _, pluginName := range r.expiredSchemas() {
+				time.AfterFunc(jitter(interval), func() {
+					select {
+					case <-done:
+					default:
+						r.refreshPluginSchema(pluginName)
+					}
+				})
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			r.mu.Lock()
+			r.refreshers--
+			r.mu.Unlock()
+		})
+	}
+}
+
+// expiredSchemas lists the plugins whose cached schemas have expired
+func (r *Registry) expiredSchemas() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var expired []string
+	for pluginName, cached := range r.plugins {
+		if cached.IsExpired() {
+			expired = append(expired, pluginName)
+		}
+	}
+	return expired
+}
+
+// refreshesInBackground reports whether RefreshEvery is keeping the cache current, so
+// lookups needn't refresh expired schemas themselves
+func (r *Registry) refreshesInBackground() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.refreshers > 0
+}
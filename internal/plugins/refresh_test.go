@@ -0,0 +1,117 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRegistry_ExpiryJitter(t *testing.T) {
+	registry := NewRegistryWithTTL(time.Hour)
+
+	now := time.Now()
+	spread := make(map[time.Time]bool)
+	for range 20 {
+		expiry := registry.expiry(now)
+		if expiry.Before(now.Add(time.Hour)) || expiry.After(now.Add(time.Hour+time.Hour/expiryJitterDivisor)) {
+			t.Fatalf("Expected an expiry within a tenth of the TTL after it, got %v", expiry.Sub(now))
+		}
+		spread[expiry] = true
+	}
+	if len(spread) < 2 {
+		t.Error("Expected expiries to be spread out")
+	}
+}
+
+func TestRegistry_RefreshEvery(t *testing.T) {
+	registry := NewRegistry()
+	var fetches atomic.Int32
+	registry.fetch = func(ctx context.Context, pluginName, ref string) (*PluginSchema, error) {
+		fetches.Add(1)
+		return &PluginSchema{Name: "Fresh"}, nil
+	}
+	registry.CacheSchema("docker#v5.13.0", &PluginSchema{Name: "Stale"})
+	registry.plugins["docker#v5.13.0"].ExpiresAt = time.Now().Add(-time.Minute)
+
+	stop := registry.RefreshEvery(10 * time.Millisecond)
+	defer stop()
+
+	// Lookups leave the refresh to the background
+	schema, err := registry.GetPluginSchema(context.Background(), "docker#v5.13.0")
+	if err != nil || schema.Name != "Stale" {
+		t.Fatalf("Expected the stale schema, got %+v, %v", schema, err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for registry.CachedStatus("docker#v5.13.0", nil).Schema.Name != "Fresh" {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the expired schema to be refreshed in the background")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if fetches.Load() != 1 {
+		t.Errorf("Expected a single refresh, got %d fetches", fetches.Load())
+	}
+
+	stop()
+	if registry.refreshesInBackground() {
+		t.Error("Expected lookups to refresh expired schemas themselves once stopped")
+	}
+}
+
+func TestRegistry_PersistedSchemaServedOffline(t *testing.T) {
+	registry, downloads := newTestDiskRegistry(t, "", errors.New("offline"))
+	path := registry.schemaCachePath(ParsePluginReference("docker#v5.13.0"))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(testPluginYAML), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := registry.RefreshEvery(time.Hour)
+	defer stop()
+
+	// The last good copy is served at once, and left to the background refresh
+	schema, err := registry.GetPluginSchema(context.Background(), "docker#v5.13.0")
+	if err != nil || schema.Name != "Docker" {
+		t.Fatalf("Expected the persisted schema, got %+v, %v", schema, err)
+	}
+	if status := registry.CachedStatus("docker#v5.13.0", nil); !status.Expired {
+		t.Error("Expected the old copy to be due a refresh")
+	}
+	if *downloads != 0 {
+		t.Errorf("Expected no download during the lookup, got %d", *downloads)
+	}
+
+	// Filling the cache fetches anyway, and falls back to the copy when offline
+	if _, err := registry.FetchPluginSchema(context.Background(), "docker#v5.13.0"); err != nil {
+		t.Fatalf("Expected the persisted schema, got %v", err)
+	}
+	if *downloads == 0 {
+		t.Error("Expected FetchPluginSchema to download")
+	}
+}
+
+func TestWriteCachedSchema_KeepsLastGoodCopy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "buildkite-plugins", "docker@v5.13.0.yml")
+	writeCachedSchema(path, []byte(testPluginYAML))
+	writeCachedSchema(path, []byte("name: Docker v2\n"))
+
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "name: Docker v2\n" {
+		t.Fatalf("Expected the copy to be replaced, got %q, %v", data, err)
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil || len(entries) != 1 {
+		t.Errorf("Expected no temporary files left behind, got %v", entries)
+	}
+}
@@ -1,10 +1,17 @@
 package plugins
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
+	"net/url"
+	"path"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -13,30 +20,6 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-// PopularPlugin represents a commonly used plugin with its latest version
-type PopularPlugin struct {
-	Name        string
-	Version     string
-	Description string
-}
-
-// GetPopularPlugins returns a list of the most commonly used Buildkite plugins
-func GetPopularPlugins() []PopularPlugin {
-	return []PopularPlugin{
-		{"docker", "v5.13.0", "Run build steps in Docker containers"},
-		{"docker-compose", "v5.10.0", "Run build steps with Docker Compose"},
-		{"cache", "v1.7.0", "Cache files between builds"},
-		{"artifacts", "v1.9.4", "Upload and download build artifacts"},
-		{"test-collector", "v1.11.0", "Collect and analyze test results"},
-		{"junit-annotate", "v2.7.0", "Annotate builds with JUnit test results"},
-		{"shellcheck", "v1.4.0", "Run ShellCheck on shell scripts"},
-		{"ecr", "v2.10.0", "Build and push Docker images to AWS ECR"},
-		{"monorepo-diff", "v1.5.1", "Skip builds for unchanged parts of monorepos"},
-		{"plugin-linter", "v3.3.0", "Lint Buildkite plugins"},
-		{"docker-login", "v3.0.0", "Log in to Docker registries"},
-	}
-}
-
 type PluginSchema struct {
 	Name          string         `yaml:"name"`
 	Description   string         `yaml:"description"`
@@ -44,6 +27,66 @@ type PluginSchema struct {
 	Requirements  []string       `yaml:"requirements"`
 	Configuration map[string]any `yaml:"configuration"`
 	SchemaData    []byte
+	// SchemaErr explains why a configuration schema couldn't be used, in which case
+	// SchemaData is nil and the plugin's configuration isn't validated
+	SchemaErr error
+}
+
+// RequiredProperties returns the configuration keys the schema marks as required, in schema order
+func (s *PluginSchema) RequiredProperties() []string {
+	if s == nil || s.Configuration == nil {
+		return nil
+	}
+
+	required, _ := s.Configuration["required"].([]interface{})
+	names := make([]string, 0, len(required))
+	for _, item := range required {
+		if name, ok := item.(string); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// RequirementGroup is a oneOf or anyOf list of alternatives, each naming the configuration
+// keys it requires together
+type RequirementGroup struct {
+	// Keyword is "oneOf" or "anyOf"
+	Keyword      string
+	Alternatives [][]string
+}
+
+// RequirementGroups returns the oneOf and anyOf groups of the configuration whose alternatives
+// require keys, in schema order. Alternatives that don't require anything are dropped.
+func (s *PluginSchema) RequirementGroups() []RequirementGroup {
+	if s == nil || s.Configuration == nil {
+		return nil
+	}
+
+	var groups []RequirementGroup
+	for _, keyword := range []string{"oneOf", "anyOf"} {
+		alternatives, _ := s.Configuration[keyword].([]interface{})
+
+		group := RequirementGroup{Keyword: keyword}
+		for _, alternative := range alternatives {
+			alternativeMap, _ := alternative.(map[string]interface{})
+			required, _ := alternativeMap["required"].([]interface{})
+
+			var names []string
+			for _, item := range required {
+				if name, ok := item.(string); ok {
+					names = append(names, name)
+				}
+			}
+			if len(names) > 0 {
+				group.Alternatives = append(group.Alternatives, names)
+			}
+		}
+		if len(group.Alternatives) > 0 {
+			groups = append(groups, group)
+		}
+	}
+	return groups
 }
 
 // CachedPluginSchema wraps a plugin schema with cache metadata
@@ -51,6 +94,15 @@ type CachedPluginSchema struct {
 	Schema    *PluginSchema
 	CachedAt  time.Time
 	ExpiresAt time.Time
+
+	// validations caches validation results keyed by config hash. It lives on
+	// the cache entry so that refreshing or evicting the schema drops them too.
+	validations *validationCache
+}
+
+// validationResult records the outcome of validating a single plugin config
+type validationResult struct {
+	err error
 }
 
 // IsExpired checks if the cached schema has expired
@@ -58,117 +110,400 @@ func (c *CachedPluginSchema) IsExpired() bool {
 	return time.Now().After(c.ExpiresAt)
 }
 
+// refreshRetryDelay is how long an expired schema is served before retrying a failed refresh
+const refreshRetryDelay = time.Minute
+
+// schemaFetch is a schema fetch in flight, shared by every caller asking for the same plugin
+type schemaFetch struct {
+	done   chan struct{}
+	schema *PluginSchema
+	err    error
+	// waiting counts the callers still waiting on the fetch; when the last gives up, cancel
+	// aborts it
+	waiting int
+	cancel  context.CancelFunc
+}
+
 type Registry struct {
 	mu         sync.RWMutex
 	plugins    map[string]*CachedPluginSchema // Cache with expiration
+	inflight   map[string]*schemaFetch        // Fetches in progress, keyed by plugin reference
+	generation int                            // Bumped when aliases change, so in-flight fetches aren't cached
 	cacheTTL   time.Duration                  // How long to cache schemas
 	maxRetries int                            // Maximum retry attempts for failed requests
+	aliases    map[string]string              // Short plugin names mapped to their full references
+	refreshers int                            // Running RefreshEvery loops, which refresh expired schemas
+
+	// schemaCacheDir is where fetched plugin.yml files are kept between runs; empty disables it
+	schemaCacheDir string
+	// download retrieves the body of a URL
+	download func(ctx context.Context, url string) ([]byte, error)
+
+	// fetch retrieves a schema given the plugin reference and its alias-resolved form
+	fetch func(ctx context.Context, pluginName, ref string) (*PluginSchema, error)
+	// onFetchFailure is told about fetches that failed with no cached schema to fall back on
+	onFetchFailure func(pluginName string, err error)
+	// onSchemaStored is told whenever a schema is fetched or cached
+	onSchemaStored func(pluginName string)
 }
 
 func NewRegistry() *Registry {
-	return &Registry{
-		plugins:    make(map[string]*CachedPluginSchema),
-		cacheTTL:   24 * time.Hour,
-		maxRetries: 3,
-	}
+	return NewRegistryWithTTL(24 * time.Hour)
 }
 
 // NewRegistryWithTTL creates a registry with custom cache TTL
 func NewRegistryWithTTL(ttl time.Duration) *Registry {
-	return &Registry{
+	r := &Registry{
 		plugins:    make(map[string]*CachedPluginSchema),
+		inflight:   make(map[string]*schemaFetch),
 		cacheTTL:   ttl,
 		maxRetries: 3,
 	}
+	r.fetch = r.fetchPluginSchema
+	r.download = downloadURL
+	return r
 }
 
-func (r *Registry) GetPluginSchema(pluginName string) (*PluginSchema, error) {
+// GetPluginSchema returns the schema for a plugin reference, fetching it on first use unless
+// an earlier run persisted it. Concurrent callers asking for the same uncached plugin share a
+// single fetch, and an expired schema is returned as-is while a fresh copy is fetched in the
+// background. Cancelling ctx stops waiting for the fetch, and aborts it when no other caller
+// waits on it.
+func (r *Registry) GetPluginSchema(ctx context.Context, pluginName string) (*PluginSchema, error) {
+	// The kubernetes plugin is built into agent-stack-k8s and has no repository to fetch from
+	if IsKubernetesPlugin(pluginName) {
+		return kubernetesPluginSchema, nil
+	}
+
 	r.mu.RLock()
-	if cached, exists := r.plugins[pluginName]; exists {
-		// Check if cache is still valid
-		if !cached.IsExpired() {
-			r.mu.RUnlock()
-			return cached.Schema, nil
+	cached, exists := r.plugins[pluginName]
+	r.mu.RUnlock()
+
+	if !exists {
+		if cached, exists = r.loadPersistedSchema(pluginName); !exists {
+			return r.loadPluginSchema(ctx, pluginName)
+		}
+	}
+
+	if cached.IsExpired() && !r.refreshesInBackground() {
+		r.refreshPluginSchema(pluginName)
+	}
+	return cached.Schema, nil
+}
+
+// FetchPluginSchema returns the schema for a plugin reference like GetPluginSchema, but
+// fetches it rather than serve a copy older than the TTL, e.g. to fill the disk cache
+func (r *Registry) FetchPluginSchema(ctx context.Context, pluginName string) (*PluginSchema, error) {
+	if IsKubernetesPlugin(pluginName) {
+		return kubernetesPluginSchema, nil
+	}
+	return r.loadPluginSchema(ctx, pluginName)
+}
+
+// loadPluginSchema fetches a plugin's schema and caches it, joining any fetch of the
+// same plugin that is already in flight
+func (r *Registry) loadPluginSchema(ctx context.Context, pluginName string) (*PluginSchema, error) {
+	r.mu.Lock()
+	pending, exists := r.inflight[pluginName]
+	if !exists {
+		// The fetch outlives the caller starting it, as long as others are waiting on it
+		fetchCtx, cancel := context.WithCancel(context.Background())
+		pending = &schemaFetch{done: make(chan struct{}), cancel: cancel}
+		r.inflight[pluginName] = pending
+		go r.runFetch(fetchCtx, pluginName, resolveAlias(r.aliases, pluginName), r.generation, pending)
+	}
+	pending.waiting++
+	r.mu.Unlock()
+
+	select {
+	case <-pending.done:
+		return pending.schema, pending.err
+	case <-ctx.Done():
+	}
+
+	r.mu.Lock()
+	pending.waiting--
+	abandoned := pending.waiting == 0
+	if abandoned && r.inflight[pluginName] == pending {
+		// Later callers start a fetch of their own rather than join the aborted one
+		delete(r.inflight, pluginName)
+	}
+	r.mu.Unlock()
+
+	if abandoned {
+		pending.cancel()
+	}
+	return nil, ctx.Err()
+}
+
+// runFetch fetches a schema for loadPluginSchema and records the result. It runs without the
+// lock so lookups of other plugins aren't held up behind it.
+func (r *Registry) runFetch(ctx context.Context, pluginName, ref string, generation int, pending *schemaFetch) {
+	pending.schema, pending.err = r.fetchRecovering(ctx, pluginName, ref)
+	abandoned := ctx.Err() != nil
+	pending.cancel()
+
+	r.mu.Lock()
+	if r.inflight[pluginName] == pending {
+		delete(r.inflight, pluginName)
+	}
+	now := time.Now()
+	var notify func(pluginName string, err error)
+	var stored func(pluginName string)
+	switch {
+	case generation != r.generation:
+		// The aliases changed mid-fetch, so the result may be for the wrong plugin
+	case abandoned && pending.err != nil:
+		// Every caller gave up, so the next lookup fetches again
+	case pending.err == nil:
+		r.plugins[pluginName] = &CachedPluginSchema{
+			Schema:    pending.schema,
+			CachedAt:  now,
+			ExpiresAt: r.expiry(now),
 		}
+		stored = r.onSchemaStored
+	case r.plugins[pluginName] != nil:
+		// Keep serving the stale schema, but don't retry on every lookup
+		r.plugins[pluginName].ExpiresAt = now.Add(refreshRetryDelay)
+	default:
+		notify = r.onFetchFailure
+	}
+	r.mu.Unlock()
+
+	// Reported before releasing the callers, so the failure is known when their lookups return
+	if notify != nil {
+		notify(pluginName, pending.err)
 	}
+	if stored != nil {
+		stored(pluginName)
+	}
+	close(pending.done)
+}
+
+// OnFetchFailure registers a function told whenever a plugin's schema can't be fetched and
+// there's no cached copy to use instead, so completion and validation of its configuration
+// are degraded. It's called on the goroutine that fetched, which may be a background refresh.
+func (r *Registry) OnFetchFailure(handler func(pluginName string, err error)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onFetchFailure = handler
+}
+
+// OnSchemaStored registers a function told whenever a plugin's schema is fetched, by a lookup,
+// prefetch or background refresh, or cached with CacheSchema, so results worked out without
+// it, or with an older copy, can be dropped. It's called on the goroutine that stored it.
+func (r *Registry) OnSchemaStored(handler func(pluginName string)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onSchemaStored = handler
+}
+
+// refreshPluginSchema starts fetching a fresh copy of an expired schema in the background,
+// unless a fetch is already in flight
+func (r *Registry) refreshPluginSchema(pluginName string) {
+	r.mu.RLock()
+	_, fetching := r.inflight[pluginName]
 	r.mu.RUnlock()
 
+	if !fetching {
+		go func() { _, _ = r.loadPluginSchema(context.Background(), pluginName) }()
+	}
+}
+
+// DefaultPrefetchParallelism bounds how many schemas Prefetch fetches at once
+const DefaultPrefetchParallelism = 4
+
+// Prefetch looks up the schemas of plugin references, fetching at most parallelism of them
+// at once, so they're cached by the time they're needed. Lookups of a plugin being
+// prefetched join its fetch rather than start another. It returns once every lookup has
+// finished, or ctx is cancelled.
+func (r *Registry) Prefetch(ctx context.Context, pluginNames []string, parallelism int) {
+	slots := make(chan struct{}, max(parallelism, 1))
+	seen := make(map[string]bool)
+	var wg sync.WaitGroup
+
+	for _, pluginName := range pluginNames {
+		if seen[pluginName] {
+			continue
+		}
+		seen[pluginName] = true
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			_, _ = r.GetPluginSchema(ctx, pluginName)
+		}()
+	}
+	wg.Wait()
+}
+
+// fetchRecovering fetches a schema, turning a panic into an error so that callers waiting
+// on the same fetch are always released
+func (r *Registry) fetchRecovering(ctx context.Context, pluginName, ref string) (schema *PluginSchema, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			schema, err = nil, fmt.Errorf("failed to fetch plugin schema for %s: %v", pluginName, recovered)
+		}
+	}()
+
+	return r.fetch(ctx, pluginName, ref)
+}
+
+// SetAliases configures short plugin names that resolve to other plugin references,
+// e.g. "dockerx" -> "my-org/dockerx". When the mapping changes, cached schemas are dropped
+// since they may have been fetched under the previous one.
+func (r *Registry) SetAliases(aliases map[string]string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	// Double-check after acquiring write lock
-	if cached, exists := r.plugins[pluginName]; exists && !cached.IsExpired() {
-		return cached.Schema, nil
+	// Settings are reapplied on every configuration change, usually with the same aliases
+	if maps.Equal(r.aliases, aliases) {
+		return
 	}
+	r.aliases = make(map[string]string, len(aliases))
+	for alias, target := range aliases {
+		r.aliases[alias] = target
+	}
+	r.plugins = make(map[string]*CachedPluginSchema)
+	r.generation++
+}
 
-	// Cache is expired or doesn't exist, fetch new schema
-	schema, err := r.fetchPluginSchema(pluginName)
-	if err != nil {
-		return nil, err
+// ResolveAlias rewrites a plugin reference using the configured aliases.
+// The version from the reference wins over any version in the alias target.
+// References without a matching alias are returned unchanged.
+func (r *Registry) ResolveAlias(ref string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return resolveAlias(r.aliases, ref)
+}
+
+func resolveAlias(aliases map[string]string, ref string) string {
+	if len(aliases) == 0 {
+		return ref
 	}
 
-	// Cache the schema with expiration
-	now := time.Now()
-	r.plugins[pluginName] = &CachedPluginSchema{
-		Schema:    schema,
-		CachedAt:  now,
-		ExpiresAt: now.Add(r.cacheTTL),
+	name, version, hasVersion := strings.Cut(ref, "#")
+	target, exists := aliases[name]
+	if !exists {
+		return ref
 	}
 
-	return schema, nil
+	targetName, targetVersion, targetHasVersion := strings.Cut(target, "#")
+	switch {
+	case hasVersion:
+		return targetName + "#" + version
+	case targetHasVersion:
+		return targetName + "#" + targetVersion
+	default:
+		return targetName
+	}
 }
 
-func (r *Registry) fetchPluginSchema(pluginName string) (*PluginSchema, error) {
+// fetchPluginSchema downloads a plugin's schema from its repository. ref is the plugin
+// reference with any alias already resolved. With a disk cache, a cached copy younger than
+// the TTL is used without downloading, and an older one when the download fails.
+func (r *Registry) fetchPluginSchema(ctx context.Context, pluginName, ref string) (*PluginSchema, error) {
 	// Parse the plugin reference to get org/name/version
-	parsed := ParsePluginReference(pluginName)
+	parsed := ParsePluginReference(ref)
 	if parsed == nil {
 		return nil, fmt.Errorf("invalid plugin reference: %s", pluginName)
 	}
 
-	// Get all possible URLs to try
-	urls := parsed.GetAllSchemaURLs()
+	// Only plugins on GitHub have a plugin.yml we know how to fetch. The others are treated
+	// as having no configuration schema, so their configuration isn't checked.
+	if !parsed.IsGitHub() {
+		return &PluginSchema{Name: parsed.Name}, nil
+	}
+
+	cachePath := r.schemaCachePath(parsed)
+	cached, age, hasCached := readCachedSchema(cachePath)
+	if hasCached && age < r.cacheTTL {
+		if schema, err := parsePluginSchema(cached); err == nil {
+			return schema, nil
+		}
+	}
 
 	var lastErr error
-	for _, url := range urls {
-		resp, err := http.Get(url)
+	for _, url := range parsed.GetAllSchemaURLs() {
+		schemaBytes, err := r.download(ctx, url)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		if err != nil {
 			lastErr = err
 			continue
 		}
-		defer func() { _ = resp.Body.Close() }()
-
-		if resp.StatusCode != http.StatusOK {
-			lastErr = fmt.Errorf("HTTP %d from %s", resp.StatusCode, url)
-			continue
-		}
 
-		schemaBytes, err := io.ReadAll(resp.Body)
+		schema, err := parsePluginSchema(schemaBytes)
 		if err != nil {
 			lastErr = err
 			continue
 		}
 
-		var schema PluginSchema
-		if err := yaml.Unmarshal(schemaBytes, &schema); err != nil {
-			lastErr = err
-			continue
+		writeCachedSchema(cachePath, schemaBytes)
+		return schema, nil
+	}
+
+	if hasCached {
+		if schema, err := parsePluginSchema(cached); err == nil {
+			return schema, nil
 		}
+	}
 
-		// Store schema data if configuration exists
-		if schema.Configuration != nil {
-			configJSON, err := json.Marshal(schema.Configuration)
-			if err != nil {
-				lastErr = err
-				continue
-			}
-			schema.SchemaData = configJSON
+	return nil, fmt.Errorf("failed to fetch plugin schema for %s (org: %s, name: %s, version: %s): %w",
+		pluginName, parsed.Org, parsed.Name, parsed.Version, lastErr)
+}
+
+// downloadURL fetches the body of a URL, treating anything but a 200 as an error
+func downloadURL(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d from %s", resp.StatusCode, url)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// parsePluginSchema reads a plugin.yml
+func parsePluginSchema(data []byte) (*PluginSchema, error) {
+	var schema PluginSchema
+	if err := yaml.Unmarshal(data, &schema); err != nil {
+		return nil, err
+	}
+
+	// Store schema data if configuration exists
+	if schema.Configuration != nil {
+		configJSON, err := json.Marshal(normalizeSchema(schema.Configuration))
+		if err != nil {
+			return nil, err
 		}
 
-		return &schema, nil
+		// A schema gojsonschema can't compile would fail every config, so the plugin is
+		// treated as having no schema instead
+		if _, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(configJSON)); err != nil {
+			schema.SchemaErr = fmt.Errorf("unsupported configuration schema: %w", err)
+			return &schema, nil
+		}
+		schema.SchemaData = configJSON
 	}
 
-	return nil, fmt.Errorf("failed to fetch plugin schema for %s (org: %s, name: %s, version: %s): %v",
-		pluginName, parsed.Org, parsed.Name, parsed.Version, lastErr)
+	return &schema, nil
 }
 
 // ClearExpiredCache removes expired entries from the cache
@@ -198,6 +533,71 @@ func (r *Registry) GetCacheStats() (total, expired int) {
 	return total, expired
 }
 
+// CacheStatus is what the registry knows about a plugin without fetching anything
+type CacheStatus struct {
+	Schema  *PluginSchema // The cached schema, or nil if it hasn't been fetched
+	Expired bool          // Whether the cached schema is due a refresh
+
+	// Validated reports whether the config was checked against the cached schema, with
+	// ValidationErr holding the result. Plugins without a config schema aren't validated.
+	Validated     bool
+	ValidationErr error
+}
+
+// CachedStatus reports the cached schema for a plugin and how the config validates against
+// it. Unlike ValidatePluginConfig it never fetches, so it is cheap enough to call on hover.
+func (r *Registry) CachedStatus(pluginName string, config interface{}) CacheStatus {
+	var status CacheStatus
+	if IsKubernetesPlugin(pluginName) {
+		status.Schema = kubernetesPluginSchema
+	} else {
+		r.mu.RLock()
+		if cached, exists := r.plugins[pluginName]; exists {
+			status.Schema = cached.Schema
+			status.Expired = cached.IsExpired()
+		}
+		r.mu.RUnlock()
+	}
+
+	if status.Schema == nil || status.Schema.SchemaData == nil {
+		return status
+	}
+
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		status.Validated, status.ValidationErr = true, fmt.Errorf("plugin %s config serialization failed: %w", pluginName, err)
+		return status
+	}
+
+	hash := configHash(configJSON)
+	if cached := r.cachedValidation(pluginName, status.Schema, hash); cached != nil {
+		status.Validated, status.ValidationErr = true, cached.err
+		return status
+	}
+
+	status.Validated, status.ValidationErr = true, validateConfigJSON(pluginName, status.Schema.SchemaData, configJSON)
+	r.storeValidation(pluginName, status.Schema, hash, status.ValidationErr)
+	return status
+}
+
+// CacheSchema stores a schema for a plugin as if it had just been fetched, e.g. for
+// private plugins whose schema is known without reaching GitHub
+func (r *Registry) CacheSchema(pluginName string, schema *PluginSchema) {
+	r.mu.Lock()
+	now := time.Now()
+	r.plugins[pluginName] = &CachedPluginSchema{
+		Schema:    schema,
+		CachedAt:  now,
+		ExpiresAt: r.expiry(now),
+	}
+	stored := r.onSchemaStored
+	r.mu.Unlock()
+
+	if stored != nil {
+		stored(pluginName)
+	}
+}
+
 // InvalidateCache removes a specific plugin from the cache
 func (r *Registry) InvalidateCache(pluginName string) {
 	r.mu.Lock()
@@ -205,10 +605,25 @@ func (r *Registry) InvalidateCache(pluginName string) {
 	delete(r.plugins, pluginName)
 }
 
+// SchemaUnavailableError is returned by ValidatePluginConfig when the plugin's schema couldn't
+// be looked up, so the configuration wasn't validated. The lookup may succeed next time.
+type SchemaUnavailableError struct {
+	Plugin string
+	Err    error
+}
+
+func (e *SchemaUnavailableError) Error() string {
+	return fmt.Sprintf("failed to get schema for plugin %s: %v", e.Plugin, e.Err)
+}
+
+func (e *SchemaUnavailableError) Unwrap() error {
+	return e.Err
+}
+
 func (r *Registry) ValidatePluginConfig(pluginName string, config interface{}) error {
-	schema, err := r.GetPluginSchema(pluginName)
+	schema, err := r.GetPluginSchema(context.Background(), pluginName)
 	if err != nil {
-		return fmt.Errorf("failed to get schema for plugin %s: %w", pluginName, err)
+		return &SchemaUnavailableError{Plugin: pluginName, Err: err}
 	}
 
 	if schema.SchemaData == nil {
@@ -222,8 +637,23 @@ func (r *Registry) ValidatePluginConfig(pluginName string, config interface{}) e
 		return fmt.Errorf("plugin %s config serialization failed: %w", pluginName, err)
 	}
 
+	// Identical configs validate identically against the same schema, so skip
+	// gojsonschema entirely when we've seen this config before
+	hash := configHash(configJSON)
+	if cached := r.cachedValidation(pluginName, schema, hash); cached != nil {
+		return cached.err
+	}
+
+	result := validateConfigJSON(pluginName, schema.SchemaData, configJSON)
+	r.storeValidation(pluginName, schema, hash, result)
+
+	return result
+}
+
+// validateConfigJSON validates a serialized plugin config against the plugin's schema
+func validateConfigJSON(pluginName string, schemaData, configJSON []byte) error {
 	// Use the same validation library as main schema
-	schemaLoader := gojsonschema.NewBytesLoader(schema.SchemaData)
+	schemaLoader := gojsonschema.NewBytesLoader(schemaData)
 	documentLoader := gojsonschema.NewBytesLoader(configJSON)
 
 	result, err := gojsonschema.Validate(schemaLoader, documentLoader)
@@ -242,6 +672,47 @@ func (r *Registry) ValidatePluginConfig(pluginName string, config interface{}) e
 	return nil
 }
 
+// configHash returns a stable key for a serialized plugin config.
+// encoding/json sorts map keys, so equal configs produce equal hashes.
+func configHash(configJSON []byte) string {
+	sum := sha256.Sum256(configJSON)
+	return hex.EncodeToString(sum[:])
+}
+
+// cachedValidation returns a previously stored validation result for the config hash.
+// Results are only returned if they were computed against the given schema.
+func (r *Registry) cachedValidation(pluginName string, schema *PluginSchema, hash string) *validationResult {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	cached, exists := r.plugins[pluginName]
+	if !exists || cached.Schema != schema {
+		return nil
+	}
+
+	if cached.validations == nil {
+		return nil
+	}
+	return cached.validations.get(hash)
+}
+
+// storeValidation records a validation result against the cached schema entry
+func (r *Registry) storeValidation(pluginName string, schema *PluginSchema, hash string, result error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cached, exists := r.plugins[pluginName]
+	if !exists || cached.Schema != schema {
+		// Schema was refreshed or evicted while we were validating
+		return
+	}
+
+	if cached.validations == nil {
+		cached.validations = newValidationCache(validationCacheSize)
+	}
+	cached.validations.put(hash, &validationResult{err: result})
+}
+
 // ParsePluginFromStep extracts plugin information from a pipeline step
 func ParsePluginFromStep(stepData map[string]interface{}) []PluginReference {
 	var plugins []PluginReference
@@ -275,66 +746,171 @@ type ParsedPluginRef struct {
 	Name    string // Plugin name without suffix (e.g., "docker", "foo")
 	Version string // Version tag (e.g., "v5.13.0", "latest")
 	FullRef string // Original reference (e.g., "docker#v5.13.0", "mcncl/foo#v3.0.0")
+
+	// Host is where the repository lives when it isn't GitHub, e.g. "gitlab.example.com"
+	// for "ssh://git@gitlab.example.com/ci/deploy.git#v1.0"
+	Host string
+	// Repo is the repository name when it differs from Name + "-buildkite-plugin"
+	Repo string
+	// Path is the location of a plugin vendored into the repository or on the agent,
+	// e.g. "./.buildkite/plugins/deploy"
+	Path string
 }
 
-// ParsePluginReference parses plugin references into components
-// Examples:
+// ParsePluginReference parses plugin references into components, following the forms the
+// agent accepts:
 //
 //	"docker#v5.13.0" -> {Org: "buildkite-plugins", Name: "docker", Version: "v5.13.0"}
 //	"mcncl/foo#v3.0.0" -> {Org: "mcncl", Name: "foo", Version: "v3.0.0"}
 //	"company/internal#latest" -> {Org: "company", Name: "internal", Version: "latest"}
+//	"github.com/org/foo-buildkite-plugin#v1" -> {Org: "org", Name: "foo", Version: "v1"}
+//	"ssh://git@host/ci/deploy.git#v1.0" -> {Host: "host", Org: "ci", Name: "deploy", Repo: "deploy", Version: "v1.0"}
+//	"git@host:ci/deploy.git#v1.0" -> the same as the ssh:// form
+//	"./.buildkite/plugins/deploy" -> {Name: "deploy", Path: "./.buildkite/plugins/deploy", Version: "latest"}
 func ParsePluginReference(ref string) *ParsedPluginRef {
 	if ref == "" {
 		return nil
 	}
 
-	parsed := &ParsedPluginRef{FullRef: ref}
+	parsed := &ParsedPluginRef{FullRef: ref, Version: "latest"}
 
-	// Split on # to separate plugin name from version
-	parts := strings.SplitN(ref, "#", 2)
-	pluginPart := parts[0]
+	// The version follows the last #, which can't appear anywhere else in a git URL
+	location := ref
+	if index := strings.LastIndex(ref, "#"); index >= 0 {
+		location = ref[:index]
+		if version := ref[index+1:]; version != "" {
+			parsed.Version = version
+		}
+	}
+	if location == "" {
+		return nil
+	}
 
-	if len(parts) == 2 {
-		parsed.Version = parts[1]
-	} else {
-		parsed.Version = "latest" // Default version
+	switch {
+	case strings.HasPrefix(location, "file://"):
+		parsed.Path = strings.TrimPrefix(location, "file://")
+		parsed.Name = pluginNameFromRepo(path.Base(parsed.Path))
+		return parsed
+	case strings.HasPrefix(location, ".") || strings.HasPrefix(location, "/") || strings.HasPrefix(location, "~"):
+		parsed.Path = location
+		parsed.Name = pluginNameFromRepo(path.Base(location))
+		return parsed
+	case strings.Contains(location, "://"):
+		u, err := url.Parse(location)
+		if err != nil || u.Host == "" {
+			return nil
+		}
+		parsed.setRepository(u.Hostname(), u.Path)
+		return parsed
+	case scpLikePattern.MatchString(location):
+		match := scpLikePattern.FindStringSubmatch(location)
+		parsed.setRepository(match[1], match[2])
+		return parsed
 	}
 
-	// Check if plugin contains org (has a slash)
-	if strings.Contains(pluginPart, "/") {
-		orgParts := strings.SplitN(pluginPart, "/", 2)
-		parsed.Org = orgParts[0]
-		parsed.Name = orgParts[1]
-	} else {
+	// Shorthand: "name", "org/name", or "host/org/name"
+	parts := strings.Split(location, "/")
+	switch len(parts) {
+	case 1:
 		// Default to buildkite-plugins org for official plugins
 		parsed.Org = "buildkite-plugins"
-		parsed.Name = pluginPart
+		parsed.Name = parts[0]
+	case 2:
+		parsed.Org = parts[0]
+		parsed.Name = parts[1]
+	default:
+		parsed.setRepository(parts[0], strings.Join(parts[1:], "/"))
+	}
+	if parsed.Org == "" || parsed.Name == "" {
+		return nil
 	}
 
 	return parsed
 }
 
-// GetRepositoryURL returns the GitHub repository URL for this plugin
+// scpLikePattern matches git's scp-like syntax, e.g. "git@github.com:org/repo.git"
+var scpLikePattern = regexp.MustCompile(`^[\w.-]+@([\w.-]+):(.+)$`)
+
+// setRepository fills in the parts of a reference from a repository host and path
+func (p *ParsedPluginRef) setRepository(host, repoPath string) {
+	repoPath = strings.TrimSuffix(strings.Trim(repoPath, "/"), ".git")
+	org, repo := path.Split(repoPath)
+
+	p.Org = strings.TrimSuffix(org, "/")
+	p.Name = pluginNameFromRepo(repo)
+	if host != "github.com" {
+		p.Host = host
+	}
+	if repo != p.Name+"-buildkite-plugin" {
+		p.Repo = repo
+	}
+}
+
+// pluginNameFromRepo drops the conventional suffix from a plugin repository name
+func pluginNameFromRepo(repo string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(repo, ".git"), "-buildkite-plugin")
+}
+
+// IsPluginReference reports whether text has the form of a plugin reference: a name with a
+// version, a git URL or a path to a local plugin. Bare names like "docker" are references
+// too, but only their place under plugins tells them apart from other keys.
+func IsPluginReference(text string) bool {
+	if text == "" || strings.ContainsAny(text, " \t") {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(text, "file://"), strings.HasPrefix(text, "./"), strings.HasPrefix(text, "../"):
+		return true
+	case strings.Contains(text, "://"), scpLikePattern.MatchString(strings.Split(text, "#")[0]):
+		return ParsePluginReference(text) != nil
+	}
+	location, version, hasVersion := strings.Cut(text, "#")
+	return hasVersion && location != "" && version != ""
+}
+
+// IsGitHub reports whether the plugin's repository is on GitHub, where its schema can be fetched
+func (p *ParsedPluginRef) IsGitHub() bool {
+	return p.Host == "" && p.Path == ""
+}
+
+// repository returns the repository name, following the plugin naming convention unless the
+// reference names the repository in full
+func (p *ParsedPluginRef) repository() string {
+	if p.Repo != "" {
+		return p.Repo
+	}
+	return p.Name + "-buildkite-plugin"
+}
+
+// GetRepositoryURL returns the repository URL for this plugin, or its path for local plugins
 func (p *ParsedPluginRef) GetRepositoryURL() string {
-	return fmt.Sprintf("https://github.com/%s/%s-buildkite-plugin", p.Org, p.Name)
+	switch {
+	case p.Path != "":
+		return p.Path
+	case p.Host != "":
+		return fmt.Sprintf("https://%s/%s/%s", p.Host, p.Org, p.repository())
+	}
+	return fmt.Sprintf("https://github.com/%s/%s", p.Org, p.repository())
 }
 
-// GetSchemaURL returns the plugin.yml URL for fetching schema
+// GetSchemaURL returns the plugin.yml URL for fetching schema, or "" when the plugin isn't on GitHub
 func (p *ParsedPluginRef) GetSchemaURL() string {
-	// Try version-specific branch first, then fall back to main/master
-	urls := []string{
-		fmt.Sprintf("https://raw.githubusercontent.com/%s/%s-buildkite-plugin/%s/plugin.yml", p.Org, p.Name, p.Version),
-		fmt.Sprintf("https://raw.githubusercontent.com/%s/%s-buildkite-plugin/main/plugin.yml", p.Org, p.Name),
-		fmt.Sprintf("https://raw.githubusercontent.com/%s/%s-buildkite-plugin/master/plugin.yml", p.Org, p.Name),
+	urls := p.GetAllSchemaURLs()
+	if len(urls) == 0 {
+		return ""
 	}
 	return urls[0] // Return primary URL, fetchPluginSchema will try fallbacks
 }
 
-// GetAllSchemaURLs returns all possible URLs to try for fetching the schema
+// GetAllSchemaURLs returns all possible URLs to try for fetching the schema: the version
+// first, then the main and master branches. Plugins that aren't on GitHub have none.
 func (p *ParsedPluginRef) GetAllSchemaURLs() []string {
+	if !p.IsGitHub() {
+		return nil
+	}
 	return []string{
-		fmt.Sprintf("https://raw.githubusercontent.com/%s/%s-buildkite-plugin/%s/plugin.yml", p.Org, p.Name, p.Version),
-		fmt.Sprintf("https://raw.githubusercontent.com/%s/%s-buildkite-plugin/main/plugin.yml", p.Org, p.Name),
-		fmt.Sprintf("https://raw.githubusercontent.com/%s/%s-buildkite-plugin/master/plugin.yml", p.Org, p.Name),
+		fmt.Sprintf("https://raw.githubusercontent.com/%s/%s/%s/plugin.yml", p.Org, p.repository(), p.Version),
+		fmt.Sprintf("https://raw.githubusercontent.com/%s/%s/main/plugin.yml", p.Org, p.repository()),
+		fmt.Sprintf("https://raw.githubusercontent.com/%s/%s/master/plugin.yml", p.Org, p.repository()),
 	}
 }
@@ -1,7 +1,13 @@
 package plugins
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -319,3 +325,618 @@ func stringify(v interface{}) []byte {
 		return []byte("")
 	}
 }
+
+func TestRegistry_ValidatePluginConfig_CachesResults(t *testing.T) {
+	registry := NewRegistry()
+	now := time.Now()
+
+	schema := &PluginSchema{
+		Name:       "test",
+		SchemaData: []byte(`{"type": "object", "properties": {"image": {"type": "string"}}, "additionalProperties": false}`),
+	}
+	registry.plugins["test#v1.0.0"] = &CachedPluginSchema{
+		Schema:    schema,
+		CachedAt:  now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+
+	validConfig := map[string]interface{}{"image": "node:18"}
+	invalidConfig := map[string]interface{}{"unknown": true}
+
+	if err := registry.ValidatePluginConfig("test#v1.0.0", validConfig); err != nil {
+		t.Errorf("Expected valid config, got error: %v", err)
+	}
+	if err := registry.ValidatePluginConfig("test#v1.0.0", invalidConfig); err == nil {
+		t.Error("Expected error for invalid config")
+	}
+
+	cached := registry.plugins["test#v1.0.0"]
+	if cached.validations.len() != 2 {
+		t.Fatalf("Expected 2 cached validation results, got %d", cached.validations.len())
+	}
+
+	// Cached results are returned even if the schema data changes underneath
+	schema.SchemaData = []byte(`{"type": "object", "required": ["missing"]}`)
+	if err := registry.ValidatePluginConfig("test#v1.0.0", validConfig); err != nil {
+		t.Errorf("Expected cached result for valid config, got error: %v", err)
+	}
+	if err := registry.ValidatePluginConfig("test#v1.0.0", invalidConfig); err == nil {
+		t.Error("Expected cached error for invalid config")
+	}
+
+	// Refreshing the schema entry drops previously cached results
+	registry.plugins["test#v1.0.0"] = &CachedPluginSchema{
+		Schema:    &PluginSchema{Name: "test", SchemaData: schema.SchemaData},
+		CachedAt:  now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+	if err := registry.ValidatePluginConfig("test#v1.0.0", validConfig); err == nil {
+		t.Error("Expected validation against refreshed schema to fail")
+	}
+}
+
+func TestRegistry_ValidatePluginConfig_CacheIsBounded(t *testing.T) {
+	registry := NewRegistry()
+	now := time.Now()
+	registry.plugins["test#v1.0.0"] = &CachedPluginSchema{
+		Schema:    &PluginSchema{Name: "test", SchemaData: []byte(`{"type": "object"}`)},
+		CachedAt:  now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+
+	// Editing a config validates a new one on every keystroke
+	for i := 0; i < validationCacheSize+10; i++ {
+		config := map[string]interface{}{"image": fmt.Sprintf("node:%d", i)}
+		if err := registry.ValidatePluginConfig("test#v1.0.0", config); err != nil {
+			t.Fatalf("Expected valid config, got error: %v", err)
+		}
+		// The config in use stays cached while the others are typed
+		if err := registry.ValidatePluginConfig("test#v1.0.0", map[string]interface{}{"image": "node:18"}); err != nil {
+			t.Fatalf("Expected valid config, got error: %v", err)
+		}
+	}
+
+	validations := registry.plugins["test#v1.0.0"].validations
+	if validations.len() != validationCacheSize {
+		t.Errorf("Expected %d cached validation results, got %d", validationCacheSize, validations.len())
+	}
+	if validations.get(configHash([]byte(`{"image":"node:18"}`))) == nil {
+		t.Error("Expected the recently used config to stay cached")
+	}
+	if validations.get(configHash([]byte(`{"image":"node:0"}`))) != nil {
+		t.Error("Expected the least recently used config to be evicted")
+	}
+}
+
+func TestRegistry_ResolveAlias(t *testing.T) {
+	registry := NewRegistry()
+	registry.plugins["dockerx#v1.0.0"] = &CachedPluginSchema{Schema: &PluginSchema{Name: "stale"}}
+
+	registry.SetAliases(map[string]string{
+		"dockerx": "my-org/dockerx",
+		"pinned":  "my-org/pinned#v2.0.0",
+	})
+
+	// Changing aliases invalidates cached schemas
+	if len(registry.plugins) != 0 {
+		t.Errorf("Expected cache to be cleared after setting aliases, got %d entries", len(registry.plugins))
+	}
+
+	tests := []struct {
+		ref      string
+		expected string
+	}{
+		{"dockerx#v1.0.0", "my-org/dockerx#v1.0.0"},
+		{"dockerx", "my-org/dockerx"},
+		{"pinned", "my-org/pinned#v2.0.0"},
+		{"pinned#v3.0.0", "my-org/pinned#v3.0.0"},
+		{"docker#v5.13.0", "docker#v5.13.0"},
+	}
+
+	for _, test := range tests {
+		if result := registry.ResolveAlias(test.ref); result != test.expected {
+			t.Errorf("ResolveAlias(%q) = %q, expected %q", test.ref, result, test.expected)
+		}
+	}
+}
+
+func TestRegistry_KubernetesPlugin(t *testing.T) {
+	registry := NewRegistry()
+
+	if !IsKubernetesPlugin("kubernetes") {
+		t.Error("Expected 'kubernetes' to be detected as the kubernetes plugin")
+	}
+	if IsKubernetesPlugin("my-org/kubernetes#v1.0.0") {
+		t.Error("Expected org-scoped plugin not to be detected as the kubernetes plugin")
+	}
+
+	schema, err := registry.GetPluginSchema(context.Background(), "kubernetes")
+	if err != nil {
+		t.Fatalf("Expected built-in schema, got error: %v", err)
+	}
+	if schema.SchemaData != nil {
+		t.Error("Expected no JSON schema for the kubernetes plugin")
+	}
+
+	// Raw podSpec YAML must not produce validation errors
+	config := map[string]interface{}{
+		"podSpec": map[string]interface{}{
+			"containers": []interface{}{
+				map[string]interface{}{"image": "alpine:latest", "command": []interface{}{"echo"}},
+			},
+		},
+	}
+	if err := registry.ValidatePluginConfig("kubernetes", config); err != nil {
+		t.Errorf("Expected no validation error, got: %v", err)
+	}
+}
+
+func TestPluginSchema_RequiredProperties(t *testing.T) {
+	schema := &PluginSchema{
+		Configuration: map[string]any{
+			"properties": map[string]any{"image": map[string]any{}, "user": map[string]any{}},
+			"required":   []interface{}{"image", "user"},
+		},
+	}
+
+	required := schema.RequiredProperties()
+	if len(required) != 2 || required[0] != "image" || required[1] != "user" {
+		t.Errorf("Expected [image user], got %v", required)
+	}
+
+	if required := (&PluginSchema{}).RequiredProperties(); len(required) != 0 {
+		t.Errorf("Expected no required properties without a configuration, got %v", required)
+	}
+}
+
+func TestRegistry_CacheSchema(t *testing.T) {
+	registry := NewRegistry()
+	registry.CacheSchema("my-org/private#v1.0.0", &PluginSchema{Name: "Private"})
+
+	schema, err := registry.GetPluginSchema(context.Background(), "my-org/private#v1.0.0")
+	if err != nil {
+		t.Fatalf("Expected cached schema, got error: %v", err)
+	}
+	if schema.Name != "Private" {
+		t.Errorf("Expected the cached schema, got %+v", schema)
+	}
+}
+
+func TestRegistry_CachedStatus(t *testing.T) {
+	registry := NewRegistry()
+	registry.fetch = func(ctx context.Context, pluginName, ref string) (*PluginSchema, error) {
+		t.Errorf("Expected no fetch for %s", pluginName)
+		return nil, fmt.Errorf("unexpected fetch")
+	}
+	registry.CacheSchema("test#v1.0.0", &PluginSchema{
+		Name:       "test",
+		SchemaData: []byte(`{"type": "object", "required": ["image"]}`),
+	})
+
+	if status := registry.CachedStatus("unknown#v1.0.0", nil); status.Schema != nil || status.Validated {
+		t.Errorf("Expected nothing known about an uncached plugin, got %+v", status)
+	}
+
+	status := registry.CachedStatus("test#v1.0.0", map[string]interface{}{})
+	if status.Schema == nil || status.Expired {
+		t.Fatalf("Expected the cached schema, got %+v", status)
+	}
+	if !status.Validated || status.ValidationErr == nil {
+		t.Errorf("Expected the config to fail validation, got %+v", status)
+	}
+
+	// The result is cached for diagnostics to reuse
+	if registry.plugins["test#v1.0.0"].validations.len() != 1 {
+		t.Error("Expected the validation result to be cached")
+	}
+
+	if status := registry.CachedStatus("kubernetes", map[string]interface{}{}); status.Schema == nil {
+		t.Error("Expected the built-in kubernetes schema to be available")
+	}
+}
+
+func TestRegistry_ConcurrentFetchesAreShared(t *testing.T) {
+	registry := NewRegistry()
+
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	registry.fetch = func(ctx context.Context, pluginName, ref string) (*PluginSchema, error) {
+		fetches.Add(1)
+		<-release
+		return &PluginSchema{Name: "Docker"}, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*PluginSchema, 5)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = registry.GetPluginSchema(context.Background(), "docker#v5.13.0")
+		}()
+	}
+
+	// Let every caller reach the in-flight fetch before it completes
+	for {
+		registry.mu.RLock()
+		_, fetching := registry.inflight["docker#v5.13.0"]
+		registry.mu.RUnlock()
+		if fetching {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if fetches.Load() != 1 {
+		t.Errorf("Expected a single fetch, got %d", fetches.Load())
+	}
+	for i, schema := range results {
+		if schema == nil || schema.Name != "Docker" {
+			t.Errorf("Caller %d: expected the fetched schema, got %+v", i, schema)
+		}
+	}
+}
+
+func TestRegistry_CancelledCallerAbortsFetch(t *testing.T) {
+	registry := NewRegistry()
+
+	started := make(chan struct{})
+	aborted := make(chan struct{})
+	registry.fetch = func(ctx context.Context, pluginName, ref string) (*PluginSchema, error) {
+		close(started)
+		<-ctx.Done()
+		close(aborted)
+		return nil, ctx.Err()
+	}
+	var failures int
+	registry.OnFetchFailure(func(pluginName string, err error) { failures++ })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	if _, err := registry.GetPluginSchema(ctx, "docker#v5.13.0"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the lookup to be cancelled, got %v", err)
+	}
+
+	select {
+	case <-aborted:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the abandoned fetch to be aborted")
+	}
+
+	// The aborted fetch is neither cached nor reported, and the next lookup fetches again
+	registry.fetch = func(ctx context.Context, pluginName, ref string) (*PluginSchema, error) {
+		return &PluginSchema{Name: "Docker"}, nil
+	}
+	schema, err := registry.GetPluginSchema(context.Background(), "docker#v5.13.0")
+	if err != nil || schema.Name != "Docker" {
+		t.Errorf("Expected a fresh fetch, got %+v, %v", schema, err)
+	}
+	if failures != 0 {
+		t.Errorf("Expected the aborted fetch not to be reported as a failure, got %d", failures)
+	}
+}
+
+func TestRegistry_CancelledCallerLeavesSharedFetch(t *testing.T) {
+	registry := NewRegistry()
+
+	release := make(chan struct{})
+	registry.fetch = func(ctx context.Context, pluginName, ref string) (*PluginSchema, error) {
+		select {
+		case <-release:
+			return &PluginSchema{Name: "Docker"}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	result := make(chan *PluginSchema)
+	go func() {
+		schema, _ := registry.GetPluginSchema(context.Background(), "docker#v5.13.0")
+		result <- schema
+	}()
+	for {
+		registry.mu.RLock()
+		pending := registry.inflight["docker#v5.13.0"]
+		registry.mu.RUnlock()
+		if pending != nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := registry.GetPluginSchema(ctx, "docker#v5.13.0"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the cancelled lookup to return, got %v", err)
+	}
+
+	// The other caller still gets the schema
+	close(release)
+	if schema := <-result; schema == nil || schema.Name != "Docker" {
+		t.Errorf("Expected the fetch to carry on for the remaining caller, got %+v", schema)
+	}
+}
+
+func TestRegistry_ExpiredSchemaIsServedWhileRefreshing(t *testing.T) {
+	registry := NewRegistry()
+	stale := &PluginSchema{Name: "Stale"}
+	registry.plugins["docker#v5.13.0"] = &CachedPluginSchema{
+		Schema:    stale,
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}
+
+	release := make(chan struct{})
+	registry.fetch = func(ctx context.Context, pluginName, ref string) (*PluginSchema, error) {
+		<-release
+		return &PluginSchema{Name: "Fresh"}, nil
+	}
+
+	schema, err := registry.GetPluginSchema(context.Background(), "docker#v5.13.0")
+	if err != nil || schema != stale {
+		t.Fatalf("Expected the stale schema without waiting, got %+v, %v", schema, err)
+	}
+	close(release)
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if schema, _ := registry.GetPluginSchema(context.Background(), "docker#v5.13.0"); schema.Name == "Fresh" {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Error("Expected the background refresh to replace the stale schema")
+}
+
+func TestRegistry_FailedRefreshKeepsStaleSchema(t *testing.T) {
+	registry := NewRegistry()
+	stale := &PluginSchema{Name: "Stale"}
+	registry.plugins["docker#v5.13.0"] = &CachedPluginSchema{
+		Schema:    stale,
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}
+	registry.fetch = func(ctx context.Context, pluginName, ref string) (*PluginSchema, error) {
+		return nil, fmt.Errorf("offline")
+	}
+
+	if _, err := registry.loadPluginSchema(context.Background(), "docker#v5.13.0"); err == nil {
+		t.Fatal("Expected the refresh to fail")
+	}
+
+	cached := registry.plugins["docker#v5.13.0"]
+	if cached.Schema != stale {
+		t.Error("Expected the stale schema to be kept")
+	}
+	if cached.IsExpired() {
+		t.Error("Expected the failed refresh to delay the next attempt")
+	}
+}
+
+func TestRegistry_FetchPanicReleasesWaiters(t *testing.T) {
+	registry := NewRegistry()
+	registry.fetch = func(ctx context.Context, pluginName, ref string) (*PluginSchema, error) {
+		panic("malformed schema")
+	}
+
+	_, err := registry.GetPluginSchema(context.Background(), "docker#v5.13.0")
+	if err == nil || !strings.Contains(err.Error(), "malformed schema") {
+		t.Errorf("Expected the panic as an error, got %v", err)
+	}
+	if len(registry.inflight) != 0 {
+		t.Error("Expected the failed fetch to be cleared")
+	}
+}
+
+func TestRegistry_AliasChangeDropsInflightResult(t *testing.T) {
+	registry := NewRegistry()
+	registry.SetAliases(map[string]string{"dockerx": "my-org/dockerx"})
+
+	release := make(chan struct{})
+	var resolved string
+	registry.fetch = func(ctx context.Context, pluginName, ref string) (*PluginSchema, error) {
+		resolved = ref
+		<-release
+		return &PluginSchema{Name: "Old"}, nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		_, _ = registry.GetPluginSchema(context.Background(), "dockerx#v1.0.0")
+		close(done)
+	}()
+
+	for {
+		registry.mu.RLock()
+		_, fetching := registry.inflight["dockerx#v1.0.0"]
+		registry.mu.RUnlock()
+		if fetching {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	registry.SetAliases(map[string]string{"dockerx": "other-org/dockerx"})
+	close(release)
+	<-done
+
+	if resolved != "my-org/dockerx#v1.0.0" {
+		t.Errorf("Expected the fetch to use the resolved alias, got %q", resolved)
+	}
+	if _, cached := registry.plugins["dockerx#v1.0.0"]; cached {
+		t.Error("Expected the result fetched under the old aliases not to be cached")
+	}
+}
+
+func TestPluginSchema_RequirementGroups(t *testing.T) {
+	schema := &PluginSchema{
+		Configuration: map[string]any{
+			"oneOf": []interface{}{
+				map[string]interface{}{"required": []interface{}{"image"}},
+				map[string]interface{}{"required": []interface{}{"build", "push"}},
+				map[string]interface{}{"properties": map[string]interface{}{}},
+			},
+			"anyOf": []interface{}{
+				map[string]interface{}{"required": []interface{}{"run"}},
+			},
+		},
+	}
+
+	expected := []RequirementGroup{
+		{Keyword: "oneOf", Alternatives: [][]string{{"image"}, {"build", "push"}}},
+		{Keyword: "anyOf", Alternatives: [][]string{{"run"}}},
+	}
+	if groups := schema.RequirementGroups(); !reflect.DeepEqual(groups, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, groups)
+	}
+
+	if groups := (&PluginSchema{}).RequirementGroups(); groups != nil {
+		t.Errorf("Expected no groups without configuration, got %+v", groups)
+	}
+}
+
+func TestRegistry_OnFetchFailure(t *testing.T) {
+	registry := NewRegistry()
+	registry.fetch = func(ctx context.Context, pluginName, ref string) (*PluginSchema, error) {
+		return nil, fmt.Errorf("HTTP 404 from %s", ref)
+	}
+
+	var failures []string
+	registry.OnFetchFailure(func(pluginName string, err error) {
+		failures = append(failures, fmt.Sprintf("%s: %v", pluginName, err))
+	})
+
+	if _, err := registry.GetPluginSchema(context.Background(), "my-org/missing#v1.0.0"); err == nil {
+		t.Fatal("Expected the fetch to fail")
+	}
+	if len(failures) != 1 || failures[0] != "my-org/missing#v1.0.0: HTTP 404 from my-org/missing#v1.0.0" {
+		t.Errorf("Expected the failure to be reported, got %v", failures)
+	}
+
+	// A failed refresh keeps serving the stale schema, so nothing is degraded
+	registry.CacheSchema("docker#v5.13.0", &PluginSchema{Name: "Docker"})
+	registry.plugins["docker#v5.13.0"].ExpiresAt = time.Now().Add(-time.Minute)
+	if _, err := registry.loadPluginSchema(context.Background(), "docker#v5.13.0"); err == nil {
+		t.Fatal("Expected the refresh to fail")
+	}
+	if len(failures) != 1 {
+		t.Errorf("Expected no report for a failed refresh, got %v", failures)
+	}
+}
+
+func TestRegistry_OnSchemaStored(t *testing.T) {
+	registry := NewRegistry()
+	fail := true
+	registry.fetch = func(ctx context.Context, pluginName, ref string) (*PluginSchema, error) {
+		if fail {
+			return nil, fmt.Errorf("HTTP 503 from %s", ref)
+		}
+		return &PluginSchema{Name: "Docker"}, nil
+	}
+
+	var stored []string
+	registry.OnSchemaStored(func(pluginName string) {
+		stored = append(stored, pluginName)
+	})
+
+	// A failed lookup stores nothing, and validation says the schema was unavailable
+	err := registry.ValidatePluginConfig("docker#v5.13.0", map[string]interface{}{})
+	var schemaErr *SchemaUnavailableError
+	if !errors.As(err, &schemaErr) || schemaErr.Plugin != "docker#v5.13.0" {
+		t.Fatalf("Expected a SchemaUnavailableError, got %v", err)
+	}
+	if len(stored) != 0 {
+		t.Errorf("Expected nothing stored for a failed fetch, got %v", stored)
+	}
+
+	fail = false
+	if _, err := registry.GetPluginSchema(context.Background(), "docker#v5.13.0"); err != nil {
+		t.Fatalf("Expected the fetch to succeed, got %v", err)
+	}
+	registry.CacheSchema("my-org/private#v1.0.0", &PluginSchema{Name: "Private"})
+	if !reflect.DeepEqual(stored, []string{"docker#v5.13.0", "my-org/private#v1.0.0"}) {
+		t.Errorf("Expected the fetched and cached schemas reported, got %v", stored)
+	}
+}
+
+func TestRegistry_Prefetch(t *testing.T) {
+	registry := NewRegistry()
+
+	var running, peak, fetches atomic.Int32
+	registry.fetch = func(ctx context.Context, pluginName, ref string) (*PluginSchema, error) {
+		fetches.Add(1)
+		now := running.Add(1)
+		for {
+			current := peak.Load()
+			if now <= current || peak.CompareAndSwap(current, now) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		running.Add(-1)
+		return &PluginSchema{Name: pluginName}, nil
+	}
+
+	refs := []string{"a#v1.0.0", "b#v1.0.0", "c#v1.0.0", "a#v1.0.0", "d#v1.0.0", "e#v1.0.0"}
+	registry.Prefetch(context.Background(), refs, 2)
+
+	if fetches.Load() != 5 {
+		t.Errorf("Expected each plugin to be fetched once, got %d fetches", fetches.Load())
+	}
+	if peak.Load() > 2 {
+		t.Errorf("Expected at most 2 fetches at once, got %d", peak.Load())
+	}
+	for _, ref := range refs {
+		if status := registry.CachedStatus(ref, nil); status.Schema == nil {
+			t.Errorf("Expected %s to be cached", ref)
+		}
+	}
+
+	// Cached plugins aren't fetched again
+	registry.Prefetch(context.Background(), refs, 2)
+	if fetches.Load() != 5 {
+		t.Errorf("Expected no further fetches, got %d", fetches.Load())
+	}
+}
+
+func TestRegistry_PrefetchCancelled(t *testing.T) {
+	registry := NewRegistry()
+	registry.fetch = func(ctx context.Context, pluginName, ref string) (*PluginSchema, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		registry.Prefetch(ctx, []string{"a#v1.0.0", "b#v1.0.0", "c#v1.0.0"}, 1)
+		close(done)
+	}()
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected a cancelled prefetch to return")
+	}
+}
+
+func TestRegistry_SetAliasesKeepsCacheWhenUnchanged(t *testing.T) {
+	registry := NewRegistry()
+	registry.SetAliases(map[string]string{"dockerx": "my-org/dockerx"})
+	registry.CacheSchema("docker#v5.13.0", &PluginSchema{Name: "Docker"})
+
+	// Reapplying the same settings keeps the schemas fetched so far
+	registry.SetAliases(map[string]string{"dockerx": "my-org/dockerx"})
+	if _, cached := registry.plugins["docker#v5.13.0"]; !cached {
+		t.Error("Expected unchanged aliases to keep the cached schemas")
+	}
+
+	registry.SetAliases(map[string]string{"dockerx": "other-org/dockerx"})
+	if _, cached := registry.plugins["docker#v5.13.0"]; cached {
+		t.Error("Expected changed aliases to drop the cached schemas")
+	}
+}
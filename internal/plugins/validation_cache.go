@@ -0,0 +1,72 @@
+package plugins
+
+import (
+	"container/list"
+	"sync"
+)
+
+// validationCacheSize is how many configs' validation results are kept per plugin schema.
+// A workspace uses a plugin with a handful of configs, but editing a config produces a new
+// one on every keystroke, so the cache is bounded.
+const validationCacheSize = 256
+
+type validationEntry struct {
+	hash   string
+	result *validationResult
+}
+
+// validationCache is a least recently used cache of validation results keyed by config hash
+type validationCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+func newValidationCache(size int) *validationCache {
+	return &validationCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *validationCache) get(hash string) *validationResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[hash]
+	if !ok {
+		return nil
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*validationEntry).result
+}
+
+func (c *validationCache) put(hash string, result *validationResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[hash]; ok {
+		element.Value.(*validationEntry).result = result
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[hash] = c.order.PushFront(&validationEntry{hash: hash, result: result})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*validationEntry).hash)
+	}
+}
+
+// len reports the number of cached results
+func (c *validationCache) len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
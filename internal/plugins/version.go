@@ -0,0 +1,59 @@
+package plugins
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CompareVersions orders two plugin versions such as "v5.13.0" and "v5.2.1", returning
+// -1, 0 or 1. Release segments compare numerically, and a pre-release ("v2.0.0-beta")
+// sorts before its release.
+func CompareVersions(a, b string) int {
+	aCore, aPre, _ := strings.Cut(strings.TrimPrefix(a, "v"), "-")
+	bCore, bPre, _ := strings.Cut(strings.TrimPrefix(b, "v"), "-")
+
+	aParts := strings.Split(aCore, ".")
+	bParts := strings.Split(bCore, ".")
+
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		if c := compareSegment(segment(aParts, i), segment(bParts, i)); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	default:
+		return strings.Compare(aPre, bPre)
+	}
+}
+
+// segment returns the version segment at index i, treating missing segments as zero
+func segment(parts []string, i int) string {
+	if i < len(parts) {
+		return parts[i]
+	}
+	return "0"
+}
+
+func compareSegment(a, b string) int {
+	aNum, aErr := strconv.Atoi(a)
+	bNum, bErr := strconv.Atoi(b)
+	if aErr != nil || bErr != nil {
+		return strings.Compare(a, b)
+	}
+
+	switch {
+	case aNum < bNum:
+		return -1
+	case aNum > bNum:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,112 @@
+//go:build ignore
+
+// gen.go vendors the Buildkite pipeline schema into schema.json at a pinned commit,
+// recording where it came from in version.go. The commit defaults to the head of main;
+// pass -commit to pin another.
+//
+// Run it with `go generate ./internal/schema`.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	// schemaURL is formatted with the commit to fetch the schema at
+	schemaURL = "https://raw.githubusercontent.com/buildkite/pipeline-schema/%s/schema.json"
+	commitURL = "https://api.github.com/repos/buildkite/pipeline-schema/commits/main"
+)
+
+const versionTemplate = `// Code generated by gen.go; DO NOT EDIT.
+
+package schema
+
+// SchemaSource is where schema.json was vendored from, or a note that it's maintained by hand
+const SchemaSource = %q
+
+// SchemaCommit is the pipeline-schema commit that schema.json was vendored from, or "" when
+// it wasn't vendored
+const SchemaCommit = %q
+
+// SchemaFetchedAt records when schema.json was vendored, or "" when it wasn't
+const SchemaFetchedAt = %q
+`
+
+func main() {
+	commit := flag.String("commit", "", "pipeline-schema commit to vendor, instead of the head of main")
+	flag.Parse()
+
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	if *commit == "" {
+		head, err := fetchCommit(client)
+		if err != nil {
+			log.Fatalf("failed to resolve schema commit: %v", err)
+		}
+		*commit = head
+	}
+
+	// Fetched at the commit itself, so the schema can't move on between the two requests
+	source := fmt.Sprintf(schemaURL, *commit)
+	schemaBytes, err := fetch(client, source)
+	if err != nil {
+		log.Fatalf("failed to fetch schema: %v", err)
+	}
+
+	// Refuse to vendor anything that isn't valid JSON
+	if !json.Valid(schemaBytes) {
+		log.Fatalf("fetched schema is not valid JSON")
+	}
+
+	if err := os.WriteFile("schema.json", schemaBytes, 0o644); err != nil {
+		log.Fatalf("failed to write schema.json: %v", err)
+	}
+
+	fetchedAt := time.Now().UTC().Format(time.RFC3339)
+	version := fmt.Sprintf(versionTemplate, source, *commit, fetchedAt)
+	if err := os.WriteFile("version.go", []byte(version), 0o644); err != nil {
+		log.Fatalf("failed to write version.go: %v", err)
+	}
+
+	log.Printf("Vendored pipeline schema at commit %s", *commit)
+}
+
+func fetchCommit(client *http.Client) (string, error) {
+	body, err := fetch(client, commitURL)
+	if err != nil {
+		return "", err
+	}
+
+	var commit struct {
+		SHA string `json:"sha"`
+	}
+	if err := json.Unmarshal(body, &commit); err != nil {
+		return "", fmt.Errorf("failed to decode commit: %w", err)
+	}
+	if commit.SHA == "" {
+		return "", fmt.Errorf("no commit SHA in response")
+	}
+
+	return commit.SHA, nil
+}
+
+func fetch(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d from %s", resp.StatusCode, url)
+	}
+
+	return io.ReadAll(resp.Body)
+}
@@ -1,64 +1,85 @@
 package schema
 
 import (
+	_ "embed"
 	"fmt"
-	"io"
-	"net/http"
 	"strings"
 	"sync"
 
 	"github.com/xeipuuv/gojsonschema"
 )
 
+//go:generate go run gen.go
+
+// SchemaURL is the upstream location of the Buildkite pipeline schema. `go generate` vendors
+// it into schema.json at a pinned commit, replacing the hand-maintained subset.
 const SchemaURL = "https://raw.githubusercontent.com/buildkite/pipeline-schema/refs/heads/main/schema.json"
 
-type Loader struct {
-	mu         sync.RWMutex
-	schemaData []byte
+//go:embed schema.json
+var bundledSchema []byte
+
+// SchemaVersion describes which copy of the pipeline schema the loader is using
+type SchemaVersion struct {
+	Source    string // Where the schema was fetched from, or that it's maintained by hand
+	Commit    string // pipeline-schema commit the schema was taken from, "" if not vendored
+	FetchedAt string // When the schema was vendored (RFC 3339), "" if not vendored
 }
 
-func NewLoader() *Loader {
-	return &Loader{}
+// Vendored reports whether the schema is a copy of upstream rather than the hand-maintained
+// subset, which may not list every key Buildkite accepts
+func (v SchemaVersion) Vendored() bool {
+	return v.Commit != ""
 }
 
-func (l *Loader) GetSchemaData() ([]byte, error) {
-	l.mu.RLock()
-	if l.schemaData != nil {
-		defer l.mu.RUnlock()
-		return l.schemaData, nil
+// String formats the version for logs and issue reports
+func (v SchemaVersion) String() string {
+	if v.Commit == "" {
+		return v.Source
 	}
-	l.mu.RUnlock()
-
-	l.mu.Lock()
-	defer l.mu.Unlock()
-
-	if l.schemaData != nil {
-		return l.schemaData, nil
+	commit := v.Commit
+	if len(commit) > 12 {
+		commit = commit[:12]
 	}
+	return fmt.Sprintf("%s@%s (fetched %s)", v.Source, commit, v.FetchedAt)
+}
 
-	resp, err := http.Get(SchemaURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch schema: %w", err)
-	}
-	defer func() { _ = resp.Body.Close() }()
+type Loader struct {
+	schemaData []byte
+	version    SchemaVersion
+
+	propertiesOnce   sync.Once
+	propertiesByType map[string][]Property
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch schema: HTTP %d", resp.StatusCode)
+func NewLoader() *Loader {
+	return &Loader{
+		schemaData: bundledSchema,
+		version: SchemaVersion{
+			Source:    SchemaSource,
+			Commit:    SchemaCommit,
+			FetchedAt: SchemaFetchedAt,
+		},
 	}
+}
 
-	schemaBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read schema: %w", err)
+// GetSchemaData returns the raw JSON of the pipeline schema
+func (l *Loader) GetSchemaData() ([]byte, error) {
+	if len(l.schemaData) == 0 {
+		return nil, fmt.Errorf("no pipeline schema bundled")
 	}
+	return l.schemaData, nil
+}
 
-	l.schemaData = schemaBytes
-	return schemaBytes, nil
+// Version reports which pipeline schema the loader validates against
+func (l *Loader) Version() SchemaVersion {
+	return l.version
 }
 
 type ValidationError struct {
-	Message string
-	Path    string
-	Line    int
+	Message         string
+	Path            string
+	Line            int
+	UnknownProperty bool // The error is a key the schema doesn't list
 }
 
 func (l *Loader) ValidateJSON(jsonData []byte) (*ValidationError, error) {
@@ -106,9 +127,10 @@ func (l *Loader) ValidateJSON(jsonData []byte) (*ValidationError, error) {
 		message := l.friendlyErrorMessage(bestError)
 
 		return &ValidationError{
-			Message: message,
-			Path:    bestError.Field(),
-			Line:    1, // Will be set by caller
+			Message:         message,
+			Path:            bestError.Field(),
+			Line:            1, // Will be set by caller
+			UnknownProperty: bestError.Type() == "additional_property_not_allowed",
 		}, nil
 	}
 
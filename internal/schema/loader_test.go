@@ -39,6 +39,10 @@ func TestValidateJSON_InvalidProperty(t *testing.T) {
 		t.Error("Expected non-empty error message")
 	}
 
+	if !result.UnknownProperty {
+		t.Error("Expected the error to be marked as an unknown property")
+	}
+
 	// Should contain information about the invalid field
 	expectedSubstrings := []string{"invalid_field", "not allowed"}
 	for _, expected := range expectedSubstrings {
@@ -310,3 +314,29 @@ func containsSubstring(text, substring string) bool {
 
 	return false
 }
+
+func TestLoader_BundledSchema(t *testing.T) {
+	loader := NewLoader()
+
+	data, err := loader.GetSchemaData()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(data) == 0 {
+		t.Fatal("Expected bundled schema data")
+	}
+
+	version := loader.Version()
+	if version.Source != SchemaSource {
+		t.Errorf("Expected schema source %s, got %s", SchemaSource, version.Source)
+	}
+
+	if version.Commit != SchemaCommit {
+		t.Errorf("Expected schema commit %s, got %s", SchemaCommit, version.Commit)
+	}
+
+	if !containsSubstring(version.String(), SchemaSource) {
+		t.Errorf("Expected version string to mention the schema source, got: %s", version.String())
+	}
+}
@@ -0,0 +1,79 @@
+package schema
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+)
+
+// Property is a key the pipeline schema allows, with the schema's description of it
+type Property struct {
+	Name        string
+	Description string
+}
+
+// stepDefinitions name the schema definition of each step type
+var stepDefinitions = map[string]string{
+	"command": "commandStep",
+	"trigger": "triggerStep",
+	"group":   "groupStep",
+	"block":   "blockStep",
+	"input":   "inputStep",
+	"wait":    "waitStep",
+}
+
+// schemaObject is the part of a JSON schema describing an object's properties
+type schemaObject struct {
+	Description string                  `json:"description"`
+	Ref         string                  `json:"$ref"`
+	Properties  map[string]schemaObject `json:"properties"`
+}
+
+// PipelineProperties returns the top-level keys the schema allows, sorted by name
+func (l *Loader) PipelineProperties() []Property {
+	return l.properties()[""]
+}
+
+// StepProperties returns the keys the schema allows on a step of the type: command, trigger,
+// group, block, input or wait. It returns nil for other types.
+func (l *Loader) StepProperties(stepType string) []Property {
+	return l.properties()[stepType]
+}
+
+// properties reads the keys of the pipeline and of each step type from the schema once.
+// Keys without a description of their own take the description of the definition they
+// refer to.
+func (l *Loader) properties() map[string][]Property {
+	l.propertiesOnce.Do(func() {
+		l.propertiesByType = make(map[string][]Property)
+
+		var root struct {
+			schemaObject
+			Definitions map[string]schemaObject `json:"definitions"`
+		}
+		if err := json.Unmarshal(l.schemaData, &root); err != nil {
+			return
+		}
+
+		collect := func(object schemaObject) []Property {
+			properties := make([]Property, 0, len(object.Properties))
+			for name, property := range object.Properties {
+				description := property.Description
+				if description == "" {
+					description = root.Definitions[strings.TrimPrefix(property.Ref, "#/definitions/")].Description
+				}
+				properties = append(properties, Property{Name: name, Description: description})
+			}
+			slices.SortFunc(properties, func(a, b Property) int { return strings.Compare(a.Name, b.Name) })
+			return properties
+		}
+
+		l.propertiesByType[""] = collect(root.schemaObject)
+		for stepType, definition := range stepDefinitions {
+			if object, ok := root.Definitions[definition]; ok {
+				l.propertiesByType[stepType] = collect(object)
+			}
+		}
+	})
+	return l.propertiesByType
+}
@@ -0,0 +1,42 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoader_StepProperties(t *testing.T) {
+	loader := NewLoader()
+
+	descriptions := make(map[string]string)
+	for _, property := range loader.StepProperties("trigger") {
+		descriptions[property.Name] = property.Description
+	}
+	for _, name := range []string{"trigger", "async", "build", "skip", "soft_fail"} {
+		if _, ok := descriptions[name]; !ok {
+			t.Errorf("Expected trigger steps to take %s, got %v", name, descriptions)
+		}
+	}
+	if _, ok := descriptions["command"]; ok {
+		t.Error("Did not expect trigger steps to take command")
+	}
+
+	// Described by the definition the key refers to
+	if !strings.Contains(descriptions["skip"], "skipped") {
+		t.Errorf("Expected skip to take its definition's description, got %q", descriptions["skip"])
+	}
+
+	if properties := loader.StepProperties("unknown"); properties != nil {
+		t.Errorf("Expected no properties for an unknown step type, got %v", properties)
+	}
+}
+
+func TestLoader_PipelineProperties(t *testing.T) {
+	var names []string
+	for _, property := range NewLoader().PipelineProperties() {
+		names = append(names, property.Name)
+	}
+	if strings.Join(names, ",") != "agents,env,notify,steps" {
+		t.Errorf("Expected the top-level keys sorted by name, got %v", names)
+	}
+}
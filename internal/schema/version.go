@@ -0,0 +1,15 @@
+package schema
+
+// schema.json is a hand-maintained subset of the pipeline schema, covering the top-level
+// agents, env, notify and steps keys. Running gen.go replaces it, and this file, with the
+// upstream schema at a pinned commit.
+
+// SchemaSource is where schema.json was vendored from, or a note that it's maintained by hand
+const SchemaSource = "hand-maintained subset of the Buildkite pipeline schema"
+
+// SchemaCommit is the pipeline-schema commit that schema.json was vendored from, or "" when
+// it wasn't vendored
+const SchemaCommit = ""
+
+// SchemaFetchedAt records when schema.json was vendored, or "" when it wasn't
+const SchemaFetchedAt = ""
@@ -8,8 +8,12 @@ import (
 	"os"
 
 	"go.lsp.dev/jsonrpc2"
+	"go.lsp.dev/protocol"
 
+	"github.com/mcncl/buildkite-ls/internal/corpus"
 	"github.com/mcncl/buildkite-ls/internal/lsp"
+	"github.com/mcncl/buildkite-ls/internal/plugins"
+	"github.com/mcncl/buildkite-ls/internal/schema"
 )
 
 var (
@@ -33,9 +37,21 @@ func main() {
 		fmt.Printf("buildkite-ls %s\n", version)
 		fmt.Printf("Commit: %s\n", commit)
 		fmt.Printf("Built: %s\n", date)
+		fmt.Printf("Schema: %s\n", schema.NewLoader().Version())
 		return
 	}
 
+	switch flag.Arg(0) {
+	case "check-corpus":
+		os.Exit(checkCorpus(flag.Args()[1:]))
+	case "schema":
+		os.Exit(schemaCommand(flag.Args()[1:]))
+	case "plugins":
+		os.Exit(pluginsCommand(flag.Args()[1:]))
+	case "cache":
+		os.Exit(cacheCommand(flag.Args()[1:]))
+	}
+
 	server := lsp.NewServer()
 
 	var rw io.ReadWriteCloser = stdio{}
@@ -45,6 +61,159 @@ func main() {
 	// Set the connection in the server so it can send notifications
 	server.SetConnection(conn)
 
-	go conn.Go(context.Background(), server.Handler())
+	// Requests are handled one at a time, in order, off the connection's read loop, so
+	// $/cancelRequest is read while a request is running and cancels its context
+	handler := protocol.CancelHandler(jsonrpc2.AsyncHandler(server.Handler()))
+	go conn.Go(context.Background(), handler)
 	<-conn.Done()
 }
+
+// checkCorpus runs the diagnostic pipeline over a directory of sample pipelines and
+// compares the results with their golden files, returning the process exit code
+func checkCorpus(args []string) int {
+	flags := flag.NewFlagSet("check-corpus", flag.ExitOnError)
+	update := flags.Bool("update", false, "Rewrite golden files with the current diagnostics")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: buildkite-ls check-corpus [-update] <dir>\n")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	server := lsp.NewServer()
+	results, err := corpus.Run(flags.Arg(0), server.Diagnose, *update)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "check-corpus: %v\n", err)
+		return 1
+	}
+
+	failed := 0
+	for _, result := range results {
+		switch {
+		case result.Updated:
+			fmt.Printf("UPDATED %s\n", result.Golden)
+		case result.Passed():
+			fmt.Printf("ok      %s\n", result.Fixture)
+		default:
+			failed++
+			fmt.Printf("FAIL    %s\n", result.Fixture)
+			fmt.Printf("--- want (%s)\n%s", result.Golden, result.Want)
+			fmt.Printf("+++ got\n%s", result.Got)
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("%d of %d fixtures failed\n", failed, len(results))
+		return 1
+	}
+	return 0
+}
+
+// schemaCommand reports on the bundled pipeline schema: `schema version` prints which schema
+// the server validates against, and `schema dump` writes the schema itself to stdout
+func schemaCommand(args []string) int {
+	usage := func() int {
+		fmt.Fprintf(os.Stderr, "Usage: buildkite-ls schema <version|dump>\n")
+		return 2
+	}
+	if len(args) != 1 {
+		return usage()
+	}
+
+	loader := schema.NewLoader()
+	switch args[0] {
+	case "version":
+		fmt.Println(loader.Version())
+	case "dump":
+		data, err := loader.GetSchemaData()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "schema dump: %v\n", err)
+			return 1
+		}
+		if _, err := os.Stdout.Write(data); err != nil {
+			fmt.Fprintf(os.Stderr, "schema dump: %v\n", err)
+			return 1
+		}
+	default:
+		return usage()
+	}
+	return 0
+}
+
+// pluginsCommand handles `plugins fetch`, which downloads plugin schemas into the on-disk
+// cache so that images built for CI or air-gapped machines have them without network access
+func pluginsCommand(args []string) int {
+	if len(args) == 0 || args[0] != "fetch" {
+		fmt.Fprintf(os.Stderr, "Usage: buildkite-ls plugins fetch [-popular] [plugin...]\n")
+		return 2
+	}
+
+	flags := flag.NewFlagSet("plugins fetch", flag.ExitOnError)
+	popular := flags.Bool("popular", false, "Also fetch the latest version of every popular plugin")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: buildkite-ls plugins fetch [-popular] [plugin...]\n")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args[1:])
+
+	refs := flags.Args()
+	if *popular {
+		for _, plugin := range plugins.GetPopularPlugins() {
+			refs = append(refs, plugin.Name+"#"+plugin.Version)
+		}
+	}
+	if len(refs) == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	cacheDir := plugins.DefaultSchemaCacheDir()
+	if cacheDir == "" {
+		fmt.Fprintf(os.Stderr, "plugins fetch: no user cache directory to store schemas in\n")
+		return 1
+	}
+	registry := plugins.NewRegistry()
+	registry.SetSchemaCacheDir(cacheDir)
+
+	failed := 0
+	for _, ref := range refs {
+		if _, err := registry.FetchPluginSchema(context.Background(), ref); err != nil {
+			failed++
+			fmt.Printf("FAIL    %s: %v\n", ref, err)
+			continue
+		}
+		fmt.Printf("ok      %s\n", ref)
+	}
+
+	if failed > 0 {
+		fmt.Printf("%d of %d plugins failed\n", failed, len(refs))
+		return 1
+	}
+	fmt.Printf("Cached in %s\n", cacheDir)
+	return 0
+}
+
+// cacheCommand handles `cache clear`, which removes the cached plugin schemas and popular
+// plugins manifest
+func cacheCommand(args []string) int {
+	if len(args) != 1 || args[0] != "clear" {
+		fmt.Fprintf(os.Stderr, "Usage: buildkite-ls cache clear\n")
+		return 2
+	}
+
+	dir := plugins.CacheDir()
+	if dir == "" {
+		fmt.Println("No cache directory")
+		return 0
+	}
+	if err := plugins.ClearCache(dir); err != nil {
+		fmt.Fprintf(os.Stderr, "cache clear: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Cleared %s\n", dir)
+	return 0
+}